@@ -13,11 +13,14 @@ import (
 	"stock-report-analysis/internal/service"
 	"sync"
 
+	"github.com/fsnotify/fsnotify"
 	"github.com/wailsapp/wails/v2/pkg/runtime"
 )
 
 type App struct {
-	ctx context.Context
+	ctx   context.Context
+	store *db.Store
+	svc   *service.Service
 
 	batchMu             sync.Mutex
 	batchCond           *sync.Cond
@@ -38,64 +41,166 @@ type App struct {
 	telegraphCancel context.CancelFunc
 	telegraphRunSeq int64
 	telegraphOnce   sync.Once
+
+	folderWatchMu     sync.Mutex
+	folderWatchStatus models.FolderWatchStatus
+	folderWatchCancel context.CancelFunc
+	folderWatchRunSeq int64
+	folderWatchRescan bool
+	folderWatchOnce   sync.Once
+	folderWatcher     *fsnotify.Watcher
+
+	embeddingMu     sync.Mutex
+	embeddingStatus models.EmbeddingBackfillStatus
+	embeddingCancel context.CancelFunc
+
+	budgetMu      sync.Mutex
+	budgetAlerted map[string]bool
+
+	// eventSink replaces the Wails runtime as the event target when set.
+	eventSink func(name string, data ...any)
 }
 
 func NewApp() *App {
-	app := &App{}
+	app := &App{budgetAlerted: map[string]bool{}}
 	app.batchCond = sync.NewCond(&app.batchMu)
 	return app
 }
 
+// NewAppWithStore returns an App over an already opened database instead of
+// the default data.db, e.g. for another profile or a headless tool.
+func NewAppWithStore(store *db.Store) *App {
+	app := NewApp()
+	app.useStore(store)
+	return app
+}
+
+func (a *App) useStore(store *db.Store) {
+	a.store = store
+	a.svc = service.New(store)
+}
+
 func (a *App) startup(ctx context.Context) {
 	a.ctx = ctx
-	if err := db.Init(); err != nil {
-		runtime.LogFatal(ctx, "DB init failed: "+err.Error())
+	if a.store == nil {
+		path, err := db.DefaultPath()
+		if err != nil {
+			runtime.LogFatal(ctx, "DB init failed: "+err.Error())
+		}
+		store, err := db.Open(path)
+		if err != nil {
+			runtime.LogFatal(ctx, "DB init failed: "+err.Error())
+		}
+		a.useStore(store)
 	}
 	a.startTelegraphScheduler()
+	a.startFolderWatch()
+}
+
+func (a *App) shutdown(ctx context.Context) {
+	a.stopFolderWatchRun("")
+	a.stopEmbeddingBackfill()
+	a.folderWatchMu.Lock()
+	if a.folderWatcher != nil {
+		_ = a.folderWatcher.Close()
+	}
+	a.folderWatchMu.Unlock()
+	if a.store != nil {
+		_ = a.store.Close()
+	}
+}
+
+// emitEvent sends an event to the frontend. Events emitted before startup
+// (or without a Wails runtime) are dropped unless eventSink is set.
+func (a *App) emitEvent(name string, data ...any) {
+	if a.eventSink != nil {
+		a.eventSink(name, data...)
+		return
+	}
+	if a.ctx == nil {
+		return
+	}
+	runtime.EventsEmit(a.ctx, name, data...)
 }
 
 // --- AI Channels ---
 
 func (a *App) GetChannels() ([]models.AIChannel, error) {
-	return service.GetChannels()
+	return a.svc.GetChannels()
 }
 
 func (a *App) SaveChannel(ch models.AIChannel) error {
-	return service.SaveChannel(ch)
+	return a.svc.SaveChannel(ch)
 }
 
 func (a *App) DeleteChannel(id int64) error {
-	return service.DeleteChannel(id)
+	return a.svc.DeleteChannel(id)
+}
+
+func (a *App) GetAIFailoverConfig() (models.AIFailoverConfig, error) {
+	return a.svc.GetAIFailoverConfig()
+}
+
+func (a *App) SaveAIFailoverConfig(cfg models.AIFailoverConfig) error {
+	return a.svc.SaveAIFailoverConfig(cfg)
+}
+
+func (a *App) GetAIBudgetConfig() (models.AIBudgetConfig, error) {
+	return a.svc.GetAIBudgetConfig()
+}
+
+func (a *App) SaveAIBudgetConfig(cfg models.AIBudgetConfig) error {
+	return a.svc.SaveAIBudgetConfig(cfg)
+}
+
+func (a *App) GetAIBudgetStatus() (models.AIBudgetStatus, error) {
+	return a.svc.GetAIBudgetStatus()
+}
+
+func (a *App) GetAIResponseCacheConfig() (models.AIResponseCacheConfig, error) {
+	return a.svc.GetAIResponseCacheConfig()
+}
+
+func (a *App) SaveAIResponseCacheConfig(cfg models.AIResponseCacheConfig) error {
+	return a.svc.SaveAIResponseCacheConfig(cfg)
+}
+
+func (a *App) GetAIResponseCacheStats() (models.AIResponseCacheStats, error) {
+	return a.svc.GetAIResponseCacheStats()
+}
+
+func (a *App) ClearAIResponseCache() (int64, error) {
+	return a.svc.ClearAIResponseCache()
 }
 
 // --- Prompts ---
 
 func (a *App) GetPrompts() ([]models.Prompt, error) {
-	return service.GetPrompts()
+	return a.svc.GetPrompts()
 }
 
 func (a *App) SavePrompt(p models.Prompt) error {
-	return service.SavePrompt(p)
+	return a.svc.SavePrompt(p)
 }
 
 func (a *App) DeletePrompt(id int64) error {
-	return service.DeletePrompt(id)
+	return a.svc.DeletePrompt(id)
 }
 
 func (a *App) GetPromptVersions(promptID int64) ([]models.PromptVersion, error) {
-	return service.GetPromptVersions(promptID)
+	return a.svc.GetPromptVersions(promptID)
 }
 
 func (a *App) RestorePromptVersion(promptID int64, versionID int64) error {
-	return service.RestorePromptVersion(promptID, versionID)
+	return a.svc.RestorePromptVersion(promptID, versionID)
 }
 
 func (a *App) GetTelegraphSchedulerConfig() (models.TelegraphSchedulerConfig, error) {
-	return service.GetTelegraphSchedulerConfig()
+	return a.svc.GetTelegraphSchedulerConfig()
 }
 
 func (a *App) SaveTelegraphSchedulerConfig(cfg models.TelegraphSchedulerConfig) error {
-	if err := service.SaveTelegraphSchedulerConfig(cfg); err != nil {
+	if err := a.svc.SaveTelegraphSchedulerConfig(cfg); err != nil {
 		return err
 	}
 	if cfg.Enabled == 1 {
@@ -120,60 +225,145 @@ func (a *App) RunTelegraphSchedulerNow() error {
 }
 
 func (a *App) StopTelegraphScheduler() error {
-	cfg, err := service.GetTelegraphSchedulerConfig()
+	cfg, err := a.svc.GetTelegraphSchedulerConfig()
 	if err != nil {
 		return err
 	}
 	cfg.Enabled = 0
-	if err := service.SaveTelegraphSchedulerConfig(cfg); err != nil {
+	if err := a.svc.SaveTelegraphSchedulerConfig(cfg); err != nil {
 		return err
 	}
 	a.stopTelegraphRun("任务已停止")
 	return nil
 }
 
+func (a *App) GetFolderWatchConfig() (models.FolderWatchConfig, error) {
+	return a.svc.GetFolderWatchConfig()
+}
+
+func (a *App) SaveFolderWatchConfig(cfg models.FolderWatchConfig) error {
+	if err := a.svc.SaveFolderWatchConfig(cfg); err != nil {
+		return err
+	}
+	a.syncFolderWatchDirs()
+	if cfg.Enabled == 1 {
+		a.triggerFolderWatchRun(folderWatchManual)
+	} else {
+		a.stopFolderWatchRun("")
+	}
+	return nil
+}
+
+func (a *App) GetFolderWatchStatus() models.FolderWatchStatus {
+	a.folderWatchMu.Lock()
+	defer a.folderWatchMu.Unlock()
+	return a.folderWatchStatus
+}
+
+// RunFolderWatchNow scans the watched folders once, even while the watch
+// is off.
+func (a *App) RunFolderWatchNow() error {
+	cfg, err := a.svc.GetFolderWatchConfig()
+	if err != nil {
+		return err
+	}
+	if len(cfg.Dirs) == 0 {
+		return errors.New("请先添加监听文件夹")
+	}
+	if !a.triggerFolderWatchRun(folderWatchManual) {
+		return errors.New("文件夹扫描正在运行")
+	}
+	return nil
+}
+
+func (a *App) StopFolderWatchRun() {
+	a.stopFolderWatchRun("任务已停止")
+}
+
+func (a *App) GetEmbeddingConfig() (models.EmbeddingConfig, error) {
+	return a.svc.GetEmbeddingConfig()
+}
+
+func (a *App) SaveEmbeddingConfig(cfg models.EmbeddingConfig) error {
+	return a.svc.SaveEmbeddingConfig(cfg)
+}
+
+func (a *App) GetEmbeddingBackfillStatus() models.EmbeddingBackfillStatus {
+	a.embeddingMu.Lock()
+	defer a.embeddingMu.Unlock()
+	return a.embeddingStatus
+}
+
+// StartEmbeddingBackfill embeds, in the background, the sections of
+// articles that have no vector for the configured embedding model yet.
+func (a *App) StartEmbeddingBackfill() error {
+	cfg, err := a.svc.GetEmbeddingConfig()
+	if err != nil {
+		return err
+	}
+	if cfg.Enabled != 1 {
+		return errors.New("请先启用语义检索")
+	}
+	return a.startEmbeddingBackfill()
+}
+
+func (a *App) StopEmbeddingBackfill() {
+	a.stopEmbeddingBackfill()
+}
+
+func (a *App) GetWatchedFiles(limit int) ([]models.WatchedFile, error) {
+	return a.svc.GetWatchedFiles(limit)
+}
+
+// ChooseWatchFolder lets the user pick a folder to watch.
+func (a *App) ChooseWatchFolder() (string, error) {
+	return runtime.OpenDirectoryDialog(a.ctx, runtime.OpenDialogOptions{
+		Title: "选择要监听的文件夹",
+	})
+}
+
 // --- Articles ---
 
-func (a *App) GetArticles(keyword string, tagID int64) ([]models.Article, error) {
-	return service.GetArticles(keyword, tagID)
+func (a *App) GetArticles(q models.ArticleQuery) (models.ArticlePage, error) {
+	return a.svc.GetArticles(q)
 }
 
-func (a *App) GetTelegraphArticles(keyword string, tagID int64, order string, watchOnly int) ([]models.TelegraphArticleItem, error) {
-	return service.GetTelegraphArticles(keyword, tagID, order, watchOnly)
+func (a *App) GetTelegraphArticles(q models.ArticleQuery) (models.TelegraphArticlePage, error) {
+	return a.svc.GetTelegraphArticles(q)
 }
 
 func (a *App) GetTelegraphDashboard() (models.TelegraphDashboard, error) {
-	return service.GetTelegraphDashboardByDays(0)
+	return a.svc.GetTelegraphDashboardByDays(0)
 }
 
 func (a *App) GetTelegraphDashboardByDays(days int) (models.TelegraphDashboard, error) {
-	return service.GetTelegraphDashboardByDays(days)
+	return a.svc.GetTelegraphDashboardByDays(days)
 }
 
 func (a *App) GetTelegraphDigests(limit int) ([]models.TelegraphDigest, error) {
-	return service.GetTelegraphDigests(limit)
+	return a.svc.GetTelegraphDigests(limit)
 }
 
 func (a *App) GetTelegraphWatchlist() ([]models.WatchStock, error) {
-	return service.GetTelegraphWatchlist()
+	return a.svc.GetTelegraphWatchlist()
 }
 
 func (a *App) SaveTelegraphWatchlist(items []models.WatchStock) error {
-	if err := service.SaveTelegraphWatchlist(items); err != nil {
+	if err := a.svc.SaveTelegraphWatchlist(items); err != nil {
 		return err
 	}
-	return service.RebuildTelegraphWatchHits()
+	return a.svc.RebuildTelegraphWatchHits()
 }
 
 func (a *App) GetArticle(id int64) (models.Article, error) {
-	return service.GetArticle(id)
+	return a.svc.GetArticle(id)
 }
 
 func (a *App) DeleteArticle(id int64) error {
-	return service.DeleteArticle(id)
+	return a.svc.DeleteArticle(id)
 }
 
-func (a *App) ImportArticle() (models.Article, error) {
+func (a *App) ImportArticle() (models.ImportResult, error) {
 	path, err := runtime.OpenFileDialog(a.ctx, runtime.OpenDialogOptions{
 		Title: "选择文章文件",
 		Filters: []runtime.FileFilter{
@@ -181,12 +371,14 @@ func (a *App) ImportArticle() (models.Article, error) {
 		},
 	})
 	if err != nil || path == "" {
-		return models.Article{}, err
+		return models.ImportResult{}, err
 	}
-	return service.ImportFile(path)
+	return a.svc.ImportFile(path, false)
 }
 
-func (a *App) ImportArticles() ([]models.Article, error) {
+// ImportArticles imports the chosen files one by one. Duplicates come back
+// as results with Duplicate set; only failures are collected into the error.
+func (a *App) ImportArticles() ([]models.ImportResult, error) {
 	paths, err := runtime.OpenMultipleFilesDialog(a.ctx, runtime.OpenDialogOptions{
 		Title: "选择文章文件（可多选）",
 		Filters: []runtime.FileFilter{
@@ -196,87 +388,137 @@ func (a *App) ImportArticles() ([]models.Article, error) {
 	if err != nil || len(paths) == 0 {
 		return nil, err
 	}
-	var articles []models.Article
+	var results []models.ImportResult
 	var failed []string
 	for _, p := range paths {
-		art, err := service.ImportFile(p)
+		result, err := a.svc.ImportFile(p, false)
 		if err == nil {
-			articles = append(articles, art)
+			results = append(results, result)
 			continue
 		}
 		failed = append(failed, fmt.Sprintf("%s: %s", filepath.Base(p), err.Error()))
 	}
 
-	if len(articles) == 0 && len(failed) > 0 {
+	if len(results) == 0 && len(failed) > 0 {
 		msg := strings.Join(failed, "；")
 		if len(failed) > 3 {
 			msg = strings.Join(failed[:3], "；") + fmt.Sprintf("；另有 %d 个文件失败", len(failed)-3)
 		}
 		return nil, fmt.Errorf("导入失败：%s", msg)
 	}
-	return articles, nil
+	return results, nil
+}
+
+// ImportFilePath imports a file the user picked earlier, typically to
+// force in a file reported as a possible duplicate.
+func (a *App) ImportFilePath(path string, force bool) (models.ImportResult, error) {
+	return a.svc.ImportFile(path, force)
+}
+
+// ImportURL imports a web page or online document; force keeps a page
+// reported as a possible duplicate.
+func (a *App) ImportURL(url string, force bool) (models.ImportResult, error) {
+	return a.svc.ImportURL(url, force)
+}
+
+func (a *App) FindDuplicateArticles() ([]models.DuplicateGroup, error) {
+	return a.svc.FindDuplicateArticles()
+}
+
+func (a *App) MergeDuplicateArticles(keepID int64, duplicateIDs []int64) error {
+	return a.svc.MergeDuplicateArticles(keepID, duplicateIDs)
+}
+
+// GetArticleAssets returns the images and tables parsed out of the
+// article's source document; image URLs are served by articleAssetHandler.
+func (a *App) GetArticleAssets(articleID int64) ([]models.ArticleAsset, error) {
+	return a.svc.GetArticleAssets(articleID)
 }
 
 // --- Tags ---
 
 func (a *App) GetTags() ([]models.Tag, error) {
-	return service.GetTags()
+	return a.svc.GetTags()
 }
 
 func (a *App) SaveTag(t models.Tag) error {
-	return service.SaveTag(t)
+	return a.svc.SaveTag(t)
 }
 
 func (a *App) DeleteTag(id int64) error {
-	return service.DeleteTag(id)
+	return a.svc.DeleteTag(id)
 }
 
 func (a *App) GetArticleTags(articleID int64) ([]models.Tag, error) {
-	return service.GetArticleTags(articleID)
+	return a.svc.GetArticleTags(articleID)
 }
 
 func (a *App) SetArticleTags(articleID int64, tagIDs []int64) error {
-	return service.SetArticleTags(articleID, tagIDs)
+	return a.svc.SetArticleTags(articleID, tagIDs)
 }
 
 // --- Analysis History ---
 
+func (a *App) GetStructuredAnalysis(articleID int64) (*models.StructuredAnalysis, error) {
+	return a.svc.GetStructuredAnalysis(articleID)
+}
+
+func (a *App) SearchStructuredAnalyses(field string, keyword string, limit int) ([]models.StructuredAnalysisHit, error) {
+	return a.svc.SearchStructuredAnalyses(field, keyword, limit)
+}
+
+func (a *App) SearchFullText(query string, scope string, limit int) ([]models.SearchHit, error) {
+	return a.svc.SearchFullText(query, scope, limit)
+}
+
 func (a *App) GetAnalysisHistory(articleID int64) ([]models.AnalysisHistory, error) {
-	return service.GetAnalysisHistory(articleID)
+	return a.svc.GetAnalysisHistory(articleID)
 }
 
 func (a *App) GetAnalysisDashboard() (models.AnalysisDashboard, error) {
-	return service.GetAnalysisDashboard()
+	return a.svc.GetAnalysisDashboard()
 }
 
 func (a *App) GetAnalysisDashboardByDays(days int) (models.AnalysisDashboard, error) {
-	return service.GetAnalysisDashboardByDays(days)
+	return a.svc.GetAnalysisDashboardByDays(days)
 }
 
 func (a *App) GetMinerUConfig() (models.MinerUConfig, error) {
-	return service.GetMinerUConfig()
+	return a.svc.GetMinerUConfig()
 }
 
 func (a *App) SaveMinerUConfig(cfg models.MinerUConfig) error {
-	return service.SaveMinerUConfig(cfg)
+	return a.svc.SaveMinerUConfig(cfg)
+}
+
+func (a *App) ClearMinerUCache() (int64, error) {
+	return a.svc.ClearMinerUCache()
 }
 
 // --- Roles ---
 
 func (a *App) GetRoles() ([]models.Role, error) {
-	return service.GetRoles()
+	return a.svc.GetRoles()
 }
 
 func (a *App) SaveRole(role models.Role) error {
-	return service.SaveRole(role)
+	return a.svc.SaveRole(role)
 }
 
 func (a *App) DeleteRole(id int64) error {
-	return service.DeleteRole(id)
+	return a.svc.DeleteRole(id)
 }
 
 func (a *App) SetDefaultRole(id int64) error {
-	return service.SetDefaultRole(id)
+	return a.svc.SetDefaultRole(id)
+}
+
+func (a *App) GetQAModeratorConfig() (models.QAModeratorConfig, error) {
+	return a.svc.GetQAModeratorConfig()
+}
+
+func (a *App) SaveQAModeratorConfig(cfg models.QAModeratorConfig) error {
+	return a.svc.SaveQAModeratorConfig(cfg)
 }
 
 func (a *App) GetRoleTemplates() []models.RoleTemplate {
@@ -284,41 +526,56 @@ func (a *App) GetRoleTemplates() []models.RoleTemplate {
 }
 
 func (a *App) CreateRoleFromTemplate(templateID string) (models.Role, error) {
-	return service.CreateRoleFromTemplate(templateID)
+	return a.svc.CreateRoleFromTemplate(templateID)
 }
 
 // --- QA ---
 
 func (a *App) GetQASessions(articleID int64) ([]models.QASession, error) {
-	return service.GetQASessions(articleID)
+	return a.svc.GetQASessions(articleID)
 }
 
 func (a *App) CreateQASession(articleID int64, title string) (models.QASession, error) {
-	return service.CreateQASession(articleID, title)
+	return a.svc.CreateQASession(articleID, title)
+}
+
+// CreateScopedQASession creates a session asking across the articles of
+// scope; ask in it with AskQuestion and article ID 0.
+func (a *App) CreateScopedQASession(scope models.QAScope, title string) (models.QASession, error) {
+	return a.svc.CreateScopedQASession(scope, title)
+}
+
+func (a *App) GetScopedQASessions() ([]models.QASession, error) {
+	return a.svc.GetScopedQASessions()
+}
+
+// ResolveQAScope previews the articles a scope selects.
+func (a *App) ResolveQAScope(scope models.QAScope) ([]models.QAScopeArticle, error) {
+	return a.svc.ResolveQAScope(scope)
 }
 
 func (a *App) RenameQASession(id int64, title string) error {
-	return service.RenameQASession(id, title)
+	return a.svc.RenameQASession(id, title)
 }
 
 func (a *App) DeleteQASession(id int64) error {
-	return service.DeleteQASession(id)
+	return a.svc.DeleteQASession(id)
 }
 
 func (a *App) GetQAMessages(sessionID int64) ([]models.QAMessage, error) {
-	return service.GetQAMessages(sessionID)
+	return a.svc.GetQAMessages(sessionID)
 }
 
 func (a *App) GetQAPins(sessionID int64) ([]models.QAPin, error) {
-	return service.GetQAPins(sessionID)
+	return a.svc.GetQAPins(sessionID)
 }
 
 func (a *App) SaveQAPin(pin models.QAPin) (models.QAPin, error) {
-	return service.SaveQAPin(pin)
+	return a.svc.SaveQAPin(pin)
 }
 
 func (a *App) DeleteQAPin(id int64) error {
-	return service.DeleteQAPin(id)
+	return a.svc.DeleteQAPin(id)
 }
 
 func (a *App) DebugQAPing(marker string) string {
@@ -350,7 +607,7 @@ func (a *App) askQuestionWithFollowUp(sessionID int64, articleID int64, question
 	callbacks := service.QAStreamCallbacks{
 		OnJobStart: func(newSessionID int64, questionMessageID int64, roleCount int) {
 			log.Printf("[QA][App] job start session=%d question_message=%d roles=%d", newSessionID, questionMessageID, roleCount)
-			runtime.EventsEmit(a.ctx, "qa-job-start", map[string]any{
+			a.emitEvent("qa-job-start", map[string]any{
 				"sessionId":         newSessionID,
 				"questionMessageId": questionMessageID,
 				"roleCount":         roleCount,
@@ -358,10 +615,18 @@ func (a *App) askQuestionWithFollowUp(sessionID int64, articleID int64, question
 		},
 		OnRoleStart: func(msg models.QAMessage, _ models.Role) {
 			log.Printf("[QA][App] role start session=%d message=%d role=%d(%s)", msg.SessionID, msg.ID, msg.RoleID, msg.RoleName)
-			runtime.EventsEmit(a.ctx, "qa-role-start", msg)
+			a.emitEvent("qa-role-start", msg)
 		},
 		OnRoleChunk: func(messageID int64, roleID int64, roleName string, chunk string) {
-			runtime.EventsEmit(a.ctx, "qa-role-chunk", map[string]any{
+			a.emitEvent("qa-role-chunk", map[string]any{
+				"messageId": messageID,
+				"roleId":    roleID,
+				"roleName":  roleName,
+				"chunk":     chunk,
+			})
+		},
+		OnRoleReasoning: func(messageID int64, roleID int64, roleName string, chunk string) {
+			a.emitEvent("qa-role-reasoning-chunk", map[string]any{
 				"messageId": messageID,
 				"roleId":    roleID,
 				"roleName":  roleName,
@@ -370,20 +635,41 @@ func (a *App) askQuestionWithFollowUp(sessionID int64, articleID int64, question
 		},
 		OnRoleDone: func(msg models.QAMessage) {
 			log.Printf("[QA][App] role done session=%d message=%d role=%d(%s)", msg.SessionID, msg.ID, msg.RoleID, msg.RoleName)
-			runtime.EventsEmit(a.ctx, "qa-role-done", msg)
+			a.emitEvent("qa-role-done", msg)
 		},
 		OnRoleError: func(messageID int64, roleID int64, roleName string, errMsg string) {
 			log.Printf("[QA][App] role error message=%d role=%d(%s) err=%s", messageID, roleID, roleName, errMsg)
-			runtime.EventsEmit(a.ctx, "qa-role-error", map[string]any{
+			a.emitEvent("qa-role-error", map[string]any{
 				"messageId": messageID,
 				"roleId":    roleID,
 				"roleName":  roleName,
 				"error":     errMsg,
 			})
 		},
+		OnModeratorStart: func(msg models.QAMessage) {
+			log.Printf("[QA][App] moderator start session=%d message=%d role=%d(%s)", msg.SessionID, msg.ID, msg.RoleID, msg.RoleName)
+			a.emitEvent("qa-moderator-start", msg)
+		},
+		OnModeratorChunk: func(messageID int64, chunk string) {
+			a.emitEvent("qa-moderator-chunk", map[string]any{
+				"messageId": messageID,
+				"chunk":     chunk,
+			})
+		},
+		OnModeratorDone: func(msg models.QAMessage) {
+			log.Printf("[QA][App] moderator done session=%d message=%d", msg.SessionID, msg.ID)
+			a.emitEvent("qa-moderator-done", msg)
+		},
+		OnModeratorError: func(messageID int64, errMsg string) {
+			log.Printf("[QA][App] moderator error message=%d err=%s", messageID, errMsg)
+			a.emitEvent("qa-moderator-error", map[string]any{
+				"messageId": messageID,
+				"error":     errMsg,
+			})
+		},
 		OnJobDone: func(doneSessionID int64) {
 			log.Printf("[QA][App] job done session=%d", doneSessionID)
-			runtime.EventsEmit(a.ctx, "qa-job-done", map[string]any{
+			a.emitEvent("qa-job-done", map[string]any{
 				"sessionId": doneSessionID,
 			})
 		},
@@ -397,30 +683,30 @@ func (a *App) askQuestionWithFollowUp(sessionID int64, articleID int64, question
 				errMsg := fmt.Sprintf("问答任务异常: %v", r)
 				runtime.LogError(a.ctx, errMsg)
 				log.Printf("[QA][App] panic recovered: %s", errMsg)
-				runtime.EventsEmit(a.ctx, "qa-role-error", map[string]any{
+				a.emitEvent("qa-role-error", map[string]any{
 					"messageId": int64(0),
 					"roleId":    int64(0),
 					"roleName":  "",
 					"error":     errMsg,
 				})
-				runtime.EventsEmit(a.ctx, "qa-job-done", map[string]any{
+				a.emitEvent("qa-job-done", map[string]any{
 					"sessionId": sessionID,
 				})
 			}
 		}()
-		if _, err := service.AskQuestionWithContextAndFollowUp(ctx, sessionID, articleID, trimmed, followUpMessageID, callbacks); err != nil {
+		if _, err := a.svc.AskQuestionWithContextAndFollowUp(ctx, sessionID, articleID, trimmed, followUpMessageID, callbacks); err != nil {
 			errMsg := err.Error()
 			if errors.Is(err, context.Canceled) {
 				errMsg = "已取消本次提问"
 			}
 			log.Printf("[QA][App] ask failed input_session=%d article=%d err=%s", sessionID, articleID, err.Error())
-			runtime.EventsEmit(a.ctx, "qa-role-error", map[string]any{
+			a.emitEvent("qa-role-error", map[string]any{
 				"messageId": int64(0),
 				"roleId":    int64(0),
 				"roleName":  "",
 				"error":     errMsg,
 			})
-			runtime.EventsEmit(a.ctx, "qa-job-done", map[string]any{
+			a.emitEvent("qa-job-done", map[string]any{
 				"sessionId": sessionID,
 			})
 			return
@@ -466,17 +752,17 @@ func (a *App) clearActiveQACancel(token int64) {
 }
 
 func (a *App) GetQADashboard() (models.QADashboard, error) {
-	return service.GetQADashboardByDays(0)
+	return a.svc.GetQADashboardByDays(0)
 }
 
 func (a *App) GetQADashboardByDays(days int) (models.QADashboard, error) {
-	return service.GetQADashboardByDays(days)
+	return a.svc.GetQADashboardByDays(days)
 }
 
 // --- Export ---
 
 func (a *App) ExportArticle(articleID int64) error {
-	article, err := service.GetArticle(articleID)
+	article, err := a.svc.GetArticle(articleID)
 	if err != nil {
 		return err
 	}
@@ -490,14 +776,14 @@ func (a *App) ExportArticle(articleID int64) error {
 	if err != nil || path == "" {
 		return err
 	}
-	return service.ExportToFile(article, path)
+	return a.svc.ExportToFile(article, path)
 }
 
 // --- Batch Analysis ---
 
 func (a *App) BatchAnalyze(articleIDs []int64, channelID int64, promptID int64) {
 	if err := a.StartBatchAnalyze(articleIDs, channelID, promptID, 1, service.AnalysisModeText); err != nil {
-		runtime.EventsEmit(a.ctx, "batch-error", err.Error())
+		a.emitEvent("batch-error", err.Error())
 	}
 }
 
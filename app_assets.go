@@ -0,0 +1,37 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"net/http"
+	"strings"
+
+	"stock-report-analysis/internal/service"
+)
+
+// articleAssetHandler serves the images of parsed documents to the
+// frontend under service.ArticleAssetURLPrefix. The Wails asset server
+// only asks it for paths the embedded frontend does not contain.
+func (a *App) articleAssetHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rest, ok := strings.CutPrefix(r.URL.Path, service.ArticleAssetURLPrefix)
+		if !ok || a.svc == nil || (r.Method != http.MethodGet && r.Method != http.MethodHead) {
+			http.NotFound(w, r)
+			return
+		}
+		fileHash, name, _ := strings.Cut(rest, "/")
+		data, contentType, err := a.svc.ReadArticleAsset(fileHash, name)
+		if errors.Is(err, fs.ErrNotExist) {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", contentType)
+		// A hash names the same bytes forever.
+		w.Header().Set("Cache-Control", "max-age=31536000, immutable")
+		_, _ = w.Write(data)
+	})
+}
@@ -1,17 +1,18 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"encoding/csv"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"log"
 	"os"
 	"sort"
 	"strings"
 	"time"
 
-	"stock-report-analysis/internal/db"
 	"stock-report-analysis/internal/models"
 	"stock-report-analysis/internal/service"
 
@@ -31,7 +32,7 @@ type batchSnapshot struct {
 func (a *App) analyzeArticleWithMode(articleID int64, channelID int64, promptID int64, mode string) string {
 	mode = normalizeAnalysisMode(mode)
 
-	article, err := service.GetArticle(articleID)
+	article, err := a.svc.GetArticle(articleID)
 	if err != nil {
 		return "错误: 获取文章失败 - " + err.Error()
 	}
@@ -40,27 +41,29 @@ func (a *App) analyzeArticleWithMode(articleID int64, channelID int64, promptID
 		return "错误: " + err.Error()
 	}
 
-	if err := service.UpdateArticleStatus(articleID, 1); err != nil {
+	if err := a.svc.UpdateArticleStatus(articleID, 1); err != nil {
 		return "错误: 更新状态失败 - " + err.Error()
 	}
 
-	startedAt := time.Now()
-	result, err := service.AnalyzeArticleDetailed(*channel, prompt.Content, article.Content, mode, func(chunk string) {
-		runtime.EventsEmit(a.ctx, "analysis-chunk", chunk)
+	cacheCfg, _ := a.svc.GetAIResponseCacheConfig()
+	attempt, structured, err := a.analyzeWithFailover(context.Background(), articleID, *channel, prompt, mode, article.Content, cacheCfg.Single, func(chunk string) {
+		a.emitEvent("analysis-chunk", chunk)
+	}, func(chunk string) {
+		a.emitEvent("analysis-reasoning-chunk", chunk)
 	})
 	if err != nil {
-		_ = service.UpdateArticleStatus(articleID, 0)
-		a.recordAnalysisRun(articleID, channel, prompt, mode, result, classifyErrorReason(err), startedAt, false)
+		_ = a.svc.UpdateArticleStatus(articleID, 0)
+		a.recordAnalysisRun(articleID, prompt, mode, attempt, classifyErrorReason(err), false)
 		return "错误: " + err.Error()
 	}
 
-	if err := service.UpdateArticleAnalysis(articleID, result.Text, prompt.Name, channel.Name); err != nil {
-		_ = service.UpdateArticleStatus(articleID, 0)
-		a.recordAnalysisRun(articleID, channel, prompt, mode, result, "save_error", startedAt, false)
+	if err := a.svc.SaveArticleAnalysis(articleID, analysisOutcome(prompt, attempt, structured)); err != nil {
+		_ = a.svc.UpdateArticleStatus(articleID, 0)
+		a.recordAnalysisRun(articleID, prompt, mode, attempt, "save_error", false)
 		return "错误: 保存分析结果失败 - " + err.Error()
 	}
 
-	a.recordAnalysisRun(articleID, channel, prompt, mode, result, "", startedAt, true)
+	a.recordAnalysisRun(articleID, prompt, mode, attempt, "", true)
 	return ""
 }
 
@@ -126,6 +129,7 @@ func (a *App) pauseBatchAnalyze() error {
 		return errors.New("当前没有运行中的批量任务")
 	}
 	a.batchStatus.Paused = true
+	a.batchStatus.PauseReason = ""
 	status := cloneBatchStatus(a.batchStatus)
 	snapshotChannelID := a.batchChannel.ID
 	snapshotPromptID := a.batchPrompt.ID
@@ -144,6 +148,7 @@ func (a *App) resumeBatchAnalyze() error {
 		return errors.New("当前没有运行中的批量任务")
 	}
 	a.batchStatus.Paused = false
+	a.batchStatus.PauseReason = ""
 	a.batchCond.Broadcast()
 	status := cloneBatchStatus(a.batchStatus)
 	snapshotChannelID := a.batchChannel.ID
@@ -189,14 +194,16 @@ func (a *App) getBatchStatus() models.BatchStatus {
 	if !a.batchSnapshotLoaded {
 		a.loadBatchSnapshotLocked()
 	}
-	return cloneBatchStatus(a.batchStatus)
+	status := cloneBatchStatus(a.batchStatus)
+	a.applyLimiterStats(&status, a.batchChannel.ID)
+	return status
 }
 
 func (a *App) loadBatchSnapshotLocked() {
 	a.batchSnapshotLoaded = true
 
 	var raw string
-	err := db.DB.Get(&raw, "SELECT value FROM app_configs WHERE key=?", batchSnapshotConfigKey)
+	err := a.store.DB.Get(&raw, "SELECT value FROM app_configs WHERE key=?", batchSnapshotConfigKey)
 	if err != nil {
 		if !errors.Is(err, sql.ErrNoRows) && a.ctx != nil {
 			runtime.LogWarning(a.ctx, "load batch snapshot failed: "+err.Error())
@@ -218,6 +225,7 @@ func (a *App) loadBatchSnapshotLocked() {
 	// after app restart there is no live worker, mark as not running
 	snap.Status.Running = false
 	snap.Status.Paused = false
+	snap.Status.PauseReason = ""
 	a.batchStatus = snap.Status
 	a.batchFailures = cloneBatchStatus(snap.Status).Failures
 	a.batchChannel = models.AIChannel{ID: snap.ChannelID}
@@ -245,7 +253,7 @@ func (a *App) persistBatchSnapshot(status models.BatchStatus, channelID int64, p
 		return
 	}
 
-	_, err = db.DB.Exec(`
+	_, err = a.store.DB.Exec(`
 		INSERT INTO app_configs(key, value, updated_at)
 		VALUES(?, ?, CURRENT_TIMESTAMP)
 		ON CONFLICT(key) DO UPDATE SET value=excluded.value, updated_at=CURRENT_TIMESTAMP
@@ -317,10 +325,31 @@ func (a *App) batchDispatchLoop() {
 				a.batchMu.Unlock()
 				a.persistBatchSnapshot(status, snapshotChannelID, snapshotPromptID, snapshotMode)
 				a.emitBatchStatus(status)
-				runtime.EventsEmit(a.ctx, "batch-done", nil)
+				a.emitEvent("batch-done", nil)
 				return
 			}
 
+			if len(a.batchPending) > 0 && a.batchStatus.InProgress < a.batchStatus.Concurrency && !a.batchStatus.Paused {
+				// The budget query runs unlocked; the state is re-read after.
+				a.batchMu.Unlock()
+				budget, exceeded := a.checkAIBudget("batch")
+				a.batchMu.Lock()
+				if exceeded && a.batchStatus.Running && !a.batchStatus.Paused {
+					a.batchStatus.Paused = true
+					a.batchStatus.PauseReason = budget.Reason
+					status := cloneBatchStatus(a.batchStatus)
+					snapshotChannelID := a.batchChannel.ID
+					snapshotPromptID := a.batchPrompt.ID
+					snapshotMode := a.batchMode
+					a.batchMu.Unlock()
+					log.Printf("[AI] batch paused: %s", budget.Reason)
+					a.persistBatchSnapshot(status, snapshotChannelID, snapshotPromptID, snapshotMode)
+					a.emitBatchStatus(status)
+					a.batchMu.Lock()
+					continue
+				}
+			}
+
 			dispatched := false
 			for len(a.batchPending) > 0 && a.batchStatus.InProgress < a.batchStatus.Concurrency && !a.batchStatus.Paused {
 				articleID := a.batchPending[0]
@@ -342,36 +371,39 @@ func (a *App) batchDispatchLoop() {
 }
 
 func (a *App) runBatchArticle(articleID int64, channel models.AIChannel, prompt models.Prompt, mode string) {
-	article, err := service.GetArticle(articleID)
+	article, err := a.svc.GetArticle(articleID)
 	if err != nil {
-		a.finishBatchArticle(articleID, "", "获取文章失败: "+err.Error(), channel, prompt, mode, service.AnalysisResult{}, time.Now(), false)
+		a.finishBatchArticle(articleID, "", fmt.Errorf("获取文章失败: %w", err), &prompt, mode, service.AnalysisAttempt{Channel: channel, StartedAt: time.Now()})
 		return
 	}
 
-	startedAt := time.Now()
-	_ = service.UpdateArticleStatus(articleID, 1)
-	result, err := service.AnalyzeArticleDetailed(channel, prompt.Content, article.Content, mode, func(string) {})
+	_ = a.svc.UpdateArticleStatus(articleID, 1)
+	cacheCfg, _ := a.svc.GetAIResponseCacheConfig()
+	attempt, structured, err := a.analyzeWithFailover(context.Background(), articleID, channel, &prompt, mode, article.Content, cacheCfg.Batch, func(string) {}, nil)
 	if err != nil {
-		_ = service.UpdateArticleStatus(articleID, 0)
-		a.finishBatchArticle(articleID, article.Title, "解读失败: "+err.Error(), channel, prompt, mode, result, startedAt, false)
+		_ = a.svc.UpdateArticleStatus(articleID, 0)
+		a.finishBatchArticle(articleID, article.Title, fmt.Errorf("解读失败: %w", err), &prompt, mode, attempt)
 		return
 	}
 
-	if err := service.UpdateArticleAnalysis(articleID, result.Text, prompt.Name, channel.Name); err != nil {
-		_ = service.UpdateArticleStatus(articleID, 0)
-		a.finishBatchArticle(articleID, article.Title, "保存失败: "+err.Error(), channel, prompt, mode, result, startedAt, false)
+	if err := a.svc.SaveArticleAnalysis(articleID, analysisOutcome(&prompt, attempt, structured)); err != nil {
+		_ = a.svc.UpdateArticleStatus(articleID, 0)
+		a.finishBatchArticle(articleID, article.Title, fmt.Errorf("保存失败: %w", err), &prompt, mode, attempt)
 		return
 	}
 
-	a.finishBatchArticle(articleID, article.Title, "", channel, prompt, mode, result, startedAt, true)
+	a.finishBatchArticle(articleID, article.Title, nil, &prompt, mode, attempt)
 }
 
-func (a *App) finishBatchArticle(articleID int64, title string, rawError string, channel models.AIChannel, prompt models.Prompt, mode string, result service.AnalysisResult, startedAt time.Time, success bool) {
-	errorReason := ""
+// finishBatchArticle records the outcome of one article; err is nil on
+// success and keeps its chain so the run gets the right error_reason.
+func (a *App) finishBatchArticle(articleID int64, title string, err error, prompt *models.Prompt, mode string, attempt service.AnalysisAttempt) {
+	success := err == nil
+	rawError := ""
 	if !success {
-		errorReason = classifyErrorReason(errors.New(rawError))
+		rawError = err.Error()
 	}
-	a.recordAnalysisRun(articleID, &channel, &prompt, mode, result, errorReason, startedAt, success)
+	a.recordAnalysisRun(articleID, prompt, mode, attempt, classifyErrorReason(err), success)
 
 	a.batchMu.Lock()
 	a.batchStatus.InProgress--
@@ -396,9 +428,9 @@ func (a *App) finishBatchArticle(articleID int64, title string, rawError string,
 	a.batchMu.Unlock()
 	a.persistBatchSnapshot(status, snapshotChannelID, snapshotPromptID, snapshotMode)
 
-	runtime.EventsEmit(a.ctx, "batch-progress", map[string]int{"current": status.Completed, "total": status.Total})
+	a.emitEvent("batch-progress", map[string]int{"current": status.Completed, "total": status.Total})
 	if !success {
-		runtime.EventsEmit(a.ctx, "batch-error", rawError)
+		a.emitEvent("batch-error", rawError)
 	}
 	a.emitBatchStatus(status)
 
@@ -408,11 +440,22 @@ func (a *App) finishBatchArticle(articleID int64, title string, rawError string,
 }
 
 func (a *App) emitBatchStatus(status models.BatchStatus) {
-	runtime.EventsEmit(a.ctx, "batch-status", status)
+	a.batchMu.Lock()
+	channelID := a.batchChannel.ID
+	a.batchMu.Unlock()
+	a.applyLimiterStats(&status, channelID)
+	a.emitEvent("batch-status", status)
+}
+
+func (a *App) applyLimiterStats(status *models.BatchStatus, channelID int64) {
+	stats := a.svc.GetChannelLimiterStats(channelID)
+	status.QueueDepth = stats.QueueDepth
+	status.AvgWaitMs = stats.AvgWaitMs
+	status.MaxWaitMs = stats.MaxWaitMs
 }
 
 func (a *App) getChannelAndPrompt(channelID int64, promptID int64) (*models.AIChannel, *models.Prompt, error) {
-	channels, err := service.GetChannels()
+	channels, err := a.svc.GetChannels()
 	if err != nil {
 		return nil, nil, fmt.Errorf("获取渠道失败 - %w", err)
 	}
@@ -427,7 +470,7 @@ func (a *App) getChannelAndPrompt(channelID int64, promptID int64) (*models.AICh
 		return nil, nil, fmt.Errorf("未找到 AI 渠道 (id=%d)，请先在设置中添加", channelID)
 	}
 
-	prompts, err := service.GetPrompts()
+	prompts, err := a.svc.GetPrompts()
 	if err != nil {
 		return nil, nil, fmt.Errorf("获取提示词失败 - %w", err)
 	}
@@ -445,27 +488,89 @@ func (a *App) getChannelAndPrompt(channelID int64, promptID int64) (*models.AICh
 	return channel, prompt, nil
 }
 
-func (a *App) recordAnalysisRun(articleID int64, channel *models.AIChannel, prompt *models.Prompt, mode string, result service.AnalysisResult, reason string, startedAt time.Time, success bool) {
+// analyzeWithFailover runs one analysis through the channel's retry policy
+// and the configured fallback channels, recording every failed attempt that
+// was followed by another one. The final attempt is left to the caller.
+// Content larger than the channel's context window is analyzed section by
+// section and merged. Structured-mode replies are validated (and repaired
+// once) before return. useCache lets identical requests reuse a stored
+// reply. onReasoning may be nil.
+func (a *App) analyzeWithFailover(ctx context.Context, articleID int64, channel models.AIChannel, prompt *models.Prompt, mode string, content string, useCache bool, onChunk func(string), onReasoning func(string)) (service.AnalysisAttempt, *models.StructuredAnalysis, error) {
+	fallbacks, err := a.svc.FallbackChannelsFor(channel)
+	if err != nil {
+		log.Printf("[AI] load fallback channels failed: %s", err.Error())
+	}
+	req := service.AnalysisRequest{
+		Channel:     channel,
+		Prompt:      prompt.Content,
+		Content:     content,
+		Mode:        mode,
+		Schema:      prompt.OutputSchema,
+		Options:     prompt.GenerationOptions,
+		OnReasoning: onReasoning,
+		UseCache:    useCache,
+	}
+	attempt, err := a.svc.AnalyzeWithContextFit(ctx, req, fallbacks, onChunk, func(failed service.AnalysisAttempt) {
+		log.Printf("[AI] attempt %d failed article=%d channel=%d(%s) err=%s", failed.Attempt, articleID, failed.Channel.ID, failed.Channel.Name, failed.Err.Error())
+		a.recordAnalysisRun(articleID, prompt, mode, failed, classifyErrorReason(failed.Err), false)
+	})
+	if err != nil || normalizeAnalysisMode(mode) != service.AnalysisModeStructured {
+		return attempt, nil, err
+	}
+
+	req.Channel = attempt.Channel
+	result, structured, err := a.svc.EnsureStructuredAnalysis(ctx, req, attempt.Result)
+	attempt.Result = result
+	if err != nil {
+		return attempt, nil, err
+	}
+	return attempt, &structured, nil
+}
+
+// analysisOutcome keeps the reasoning only when the channel that answered
+// is set to store it.
+func analysisOutcome(prompt *models.Prompt, attempt service.AnalysisAttempt, structured *models.StructuredAnalysis) service.AnalysisOutcome {
+	out := service.AnalysisOutcome{
+		Analysis:    attempt.Result.Text,
+		PromptUsed:  prompt.Name,
+		ChannelUsed: attempt.Channel.Name,
+		Structured:  structured,
+	}
+	if attempt.Channel.StoreReasoning == 1 {
+		out.Reasoning = attempt.Result.Reasoning
+	}
+	return out
+}
+
+func (a *App) recordAnalysisRun(articleID int64, prompt *models.Prompt, mode string, attempt service.AnalysisAttempt, reason string, success bool) {
+	channel := attempt.Channel
+	result := attempt.Result
 	durationMs := result.DurationMs
 	if durationMs <= 0 {
-		durationMs = time.Since(startedAt).Milliseconds()
+		durationMs = time.Since(attempt.StartedAt).Milliseconds()
 	}
+	cost, currency := service.ChannelCost(channel, result.PromptTokens, result.CompletionTokens)
 
 	run := models.AnalysisRun{
-		ArticleID:        articleID,
-		ChannelID:        channel.ID,
-		ChannelName:      channel.Name,
-		PromptID:         prompt.ID,
-		PromptName:       prompt.Name,
-		Mode:             normalizeAnalysisMode(mode),
-		Success:          boolToInt(success),
-		ErrorReason:      reason,
-		DurationMs:       durationMs,
-		PromptTokens:     result.PromptTokens,
-		CompletionTokens: result.CompletionTokens,
-		TotalTokens:      result.TotalTokens,
-	}
-	_ = service.RecordAnalysisRun(run)
+		ArticleID:         articleID,
+		ChannelID:         channel.ID,
+		ChannelName:       channel.Name,
+		PromptID:          prompt.ID,
+		PromptName:        prompt.Name,
+		Mode:              normalizeAnalysisMode(mode),
+		Attempt:           attempt.Attempt,
+		Success:           boolToInt(success),
+		ErrorReason:       reason,
+		DurationMs:        durationMs,
+		PromptTokens:      result.PromptTokens,
+		CompletionTokens:  result.CompletionTokens,
+		TotalTokens:       result.TotalTokens,
+		GenerationOptions: prompt.GenerationOptions,
+		CacheHit:          boolToInt(result.CacheHit),
+		Cost:              cost,
+		Currency:          currency,
+	}
+	_ = a.svc.RecordAnalysisRun(run)
 }
 
 func normalizeAnalysisMode(mode string) string {
@@ -479,6 +584,11 @@ func classifyErrorReason(err error) string {
 	if err == nil {
 		return ""
 	}
+	// Checked first: a schema path like "$.rate" must not read as a rate limit.
+	var schemaErr *service.SchemaViolationError
+	if errors.As(err, &schemaErr) {
+		return "schema_violation"
+	}
 	msg := strings.ToLower(err.Error())
 	switch {
 	case strings.Contains(msg, "timeout"), strings.Contains(msg, "deadline"):
@@ -493,6 +603,8 @@ func classifyErrorReason(err error) string {
 		return "network"
 	case strings.Contains(msg, "save"):
 		return "save_error"
+	case strings.Contains(msg, "结构化结果"):
+		return "invalid_json"
 	default:
 		return "other"
 	}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"stock-report-analysis/internal/llmtest"
+	"stock-report-analysis/internal/models"
+	"stock-report-analysis/internal/service"
+)
+
+func saveTestPrompt(t *testing.T, app *App) models.Prompt {
+	t.Helper()
+	if err := app.svc.SavePrompt(models.Prompt{Name: "测试提示词", Content: "请解读这篇报告", IsDefault: 1}); err != nil {
+		t.Fatalf("save prompt: %v", err)
+	}
+	prompts, err := app.svc.GetPrompts()
+	if err != nil || len(prompts) == 0 {
+		t.Fatalf("load prompts: %v", err)
+	}
+	return prompts[0]
+}
+
+func waitForEvent(t *testing.T, events *testEvents, name string) {
+	t.Helper()
+	timeout := time.After(10 * time.Second)
+	for {
+		if len(events.named(name)) > 0 {
+			return
+		}
+		select {
+		case <-events.notify:
+		case <-time.After(50 * time.Millisecond):
+		case <-timeout:
+			t.Fatalf("timed out waiting for %s", name)
+		}
+	}
+}
+
+func TestBatchAnalyzeDispatchesAll(t *testing.T) {
+	app, events := newTestApp(t)
+	srv := llmtest.New(t)
+	srv.Handle(func(req llmtest.Request) (llmtest.Reply, bool) {
+		if strings.Contains(req.User(), "失败") {
+			return llmtest.Status(http.StatusBadRequest, "rejected"), true
+		}
+		return llmtest.Reply{Chunks: []string{"解读:", req.User()}, Usage: &llmtest.Usage{TotalTokens: 10}}, true
+	})
+	channel := saveTestChannel(t, app, srv)
+	prompt := saveTestPrompt(t, app)
+
+	ids := []int64{
+		insertTestArticle(t, app, "a", "文章一"),
+		insertTestArticle(t, app, "b", "文章二"),
+		insertTestArticle(t, app, "c", "文章三"),
+		insertTestArticle(t, app, "d", "这篇会失败"),
+	}
+	if err := app.startBatchAnalyze(ids, channel.ID, prompt.ID, 2, service.AnalysisModeText); err != nil {
+		t.Fatalf("start batch: %v", err)
+	}
+	waitForEvent(t, events, "batch-done")
+
+	status := app.getBatchStatus()
+	if status.Running || status.Total != 4 || status.Success != 3 || status.Failed != 1 {
+		t.Fatalf("status = %+v", status)
+	}
+	if len(status.Failures) != 1 || status.Failures[0].ArticleID != ids[3] {
+		t.Errorf("failures = %+v", status.Failures)
+	}
+	if got := len(events.named("batch-progress")); got != 4 {
+		t.Errorf("batch-progress events = %d, want 4", got)
+	}
+	if got := len(events.named("batch-error")); got != 1 {
+		t.Errorf("batch-error events = %d, want 1", got)
+	}
+
+	article, err := app.svc.GetArticle(ids[0])
+	if err != nil {
+		t.Fatalf("get article: %v", err)
+	}
+	if article.Analysis != "解读:文章一" || article.Status != 2 {
+		t.Errorf("article = %q status %d", article.Analysis, article.Status)
+	}
+	var runs []struct {
+		Success int    `db:"success"`
+		Tokens  int    `db:"total_tokens"`
+		Reason  string `db:"error_reason"`
+	}
+	if err := app.store.DB.Select(&runs, "SELECT success, total_tokens, error_reason FROM analysis_runs ORDER BY id"); err != nil {
+		t.Fatalf("runs: %v", err)
+	}
+	if len(runs) != 4 {
+		t.Fatalf("runs = %+v", runs)
+	}
+	succeeded := 0
+	for _, run := range runs {
+		succeeded += run.Success
+	}
+	if succeeded != 3 {
+		t.Errorf("successful runs = %d, want 3", succeeded)
+	}
+}
+
+func TestBatchAnalyzePausesOnBudget(t *testing.T) {
+	app, events := newTestApp(t)
+	srv := llmtest.New(t)
+	srv.SetFallback(llmtest.Reply{Chunks: []string{"ok"}, Usage: &llmtest.Usage{PromptTokens: 1_000_000, CompletionTokens: 0}})
+	ch := srv.Channel()
+	ch.ID = 0
+	ch.IsDefault = 1
+	ch.InputPrice = 5
+	if err := app.svc.SaveChannel(ch); err != nil {
+		t.Fatalf("save channel: %v", err)
+	}
+	channels, _ := app.svc.GetChannels()
+	prompt := saveTestPrompt(t, app)
+	if err := app.svc.SaveAIBudgetConfig(models.AIBudgetConfig{DailyLimit: 4}); err != nil {
+		t.Fatalf("save budget: %v", err)
+	}
+
+	ids := []int64{insertTestArticle(t, app, "a", "一"), insertTestArticle(t, app, "b", "二"), insertTestArticle(t, app, "c", "三")}
+	if err := app.startBatchAnalyze(ids, channels[0].ID, prompt.ID, 1, service.AnalysisModeText); err != nil {
+		t.Fatalf("start batch: %v", err)
+	}
+	waitForEvent(t, events, "ai-budget-exceeded")
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		status := app.getBatchStatus()
+		if status.Paused && status.InProgress == 0 {
+			if status.Completed != 1 || status.PauseReason == "" {
+				t.Fatalf("status = %+v", status)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("batch not paused: %+v", status)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if got := len(srv.Requests()); got != 1 {
+		t.Errorf("requests = %d, want 1", got)
+	}
+	if len(events.named("batch-done")) != 0 {
+		t.Error("paused batch should not finish")
+	}
+}
+
+func TestBatchAnalyzeRecordsSchemaViolation(t *testing.T) {
+	app, events := newTestApp(t)
+	srv := llmtest.New(t)
+	// Valid JSON without valuationView, also after the repair request.
+	srv.SetFallback(llmtest.Text(`{"summary": "营收增长", "risks": [], "catalysts": []}`))
+	channel := saveTestChannel(t, app, srv)
+	prompt := saveTestPrompt(t, app)
+	id := insertTestArticle(t, app, "a", "文章一")
+
+	if err := app.startBatchAnalyze([]int64{id}, channel.ID, prompt.ID, 1, service.AnalysisModeStructured); err != nil {
+		t.Fatalf("start batch: %v", err)
+	}
+	waitForEvent(t, events, "batch-done")
+
+	if status := app.getBatchStatus(); status.Failed != 1 || !strings.Contains(status.Failures[0].Reason, "valuationView") {
+		t.Fatalf("status = %+v", status)
+	}
+	var reasons []string
+	if err := app.store.DB.Select(&reasons, "SELECT error_reason FROM analysis_runs"); err != nil {
+		t.Fatalf("runs: %v", err)
+	}
+	if len(reasons) != 1 || reasons[0] != "schema_violation" {
+		t.Errorf("error reasons = %v", reasons)
+	}
+}
+
+func TestBatchAnalyzeMapReducesLongArticle(t *testing.T) {
+	app, events := newTestApp(t)
+	srv := llmtest.New(t)
+	marks := []string{"甲", "乙", "丙"}
+	srv.Handle(func(req llmtest.Request) (llmtest.Reply, bool) {
+		if !strings.Contains(req.System(), "分段阅读") {
+			return llmtest.Reply{Chunks: []string{"完整解读"}, Usage: &llmtest.Usage{PromptTokens: 50, CompletionTokens: 200, TotalTokens: 250}}, true
+		}
+		for _, mark := range marks {
+			if strings.Contains(req.User(), mark) {
+				return llmtest.Reply{Chunks: []string{"要点" + mark}, Usage: &llmtest.Usage{PromptTokens: 100, CompletionTokens: 10, TotalTokens: 110}}, true
+			}
+		}
+		return llmtest.Reply{}, false
+	})
+	ch := srv.Channel()
+	ch.ID = 0
+	ch.IsDefault = 1
+	// Leaves about 690 tokens for the article and 580 for each section.
+	ch.ContextWindow = 3000
+	ch.InputPrice = 2
+	ch.OutputPrice = 8
+	if err := app.svc.SaveChannel(ch); err != nil {
+		t.Fatalf("save channel: %v", err)
+	}
+	channels, _ := app.svc.GetChannels()
+	prompt := saveTestPrompt(t, app)
+	paragraphs := make([]string, len(marks))
+	for i, mark := range marks {
+		paragraphs[i] = strings.Repeat(mark, 500)
+	}
+	id := insertTestArticle(t, app, "长报告", strings.Join(paragraphs, "\n\n"))
+
+	if err := app.startBatchAnalyze([]int64{id}, channels[0].ID, prompt.ID, 1, service.AnalysisModeText); err != nil {
+		t.Fatalf("start batch: %v", err)
+	}
+	waitForEvent(t, events, "batch-done")
+	if status := app.getBatchStatus(); status.Success != 1 {
+		t.Fatalf("status = %+v", status)
+	}
+
+	requests := srv.Requests()
+	if len(requests) != len(marks)+1 {
+		t.Fatalf("requests = %d, want %d map and 1 reduce", len(requests), len(marks))
+	}
+	for i, req := range requests[:len(marks)] {
+		if !strings.Contains(req.System(), "分段阅读") || strings.Count(req.User(), marks[i]) != 500 {
+			t.Errorf("map request %d: system = %q, user has %d marks", i+1, req.System(), strings.Count(req.User(), marks[i]))
+		}
+	}
+	reduce := requests[len(marks)]
+	if reduce.System() != prompt.Content {
+		t.Errorf("reduce system = %q", reduce.System())
+	}
+	want := "【第 1 段要点】\n要点甲\n\n【第 2 段要点】\n要点乙\n\n【第 3 段要点】\n要点丙"
+	if user := reduce.User(); !strings.HasPrefix(user, "以下是一篇长篇研究报告") || !strings.HasSuffix(user, want) || strings.Contains(user, marks[0]+marks[0]) {
+		t.Errorf("reduce input = %q", user)
+	}
+
+	var runs []models.AnalysisRun
+	if err := app.store.DB.Select(&runs, "SELECT * FROM analysis_runs"); err != nil {
+		t.Fatalf("runs: %v", err)
+	}
+	if len(runs) != 1 {
+		t.Fatalf("runs = %+v", runs)
+	}
+	run := runs[0]
+	if run.Success != 1 || run.PromptTokens != 350 || run.CompletionTokens != 230 || run.TotalTokens != 580 {
+		t.Errorf("run usage = %+v", run)
+	}
+	if wantCost := (350*2.0 + 230*8.0) / 1e6; math.Abs(run.Cost-wantCost) > 1e-12 {
+		t.Errorf("run cost = %v, want %v", run.Cost, wantCost)
+	}
+	article, err := app.svc.GetArticle(id)
+	if err != nil || article.Analysis != "完整解读" {
+		t.Errorf("analysis = %q, err = %v", article.Analysis, err)
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"log"
+
+	"stock-report-analysis/internal/models"
+)
+
+// checkAIBudget reports whether background work from source (batch,
+// telegraph or folder_watch) has to stop because a budget cap is reached. The
+// ai-budget-exceeded event fires when a source first hits the cap, not on
+// every check; a failed check lets the work go on.
+func (a *App) checkAIBudget(source string) (models.AIBudgetStatus, bool) {
+	status, err := a.svc.GetAIBudgetStatus()
+	if err != nil {
+		log.Printf("[AI] budget check failed: %s", err.Error())
+		return status, false
+	}
+
+	a.budgetMu.Lock()
+	notify := status.Exceeded && !a.budgetAlerted[source]
+	a.budgetAlerted[source] = status.Exceeded
+	a.budgetMu.Unlock()
+
+	if notify {
+		a.emitEvent("ai-budget-exceeded", map[string]any{
+			"source": source,
+			"status": status,
+		})
+	}
+	return status, status.Exceeded
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+)
+
+// startEmbeddingBackfill starts embedding the sections of the library that
+// have no vector yet, unless a run is already going.
+func (a *App) startEmbeddingBackfill() error {
+	a.embeddingMu.Lock()
+	if a.embeddingStatus.Running {
+		a.embeddingMu.Unlock()
+		return errors.New("向量回填正在运行")
+	}
+	runCtx, cancel := context.WithCancel(context.Background())
+	a.embeddingCancel = cancel
+	s := &a.embeddingStatus
+	s.Running = true
+	s.Total = 0
+	s.Completed = 0
+	s.LastError = ""
+	status := *s
+	a.embeddingMu.Unlock()
+
+	a.emitEvent("embedding-backfill-status", status)
+	go a.runEmbeddingBackfill(runCtx)
+	return nil
+}
+
+func (a *App) stopEmbeddingBackfill() {
+	a.embeddingMu.Lock()
+	cancel := a.embeddingCancel
+	a.embeddingMu.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+}
+
+// runEmbeddingBackfill reports progress as embedding-backfill-status
+// events and the end of the run as embedding-backfill-done.
+func (a *App) runEmbeddingBackfill(ctx context.Context) {
+	startedAt := time.Now()
+	done, err := a.svc.BackfillEmbeddings(ctx, func(done, total int) {
+		a.embeddingMu.Lock()
+		a.embeddingStatus.Completed = done
+		a.embeddingStatus.Total = total
+		status := a.embeddingStatus
+		a.embeddingMu.Unlock()
+		a.emitEvent("embedding-backfill-status", status)
+	})
+
+	a.embeddingMu.Lock()
+	a.embeddingCancel = nil
+	s := &a.embeddingStatus
+	s.Running = false
+	s.LastRunAt = startedAt
+	switch {
+	case errors.Is(err, context.Canceled):
+		s.LastError = "任务已停止"
+	case err != nil:
+		s.LastError = err.Error()
+	}
+	status := *s
+	a.embeddingMu.Unlock()
+
+	a.emitEvent("embedding-backfill-status", status)
+	a.emitEvent("embedding-backfill-done", status)
+	log.Printf("[Embedding] backfill finished embedded=%d err=%v", done, err)
+}
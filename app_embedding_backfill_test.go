@@ -0,0 +1,53 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"stock-report-analysis/internal/llmtest"
+	"stock-report-analysis/internal/models"
+)
+
+func TestEmbeddingBackfillReportsProgress(t *testing.T) {
+	app, events := newTestApp(t)
+	llm := llmtest.New(t)
+	llm.SetEmbedder(func(string) []float32 { return []float32{1, 0} })
+	if err := app.StartEmbeddingBackfill(); err == nil {
+		t.Fatal("backfill started while semantic retrieval is off")
+	}
+
+	channel := llm.Channel()
+	channel.ID = 0
+	channel.EmbeddingModel = "fake-embedding"
+	if err := app.svc.SaveChannel(channel); err != nil {
+		t.Fatalf("save channel: %v", err)
+	}
+	channels, _ := app.svc.GetChannels()
+	if err := app.SaveEmbeddingConfig(models.EmbeddingConfig{Enabled: 1, ChannelID: channels[0].ID}); err != nil {
+		t.Fatalf("save config: %v", err)
+	}
+	insertTestArticle(t, app, "a", "## 投资要点\n维持买入评级。\n\n## 风险提示\n需求不及预期。")
+
+	if err := app.StartEmbeddingBackfill(); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	deadline := time.After(5 * time.Second)
+	for len(events.named("embedding-backfill-done")) == 0 {
+		select {
+		case <-events.notify:
+		case <-deadline:
+			t.Fatal("backfill did not finish")
+		}
+	}
+
+	status := app.GetEmbeddingBackfillStatus()
+	if status.Running || status.Total != 2 || status.Completed != 2 || status.LastError != "" || status.LastRunAt.IsZero() {
+		t.Errorf("status = %+v", status)
+	}
+	if n := len(events.named("embedding-backfill-status")); n < 3 {
+		t.Errorf("status events = %d", n)
+	}
+	if n := len(llm.EmbeddingRequests()); n != 1 {
+		t.Errorf("embedding requests = %d, want one batch", n)
+	}
+}
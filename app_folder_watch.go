@@ -0,0 +1,342 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"stock-report-analysis/internal/models"
+	"stock-report-analysis/internal/service"
+)
+
+const (
+	// folderWatchSettle skips files modified this recently; they may still
+	// be copied or downloaded.
+	folderWatchSettle = 3 * time.Second
+	// folderWatchDebounce waits for a burst of file changes to end before
+	// scanning. It is longer than folderWatchSettle so the changed files
+	// are picked up by that scan.
+	folderWatchDebounce = 4 * time.Second
+)
+
+// Why a folder-watch run starts. A change run skips the interval, a manual
+// run also ignores whether the watch is enabled.
+const (
+	folderWatchScheduled = "scheduled"
+	folderWatchChanged   = "changed"
+	folderWatchManual    = "manual"
+)
+
+// startFolderWatch scans the watched folders on the configured interval
+// and, where the platform supports it, soon after files in them change.
+func (a *App) startFolderWatch() {
+	a.folderWatchOnce.Do(func() {
+		watcher, err := fsnotify.NewWatcher()
+		if err != nil {
+			log.Printf("[FolderWatch] change notifications unavailable, scanning on schedule only: %s", err.Error())
+			watcher = nil
+		}
+		a.folderWatchMu.Lock()
+		a.folderWatcher = watcher
+		a.folderWatchMu.Unlock()
+		go a.folderWatchLoop(watcher)
+	})
+}
+
+func (a *App) folderWatchLoop(watcher *fsnotify.Watcher) {
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+
+	var events <-chan fsnotify.Event
+	var watchErrs <-chan error
+	if watcher != nil {
+		events = watcher.Events
+		watchErrs = watcher.Errors
+	}
+	var settled <-chan time.Time
+
+	a.syncFolderWatchDirs()
+	_ = a.triggerFolderWatchRun(folderWatchScheduled)
+	for {
+		select {
+		case <-ticker.C:
+			_ = a.triggerFolderWatchRun(folderWatchScheduled)
+		case ev, ok := <-events:
+			if !ok {
+				events = nil
+				continue
+			}
+			if ev.Has(fsnotify.Create) {
+				if info, err := os.Stat(ev.Name); err == nil && info.IsDir() {
+					_ = watcher.Add(ev.Name)
+				}
+			}
+			if ev.Has(fsnotify.Create) || ev.Has(fsnotify.Write) || ev.Has(fsnotify.Rename) {
+				settled = time.After(folderWatchDebounce)
+			}
+		case <-settled:
+			settled = nil
+			_ = a.triggerFolderWatchRun(folderWatchChanged)
+		case err, ok := <-watchErrs:
+			if !ok {
+				watchErrs = nil
+				continue
+			}
+			log.Printf("[FolderWatch] watcher error: %s", err.Error())
+		}
+	}
+}
+
+// syncFolderWatchDirs points change notifications at the configured
+// folders and their subfolders, or at nothing when the watch is off.
+func (a *App) syncFolderWatchDirs() {
+	a.folderWatchMu.Lock()
+	watcher := a.folderWatcher
+	a.folderWatchMu.Unlock()
+	if watcher == nil {
+		return
+	}
+
+	want := map[string]bool{}
+	if cfg, err := a.svc.GetFolderWatchConfig(); err == nil && cfg.Enabled == 1 {
+		for _, dir := range service.WatchableDirs(cfg.Dirs) {
+			want[dir] = true
+		}
+	}
+	for _, dir := range watcher.WatchList() {
+		if !want[dir] {
+			_ = watcher.Remove(dir)
+		}
+		delete(want, dir)
+	}
+	for dir := range want {
+		if err := watcher.Add(dir); err != nil {
+			log.Printf("[FolderWatch] watch %s failed: %s", dir, err.Error())
+		}
+	}
+
+	watching := len(watcher.WatchList()) > 0
+	a.updateFolderWatchStatus(func(s *models.FolderWatchStatus) {
+		s.Watching = watching
+	})
+}
+
+func (a *App) triggerFolderWatchRun(reason string) bool {
+	cfg, err := a.svc.GetFolderWatchConfig()
+	if err != nil {
+		a.updateFolderWatchStatus(func(s *models.FolderWatchStatus) {
+			s.LastError = "读取文件夹监听配置失败: " + err.Error()
+		})
+		return false
+	}
+	if (cfg.Enabled != 1 && reason != folderWatchManual) || len(cfg.Dirs) == 0 {
+		return false
+	}
+
+	a.folderWatchMu.Lock()
+	if a.folderWatchStatus.Running {
+		// Files changed during a run may have been missed by its scan.
+		if reason == folderWatchChanged {
+			a.folderWatchRescan = true
+		}
+		a.folderWatchMu.Unlock()
+		return false
+	}
+	if reason == folderWatchScheduled && !a.folderWatchStatus.LastRunAt.IsZero() {
+		nextAt := a.folderWatchStatus.LastRunAt.Add(time.Duration(cfg.IntervalMinutes) * time.Minute)
+		if time.Now().Before(nextAt) {
+			a.folderWatchMu.Unlock()
+			return false
+		}
+	}
+	runCtx, cancel := context.WithCancel(context.Background())
+	a.folderWatchRunSeq++
+	runSeq := a.folderWatchRunSeq
+	a.folderWatchCancel = cancel
+	a.folderWatchRescan = false
+	s := &a.folderWatchStatus
+	s.Running = true
+	s.Total = 0
+	s.Completed = 0
+	s.CurrentFile = ""
+	a.folderWatchMu.Unlock()
+
+	go a.runFolderWatchOnce(runCtx, runSeq, cfg)
+	return true
+}
+
+func (a *App) stopFolderWatchRun(reason string) {
+	a.folderWatchMu.Lock()
+	cancel := a.folderWatchCancel
+	if reason != "" {
+		a.folderWatchStatus.LastError = reason
+	}
+	a.folderWatchMu.Unlock()
+
+	if cancel != nil {
+		cancel()
+	}
+}
+
+// runFolderWatchOnce imports the pending files one by one and, when
+// configured, analyzes each new article right after its import. Progress
+// goes out as folder-watch-status events, failures as folder-watch-error
+// and the end of the run as folder-watch-done.
+func (a *App) runFolderWatchOnce(ctx context.Context, runSeq int64, cfg models.FolderWatchConfig) {
+	startedAt := time.Now()
+	imported := 0
+	duplicates := 0
+	failed := 0
+	analyzed := 0
+	lastErr := ""
+
+	defer func() {
+		a.folderWatchMu.Lock()
+		if a.folderWatchRunSeq != runSeq {
+			a.folderWatchMu.Unlock()
+			return
+		}
+		a.folderWatchCancel = nil
+		s := &a.folderWatchStatus
+		s.Running = false
+		s.CurrentFile = ""
+		s.LastRunAt = startedAt
+		s.LastImported = imported
+		s.LastDuplicates = duplicates
+		s.LastFailed = failed
+		s.LastAnalyzed = analyzed
+		s.LastError = lastErr
+		status := *s
+		rescan := a.folderWatchRescan && ctx.Err() == nil
+		a.folderWatchMu.Unlock()
+
+		a.emitEvent("folder-watch-status", status)
+		a.emitEvent("folder-watch-done", status)
+		log.Printf("[FolderWatch] run finished imported=%d duplicates=%d failed=%d analyzed=%d", imported, duplicates, failed, analyzed)
+		if rescan {
+			a.triggerFolderWatchRun(folderWatchChanged)
+		}
+	}()
+
+	paths, err := a.svc.PendingWatchedFiles(cfg.Dirs, startedAt.Add(-folderWatchSettle))
+	if err != nil {
+		// Files found in the readable folders are still imported.
+		lastErr = err.Error()
+		a.emitEvent("folder-watch-error", lastErr)
+	}
+	if len(paths) == 0 {
+		return
+	}
+	a.updateFolderWatchStatus(func(s *models.FolderWatchStatus) {
+		s.Total = len(paths)
+	})
+
+	var channel *models.AIChannel
+	var prompt *models.Prompt
+	autoAnalyze := cfg.AutoAnalyze == 1
+	if autoAnalyze {
+		channel, prompt, err = a.getChannelAndPrompt(cfg.ChannelID, cfg.PromptID)
+		if err != nil {
+			autoAnalyze = false
+			lastErr = "自动解读未执行: " + err.Error()
+			a.emitEvent("folder-watch-error", lastErr)
+		}
+	}
+	cacheCfg, _ := a.svc.GetAIResponseCacheConfig()
+
+	for _, path := range paths {
+		if ctx.Err() != nil {
+			lastErr = "任务已停止"
+			break
+		}
+		name := filepath.Base(path)
+		a.emitFolderWatchStatus(func(s *models.FolderWatchStatus) {
+			s.CurrentFile = path
+		})
+
+		file, err := a.svc.ImportWatchedFile(path)
+		switch {
+		case err != nil:
+			failed++
+			lastErr = fmt.Sprintf("%s: %s", name, err.Error())
+			a.emitEvent("folder-watch-error", lastErr)
+		case file.Status == service.WatchedFileFailed:
+			failed++
+			lastErr = fmt.Sprintf("%s: %s", name, file.Error)
+			a.emitEvent("folder-watch-error", lastErr)
+		case file.Status == service.WatchedFileDuplicate:
+			duplicates++
+		default:
+			imported++
+			if autoAnalyze {
+				if budget, exceeded := a.checkAIBudget("folder_watch"); exceeded {
+					// Later files are still imported, just not analyzed.
+					autoAnalyze = false
+					lastErr = "自动解读已暂停: " + budget.Reason
+					a.emitEvent("folder-watch-error", lastErr)
+				} else if err := a.analyzeWatchedArticle(ctx, file.ArticleID, *channel, prompt, cfg.Mode, cacheCfg.Batch); err != nil {
+					// A stop is reported by the next iteration.
+					if ctx.Err() == nil {
+						lastErr = fmt.Sprintf("%s: 自动解读失败: %s", name, err.Error())
+						a.emitEvent("folder-watch-error", lastErr)
+					}
+				} else {
+					analyzed++
+				}
+			}
+		}
+		if err == nil {
+			a.emitEvent("folder-watch-file", file)
+		}
+		a.emitFolderWatchStatus(func(s *models.FolderWatchStatus) {
+			s.Completed++
+		})
+	}
+}
+
+// analyzeWatchedArticle analyzes a newly imported article the way a batch
+// job does.
+func (a *App) analyzeWatchedArticle(ctx context.Context, articleID int64, channel models.AIChannel, prompt *models.Prompt, mode string, useCache bool) error {
+	article, err := a.svc.GetArticle(articleID)
+	if err != nil {
+		return err
+	}
+	_ = a.svc.UpdateArticleStatus(articleID, 1)
+	runCtx, cancel := context.WithTimeout(ctx, 10*time.Minute)
+	attempt, structured, err := a.analyzeWithFailover(runCtx, articleID, channel, prompt, mode, article.Content, useCache, func(string) {}, nil)
+	cancel()
+	if err != nil {
+		_ = a.svc.UpdateArticleStatus(articleID, 0)
+		if !errors.Is(ctx.Err(), context.Canceled) {
+			a.recordAnalysisRun(articleID, prompt, mode, attempt, classifyErrorReason(err), false)
+		}
+		return err
+	}
+	if err := a.svc.SaveArticleAnalysis(articleID, analysisOutcome(prompt, attempt, structured)); err != nil {
+		_ = a.svc.UpdateArticleStatus(articleID, 0)
+		a.recordAnalysisRun(articleID, prompt, mode, attempt, "save_error", false)
+		return err
+	}
+	a.recordAnalysisRun(articleID, prompt, mode, attempt, "", true)
+	return nil
+}
+
+func (a *App) updateFolderWatchStatus(update func(*models.FolderWatchStatus)) {
+	a.folderWatchMu.Lock()
+	defer a.folderWatchMu.Unlock()
+	update(&a.folderWatchStatus)
+}
+
+func (a *App) emitFolderWatchStatus(update func(*models.FolderWatchStatus)) {
+	a.folderWatchMu.Lock()
+	update(&a.folderWatchStatus)
+	status := a.folderWatchStatus
+	a.folderWatchMu.Unlock()
+	a.emitEvent("folder-watch-status", status)
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"stock-report-analysis/internal/llmtest"
+	"stock-report-analysis/internal/models"
+)
+
+func TestRunFolderWatchOnceImportsAndAnalyzes(t *testing.T) {
+	app, events := newTestApp(t)
+	llm := llmtest.New(t)
+	llm.SetFallback(llmtest.Reply{Chunks: []string{"业绩符合预期"}, Usage: &llmtest.Usage{TotalTokens: 10}})
+	channel := saveTestChannel(t, app, llm)
+	prompt := saveTestPrompt(t, app)
+
+	dir := t.TempDir()
+	old := time.Now().Add(-time.Minute)
+	for name, content := range map[string]string{
+		"贵州茅台.md": "三季度营收同比增长15%，净利润同比增长14%，直销占比继续提升。",
+		"宁德时代.md": "储能电池出货量同比翻倍，海外订单占比提升至三成。",
+		"空白.txt":  " ",
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		os.Chtimes(path, old, old)
+	}
+	cfg := models.FolderWatchConfig{Dirs: []string{dir}, AutoAnalyze: 1, ChannelID: channel.ID, PromptID: prompt.ID, Mode: "text"}
+
+	app.runFolderWatchOnce(context.Background(), 0, cfg)
+	status := app.GetFolderWatchStatus()
+	if status.Running || status.LastImported != 2 || status.LastAnalyzed != 2 || status.LastFailed != 1 || status.LastError == "" {
+		t.Fatalf("status = %+v", status)
+	}
+	var analyzed int
+	if err := app.store.DB.Get(&analyzed, "SELECT COUNT(*) FROM articles WHERE status=2 AND analysis<>''"); err != nil || analyzed != 2 {
+		t.Errorf("analyzed articles = %d, err = %v", analyzed, err)
+	}
+	if n := len(events.named("folder-watch-file")); n != 3 {
+		t.Errorf("file events = %d, want 3", n)
+	}
+	if len(events.named("folder-watch-error")) != 1 || len(events.named("folder-watch-done")) != 1 {
+		t.Errorf("error/done events = %d/%d", len(events.named("folder-watch-error")), len(events.named("folder-watch-done")))
+	}
+
+	// Processed files are not imported or analyzed again.
+	requests := len(llm.Requests())
+	app.runFolderWatchOnce(context.Background(), 0, cfg)
+	if status := app.GetFolderWatchStatus(); status.LastImported != 0 || status.LastFailed != 1 {
+		t.Errorf("second run = %+v", status)
+	}
+	if len(llm.Requests()) != requests {
+		t.Errorf("second run called the model %d times", len(llm.Requests())-requests)
+	}
+}
@@ -11,8 +11,6 @@ import (
 
 	"stock-report-analysis/internal/models"
 	"stock-report-analysis/internal/service"
-
-	"github.com/wailsapp/wails/v2/pkg/runtime"
 )
 
 const telegraphAlertMinScore = 85
@@ -34,7 +32,7 @@ func (a *App) startTelegraphScheduler() {
 }
 
 func (a *App) triggerTelegraphRun(force bool) bool {
-	cfg, err := service.GetTelegraphSchedulerConfig()
+	cfg, err := a.svc.GetTelegraphSchedulerConfig()
 	if err != nil {
 		a.updateTelegraphStatus(func(s *models.TelegraphSchedulerStatus) {
 			s.LastError = "读取电报配置失败: " + err.Error()
@@ -90,7 +88,7 @@ func (a *App) runTelegraphOnce(ctx context.Context, runSeq int64, cfg models.Tel
 
 	defer func() {
 		durationMs := time.Since(startedAt).Milliseconds()
-		_ = service.RecordTelegraphRun(startedAt, durationMs, fetched, imported, analyzed, lastErr)
+		_ = a.svc.RecordTelegraphRun(startedAt, durationMs, fetched, imported, analyzed, lastErr)
 
 		a.telegraphMu.Lock()
 		defer a.telegraphMu.Unlock()
@@ -111,6 +109,10 @@ func (a *App) runTelegraphOnce(ctx context.Context, runSeq int64, cfg models.Tel
 		lastErr = "任务已停止"
 		return
 	}
+	if budget, exceeded := a.checkAIBudget("telegraph"); exceeded {
+		lastErr = "已暂停: " + budget.Reason
+		return
+	}
 
 	items, err := service.FetchTelegraphNews(ctx, cfg.SourceURL, cfg.FetchLimit)
 	if err != nil {
@@ -127,25 +129,33 @@ func (a *App) runTelegraphOnce(ctx context.Context, runSeq int64, cfg models.Tel
 		return
 	}
 
-	channel, prompt, err := resolveTelegraphAnalysisTarget(cfg.ChannelID, cfg.AnalysisPrompt)
+	channel, prompt, err := a.resolveTelegraphAnalysisTarget(cfg)
 	if err != nil {
 		lastErr = err.Error()
 		log.Printf("[CLS] resolve ai target failed: %s", err.Error())
 		return
 	}
+	cacheCfg, _ := a.svc.GetAIResponseCacheConfig()
 
 	// Analyze from old to new for chronological readability.
 	sort.Slice(items, func(i, j int) bool {
 		return items[i].Published.Before(items[j].Published)
 	})
 
+	budgetStopped := false
 	for _, item := range items {
 		if ctx.Err() != nil {
 			lastErr = "任务已停止"
 			break
 		}
+		if budget, exceeded := a.checkAIBudget("telegraph"); exceeded {
+			// Unimported items are picked up again by a later run.
+			lastErr = "已暂停: " + budget.Reason
+			budgetStopped = true
+			break
+		}
 
-		article, created, err := service.ImportTelegraphNews(item)
+		article, created, err := a.svc.ImportTelegraphNews(item)
 		if err != nil {
 			lastErr = "导入电报失败: " + err.Error()
 			log.Printf("[CLS] import news failed id=%d err=%s", item.NewsID, err.Error())
@@ -155,46 +165,47 @@ func (a *App) runTelegraphOnce(ctx context.Context, runSeq int64, cfg models.Tel
 			continue
 		}
 		imported++
-		if err := service.RefreshTelegraphWatchHits(article.ID, article.Title, article.Content); err != nil {
+		if err := a.svc.RefreshTelegraphWatchHits(article.ID, article.Title, article.Content); err != nil {
 			log.Printf("[CLS] refresh watch hits failed article=%d err=%s", article.ID, err.Error())
 		}
 
-		startedRunAt := time.Now()
-		_ = service.UpdateArticleStatus(article.ID, 1)
+		_ = a.svc.UpdateArticleStatus(article.ID, 1)
 
 		runCtx, cancel := context.WithTimeout(ctx, 4*time.Minute)
-		result, err := service.AnalyzeArticleDetailedWithContext(runCtx, *channel, prompt.Content, article.Content, service.AnalysisModeText, func(string) {})
+		attempt, _, err := a.analyzeWithFailover(runCtx, article.ID, *channel, prompt, service.AnalysisModeText, article.Content, cacheCfg.Telegraph, func(string) {}, nil)
+		runErr := runCtx.Err()
 		cancel()
+		result := attempt.Result
 		if err != nil {
-			if errors.Is(runCtx.Err(), context.Canceled) || errors.Is(ctx.Err(), context.Canceled) {
-				_ = service.UpdateArticleStatus(article.ID, 0)
+			if errors.Is(runErr, context.Canceled) || errors.Is(ctx.Err(), context.Canceled) {
+				_ = a.svc.UpdateArticleStatus(article.ID, 0)
 				lastErr = "任务已停止"
 				break
 			}
 			a.refreshTelegraphMeta(article, "")
-			_ = service.UpdateArticleStatus(article.ID, 0)
+			_ = a.svc.UpdateArticleStatus(article.ID, 0)
 			lastErr = "AI 解读失败: " + err.Error()
-			a.recordAnalysisRun(article.ID, channel, prompt, service.AnalysisModeText, result, classifyErrorReason(err), startedRunAt, false)
+			a.recordAnalysisRun(article.ID, prompt, service.AnalysisModeText, attempt, classifyErrorReason(err), false)
 			log.Printf("[CLS] analyze failed article=%d news=%d err=%s", article.ID, item.NewsID, err.Error())
 			continue
 		}
 
-		if err := service.UpdateArticleAnalysis(article.ID, result.Text, prompt.Name, channel.Name); err != nil {
+		if err := a.svc.SaveArticleAnalysis(article.ID, analysisOutcome(prompt, attempt, nil)); err != nil {
 			a.refreshTelegraphMeta(article, result.Text)
-			_ = service.UpdateArticleStatus(article.ID, 0)
+			_ = a.svc.UpdateArticleStatus(article.ID, 0)
 			lastErr = "保存解读失败: " + err.Error()
-			a.recordAnalysisRun(article.ID, channel, prompt, service.AnalysisModeText, result, "save_error", startedRunAt, false)
+			a.recordAnalysisRun(article.ID, prompt, service.AnalysisModeText, attempt, "save_error", false)
 			log.Printf("[CLS] save analysis failed article=%d news=%d err=%s", article.ID, item.NewsID, err.Error())
 			continue
 		}
 
 		a.refreshTelegraphMeta(article, result.Text)
-		a.recordAnalysisRun(article.ID, channel, prompt, service.AnalysisModeText, result, "", startedRunAt, true)
+		a.recordAnalysisRun(article.ID, prompt, service.AnalysisModeText, attempt, "", true)
 		analyzed++
 	}
 
-	if ctx.Err() == nil {
-		if err := a.maybeGenerateTelegraphDigest(ctx, channel); err != nil {
+	if ctx.Err() == nil && !budgetStopped {
+		if err := a.maybeGenerateTelegraphDigest(ctx, channel, prompt.GenerationOptions); err != nil {
 			log.Printf("[CLS] digest failed: %s", err.Error())
 			if lastErr == "" {
 				lastErr = "盘中摘要生成失败"
@@ -207,21 +218,21 @@ func (a *App) runTelegraphOnce(ctx context.Context, runSeq int64, cfg models.Tel
 
 func (a *App) refreshTelegraphMeta(article models.Article, analysis string) {
 	score, direction, level := service.EvaluateTelegraphImportance(article.Title, article.Content, analysis)
-	if err := service.UpsertTelegraphMeta(article.ID, score, direction, level); err != nil {
+	if err := a.svc.UpsertTelegraphMeta(article.ID, score, direction, level); err != nil {
 		log.Printf("[CLS] upsert meta failed article=%d err=%s", article.ID, err.Error())
 		return
 	}
-	if err := service.AutoTagTelegraphArticle(article.ID, article.Title, article.Content, direction, level); err != nil {
+	if err := a.svc.AutoTagTelegraphArticle(article.ID, article.Title, article.Content, direction, level); err != nil {
 		log.Printf("[CLS] auto tag failed article=%d err=%s", article.ID, err.Error())
 	}
 
-	alerted, err := service.MarkTelegraphAlertedIfNeeded(article.ID, telegraphAlertMinScore)
+	alerted, err := a.svc.MarkTelegraphAlertedIfNeeded(article.ID, telegraphAlertMinScore)
 	if err != nil {
 		log.Printf("[CLS] mark alert failed article=%d err=%s", article.ID, err.Error())
 		return
 	}
-	if alerted && a.ctx != nil {
-		runtime.EventsEmit(a.ctx, "telegraph-alert", map[string]any{
+	if alerted {
+		a.emitEvent("telegraph-alert", map[string]any{
 			"articleId":  article.ID,
 			"title":      article.Title,
 			"score":      score,
@@ -233,7 +244,10 @@ func (a *App) refreshTelegraphMeta(article models.Article, analysis string) {
 	}
 }
 
-func (a *App) maybeGenerateTelegraphDigest(ctx context.Context, channel *models.AIChannel) error {
+// maybeGenerateTelegraphDigest summarizes the previous digest slot once. The
+// call fails over like article analysis, and its run is recorded against
+// the slot's top-scoring article so the spend counts toward the budget.
+func (a *App) maybeGenerateTelegraphDigest(ctx context.Context, channel *models.AIChannel, options models.GenerationOptions) error {
 	if channel == nil {
 		return nil
 	}
@@ -241,7 +255,7 @@ func (a *App) maybeGenerateTelegraphDigest(ctx context.Context, channel *models.
 	slotEnd := now.Truncate(telegraphDigestInterval)
 	slotStart := slotEnd.Add(-telegraphDigestInterval)
 
-	exists, err := service.HasTelegraphDigestSlot(slotStart, slotEnd)
+	exists, err := a.svc.HasTelegraphDigestSlot(slotStart, slotEnd)
 	if err != nil {
 		return err
 	}
@@ -249,13 +263,16 @@ func (a *App) maybeGenerateTelegraphDigest(ctx context.Context, channel *models.
 		return nil
 	}
 
-	items, err := service.GetTelegraphDigestSource(slotStart, slotEnd, 5)
+	items, err := a.svc.GetTelegraphDigestSource(slotStart, slotEnd, 5)
 	if err != nil {
 		return err
 	}
 	if len(items) == 0 {
 		return nil
 	}
+	if _, exceeded := a.checkAIBudget("telegraph"); exceeded {
+		return nil
+	}
 
 	var b strings.Builder
 	b.WriteString(fmt.Sprintf("时间窗口: %s - %s\n", slotStart.Format("15:04"), slotEnd.Format("15:04")))
@@ -266,19 +283,26 @@ func (a *App) maybeGenerateTelegraphDigest(ctx context.Context, channel *models.
 		}
 	}
 
-	digestPrompt := `你是A股盘中复盘分析师。请基于给定时间窗口内的高影响新闻，输出：
+	digestPrompt := &models.Prompt{
+		Name: "财联社盘中摘要",
+		Content: `你是A股盘中复盘分析师。请基于给定时间窗口内的高影响新闻，输出：
 1) 市场主线（2-3点）
 2) 影响路径（政策/行业/公司如何传导）
 3) 风险提示（1-2点）
 4) 接下来30分钟跟踪信号
-要求：简洁、结构化、禁止编造。`
+要求：简洁、结构化、禁止编造。`,
+		GenerationOptions: options,
+	}
 
 	runCtx, cancel := context.WithTimeout(ctx, 2*time.Minute)
 	defer cancel()
-	res, err := service.AnalyzeArticleDetailedWithContext(runCtx, *channel, digestPrompt, b.String(), service.AnalysisModeText, func(string) {})
+	runArticleID := items[0].ArticleID
+	attempt, _, err := a.analyzeWithFailover(runCtx, runArticleID, *channel, digestPrompt, service.AnalysisModeText, b.String(), false, func(string) {}, nil)
+	a.recordAnalysisRun(runArticleID, digestPrompt, service.AnalysisModeText, attempt, classifyErrorReason(err), err == nil)
 	if err != nil {
 		return err
 	}
+	res := attempt.Result
 
 	totalScore := 0
 	for _, item := range items {
@@ -288,19 +312,17 @@ func (a *App) maybeGenerateTelegraphDigest(ctx context.Context, channel *models.
 	if len(items) > 0 {
 		avgScore = totalScore / len(items)
 	}
-	if err := service.SaveTelegraphDigest(slotStart, slotEnd, res.Text, len(items), avgScore); err != nil {
+	if err := a.svc.SaveTelegraphDigest(slotStart, slotEnd, res.Text, len(items), avgScore); err != nil {
 		return err
 	}
 
-	if a.ctx != nil {
-		runtime.EventsEmit(a.ctx, "telegraph-digest", map[string]any{
-			"slotStart": slotStart,
-			"slotEnd":   slotEnd,
-			"summary":   trimLocal(res.Text, 220),
-			"topItems":  len(items),
-			"avgScore":  avgScore,
-		})
-	}
+	a.emitEvent("telegraph-digest", map[string]any{
+		"slotStart": slotStart,
+		"slotEnd":   slotEnd,
+		"summary":   trimLocal(res.Text, 220),
+		"topItems":  len(items),
+		"avgScore":  avgScore,
+	})
 	return nil
 }
 
@@ -322,8 +344,9 @@ func trimLocal(s string, limit int) string {
 	return string(r[:limit]) + "..."
 }
 
-func resolveTelegraphAnalysisTarget(channelID int64, analysisPrompt string) (*models.AIChannel, *models.Prompt, error) {
-	channels, err := service.GetChannels()
+func (a *App) resolveTelegraphAnalysisTarget(cfg models.TelegraphSchedulerConfig) (*models.AIChannel, *models.Prompt, error) {
+	channelID := cfg.ChannelID
+	channels, err := a.svc.GetChannels()
 	if err != nil {
 		return nil, nil, err
 	}
@@ -352,15 +375,15 @@ func resolveTelegraphAnalysisTarget(channelID int64, analysisPrompt string) (*mo
 		channel = &channels[0]
 	}
 
-	promptContent := strings.TrimSpace(analysisPrompt)
+	promptContent := strings.TrimSpace(cfg.AnalysisPrompt)
 	if promptContent == "" {
-		cfg := service.DefaultTelegraphPrompt()
-		promptContent = cfg
+		promptContent = service.DefaultTelegraphPrompt()
 	}
 	prompt := &models.Prompt{
-		ID:      0,
-		Name:    "财联社新闻专用提示词",
-		Content: promptContent,
+		ID:                0,
+		Name:              "财联社新闻专用提示词",
+		Content:           promptContent,
+		GenerationOptions: cfg.GenerationOptions,
 	}
 
 	return channel, prompt, nil
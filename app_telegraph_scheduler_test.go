@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"stock-report-analysis/internal/llmtest"
+	"stock-report-analysis/internal/models"
+)
+
+// telegraphPage serves a page shaped like the telegraph source with the given news.
+func telegraphPage(t *testing.T, news ...[2]string) *httptest.Server {
+	t.Helper()
+	now := time.Now().Unix()
+	rows := ""
+	for i, n := range news {
+		if i > 0 {
+			rows += ","
+		}
+		rows += fmt.Sprintf(`{"id":%d,"ctime":%d,"title":%q,"content":%q,"brief":""}`, 1000+i, now-int64(len(news)-i), n[0], n[1])
+	}
+	page := `<html><body><script id="__NEXT_DATA__" type="application/json">{"props":{"initialState":{"roll_data":[` + rows + `]}}}</script></body></html>`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = w.Write([]byte(page))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+type telegraphRunRow struct {
+	Fetched     int    `db:"fetched"`
+	Imported    int    `db:"imported"`
+	Analyzed    int    `db:"analyzed"`
+	Success     int    `db:"success"`
+	ErrorReason string `db:"error_reason"`
+}
+
+func lastTelegraphRun(t *testing.T, app *App) telegraphRunRow {
+	t.Helper()
+	var run telegraphRunRow
+	if err := app.store.DB.Get(&run, "SELECT fetched, imported, analyzed, success, error_reason FROM telegraph_runs ORDER BY id DESC LIMIT 1"); err != nil {
+		t.Fatalf("telegraph run: %v", err)
+	}
+	return run
+}
+
+func TestRunTelegraphOnceImportsAndAnalyzes(t *testing.T) {
+	app, _ := newTestApp(t)
+	llm := llmtest.New(t)
+	llm.SetFallback(llmtest.Reply{Chunks: []string{"利好，影响较小"}, Usage: &llmtest.Usage{TotalTokens: 12}})
+	saveTestChannel(t, app, llm)
+	page := telegraphPage(t,
+		[2]string{"公司A中标", "公司A中标十亿元订单"},
+		[2]string{"公司B回购", "公司B拟回购股份"},
+	)
+	cfg := models.TelegraphSchedulerConfig{SourceURL: page.URL, FetchLimit: 10}
+
+	app.runTelegraphOnce(context.Background(), 0, cfg)
+	run := lastTelegraphRun(t, app)
+	if run.Fetched != 2 || run.Imported != 2 || run.Analyzed != 2 || run.Success != 1 {
+		t.Fatalf("run = %+v", run)
+	}
+	var analyzed int
+	if err := app.store.DB.Get(&analyzed, "SELECT COUNT(*) FROM articles WHERE status=2 AND analysis<>''"); err != nil || analyzed != 2 {
+		t.Errorf("analyzed articles = %d, err = %v", analyzed, err)
+	}
+	var runs int
+	if err := app.store.DB.Get(&runs, "SELECT COUNT(*) FROM analysis_runs WHERE success=1"); err != nil || runs != 2 {
+		t.Errorf("analysis runs = %d, err = %v", runs, err)
+	}
+
+	// Already imported news is skipped on the next run.
+	requests := len(llm.Requests())
+	app.runTelegraphOnce(context.Background(), 0, cfg)
+	run = lastTelegraphRun(t, app)
+	if run.Fetched != 2 || run.Imported != 0 || run.Analyzed != 0 {
+		t.Errorf("second run = %+v", run)
+	}
+	if len(llm.Requests()) != requests {
+		t.Errorf("second run called the model %d times", len(llm.Requests())-requests)
+	}
+}
+
+func TestRunTelegraphOnceRecordsAnalysisFailure(t *testing.T) {
+	app, _ := newTestApp(t)
+	llm := llmtest.New(t)
+	llm.SetFallback(llmtest.Status(http.StatusUnauthorized, "bad key"))
+	saveTestChannel(t, app, llm)
+	page := telegraphPage(t, [2]string{"标题", "电报正文"})
+
+	app.runTelegraphOnce(context.Background(), 0, models.TelegraphSchedulerConfig{SourceURL: page.URL, FetchLimit: 10})
+	run := lastTelegraphRun(t, app)
+	if run.Imported != 1 || run.Analyzed != 0 || run.Success != 0 || run.ErrorReason == "" {
+		t.Fatalf("run = %+v", run)
+	}
+	var failed int
+	if err := app.store.DB.Get(&failed, "SELECT COUNT(*) FROM analysis_runs WHERE success=0"); err != nil || failed != 1 {
+		t.Errorf("failed runs = %d, err = %v", failed, err)
+	}
+}
+
+func TestRunTelegraphOnceStopsWhenCanceled(t *testing.T) {
+	app, _ := newTestApp(t)
+	llm := llmtest.New(t)
+	saveTestChannel(t, app, llm)
+	page := telegraphPage(t, [2]string{"标题", "电报正文"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	app.runTelegraphOnce(ctx, 0, models.TelegraphSchedulerConfig{SourceURL: page.URL, FetchLimit: 10})
+	if run := lastTelegraphRun(t, app); run.Success != 0 || run.Imported != 0 {
+		t.Errorf("run = %+v", run)
+	}
+	if len(llm.Requests()) != 0 {
+		t.Errorf("requests = %d, want 0", len(llm.Requests()))
+	}
+}
+
+func TestTelegraphDigestRecordsPricedRun(t *testing.T) {
+	app, events := newTestApp(t)
+	llm := llmtest.New(t)
+	llm.SetFallback(llmtest.Reply{Chunks: []string{"主线：订单落地"}, Usage: &llmtest.Usage{PromptTokens: 300, CompletionTokens: 100, TotalTokens: 400}})
+	ch := llm.Channel()
+	ch.ID = 0
+	ch.IsDefault = 1
+	ch.InputPrice = 2
+	ch.OutputPrice = 8
+	if err := app.svc.SaveChannel(ch); err != nil {
+		t.Fatalf("save channel: %v", err)
+	}
+	channels, _ := app.svc.GetChannels()
+	if err := app.svc.SaveAIBudgetConfig(models.AIBudgetConfig{DailyLimit: 100}); err != nil {
+		t.Fatalf("save budget: %v", err)
+	}
+
+	slotStart := time.Now().Truncate(telegraphDigestInterval).Add(-telegraphDigestInterval)
+	var ids []int64
+	for i, title := range []string{"公司A中标", "公司B回购"} {
+		res, err := app.store.DB.Exec("INSERT INTO articles(title, content, source, created_at) VALUES(?, ?, ?, ?)",
+			title, title+"正文", fmt.Sprintf("cls-telegraph:%d", i+1), slotStart.Add(time.Minute))
+		if err != nil {
+			t.Fatalf("insert article: %v", err)
+		}
+		id, _ := res.LastInsertId()
+		ids = append(ids, id)
+	}
+	if err := app.svc.UpsertTelegraphMeta(ids[0], 90, "利好", "高影响"); err != nil {
+		t.Fatalf("meta: %v", err)
+	}
+
+	temperature := 0.0
+	if err := app.maybeGenerateTelegraphDigest(context.Background(), &channels[0], models.GenerationOptions{Temperature: &temperature, MaxTokens: 600}); err != nil {
+		t.Fatalf("digest: %v", err)
+	}
+	waitForEvent(t, events, "telegraph-digest")
+	requests := llm.Requests()
+	if len(requests) != 1 || requests[0].Temperature == nil || *requests[0].Temperature != 0 || requests[0].MaxTokens != 600 {
+		t.Fatalf("requests = %+v", requests)
+	}
+
+	var run models.AnalysisRun
+	if err := app.store.DB.Get(&run, "SELECT * FROM analysis_runs"); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if run.ArticleID != ids[0] || run.PromptName != "财联社盘中摘要" || run.Success != 1 || run.TotalTokens != 400 {
+		t.Errorf("run = %+v", run)
+	}
+	if want := (300*2.0 + 100*8.0) / 1e6; run.Cost < want-1e-12 || run.Cost > want+1e-12 {
+		t.Errorf("run cost = %v, want %v", run.Cost, want)
+	}
+	status, err := app.svc.GetAIBudgetStatus()
+	if err != nil || status.DailySpent != run.Cost {
+		t.Errorf("budget status = %+v, err = %v", status, err)
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"sync"
+	"testing"
+
+	"stock-report-analysis/internal/db"
+	"stock-report-analysis/internal/llmtest"
+	"stock-report-analysis/internal/models"
+)
+
+// testEvents records what the App emitted.
+type testEvents struct {
+	mu     sync.Mutex
+	events []testEvent
+	notify chan string
+}
+
+type testEvent struct {
+	Name string
+	Data []any
+}
+
+func (e *testEvents) sink(name string, data ...any) {
+	e.mu.Lock()
+	e.events = append(e.events, testEvent{Name: name, Data: data})
+	e.mu.Unlock()
+	select {
+	case e.notify <- name:
+	default:
+	}
+}
+
+func (e *testEvents) named(name string) []testEvent {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	var out []testEvent
+	for _, ev := range e.events {
+		if ev.Name == name {
+			out = append(out, ev)
+		}
+	}
+	return out
+}
+
+// newTestApp returns an App on a fresh database whose events are recorded
+// instead of sent to a Wails runtime.
+func newTestApp(t *testing.T) (*App, *testEvents) {
+	t.Helper()
+	store, err := db.OpenMemory()
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+
+	events := &testEvents{notify: make(chan string, 256)}
+	app := NewAppWithStore(store)
+	app.eventSink = events.sink
+	return app, events
+}
+
+// saveTestChannel stores srv as the default channel and returns it with its ID.
+func saveTestChannel(t *testing.T, app *App, srv *llmtest.Server) models.AIChannel {
+	t.Helper()
+	ch := srv.Channel()
+	ch.ID = 0
+	ch.IsDefault = 1
+	if err := app.svc.SaveChannel(ch); err != nil {
+		t.Fatalf("save channel: %v", err)
+	}
+	channels, err := app.svc.GetChannels()
+	if err != nil || len(channels) == 0 {
+		t.Fatalf("load channels: %v", err)
+	}
+	return channels[0]
+}
+
+func insertTestArticle(t *testing.T, app *App, title, content string) int64 {
+	t.Helper()
+	res, err := app.store.DB.Exec("INSERT INTO articles(title, content) VALUES(?, ?)", title, content)
+	if err != nil {
+		t.Fatalf("insert article: %v", err)
+	}
+	id, _ := res.LastInsertId()
+	return id
+}
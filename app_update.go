@@ -18,7 +18,6 @@ import (
 	"time"
 
 	"stock-report-analysis/internal/models"
-	"stock-report-analysis/internal/service"
 
 	"github.com/wailsapp/wails/v2/pkg/runtime"
 )
@@ -47,15 +46,15 @@ func (a *App) GetAppVersion() string {
 }
 
 func (a *App) GetAppUpdateConfig() (models.AppUpdateConfig, error) {
-	return service.GetAppUpdateConfig()
+	return a.svc.GetAppUpdateConfig()
 }
 
 func (a *App) SaveAppUpdateConfig(cfg models.AppUpdateConfig) error {
-	return service.SaveAppUpdateConfig(cfg)
+	return a.svc.SaveAppUpdateConfig(cfg)
 }
 
 func (a *App) CheckAppUpdate() (models.AppUpdateResult, error) {
-	cfg, err := service.GetAppUpdateConfig()
+	cfg, err := a.svc.GetAppUpdateConfig()
 	if err != nil {
 		return models.AppUpdateResult{}, err
 	}
@@ -3,6 +3,7 @@ import { HashRouter, Routes, Route, NavLink } from 'react-router-dom'
 import Articles from './pages/Articles'
 import ArticleDetail from './pages/ArticleDetail'
 import News from './pages/News'
+import LibraryQA from './pages/LibraryQA'
 import Settings from './pages/Settings'
 import { EventsOn } from '../wailsjs/runtime/runtime'
 
@@ -71,9 +72,20 @@ function App() {
       notifyDesktop('盘中摘要已生成', `${slotStart} - ${slotEnd}`, `telegraph-digest-${slotEnd}`)
     })
 
+    const offBudget = EventsOn('ai-budget-exceeded', (...args: unknown[]) => {
+      const payload = (args[0] || {}) as Record<string, unknown>
+      const status = (payload.status || {}) as Record<string, unknown>
+      const sourceLabels: Record<string, string> = { telegraph: '电报定时解读', folder_watch: '文件夹自动解读' }
+      const source = sourceLabels[String(payload.source)] || '批量解读'
+      const reason = String(status.reason || '已超出 AI 预算')
+      pushToast('AI 预算已用尽', `${source}已暂停：${reason}`, 'warn')
+      notifyDesktop('AI 预算已用尽', `${source}已暂停\n${reason}`, `ai-budget-${payload.source || ''}`)
+    })
+
     return () => {
       offAlert()
       offDigest()
+      offBudget()
     }
   }, [])
 
@@ -96,6 +108,10 @@ function App() {
               <svg className="w-4 h-4" fill="none" stroke="currentColor" viewBox="0 0 24 24"><path strokeLinecap="round" strokeLinejoin="round" strokeWidth={1.5} d="M19 4H5a2 2 0 00-2 2v10a2 2 0 002 2h4l3 3 3-3h4a2 2 0 002-2V6a2 2 0 00-2-2z" /></svg>
               新闻电报
             </NavLink>
+            <NavLink to="/qa" className={navCls}>
+              <svg className="w-4 h-4" fill="none" stroke="currentColor" viewBox="0 0 24 24"><path strokeLinecap="round" strokeLinejoin="round" strokeWidth={1.5} d="M8 10h.01M12 10h.01M16 10h.01M9 16H5a2 2 0 01-2-2V6a2 2 0 012-2h14a2 2 0 012 2v8a2 2 0 01-2 2h-4l-3 3-3-3z" /></svg>
+              跨文章问答
+            </NavLink>
             <NavLink to="/settings" className={navCls}>
               <svg className="w-4 h-4" fill="none" stroke="currentColor" viewBox="0 0 24 24"><path strokeLinecap="round" strokeLinejoin="round" strokeWidth={1.5} d="M10.325 4.317c.426-1.756 2.924-1.756 3.35 0a1.724 1.724 0 002.573 1.066c1.543-.94 3.31.826 2.37 2.37a1.724 1.724 0 001.066 2.573c1.756.426 1.756 2.924 0 3.35a1.724 1.724 0 00-1.066 2.573c.94 1.543-.826 3.31-2.37 2.37a1.724 1.724 0 00-2.573 1.066c-.426 1.756-2.924 1.756-3.35 0a1.724 1.724 0 00-2.573-1.066c-1.543.94-3.31-.826-2.37-2.37a1.724 1.724 0 00-1.066-2.573c-1.756-.426-1.756-2.924 0-3.35a1.724 1.724 0 001.066-2.573c-.94-1.543.826-3.31 2.37-2.37.996.608 2.296.07 2.572-1.065z" /><path strokeLinecap="round" strokeLinejoin="round" strokeWidth={1.5} d="M15 12a3 3 0 11-6 0 3 3 0 016 0z" /></svg>
               设置
@@ -107,6 +123,7 @@ function App() {
             <Route path="/" element={<Articles />} />
             <Route path="/news" element={<News />} />
             <Route path="/article/:id" element={<ArticleDetail />} />
+            <Route path="/qa" element={<LibraryQA />} />
             <Route path="/settings" element={<Settings />} />
           </Routes>
         </main>
@@ -1,6 +1,6 @@
 import { useEffect, useMemo, useRef, useState } from 'react'
-import { useNavigate, useParams } from 'react-router-dom'
-import ReactMarkdown from 'react-markdown'
+import { useLocation, useNavigate, useParams } from 'react-router-dom'
+import ReactMarkdown, { defaultUrlTransform } from 'react-markdown'
 import {
   AnalyzeArticleWithMode,
   AskQuestion,
@@ -12,10 +12,12 @@ import {
   ExportArticle,
   GetAnalysisHistory,
   GetArticle,
+  GetArticleAssets,
   GetArticleTags,
   GetChannels,
   GetPrompts,
   GetRoles,
+  GetStructuredAnalysis,
   GetQAMessages,
   GetQAPins,
   GetQASessions,
@@ -33,6 +35,7 @@ const analysisModes = [
 
 type AnalysisMode = (typeof analysisModes)[number]['value']
 type DetailTab = 'analysis' | 'qa'
+type SourceView = 'content' | 'assets'
 
 type StructuredAnalysis = {
   summary: string
@@ -44,6 +47,7 @@ type StructuredAnalysis = {
 export default function ArticleDetail() {
   const { id } = useParams()
   const navigate = useNavigate()
+  const location = useLocation()
   const [article, setArticle] = useState<models.Article | null>(null)
   const [channels, setChannels] = useState<models.AIChannel[]>([])
   const [prompts, setPrompts] = useState<models.Prompt[]>([])
@@ -51,18 +55,24 @@ export default function ArticleDetail() {
   const [promptId, setPromptId] = useState(0)
   const [analysisMode, setAnalysisMode] = useState<AnalysisMode>('text')
   const [streaming, setStreaming] = useState('')
+  const [reasoningStream, setReasoningStream] = useState('')
   const [analyzing, setAnalyzing] = useState(false)
   const [error, setError] = useState('')
   const [allTags, setAllTags] = useState<models.Tag[]>([])
   const [articleTags, setArticleTags] = useState<models.Tag[]>([])
   const [showTagPicker, setShowTagPicker] = useState(false)
+  const [assets, setAssets] = useState<models.ArticleAsset[]>([])
+  const [sourceView, setSourceView] = useState<SourceView>('content')
   const [history, setHistory] = useState<models.AnalysisHistory[]>([])
+  const [storedStructured, setStoredStructured] = useState<models.StructuredAnalysis | null>(null)
   const [historyId, setHistoryId] = useState(0)
 
   const [detailTab, setDetailTab] = useState<DetailTab>('analysis')
   const [qaSessions, setQaSessions] = useState<models.QASession[]>([])
   const [qaSessionId, setQaSessionId] = useState(0)
   const [qaMessages, setQaMessages] = useState<models.QAMessage[]>([])
+  // Reasoning of QA roles is only streamed, not stored, so it lives here.
+  const [qaReasoning, setQaReasoning] = useState<Record<number, string>>({})
   const [qaPins, setQaPins] = useState<models.QAPin[]>([])
   const [pinDraft, setPinDraft] = useState('')
   const [qaQuestion, setQaQuestion] = useState('')
@@ -81,6 +91,7 @@ export default function ArticleDetail() {
   const qaInputRef = useRef<HTMLTextAreaElement | null>(null)
   const askSeqRef = useRef(0)
   const askHardTimeoutRef = useRef<number | null>(null)
+  const sourceRef = useRef<HTMLDivElement | null>(null)
   const pendingFollowUpMessageRef = useRef(0)
   const [followUpMessage, setFollowUpMessage] = useState<models.QAMessage | null>(null)
 
@@ -160,6 +171,8 @@ export default function ArticleDetail() {
     }
 
     GetArticle(aid).then(setArticle)
+    GetArticleAssets(aid).then((list) => setAssets(list || []))
+    setSourceView('content')
     GetChannels().then((list) => {
       setChannels(list || [])
       const defaultChannel = (list || []).find((c) => c.isDefault === 1)
@@ -182,6 +195,8 @@ export default function ArticleDetail() {
     GetTags().then((list) => setAllTags(list || []))
     GetArticleTags(aid).then((list) => setArticleTags(list || []))
     GetAnalysisHistory(aid).then((list) => setHistory(list || []))
+    GetStructuredAnalysis(aid).then((item) => setStoredStructured(item || null))
+    setReasoningStream('')
     loadQASessions()
   }, [aid])
 
@@ -190,8 +205,13 @@ export default function ArticleDetail() {
       const chunk = args[0]
       setStreaming((prev) => prev + (typeof chunk === 'string' ? chunk : ''))
     })
+    const offReasoning = EventsOn('analysis-reasoning-chunk', (...args: unknown[]) => {
+      const chunk = args[0]
+      setReasoningStream((prev) => prev + (typeof chunk === 'string' ? chunk : ''))
+    })
     return () => {
       off()
+      offReasoning()
     }
   }, [aid])
 
@@ -250,7 +270,9 @@ export default function ArticleDetail() {
       }
     })
 
-    const offRoleStart = EventsOn('qa-role-start', (...args: unknown[]) => {
+    // Roles and the moderator stream their messages through the same
+    // start/chunk/done payloads.
+    const onStreamedMessage = (...args: unknown[]) => {
       const raw = args[0]
       if (!raw || typeof raw !== 'object') {
         return
@@ -260,9 +282,9 @@ export default function ArticleDetail() {
         return
       }
       upsertQAMessage(msg)
-    })
+    }
 
-    const offRoleChunk = EventsOn('qa-role-chunk', (...args: unknown[]) => {
+    const onStreamedChunk = (...args: unknown[]) => {
       const payload = (args[0] || {}) as Record<string, unknown>
       const messageID = Number(payload.messageId || 0)
       const chunk = typeof payload.chunk === 'string' ? payload.chunk : ''
@@ -282,20 +304,26 @@ export default function ArticleDetail() {
         })
         return next
       })
-    })
+    }
 
-    const offRoleDone = EventsOn('qa-role-done', (...args: unknown[]) => {
-      const raw = args[0]
-      if (!raw || typeof raw !== 'object') {
-        return
-      }
-      const msg = new models.QAMessage(raw)
-      if (!msg.sessionId || (activeSessionRef.current && msg.sessionId !== activeSessionRef.current)) {
+    const offRoleStart = EventsOn('qa-role-start', onStreamedMessage)
+    const offRoleChunk = EventsOn('qa-role-chunk', onStreamedChunk)
+    const offModeratorStart = EventsOn('qa-moderator-start', onStreamedMessage)
+    const offModeratorChunk = EventsOn('qa-moderator-chunk', onStreamedChunk)
+
+    const offRoleReasoning = EventsOn('qa-role-reasoning-chunk', (...args: unknown[]) => {
+      const payload = (args[0] || {}) as Record<string, unknown>
+      const messageID = Number(payload.messageId || 0)
+      const chunk = typeof payload.chunk === 'string' ? payload.chunk : ''
+      if (!messageID || !chunk) {
         return
       }
-      upsertQAMessage(msg)
+      setQaReasoning((prev) => ({ ...prev, [messageID]: `${prev[messageID] || ''}${chunk}` }))
     })
 
+    const offRoleDone = EventsOn('qa-role-done', onStreamedMessage)
+    const offModeratorDone = EventsOn('qa-moderator-done', onStreamedMessage)
+
     const offRoleError = EventsOn('qa-role-error', (...args: unknown[]) => {
       const payload = (args[0] || {}) as Record<string, unknown>
       const messageID = Number(payload.messageId || 0)
@@ -324,6 +352,20 @@ export default function ArticleDetail() {
       })
     })
 
+    // A failed synthesis leaves the role answers in place.
+    const offModeratorError = EventsOn('qa-moderator-error', (...args: unknown[]) => {
+      const payload = (args[0] || {}) as Record<string, unknown>
+      const messageID = Number(payload.messageId || 0)
+      const errMsg = typeof payload.error === 'string' ? payload.error : '主持综合失败'
+      if (!messageID) {
+        setQaError(errMsg)
+        return
+      }
+      setQaMessages((prev) => prev.map((item) => (
+        item.id === messageID ? new models.QAMessage({ ...item, status: 'failed', errorReason: errMsg }) : item
+      )))
+    })
+
     const offJobDone = EventsOn('qa-job-done', (...args: unknown[]) => {
       const payload = (args[0] || {}) as Record<string, unknown>
       const sessionID = Number(payload.sessionId || 0)
@@ -344,8 +386,13 @@ export default function ArticleDetail() {
       offJobStart()
       offRoleStart()
       offRoleChunk()
+      offRoleReasoning()
       offRoleDone()
       offRoleError()
+      offModeratorStart()
+      offModeratorChunk()
+      offModeratorDone()
+      offModeratorError()
       offJobDone()
     }
   }, [aid])
@@ -367,6 +414,7 @@ export default function ArticleDetail() {
 
     setError('')
     setStreaming('')
+    setReasoningStream('')
     setAnalyzing(true)
     setHistoryId(0)
 
@@ -377,6 +425,7 @@ export default function ArticleDetail() {
       } else {
         GetArticle(aid).then(setArticle)
         GetAnalysisHistory(aid).then((list) => setHistory(list || []))
+        GetStructuredAnalysis(aid).then((item) => setStoredStructured(item || null))
       }
     } catch (e: unknown) {
       const message = e instanceof Error ? e.message : '分析失败'
@@ -647,8 +696,38 @@ export default function ArticleDetail() {
     })
   }
 
+  // Shows the section an evidence was quoted from in the source pane.
+  const handleJumpToEvidence = (ev: models.QAEvidence) => {
+    setSourceView('content')
+    window.setTimeout(() => {
+      const root = sourceRef.current
+      const target = root && findEvidenceTarget(root, ev)
+      if (!root || !target) return
+      if (target instanceof HTMLElement) {
+        target.scrollIntoView({ behavior: 'smooth', block: 'center' })
+        target.classList.add('bg-yellow-100')
+        window.setTimeout(() => target.classList.remove('bg-yellow-100'), 2000)
+        return
+      }
+      const top = target.getBoundingClientRect().top - root.getBoundingClientRect().top
+      root.scrollBy({ top: top - root.clientHeight / 2, behavior: 'smooth' })
+      const selection = window.getSelection()
+      selection?.removeAllRanges()
+      selection?.addRange(target)
+    }, 0)
+  }
+
+  // A citation opened from cross-article QA jumps to its section once the
+  // article is shown.
+  const openedEvidence = (location.state as { evidence?: models.QAEvidence } | null)?.evidence
+  useEffect(() => {
+    if (article && openedEvidence && openedEvidence.articleId === article.id) {
+      handleJumpToEvidence(openedEvidence)
+    }
+  }, [article?.id, location.key])
+
   const handlePickFollowUpMessage = (msg: models.QAMessage) => {
-    if (msg.roleType !== 'assistant' || !msg.id) {
+    if ((msg.roleType !== 'assistant' && msg.roleType !== 'moderator') || !msg.id) {
       return
     }
     setFollowUpMessage(msg)
@@ -688,10 +767,48 @@ export default function ArticleDetail() {
 
   const selectedHistory = historyId ? history.find((h) => h.id === historyId) : null
   const analysis = analyzing ? streaming : (selectedHistory ? selectedHistory.analysis : (article?.analysis || streaming))
-
-  const structured = useMemo(() => parseStructuredAnalysis(analysis), [analysis])
-  const useStructuredCards = analysisMode === 'structured' && !!structured
+  // history[0] is the stored form of the current analysis; reasoning is only
+  // stored for channels that keep it, so fall back to the last stream.
+  const reasoning = analyzing
+    ? reasoningStream
+    : (selectedHistory ? selectedHistory.reasoning : (history[0]?.reasoning || reasoningStream)) || ''
+
+  // The stored row is the validated form of the article's current analysis;
+  // history entries and live streams are still parsed on the fly.
+  const showingStored = !analyzing && !selectedHistory && !!storedStructured
+  const structured = useMemo<StructuredAnalysis | null>(
+    () => (showingStored && storedStructured
+      ? {
+          summary: storedStructured.summary,
+          risks: storedStructured.risks || [],
+          catalysts: storedStructured.catalysts || [],
+          valuationView: storedStructured.valuationView,
+        }
+      : parseStructuredAnalysis(analysis)),
+    [analysis, showingStored, storedStructured],
+  )
+  // Prompts with their own output schema have no summary; their fields are
+  // shown generically in reply order.
+  const customStructured = useMemo<Record<string, unknown> | null>(
+    () => parseCustomStructured(showingStored && storedStructured?.payload ? storedStructured.payload : analysis),
+    [analysis, showingStored, storedStructured],
+  )
+  const useStructuredCards = !!structured && (analysisMode === 'structured' || showingStored)
   const articleContentIsMarkdown = useMemo(() => looksLikeMarkdown(article?.content || ''), [article?.content])
+  // MinerU markdown links images relative to its result, e.g. images/x.jpg;
+  // those are served from the parse cache.
+  const assetUrlTransform = useMemo(() => {
+    const byPath = new Map(assets.filter((a) => a.url).map((a) => [a.path, a.url]))
+    return (url: string) => {
+      const rel = url.replace(/^\.\//, '')
+      for (const [path, assetUrl] of byPath) {
+        if (path === rel || path.endsWith('/' + rel)) {
+          return assetUrl
+        }
+      }
+      return defaultUrlTransform(url)
+    }
+  }, [assets])
 
   const sortedQAMessages = useMemo(
     () => [...qaMessages].sort((a, b) => normalizeMessageOrderID(a.id) - normalizeMessageOrderID(b.id)),
@@ -805,13 +922,31 @@ export default function ArticleDetail() {
 
       <div className="flex-1 grid grid-cols-2 gap-4 min-h-0">
         <div className="bg-white rounded-xl border border-gray-200/80 flex flex-col overflow-hidden">
-          <div className="px-4 py-3 border-b border-gray-100 bg-gray-50/50">
+          <div className="px-4 py-3 border-b border-gray-100 bg-gray-50/50 flex items-center justify-between gap-3">
             <h3 className="text-xs font-medium text-gray-500 uppercase tracking-wider">原文</h3>
+            {assets.length > 0 && (
+              <div className="inline-flex bg-gray-100 rounded-lg p-0.5">
+                <button
+                  onClick={() => setSourceView('content')}
+                  className={`px-2.5 py-1 text-xs rounded-md transition-colors ${sourceView === 'content' ? 'bg-white text-gray-700 shadow-sm' : 'text-gray-500 hover:text-gray-700'}`}
+                >
+                  正文
+                </button>
+                <button
+                  onClick={() => setSourceView('assets')}
+                  className={`px-2.5 py-1 text-xs rounded-md transition-colors ${sourceView === 'assets' ? 'bg-white text-gray-700 shadow-sm' : 'text-gray-500 hover:text-gray-700'}`}
+                >
+                  图表 {assets.length}
+                </button>
+              </div>
+            )}
           </div>
-          <div className="p-4 overflow-auto flex-1">
-            {articleContentIsMarkdown ? (
+          <div ref={sourceRef} className="p-4 overflow-auto flex-1">
+            {sourceView === 'assets' && assets.length > 0 ? (
+              <AssetList assets={assets} />
+            ) : articleContentIsMarkdown ? (
               <div className="text-sm text-gray-700 leading-relaxed prose prose-sm max-w-none prose-headings:text-gray-800 prose-a:text-blue-500">
-                <ReactMarkdown>{article.content}</ReactMarkdown>
+                <ReactMarkdown urlTransform={assetUrlTransform}>{article.content}</ReactMarkdown>
               </div>
             ) : (
               <div className="text-sm text-gray-700 leading-relaxed whitespace-pre-wrap">{article.content}</div>
@@ -869,8 +1004,11 @@ export default function ArticleDetail() {
 
           {detailTab === 'analysis' ? (
             <div className="p-4 overflow-auto flex-1">
+              {reasoning && <ReasoningBlock text={reasoning} streaming={analyzing && !streaming} />}
               {analysis ? (
-                useStructuredCards && structured ? (
+                useStructuredCards && customStructured ? (
+                  <CustomStructuredCards data={customStructured} />
+                ) : useStructuredCards && structured ? (
                   <StructuredCards data={structured} />
                 ) : (
                   <div className="text-sm text-gray-700 leading-relaxed prose prose-sm max-w-none prose-headings:text-gray-800 prose-a:text-blue-500">
@@ -922,15 +1060,19 @@ export default function ArticleDetail() {
               <div className="flex-1 overflow-auto space-y-3 pr-1">
                 {sortedQAMessages.map((msg) => {
                   const isUser = msg.roleType === 'user'
+                  const isModerator = msg.roleType === 'moderator'
                   return (
-                    <div key={msg.id} className={`max-w-[92%] rounded-lg border px-3 py-2 ${isUser ? 'ml-auto bg-blue-50 border-blue-100' : 'bg-gray-50 border-gray-200'}`}>
+                    <div key={msg.id} className={`max-w-[92%] rounded-lg border px-3 py-2 ${isUser ? 'ml-auto bg-blue-50 border-blue-100' : isModerator ? 'bg-violet-50 border-violet-200' : 'bg-gray-50 border-gray-200'}`}>
                       <div className="flex items-center justify-between gap-2 text-xs mb-1">
-                        <span className="font-medium text-gray-700">{isUser ? '你' : (msg.roleName || '助手')}</span>
+                        <span className="font-medium text-gray-700">{isUser ? '你' : isModerator ? `综合观点 · ${msg.roleName || '主持'}` : (msg.roleName || '助手')}</span>
                         <span className="text-gray-400">{msg.status === 'running' ? '生成中' : msg.status === 'failed' ? '失败' : ''}</span>
                       </div>
                       <div className="text-sm text-gray-700 leading-relaxed prose prose-sm max-w-none prose-headings:text-gray-800 prose-a:text-blue-500">
-                        <ReactMarkdown>{msg.content || (msg.status === 'running' ? '正在生成回答...' : '')}</ReactMarkdown>
+                        <ReactMarkdown>{msg.content || (msg.status === 'running' ? (isModerator ? '正在综合各角色观点...' : '正在生成回答...') : '')}</ReactMarkdown>
                       </div>
+                      {!isUser && qaReasoning[msg.id] && (
+                        <ReasoningBlock text={qaReasoning[msg.id]} streaming={msg.status === 'running' && !msg.content} />
+                      )}
                       {msg.errorReason && (
                         <div className="text-xs text-red-500 mt-1">{msg.errorReason}</div>
                       )}
@@ -939,7 +1081,16 @@ export default function ArticleDetail() {
                           <div className="text-xs text-gray-500 mb-1">参考片段</div>
                           <div className="space-y-1">
                             {(msg.evidences || []).slice(0, 4).map((ev) => (
-                              <div key={ev.id} className="text-xs text-gray-600 leading-relaxed">[{ev.chunkIndex}] {ev.quote}</div>
+                              <button
+                                key={ev.id}
+                                onClick={() => handleJumpToEvidence(ev)}
+                                title={[ev.headingPath, ev.reason].filter(Boolean).join('\n') || '定位到原文'}
+                                className="block w-full text-left text-xs text-gray-600 leading-relaxed hover:text-gray-800"
+                              >
+                                {ev.chunkIndex > 0 && <>[{ev.chunkIndex}]{' '}</>}
+                                {evidenceLocation(ev) && <span className="text-blue-500">{evidenceLocation(ev)} </span>}
+                                {ev.quote}
+                              </button>
                             ))}
                           </div>
                         </div>
@@ -1091,6 +1242,61 @@ export default function ArticleDetail() {
   )
 }
 
+// AssetList shows the images and tables parsed out of the source document.
+// Table HTML comes from the parser, so only its cell text is rendered.
+function AssetList({ assets }: { assets: models.ArticleAsset[] }) {
+  return (
+    <div className="space-y-5">
+      {assets.map((asset) => (
+        <figure key={asset.id} className="space-y-1.5">
+          {asset.kind === 'table' && asset.html ? (
+            <div className="overflow-x-auto">
+              <table className="text-xs text-gray-700 border-collapse">
+                <tbody>
+                  {parseTableHtml(asset.html).map((row, i) => (
+                    <tr key={i}>
+                      {row.map((cell, j) => {
+                        const Cell = cell.header ? 'th' : 'td'
+                        return (
+                          <Cell key={j} rowSpan={cell.rowSpan} colSpan={cell.colSpan} className="border border-gray-200 px-2 py-1 align-top">
+                            {cell.text}
+                          </Cell>
+                        )
+                      })}
+                    </tr>
+                  ))}
+                </tbody>
+              </table>
+            </div>
+          ) : asset.url ? (
+            <img src={asset.url} alt={asset.caption} className="max-w-full rounded border border-gray-100" />
+          ) : null}
+          {(asset.caption || asset.page > 0) && (
+            <figcaption className="text-xs text-gray-400">
+              {asset.page > 0 && <span className="mr-2">P{asset.page}</span>}
+              {asset.caption}
+            </figcaption>
+          )}
+        </figure>
+      ))}
+    </div>
+  )
+}
+
+type TableCell = { text: string; header: boolean; rowSpan: number; colSpan: number }
+
+function parseTableHtml(html: string): TableCell[][] {
+  const doc = new DOMParser().parseFromString(html, 'text/html')
+  return Array.from(doc.querySelectorAll('tr')).map((tr) =>
+    Array.from(tr.querySelectorAll('td, th')).map((cell) => ({
+      text: (cell.textContent || '').trim(),
+      header: cell.tagName === 'TH',
+      rowSpan: Number(cell.getAttribute('rowspan')) || 1,
+      colSpan: Number(cell.getAttribute('colspan')) || 1,
+    })),
+  )
+}
+
 function StructuredCards({ data }: { data: StructuredAnalysis }) {
   return (
     <div className="space-y-3 text-sm text-gray-700">
@@ -1125,6 +1331,56 @@ function StructuredCards({ data }: { data: StructuredAnalysis }) {
   )
 }
 
+// ReasoningBlock shows a model's thinking, expanded only while it is the
+// only output so far.
+function ReasoningBlock({ text, streaming }: { text: string; streaming: boolean }) {
+  return (
+    <details open={streaming} className="mb-3 rounded-lg border border-amber-200 bg-amber-50/60 px-3 py-2 text-xs text-gray-600">
+      <summary className="cursor-pointer select-none font-medium text-amber-700">{streaming ? '推理中...' : '推理过程'}</summary>
+      <div className="mt-2 whitespace-pre-wrap leading-relaxed max-h-64 overflow-auto">{text}</div>
+    </details>
+  )
+}
+
+function CustomStructuredCards({ data }: { data: Record<string, unknown> }) {
+  return (
+    <div className="space-y-3 text-sm text-gray-700">
+      {Object.entries(data).map(([key, value]) => (
+        <section key={key} className="rounded-lg border border-gray-200 bg-gray-50 p-3">
+          <h4 className="text-xs font-semibold text-gray-500 mb-2">{key}</h4>
+          {typeof value === 'string' ? (
+            <p className="leading-relaxed">{value || '无'}</p>
+          ) : Array.isArray(value) && value.every((x) => typeof x === 'string') ? (
+            value.length > 0 ? (
+              <ul className="list-disc pl-4 space-y-1">
+                {value.map((item, idx) => <li key={`${item}-${idx}`}>{item as string}</li>)}
+              </ul>
+            ) : <p>无</p>
+          ) : (
+            <pre className="text-xs whitespace-pre-wrap break-all">{JSON.stringify(value, null, 2)}</pre>
+          )}
+        </section>
+      ))}
+    </div>
+  )
+}
+
+function parseCustomStructured(raw: string): Record<string, unknown> | null {
+  const cleaned = extractJSONObject(raw)
+  if (!cleaned) {
+    return null
+  }
+  try {
+    const parsed = JSON.parse(cleaned) as unknown
+    if (!parsed || typeof parsed !== 'object' || Array.isArray(parsed) || 'summary' in parsed) {
+      return null
+    }
+    return parsed as Record<string, unknown>
+  } catch {
+    return null
+  }
+}
+
 function parseStructuredAnalysis(raw: string): StructuredAnalysis | null {
   const cleaned = extractJSONObject(raw)
   if (!cleaned) {
@@ -1210,3 +1466,49 @@ function normalizeMessageOrderID(id: number): number {
 function normalizeComparableText(text: string): string {
   return (text || '').trim().replace(/\s+/g, ' ')
 }
+
+// evidenceLocation labels where an evidence was quoted from, e.g.
+// "P12 · 三、盈利预测": its pages and nearest heading.
+function evidenceLocation(ev: models.QAEvidence): string {
+  const parts: string[] = []
+  if (ev.pageStart > 0) {
+    parts.push(ev.pageEnd > ev.pageStart ? `P${ev.pageStart}-${ev.pageEnd}` : `P${ev.pageStart}`)
+  }
+  const heading = (ev.headingPath || '').split(' > ').pop()
+  if (heading) {
+    parts.push(heading)
+  }
+  return parts.join(' · ')
+}
+
+// findEvidenceTarget finds where an evidence quote starts in the source
+// pane: the rendered markdown block, or the text range in plain content.
+// Body lines are tried before the heading line, which may repeat.
+function findEvidenceTarget(root: HTMLElement, ev: models.QAEvidence): HTMLElement | Range | null {
+  const blocks = Array.from(root.querySelectorAll<HTMLElement>('h1,h2,h3,h4,h5,h6,p,li,td,th,pre'))
+  const lines = ev.quote
+    .split('\n')
+    .map((line) => normalizeComparableText(line.replace(/[*_`#>|]/g, ' ').replace(/^\s*[-+]\s+/, '')).slice(0, 24))
+    .filter((line) => line.length >= 4)
+  const needles = [...lines.slice(1), ...lines.slice(0, 1)]
+  for (const needle of needles) {
+    const found = blocks.find((el) => normalizeComparableText(el.textContent || '').includes(needle))
+    if (found) return found
+  }
+  if (blocks.length > 0) return null
+
+  const walker = document.createTreeWalker(root, NodeFilter.SHOW_TEXT)
+  for (let node = walker.nextNode(); node; node = walker.nextNode()) {
+    const text = node.textContent || ''
+    for (const needle of needles) {
+      const at = text.indexOf(needle)
+      if (at >= 0) {
+        const range = document.createRange()
+        range.setStart(node, at)
+        range.setEnd(node, at + needle.length)
+        return range
+      }
+    }
+  }
+  return null
+}
@@ -9,9 +9,13 @@ import {
   GetPrompts,
   GetTags,
   ImportArticles,
+  ImportFilePath,
+  ImportURL,
   PauseBatchAnalyze,
   ResumeBatchAnalyze,
   RetryFailedBatchAnalyze,
+  SearchFullText,
+  SearchStructuredAnalyses,
   StartBatchAnalyze,
 } from '../../wailsjs/go/main/App'
 import type { models } from '../../wailsjs/go/models'
@@ -30,12 +34,47 @@ const modeOptions = [
 
 type AnalysisMode = (typeof modeOptions)[number]['value']
 
+const structuredFieldOptions = [
+  { value: '', label: '标题/正文' },
+  { value: 'fulltext', label: '全文（含解读/问答）' },
+  { value: 'all', label: '全部结构化字段' },
+  { value: 'summary', label: '核心结论' },
+  { value: 'risks', label: '主要风险' },
+  { value: 'catalysts', label: '催化因素' },
+  { value: 'valuationView', label: '估值观点' },
+] as const
+
+const structuredFieldLabel: Record<string, string> = {
+  summary: '核心结论',
+  risks: '主要风险',
+  catalysts: '催化因素',
+  valuationView: '估值观点',
+}
+
+const fullTextFieldLabel: Record<string, string> = {
+  title: '标题',
+  content: '正文',
+  analysis: '解读',
+  question: '提问',
+  answer: '回答',
+}
+
 export default function Articles() {
   const [articles, setArticles] = useState<models.Article[]>([])
   const [keyword, setKeyword] = useState('')
   const [debouncedKeyword, setDebouncedKeyword] = useState('')
   const [tags, setTags] = useState<models.Tag[]>([])
   const [filterTag, setFilterTag] = useState(0)
+  const [filterStatus, setFilterStatus] = useState(-1)
+  const [createdFrom, setCreatedFrom] = useState('')
+  const [createdTo, setCreatedTo] = useState('')
+  const [total, setTotal] = useState(0)
+  const [nextCursor, setNextCursor] = useState('')
+  const [listError, setListError] = useState('')
+  const [searchField, setSearchField] = useState('')
+  const [structuredHits, setStructuredHits] = useState<models.StructuredAnalysisHit[]>([])
+  const [fullTextHits, setFullTextHits] = useState<models.SearchHit[]>([])
+  const [fullTextError, setFullTextError] = useState('')
   const [selected, setSelected] = useState<Set<number>>(new Set())
 
   const [taskCenterOpen, setTaskCenterOpen] = useState(false)
@@ -49,11 +88,49 @@ export default function Articles() {
   const [batchError, setBatchError] = useState('')
   const [importError, setImportError] = useState('')
   const [importing, setImporting] = useState(false)
+  const [importURL, setImportURL] = useState('')
+  const [importNotice, setImportNotice] = useState('')
 
   const navigate = useNavigate()
 
-  const load = (kw: string = debouncedKeyword, tagId: number = filterTag) =>
-    GetArticles(kw, tagId).then((list) => setArticles(list || []))
+  const articleQuery = (cursor = '') => ({
+    keyword: debouncedKeyword,
+    tagIds: filterTag > 0 ? [filterTag] : [],
+    tagMode: 'any',
+    statuses: filterStatus >= 0 ? [filterStatus] : [],
+    sources: [],
+    createdFrom,
+    createdTo,
+    analyzedFrom: '',
+    analyzedTo: '',
+    sort: 'created_desc',
+    watchOnly: false,
+    cursor,
+    limit: 50,
+  })
+
+  const load = () =>
+    GetArticles(articleQuery())
+      .then((page) => {
+        setArticles(page?.items || [])
+        setTotal(page?.total || 0)
+        setNextCursor(page?.nextCursor || '')
+        setListError('')
+      })
+      .catch((e) => setListError(String(e)))
+
+  const loadMore = () => {
+    if (!nextCursor) {
+      return
+    }
+    GetArticles(articleQuery(nextCursor))
+      .then((page) => {
+        setArticles((prev) => [...prev, ...(page?.items || [])])
+        setTotal(page?.total || 0)
+        setNextCursor(page?.nextCursor || '')
+      })
+      .catch((e) => setListError(String(e)))
+  }
   const loadTags = () => GetTags().then((list) => setTags(list || []))
 
   useEffect(() => {
@@ -65,7 +142,34 @@ export default function Articles() {
 
   useEffect(() => {
     load()
-  }, [debouncedKeyword, filterTag])
+  }, [debouncedKeyword, filterTag, filterStatus, createdFrom, createdTo])
+
+  useEffect(() => {
+    if (searchField !== 'fulltext' || !debouncedKeyword.trim()) {
+      setFullTextHits([])
+      setFullTextError('')
+      return
+    }
+    SearchFullText(debouncedKeyword, 'all', 100)
+      .then((list) => {
+        setFullTextHits(list || [])
+        setFullTextError('')
+      })
+      .catch((e) => {
+        setFullTextHits([])
+        setFullTextError(String(e))
+      })
+  }, [searchField, debouncedKeyword])
+
+  useEffect(() => {
+    if (!searchField || searchField === 'fulltext' || !debouncedKeyword.trim()) {
+      setStructuredHits([])
+      return
+    }
+    SearchStructuredAnalyses(searchField === 'all' ? '' : searchField, debouncedKeyword, 100)
+      .then((list) => setStructuredHits(list || []))
+      .catch(() => setStructuredHits([]))
+  }, [searchField, debouncedKeyword])
 
   useEffect(() => {
     loadTags()
@@ -86,23 +190,47 @@ export default function Articles() {
     const offD = EventsOn('batch-done', () => {
       load()
     })
+    // Articles imported from watched folders show up without a manual refresh.
+    const offW = EventsOn('folder-watch-done', () => {
+      load()
+    })
 
     return () => {
       offS()
       offE()
       offD()
+      offW()
     }
-  }, [debouncedKeyword, filterTag])
+  }, [debouncedKeyword, filterTag, filterStatus, createdFrom, createdTo])
+
+  // Possible duplicates are imported only after the user confirms; exact
+  // duplicates are reported and skipped.
+  const settleImportResults = async (results: models.ImportResult[], retry: (r: models.ImportResult) => Promise<models.ImportResult>) => {
+    const notices: string[] = []
+    for (const result of results) {
+      if (result.duplicate === 'similar' && window.confirm(`${result.message}\n\n仍要导入吗？`)) {
+        const forced = await retry(result)
+        if (forced.message) {
+          notices.push(forced.message)
+        }
+      } else if (result.duplicate) {
+        notices.push(result.message)
+      }
+    }
+    setImportNotice(notices.join('；'))
+  }
 
   const handleImport = async () => {
     if (importing) {
       return
     }
     setImportError('')
+    setImportNotice('')
     setImporting(true)
     try {
-      const list = await ImportArticles()
-      if (list?.length) {
+      const results = await ImportArticles()
+      if (results?.length) {
+        await settleImportResults(results, (r) => ImportFilePath(r.filePath, true))
         await load()
       } else {
         setImportError('未导入到任何文章，请检查文件格式或 MinerU 配置')
@@ -118,6 +246,26 @@ export default function Articles() {
     }
   }
 
+  const handleImportURL = async () => {
+    if (importing || !importURL.trim()) {
+      return
+    }
+    setImportError('')
+    setImportNotice('')
+    setImporting(true)
+    try {
+      const result = await ImportURL(importURL, false)
+      await settleImportResults([result], () => ImportURL(importURL, true))
+      setImportURL('')
+      await load()
+    } catch (err: unknown) {
+      const msg = err instanceof Error ? err.message : String(err || '')
+      setImportError(msg || '网址导入失败，请检查链接或网络连接')
+    } finally {
+      setImporting(false)
+    }
+  }
+
   const handleDelete = async (e: React.MouseEvent, id: number) => {
     e.stopPropagation()
     await DeleteArticle(id)
@@ -216,6 +364,10 @@ export default function Articles() {
     inProgress: 0,
     concurrency: batchConcurrency,
     failures: [],
+    queueDepth: 0,
+    avgWaitMs: 0,
+    maxWaitMs: 0,
+    pauseReason: '',
   }
 
   const showTaskCenter = taskCenterOpen || activeStatus.running || activeStatus.total > 0
@@ -225,6 +377,14 @@ export default function Articles() {
       <div className="flex items-center justify-between mb-5">
         <h2 className="text-xl font-semibold text-gray-800">文章列表</h2>
         <div className="flex items-center gap-2">
+          {selected.size > 0 && (
+            <button
+              onClick={() => navigate('/qa', { state: { articleIds: Array.from(selected) } })}
+              className="inline-flex items-center gap-1.5 px-4 py-2 bg-white border border-gray-200 text-gray-700 text-sm rounded-lg hover:bg-gray-50 shadow-sm transition-colors"
+            >
+              跨文章问答 ({selected.size})
+            </button>
+          )}
           {selected.size > 0 && !showTaskCenter && (
             <button
               onClick={openTaskCenter}
@@ -234,6 +394,25 @@ export default function Articles() {
               打开任务中心 ({selected.size})
             </button>
           )}
+          <input
+            type="text"
+            placeholder="粘贴网页或 PDF 链接"
+            value={importURL}
+            onChange={(e) => setImportURL(e.target.value)}
+            onKeyDown={(e) => {
+              if (e.key === 'Enter') {
+                void handleImportURL()
+              }
+            }}
+            className="w-56 px-3 py-2 bg-white border border-gray-200 rounded-lg text-sm focus:outline-none focus:ring-2 focus:ring-blue-500/20 focus:border-blue-400"
+          />
+          <button
+            onClick={handleImportURL}
+            disabled={importing || !importURL.trim()}
+            className="px-3 py-2 bg-white border border-gray-200 text-sm text-gray-700 rounded-lg hover:bg-gray-50 disabled:opacity-60 disabled:cursor-not-allowed"
+          >
+            从网址导入
+          </button>
           <button
             onClick={handleImport}
             disabled={importing}
@@ -258,6 +437,12 @@ export default function Articles() {
         </div>
       )}
 
+      {importNotice && (
+        <div className="mb-4 text-sm text-amber-700 bg-amber-50 border border-amber-200 rounded-lg px-4 py-2.5">
+          {importNotice}
+        </div>
+      )}
+
       {importError && (
         <div className="mb-4 text-sm text-red-600 bg-red-50 border border-red-200 rounded-lg px-4 py-2.5">
           {importError}
@@ -321,7 +506,14 @@ export default function Articles() {
             <span>成功 {activeStatus.success}</span>
             <span>失败 {activeStatus.failed}</span>
             <span>进行中 {activeStatus.inProgress}</span>
+            {activeStatus.queueDepth > 0 && <span className="text-amber-600">限流排队 {activeStatus.queueDepth}</span>}
+            {activeStatus.avgWaitMs > 0 && (
+              <span className="text-gray-400">平均等待 {(activeStatus.avgWaitMs / 1000).toFixed(1)}s / 最长 {(activeStatus.maxWaitMs / 1000).toFixed(1)}s</span>
+            )}
           </div>
+          {activeStatus.paused && activeStatus.pauseReason && (
+            <div className="mt-2 text-xs text-amber-600">已自动暂停：{activeStatus.pauseReason}</div>
+          )}
 
           {activeStatus.total > 0 && (
             <div className="mt-2 h-2 bg-emerald-100 rounded-full overflow-hidden">
@@ -389,67 +581,169 @@ export default function Articles() {
         </div>
       )}
 
-      <div className="relative mb-5">
-        <svg className="absolute left-3 top-1/2 -translate-y-1/2 w-4 h-4 text-gray-400" fill="none" stroke="currentColor" viewBox="0 0 24 24"><path strokeLinecap="round" strokeLinejoin="round" strokeWidth={2} d="M21 21l-6-6m2-5a7 7 0 11-14 0 7 7 0 0114 0z" /></svg>
-        <input
-          type="text"
-          placeholder="搜索文章标题或内容..."
-          value={keyword}
-          onChange={(e) => setKeyword(e.target.value)}
-          className="w-full pl-10 pr-4 py-2.5 bg-white border border-gray-200 rounded-lg text-sm focus:outline-none focus:ring-2 focus:ring-blue-500/20 focus:border-blue-400 transition-shadow"
-        />
+      <div className="flex gap-2 mb-5">
+        <select
+          value={searchField}
+          onChange={(e) => setSearchField(e.target.value)}
+          className="px-3 py-2.5 bg-white border border-gray-200 rounded-lg text-sm focus:outline-none focus:ring-2 focus:ring-blue-500/20 focus:border-blue-400"
+        >
+          {structuredFieldOptions.map((opt) => (
+            <option key={opt.value} value={opt.value}>{opt.label}</option>
+          ))}
+        </select>
+        <div className="relative flex-1">
+          <svg className="absolute left-3 top-1/2 -translate-y-1/2 w-4 h-4 text-gray-400" fill="none" stroke="currentColor" viewBox="0 0 24 24"><path strokeLinecap="round" strokeLinejoin="round" strokeWidth={2} d="M21 21l-6-6m2-5a7 7 0 11-14 0 7 7 0 0114 0z" /></svg>
+          <input
+            type="text"
+            placeholder={
+              searchField === 'fulltext'
+                ? '全文搜索，支持 AND / OR / NOT、-排除词、"短语"'
+                : searchField
+                  ? '搜索结构化解读，如：商誉减值'
+                  : '搜索文章标题或内容...'
+            }
+            value={keyword}
+            onChange={(e) => setKeyword(e.target.value)}
+            className="w-full pl-10 pr-4 py-2.5 bg-white border border-gray-200 rounded-lg text-sm focus:outline-none focus:ring-2 focus:ring-blue-500/20 focus:border-blue-400 transition-shadow"
+          />
+        </div>
       </div>
 
-      <div className="space-y-2">
-        {articles.map((a) => (
-          <div
-            key={a.id}
-            onClick={() => navigate(`/article/${a.id}`)}
-            className="group flex items-center gap-3 p-4 bg-white rounded-xl border border-gray-200/80 cursor-pointer hover:border-blue-300 hover:shadow-sm transition-all"
+      {!searchField && (
+        <div className="flex items-center gap-2 mb-4 text-xs text-gray-500">
+          <select
+            value={filterStatus}
+            onChange={(e) => setFilterStatus(Number(e.target.value))}
+            className="px-2 py-1.5 bg-white border border-gray-200 rounded-lg"
           >
-            <input
-              type="checkbox"
-              checked={selected.has(a.id)}
-              onClick={(e) => toggleSelect(e, a.id)}
-              onChange={() => {}}
-              className="w-4 h-4 rounded border-gray-300 text-blue-500 shrink-0"
-            />
-            <div className="flex-1 min-w-0">
+            <option value={-1}>全部状态</option>
+            {Object.entries(statusMap).map(([value, s]) => (
+              <option key={value} value={value}>{s.text}</option>
+            ))}
+          </select>
+          <span>导入日期</span>
+          <input type="date" value={createdFrom} onChange={(e) => setCreatedFrom(e.target.value)} className="px-2 py-1.5 bg-white border border-gray-200 rounded-lg" />
+          <span>至</span>
+          <input type="date" value={createdTo} onChange={(e) => setCreatedTo(e.target.value)} className="px-2 py-1.5 bg-white border border-gray-200 rounded-lg" />
+          <span className="ml-auto">共 {total} 篇</span>
+        </div>
+      )}
+
+      {searchField === 'fulltext' ? (
+        <div className="space-y-2">
+          {fullTextHits.map((h) => (
+            <div
+              key={`${h.kind}-${h.articleId}-${h.messageId}`}
+              onClick={() => (h.articleId ? navigate(`/article/${h.articleId}`) : navigate('/qa', { state: { sessionId: h.sessionId } }))}
+              className="group p-4 bg-white rounded-xl border border-gray-200/80 cursor-pointer hover:border-blue-300 hover:shadow-sm transition-all"
+            >
               <div className="flex items-center gap-2">
-                <span className="text-sm font-medium text-gray-800 truncate group-hover:text-blue-600 transition-colors">{a.title}</span>
-                {a.tags?.map((t) => (
-                  <span
-                    key={t.id}
-                    className="text-xs px-2 py-0.5 rounded-full shrink-0"
-                    style={{ backgroundColor: `${t.color}20`, color: t.color }}
-                  >
-                    {t.name}
-                  </span>
-                ))}
+                <span className="text-sm font-medium text-gray-800 truncate group-hover:text-blue-600 transition-colors">{h.title}</span>
+                <span className={`text-xs px-2 py-0.5 rounded-full shrink-0 ${h.kind === 'qa' ? 'bg-amber-50 text-amber-600' : 'bg-violet-50 text-violet-600'}`}>
+                  {h.kind === 'qa' ? '问答 · ' : ''}{fullTextFieldLabel[h.field] || h.field}
+                </span>
               </div>
-              <div className="text-xs text-gray-400 mt-1.5">{new Date(a.createdAt).toLocaleString()}</div>
+              {/* Snippets are escaped by the backend; only <mark> is added. */}
+              <div
+                className="text-xs text-gray-500 mt-1.5 line-clamp-2 [&_mark]:bg-yellow-100 [&_mark]:text-gray-800"
+                dangerouslySetInnerHTML={{ __html: h.snippet }}
+              />
             </div>
-            <div className="flex items-center gap-3 ml-4 shrink-0">
-              <span className={`text-xs px-2.5 py-1 rounded-full font-medium ${statusMap[a.status]?.color}`}>
-                {statusMap[a.status]?.text}
-              </span>
-              <button
-                onClick={(e) => handleDelete(e, a.id)}
-                className="text-xs text-gray-400 hover:text-red-500 opacity-0 group-hover:opacity-100 transition-all"
-              >
-                删除
-              </button>
+          ))}
+          {fullTextHits.length === 0 && (
+            <div className="text-center py-20">
+              <p className="text-sm text-gray-400">
+                {fullTextError || (debouncedKeyword.trim() ? '没有匹配的文章或问答' : '输入关键词搜索文章、解读与问答')}
+              </p>
             </div>
-          </div>
-        ))}
-        {articles.length === 0 && (
-          <div className="text-center py-20">
-            <svg className="w-12 h-12 text-gray-300 mx-auto mb-3" fill="none" stroke="currentColor" viewBox="0 0 24 24"><path strokeLinecap="round" strokeLinejoin="round" strokeWidth={1} d="M9 12h6m-6 4h6m2 5H7a2 2 0 01-2-2V5a2 2 0 012-2h5.586a1 1 0 01.707.293l5.414 5.414a1 1 0 01.293.707V19a2 2 0 01-2 2z" /></svg>
-            <p className="text-sm text-gray-400">暂无文章</p>
-            <p className="text-xs text-gray-300 mt-1">点击右上角"导入文章"开始</p>
-          </div>
-        )}
-      </div>
+          )}
+        </div>
+      ) : searchField ? (
+        <div className="space-y-2">
+          {structuredHits.map((h, idx) => (
+            <div
+              key={`${h.articleId}-${h.field}-${idx}`}
+              onClick={() => navigate(`/article/${h.articleId}`)}
+              className="group p-4 bg-white rounded-xl border border-gray-200/80 cursor-pointer hover:border-blue-300 hover:shadow-sm transition-all"
+            >
+              <div className="flex items-center gap-2">
+                <span className="text-sm font-medium text-gray-800 truncate group-hover:text-blue-600 transition-colors">{h.title}</span>
+                <span className="text-xs px-2 py-0.5 rounded-full shrink-0 bg-violet-50 text-violet-600">
+                  {structuredFieldLabel[h.field] || h.field}
+                </span>
+              </div>
+              <div className="text-xs text-gray-500 mt-1.5 line-clamp-2">{h.content}</div>
+            </div>
+          ))}
+          {structuredHits.length === 0 && (
+            <div className="text-center py-20">
+              <p className="text-sm text-gray-400">{debouncedKeyword.trim() ? '没有匹配的结构化解读' : '输入关键词搜索结构化解读'}</p>
+            </div>
+          )}
+        </div>
+      ) : (
+        <div className="space-y-2">
+          {articles.map((a) => (
+            <div
+              key={a.id}
+              onClick={() => navigate(`/article/${a.id}`)}
+              className="group flex items-center gap-3 p-4 bg-white rounded-xl border border-gray-200/80 cursor-pointer hover:border-blue-300 hover:shadow-sm transition-all"
+            >
+              <input
+                type="checkbox"
+                checked={selected.has(a.id)}
+                onClick={(e) => toggleSelect(e, a.id)}
+                onChange={() => {}}
+                className="w-4 h-4 rounded border-gray-300 text-blue-500 shrink-0"
+              />
+              <div className="flex-1 min-w-0">
+                <div className="flex items-center gap-2">
+                  <span className="text-sm font-medium text-gray-800 truncate group-hover:text-blue-600 transition-colors">{a.title}</span>
+                  {a.tags?.map((t) => (
+                    <span
+                      key={t.id}
+                      className="text-xs px-2 py-0.5 rounded-full shrink-0"
+                      style={{ backgroundColor: `${t.color}20`, color: t.color }}
+                    >
+                      {t.name}
+                    </span>
+                  ))}
+                </div>
+                <div className="text-xs text-gray-400 mt-1.5">{new Date(a.createdAt).toLocaleString()}</div>
+              </div>
+              <div className="flex items-center gap-3 ml-4 shrink-0">
+                <span className={`text-xs px-2.5 py-1 rounded-full font-medium ${statusMap[a.status]?.color}`}>
+                  {statusMap[a.status]?.text}
+                </span>
+                <button
+                  onClick={(e) => handleDelete(e, a.id)}
+                  className="text-xs text-gray-400 hover:text-red-500 opacity-0 group-hover:opacity-100 transition-all"
+                >
+                  删除
+                </button>
+              </div>
+            </div>
+          ))}
+          {nextCursor && (
+            <button
+              onClick={loadMore}
+              className="w-full py-2.5 text-xs text-gray-500 bg-white border border-gray-200 rounded-xl hover:bg-gray-50"
+            >
+              加载更多（已显示 {articles.length} / {total}）
+            </button>
+          )}
+          {listError && (
+            <div className="text-xs text-red-600 bg-red-50 border border-red-200 rounded-lg px-3 py-2">{listError}</div>
+          )}
+          {articles.length === 0 && !listError && (
+            <div className="text-center py-20">
+              <svg className="w-12 h-12 text-gray-300 mx-auto mb-3" fill="none" stroke="currentColor" viewBox="0 0 24 24"><path strokeLinecap="round" strokeLinejoin="round" strokeWidth={1} d="M9 12h6m-6 4h6m2 5H7a2 2 0 01-2-2V5a2 2 0 012-2h5.586a1 1 0 01.707.293l5.414 5.414a1 1 0 01.293.707V19a2 2 0 01-2 2z" /></svg>
+              <p className="text-sm text-gray-400">暂无文章</p>
+              <p className="text-xs text-gray-300 mt-1">点击右上角"导入文章"开始</p>
+            </div>
+          )}
+        </div>
+      )}
     </div>
   )
 }
@@ -0,0 +1,444 @@
+import { useEffect, useMemo, useRef, useState } from 'react'
+import { useLocation, useNavigate } from 'react-router-dom'
+import ReactMarkdown from 'react-markdown'
+import {
+  AskQuestion,
+  AskQuestionFollowUp,
+  CancelAskQuestion,
+  CreateScopedQASession,
+  DeleteQASession,
+  GetQAMessages,
+  GetScopedQASessions,
+  GetTags,
+  GetTelegraphWatchlist,
+  ResolveQAScope,
+} from '../../wailsjs/go/main/App'
+import { models } from '../../wailsjs/go/models'
+import { EventsOn } from '../../wailsjs/runtime/runtime'
+
+// LibraryLocationState is how other pages open this one: with articles
+// picked in the list, or on a session found by full-text search.
+type LibraryLocationState = {
+  articleIds?: number[]
+  sessionId?: number
+}
+
+const emptyScope = (): models.QAScope => new models.QAScope({
+  articleIds: [],
+  tagIds: [],
+  keyword: '',
+  dateFrom: '',
+  dateTo: '',
+  watchStock: '',
+  limit: 0,
+})
+
+export default function LibraryQA() {
+  const navigate = useNavigate()
+  const location = useLocation()
+  const [sessions, setSessions] = useState<models.QASession[]>([])
+  const [sessionId, setSessionId] = useState(0)
+  const [messages, setMessages] = useState<models.QAMessage[]>([])
+  const [tags, setTags] = useState<models.Tag[]>([])
+  const [watchlist, setWatchlist] = useState<models.WatchStock[]>([])
+
+  const [creating, setCreating] = useState(false)
+  const [scope, setScope] = useState<models.QAScope>(emptyScope)
+  const [title, setTitle] = useState('')
+  const [preview, setPreview] = useState<models.QAScopeArticle[] | null>(null)
+  const [scopeError, setScopeError] = useState('')
+
+  const [question, setQuestion] = useState('')
+  const [followUp, setFollowUp] = useState<models.QAMessage | null>(null)
+  const [asking, setAsking] = useState(false)
+  const [qaError, setQaError] = useState('')
+  const activeSessionRef = useRef(0)
+
+  const session = sessions.find((s) => s.id === sessionId) || null
+
+  const loadSessions = async (preferred = 0) => {
+    const list = (await GetScopedQASessions()) || []
+    setSessions(list)
+    setSessionId((prev) => {
+      const target = preferred || prev
+      if (target && list.some((s) => s.id === target)) {
+        return target
+      }
+      return list[0]?.id || 0
+    })
+    if (list.length === 0) {
+      setCreating(true)
+    }
+  }
+
+  useEffect(() => {
+    const state = (location.state || {}) as LibraryLocationState
+    GetTags().then((list) => setTags(list || []))
+    GetTelegraphWatchlist().then((list) => setWatchlist(list || []))
+    if (state.articleIds?.length) {
+      setScope(new models.QAScope({ ...emptyScope(), articleIds: state.articleIds }))
+      setCreating(true)
+    }
+    loadSessions(state.sessionId || 0)
+  }, [location.key])
+
+  useEffect(() => {
+    activeSessionRef.current = sessionId
+    setFollowUp(null)
+    if (!sessionId) {
+      setMessages([])
+      return
+    }
+    GetQAMessages(sessionId).then((list) => setMessages(list || []))
+  }, [sessionId])
+
+  useEffect(() => {
+    const isActive = (id: number) => id > 0 && id === activeSessionRef.current
+    const patch = (messageID: number, update: (msg: models.QAMessage) => Partial<models.QAMessage>) => {
+      setMessages((prev) => prev.map((item) => (item.id === messageID ? new models.QAMessage({ ...item, ...update(item) }) : item)))
+    }
+    const upsert = (msg: models.QAMessage) => {
+      setMessages((prev) => (prev.some((item) => item.id === msg.id)
+        ? prev.map((item) => (item.id === msg.id ? new models.QAMessage({ ...item, ...msg }) : item))
+        : [...prev, msg]))
+    }
+
+    const offJobStart = EventsOn('qa-job-start', (...args: unknown[]) => {
+      const payload = (args[0] || {}) as Record<string, unknown>
+      if (isActive(Number(payload.sessionId || 0))) {
+        GetQAMessages(activeSessionRef.current).then((list) => setMessages(list || []))
+      }
+    })
+    // Roles and the moderator share the start/chunk/done payloads.
+    const onMessage = (...args: unknown[]) => {
+      const msg = new models.QAMessage(args[0] || {})
+      if (isActive(msg.sessionId)) upsert(msg)
+    }
+    const onChunk = (...args: unknown[]) => {
+      const payload = (args[0] || {}) as Record<string, unknown>
+      const chunk = typeof payload.chunk === 'string' ? payload.chunk : ''
+      patch(Number(payload.messageId || 0), (msg) => ({ content: `${msg.content || ''}${chunk}`, status: 'running' }))
+    }
+    const offRoleStart = EventsOn('qa-role-start', onMessage)
+    const offRoleChunk = EventsOn('qa-role-chunk', onChunk)
+    const offRoleDone = EventsOn('qa-role-done', onMessage)
+    const offModeratorStart = EventsOn('qa-moderator-start', onMessage)
+    const offModeratorChunk = EventsOn('qa-moderator-chunk', onChunk)
+    const offModeratorDone = EventsOn('qa-moderator-done', onMessage)
+    const offModeratorError = EventsOn('qa-moderator-error', (...args: unknown[]) => {
+      const payload = (args[0] || {}) as Record<string, unknown>
+      const messageID = Number(payload.messageId || 0)
+      const errMsg = typeof payload.error === 'string' ? payload.error : '主持综合失败'
+      if (!messageID) {
+        setQaError(errMsg)
+        return
+      }
+      patch(messageID, () => ({ status: 'failed', errorReason: errMsg }))
+    })
+    const offRoleError = EventsOn('qa-role-error', (...args: unknown[]) => {
+      const payload = (args[0] || {}) as Record<string, unknown>
+      const messageID = Number(payload.messageId || 0)
+      const errMsg = typeof payload.error === 'string' ? payload.error : '回答失败'
+      if (!messageID) {
+        setQaError(errMsg)
+        setAsking(false)
+        return
+      }
+      patch(messageID, () => ({ status: 'failed', errorReason: errMsg }))
+    })
+    const offJobDone = EventsOn('qa-job-done', (...args: unknown[]) => {
+      const payload = (args[0] || {}) as Record<string, unknown>
+      const doneSessionID = Number(payload.sessionId || 0)
+      setAsking(false)
+      if (isActive(doneSessionID)) {
+        GetQAMessages(doneSessionID).then((list) => setMessages(list || []))
+        loadSessions(doneSessionID)
+      }
+    })
+    return () => {
+      offJobStart()
+      offRoleStart()
+      offRoleChunk()
+      offRoleDone()
+      offRoleError()
+      offModeratorStart()
+      offModeratorChunk()
+      offModeratorDone()
+      offModeratorError()
+      offJobDone()
+    }
+  }, [])
+
+  const updateScope = (patch: Partial<models.QAScope>) => {
+    setScope((prev) => new models.QAScope({ ...prev, ...patch }))
+    setPreview(null)
+    setScopeError('')
+  }
+
+  const toggleTag = (id: number) => {
+    const current = scope.tagIds || []
+    updateScope({ tagIds: current.includes(id) ? current.filter((t) => t !== id) : [...current, id] })
+  }
+
+  const handlePreview = async () => {
+    setScopeError('')
+    try {
+      setPreview((await ResolveQAScope(scope)) || [])
+    } catch (e: unknown) {
+      setScopeError(e instanceof Error ? e.message : String(e))
+    }
+  }
+
+  const handleCreate = async () => {
+    setScopeError('')
+    try {
+      const created = await CreateScopedQASession(scope, title)
+      setCreating(false)
+      setScope(emptyScope())
+      setTitle('')
+      setPreview(null)
+      await loadSessions(created.id)
+    } catch (e: unknown) {
+      setScopeError(e instanceof Error ? e.message : String(e))
+    }
+  }
+
+  const handleDelete = async () => {
+    if (!sessionId) return
+    await DeleteQASession(sessionId)
+    await loadSessions()
+  }
+
+  const handleAsk = async () => {
+    const text = question.trim()
+    if (!sessionId || !text || asking) return
+    setQaError('')
+    setAsking(true)
+    try {
+      if (followUp) {
+        await AskQuestionFollowUp(sessionId, 0, text, followUp.id)
+      } else {
+        await AskQuestion(sessionId, 0, text)
+      }
+      setQuestion('')
+      setFollowUp(null)
+    } catch (e: unknown) {
+      setQaError(e instanceof Error ? e.message : '提问失败')
+      setAsking(false)
+    }
+  }
+
+  const handleCancel = async () => {
+    try {
+      await CancelAskQuestion()
+    } catch (e: unknown) {
+      setQaError(e instanceof Error ? e.message : '取消失败')
+    }
+  }
+
+  const sortedMessages = useMemo(() => [...messages].sort((a, b) => a.id - b.id), [messages])
+
+  return (
+    <div className="flex h-full">
+      <aside className="w-64 shrink-0 border-r border-gray-200/80 bg-white flex flex-col">
+        <div className="px-4 py-4 border-b border-gray-100 flex items-center justify-between">
+          <h2 className="text-sm font-semibold text-gray-800">跨文章问答</h2>
+          <button onClick={() => setCreating(true)} className="px-2 py-1 text-xs bg-blue-500 text-white rounded-md hover:bg-blue-600">新建</button>
+        </div>
+        <div className="flex-1 overflow-auto p-2 space-y-1">
+          {sessions.map((s) => (
+            <button
+              key={s.id}
+              onClick={() => { setSessionId(s.id); setCreating(false) }}
+              className={`block w-full text-left px-3 py-2 rounded-lg text-xs ${s.id === sessionId && !creating ? 'bg-blue-50 text-blue-600' : 'text-gray-600 hover:bg-gray-50'}`}
+            >
+              <div className="font-medium truncate">{s.title}</div>
+              <div className="text-[11px] text-gray-400 truncate mt-0.5">{scopeLabel(s.scope, tags)}</div>
+            </button>
+          ))}
+          {sessions.length === 0 && <div className="text-xs text-gray-400 px-3 py-2">暂无会话</div>}
+        </div>
+      </aside>
+
+      <section className="flex-1 min-w-0 flex flex-col p-5">
+        {creating ? (
+          <div className="bg-white rounded-xl border border-gray-200/80 p-5 space-y-4 max-w-3xl">
+            <div>
+              <h3 className="text-sm font-semibold text-gray-800">问答范围</h3>
+              <p className="text-xs text-gray-400 mt-1">条件同时生效；每次提问时重新筛选，按导入时间取最新的文章。</p>
+            </div>
+            {(scope.articleIds || []).length > 0 && (
+              <div className="flex items-center gap-2 text-xs text-gray-600">
+                <span>已选文章 {scope.articleIds.length} 篇</span>
+                <button onClick={() => updateScope({ articleIds: [] })} className="text-blue-500 hover:text-blue-700">清除</button>
+              </div>
+            )}
+            <div className="grid grid-cols-2 gap-3 text-xs">
+              <label className="space-y-1">
+                <span className="text-gray-500">关键词</span>
+                <input value={scope.keyword} onChange={(e) => updateScope({ keyword: e.target.value })} placeholder="如：宁德时代" className="w-full px-2 py-1.5 border border-gray-200 rounded-md focus:outline-none" />
+              </label>
+              <label className="space-y-1">
+                <span className="text-gray-500">最近篇数</span>
+                <input type="number" min={0} max={200} value={scope.limit || ''} onChange={(e) => updateScope({ limit: Number(e.target.value) || 0 })} placeholder="默认 200" className="w-full px-2 py-1.5 border border-gray-200 rounded-md focus:outline-none" />
+              </label>
+              <label className="space-y-1">
+                <span className="text-gray-500">导入日期起</span>
+                <input type="date" value={scope.dateFrom} onChange={(e) => updateScope({ dateFrom: e.target.value })} className="w-full px-2 py-1.5 border border-gray-200 rounded-md" />
+              </label>
+              <label className="space-y-1">
+                <span className="text-gray-500">导入日期止</span>
+                <input type="date" value={scope.dateTo} onChange={(e) => updateScope({ dateTo: e.target.value })} className="w-full px-2 py-1.5 border border-gray-200 rounded-md" />
+              </label>
+              <label className="space-y-1 col-span-2">
+                <span className="text-gray-500">自选股电报（选中后只问命中该股票的电报）</span>
+                <select value={scope.watchStock} onChange={(e) => updateScope({ watchStock: e.target.value })} className="w-full px-2 py-1.5 border border-gray-200 rounded-md bg-white">
+                  <option value="">不限（研报）</option>
+                  {watchlist.map((w) => (
+                    <option key={w.code} value={w.code}>{w.name}（{w.code}）</option>
+                  ))}
+                </select>
+              </label>
+            </div>
+            {tags.length > 0 && (
+              <div className="flex flex-wrap gap-1.5">
+                {tags.map((tag) => {
+                  const on = (scope.tagIds || []).includes(tag.id)
+                  return (
+                    <button
+                      key={tag.id}
+                      onClick={() => toggleTag(tag.id)}
+                      className={`px-2 py-0.5 text-xs rounded-full border ${on ? 'text-white border-transparent' : 'text-gray-600 border-gray-200 bg-white'}`}
+                      style={on ? { backgroundColor: tag.color } : undefined}
+                    >
+                      {tag.name}
+                    </button>
+                  )
+                })}
+              </div>
+            )}
+            <input value={title} onChange={(e) => setTitle(e.target.value)} placeholder="会话标题（可选）" className="w-full text-xs px-2 py-1.5 border border-gray-200 rounded-md focus:outline-none" />
+            {scopeError && <div className="text-xs text-red-600 bg-red-50 border border-red-200 rounded-lg px-3 py-2">{scopeError}</div>}
+            {preview && (
+              <div className="border border-gray-100 rounded-lg max-h-48 overflow-auto divide-y divide-gray-100">
+                <div className="px-3 py-1.5 text-xs text-gray-500 bg-gray-50">共 {preview.length} 篇</div>
+                {preview.map((a) => (
+                  <div key={a.id} className="px-3 py-1.5 text-xs text-gray-700 truncate">{a.title}</div>
+                ))}
+              </div>
+            )}
+            <div className="flex justify-end gap-2">
+              {sessions.length > 0 && (
+                <button onClick={() => setCreating(false)} className="px-3 py-1.5 text-xs bg-white border border-gray-200 rounded-md hover:bg-gray-50">取消</button>
+              )}
+              <button onClick={handlePreview} className="px-3 py-1.5 text-xs bg-white border border-gray-200 rounded-md hover:bg-gray-50">预览文章</button>
+              <button onClick={handleCreate} className="px-3 py-1.5 text-xs bg-blue-500 text-white rounded-md hover:bg-blue-600">创建会话</button>
+            </div>
+          </div>
+        ) : session ? (
+          <>
+            <div className="flex items-center justify-between mb-3">
+              <div className="min-w-0">
+                <div className="text-sm font-semibold text-gray-800 truncate">{session.title}</div>
+                <div className="text-xs text-gray-400 truncate">{scopeLabel(session.scope, tags)}</div>
+              </div>
+              <button onClick={handleDelete} disabled={asking} className="px-2 py-1 text-xs bg-white border border-gray-200 rounded-md hover:bg-gray-50 disabled:opacity-50">删除</button>
+            </div>
+            <div className="flex-1 overflow-auto space-y-3 pr-1">
+              {sortedMessages.map((msg) => {
+                const isUser = msg.roleType === 'user'
+                const isModerator = msg.roleType === 'moderator'
+                return (
+                  <div key={msg.id} className={`max-w-[92%] rounded-lg border px-3 py-2 ${isUser ? 'ml-auto bg-blue-50 border-blue-100' : isModerator ? 'bg-violet-50 border-violet-200' : 'bg-white border-gray-200'}`}>
+                    <div className="flex items-center justify-between gap-2 text-xs mb-1">
+                      <span className="font-medium text-gray-700">{isUser ? '你' : isModerator ? `综合观点 · ${msg.roleName || '主持'}` : (msg.roleName || '助手')}</span>
+                      <span className="text-gray-400">{msg.status === 'running' ? '生成中' : msg.status === 'failed' ? '失败' : ''}</span>
+                    </div>
+                    <div className="text-sm text-gray-700 leading-relaxed prose prose-sm max-w-none">
+                      <ReactMarkdown>{msg.content || (msg.status === 'running' ? '正在生成回答...' : '')}</ReactMarkdown>
+                    </div>
+                    {msg.errorReason && <div className="text-xs text-red-500 mt-1">{msg.errorReason}</div>}
+                    {!isUser && (msg.evidences?.length || 0) > 0 && (
+                      <div className="mt-2 pt-2 border-t border-gray-200">
+                        <div className="text-xs text-gray-500 mb-1">参考片段</div>
+                        <div className="space-y-1">
+                          {(msg.evidences || []).map((ev, idx) => (
+                            <button
+                              key={ev.id}
+                              onClick={() => ev.articleId && navigate(`/article/${ev.articleId}`, { state: { evidence: ev } })}
+                              disabled={!ev.articleId}
+                              title={ev.reason || '打开原文'}
+                              className="block w-full text-left text-xs text-gray-600 leading-relaxed hover:text-gray-800 disabled:cursor-default"
+                            >
+                              [{idx + 1}]{' '}
+                              <span className="text-blue-500">《{ev.articleTitle || '已删除的文章'}》</span>
+                              {ev.headingPath && <span className="text-gray-400"> {ev.headingPath.split(' > ').pop()} </span>}
+                              {ev.quote}
+                            </button>
+                          ))}
+                        </div>
+                      </div>
+                    )}
+                    {!isUser && msg.content.trim() && (
+                      <div className="mt-2 flex justify-end">
+                        <button onClick={() => setFollowUp(msg)} disabled={asking} className="text-xs px-2 py-1 bg-indigo-100 text-indigo-700 rounded-md hover:bg-indigo-200 disabled:opacity-50">继续追问</button>
+                      </div>
+                    )}
+                  </div>
+                )
+              })}
+              {sortedMessages.length === 0 && (
+                <div className="flex items-center justify-center h-full text-sm text-gray-300">在范围内的所有文章中检索并回答，可用 @角色名 指定答复角色</div>
+              )}
+            </div>
+            {qaError && <div className="mt-3 text-xs text-red-600 bg-red-50 border border-red-200 rounded-lg px-3 py-2">{qaError}</div>}
+            <div className="mt-3 border border-gray-200 rounded-lg p-3 bg-white">
+              {followUp && (
+                <div className="mb-2 flex items-center justify-between gap-2 text-[11px] text-indigo-700 bg-indigo-50 border border-indigo-200 rounded-md px-2 py-1">
+                  <span className="truncate">继续追问：{followUp.roleName || '助手'}（#{followUp.id}）</span>
+                  <button onClick={() => setFollowUp(null)} className="shrink-0">取消</button>
+                </div>
+              )}
+              <textarea
+                value={question}
+                onChange={(e) => setQuestion(e.target.value)}
+                onKeyDown={(e) => {
+                  if (e.key === 'Enter' && (e.metaKey || e.ctrlKey)) {
+                    e.preventDefault()
+                    void handleAsk()
+                  }
+                }}
+                rows={3}
+                placeholder="如：这些报告对海外产能怎么看？（Ctrl/⌘ + Enter 发送）"
+                className="w-full text-sm resize-none focus:outline-none"
+              />
+              <div className="flex justify-end gap-2">
+                {asking && <button onClick={handleCancel} className="px-3 py-1.5 text-xs bg-white border border-gray-200 rounded-md hover:bg-gray-50">停止</button>}
+                <button onClick={handleAsk} disabled={asking || !question.trim()} className="px-3 py-1.5 text-xs bg-blue-500 text-white rounded-md hover:bg-blue-600 disabled:opacity-50">
+                  {asking ? '回答中...' : '提问'}
+                </button>
+              </div>
+            </div>
+          </>
+        ) : (
+          <div className="flex items-center justify-center h-full text-sm text-gray-300">新建一个会话开始跨文章问答</div>
+        )}
+      </section>
+    </div>
+  )
+}
+
+// scopeLabel summarizes a scope, e.g. "标签 电池 · 最近 10 篇".
+function scopeLabel(scope: models.QAScope | undefined, tags: models.Tag[]): string {
+  if (!scope) return ''
+  const parts: string[] = []
+  if (scope.articleIds?.length) parts.push(`${scope.articleIds.length} 篇指定文章`)
+  if (scope.watchStock) parts.push(`自选股 ${scope.watchStock} 电报`)
+  if (scope.keyword) parts.push(`关键词 ${scope.keyword}`)
+  if (scope.tagIds?.length) {
+    parts.push(`标签 ${scope.tagIds.map((id) => tags.find((t) => t.id === id)?.name || id).join('/')}`)
+  }
+  if (scope.dateFrom || scope.dateTo) parts.push(`${scope.dateFrom || '…'} 至 ${scope.dateTo || '…'}`)
+  if (scope.limit) parts.push(`最近 ${scope.limit} 篇`)
+  return parts.join(' · ')
+}
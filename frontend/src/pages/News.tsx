@@ -29,14 +29,35 @@ export default function News() {
   const [filterTag, setFilterTag] = useState(0)
   const [order, setOrder] = useState<SortOrder>('score_desc')
   const [watchOnly, setWatchOnly] = useState(false)
+  const [total, setTotal] = useState(0)
+  const [nextCursor, setNextCursor] = useState('')
   const [loading, setLoading] = useState(false)
   const navigate = useNavigate()
 
-  const loadNews = async (kw: string = debouncedKeyword, tagID: number = filterTag, sortOrder: SortOrder = order, onlyWatch: boolean = watchOnly) => {
+  const newsQuery = (cursor = '') => ({
+    keyword: debouncedKeyword,
+    tagIds: filterTag > 0 ? [filterTag] : [],
+    tagMode: 'any',
+    statuses: [],
+    sources: [],
+    createdFrom: '',
+    createdTo: '',
+    analyzedFrom: '',
+    analyzedTo: '',
+    sort: order === 'latest' ? 'created_desc' : order,
+    watchOnly,
+    cursor,
+    limit: 50,
+  })
+
+  const loadNews = async (cursor = '') => {
     setLoading(true)
     try {
-      const list = await GetTelegraphArticles(kw, tagID, sortOrder, onlyWatch ? 1 : 0)
-      setItems(list || [])
+      const page = await GetTelegraphArticles(newsQuery(cursor))
+      const list = page?.items || []
+      setItems((prev) => (cursor ? [...prev, ...list] : list))
+      setTotal(page?.total || 0)
+      setNextCursor(page?.nextCursor || '')
     } finally {
       setLoading(false)
     }
@@ -229,6 +250,14 @@ export default function News() {
             </div>
           </div>
         ))}
+        {nextCursor && !loading && (
+          <button
+            onClick={() => void loadNews(nextCursor)}
+            className="w-full py-2.5 text-xs text-gray-500 bg-white border border-gray-200 rounded-xl hover:bg-gray-50"
+          >
+            加载更多（已显示 {items.length} / {total}）
+          </button>
+        )}
         {items.length === 0 && !loading && (
           <div className="text-center py-12 text-sm text-gray-400">暂无新闻电报</div>
         )}
@@ -1,47 +1,74 @@
 import { useEffect, useMemo, useState } from 'react'
 import {
   CheckAppUpdate,
+  ChooseWatchFolder,
   CreateRoleFromTemplate,
   DeleteChannel,
+  ClearAIResponseCache,
+  ClearMinerUCache,
   DownloadAndInstallAppUpdate,
+  FindDuplicateArticles,
   DeletePrompt,
   DeleteRole,
   DeleteTag,
+  GetAIBudgetConfig,
+  GetAIBudgetStatus,
+  GetAIFailoverConfig,
+  GetAIResponseCacheConfig,
+  GetAIResponseCacheStats,
   GetAnalysisDashboard,
   GetAnalysisDashboardByDays,
   GetAppUpdateConfig,
   GetAppVersion,
   GetChannels,
+  GetEmbeddingBackfillStatus,
+  GetEmbeddingConfig,
+  GetFolderWatchConfig,
+  GetFolderWatchStatus,
   GetMinerUConfig,
   GetPromptVersions,
   GetPrompts,
+  GetQAModeratorConfig,
   GetRoleTemplates,
   GetRoles,
   GetTags,
   GetTelegraphSchedulerConfig,
   GetTelegraphSchedulerStatus,
   GetTelegraphWatchlist,
+  GetWatchedFiles,
+  MergeDuplicateArticles,
   OpenURL,
   RestorePromptVersion,
+  RunFolderWatchNow,
   RunTelegraphSchedulerNow,
   SaveChannel,
+  SaveAIBudgetConfig,
+  SaveAIFailoverConfig,
+  SaveAIResponseCacheConfig,
   SaveAppUpdateConfig,
+  SaveEmbeddingConfig,
+  SaveFolderWatchConfig,
   SaveMinerUConfig,
   SavePrompt,
+  SaveQAModeratorConfig,
   SaveRole,
   SaveTag,
   SaveTelegraphSchedulerConfig,
   SaveTelegraphWatchlist,
+  StopFolderWatchRun,
   StopTelegraphScheduler,
   SetDefaultRole,
+  StartEmbeddingBackfill,
+  StopEmbeddingBackfill,
 } from '../../wailsjs/go/main/App'
 import { models } from '../../wailsjs/go/models'
+import { EventsOn } from '../../wailsjs/runtime/runtime'
 
 const inputCls = 'w-full px-3 py-2.5 bg-white border border-gray-200 rounded-lg text-sm focus:outline-none focus:ring-2 focus:ring-blue-500/20 focus:border-blue-400 transition-shadow'
 
 const TAG_COLORS = ['#3b82f6', '#ef4444', '#f59e0b', '#10b981', '#8b5cf6', '#ec4899', '#6366f1', '#14b8a6']
 
-type TabKey = 'channels' | 'prompts' | 'roles' | 'mineru' | 'telegraph' | 'updater' | 'watchlist' | 'tags' | 'dashboard'
+type TabKey = 'channels' | 'prompts' | 'roles' | 'mineru' | 'telegraph' | 'updater' | 'watchlist' | 'tags' | 'folders' | 'library' | 'dashboard'
 type DashboardRange = 0 | 7 | 30
 
 type AppUpdateConfigData = {
@@ -54,6 +81,14 @@ type WatchStockFormData = {
   aliasesText: string
 }
 
+type GenerationOptionsData = {
+  temperature?: number
+  topP?: number
+  maxTokens?: number
+  stop?: string[]
+  seed?: number
+}
+
 type TelegraphConfigData = {
   enabled: number
   sourceUrl: string
@@ -61,6 +96,7 @@ type TelegraphConfigData = {
   fetchLimit: number
   channelId: number
   analysisPrompt: string
+  generationOptions: GenerationOptionsData
 }
 
 type TelegraphStatusData = {
@@ -78,13 +114,34 @@ type ChannelFormData = {
   baseUrl: string
   apiKey: string
   model: string
+  provider: string
+  maxRetries: number
+  retryBackoffMs: number
+  rpmLimit: number
+  tpmLimit: number
+  maxInFlight: number
+  contextWindow: number
+  storeReasoning: number
+  inputPrice: number
+  outputPrice: number
+  currency: string
+  embeddingModel: string
   isDefault: number
 }
 
+const CHANNEL_PROVIDERS = [
+  { value: 'openai', label: 'OpenAI 兼容', baseUrl: 'https://api.deepseek.com/v1' },
+  { value: 'anthropic', label: 'Anthropic Messages', baseUrl: 'https://api.anthropic.com/v1' },
+  { value: 'gemini', label: 'Google Gemini', baseUrl: 'https://generativelanguage.googleapis.com/v1beta' },
+  { value: 'ollama', label: 'Ollama', baseUrl: 'http://localhost:11434' },
+]
+
 type PromptFormData = {
   id: number
   name: string
   content: string
+  generationOptions: GenerationOptionsData
+  outputSchema: string
   isDefault: number
 }
 
@@ -101,12 +158,17 @@ type RoleFormData = {
   domainTags: string
   systemPrompt: string
   modelOverride: string
-  temperature: number
-  maxTokens: number
+  generationOptions: GenerationOptionsData
   enabled: number
   isDefault: number
 }
 
+const PARSER_OPTIONS = [
+  { value: 'mineru_cloud', label: 'MinerU 云端', hint: 'mineru.net API，需要 API Token，消耗额度' },
+  { value: 'mineru_self_hosted', label: '自部署 MinerU', hint: '本机或内网的 mineru-api / magic-pdf 服务' },
+  { value: 'builtin', label: '内置解析', hint: '离线提取 PDF 文本层与 DOCX，不含图片' },
+]
+
 const DEFAULT_TELEGRAPH_CONFIG: TelegraphConfigData = {
   enabled: 0,
   sourceUrl: 'https://m.cls.cn/telegraph',
@@ -114,6 +176,7 @@ const DEFAULT_TELEGRAPH_CONFIG: TelegraphConfigData = {
   fetchLimit: 8,
   channelId: 0,
   analysisPrompt: '你是资深A股盘中快讯分析师。请基于这条财联社电报，输出：1) 事件一句话总结 2) 市场影响方向与理由 3) 受影响板块 4) 后续跟踪信号。禁止编造。',
+  generationOptions: {},
 }
 
 const DEFAULT_TELEGRAPH_STATUS: TelegraphStatusData = {
@@ -131,6 +194,18 @@ const toChannelFormData = (item: models.AIChannel): ChannelFormData => ({
   baseUrl: item.baseUrl,
   apiKey: item.apiKey,
   model: item.model,
+  provider: item.provider || 'openai',
+  maxRetries: item.maxRetries ?? 2,
+  retryBackoffMs: item.retryBackoffMs || 1000,
+  rpmLimit: item.rpmLimit || 0,
+  tpmLimit: item.tpmLimit || 0,
+  maxInFlight: item.maxInFlight || 0,
+  contextWindow: item.contextWindow || 0,
+  storeReasoning: item.storeReasoning || 0,
+  inputPrice: item.inputPrice || 0,
+  outputPrice: item.outputPrice || 0,
+  currency: item.currency || 'CNY',
+  embeddingModel: item.embeddingModel || '',
   isDefault: item.isDefault,
 })
 
@@ -138,6 +213,8 @@ const toPromptFormData = (item: models.Prompt): PromptFormData => ({
   id: item.id,
   name: item.name,
   content: item.content,
+  generationOptions: item.generationOptions || {},
+  outputSchema: item.outputSchema || '',
   isDefault: item.isDefault,
 })
 
@@ -154,14 +231,20 @@ const toRoleFormData = (item: models.Role): RoleFormData => ({
   domainTags: item.domainTags,
   systemPrompt: item.systemPrompt,
   modelOverride: item.modelOverride,
-  temperature: item.temperature,
-  maxTokens: item.maxTokens,
+  generationOptions: item.generationOptions || {},
   enabled: item.enabled,
   isDefault: item.isDefault,
 })
 
 export default function Settings() {
   const [channels, setChannels] = useState<models.AIChannel[]>([])
+  const [failoverIDs, setFailoverIDs] = useState<number[]>([])
+  const [cacheCfg, setCacheCfg] = useState<models.AIResponseCacheConfig>(new models.AIResponseCacheConfig({ single: false, batch: false, qa: false, telegraph: false, maxAgeDays: 0 }))
+  const [cacheStats, setCacheStats] = useState<models.AIResponseCacheStats | null>(null)
+  const [cacheTip, setCacheTip] = useState('')
+  const [budgetCfg, setBudgetCfg] = useState<models.AIBudgetConfig>(new models.AIBudgetConfig({ dailyLimit: 0, monthlyLimit: 0, currency: 'CNY' }))
+  const [budgetStatus, setBudgetStatus] = useState<models.AIBudgetStatus | null>(null)
+  const [budgetTip, setBudgetTip] = useState('')
   const [prompts, setPrompts] = useState<models.Prompt[]>([])
   const [promptVersions, setPromptVersions] = useState<models.PromptVersion[]>([])
   const [roles, setRoles] = useState<models.Role[]>([])
@@ -171,6 +254,7 @@ export default function Settings() {
   const [tab, setTab] = useState<TabKey>('channels')
   const [editCh, setEditCh] = useState<ChannelFormData | null>(null)
   const [editPr, setEditPr] = useState<PromptFormData | null>(null)
+  const [promptTip, setPromptTip] = useState('')
   const [versionPrompt, setVersionPrompt] = useState<models.Prompt | null>(null)
   const [diffVersionID, setDiffVersionID] = useState(0)
   const [restoringPromptVersionID, setRestoringPromptVersionID] = useState(0)
@@ -186,6 +270,10 @@ export default function Settings() {
     isOCR: 1,
     pollIntervalMs: 2000,
     timeoutSec: 300,
+    parsers: ['mineru_cloud', 'builtin'],
+    selfHostedUrl: '',
+    selfHostedApi: 'mineru',
+    selfHostedBackend: 'pipeline',
   }))
   const [mineruSaving, setMineruSaving] = useState(false)
   const [mineruSavedTip, setMineruSavedTip] = useState('')
@@ -206,6 +294,15 @@ export default function Settings() {
   const [watchTip, setWatchTip] = useState('')
 
   const loadChannels = () => GetChannels().then((list) => setChannels(list || []))
+  const loadFailover = () => GetAIFailoverConfig().then((cfg) => setFailoverIDs(cfg?.channelIds || []))
+  const loadResponseCache = () => Promise.all([GetAIResponseCacheConfig(), GetAIResponseCacheStats()]).then(([cfg, stats]) => {
+    setCacheCfg(new models.AIResponseCacheConfig(cfg))
+    setCacheStats(stats || null)
+  })
+  const loadBudget = () => Promise.all([GetAIBudgetConfig(), GetAIBudgetStatus()]).then(([cfg, status]) => {
+    setBudgetCfg(new models.AIBudgetConfig(cfg))
+    setBudgetStatus(status || null)
+  })
   const loadPrompts = () => GetPrompts().then((list) => setPrompts(list || []))
   const loadPromptVersions = (promptID: number) => GetPromptVersions(promptID).then((list) => setPromptVersions(list || []))
   const loadRoles = () => GetRoles().then((list) => setRoles(list || []))
@@ -220,6 +317,7 @@ export default function Settings() {
       fetchLimit: Number(cfg?.fetchLimit || DEFAULT_TELEGRAPH_CONFIG.fetchLimit),
       channelId: Number(cfg?.channelId || 0),
       analysisPrompt: cfg?.analysisPrompt || DEFAULT_TELEGRAPH_CONFIG.analysisPrompt,
+      generationOptions: cfg?.generationOptions || {},
     })
   })
   const loadTelegraphStatus = () => GetTelegraphSchedulerStatus().then((status) => {
@@ -254,6 +352,9 @@ export default function Settings() {
 
   useEffect(() => {
     loadChannels()
+    loadFailover()
+    loadResponseCache()
+    loadBudget()
     loadPrompts()
     loadRoles()
     loadRoleTemplates()
@@ -285,7 +386,7 @@ export default function Settings() {
   }, [tab])
 
   const saveCh = async () => {
-    if (!editCh?.name || !editCh.baseUrl || !editCh.apiKey || !editCh.model) {
+    if (!editCh?.name || !editCh.model || (editCh.provider !== 'ollama' && !editCh.apiKey)) {
       return
     }
     await SaveChannel(new models.AIChannel(editCh))
@@ -293,11 +394,63 @@ export default function Settings() {
     await loadChannels()
   }
 
+  const saveFailover = async (ids: number[]) => {
+    setFailoverIDs(ids)
+    await SaveAIFailoverConfig(new models.AIFailoverConfig({ channelIds: ids }))
+  }
+
+  const saveResponseCache = async (next: models.AIResponseCacheConfig) => {
+    setCacheCfg(next)
+    setCacheTip('')
+    try {
+      await SaveAIResponseCacheConfig(next)
+    } catch (err) {
+      setCacheTip(`保存失败: ${toErrorMessage(err)}`)
+    }
+  }
+
+  const clearResponseCache = async () => {
+    try {
+      const removed = await ClearAIResponseCache()
+      setCacheTip(`已清空 ${removed} 条缓存`)
+      await loadResponseCache()
+    } catch (err) {
+      setCacheTip(`清空失败: ${toErrorMessage(err)}`)
+    }
+  }
+
+  const saveBudget = async () => {
+    setBudgetTip('')
+    try {
+      await SaveAIBudgetConfig(budgetCfg)
+      await loadBudget()
+      setBudgetTip('已保存')
+    } catch (err) {
+      setBudgetTip(`保存失败: ${toErrorMessage(err)}`)
+    }
+  }
+
+  const moveFailover = (index: number, delta: number) => {
+    const next = [...failoverIDs]
+    const target = index + delta
+    if (target < 0 || target >= next.length) {
+      return
+    }
+    ;[next[index], next[target]] = [next[target], next[index]]
+    void saveFailover(next)
+  }
+
   const savePr = async () => {
     if (!editPr?.name || !editPr.content) {
       return
     }
-    await SavePrompt(new models.Prompt(editPr))
+    setPromptTip('')
+    try {
+      await SavePrompt(new models.Prompt(editPr))
+    } catch (err) {
+      setPromptTip(`保存失败: ${toErrorMessage(err)}`)
+      return
+    }
     setEditPr(null)
     await loadPrompts()
     if (versionPrompt && versionPrompt.id === editPr.id && editPr.id > 0) {
@@ -339,14 +492,7 @@ export default function Settings() {
     if (!editRole?.name || !editRole.systemPrompt) {
       return
     }
-    const payload = new models.Role(editRole)
-    if (payload.maxTokens <= 0) {
-      payload.maxTokens = 1200
-    }
-    if (payload.temperature <= 0) {
-      payload.temperature = 0.2
-    }
-    await SaveRole(payload)
+    await SaveRole(new models.Role(editRole))
     setEditRole(null)
     await loadRoles()
   }
@@ -375,6 +521,32 @@ export default function Settings() {
     }
   }
 
+  const moveParser = (name: string, delta: number) => {
+    const list = [...(mineruCfg.parsers || [])]
+    const idx = list.indexOf(name)
+    const target = idx + delta
+    if (idx < 0 || target < 0 || target >= list.length) {
+      return
+    }
+    list.splice(target, 0, ...list.splice(idx, 1))
+    setMineruCfg({ ...mineruCfg, parsers: list })
+  }
+
+  const toggleParser = (name: string, on: boolean) => {
+    const list = (mineruCfg.parsers || []).filter((p) => p !== name)
+    setMineruCfg({ ...mineruCfg, parsers: on ? [...list, name] : list })
+  }
+
+  const clearMinerUCache = async () => {
+    setMineruSavedTip('')
+    try {
+      const removed = await ClearMinerUCache()
+      setMineruSavedTip(`已清理 ${removed} 个未使用的解析结果`)
+    } catch (err) {
+      setMineruSavedTip(`清理失败: ${toErrorMessage(err)}`)
+    }
+  }
+
   const saveTelegraphScheduler = async () => {
     setTelegraphSaving(true)
     setTelegraphTip('')
@@ -527,13 +699,15 @@ export default function Settings() {
         <TabButton tab={tab} value="updater" onClick={setTab} label="应用更新" />
         <TabButton tab={tab} value="watchlist" onClick={setTab} label="自选股池" />
         <TabButton tab={tab} value="tags" onClick={setTab} label="标签管理" />
+        <TabButton tab={tab} value="folders" onClick={setTab} label="文件夹监听" />
+        <TabButton tab={tab} value="library" onClick={setTab} label="文库维护" />
         <TabButton tab={tab} value="dashboard" onClick={setTab} label="运行看板" />
       </div>
 
       {tab === 'channels' && (
         <div>
           <button
-            onClick={() => setEditCh({ id: 0, name: '', baseUrl: '', apiKey: '', model: '', isDefault: 0 })}
+            onClick={() => setEditCh({ id: 0, name: '', baseUrl: '', apiKey: '', model: '', provider: 'openai', maxRetries: 2, retryBackoffMs: 1000, rpmLimit: 0, tpmLimit: 0, maxInFlight: 0, contextWindow: 0, storeReasoning: 0, inputPrice: 0, outputPrice: 0, currency: 'CNY', embeddingModel: '', isDefault: 0 })}
             className="inline-flex items-center gap-1.5 px-4 py-2 bg-blue-500 text-white text-sm rounded-lg mb-4 hover:bg-blue-600 shadow-sm transition-colors"
           >
             <svg className="w-4 h-4" fill="none" stroke="currentColor" viewBox="0 0 24 24"><path strokeLinecap="round" strokeLinejoin="round" strokeWidth={2} d="M12 4v16m8-8H4" /></svg>
@@ -547,6 +721,7 @@ export default function Settings() {
                   <div className="flex items-center gap-2">
                     <span className="text-sm font-medium text-gray-800">{c.name}</span>
                     <span className="text-xs text-gray-400 bg-gray-100 px-2 py-0.5 rounded-md">{c.model}</span>
+                    <span className="text-xs text-gray-400">{CHANNEL_PROVIDERS.find((p) => p.value === (c.provider || 'openai'))?.label}</span>
                     {c.isDefault === 1 && <span className="text-xs bg-blue-50 text-blue-600 px-2 py-0.5 rounded-full ring-1 ring-blue-200 font-medium">默认</span>}
                   </div>
                   <div className="text-xs text-gray-400 mt-1.5 truncate">{c.baseUrl}</div>
@@ -561,19 +736,126 @@ export default function Settings() {
               <div className="text-center py-12 text-sm text-gray-400">暂无 AI 渠道，点击上方按钮添加</div>
             )}
           </div>
+          {channels.length > 1 && (
+            <div className="mt-6 p-4 bg-white rounded-xl border border-gray-200/80">
+              <div className="text-sm font-semibold text-gray-800">故障转移顺序</div>
+              <div className="text-xs text-gray-400 mt-1 mb-3">当前渠道重试仍失败时，按以下顺序依次改用其他渠道。</div>
+              <div className="space-y-1.5">
+                {failoverIDs.map((id, idx) => {
+                  const channel = channels.find((c) => c.id === id)
+                  if (!channel) {
+                    return null
+                  }
+                  return (
+                    <div key={id} className="flex items-center justify-between px-3 py-2 bg-gray-50 rounded-lg text-sm">
+                      <span className="text-gray-700">{idx + 1}. {channel.name} / {channel.model}</span>
+                      <div className="flex gap-2 text-xs">
+                        <button onClick={() => moveFailover(idx, -1)} disabled={idx === 0} className="text-gray-500 hover:text-gray-700 disabled:opacity-30">上移</button>
+                        <button onClick={() => moveFailover(idx, 1)} disabled={idx === failoverIDs.length - 1} className="text-gray-500 hover:text-gray-700 disabled:opacity-30">下移</button>
+                        <button onClick={() => void saveFailover(failoverIDs.filter((item) => item !== id))} className="text-red-400 hover:text-red-600">移除</button>
+                      </div>
+                    </div>
+                  )
+                })}
+              </div>
+              <select
+                value={0}
+                onChange={(e) => {
+                  const id = Number(e.target.value)
+                  if (id > 0) {
+                    void saveFailover([...failoverIDs, id])
+                  }
+                }}
+                className={`${inputCls} mt-3`}
+              >
+                <option value={0}>添加备用渠道...</option>
+                {channels.filter((c) => !failoverIDs.includes(c.id)).map((c) => (
+                  <option key={c.id} value={c.id}>{c.name} / {c.model}</option>
+                ))}
+              </select>
+            </div>
+          )}
+          <div className="mt-6 p-4 bg-white rounded-xl border border-gray-200/80">
+            <div className="flex items-center justify-between">
+              <div className="text-sm font-semibold text-gray-800">响应缓存</div>
+              <button onClick={() => void clearResponseCache()} className="text-xs text-red-400 hover:text-red-600">清空缓存</button>
+            </div>
+            <div className="text-xs text-gray-400 mt-1 mb-3">
+              模型、提示词、模式、生成参数与正文完全相同时直接复用已保存的回答，不再消耗 Token。当前 {cacheStats?.entries ?? 0} 条，累计命中 {cacheStats?.totalHits ?? 0} 次。
+            </div>
+            <div className="flex flex-wrap items-center gap-4">
+              {([
+                ['single', '单篇解读'],
+                ['batch', '批量解读'],
+                ['qa', '问答'],
+                ['telegraph', '电报定时解读'],
+              ] as const).map(([key, label]) => (
+                <label key={key} className="flex items-center gap-2 text-sm text-gray-600 cursor-pointer">
+                  <input
+                    type="checkbox"
+                    checked={cacheCfg[key]}
+                    onChange={(e) => void saveResponseCache(new models.AIResponseCacheConfig({ ...cacheCfg, [key]: e.target.checked }))}
+                    className="w-4 h-4 rounded border-gray-300 text-blue-500 focus:ring-blue-500/20"
+                  />
+                  {label}
+                </label>
+              ))}
+              <label className="flex items-center gap-2 text-sm text-gray-600">
+                有效期（天，0 不过期）
+                <input
+                  type="number"
+                  min={0}
+                  value={cacheCfg.maxAgeDays}
+                  onChange={(e) => setCacheCfg(new models.AIResponseCacheConfig({ ...cacheCfg, maxAgeDays: Number(e.target.value) }))}
+                  onBlur={() => void saveResponseCache(cacheCfg)}
+                  className={`${inputCls} w-24`}
+                />
+              </label>
+            </div>
+            {cacheTip && <div className="text-xs text-gray-500 mt-2">{cacheTip}</div>}
+          </div>
+          <div className="mt-6 p-4 bg-white rounded-xl border border-gray-200/80">
+            <div className="text-sm font-semibold text-gray-800">花费预算</div>
+            <div className="text-xs text-gray-400 mt-1 mb-3">
+              按渠道价格统计解读与问答花费，达到日/月预算后自动暂停批量解读与电报定时解读。0 表示不限；只统计与预算币种相同的渠道。
+            </div>
+            <div className="grid grid-cols-4 gap-3 items-end">
+              <div>
+                <label className="block text-xs font-medium text-gray-500 mb-1.5">日预算</label>
+                <input type="number" min={0} step={1} value={budgetCfg.dailyLimit} onChange={(e) => setBudgetCfg(new models.AIBudgetConfig({ ...budgetCfg, dailyLimit: Number(e.target.value) }))} className={inputCls} />
+              </div>
+              <div>
+                <label className="block text-xs font-medium text-gray-500 mb-1.5">月预算</label>
+                <input type="number" min={0} step={10} value={budgetCfg.monthlyLimit} onChange={(e) => setBudgetCfg(new models.AIBudgetConfig({ ...budgetCfg, monthlyLimit: Number(e.target.value) }))} className={inputCls} />
+              </div>
+              <div>
+                <label className="block text-xs font-medium text-gray-500 mb-1.5">币种</label>
+                <input value={budgetCfg.currency} onChange={(e) => setBudgetCfg(new models.AIBudgetConfig({ ...budgetCfg, currency: e.target.value }))} className={inputCls} />
+              </div>
+              <button onClick={() => void saveBudget()} className="px-4 py-2.5 bg-blue-500 text-white text-sm rounded-lg hover:bg-blue-600 shadow-sm transition-colors">保存</button>
+            </div>
+            {budgetStatus && (
+              <div className={`text-xs mt-3 ${budgetStatus.exceeded ? 'text-red-500' : 'text-gray-500'}`}>
+                今日 {budgetStatus.dailySpent.toFixed(2)} / 本月 {budgetStatus.monthlySpent.toFixed(2)} {budgetStatus.currency}
+                {budgetStatus.exceeded && `（${budgetStatus.reason}）`}
+              </div>
+            )}
+            {budgetTip && <div className="text-xs text-gray-500 mt-2">{budgetTip}</div>}
+          </div>
+          <SemanticRetrievalPanel channels={channels} />
         </div>
       )}
 
       {tab === 'prompts' && (
         <div>
           <button
-            onClick={() => setEditPr({ id: 0, name: '', content: '', isDefault: 0 })}
+            onClick={() => setEditPr({ id: 0, name: '', content: '', generationOptions: {}, outputSchema: '', isDefault: 0 })}
             className="inline-flex items-center gap-1.5 px-4 py-2 bg-blue-500 text-white text-sm rounded-lg mb-4 hover:bg-blue-600 shadow-sm transition-colors"
           >
             <svg className="w-4 h-4" fill="none" stroke="currentColor" viewBox="0 0 24 24"><path strokeLinecap="round" strokeLinejoin="round" strokeWidth={2} d="M12 4v16m8-8H4" /></svg>
             添加提示词
           </button>
-          {editPr && <PromptForm pr={editPr} onChange={setEditPr} onSave={savePr} onCancel={() => setEditPr(null)} />}
+          {editPr && <PromptForm pr={editPr} tip={promptTip} onChange={setEditPr} onSave={savePr} onCancel={() => { setEditPr(null); setPromptTip('') }} />}
           <div className="space-y-2">
             {prompts.map((p) => (
               <div key={p.id} className="group flex items-center justify-between p-4 bg-white rounded-xl border border-gray-200/80 hover:border-gray-300 transition-colors">
@@ -716,7 +998,7 @@ export default function Settings() {
           )}
 
           <button
-            onClick={() => setEditRole({ id: 0, name: '', alias: '', domainTags: '', systemPrompt: '', modelOverride: '', temperature: 0.2, maxTokens: 1200, enabled: 1, isDefault: 0 })}
+            onClick={() => setEditRole({ id: 0, name: '', alias: '', domainTags: '', systemPrompt: '', modelOverride: '', generationOptions: { temperature: 0.2, maxTokens: 1200 }, enabled: 1, isDefault: 0 })}
             className="inline-flex items-center gap-1.5 px-4 py-2 bg-blue-500 text-white text-sm rounded-lg mb-4 hover:bg-blue-600 shadow-sm transition-colors"
           >
             <svg className="w-4 h-4" fill="none" stroke="currentColor" viewBox="0 0 24 24"><path strokeLinecap="round" strokeLinejoin="round" strokeWidth={2} d="M12 4v16m8-8H4" /></svg>
@@ -761,13 +1043,45 @@ export default function Settings() {
               <div className="text-center py-12 text-sm text-gray-400">暂无角色，点击上方按钮添加</div>
             )}
           </div>
+          <QAModeratorPanel roles={roles} />
         </div>
       )}
 
       {tab === 'mineru' && (
         <div className="bg-white rounded-xl border border-gray-200 p-5 space-y-4">
-          <div className="flex items-center justify-between">
-            <h3 className="text-base font-semibold text-gray-800">MinerU 文档解析</h3>
+          <div>
+            <h3 className="text-base font-semibold text-gray-800 mb-1">解析顺序</h3>
+            <p className="text-xs text-gray-500 mb-3">导入 PDF/图片/Office 文档时按顺序尝试，未配置或失败的解析器交给下一个。把内置解析放在最后，断网时 PDF 与 DOCX 仍可导入。</p>
+            <div className="space-y-2">
+              {PARSER_OPTIONS.map((opt) => {
+                const order = (mineruCfg.parsers || []).indexOf(opt.value)
+                return (
+                  <div key={opt.value} className="flex items-center gap-3 px-3 py-2 border border-gray-100 rounded-lg">
+                    <input
+                      type="checkbox"
+                      checked={order >= 0}
+                      onChange={(e) => toggleParser(opt.value, e.target.checked)}
+                      className="w-4 h-4 rounded border-gray-300 text-blue-500 focus:ring-blue-500/20"
+                    />
+                    <span className="w-5 text-xs text-gray-400">{order >= 0 ? order + 1 : '-'}</span>
+                    <div className="flex-1">
+                      <div className="text-sm text-gray-700">{opt.label}</div>
+                      <div className="text-xs text-gray-400">{opt.hint}</div>
+                    </div>
+                    {order >= 0 && (
+                      <div className="flex gap-1">
+                        <button onClick={() => moveParser(opt.value, -1)} disabled={order === 0} className="px-2 py-0.5 text-xs text-gray-500 border border-gray-200 rounded hover:bg-gray-50 disabled:opacity-40">上移</button>
+                        <button onClick={() => moveParser(opt.value, 1)} disabled={order === (mineruCfg.parsers || []).length - 1} className="px-2 py-0.5 text-xs text-gray-500 border border-gray-200 rounded hover:bg-gray-50 disabled:opacity-40">下移</button>
+                      </div>
+                    )}
+                  </div>
+                )
+              })}
+            </div>
+          </div>
+
+          <div className="flex items-center justify-between pt-2 border-t border-gray-100">
+            <h3 className="text-base font-semibold text-gray-800">MinerU 云端 API</h3>
             <label className="flex items-center gap-2 text-sm text-gray-600 cursor-pointer">
               <input
                 type="checkbox"
@@ -847,6 +1161,42 @@ export default function Settings() {
             </div>
           </div>
 
+          <div className="pt-2 border-t border-gray-100 space-y-3">
+            <h3 className="text-base font-semibold text-gray-800">自部署 MinerU</h3>
+            <div className="grid grid-cols-3 gap-3">
+              <div>
+                <label className="block text-xs font-medium text-gray-500 mb-1.5">服务地址</label>
+                <input
+                  value={mineruCfg.selfHostedUrl}
+                  onChange={(e) => setMineruCfg({ ...mineruCfg, selfHostedUrl: e.target.value })}
+                  placeholder="http://127.0.0.1:8000"
+                  className={inputCls}
+                />
+              </div>
+              <div>
+                <label className="block text-xs font-medium text-gray-500 mb-1.5">接口类型</label>
+                <select
+                  value={mineruCfg.selfHostedApi}
+                  onChange={(e) => setMineruCfg({ ...mineruCfg, selfHostedApi: e.target.value })}
+                  className={inputCls}
+                >
+                  <option value="mineru">mineru-api（MinerU 2.x）</option>
+                  <option value="magic-pdf">magic-pdf web_api（MinerU 1.x）</option>
+                </select>
+              </div>
+              <div>
+                <label className="block text-xs font-medium text-gray-500 mb-1.5">Backend</label>
+                <input
+                  value={mineruCfg.selfHostedBackend}
+                  onChange={(e) => setMineruCfg({ ...mineruCfg, selfHostedBackend: e.target.value })}
+                  placeholder="pipeline"
+                  disabled={mineruCfg.selfHostedApi === 'magic-pdf'}
+                  className={inputCls}
+                />
+              </div>
+            </div>
+          </div>
+
           <div className="flex items-center gap-2">
             <button
               onClick={saveMinerU}
@@ -855,11 +1205,18 @@ export default function Settings() {
             >
               {mineruSaving ? '保存中...' : '保存配置'}
             </button>
+            <button
+              onClick={clearMinerUCache}
+              className="px-4 py-2 bg-white border border-gray-200 text-gray-600 text-sm rounded-lg hover:bg-gray-50 shadow-sm transition-colors"
+            >
+              清理未使用的解析缓存
+            </button>
             {mineruSavedTip && <span className="text-xs text-emerald-600">{mineruSavedTip}</span>}
           </div>
 
           <div className="text-xs text-gray-500 leading-relaxed">
-            导入 PDF/图片/Office 文档时会先调用 MinerU 解析，再将 Markdown 内容写入文章原文。
+            解析得到的 Markdown 写入文章原文。MinerU（云端或自部署）的解析结果按文件内容缓存在数据目录的 mineru-cache 下，重新导入同一文件不再消耗 MinerU 额度；提取出的图片和表格可在文章详情的“图表”中查看。
+            内置解析只提取 PDF 文本层与 DOCX 文字和表格，不含图片，扫描件需要 MinerU。
           </div>
         </div>
       )}
@@ -942,6 +1299,11 @@ export default function Settings() {
             />
           </div>
 
+          <GenerationOptionsFields
+            value={telegraphCfg.generationOptions}
+            onChange={(value) => setTelegraphCfg({ ...telegraphCfg, generationOptions: value })}
+          />
+
           <div className="flex items-center gap-2">
             <button
               onClick={saveTelegraphScheduler}
@@ -1223,6 +1585,10 @@ export default function Settings() {
         </div>
       )}
 
+      {tab === 'folders' && <FolderWatchPanel channels={channels} prompts={prompts} />}
+
+      {tab === 'library' && <DuplicatePanel />}
+
       {tab === 'dashboard' && (
         <DashboardPanel data={dashboard} range={dashboardRange} onRangeChange={setDashboardRange} onRefresh={() => loadDashboard(dashboardRange)} />
       )}
@@ -1314,6 +1680,494 @@ function buildLineDiff(fromText: string, toText: string): DiffLine[] {
   return result
 }
 
+const WATCHED_FILE_STATUS: Record<string, string> = {
+  imported: '已导入',
+  duplicate: '重复跳过',
+  failed: '失败',
+}
+
+// FolderWatchPanel configures the folders whose new files are imported,
+// and optionally analyzed, in the background.
+function FolderWatchPanel({ channels, prompts }: { channels: models.AIChannel[]; prompts: models.Prompt[] }) {
+  const [cfg, setCfg] = useState<models.FolderWatchConfig | null>(null)
+  const [status, setStatus] = useState<models.FolderWatchStatus | null>(null)
+  const [files, setFiles] = useState<models.WatchedFile[]>([])
+  const [busy, setBusy] = useState(false)
+  const [tip, setTip] = useState('')
+
+  const loadFiles = () => GetWatchedFiles(30).then((list) => setFiles(list || [])).catch(() => setFiles([]))
+
+  useEffect(() => {
+    GetFolderWatchConfig().then(setCfg).catch((e) => setTip(toErrorMessage(e)))
+    GetFolderWatchStatus().then(setStatus).catch(() => undefined)
+    loadFiles()
+    const offStatus = EventsOn('folder-watch-status', (...args: unknown[]) => {
+      const payload = args[0] as models.FolderWatchStatus | undefined
+      if (payload) {
+        setStatus(payload)
+      }
+    })
+    const offFile = EventsOn('folder-watch-file', () => {
+      loadFiles()
+    })
+    return () => {
+      offStatus()
+      offFile()
+    }
+  }, [])
+
+  if (!cfg) {
+    return <div className="text-center py-8 text-sm text-gray-400">{tip || '加载中...'}</div>
+  }
+
+  const addFolder = async () => {
+    try {
+      const dir = await ChooseWatchFolder()
+      if (dir && !cfg.dirs.includes(dir)) {
+        setCfg({ ...cfg, dirs: [...cfg.dirs, dir] })
+      }
+    } catch (e) {
+      setTip(toErrorMessage(e))
+    }
+  }
+
+  const save = async () => {
+    setBusy(true)
+    setTip('')
+    try {
+      await SaveFolderWatchConfig(cfg)
+      setCfg(await GetFolderWatchConfig())
+      setTip('已保存')
+    } catch (e) {
+      setTip(toErrorMessage(e))
+    } finally {
+      setBusy(false)
+    }
+  }
+
+  const runNow = async () => {
+    setTip('')
+    try {
+      await RunFolderWatchNow()
+      setTip('已开始扫描')
+    } catch (e) {
+      setTip(toErrorMessage(e))
+    }
+  }
+
+  return (
+    <div className="bg-white rounded-xl border border-gray-200 p-5 space-y-4">
+      <div className="flex items-center justify-between">
+        <div>
+          <h3 className="text-base font-semibold text-gray-800">文件夹监听</h3>
+          <p className="text-xs text-gray-400 mt-1">自动导入监听文件夹（含子文件夹）中新增的研报文件，已处理过的文件按内容哈希记住，改名或复制后不会重复导入</p>
+        </div>
+        <label className="flex items-center gap-2 text-sm text-gray-600 cursor-pointer">
+          <input
+            type="checkbox"
+            checked={cfg.enabled === 1}
+            onChange={(e) => setCfg({ ...cfg, enabled: e.target.checked ? 1 : 0 })}
+            className="w-4 h-4 rounded border-gray-300 text-blue-500 focus:ring-blue-500/20"
+          />
+          启用
+        </label>
+      </div>
+
+      <div>
+        <label className="block text-xs font-medium text-gray-500 mb-1.5">监听文件夹</label>
+        <div className="space-y-1.5">
+          {cfg.dirs.map((dir) => (
+            <div key={dir} className="flex items-center justify-between rounded-lg border border-gray-200 bg-gray-50 px-3 py-2 text-sm text-gray-700">
+              <span className="truncate">{dir}</span>
+              <button
+                onClick={() => setCfg({ ...cfg, dirs: cfg.dirs.filter((d) => d !== dir) })}
+                className="text-xs text-rose-500 hover:text-rose-700 ml-3 shrink-0"
+              >
+                移除
+              </button>
+            </div>
+          ))}
+          <button onClick={addFolder} className="px-3 py-1.5 bg-white border border-gray-200 text-gray-700 text-xs rounded-lg hover:bg-gray-50 transition-colors">
+            + 添加文件夹
+          </button>
+        </div>
+      </div>
+
+      <div className="grid grid-cols-2 gap-3">
+        <div>
+          <label className="block text-xs font-medium text-gray-500 mb-1.5">扫描间隔(分钟)</label>
+          <input
+            type="number"
+            min={1}
+            max={1440}
+            value={cfg.intervalMinutes}
+            onChange={(e) => setCfg({ ...cfg, intervalMinutes: Number(e.target.value) })}
+            className={inputCls}
+          />
+        </div>
+        <label className="flex items-center gap-2 text-sm text-gray-600 cursor-pointer self-end pb-2.5">
+          <input
+            type="checkbox"
+            checked={cfg.autoAnalyze === 1}
+            onChange={(e) => setCfg({ ...cfg, autoAnalyze: e.target.checked ? 1 : 0 })}
+            className="w-4 h-4 rounded border-gray-300 text-blue-500 focus:ring-blue-500/20"
+          />
+          导入后自动解读
+        </label>
+      </div>
+
+      {cfg.autoAnalyze === 1 && (
+        <div className="grid grid-cols-3 gap-3">
+          <div>
+            <label className="block text-xs font-medium text-gray-500 mb-1.5">AI 渠道</label>
+            <select value={cfg.channelId} onChange={(e) => setCfg({ ...cfg, channelId: Number(e.target.value) })} className={inputCls}>
+              <option value={0}>请选择</option>
+              {channels.map((channel) => (
+                <option key={channel.id} value={channel.id}>
+                  {channel.name} / {channel.model}
+                </option>
+              ))}
+            </select>
+          </div>
+          <div>
+            <label className="block text-xs font-medium text-gray-500 mb-1.5">提示词</label>
+            <select value={cfg.promptId} onChange={(e) => setCfg({ ...cfg, promptId: Number(e.target.value) })} className={inputCls}>
+              <option value={0}>请选择</option>
+              {prompts.map((prompt) => (
+                <option key={prompt.id} value={prompt.id}>
+                  {prompt.name}
+                </option>
+              ))}
+            </select>
+          </div>
+          <div>
+            <label className="block text-xs font-medium text-gray-500 mb-1.5">解读模式</label>
+            <select value={cfg.mode} onChange={(e) => setCfg({ ...cfg, mode: e.target.value })} className={inputCls}>
+              <option value="text">文本</option>
+              <option value="structured">结构化</option>
+            </select>
+          </div>
+        </div>
+      )}
+
+      <div className="flex items-center gap-2">
+        <button onClick={save} disabled={busy} className="px-4 py-2 bg-blue-500 text-white text-sm rounded-lg hover:bg-blue-600 shadow-sm transition-colors disabled:opacity-50">
+          {busy ? '保存中...' : '保存配置'}
+        </button>
+        <button
+          onClick={runNow}
+          disabled={status?.running || cfg.dirs.length === 0}
+          className="px-4 py-2 bg-emerald-500 text-white text-sm rounded-lg hover:bg-emerald-600 shadow-sm transition-colors disabled:opacity-50"
+        >
+          {status?.running ? '扫描中...' : '立即扫描'}
+        </button>
+        <button
+          onClick={() => void StopFolderWatchRun()}
+          disabled={!status?.running}
+          className="px-4 py-2 bg-rose-500 text-white text-sm rounded-lg hover:bg-rose-600 shadow-sm transition-colors disabled:opacity-50"
+        >
+          停止
+        </button>
+        {tip && <span className="text-xs text-emerald-600">{tip}</span>}
+      </div>
+
+      {status && (
+        <div className="grid grid-cols-3 gap-3">
+          <div className="rounded-lg border border-gray-200 bg-gray-50 p-3">
+            <div className="text-xs text-gray-500">运行状态</div>
+            <div className={`mt-1 text-sm font-semibold ${status.running ? 'text-emerald-600' : 'text-gray-700'}`}>
+              {status.running ? `导入中 ${status.completed}/${status.total}` : status.watching ? '监听中' : '空闲'}
+            </div>
+            {status.running && status.currentFile && <div className="mt-1 text-xs text-gray-400 truncate">{status.currentFile}</div>}
+          </div>
+          <div className="rounded-lg border border-gray-200 bg-gray-50 p-3">
+            <div className="text-xs text-gray-500">上次扫描时间</div>
+            <div className="mt-1 text-sm font-semibold text-gray-700">{formatDateTime(status.lastRunAt)}</div>
+          </div>
+          <div className="rounded-lg border border-gray-200 bg-gray-50 p-3">
+            <div className="text-xs text-gray-500">上次导入/重复/失败/解读</div>
+            <div className="mt-1 text-sm font-semibold text-gray-700">
+              {status.lastImported} / {status.lastDuplicates} / {status.lastFailed} / {status.lastAnalyzed}
+            </div>
+          </div>
+        </div>
+      )}
+
+      {status?.lastError && (
+        <div className="rounded-lg border border-rose-200 bg-rose-50 px-3 py-2 text-xs text-rose-700 break-all">最近错误：{status.lastError}</div>
+      )}
+
+      {files.length > 0 && (
+        <div>
+          <div className="text-xs font-medium text-gray-500 mb-1.5">最近处理的文件</div>
+          <div className="divide-y divide-gray-100 border border-gray-200 rounded-lg">
+            {files.map((f) => (
+              <div key={f.path} className="flex items-center justify-between px-3 py-2 text-xs">
+                <span className="truncate text-gray-700" title={f.path}>
+                  {f.path}
+                  {f.title && <span className="text-gray-400 ml-2">→ {f.title}</span>}
+                </span>
+                <span
+                  className={`ml-3 shrink-0 ${f.status === 'failed' ? 'text-rose-600' : f.status === 'duplicate' ? 'text-amber-600' : 'text-emerald-600'}`}
+                  title={f.error}
+                >
+                  {WATCHED_FILE_STATUS[f.status] || f.status}
+                  {f.status === 'failed' && ` (${f.attempts})`}
+                </span>
+              </div>
+            ))}
+          </div>
+        </div>
+      )}
+    </div>
+  )
+}
+
+// SemanticRetrievalPanel turns on hybrid BM25 + embedding retrieval for QA
+// and embeds the sections of articles imported before it was on.
+function SemanticRetrievalPanel({ channels }: { channels: models.AIChannel[] }) {
+  const [cfg, setCfg] = useState<models.EmbeddingConfig | null>(null)
+  const [status, setStatus] = useState<models.EmbeddingBackfillStatus | null>(null)
+  const [tip, setTip] = useState('')
+
+  useEffect(() => {
+    GetEmbeddingConfig().then(setCfg).catch((e) => setTip(toErrorMessage(e)))
+    GetEmbeddingBackfillStatus().then(setStatus).catch(() => undefined)
+    const offStatus = EventsOn('embedding-backfill-status', (...args: unknown[]) => {
+      const payload = args[0] as models.EmbeddingBackfillStatus | undefined
+      if (payload) {
+        setStatus(payload)
+      }
+    })
+    return () => {
+      offStatus()
+    }
+  }, [])
+
+  if (!cfg) {
+    return null
+  }
+  const embeddingChannels = channels.filter((c) => c.embeddingModel)
+
+  const save = async () => {
+    setTip('')
+    try {
+      await SaveEmbeddingConfig(cfg)
+      setCfg(await GetEmbeddingConfig())
+      setTip('已保存')
+    } catch (e) {
+      setTip(toErrorMessage(e))
+    }
+  }
+
+  const backfill = async () => {
+    setTip('')
+    try {
+      await StartEmbeddingBackfill()
+    } catch (e) {
+      setTip(toErrorMessage(e))
+    }
+  }
+
+  return (
+    <div className="mt-6 p-4 bg-white rounded-xl border border-gray-200/80">
+      <div className="flex items-center justify-between">
+        <div className="text-sm font-semibold text-gray-800">语义检索</div>
+        <label className="flex items-center gap-2 text-sm text-gray-600 cursor-pointer">
+          <input
+            type="checkbox"
+            checked={cfg.enabled === 1}
+            onChange={(e) => setCfg(new models.EmbeddingConfig({ ...cfg, enabled: e.target.checked ? 1 : 0 }))}
+            className="w-4 h-4 rounded border-gray-300 text-blue-500 focus:ring-blue-500/20"
+          />
+          启用
+        </label>
+      </div>
+      <div className="text-xs text-gray-400 mt-1 mb-3">
+        问答检索时在 BM25 关键词得分之外加入向量相似度，换一种说法提问也能找到相关段落。需在 OpenAI 兼容渠道中填写向量模型；向量调用失败时自动退回 BM25。
+      </div>
+      <div className="grid grid-cols-3 gap-3 items-end">
+        <div>
+          <label className="block text-xs font-medium text-gray-500 mb-1.5">向量渠道</label>
+          <select value={cfg.channelId} onChange={(e) => setCfg(new models.EmbeddingConfig({ ...cfg, channelId: Number(e.target.value) }))} className={inputCls}>
+            <option value={0}>请选择</option>
+            {embeddingChannels.map((c) => (
+              <option key={c.id} value={c.id}>{c.name} / {c.embeddingModel}</option>
+            ))}
+          </select>
+        </div>
+        <div>
+          <label className="block text-xs font-medium text-gray-500 mb-1.5">语义权重（0-1）</label>
+          <input type="number" min={0} max={1} step={0.1} value={cfg.semanticWeight} onChange={(e) => setCfg(new models.EmbeddingConfig({ ...cfg, semanticWeight: Number(e.target.value) }))} className={inputCls} />
+        </div>
+        <button onClick={() => void save()} className="px-4 py-2.5 bg-blue-500 text-white text-sm rounded-lg hover:bg-blue-600 shadow-sm transition-colors">保存</button>
+      </div>
+      <div className="flex items-center gap-2 mt-3">
+        <button
+          onClick={() => void backfill()}
+          disabled={status?.running || cfg.enabled !== 1}
+          className="px-3 py-1.5 bg-emerald-500 text-white text-xs rounded-lg hover:bg-emerald-600 shadow-sm transition-colors disabled:opacity-50"
+        >
+          {status?.running ? `回填中 ${status.completed}/${status.total}` : '为已有文章生成向量'}
+        </button>
+        {status?.running && (
+          <button onClick={() => void StopEmbeddingBackfill()} className="px-3 py-1.5 bg-rose-500 text-white text-xs rounded-lg hover:bg-rose-600 shadow-sm transition-colors">
+            停止
+          </button>
+        )}
+        {status && !status.running && status.total > 0 && (
+          <span className="text-xs text-gray-500">
+            上次回填 {formatDateTime(status.lastRunAt)}，{status.completed}/{status.total} 段
+          </span>
+        )}
+        {tip && <span className="text-xs text-emerald-600">{tip}</span>}
+      </div>
+      {status?.lastError && (
+        <div className="mt-2 rounded-lg border border-rose-200 bg-rose-50 px-3 py-2 text-xs text-rose-700 break-all">最近错误：{status.lastError}</div>
+      )}
+    </div>
+  )
+}
+
+// QAModeratorPanel configures the synthesis written after a question that
+// several roles answered.
+function QAModeratorPanel({ roles }: { roles: models.Role[] }) {
+  const [cfg, setCfg] = useState<models.QAModeratorConfig | null>(null)
+  const [tip, setTip] = useState('')
+
+  useEffect(() => {
+    GetQAModeratorConfig().then(setCfg).catch((e) => setTip(toErrorMessage(e)))
+  }, [])
+
+  if (!cfg) {
+    return null
+  }
+
+  const save = async () => {
+    setTip('')
+    try {
+      await SaveQAModeratorConfig(cfg)
+      setCfg(await GetQAModeratorConfig())
+      setTip('已保存')
+    } catch (e) {
+      setTip(toErrorMessage(e))
+    }
+  }
+
+  return (
+    <div className="mt-6 p-4 bg-white rounded-xl border border-gray-200/80">
+      <div className="flex items-center justify-between">
+        <div className="text-sm font-semibold text-gray-800">主持综合</div>
+        <label className="flex items-center gap-2 text-sm text-gray-600 cursor-pointer">
+          <input
+            type="checkbox"
+            checked={cfg.enabled === 1}
+            onChange={(e) => setCfg(new models.QAModeratorConfig({ ...cfg, enabled: e.target.checked ? 1 : 0 }))}
+            className="w-4 h-4 rounded border-gray-300 text-blue-500 focus:ring-blue-500/20"
+          />
+          启用
+        </label>
+      </div>
+      <div className="text-xs text-gray-400 mt-1 mb-3">
+        一次提问 @ 了多个角色且至少两个角色回答成功后，由主持角色通读全部回答，整理共识与分歧，作为单独一条回答保存。
+      </div>
+      <div className="space-y-3">
+        <div>
+          <label className="block text-xs font-medium text-gray-500 mb-1.5">主持角色</label>
+          <select value={cfg.roleId} onChange={(e) => setCfg(new models.QAModeratorConfig({ ...cfg, roleId: Number(e.target.value) }))} className={inputCls}>
+            <option value={0}>默认角色</option>
+            {roles.filter((r) => r.enabled === 1).map((r) => (
+              <option key={r.id} value={r.id}>{r.name}</option>
+            ))}
+          </select>
+        </div>
+        <div>
+          <label className="block text-xs font-medium text-gray-500 mb-1.5">主持提示词（留空使用内置：先共识、再分歧、最后综合判断）</label>
+          <textarea
+            value={cfg.prompt}
+            onChange={(e) => setCfg(new models.QAModeratorConfig({ ...cfg, prompt: e.target.value }))}
+            rows={4}
+            className={inputCls}
+          />
+        </div>
+        <div className="flex items-center gap-2">
+          <button onClick={() => void save()} className="px-4 py-2 bg-blue-500 text-white text-sm rounded-lg hover:bg-blue-600 shadow-sm transition-colors">保存</button>
+          {tip && <span className="text-xs text-emerald-600">{tip}</span>}
+        </div>
+      </div>
+    </div>
+  )
+}
+
+// DuplicatePanel finds articles imported more than once and merges each
+// group into its oldest article.
+function DuplicatePanel() {
+  const [groups, setGroups] = useState<models.DuplicateGroup[] | null>(null)
+  const [busy, setBusy] = useState(false)
+  const [tip, setTip] = useState('')
+
+  const scan = async () => {
+    setBusy(true)
+    setTip('')
+    try {
+      setGroups((await FindDuplicateArticles()) || [])
+    } catch (e) {
+      setTip(String(e))
+    } finally {
+      setBusy(false)
+    }
+  }
+
+  const merge = async (group: models.DuplicateGroup) => {
+    const [keep, ...rest] = group.articles
+    if (!window.confirm(`将 ${rest.length} 篇合并到《${keep.title}》并删除，标签、解读历史与问答会一并迁移，确认吗？`)) {
+      return
+    }
+    setBusy(true)
+    try {
+      await MergeDuplicateArticles(keep.id, rest.map((a) => a.id))
+      setTip(`已合并到《${keep.title}》`)
+      setGroups((await FindDuplicateArticles()) || [])
+    } catch (e) {
+      setTip(String(e))
+    } finally {
+      setBusy(false)
+    }
+  }
+
+  return (
+    <div className="bg-white rounded-xl border border-gray-200 p-5 space-y-4">
+      <div className="flex items-center justify-between">
+        <div>
+          <h3 className="text-base font-semibold text-gray-800">重复文章</h3>
+          <p className="text-xs text-gray-400 mt-1">按原文件、规范化正文与相似度（simhash）查找重复导入的文章，合并时保留最早导入的一篇</p>
+        </div>
+        <button onClick={scan} disabled={busy} className="px-4 py-2 bg-blue-500 text-white text-sm rounded-lg hover:bg-blue-600 shadow-sm transition-colors disabled:opacity-60">
+          {busy ? '处理中...' : '查找重复'}
+        </button>
+      </div>
+      {tip && <div className="text-xs text-gray-600 bg-gray-50 border border-gray-200 rounded-lg px-3 py-2">{tip}</div>}
+      {groups?.map((group) => (
+        <div key={group.articles[0].id} className="border border-gray-200 rounded-lg p-3">
+          <div className="flex items-center justify-between mb-2">
+            <span className={`text-xs px-2 py-0.5 rounded-full ${group.exact ? 'bg-rose-50 text-rose-600' : 'bg-amber-50 text-amber-600'}`}>
+              {group.exact ? '内容相同' : '内容相似'}
+            </span>
+            <button onClick={() => merge(group)} disabled={busy} className="text-xs text-blue-500 hover:text-blue-700 font-medium disabled:opacity-60">合并</button>
+          </div>
+          {group.articles.map((a, idx) => (
+            <div key={a.id} className="text-xs text-gray-600 py-0.5">
+              {idx === 0 ? '保留' : '合并'} · #{a.id} {a.title}
+              <span className="text-gray-400 ml-2">{new Date(a.createdAt).toLocaleString()}</span>
+            </div>
+          ))}
+        </div>
+      ))}
+      {groups?.length === 0 && <div className="text-center py-8 text-sm text-gray-400">未发现重复文章</div>}
+    </div>
+  )
+}
+
 function TabButton({ tab, value, onClick, label }: { tab: TabKey; value: TabKey; onClick: (key: TabKey) => void; label: string }) {
   return (
     <button
@@ -1341,6 +2195,7 @@ function DashboardPanel({
     { label: '成功率', value: data?.successRate ?? '0%' },
     { label: '平均耗时', value: `${data?.avgDurationMs ?? 0} ms` },
     { label: '总 Token', value: data?.totalTokens ?? 0 },
+    { label: '缓存命中', value: `${data?.cacheHits ?? 0}（${data?.cacheHitRate ?? '0%'}）` },
   ]
 
   return (
@@ -1361,7 +2216,7 @@ function DashboardPanel({
         </div>
       </div>
 
-      <div className="grid grid-cols-4 gap-3">
+      <div className="grid grid-cols-5 gap-3">
         {summaryItems.map((item) => (
           <div key={item.label} className="bg-white border border-gray-200 rounded-xl p-4">
             <div className="text-xs text-gray-500 mb-1">{item.label}</div>
@@ -1381,6 +2236,7 @@ function DashboardPanel({
                   <th className="text-right py-2 pr-2">运行</th>
                   <th className="text-right py-2 pr-2">成功率</th>
                   <th className="text-right py-2 pr-2">均耗时</th>
+                  <th className="text-right py-2 pr-2">缓存命中</th>
                   <th className="text-right py-2">Token</th>
                 </tr>
               </thead>
@@ -1391,12 +2247,13 @@ function DashboardPanel({
                     <td className="py-2 pr-2 text-right text-gray-700">{row.totalRuns}</td>
                     <td className="py-2 pr-2 text-right text-gray-700">{row.successRate}</td>
                     <td className="py-2 pr-2 text-right text-gray-700">{row.avgDuration} ms</td>
+                    <td className="py-2 pr-2 text-right text-gray-700">{row.cacheHits}</td>
                     <td className="py-2 text-right text-gray-700">{row.totalTokens}</td>
                   </tr>
                 ))}
                 {(data?.byChannel?.length || 0) === 0 && (
                   <tr>
-                    <td colSpan={5} className="py-6 text-center text-gray-400">暂无数据</td>
+                    <td colSpan={6} className="py-6 text-center text-gray-400">暂无数据</td>
                   </tr>
                 )}
               </tbody>
@@ -1426,6 +2283,41 @@ function DashboardPanel({
           </div>
         </section>
       </div>
+
+      <section className="bg-white border border-gray-200 rounded-xl p-4">
+        <div className="flex items-center justify-between mb-3">
+          <h4 className="text-sm font-semibold text-gray-800">花费统计</h4>
+          <span className="text-xs text-gray-500">
+            合计 {(data?.costs || []).map((item) => formatCost(item)).join(' / ') || '暂无（渠道未设置价格）'}
+          </span>
+        </div>
+        <div className="grid grid-cols-3 gap-4">
+          <CostTable title="按日" items={data?.costByDay || []} />
+          <CostTable title="按渠道" items={data?.costByChannel || []} />
+          <CostTable title="按提示词" items={data?.costByPrompt || []} />
+        </div>
+      </section>
+    </div>
+  )
+}
+
+function formatCost(item: models.CostMetric): string {
+  return `${item.cost.toFixed(4)} ${item.currency}`
+}
+
+function CostTable({ title, items }: { title: string; items: models.CostMetric[] }) {
+  return (
+    <div>
+      <div className="text-xs font-medium text-gray-500 mb-2">{title}</div>
+      <div className="space-y-1 max-h-48 overflow-auto">
+        {items.map((item) => (
+          <div key={`${item.key}-${item.currency}`} className="flex items-center justify-between text-xs">
+            <span className="text-gray-700 truncate pr-2">{item.key || '-'}</span>
+            <span className="text-gray-500 whitespace-nowrap">{formatCost(item)}</span>
+          </div>
+        ))}
+        {items.length === 0 && <div className="text-xs text-gray-400">暂无数据</div>}
+      </div>
     </div>
   )
 }
@@ -1454,14 +2346,84 @@ function ChannelForm({ ch, onChange, onSave, onCancel }: ChannelFormProps) {
           <input placeholder="如 deepseek-chat" value={ch.model} onChange={(e) => setField('model', e.target.value)} className={inputCls} />
         </div>
       </div>
+      <div>
+        <label className="block text-xs font-medium text-gray-500 mb-1.5">接口类型</label>
+        <select value={ch.provider} onChange={(e) => onChange({ ...ch, provider: e.target.value, embeddingModel: e.target.value === 'openai' ? ch.embeddingModel : '' })} className={inputCls}>
+          {CHANNEL_PROVIDERS.map((p) => (
+            <option key={p.value} value={p.value}>{p.label}</option>
+          ))}
+        </select>
+      </div>
       <div>
         <label className="block text-xs font-medium text-gray-500 mb-1.5">API Base URL</label>
-        <input placeholder="如 https://api.deepseek.com/v1" value={ch.baseUrl} onChange={(e) => setField('baseUrl', e.target.value)} className={inputCls} />
+        <input
+          placeholder={`如 ${CHANNEL_PROVIDERS.find((p) => p.value === ch.provider)?.baseUrl || 'https://api.deepseek.com/v1'}（留空使用官方地址）`}
+          value={ch.baseUrl}
+          onChange={(e) => setField('baseUrl', e.target.value)}
+          className={inputCls}
+        />
       </div>
       <div>
         <label className="block text-xs font-medium text-gray-500 mb-1.5">API Key</label>
         <input placeholder="sk-..." type="password" value={ch.apiKey} onChange={(e) => setField('apiKey', e.target.value)} className={inputCls} />
       </div>
+      <div className="grid grid-cols-2 gap-3">
+        <div>
+          <label className="block text-xs font-medium text-gray-500 mb-1.5">失败重试次数</label>
+          <input type="number" min={0} max={5} value={ch.maxRetries} onChange={(e) => setField('maxRetries', Number(e.target.value))} className={inputCls} />
+        </div>
+        <div>
+          <label className="block text-xs font-medium text-gray-500 mb-1.5">初始退避（毫秒）</label>
+          <input type="number" min={100} step={100} value={ch.retryBackoffMs} onChange={(e) => setField('retryBackoffMs', Number(e.target.value))} className={inputCls} />
+        </div>
+      </div>
+      <div className="grid grid-cols-3 gap-3">
+        <div>
+          <label className="block text-xs font-medium text-gray-500 mb-1.5">每分钟请求数（0 不限）</label>
+          <input type="number" min={0} value={ch.rpmLimit} onChange={(e) => setField('rpmLimit', Number(e.target.value))} className={inputCls} />
+        </div>
+        <div>
+          <label className="block text-xs font-medium text-gray-500 mb-1.5">每分钟 Token（0 不限）</label>
+          <input type="number" min={0} step={1000} value={ch.tpmLimit} onChange={(e) => setField('tpmLimit', Number(e.target.value))} className={inputCls} />
+        </div>
+        <div>
+          <label className="block text-xs font-medium text-gray-500 mb-1.5">最大并发（0 不限）</label>
+          <input type="number" min={0} value={ch.maxInFlight} onChange={(e) => setField('maxInFlight', Number(e.target.value))} className={inputCls} />
+        </div>
+        <div>
+          <label className="block text-xs font-medium text-gray-500 mb-1.5">上下文窗口 Token（0 不分段）</label>
+          <input type="number" min={0} step={1024} value={ch.contextWindow} onChange={(e) => setField('contextWindow', Number(e.target.value))} className={inputCls} />
+        </div>
+        {ch.provider === 'openai' && (
+          <div>
+            <label className="block text-xs font-medium text-gray-500 mb-1.5">向量模型（语义检索用，可空）</label>
+            <input value={ch.embeddingModel} onChange={(e) => setField('embeddingModel', e.target.value)} placeholder="text-embedding-3-small" className={inputCls} />
+          </div>
+        )}
+      </div>
+      <div className="grid grid-cols-3 gap-3">
+        <div>
+          <label className="block text-xs font-medium text-gray-500 mb-1.5">输入价格（每百万 Token）</label>
+          <input type="number" min={0} step={0.1} value={ch.inputPrice} onChange={(e) => setField('inputPrice', Number(e.target.value))} className={inputCls} />
+        </div>
+        <div>
+          <label className="block text-xs font-medium text-gray-500 mb-1.5">输出价格（每百万 Token）</label>
+          <input type="number" min={0} step={0.1} value={ch.outputPrice} onChange={(e) => setField('outputPrice', Number(e.target.value))} className={inputCls} />
+        </div>
+        <div>
+          <label className="block text-xs font-medium text-gray-500 mb-1.5">币种</label>
+          <input value={ch.currency} onChange={(e) => setField('currency', e.target.value)} placeholder="CNY" className={inputCls} />
+        </div>
+      </div>
+      <label className="flex items-center gap-2 text-sm text-gray-600 cursor-pointer">
+        <input
+          type="checkbox"
+          checked={ch.storeReasoning === 1}
+          onChange={(e) => setField('storeReasoning', e.target.checked ? 1 : 0)}
+          className="w-4 h-4 rounded border-gray-300 text-blue-500 focus:ring-blue-500/20"
+        />
+        保存推理过程到解读历史（推理模型适用）
+      </label>
       <label className="flex items-center gap-2 text-sm text-gray-600 cursor-pointer">
         <input
           type="checkbox"
@@ -1481,12 +2443,13 @@ function ChannelForm({ ch, onChange, onSave, onCancel }: ChannelFormProps) {
 
 type PromptFormProps = {
   pr: PromptFormData
+  tip: string
   onChange: (value: PromptFormData) => void
   onSave: () => void
   onCancel: () => void
 }
 
-function PromptForm({ pr, onChange, onSave, onCancel }: PromptFormProps) {
+function PromptForm({ pr, tip, onChange, onSave, onCancel }: PromptFormProps) {
   const setField = <K extends keyof PromptFormData>(key: K, value: PromptFormData[K]) => {
     onChange({ ...pr, [key]: value })
   }
@@ -1507,6 +2470,16 @@ function PromptForm({ pr, onChange, onSave, onCancel }: PromptFormProps) {
           className={`${inputCls} resize-none`}
         />
       </div>
+      <div>
+        <label className="block text-xs font-medium text-gray-500 mb-1.5">输出 JSON Schema（可选，仅结构化模式生效，留空使用默认的结论/风险/催化剂/估值观点）</label>
+        <textarea
+          placeholder='{"type":"object","properties":{"revenue":{"type":"string"},"netProfit":{"type":"string"},"guidance":{"type":"string"}},"required":["revenue","netProfit","guidance"]}'
+          value={pr.outputSchema}
+          onChange={(e) => setField('outputSchema', e.target.value)}
+          rows={5}
+          className={`${inputCls} resize-none font-mono text-xs`}
+        />
+      </div>
       <label className="flex items-center gap-2 text-sm text-gray-600 cursor-pointer">
         <input
           type="checkbox"
@@ -1516,10 +2489,73 @@ function PromptForm({ pr, onChange, onSave, onCancel }: PromptFormProps) {
         />
         设为默认提示词
       </label>
+      <GenerationOptionsFields value={pr.generationOptions} onChange={(value) => setField('generationOptions', value)} />
       <div className="flex gap-2 pt-1">
         <button onClick={onSave} className="px-4 py-2 bg-blue-500 text-white text-sm rounded-lg hover:bg-blue-600 shadow-sm transition-colors">保存</button>
         <button onClick={onCancel} className="px-4 py-2 bg-gray-100 text-gray-600 text-sm rounded-lg hover:bg-gray-200 transition-colors">取消</button>
+        {tip && <span className="self-center text-xs text-red-500">{tip}</span>}
+      </div>
+    </div>
+  )
+}
+
+type GenerationOptionsFieldsProps = {
+  value: GenerationOptionsData
+  onChange: (value: GenerationOptionsData) => void
+}
+
+const toOptionalNumber = (raw: string) => (raw.trim() === '' ? undefined : Number(raw))
+
+// Empty inputs are sent as undefined so the provider default applies.
+function GenerationOptionsFields({ value, onChange }: GenerationOptionsFieldsProps) {
+  const opts = value || {}
+  return (
+    <div className="p-3 bg-gray-50 border border-gray-200 rounded-lg space-y-2">
+      <div className="text-xs font-medium text-gray-500">生成参数（留空使用模型默认值）</div>
+      <div className="grid grid-cols-4 gap-2">
+        <input
+          type="number"
+          step="0.1"
+          min={0}
+          max={2}
+          placeholder="temperature"
+          value={opts.temperature ?? ''}
+          onChange={(e) => onChange({ ...opts, temperature: toOptionalNumber(e.target.value) })}
+          className={inputCls}
+        />
+        <input
+          type="number"
+          step="0.05"
+          min={0}
+          max={1}
+          placeholder="top_p"
+          value={opts.topP ?? ''}
+          onChange={(e) => onChange({ ...opts, topP: toOptionalNumber(e.target.value) })}
+          className={inputCls}
+        />
+        <input
+          type="number"
+          min={0}
+          placeholder="max_tokens"
+          value={opts.maxTokens || ''}
+          onChange={(e) => onChange({ ...opts, maxTokens: toOptionalNumber(e.target.value) })}
+          className={inputCls}
+        />
+        <input
+          type="number"
+          placeholder="seed"
+          value={opts.seed ?? ''}
+          onChange={(e) => onChange({ ...opts, seed: toOptionalNumber(e.target.value) })}
+          className={inputCls}
+        />
       </div>
+      <textarea
+        placeholder="stop 序列，每行一个（最多 4 个）"
+        value={(opts.stop || []).join('\n')}
+        onChange={(e) => onChange({ ...opts, stop: e.target.value === '' ? undefined : e.target.value.split('\n') })}
+        rows={2}
+        className={`${inputCls} resize-none`}
+      />
     </div>
   )
 }
@@ -1562,35 +2598,11 @@ function RoleForm({ role, onChange, onSave, onCancel }: RoleFormProps) {
           className={`${inputCls} resize-none`}
         />
       </div>
-      <div className="grid grid-cols-3 gap-3">
-        <div>
-          <label className="block text-xs font-medium text-gray-500 mb-1.5">模型覆盖（可空）</label>
-          <input placeholder="如 deepseek-chat" value={role.modelOverride} onChange={(e) => setField('modelOverride', e.target.value)} className={inputCls} />
-        </div>
-        <div>
-          <label className="block text-xs font-medium text-gray-500 mb-1.5">温度</label>
-          <input
-            type="number"
-            min={0}
-            max={2}
-            step={0.1}
-            value={role.temperature}
-            onChange={(e) => setField('temperature', Number(e.target.value))}
-            className={inputCls}
-          />
-        </div>
-        <div>
-          <label className="block text-xs font-medium text-gray-500 mb-1.5">最大 Token</label>
-          <input
-            type="number"
-            min={100}
-            step={100}
-            value={role.maxTokens}
-            onChange={(e) => setField('maxTokens', Number(e.target.value))}
-            className={inputCls}
-          />
-        </div>
+      <div>
+        <label className="block text-xs font-medium text-gray-500 mb-1.5">模型覆盖（可空）</label>
+        <input placeholder="如 deepseek-chat" value={role.modelOverride} onChange={(e) => setField('modelOverride', e.target.value)} className={inputCls} />
       </div>
+      <GenerationOptionsFields value={role.generationOptions} onChange={(value) => setField('generationOptions', value)} />
       <div className="flex items-center gap-5">
         <label className="flex items-center gap-2 text-sm text-gray-600 cursor-pointer">
           <input
@@ -16,10 +16,18 @@ export function CancelAskQuestion():Promise<void>;
 
 export function CheckAppUpdate():Promise<models.AppUpdateResult>;
 
+export function ChooseWatchFolder():Promise<string>;
+
+export function ClearAIResponseCache():Promise<number>;
+
+export function ClearMinerUCache():Promise<number>;
+
 export function CreateQASession(arg1:number,arg2:string):Promise<models.QASession>;
 
 export function CreateRoleFromTemplate(arg1:string):Promise<models.Role>;
 
+export function CreateScopedQASession(arg1:models.QAScope,arg2:string):Promise<models.QASession>;
+
 export function DebugQAPing(arg1:string):Promise<string>;
 
 export function DeleteArticle(arg1:number):Promise<void>;
@@ -42,6 +50,18 @@ export function ExportArticle(arg1:number):Promise<void>;
 
 export function ExportBatchFailures():Promise<void>;
 
+export function FindDuplicateArticles():Promise<Array<models.DuplicateGroup>>;
+
+export function GetAIBudgetConfig():Promise<models.AIBudgetConfig>;
+
+export function GetAIBudgetStatus():Promise<models.AIBudgetStatus>;
+
+export function GetAIFailoverConfig():Promise<models.AIFailoverConfig>;
+
+export function GetAIResponseCacheConfig():Promise<models.AIResponseCacheConfig>;
+
+export function GetAIResponseCacheStats():Promise<models.AIResponseCacheStats>;
+
 export function GetAnalysisDashboard():Promise<models.AnalysisDashboard>;
 
 export function GetAnalysisDashboardByDays(arg1:number):Promise<models.AnalysisDashboard>;
@@ -54,14 +74,24 @@ export function GetAppVersion():Promise<string>;
 
 export function GetArticle(arg1:number):Promise<models.Article>;
 
+export function GetArticleAssets(arg1:number):Promise<Array<models.ArticleAsset>>;
+
 export function GetArticleTags(arg1:number):Promise<Array<models.Tag>>;
 
-export function GetArticles(arg1:string,arg2:number):Promise<Array<models.Article>>;
+export function GetArticles(arg1:models.ArticleQuery):Promise<models.ArticlePage>;
 
 export function GetBatchStatus():Promise<models.BatchStatus>;
 
 export function GetChannels():Promise<Array<models.AIChannel>>;
 
+export function GetEmbeddingBackfillStatus():Promise<models.EmbeddingBackfillStatus>;
+
+export function GetEmbeddingConfig():Promise<models.EmbeddingConfig>;
+
+export function GetFolderWatchConfig():Promise<models.FolderWatchConfig>;
+
+export function GetFolderWatchStatus():Promise<models.FolderWatchStatus>;
+
 export function GetMinerUConfig():Promise<models.MinerUConfig>;
 
 export function GetPromptVersions(arg1:number):Promise<Array<models.PromptVersion>>;
@@ -74,6 +104,8 @@ export function GetQADashboardByDays(arg1:number):Promise<models.QADashboard>;
 
 export function GetQAMessages(arg1:number):Promise<Array<models.QAMessage>>;
 
+export function GetQAModeratorConfig():Promise<models.QAModeratorConfig>;
+
 export function GetQAPins(arg1:number):Promise<Array<models.QAPin>>;
 
 export function GetQASessions(arg1:number):Promise<Array<models.QASession>>;
@@ -82,9 +114,13 @@ export function GetRoleTemplates():Promise<Array<models.RoleTemplate>>;
 
 export function GetRoles():Promise<Array<models.Role>>;
 
+export function GetScopedQASessions():Promise<Array<models.QASession>>;
+
+export function GetStructuredAnalysis(arg1:number):Promise<models.StructuredAnalysis>;
+
 export function GetTags():Promise<Array<models.Tag>>;
 
-export function GetTelegraphArticles(arg1:string,arg2:number,arg3:string,arg4:number):Promise<Array<models.TelegraphArticleItem>>;
+export function GetTelegraphArticles(arg1:models.ArticleQuery):Promise<models.TelegraphArticlePage>;
 
 export function GetTelegraphDashboard():Promise<models.TelegraphDashboard>;
 
@@ -98,9 +134,17 @@ export function GetTelegraphSchedulerStatus():Promise<models.TelegraphSchedulerS
 
 export function GetTelegraphWatchlist():Promise<Array<models.WatchStock>>;
 
-export function ImportArticle():Promise<models.Article>;
+export function GetWatchedFiles(arg1:number):Promise<Array<models.WatchedFile>>;
 
-export function ImportArticles():Promise<Array<models.Article>>;
+export function ImportArticle():Promise<models.ImportResult>;
+
+export function ImportArticles():Promise<Array<models.ImportResult>>;
+
+export function ImportFilePath(arg1:string,arg2:boolean):Promise<models.ImportResult>;
+
+export function ImportURL(arg1:string,arg2:boolean):Promise<models.ImportResult>;
+
+export function MergeDuplicateArticles(arg1:number,arg2:Array<number>):Promise<void>;
 
 export function OpenURL(arg1:string):Promise<void>;
 
@@ -108,22 +152,38 @@ export function PauseBatchAnalyze():Promise<void>;
 
 export function RenameQASession(arg1:number,arg2:string):Promise<void>;
 
+export function ResolveQAScope(arg1:models.QAScope):Promise<Array<models.QAScopeArticle>>;
+
 export function RestorePromptVersion(arg1:number,arg2:number):Promise<void>;
 
 export function ResumeBatchAnalyze():Promise<void>;
 
 export function RetryFailedBatchAnalyze():Promise<void>;
 
+export function RunFolderWatchNow():Promise<void>;
+
 export function RunTelegraphSchedulerNow():Promise<void>;
 
+export function SaveAIBudgetConfig(arg1:models.AIBudgetConfig):Promise<void>;
+
+export function SaveAIFailoverConfig(arg1:models.AIFailoverConfig):Promise<void>;
+
+export function SaveAIResponseCacheConfig(arg1:models.AIResponseCacheConfig):Promise<void>;
+
 export function SaveAppUpdateConfig(arg1:models.AppUpdateConfig):Promise<void>;
 
 export function SaveChannel(arg1:models.AIChannel):Promise<void>;
 
+export function SaveEmbeddingConfig(arg1:models.EmbeddingConfig):Promise<void>;
+
+export function SaveFolderWatchConfig(arg1:models.FolderWatchConfig):Promise<void>;
+
 export function SaveMinerUConfig(arg1:models.MinerUConfig):Promise<void>;
 
 export function SavePrompt(arg1:models.Prompt):Promise<void>;
 
+export function SaveQAModeratorConfig(arg1:models.QAModeratorConfig):Promise<void>;
+
 export function SaveQAPin(arg1:models.QAPin):Promise<models.QAPin>;
 
 export function SaveRole(arg1:models.Role):Promise<void>;
@@ -134,10 +194,20 @@ export function SaveTelegraphSchedulerConfig(arg1:models.TelegraphSchedulerConfi
 
 export function SaveTelegraphWatchlist(arg1:Array<models.WatchStock>):Promise<void>;
 
+export function SearchFullText(arg1:string,arg2:string,arg3:number):Promise<Array<models.SearchHit>>;
+
+export function SearchStructuredAnalyses(arg1:string,arg2:string,arg3:number):Promise<Array<models.StructuredAnalysisHit>>;
+
 export function SetArticleTags(arg1:number,arg2:Array<number>):Promise<void>;
 
 export function SetDefaultRole(arg1:number):Promise<void>;
 
 export function StartBatchAnalyze(arg1:Array<number>,arg2:number,arg3:number,arg4:number,arg5:string):Promise<void>;
 
+export function StartEmbeddingBackfill():Promise<void>;
+
+export function StopEmbeddingBackfill():Promise<void>;
+
+export function StopFolderWatchRun():Promise<void>;
+
 export function StopTelegraphScheduler():Promise<void>;
@@ -30,6 +30,18 @@ export function CheckAppUpdate() {
   return window['go']['main']['App']['CheckAppUpdate']();
 }
 
+export function ChooseWatchFolder() {
+  return window['go']['main']['App']['ChooseWatchFolder']();
+}
+
+export function ClearAIResponseCache() {
+  return window['go']['main']['App']['ClearAIResponseCache']();
+}
+
+export function ClearMinerUCache() {
+  return window['go']['main']['App']['ClearMinerUCache']();
+}
+
 export function CreateQASession(arg1, arg2) {
   return window['go']['main']['App']['CreateQASession'](arg1, arg2);
 }
@@ -38,6 +50,10 @@ export function CreateRoleFromTemplate(arg1) {
   return window['go']['main']['App']['CreateRoleFromTemplate'](arg1);
 }
 
+export function CreateScopedQASession(arg1, arg2) {
+  return window['go']['main']['App']['CreateScopedQASession'](arg1, arg2);
+}
+
 export function DebugQAPing(arg1) {
   return window['go']['main']['App']['DebugQAPing'](arg1);
 }
@@ -82,6 +98,30 @@ export function ExportBatchFailures() {
   return window['go']['main']['App']['ExportBatchFailures']();
 }
 
+export function FindDuplicateArticles() {
+  return window['go']['main']['App']['FindDuplicateArticles']();
+}
+
+export function GetAIBudgetConfig() {
+  return window['go']['main']['App']['GetAIBudgetConfig']();
+}
+
+export function GetAIBudgetStatus() {
+  return window['go']['main']['App']['GetAIBudgetStatus']();
+}
+
+export function GetAIFailoverConfig() {
+  return window['go']['main']['App']['GetAIFailoverConfig']();
+}
+
+export function GetAIResponseCacheConfig() {
+  return window['go']['main']['App']['GetAIResponseCacheConfig']();
+}
+
+export function GetAIResponseCacheStats() {
+  return window['go']['main']['App']['GetAIResponseCacheStats']();
+}
+
 export function GetAnalysisDashboard() {
   return window['go']['main']['App']['GetAnalysisDashboard']();
 }
@@ -106,12 +146,16 @@ export function GetArticle(arg1) {
   return window['go']['main']['App']['GetArticle'](arg1);
 }
 
+export function GetArticleAssets(arg1) {
+  return window['go']['main']['App']['GetArticleAssets'](arg1);
+}
+
 export function GetArticleTags(arg1) {
   return window['go']['main']['App']['GetArticleTags'](arg1);
 }
 
-export function GetArticles(arg1, arg2) {
-  return window['go']['main']['App']['GetArticles'](arg1, arg2);
+export function GetArticles(arg1) {
+  return window['go']['main']['App']['GetArticles'](arg1);
 }
 
 export function GetBatchStatus() {
@@ -122,6 +166,22 @@ export function GetChannels() {
   return window['go']['main']['App']['GetChannels']();
 }
 
+export function GetEmbeddingBackfillStatus() {
+  return window['go']['main']['App']['GetEmbeddingBackfillStatus']();
+}
+
+export function GetEmbeddingConfig() {
+  return window['go']['main']['App']['GetEmbeddingConfig']();
+}
+
+export function GetFolderWatchConfig() {
+  return window['go']['main']['App']['GetFolderWatchConfig']();
+}
+
+export function GetFolderWatchStatus() {
+  return window['go']['main']['App']['GetFolderWatchStatus']();
+}
+
 export function GetMinerUConfig() {
   return window['go']['main']['App']['GetMinerUConfig']();
 }
@@ -146,6 +206,10 @@ export function GetQAMessages(arg1) {
   return window['go']['main']['App']['GetQAMessages'](arg1);
 }
 
+export function GetQAModeratorConfig() {
+  return window['go']['main']['App']['GetQAModeratorConfig']();
+}
+
 export function GetQAPins(arg1) {
   return window['go']['main']['App']['GetQAPins'](arg1);
 }
@@ -162,12 +226,20 @@ export function GetRoles() {
   return window['go']['main']['App']['GetRoles']();
 }
 
+export function GetScopedQASessions() {
+  return window['go']['main']['App']['GetScopedQASessions']();
+}
+
+export function GetStructuredAnalysis(arg1) {
+  return window['go']['main']['App']['GetStructuredAnalysis'](arg1);
+}
+
 export function GetTags() {
   return window['go']['main']['App']['GetTags']();
 }
 
-export function GetTelegraphArticles(arg1, arg2, arg3, arg4) {
-  return window['go']['main']['App']['GetTelegraphArticles'](arg1, arg2, arg3, arg4);
+export function GetTelegraphArticles(arg1) {
+  return window['go']['main']['App']['GetTelegraphArticles'](arg1);
 }
 
 export function GetTelegraphDashboard() {
@@ -194,6 +266,10 @@ export function GetTelegraphWatchlist() {
   return window['go']['main']['App']['GetTelegraphWatchlist']();
 }
 
+export function GetWatchedFiles(arg1) {
+  return window['go']['main']['App']['GetWatchedFiles'](arg1);
+}
+
 export function ImportArticle() {
   return window['go']['main']['App']['ImportArticle']();
 }
@@ -202,6 +278,18 @@ export function ImportArticles() {
   return window['go']['main']['App']['ImportArticles']();
 }
 
+export function ImportFilePath(arg1, arg2) {
+  return window['go']['main']['App']['ImportFilePath'](arg1, arg2);
+}
+
+export function ImportURL(arg1, arg2) {
+  return window['go']['main']['App']['ImportURL'](arg1, arg2);
+}
+
+export function MergeDuplicateArticles(arg1, arg2) {
+  return window['go']['main']['App']['MergeDuplicateArticles'](arg1, arg2);
+}
+
 export function OpenURL(arg1) {
   return window['go']['main']['App']['OpenURL'](arg1);
 }
@@ -214,6 +302,10 @@ export function RenameQASession(arg1, arg2) {
   return window['go']['main']['App']['RenameQASession'](arg1, arg2);
 }
 
+export function ResolveQAScope(arg1) {
+  return window['go']['main']['App']['ResolveQAScope'](arg1);
+}
+
 export function RestorePromptVersion(arg1, arg2) {
   return window['go']['main']['App']['RestorePromptVersion'](arg1, arg2);
 }
@@ -226,10 +318,26 @@ export function RetryFailedBatchAnalyze() {
   return window['go']['main']['App']['RetryFailedBatchAnalyze']();
 }
 
+export function RunFolderWatchNow() {
+  return window['go']['main']['App']['RunFolderWatchNow']();
+}
+
 export function RunTelegraphSchedulerNow() {
   return window['go']['main']['App']['RunTelegraphSchedulerNow']();
 }
 
+export function SaveAIBudgetConfig(arg1) {
+  return window['go']['main']['App']['SaveAIBudgetConfig'](arg1);
+}
+
+export function SaveAIFailoverConfig(arg1) {
+  return window['go']['main']['App']['SaveAIFailoverConfig'](arg1);
+}
+
+export function SaveAIResponseCacheConfig(arg1) {
+  return window['go']['main']['App']['SaveAIResponseCacheConfig'](arg1);
+}
+
 export function SaveAppUpdateConfig(arg1) {
   return window['go']['main']['App']['SaveAppUpdateConfig'](arg1);
 }
@@ -238,6 +346,14 @@ export function SaveChannel(arg1) {
   return window['go']['main']['App']['SaveChannel'](arg1);
 }
 
+export function SaveEmbeddingConfig(arg1) {
+  return window['go']['main']['App']['SaveEmbeddingConfig'](arg1);
+}
+
+export function SaveFolderWatchConfig(arg1) {
+  return window['go']['main']['App']['SaveFolderWatchConfig'](arg1);
+}
+
 export function SaveMinerUConfig(arg1) {
   return window['go']['main']['App']['SaveMinerUConfig'](arg1);
 }
@@ -246,6 +362,10 @@ export function SavePrompt(arg1) {
   return window['go']['main']['App']['SavePrompt'](arg1);
 }
 
+export function SaveQAModeratorConfig(arg1) {
+  return window['go']['main']['App']['SaveQAModeratorConfig'](arg1);
+}
+
 export function SaveQAPin(arg1) {
   return window['go']['main']['App']['SaveQAPin'](arg1);
 }
@@ -266,6 +386,14 @@ export function SaveTelegraphWatchlist(arg1) {
   return window['go']['main']['App']['SaveTelegraphWatchlist'](arg1);
 }
 
+export function SearchFullText(arg1, arg2, arg3) {
+  return window['go']['main']['App']['SearchFullText'](arg1, arg2, arg3);
+}
+
+export function SearchStructuredAnalyses(arg1, arg2, arg3) {
+  return window['go']['main']['App']['SearchStructuredAnalyses'](arg1, arg2, arg3);
+}
+
 export function SetArticleTags(arg1, arg2) {
   return window['go']['main']['App']['SetArticleTags'](arg1, arg2);
 }
@@ -278,6 +406,18 @@ export function StartBatchAnalyze(arg1, arg2, arg3, arg4, arg5) {
   return window['go']['main']['App']['StartBatchAnalyze'](arg1, arg2, arg3, arg4, arg5);
 }
 
+export function StartEmbeddingBackfill() {
+  return window['go']['main']['App']['StartEmbeddingBackfill']();
+}
+
+export function StopEmbeddingBackfill() {
+  return window['go']['main']['App']['StopEmbeddingBackfill']();
+}
+
+export function StopFolderWatchRun() {
+  return window['go']['main']['App']['StopFolderWatchRun']();
+}
+
 export function StopTelegraphScheduler() {
   return window['go']['main']['App']['StopTelegraphScheduler']();
 }
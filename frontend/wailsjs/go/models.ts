@@ -1,11 +1,63 @@
 export namespace models {
 	
+	export class AIBudgetConfig {
+	    dailyLimit: number;
+	    monthlyLimit: number;
+	    currency: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new AIBudgetConfig(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.dailyLimit = source["dailyLimit"];
+	        this.monthlyLimit = source["monthlyLimit"];
+	        this.currency = source["currency"];
+	    }
+	}
+	export class AIBudgetStatus {
+	    currency: string;
+	    dailyLimit: number;
+	    monthlyLimit: number;
+	    dailySpent: number;
+	    monthlySpent: number;
+	    exceeded: boolean;
+	    reason: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new AIBudgetStatus(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.currency = source["currency"];
+	        this.dailyLimit = source["dailyLimit"];
+	        this.monthlyLimit = source["monthlyLimit"];
+	        this.dailySpent = source["dailySpent"];
+	        this.monthlySpent = source["monthlySpent"];
+	        this.exceeded = source["exceeded"];
+	        this.reason = source["reason"];
+	    }
+	}
 	export class AIChannel {
 	    id: number;
 	    name: string;
 	    baseUrl: string;
 	    apiKey: string;
 	    model: string;
+	    provider: string;
+	    maxRetries: number;
+	    retryBackoffMs: number;
+	    rpmLimit: number;
+	    tpmLimit: number;
+	    maxInFlight: number;
+	    contextWindow: number;
+	    storeReasoning: number;
+	    inputPrice: number;
+	    outputPrice: number;
+	    currency: string;
+	    embeddingModel: string;
 	    isDefault: number;
 	    // Go type: time
 	    createdAt: any;
@@ -21,6 +73,18 @@ export namespace models {
 	        this.baseUrl = source["baseUrl"];
 	        this.apiKey = source["apiKey"];
 	        this.model = source["model"];
+	        this.provider = source["provider"];
+	        this.maxRetries = source["maxRetries"];
+	        this.retryBackoffMs = source["retryBackoffMs"];
+	        this.rpmLimit = source["rpmLimit"];
+	        this.tpmLimit = source["tpmLimit"];
+	        this.maxInFlight = source["maxInFlight"];
+	        this.contextWindow = source["contextWindow"];
+	        this.storeReasoning = source["storeReasoning"];
+	        this.inputPrice = source["inputPrice"];
+	        this.outputPrice = source["outputPrice"];
+	        this.currency = source["currency"];
+	        this.embeddingModel = source["embeddingModel"];
 	        this.isDefault = source["isDefault"];
 	        this.createdAt = this.convertValues(source["createdAt"], null);
 	    }
@@ -43,6 +107,72 @@ export namespace models {
 		    return a;
 		}
 	}
+	export class AIFailoverConfig {
+	    channelIds: number[];
+	
+	    static createFrom(source: any = {}) {
+	        return new AIFailoverConfig(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.channelIds = source["channelIds"];
+	    }
+	}
+	export class AIResponseCacheConfig {
+	    single: boolean;
+	    batch: boolean;
+	    qa: boolean;
+	    telegraph: boolean;
+	    maxAgeDays: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new AIResponseCacheConfig(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.single = source["single"];
+	        this.batch = source["batch"];
+	        this.qa = source["qa"];
+	        this.telegraph = source["telegraph"];
+	        this.maxAgeDays = source["maxAgeDays"];
+	    }
+	}
+	export class AIResponseCacheStats {
+	    entries: number;
+	    totalHits: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new AIResponseCacheStats(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.entries = source["entries"];
+	        this.totalHits = source["totalHits"];
+	    }
+	}
+	export class CostMetric {
+	    key: string;
+	    currency: string;
+	    cost: number;
+	    runs: number;
+	    tokens: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new CostMetric(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.key = source["key"];
+	        this.currency = source["currency"];
+	        this.cost = source["cost"];
+	        this.runs = source["runs"];
+	        this.tokens = source["tokens"];
+	    }
+	}
 	export class FailureReasonMetric {
 	    reason: string;
 	    count: number;
@@ -68,6 +198,7 @@ export namespace models {
 	    totalTokens: number;
 	    promptTokens: number;
 	    outputTokens: number;
+	    cacheHits: number;
 	
 	    static createFrom(source: any = {}) {
 	        return new ChannelMetric(source);
@@ -85,6 +216,7 @@ export namespace models {
 	        this.totalTokens = source["totalTokens"];
 	        this.promptTokens = source["promptTokens"];
 	        this.outputTokens = source["outputTokens"];
+	        this.cacheHits = source["cacheHits"];
 	    }
 	}
 	export class AnalysisDashboard {
@@ -96,8 +228,14 @@ export namespace models {
 	    totalTokens: number;
 	    promptTokens: number;
 	    outputTokens: number;
+	    cacheHits: number;
+	    cacheHitRate: string;
 	    byChannel: ChannelMetric[];
 	    failureTop: FailureReasonMetric[];
+	    costs: CostMetric[];
+	    costByDay: CostMetric[];
+	    costByChannel: CostMetric[];
+	    costByPrompt: CostMetric[];
 	
 	    static createFrom(source: any = {}) {
 	        return new AnalysisDashboard(source);
@@ -113,8 +251,14 @@ export namespace models {
 	        this.totalTokens = source["totalTokens"];
 	        this.promptTokens = source["promptTokens"];
 	        this.outputTokens = source["outputTokens"];
+	        this.cacheHits = source["cacheHits"];
+	        this.cacheHitRate = source["cacheHitRate"];
 	        this.byChannel = this.convertValues(source["byChannel"], ChannelMetric);
 	        this.failureTop = this.convertValues(source["failureTop"], FailureReasonMetric);
+	        this.costs = this.convertValues(source["costs"], CostMetric);
+	        this.costByDay = this.convertValues(source["costByDay"], CostMetric);
+	        this.costByChannel = this.convertValues(source["costByChannel"], CostMetric);
+	        this.costByPrompt = this.convertValues(source["costByPrompt"], CostMetric);
 	    }
 	
 		convertValues(a: any, classs: any, asMap: boolean = false): any {
@@ -141,6 +285,7 @@ export namespace models {
 	    analysis: string;
 	    promptUsed: string;
 	    channelUsed: string;
+	    reasoning: string;
 	    // Go type: time
 	    createdAt: any;
 	
@@ -155,6 +300,7 @@ export namespace models {
 	        this.analysis = source["analysis"];
 	        this.promptUsed = source["promptUsed"];
 	        this.channelUsed = source["channelUsed"];
+	        this.reasoning = source["reasoning"];
 	        this.createdAt = this.convertValues(source["createdAt"], null);
 	    }
 	
@@ -277,6 +423,8 @@ export namespace models {
 	    createdAt: any;
 	    // Go type: time
 	    analyzedAt?: any;
+	    contentHash: string;
+	    fileHash: string;
 	    tags: Tag[];
 	
 	    static createFrom(source: any = {}) {
@@ -295,6 +443,8 @@ export namespace models {
 	        this.status = source["status"];
 	        this.createdAt = this.convertValues(source["createdAt"], null);
 	        this.analyzedAt = this.convertValues(source["analyzedAt"], null);
+	        this.contentHash = source["contentHash"];
+	        this.fileHash = source["fileHash"];
 	        this.tags = this.convertValues(source["tags"], Tag);
 	    }
 	
@@ -316,6 +466,103 @@ export namespace models {
 		    return a;
 		}
 	}
+	export class ArticleAsset {
+	    id: number;
+	    articleId: number;
+	    kind: string;
+	    path: string;
+	    url: string;
+	    caption: string;
+	    html: string;
+	    page: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new ArticleAsset(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.id = source["id"];
+	        this.articleId = source["articleId"];
+	        this.kind = source["kind"];
+	        this.path = source["path"];
+	        this.url = source["url"];
+	        this.caption = source["caption"];
+	        this.html = source["html"];
+	        this.page = source["page"];
+	    }
+	}
+	
+	export class ArticlePage {
+	    items: Article[];
+	    total: number;
+	    nextCursor: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new ArticlePage(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.items = this.convertValues(source["items"], Article);
+	        this.total = source["total"];
+	        this.nextCursor = source["nextCursor"];
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class ArticleQuery {
+	    keyword: string;
+	    tagIds: number[];
+	    tagMode: string;
+	    statuses: number[];
+	    sources: string[];
+	    createdFrom: string;
+	    createdTo: string;
+	    analyzedFrom: string;
+	    analyzedTo: string;
+	    sort: string;
+	    watchOnly: boolean;
+	    cursor: string;
+	    limit: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new ArticleQuery(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.keyword = source["keyword"];
+	        this.tagIds = source["tagIds"];
+	        this.tagMode = source["tagMode"];
+	        this.statuses = source["statuses"];
+	        this.sources = source["sources"];
+	        this.createdFrom = source["createdFrom"];
+	        this.createdTo = source["createdTo"];
+	        this.analyzedFrom = source["analyzedFrom"];
+	        this.analyzedTo = source["analyzedTo"];
+	        this.sort = source["sort"];
+	        this.watchOnly = source["watchOnly"];
+	        this.cursor = source["cursor"];
+	        this.limit = source["limit"];
+	    }
+	}
 	export class BatchFailure {
 	    articleId: number;
 	    title: string;
@@ -363,6 +610,10 @@ export namespace models {
 	    inProgress: number;
 	    concurrency: number;
 	    failures: BatchFailure[];
+	    pauseReason: string;
+	    queueDepth: number;
+	    avgWaitMs: number;
+	    maxWaitMs: number;
 	
 	    static createFrom(source: any = {}) {
 	        return new BatchStatus(source);
@@ -379,6 +630,235 @@ export namespace models {
 	        this.inProgress = source["inProgress"];
 	        this.concurrency = source["concurrency"];
 	        this.failures = this.convertValues(source["failures"], BatchFailure);
+	        this.pauseReason = source["pauseReason"];
+	        this.queueDepth = source["queueDepth"];
+	        this.avgWaitMs = source["avgWaitMs"];
+	        this.maxWaitMs = source["maxWaitMs"];
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	
+	
+	
+	export class DuplicateGroup {
+	    articles: Article[];
+	    exact: boolean;
+	
+	    static createFrom(source: any = {}) {
+	        return new DuplicateGroup(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.articles = this.convertValues(source["articles"], Article);
+	        this.exact = source["exact"];
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class EmbeddingConfig {
+	    enabled: number;
+	    channelId: number;
+	    semanticWeight: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new EmbeddingConfig(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.enabled = source["enabled"];
+	        this.channelId = source["channelId"];
+	        this.semanticWeight = source["semanticWeight"];
+	    }
+	}
+	
+	export class EmbeddingBackfillStatus {
+	    running: boolean;
+	    total: number;
+	    completed: number;
+	    // Go type: time
+	    lastRunAt: any;
+	    lastError: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new EmbeddingBackfillStatus(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.running = source["running"];
+	        this.total = source["total"];
+	        this.completed = source["completed"];
+	        this.lastRunAt = this.convertValues(source["lastRunAt"], null);
+	        this.lastError = source["lastError"];
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	
+	export class FolderWatchConfig {
+	    enabled: number;
+	    dirs: string[];
+	    intervalMinutes: number;
+	    autoAnalyze: number;
+	    channelId: number;
+	    promptId: number;
+	    mode: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new FolderWatchConfig(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.enabled = source["enabled"];
+	        this.dirs = source["dirs"];
+	        this.intervalMinutes = source["intervalMinutes"];
+	        this.autoAnalyze = source["autoAnalyze"];
+	        this.channelId = source["channelId"];
+	        this.promptId = source["promptId"];
+	        this.mode = source["mode"];
+	    }
+	}
+	
+	export class FolderWatchStatus {
+	    running: boolean;
+	    watching: boolean;
+	    total: number;
+	    completed: number;
+	    currentFile: string;
+	    // Go type: time
+	    lastRunAt: any;
+	    lastImported: number;
+	    lastDuplicates: number;
+	    lastFailed: number;
+	    lastAnalyzed: number;
+	    lastError: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new FolderWatchStatus(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.running = source["running"];
+	        this.watching = source["watching"];
+	        this.total = source["total"];
+	        this.completed = source["completed"];
+	        this.currentFile = source["currentFile"];
+	        this.lastRunAt = this.convertValues(source["lastRunAt"], null);
+	        this.lastImported = source["lastImported"];
+	        this.lastDuplicates = source["lastDuplicates"];
+	        this.lastFailed = source["lastFailed"];
+	        this.lastAnalyzed = source["lastAnalyzed"];
+	        this.lastError = source["lastError"];
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	
+	export class GenerationOptions {
+	    temperature?: number;
+	    topP?: number;
+	    maxTokens?: number;
+	    stop?: string[];
+	    seed?: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new GenerationOptions(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.temperature = source["temperature"];
+	        this.topP = source["topP"];
+	        this.maxTokens = source["maxTokens"];
+	        this.stop = source["stop"];
+	        this.seed = source["seed"];
+	    }
+	}
+	export class ImportResult {
+	    article: Article;
+	    duplicate: string;
+	    message: string;
+	    filePath: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new ImportResult(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.article = this.convertValues(source["article"], Article);
+	        this.duplicate = source["duplicate"];
+	        this.message = source["message"];
+	        this.filePath = source["filePath"];
 	    }
 	
 		convertValues(a: any, classs: any, asMap: boolean = false): any {
@@ -399,8 +879,6 @@ export namespace models {
 		    return a;
 		}
 	}
-	
-	
 	export class MinerUConfig {
 	    enabled: number;
 	    baseUrl: string;
@@ -409,6 +887,10 @@ export namespace models {
 	    isOCR: number;
 	    pollIntervalMs: number;
 	    timeoutSec: number;
+	    parsers: string[];
+	    selfHostedUrl: string;
+	    selfHostedApi: string;
+	    selfHostedBackend: string;
 	
 	    static createFrom(source: any = {}) {
 	        return new MinerUConfig(source);
@@ -423,12 +905,18 @@ export namespace models {
 	        this.isOCR = source["isOCR"];
 	        this.pollIntervalMs = source["pollIntervalMs"];
 	        this.timeoutSec = source["timeoutSec"];
+	        this.parsers = source["parsers"];
+	        this.selfHostedUrl = source["selfHostedUrl"];
+	        this.selfHostedApi = source["selfHostedApi"];
+	        this.selfHostedBackend = source["selfHostedBackend"];
 	    }
 	}
 	export class Prompt {
 	    id: number;
 	    name: string;
 	    content: string;
+	    generationOptions: GenerationOptions;
+	    outputSchema: string;
 	    isDefault: number;
 	    // Go type: time
 	    createdAt: any;
@@ -442,6 +930,8 @@ export namespace models {
 	        this.id = source["id"];
 	        this.name = source["name"];
 	        this.content = source["content"];
+	        this.generationOptions = this.convertValues(source["generationOptions"], GenerationOptions);
+	        this.outputSchema = source["outputSchema"];
 	        this.isDefault = source["isDefault"];
 	        this.createdAt = this.convertValues(source["createdAt"], null);
 	    }
@@ -470,6 +960,8 @@ export namespace models {
 	    versionNo: number;
 	    name: string;
 	    content: string;
+	    generationOptions: GenerationOptions;
+	    outputSchema: string;
 	    // Go type: time
 	    createdAt: any;
 	
@@ -484,6 +976,8 @@ export namespace models {
 	        this.versionNo = source["versionNo"];
 	        this.name = source["name"];
 	        this.content = source["content"];
+	        this.generationOptions = this.convertValues(source["generationOptions"], GenerationOptions);
+	        this.outputSchema = source["outputSchema"];
 	        this.createdAt = this.convertValues(source["createdAt"], null);
 	    }
 	
@@ -546,6 +1040,9 @@ export namespace models {
 	    outputTokens: number;
 	    byRole: QARoleMetric[];
 	    failureTop: FailureReasonMetric[];
+	    costs: CostMetric[];
+	    costByDay: CostMetric[];
+	    costByRole: CostMetric[];
 	
 	    static createFrom(source: any = {}) {
 	        return new QADashboard(source);
@@ -563,6 +1060,9 @@ export namespace models {
 	        this.outputTokens = source["outputTokens"];
 	        this.byRole = this.convertValues(source["byRole"], QARoleMetric);
 	        this.failureTop = this.convertValues(source["failureTop"], FailureReasonMetric);
+	        this.costs = this.convertValues(source["costs"], CostMetric);
+	        this.costByDay = this.convertValues(source["costByDay"], CostMetric);
+	        this.costByRole = this.convertValues(source["costByRole"], CostMetric);
 	    }
 	
 		convertValues(a: any, classs: any, asMap: boolean = false): any {
@@ -586,9 +1086,14 @@ export namespace models {
 	export class QAEvidence {
 	    id: number;
 	    messageId: number;
+	    articleId: number;
+	    articleTitle: string;
 	    chunkIndex: number;
 	    quote: string;
 	    reason: string;
+	    headingPath: string;
+	    pageStart: number;
+	    pageEnd: number;
 	
 	    static createFrom(source: any = {}) {
 	        return new QAEvidence(source);
@@ -598,9 +1103,14 @@ export namespace models {
 	        if ('string' === typeof source) source = JSON.parse(source);
 	        this.id = source["id"];
 	        this.messageId = source["messageId"];
+	        this.articleId = source["articleId"];
+	        this.articleTitle = source["articleTitle"];
 	        this.chunkIndex = source["chunkIndex"];
 	        this.quote = source["quote"];
 	        this.reason = source["reason"];
+	        this.headingPath = source["headingPath"];
+	        this.pageStart = source["pageStart"];
+	        this.pageEnd = source["pageEnd"];
 	    }
 	}
 	export class QAMessage {
@@ -709,9 +1219,90 @@ export namespace models {
 		}
 	}
 	
+	export class QAModeratorConfig {
+	    enabled: number;
+	    roleId: number;
+	    prompt: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new QAModeratorConfig(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.enabled = source["enabled"];
+	        this.roleId = source["roleId"];
+	        this.prompt = source["prompt"];
+	    }
+	}
+	
+	export class QAScope {
+	    articleIds: Array<number>;
+	    tagIds: Array<number>;
+	    keyword: string;
+	    dateFrom: string;
+	    dateTo: string;
+	    watchStock: string;
+	    limit: number;
+	
+	    static createFrom(source: any = {}) {
+	        return new QAScope(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.articleIds = source["articleIds"];
+	        this.tagIds = source["tagIds"];
+	        this.keyword = source["keyword"];
+	        this.dateFrom = source["dateFrom"];
+	        this.dateTo = source["dateTo"];
+	        this.watchStock = source["watchStock"];
+	        this.limit = source["limit"];
+	    }
+	}
+	
+	export class QAScopeArticle {
+	    id: number;
+	    title: string;
+	    source: string;
+	    // Go type: time
+	    createdAt: any;
+	
+	    static createFrom(source: any = {}) {
+	        return new QAScopeArticle(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.id = source["id"];
+	        this.title = source["title"];
+	        this.source = source["source"];
+	        this.createdAt = this.convertValues(source["createdAt"], null);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	
 	export class QASession {
 	    id: number;
 	    articleId: number;
+	    scope: QAScope;
 	    title: string;
 	    summary: string;
 	    // Go type: time
@@ -727,6 +1318,7 @@ export namespace models {
 	        if ('string' === typeof source) source = JSON.parse(source);
 	        this.id = source["id"];
 	        this.articleId = source["articleId"];
+	        this.scope = this.convertValues(source["scope"], QAScope);
 	        this.title = source["title"];
 	        this.summary = source["summary"];
 	        this.createdAt = this.convertValues(source["createdAt"], null);
@@ -758,8 +1350,7 @@ export namespace models {
 	    domainTags: string;
 	    systemPrompt: string;
 	    modelOverride: string;
-	    temperature: number;
-	    maxTokens: number;
+	    generationOptions: GenerationOptions;
 	    enabled: number;
 	    isDefault: number;
 	    // Go type: time
@@ -779,8 +1370,7 @@ export namespace models {
 	        this.domainTags = source["domainTags"];
 	        this.systemPrompt = source["systemPrompt"];
 	        this.modelOverride = source["modelOverride"];
-	        this.temperature = source["temperature"];
-	        this.maxTokens = source["maxTokens"];
+	        this.generationOptions = this.convertValues(source["generationOptions"], GenerationOptions);
 	        this.enabled = source["enabled"];
 	        this.isDefault = source["isDefault"];
 	        this.createdAt = this.convertValues(source["createdAt"], null);
@@ -825,6 +1415,139 @@ export namespace models {
 	        this.systemPrompt = source["systemPrompt"];
 	    }
 	}
+	export class SearchHit {
+	    kind: string;
+	    articleId: number;
+	    sessionId: number;
+	    messageId: number;
+	    title: string;
+	    source: string;
+	    field: string;
+	    snippet: string;
+	    score: number;
+	    // Go type: time
+	    createdAt: any;
+	
+	    static createFrom(source: any = {}) {
+	        return new SearchHit(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.kind = source["kind"];
+	        this.articleId = source["articleId"];
+	        this.sessionId = source["sessionId"];
+	        this.messageId = source["messageId"];
+	        this.title = source["title"];
+	        this.source = source["source"];
+	        this.field = source["field"];
+	        this.snippet = source["snippet"];
+	        this.score = source["score"];
+	        this.createdAt = this.convertValues(source["createdAt"], null);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class StructuredAnalysis {
+	    articleId: number;
+	    summary: string;
+	    risks: string[];
+	    catalysts: string[];
+	    valuationView: string;
+	    payload: string;
+	    repaired: number;
+	    // Go type: time
+	    updatedAt: any;
+	
+	    static createFrom(source: any = {}) {
+	        return new StructuredAnalysis(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.articleId = source["articleId"];
+	        this.summary = source["summary"];
+	        this.risks = source["risks"];
+	        this.catalysts = source["catalysts"];
+	        this.valuationView = source["valuationView"];
+	        this.payload = source["payload"];
+	        this.repaired = source["repaired"];
+	        this.updatedAt = this.convertValues(source["updatedAt"], null);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
+	export class StructuredAnalysisHit {
+	    articleId: number;
+	    title: string;
+	    field: string;
+	    content: string;
+	    // Go type: time
+	    updatedAt: any;
+	
+	    static createFrom(source: any = {}) {
+	        return new StructuredAnalysisHit(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.articleId = source["articleId"];
+	        this.title = source["title"];
+	        this.field = source["field"];
+	        this.content = source["content"];
+	        this.updatedAt = this.convertValues(source["updatedAt"], null);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
 	
 	export class TelegraphWatchMatch {
 	    code: string;
@@ -894,6 +1617,40 @@ export namespace models {
 		    return a;
 		}
 	}
+	export class TelegraphArticlePage {
+	    items: TelegraphArticleItem[];
+	    total: number;
+	    nextCursor: string;
+	
+	    static createFrom(source: any = {}) {
+	        return new TelegraphArticlePage(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.items = this.convertValues(source["items"], TelegraphArticleItem);
+	        this.total = source["total"];
+	        this.nextCursor = source["nextCursor"];
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
 	export class TelegraphDashboard {
 	    totalRuns: number;
 	    totalFetched: number;
@@ -988,6 +1745,7 @@ export namespace models {
 	    fetchLimit: number;
 	    channelId: number;
 	    analysisPrompt: string;
+	    generationOptions: GenerationOptions;
 	
 	    static createFrom(source: any = {}) {
 	        return new TelegraphSchedulerConfig(source);
@@ -1001,7 +1759,26 @@ export namespace models {
 	        this.fetchLimit = source["fetchLimit"];
 	        this.channelId = source["channelId"];
 	        this.analysisPrompt = source["analysisPrompt"];
+	        this.generationOptions = this.convertValues(source["generationOptions"], GenerationOptions);
 	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
 	}
 	export class TelegraphSchedulerStatus {
 	    running: boolean;
@@ -1061,6 +1838,51 @@ export namespace models {
 	        this.aliases = source["aliases"];
 	    }
 	}
+	export class WatchedFile {
+	    path: string;
+	    fileHash: string;
+	    articleId: number;
+	    title: string;
+	    status: string;
+	    error: string;
+	    attempts: number;
+	    // Go type: time
+	    processedAt: any;
+	
+	    static createFrom(source: any = {}) {
+	        return new WatchedFile(source);
+	    }
+	
+	    constructor(source: any = {}) {
+	        if ('string' === typeof source) source = JSON.parse(source);
+	        this.path = source["path"];
+	        this.fileHash = source["fileHash"];
+	        this.articleId = source["articleId"];
+	        this.title = source["title"];
+	        this.status = source["status"];
+	        this.error = source["error"];
+	        this.attempts = source["attempts"];
+	        this.processedAt = this.convertValues(source["processedAt"], null);
+	    }
+	
+		convertValues(a: any, classs: any, asMap: boolean = false): any {
+		    if (!a) {
+		        return a;
+		    }
+		    if (a.slice && a.map) {
+		        return (a as any[]).map(elem => this.convertValues(elem, classs));
+		    } else if ("object" === typeof a) {
+		        if (asMap) {
+		            for (const key of Object.keys(a)) {
+		                a[key] = new classs(a[key]);
+		            }
+		            return a;
+		        }
+		        return new classs(a);
+		    }
+		    return a;
+		}
+	}
 
 }
 
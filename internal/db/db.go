@@ -9,32 +9,75 @@ import (
 	_ "modernc.org/sqlite"
 )
 
-var DB *sqlx.DB
+// Store is one opened and migrated database. Each App owns its own Store,
+// so several databases can be used side by side in one process.
+type Store struct {
+	DB *sqlx.DB
+	// Path is the database file, empty for an in-memory database.
+	Path string
+}
 
-func Init() error {
+// DefaultPath returns ~/.stock-report-analysis/data.db, creating the
+// directory if needed.
+func DefaultPath() (string, error) {
 	home, err := os.UserHomeDir()
 	if err != nil {
-		return err
+		return "", err
 	}
 	dir := filepath.Join(home, ".stock-report-analysis")
 	if err := os.MkdirAll(dir, 0755); err != nil {
-		return err
+		return "", err
 	}
+	return filepath.Join(dir, "data.db"), nil
+}
+
+// Open opens (creating if needed) and migrates the database file at path.
+// Pending migrations of an existing file are preceded by a backup next to it.
+func Open(path string) (*Store, error) {
+	return open(fmt.Sprintf("%s?_pragma=journal_mode(WAL)&_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)", path), path)
+}
+
+// OpenMemory opens an empty, migrated in-memory database. Its data lives as
+// long as the Store's single connection, i.e. until Close.
+func OpenMemory() (*Store, error) {
+	return open(":memory:?_pragma=foreign_keys(1)", "")
+}
 
-	dsn := fmt.Sprintf("%s?_pragma=journal_mode(WAL)&_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)", filepath.Join(dir, "data.db"))
-	DB, err = sqlx.Open("sqlite", dsn)
+func open(dsn, path string) (*Store, error) {
+	conn, err := sqlx.Open("sqlite", dsn)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	DB.SetMaxOpenConns(1)
-	if err := DB.Ping(); err != nil {
-		return err
+	conn.SetMaxOpenConns(1)
+	conn.SetMaxIdleConns(1)
+	if err := conn.Ping(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if err := migrate(conn, path); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &Store{DB: conn, Path: path}, nil
+}
+
+// Dir is the directory holding the database file, where other per-database
+// data such as parse caches lives. It is empty for an in-memory database.
+func (s *Store) Dir() string {
+	if s.Path == "" {
+		return ""
 	}
+	return filepath.Dir(s.Path)
+}
 
-	return migrate()
+func (s *Store) Close() error {
+	return s.DB.Close()
 }
 
-func migrate() error {
+// migrateBaseline is migration 1: the schema as it stood before versioned
+// migrations. It is idempotent so databases created by older builds, which
+// have no schema_migrations rows, are brought up to date by it too.
+func migrateBaseline(tx *sqlx.Tx) error {
 	schema := `
 	CREATE TABLE IF NOT EXISTS ai_channels (
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
@@ -42,6 +85,17 @@ func migrate() error {
 		base_url TEXT NOT NULL,
 		api_key TEXT NOT NULL,
 		model TEXT NOT NULL,
+		provider TEXT DEFAULT 'openai',
+		max_retries INTEGER DEFAULT 2,
+		retry_backoff_ms INTEGER DEFAULT 1000,
+		rpm_limit INTEGER DEFAULT 0,
+		tpm_limit INTEGER DEFAULT 0,
+		max_in_flight INTEGER DEFAULT 0,
+		context_window INTEGER DEFAULT 0,
+		store_reasoning INTEGER DEFAULT 0,
+		input_price REAL DEFAULT 0,
+		output_price REAL DEFAULT 0,
+		currency TEXT DEFAULT 'CNY',
 		is_default INTEGER DEFAULT 0,
 		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
 	);
@@ -49,6 +103,8 @@ func migrate() error {
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
 		name TEXT NOT NULL,
 		content TEXT NOT NULL,
+		generation_options TEXT DEFAULT '',
+		output_schema TEXT DEFAULT '',
 		is_default INTEGER DEFAULT 0,
 		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
 	);
@@ -58,6 +114,8 @@ func migrate() error {
 		version_no INTEGER NOT NULL,
 		name TEXT NOT NULL,
 		content TEXT NOT NULL,
+		generation_options TEXT DEFAULT '',
+		output_schema TEXT DEFAULT '',
 		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 		UNIQUE(prompt_id, version_no)
 	);
@@ -91,6 +149,7 @@ func migrate() error {
 		analysis TEXT NOT NULL,
 		prompt_used TEXT DEFAULT '',
 		channel_used TEXT DEFAULT '',
+		reasoning TEXT DEFAULT '',
 		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
 	);
 	CREATE TABLE IF NOT EXISTS analysis_runs (
@@ -101,14 +160,31 @@ func migrate() error {
 		prompt_id INTEGER NOT NULL,
 		prompt_name TEXT NOT NULL,
 		mode TEXT DEFAULT 'text',
+		attempt INTEGER DEFAULT 1,
 		success INTEGER NOT NULL,
 		error_reason TEXT DEFAULT '',
 		duration_ms INTEGER DEFAULT 0,
 		prompt_tokens INTEGER DEFAULT 0,
 		completion_tokens INTEGER DEFAULT 0,
 		total_tokens INTEGER DEFAULT 0,
+		generation_options TEXT DEFAULT '',
+		cache_hit INTEGER DEFAULT 0,
+		cost REAL DEFAULT 0,
+		currency TEXT DEFAULT '',
 		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
 	);
+	CREATE TABLE IF NOT EXISTS ai_response_cache (
+		cache_key TEXT PRIMARY KEY,
+		model TEXT NOT NULL DEFAULT '',
+		text TEXT NOT NULL DEFAULT '',
+		reasoning TEXT DEFAULT '',
+		prompt_tokens INTEGER DEFAULT 0,
+		completion_tokens INTEGER DEFAULT 0,
+		total_tokens INTEGER DEFAULT 0,
+		hit_count INTEGER DEFAULT 0,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		last_hit_at DATETIME
+	);
 	CREATE TABLE IF NOT EXISTS app_configs (
 		key TEXT PRIMARY KEY,
 		value TEXT NOT NULL,
@@ -181,6 +257,9 @@ func migrate() error {
 		prompt_tokens INTEGER DEFAULT 0,
 		completion_tokens INTEGER DEFAULT 0,
 		total_tokens INTEGER DEFAULT 0,
+		generation_options TEXT DEFAULT '',
+		cost REAL DEFAULT 0,
+		currency TEXT DEFAULT '',
 		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
 	);
 	CREATE TABLE IF NOT EXISTS telegraph_ingests (
@@ -226,12 +305,28 @@ func migrate() error {
 		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 		PRIMARY KEY(article_id, stock_code)
 	);
+	CREATE TABLE IF NOT EXISTS structured_analyses (
+		article_id INTEGER PRIMARY KEY REFERENCES articles(id) ON DELETE CASCADE,
+		summary TEXT NOT NULL DEFAULT '',
+		valuation_view TEXT DEFAULT '',
+		payload TEXT DEFAULT '',
+		repaired INTEGER DEFAULT 0,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE TABLE IF NOT EXISTS structured_analysis_items (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		article_id INTEGER NOT NULL REFERENCES structured_analyses(article_id) ON DELETE CASCADE,
+		kind TEXT NOT NULL,
+		position INTEGER NOT NULL,
+		content TEXT NOT NULL
+	);
 	CREATE INDEX IF NOT EXISTS idx_article_tags_article_id ON article_tags(article_id);
 	CREATE INDEX IF NOT EXISTS idx_article_tags_tag_id ON article_tags(tag_id);
 	CREATE INDEX IF NOT EXISTS idx_analysis_history_article_id ON analysis_history(article_id);
 	CREATE INDEX IF NOT EXISTS idx_analysis_runs_created_at ON analysis_runs(created_at);
 	CREATE INDEX IF NOT EXISTS idx_analysis_runs_channel_id ON analysis_runs(channel_id);
 	CREATE INDEX IF NOT EXISTS idx_analysis_runs_success ON analysis_runs(success);
+	CREATE INDEX IF NOT EXISTS idx_ai_response_cache_created_at ON ai_response_cache(created_at);
 	CREATE INDEX IF NOT EXISTS idx_prompt_versions_prompt_id ON prompt_versions(prompt_id);
 	CREATE INDEX IF NOT EXISTS idx_roles_enabled_default ON roles(enabled, is_default);
 	CREATE INDEX IF NOT EXISTS idx_qa_sessions_article_id ON qa_sessions(article_id);
@@ -250,6 +345,8 @@ func migrate() error {
 	CREATE INDEX IF NOT EXISTS idx_telegraph_digests_slot_end ON telegraph_digests(slot_end);
 	CREATE INDEX IF NOT EXISTS idx_telegraph_watch_hits_code ON telegraph_watch_hits(stock_code);
 	CREATE INDEX IF NOT EXISTS idx_telegraph_watch_hits_article_id ON telegraph_watch_hits(article_id);
+	CREATE INDEX IF NOT EXISTS idx_structured_items_article ON structured_analysis_items(article_id, kind, position);
+	CREATE INDEX IF NOT EXISTS idx_structured_items_kind ON structured_analysis_items(kind);
 	INSERT INTO prompt_versions(prompt_id, version_no, name, content)
 	SELECT p.id, 1, p.name, p.content
 	FROM prompts p
@@ -274,6 +371,59 @@ func migrate() error {
 		SELECT id FROM roles WHERE enabled = 1 ORDER BY is_default DESC, id ASC LIMIT 1
 	)
 	AND NOT EXISTS (SELECT 1 FROM roles WHERE enabled = 1 AND is_default = 1);`
-	_, err := DB.Exec(schema)
-	return err
+	if _, err := tx.Exec(schema); err != nil {
+		return err
+	}
+	return ensureColumns(tx)
+}
+
+// columnPatches lists the columns older builds added to existing tables
+// through ALTER TABLE. It is frozen: new columns are added by a numbered
+// migration instead.
+var columnPatches = []struct {
+	table  string
+	column string
+	ddl    string
+}{
+	{"ai_channels", "provider", "TEXT DEFAULT 'openai'"},
+	{"prompts", "generation_options", "TEXT DEFAULT ''"},
+	{"prompt_versions", "generation_options", "TEXT DEFAULT ''"},
+	{"analysis_runs", "generation_options", "TEXT DEFAULT ''"},
+	{"qa_runs", "generation_options", "TEXT DEFAULT ''"},
+	{"ai_channels", "max_retries", "INTEGER DEFAULT 2"},
+	{"ai_channels", "retry_backoff_ms", "INTEGER DEFAULT 1000"},
+	{"analysis_runs", "attempt", "INTEGER DEFAULT 1"},
+	{"ai_channels", "rpm_limit", "INTEGER DEFAULT 0"},
+	{"ai_channels", "tpm_limit", "INTEGER DEFAULT 0"},
+	{"ai_channels", "max_in_flight", "INTEGER DEFAULT 0"},
+	{"prompts", "output_schema", "TEXT DEFAULT ''"},
+	{"prompt_versions", "output_schema", "TEXT DEFAULT ''"},
+	{"structured_analyses", "payload", "TEXT DEFAULT ''"},
+	{"ai_channels", "store_reasoning", "INTEGER DEFAULT 0"},
+	{"analysis_history", "reasoning", "TEXT DEFAULT ''"},
+	{"ai_channels", "context_window", "INTEGER DEFAULT 0"},
+	{"analysis_runs", "cache_hit", "INTEGER DEFAULT 0"},
+	{"ai_channels", "input_price", "REAL DEFAULT 0"},
+	{"ai_channels", "output_price", "REAL DEFAULT 0"},
+	{"ai_channels", "currency", "TEXT DEFAULT 'CNY'"},
+	{"analysis_runs", "cost", "REAL DEFAULT 0"},
+	{"analysis_runs", "currency", "TEXT DEFAULT ''"},
+	{"qa_runs", "cost", "REAL DEFAULT 0"},
+	{"qa_runs", "currency", "TEXT DEFAULT ''"},
+}
+
+func ensureColumns(tx *sqlx.Tx) error {
+	for _, p := range columnPatches {
+		var n int
+		if err := tx.Get(&n, "SELECT COUNT(*) FROM pragma_table_info(?) WHERE name=?", p.table, p.column); err != nil {
+			return err
+		}
+		if n > 0 {
+			continue
+		}
+		if _, err := tx.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", p.table, p.column, p.ddl)); err != nil {
+			return fmt.Errorf("add column %s.%s: %w", p.table, p.column, err)
+		}
+	}
+	return nil
 }
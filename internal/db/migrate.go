@@ -0,0 +1,178 @@
+package db
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// keepBackups is how many pre-migration backups are kept per database file.
+const keepBackups = 3
+
+// migration is one numbered schema change. It runs in its own transaction
+// together with its schema_migrations row, so a failed migration leaves the
+// database at the previous version.
+//
+// SQLite can only change constraints by rebuilding a table. Such migrations
+// set rebuild: foreign keys are switched off around the transaction (a DROP
+// TABLE would otherwise cascade) and checked before commit.
+type migration struct {
+	version int
+	name    string
+	rebuild bool
+	up      func(tx *sqlx.Tx) error
+}
+
+// LatestVersion is the schema version this build writes.
+func LatestVersion() int {
+	return migrations[len(migrations)-1].version
+}
+
+// SchemaVersion returns the highest migration applied to the database.
+func (s *Store) SchemaVersion() (int, error) {
+	return schemaVersion(s.DB)
+}
+
+func schemaVersion(db *sqlx.DB) (int, error) {
+	var version int
+	err := db.Get(&version, "SELECT COALESCE(MAX(version), 0) FROM schema_migrations")
+	return version, err
+}
+
+// migrate applies the pending migrations in order. A database written by a
+// newer build is refused rather than opened with a schema this build does
+// not know. backupPath is the database file; when set and the database
+// already holds data, it is copied before the first pending migration.
+func migrate(db *sqlx.DB, backupPath string) error {
+	if _, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		)
+	`); err != nil {
+		return err
+	}
+
+	current, err := schemaVersion(db)
+	if err != nil {
+		return err
+	}
+	latest := LatestVersion()
+	if current > latest {
+		return fmt.Errorf("数据库版本 v%d 高于当前程序支持的 v%d，请升级程序后再打开", current, latest)
+	}
+	if current == latest {
+		return nil
+	}
+
+	if backupPath != "" {
+		hasData, err := hasUserTables(db)
+		if err != nil {
+			return err
+		}
+		if hasData {
+			target, err := backupDatabase(db, backupPath, current)
+			if err != nil {
+				return fmt.Errorf("迁移前备份数据库失败: %w", err)
+			}
+			log.Printf("[DB] backup before migrating v%d -> v%d: %s", current, latest, target)
+		}
+	}
+
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+		if err := applyMigration(db, m); err != nil {
+			return fmt.Errorf("数据库迁移 v%d（%s）失败: %w", m.version, m.name, err)
+		}
+		log.Printf("[DB] migrated to v%d (%s)", m.version, m.name)
+	}
+	return nil
+}
+
+func applyMigration(db *sqlx.DB, m migration) (err error) {
+	if m.rebuild {
+		// The pragma is a no-op inside a transaction, so it is set on the
+		// (single) connection before the transaction starts.
+		if _, err := db.Exec("PRAGMA foreign_keys=OFF"); err != nil {
+			return err
+		}
+		defer func() {
+			if _, restoreErr := db.Exec("PRAGMA foreign_keys=ON"); restoreErr != nil && err == nil {
+				err = restoreErr
+			}
+		}()
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := m.up(tx); err != nil {
+		return err
+	}
+	if m.rebuild {
+		var violations int
+		if err := tx.Get(&violations, "SELECT COUNT(*) FROM pragma_foreign_key_check"); err != nil {
+			return err
+		}
+		if violations > 0 {
+			return fmt.Errorf("重建后有 %d 条外键约束不满足", violations)
+		}
+	}
+	if _, err := tx.Exec("INSERT INTO schema_migrations(version, name) VALUES(?, ?)", m.version, m.name); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func hasUserTables(db *sqlx.DB) (bool, error) {
+	var n int
+	err := db.Get(&n, `
+		SELECT COUNT(*) FROM sqlite_master
+		WHERE type='table' AND name <> 'schema_migrations' AND name NOT LIKE 'sqlite_%'
+	`)
+	return n > 0, err
+}
+
+// backupDatabase writes a consistent copy of the database (WAL included)
+// next to path and prunes all but the newest keepBackups copies.
+func backupDatabase(db *sqlx.DB, path string, version int) (string, error) {
+	target := fmt.Sprintf("%s.v%d-%s.bak", path, version, time.Now().Format("20060102-150405"))
+	if _, err := db.Exec("VACUUM INTO ?", target); err != nil {
+		return "", err
+	}
+
+	backups, err := filepath.Glob(path + ".v*.bak")
+	if err != nil {
+		return target, nil
+	}
+	// Sort by modification time: version numbers in the names do not sort
+	// lexically once they reach two digits.
+	sort.Slice(backups, func(i, j int) bool {
+		return modTime(backups[i]).After(modTime(backups[j]))
+	})
+	for _, old := range backups[min(len(backups), keepBackups):] {
+		if err := os.Remove(old); err != nil {
+			log.Printf("[DB] remove old backup %s failed: %s", old, err.Error())
+		}
+	}
+	return target, nil
+}
+
+func modTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
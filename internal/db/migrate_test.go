@@ -0,0 +1,241 @@
+package db
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+)
+
+func TestOpenAppliesMigrationsOnce(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.db")
+	store, err := Open(path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	version, err := store.SchemaVersion()
+	if err != nil || version != LatestVersion() {
+		t.Fatalf("version = %d, err = %v", version, err)
+	}
+	store.Close()
+
+	// A fresh file needs no backup, and reopening applies nothing.
+	store, err = Open(path)
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer store.Close()
+	var applied int
+	if err := store.DB.Get(&applied, "SELECT COUNT(*) FROM schema_migrations"); err != nil || applied != len(migrations) {
+		t.Errorf("applied = %d, err = %v", applied, err)
+	}
+	if backups, _ := filepath.Glob(path + ".v*.bak"); len(backups) != 0 {
+		t.Errorf("backups = %v", backups)
+	}
+}
+
+func TestOpenBacksUpPreMigrationDatabase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.db")
+	// A database from a build without schema_migrations.
+	legacy, err := sqlx.Open("sqlite", path)
+	if err != nil {
+		t.Fatalf("open legacy: %v", err)
+	}
+	legacy.MustExec(`
+		CREATE TABLE ai_channels (id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT NOT NULL, base_url TEXT NOT NULL, api_key TEXT NOT NULL, model TEXT NOT NULL, is_default INTEGER DEFAULT 0);
+		INSERT INTO ai_channels(name, base_url, api_key, model) VALUES('旧渠道', 'http://x', 'k', 'm');
+	`)
+	legacy.Close()
+
+	store, err := Open(path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer store.Close()
+
+	var provider string
+	if err := store.DB.Get(&provider, "SELECT provider FROM ai_channels WHERE name='旧渠道'"); err != nil || provider != "openai" {
+		t.Errorf("provider = %q, err = %v", provider, err)
+	}
+	backups, _ := filepath.Glob(path + ".v0-*.bak")
+	if len(backups) != 1 {
+		t.Fatalf("backups = %v", backups)
+	}
+	backup, err := sqlx.Open("sqlite", backups[0])
+	if err != nil {
+		t.Fatalf("open backup: %v", err)
+	}
+	defer backup.Close()
+	var n int
+	if err := backup.Get(&n, "SELECT COUNT(*) FROM ai_channels"); err != nil || n != 1 {
+		t.Errorf("backup channels = %d, err = %v", n, err)
+	}
+}
+
+func TestOpenRefusesNewerDatabase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.db")
+	store, err := Open(path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	store.DB.MustExec("INSERT INTO schema_migrations(version, name) VALUES(?, 'future')", LatestVersion()+1)
+	store.Close()
+
+	if _, err := Open(path); err == nil || !strings.Contains(err.Error(), "高于当前程序") {
+		t.Fatalf("err = %v, want newer-schema error", err)
+	}
+}
+
+func TestFailedMigrationRollsBack(t *testing.T) {
+	store, err := OpenMemory()
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer store.Close()
+
+	bad := migration{version: LatestVersion() + 1, name: "bad", up: func(tx *sqlx.Tx) error {
+		if _, err := tx.Exec("ALTER TABLE articles ADD COLUMN scratch TEXT"); err != nil {
+			return err
+		}
+		_, err := tx.Exec("SELECT * FROM missing_table")
+		return err
+	}}
+	if err := applyMigration(store.DB, bad); err == nil {
+		t.Fatal("want error")
+	}
+	var n int
+	if err := store.DB.Get(&n, "SELECT COUNT(*) FROM pragma_table_info('articles') WHERE name='scratch'"); err != nil || n != 0 {
+		t.Errorf("scratch column survived rollback: n = %d, err = %v", n, err)
+	}
+	if version, _ := store.SchemaVersion(); version != LatestVersion() {
+		t.Errorf("version = %d", version)
+	}
+}
+
+func TestRebuildMigrationKeepsReferencingRows(t *testing.T) {
+	store, err := OpenMemory()
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer store.Close()
+	store.DB.MustExec("INSERT INTO tags(name) VALUES('t')")
+	store.DB.MustExec("INSERT INTO articles(title, content) VALUES('a', 'c')")
+	store.DB.MustExec("INSERT INTO article_tags(article_id, tag_id) VALUES(1, 1)")
+
+	rebuild := migration{version: LatestVersion() + 1, name: "rebuild tags", rebuild: true, up: func(tx *sqlx.Tx) error {
+		_, err := tx.Exec(`
+			CREATE TABLE tags_new (id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT NOT NULL UNIQUE, color TEXT DEFAULT '#6b7280');
+			INSERT INTO tags_new(id, name, color) SELECT id, name, color FROM tags;
+			DROP TABLE tags;
+			ALTER TABLE tags_new RENAME TO tags;
+		`)
+		return err
+	}}
+	if err := applyMigration(store.DB, rebuild); err != nil {
+		t.Fatalf("rebuild: %v", err)
+	}
+	var links, fk int
+	if err := store.DB.Get(&links, "SELECT COUNT(*) FROM article_tags"); err != nil || links != 1 {
+		t.Errorf("article_tags = %d, err = %v", links, err)
+	}
+	if err := store.DB.Get(&fk, "PRAGMA foreign_keys"); err != nil || fk != 1 {
+		t.Errorf("foreign_keys = %d, err = %v", fk, err)
+	}
+}
+
+func TestQASessionScopesMigrationKeepsHistory(t *testing.T) {
+	conn, err := sqlx.Open("sqlite", ":memory:?_pragma=foreign_keys(1)")
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer conn.Close()
+	conn.SetMaxOpenConns(1)
+	conn.MustExec("CREATE TABLE schema_migrations (version INTEGER PRIMARY KEY, name TEXT NOT NULL, applied_at DATETIME DEFAULT CURRENT_TIMESTAMP)")
+	var scopes migration
+	for _, m := range migrations {
+		if m.name == "qa_session_scopes" {
+			scopes = m
+			break
+		}
+		if err := applyMigration(conn, m); err != nil {
+			t.Fatalf("v%d: %v", m.version, err)
+		}
+	}
+	conn.MustExec(`
+		INSERT INTO articles(title, content) VALUES('a', 'c');
+		INSERT INTO roles(name, system_prompt) VALUES('r', 'p');
+		INSERT INTO qa_sessions(article_id, title) VALUES(1, 's');
+		INSERT INTO qa_messages(session_id, article_id, role_type, content) VALUES(1, 1, 'assistant', '海外产能爬坡');
+		INSERT INTO qa_evidences(message_id, chunk_index, quote) VALUES(1, 2, 'q');
+		INSERT INTO qa_pins(session_id, article_id, content) VALUES(1, 1, 'pin');
+		INSERT INTO qa_runs(session_id, message_id, article_id, role_id, role_name, success) VALUES(1, 1, 1, 1, 'r', 1);
+	`)
+
+	if err := applyMigration(conn, scopes); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	var evidenceArticle, hits int
+	if err := conn.Get(&evidenceArticle, "SELECT article_id FROM qa_evidences"); err != nil || evidenceArticle != 1 {
+		t.Errorf("evidence article = %d, err = %v", evidenceArticle, err)
+	}
+	if err := conn.Get(&hits, "SELECT COUNT(*) FROM qa_messages_fts WHERE qa_messages_fts MATCH '海外产能'"); err != nil || hits != 1 {
+		t.Errorf("fts hits = %d, err = %v", hits, err)
+	}
+
+	// Scoped sessions own rows without an article, and deleting an article
+	// still removes its own sessions.
+	conn.MustExec(`
+		INSERT INTO qa_sessions(scope, title) VALUES('{"tagIds":[1]}', 'scoped');
+		INSERT INTO qa_messages(session_id, role_type, content) VALUES(2, 'user', '出海进展');
+		DELETE FROM articles WHERE id=1;
+	`)
+	var sessions, runs int
+	if err := conn.Get(&sessions, "SELECT COUNT(*) FROM qa_sessions"); err != nil || sessions != 1 {
+		t.Errorf("sessions = %d, err = %v", sessions, err)
+	}
+	if err := conn.Get(&runs, "SELECT COUNT(*) FROM qa_runs"); err != nil || runs != 0 {
+		t.Errorf("runs = %d, err = %v", runs, err)
+	}
+	if err := conn.Get(&hits, "SELECT COUNT(*) FROM qa_messages_fts WHERE qa_messages_fts MATCH '出海进展'"); err != nil || hits != 1 {
+		t.Errorf("scoped fts hits = %d, err = %v", hits, err)
+	}
+}
+
+func TestRoleGenerationOptionsMigration(t *testing.T) {
+	conn, err := sqlx.Open("sqlite", ":memory:?_pragma=foreign_keys(1)")
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer conn.Close()
+	conn.SetMaxOpenConns(1)
+	conn.MustExec("CREATE TABLE schema_migrations (version INTEGER PRIMARY KEY, name TEXT NOT NULL, applied_at DATETIME DEFAULT CURRENT_TIMESTAMP)")
+	var options migration
+	for _, m := range migrations {
+		if m.name == "role_generation_options" {
+			options = m
+			break
+		}
+		if err := applyMigration(conn, m); err != nil {
+			t.Fatalf("v%d: %v", m.version, err)
+		}
+	}
+	conn.MustExec(`
+		INSERT INTO roles(name, system_prompt, temperature, max_tokens) VALUES('a', 'p', 0.7, 800);
+		INSERT INTO roles(name, system_prompt, temperature, max_tokens) VALUES('b', 'p', 0, 0);
+	`)
+
+	if err := applyMigration(conn, options); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	var got []string
+	if err := conn.Select(&got, "SELECT generation_options FROM roles WHERE name IN ('a', 'b') ORDER BY id"); err != nil {
+		t.Fatalf("roles: %v", err)
+	}
+	if len(got) != 2 || got[0] != `{"temperature":0.7,"maxTokens":800}` || got[1] != "" {
+		t.Errorf("generation options = %q", got)
+	}
+	if _, err := conn.Exec("SELECT temperature FROM roles"); err == nil {
+		t.Error("temperature column kept")
+	}
+}
@@ -0,0 +1,289 @@
+package db
+
+import "github.com/jmoiron/sqlx"
+
+// migrations is append-only: a released migration is never edited or
+// renumbered, a fix ships as a new one.
+var migrations = []migration{
+	{version: 1, name: "baseline", up: migrateBaseline},
+	{version: 2, name: "fulltext_search", up: migrateFullTextSearch},
+	{version: 3, name: "article_source_index", up: migrateArticleSourceIndex},
+	{version: 4, name: "article_fingerprints", up: migrateArticleFingerprints},
+	{version: 5, name: "watched_files", up: migrateWatchedFiles},
+	{version: 6, name: "article_assets", up: migrateArticleAssets},
+	{version: 7, name: "article_chunks", up: migrateArticleChunks},
+	{version: 8, name: "article_chunk_terms", up: migrateArticleChunkTerms},
+	{version: 9, name: "chunk_embeddings", up: migrateChunkEmbeddings},
+	{version: 10, name: "qa_session_scopes", rebuild: true, up: migrateQASessionScopes},
+	{version: 11, name: "role_generation_options", up: migrateRoleGenerationOptions},
+}
+
+// migrateArticleSourceIndex indexes articles.source, which URL imports
+// look up to detect pages imported before.
+func migrateArticleSourceIndex(tx *sqlx.Tx) error {
+	_, err := tx.Exec("CREATE INDEX IF NOT EXISTS idx_articles_source ON articles(source)")
+	return err
+}
+
+// migrateFullTextSearch indexes articles (title, content, analysis) and QA
+// messages with FTS5. The trigram tokenizer needs no word segmentation, so
+// Chinese text is searchable as is. The indexes are external-content
+// tables kept in sync by triggers.
+func migrateFullTextSearch(tx *sqlx.Tx) error {
+	_, err := tx.Exec(`
+	CREATE VIRTUAL TABLE articles_fts USING fts5(
+		title, content, analysis,
+		content='articles', content_rowid='id', tokenize='trigram'
+	);
+	CREATE TRIGGER articles_fts_insert AFTER INSERT ON articles BEGIN
+		INSERT INTO articles_fts(rowid, title, content, analysis)
+		VALUES (new.id, new.title, new.content, new.analysis);
+	END;
+	CREATE TRIGGER articles_fts_delete AFTER DELETE ON articles BEGIN
+		INSERT INTO articles_fts(articles_fts, rowid, title, content, analysis)
+		VALUES ('delete', old.id, old.title, old.content, old.analysis);
+	END;
+	CREATE TRIGGER articles_fts_update AFTER UPDATE OF title, content, analysis ON articles BEGIN
+		INSERT INTO articles_fts(articles_fts, rowid, title, content, analysis)
+		VALUES ('delete', old.id, old.title, old.content, old.analysis);
+		INSERT INTO articles_fts(rowid, title, content, analysis)
+		VALUES (new.id, new.title, new.content, new.analysis);
+	END;
+	INSERT INTO articles_fts(articles_fts) VALUES ('rebuild');
+
+	CREATE VIRTUAL TABLE qa_messages_fts USING fts5(
+		content,
+		content='qa_messages', content_rowid='id', tokenize='trigram'
+	);
+	CREATE TRIGGER qa_messages_fts_insert AFTER INSERT ON qa_messages BEGIN
+		INSERT INTO qa_messages_fts(rowid, content) VALUES (new.id, new.content);
+	END;
+	CREATE TRIGGER qa_messages_fts_delete AFTER DELETE ON qa_messages BEGIN
+		INSERT INTO qa_messages_fts(qa_messages_fts, rowid, content) VALUES ('delete', old.id, old.content);
+	END;
+	CREATE TRIGGER qa_messages_fts_update AFTER UPDATE OF content ON qa_messages BEGIN
+		INSERT INTO qa_messages_fts(qa_messages_fts, rowid, content) VALUES ('delete', old.id, old.content);
+		INSERT INTO qa_messages_fts(rowid, content) VALUES (new.id, new.content);
+	END;
+	INSERT INTO qa_messages_fts(qa_messages_fts) VALUES ('rebuild');`)
+	return err
+}
+
+// migrateArticleFingerprints adds the hashes import deduplication compares.
+// Existing rows keep empty hashes; the service fills them in on first use.
+func migrateArticleFingerprints(tx *sqlx.Tx) error {
+	_, err := tx.Exec(`
+	ALTER TABLE articles ADD COLUMN content_hash TEXT DEFAULT '';
+	ALTER TABLE articles ADD COLUMN file_hash TEXT DEFAULT '';
+	ALTER TABLE articles ADD COLUMN simhash INTEGER DEFAULT 0;
+	CREATE INDEX idx_articles_content_hash ON articles(content_hash);
+	CREATE INDEX idx_articles_file_hash ON articles(file_hash);`)
+	return err
+}
+
+// migrateWatchedFiles records the files the folder watch has processed.
+// size and mod_time (unix nanoseconds) let a scan skip unchanged files
+// without hashing them.
+func migrateWatchedFiles(tx *sqlx.Tx) error {
+	_, err := tx.Exec(`
+	CREATE TABLE watched_files (
+		path TEXT PRIMARY KEY,
+		file_hash TEXT NOT NULL,
+		size INTEGER DEFAULT 0,
+		mod_time INTEGER DEFAULT 0,
+		article_id INTEGER DEFAULT 0,
+		status TEXT NOT NULL,
+		error TEXT DEFAULT '',
+		attempts INTEGER DEFAULT 0,
+		processed_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE INDEX idx_watched_files_hash ON watched_files(file_hash);`)
+	return err
+}
+
+// migrateArticleAssets links articles to the images and tables of their
+// MinerU parse, which stays cached under the file hash.
+func migrateArticleAssets(tx *sqlx.Tx) error {
+	_, err := tx.Exec(`
+	CREATE TABLE article_assets (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		article_id INTEGER NOT NULL REFERENCES articles(id) ON DELETE CASCADE,
+		file_hash TEXT NOT NULL,
+		kind TEXT NOT NULL,
+		path TEXT DEFAULT '',
+		caption TEXT DEFAULT '',
+		html TEXT DEFAULT '',
+		page INTEGER DEFAULT 0
+	);
+	CREATE INDEX idx_article_assets_article ON article_assets(article_id);`)
+	return err
+}
+
+// migrateArticleChunks stores the sections QA retrieves from, with the
+// pages and headings they come from, and records both on QA evidence so an
+// answer can be traced back to the source document.
+func migrateArticleChunks(tx *sqlx.Tx) error {
+	_, err := tx.Exec(`
+	CREATE TABLE article_chunks (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		article_id INTEGER NOT NULL REFERENCES articles(id) ON DELETE CASCADE,
+		chunk_index INTEGER NOT NULL,
+		heading_path TEXT DEFAULT '',
+		page_start INTEGER DEFAULT 0,
+		page_end INTEGER DEFAULT 0,
+		text TEXT NOT NULL
+	);
+	CREATE UNIQUE INDEX idx_article_chunks_article ON article_chunks(article_id, chunk_index);
+	ALTER TABLE qa_evidences ADD COLUMN heading_path TEXT DEFAULT '';
+	ALTER TABLE qa_evidences ADD COLUMN page_start INTEGER DEFAULT 0;
+	ALTER TABLE qa_evidences ADD COLUMN page_end INTEGER DEFAULT 0;`)
+	return err
+}
+
+// migrateArticleChunkTerms adds the BM25 term counts of each section.
+// Sections stored before get them on their article's next question.
+func migrateArticleChunkTerms(tx *sqlx.Tx) error {
+	_, err := tx.Exec(`
+	ALTER TABLE article_chunks ADD COLUMN terms TEXT DEFAULT '';
+	ALTER TABLE article_chunks ADD COLUMN term_count INTEGER DEFAULT 0;`)
+	return err
+}
+
+// migrateChunkEmbeddings adds the embedding model of a channel and stores
+// one vector per section and model, as little-endian float32s scaled to
+// unit length.
+func migrateChunkEmbeddings(tx *sqlx.Tx) error {
+	_, err := tx.Exec(`
+	ALTER TABLE ai_channels ADD COLUMN embedding_model TEXT DEFAULT '';
+	CREATE TABLE chunk_embeddings (
+		chunk_id INTEGER NOT NULL REFERENCES article_chunks(id) ON DELETE CASCADE,
+		model TEXT NOT NULL,
+		dims INTEGER NOT NULL,
+		vector BLOB NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (chunk_id, model)
+	);`)
+	return err
+}
+
+// migrateQASessionScopes lets a QA session ask across a set of articles.
+// Such a session stores its scope as JSON and belongs to no single article,
+// so article_id becomes nullable on the session and the rows it owns; the
+// tables are rebuilt because SQLite cannot drop NOT NULL. Evidence records
+// the article it quotes, filled in from its message for existing rows.
+func migrateQASessionScopes(tx *sqlx.Tx) error {
+	_, err := tx.Exec(`
+	CREATE TABLE qa_sessions_new (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		article_id INTEGER REFERENCES articles(id) ON DELETE CASCADE,
+		scope TEXT DEFAULT '',
+		title TEXT DEFAULT '',
+		summary TEXT DEFAULT '',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	INSERT INTO qa_sessions_new(id, article_id, title, summary, created_at, updated_at)
+	SELECT id, article_id, title, summary, created_at, updated_at FROM qa_sessions;
+	DROP TABLE qa_sessions;
+	ALTER TABLE qa_sessions_new RENAME TO qa_sessions;
+	CREATE INDEX idx_qa_sessions_article_id ON qa_sessions(article_id);
+
+	CREATE TABLE qa_pins_new (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		session_id INTEGER NOT NULL REFERENCES qa_sessions(id) ON DELETE CASCADE,
+		article_id INTEGER REFERENCES articles(id) ON DELETE CASCADE,
+		source_message_id INTEGER DEFAULT 0,
+		content TEXT NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	INSERT INTO qa_pins_new(id, session_id, article_id, source_message_id, content, created_at, updated_at)
+	SELECT id, session_id, article_id, source_message_id, content, created_at, updated_at FROM qa_pins;
+	DROP TABLE qa_pins;
+	ALTER TABLE qa_pins_new RENAME TO qa_pins;
+	CREATE INDEX idx_qa_pins_session_id ON qa_pins(session_id);
+
+	CREATE TABLE qa_messages_new (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		session_id INTEGER NOT NULL REFERENCES qa_sessions(id) ON DELETE CASCADE,
+		article_id INTEGER REFERENCES articles(id) ON DELETE CASCADE,
+		parent_id INTEGER DEFAULT 0,
+		role_type TEXT NOT NULL,
+		role_id INTEGER DEFAULT 0,
+		content TEXT NOT NULL,
+		status TEXT DEFAULT 'done',
+		error_reason TEXT DEFAULT '',
+		duration_ms INTEGER DEFAULT 0,
+		prompt_tokens INTEGER DEFAULT 0,
+		completion_tokens INTEGER DEFAULT 0,
+		total_tokens INTEGER DEFAULT 0,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	INSERT INTO qa_messages_new(id, session_id, article_id, parent_id, role_type, role_id, content, status,
+		error_reason, duration_ms, prompt_tokens, completion_tokens, total_tokens, created_at)
+	SELECT id, session_id, article_id, parent_id, role_type, role_id, content, status,
+		error_reason, duration_ms, prompt_tokens, completion_tokens, total_tokens, created_at FROM qa_messages;
+	DROP TABLE qa_messages;
+	ALTER TABLE qa_messages_new RENAME TO qa_messages;
+	CREATE INDEX idx_qa_messages_session_id ON qa_messages(session_id);
+	CREATE INDEX idx_qa_messages_created_at ON qa_messages(created_at);
+	CREATE TRIGGER qa_messages_fts_insert AFTER INSERT ON qa_messages BEGIN
+		INSERT INTO qa_messages_fts(rowid, content) VALUES (new.id, new.content);
+	END;
+	CREATE TRIGGER qa_messages_fts_delete AFTER DELETE ON qa_messages BEGIN
+		INSERT INTO qa_messages_fts(qa_messages_fts, rowid, content) VALUES ('delete', old.id, old.content);
+	END;
+	CREATE TRIGGER qa_messages_fts_update AFTER UPDATE OF content ON qa_messages BEGIN
+		INSERT INTO qa_messages_fts(qa_messages_fts, rowid, content) VALUES ('delete', old.id, old.content);
+		INSERT INTO qa_messages_fts(rowid, content) VALUES (new.id, new.content);
+	END;
+
+	CREATE TABLE qa_runs_new (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		session_id INTEGER NOT NULL REFERENCES qa_sessions(id) ON DELETE CASCADE,
+		message_id INTEGER NOT NULL REFERENCES qa_messages(id) ON DELETE CASCADE,
+		article_id INTEGER REFERENCES articles(id) ON DELETE CASCADE,
+		role_id INTEGER NOT NULL REFERENCES roles(id) ON DELETE CASCADE,
+		role_name TEXT NOT NULL,
+		success INTEGER NOT NULL,
+		error_reason TEXT DEFAULT '',
+		duration_ms INTEGER DEFAULT 0,
+		prompt_tokens INTEGER DEFAULT 0,
+		completion_tokens INTEGER DEFAULT 0,
+		total_tokens INTEGER DEFAULT 0,
+		generation_options TEXT DEFAULT '',
+		cost REAL DEFAULT 0,
+		currency TEXT DEFAULT '',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	INSERT INTO qa_runs_new(id, session_id, message_id, article_id, role_id, role_name, success, error_reason,
+		duration_ms, prompt_tokens, completion_tokens, total_tokens, generation_options, cost, currency, created_at)
+	SELECT id, session_id, message_id, article_id, role_id, role_name, success, error_reason,
+		duration_ms, prompt_tokens, completion_tokens, total_tokens, generation_options, cost, currency, created_at FROM qa_runs;
+	DROP TABLE qa_runs;
+	ALTER TABLE qa_runs_new RENAME TO qa_runs;
+	CREATE INDEX idx_qa_runs_created_at ON qa_runs(created_at);
+	CREATE INDEX idx_qa_runs_role_id ON qa_runs(role_id);
+	CREATE INDEX idx_qa_runs_success ON qa_runs(success);
+
+	ALTER TABLE qa_evidences ADD COLUMN article_id INTEGER REFERENCES articles(id) ON DELETE SET NULL;
+	UPDATE qa_evidences SET article_id = (SELECT m.article_id FROM qa_messages m WHERE m.id = qa_evidences.message_id);
+	CREATE INDEX idx_qa_evidences_article_id ON qa_evidences(article_id);`)
+	return err
+}
+
+// migrateRoleGenerationOptions gives roles the full generation options that
+// prompts have. The temperature and max_tokens columns are folded into the
+// JSON and dropped; a non-positive value there meant "unset".
+func migrateRoleGenerationOptions(tx *sqlx.Tx) error {
+	_, err := tx.Exec(`
+	ALTER TABLE roles ADD COLUMN generation_options TEXT DEFAULT '';
+	UPDATE roles SET generation_options = json_patch(
+		CASE WHEN temperature > 0 THEN json_object('temperature', temperature) ELSE '{}' END,
+		CASE WHEN max_tokens > 0 THEN json_object('maxTokens', max_tokens) ELSE '{}' END
+	);
+	UPDATE roles SET generation_options = '' WHERE generation_options = '{}';
+	ALTER TABLE roles DROP COLUMN temperature;
+	ALTER TABLE roles DROP COLUMN max_tokens;`)
+	return err
+}
@@ -0,0 +1,351 @@
+// Package llmtest runs an in-process fake of an OpenAI-compatible chat
+// completions endpoint so the AI pipeline can be tested without a live
+// provider. Replies are scripted per request: SSE streams, plain JSON,
+// usage chunks, in-stream errors, dropped connections, slow streams and
+// non-2xx statuses such as 429. An /embeddings endpoint answers with
+// vectors from a function the test sets.
+package llmtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"stock-report-analysis/internal/models"
+)
+
+// Usage is reported in the final stream event, or in the body of a JSON reply.
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// Reply scripts the answer to one request. The zero value is an empty
+// SSE stream.
+type Reply struct {
+	// Status other than 0/200 answers with Body as a plain error.
+	Status     int
+	RetryAfter string
+	Body       string
+
+	// JSON answers with a single non-streaming completion of Chunks joined.
+	JSON bool
+	// Chunks are streamed as content deltas, Reasoning as reasoning_content
+	// deltas before them.
+	Chunks    []string
+	Reasoning []string
+	Usage     *Usage
+
+	// Delay is slept before every stream event.
+	Delay time.Duration
+	// StreamError is sent as an {"error":{...}} event after the chunks.
+	StreamError string
+	// DropAfter > 0 aborts the connection after that many content chunks.
+	DropAfter int
+}
+
+// Text streams text as a single chunk.
+func Text(text string) Reply {
+	return Reply{Chunks: []string{text}}
+}
+
+// Stream streams each chunk as its own event.
+func Stream(chunks ...string) Reply {
+	return Reply{Chunks: chunks}
+}
+
+// JSONText answers with a non-streaming completion.
+func JSONText(text string) Reply {
+	return Reply{JSON: true, Chunks: []string{text}}
+}
+
+// Status answers with an HTTP error.
+func Status(code int, body string) Reply {
+	return Reply{Status: code, Body: body}
+}
+
+// RateLimited answers 429 with the given Retry-After header value.
+func RateLimited(retryAfter string) Reply {
+	return Reply{Status: http.StatusTooManyRequests, RetryAfter: retryAfter, Body: `{"error":{"message":"rate limited"}}`}
+}
+
+// Message is one chat message of a recorded request.
+type Message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// Request is what the server received.
+type Request struct {
+	Model          string          `json:"model"`
+	Messages       []Message       `json:"messages"`
+	Stream         bool            `json:"stream"`
+	ResponseFormat json.RawMessage `json:"response_format"`
+	Temperature    *float64        `json:"temperature"`
+	TopP           *float64        `json:"top_p"`
+	MaxTokens      int             `json:"max_tokens"`
+	Stop           []string        `json:"stop"`
+	Seed           *int64          `json:"seed"`
+	Auth           string          `json:"-"`
+}
+
+// System returns the system message, if any.
+func (r Request) System() string {
+	return r.message("system")
+}
+
+// User returns the user message, if any.
+func (r Request) User() string {
+	return r.message("user")
+}
+
+func (r Request) message(role string) string {
+	for _, m := range r.Messages {
+		if m.Role == role {
+			return m.Content
+		}
+	}
+	return ""
+}
+
+// Server is a fake chat completions endpoint. Queued replies are used in
+// order; once the queue is empty every request gets the fallback reply.
+type Server struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	queue    []Reply
+	fallback Reply
+	handler  func(Request) (Reply, bool)
+	requests []Request
+
+	embedder   func(input string) []float32
+	embeddings []EmbeddingRequest
+}
+
+// EmbeddingRequest is what the /embeddings endpoint received.
+type EmbeddingRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+	Auth  string   `json:"-"`
+}
+
+// New starts a server that is closed when the test ends. Until told
+// otherwise it answers every request with Text("ok").
+func New(t testing.TB) *Server {
+	t.Helper()
+	s := &Server{fallback: Text("ok")}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Enqueue appends replies for the next requests.
+func (s *Server) Enqueue(replies ...Reply) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.queue = append(s.queue, replies...)
+}
+
+// SetFallback sets the reply used once the queue is empty.
+func (s *Server) SetFallback(reply Reply) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fallback = reply
+}
+
+// Handle picks replies from the request itself. When fn returns false the
+// queue and fallback are used as usual. Requests may arrive concurrently.
+func (s *Server) Handle(fn func(Request) (Reply, bool)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handler = fn
+}
+
+// SetEmbedder answers /embeddings requests with fn's vector for each
+// input. Without one the endpoint answers 404.
+func (s *Server) SetEmbedder(fn func(input string) []float32) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.embedder = fn
+}
+
+// EmbeddingRequests returns the /embeddings requests received so far.
+func (s *Server) EmbeddingRequests() []EmbeddingRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]EmbeddingRequest(nil), s.embeddings...)
+}
+
+// Requests returns the requests received so far.
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+// Channel returns an OpenAI-compatible channel pointing at the server with
+// retries disabled; callers adjust the fields they test.
+func (s *Server) Channel() models.AIChannel {
+	return models.AIChannel{
+		ID:             1,
+		Name:           "fake",
+		BaseURL:        s.URL + "/v1",
+		APIKey:         "test-key",
+		Model:          "fake-model",
+		Provider:       "openai",
+		MaxRetries:     0,
+		RetryBackoffMs: 1,
+	}
+}
+
+func (s *Server) next(req Request) Reply {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = append(s.requests, req)
+	if s.handler != nil {
+		if reply, ok := s.handler(req); ok {
+			return reply
+		}
+	}
+	if len(s.queue) > 0 {
+		reply := s.queue[0]
+		s.queue = s.queue[1:]
+		return reply
+	}
+	return s.fallback
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/embeddings") {
+		s.serveEmbeddings(w, r)
+		return
+	}
+	if r.Method != http.MethodPost || !strings.HasSuffix(r.URL.Path, "/chat/completions") {
+		http.NotFound(w, r)
+		return
+	}
+	body, _ := io.ReadAll(r.Body)
+	var req Request
+	if err := json.Unmarshal(body, &req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	req.Auth = r.Header.Get("Authorization")
+	reply := s.next(req)
+
+	if reply.Status != 0 && reply.Status != http.StatusOK {
+		if reply.RetryAfter != "" {
+			w.Header().Set("Retry-After", reply.RetryAfter)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(reply.Status)
+		_, _ = io.WriteString(w, reply.Body)
+		return
+	}
+	if reply.JSON {
+		writeJSONReply(w, reply)
+		return
+	}
+	writeSSEReply(w, r, reply)
+}
+
+func (s *Server) serveEmbeddings(w http.ResponseWriter, r *http.Request) {
+	var req EmbeddingRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	req.Auth = r.Header.Get("Authorization")
+	s.mu.Lock()
+	s.embeddings = append(s.embeddings, req)
+	embedder := s.embedder
+	s.mu.Unlock()
+	if embedder == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	data := make([]any, len(req.Input))
+	for i, input := range req.Input {
+		data[i] = map[string]any{"object": "embedding", "index": i, "embedding": embedder(input)}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{"object": "list", "data": data, "model": req.Model})
+}
+
+func writeJSONReply(w http.ResponseWriter, reply Reply) {
+	message := map[string]any{"role": "assistant", "content": strings.Join(reply.Chunks, "")}
+	if len(reply.Reasoning) > 0 {
+		message["reasoning_content"] = strings.Join(reply.Reasoning, "")
+	}
+	payload := map[string]any{
+		"choices": []any{map[string]any{"message": message, "finish_reason": "stop"}},
+	}
+	if reply.Usage != nil {
+		payload["usage"] = reply.Usage
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(payload)
+}
+
+func writeSSEReply(w http.ResponseWriter, r *http.Request, reply Reply) {
+	flusher, _ := w.(http.Flusher)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.WriteHeader(http.StatusOK)
+
+	send := func(v any) bool {
+		if reply.Delay > 0 {
+			select {
+			case <-time.After(reply.Delay):
+			case <-r.Context().Done():
+				return false
+			}
+		}
+		data, _ := json.Marshal(v)
+		if _, err := fmt.Fprintf(w, "data: %s\n\n", data); err != nil {
+			return false
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return true
+	}
+	delta := func(key, text string) map[string]any {
+		return map[string]any{"choices": []any{map[string]any{"delta": map[string]any{key: text}}}}
+	}
+
+	for _, text := range reply.Reasoning {
+		if !send(delta("reasoning_content", text)) {
+			return
+		}
+	}
+	for i, text := range reply.Chunks {
+		if reply.DropAfter > 0 && i == reply.DropAfter {
+			panic(http.ErrAbortHandler)
+		}
+		if !send(delta("content", text)) {
+			return
+		}
+	}
+	if reply.StreamError != "" {
+		send(map[string]any{"error": map[string]any{"message": reply.StreamError}})
+		return
+	}
+	if reply.Usage != nil {
+		if !send(map[string]any{"choices": []any{}, "usage": reply.Usage}) {
+			return
+		}
+	}
+	_, _ = io.WriteString(w, "data: [DONE]\n\n")
+	if flusher != nil {
+		flusher.Flush()
+	}
+}
@@ -1,41 +1,130 @@
 package models
 
-import "time"
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
 
 type AIChannel struct {
-	ID        int64     `db:"id" json:"id"`
-	Name      string    `db:"name" json:"name"`
-	BaseURL   string    `db:"base_url" json:"baseUrl"`
-	APIKey    string    `db:"api_key" json:"apiKey"`
-	Model     string    `db:"model" json:"model"`
-	IsDefault int       `db:"is_default" json:"isDefault"`
-	CreatedAt time.Time `db:"created_at" json:"createdAt"`
+	ID             int64     `db:"id" json:"id"`
+	Name           string    `db:"name" json:"name"`
+	BaseURL        string    `db:"base_url" json:"baseUrl"`
+	APIKey         string    `db:"api_key" json:"apiKey"`
+	Model          string    `db:"model" json:"model"`
+	Provider       string    `db:"provider" json:"provider"` // openai/anthropic/gemini/ollama
+	MaxRetries     int       `db:"max_retries" json:"maxRetries"`
+	RetryBackoffMs int       `db:"retry_backoff_ms" json:"retryBackoffMs"`
+	RPMLimit       int       `db:"rpm_limit" json:"rpmLimit"`           // 0 = unlimited
+	TPMLimit       int       `db:"tpm_limit" json:"tpmLimit"`           // 0 = unlimited
+	MaxInFlight    int       `db:"max_in_flight" json:"maxInFlight"`    // 0 = unlimited
+	ContextWindow  int       `db:"context_window" json:"contextWindow"` // tokens, 0 = not fitted
+	StoreReasoning int       `db:"store_reasoning" json:"storeReasoning"`
+	InputPrice     float64   `db:"input_price" json:"inputPrice"`   // per million prompt tokens
+	OutputPrice    float64   `db:"output_price" json:"outputPrice"` // per million completion tokens
+	Currency       string    `db:"currency" json:"currency"`
+	EmbeddingModel string    `db:"embedding_model" json:"embeddingModel"` // for /embeddings, "" = none
+	IsDefault      int       `db:"is_default" json:"isDefault"`
+	CreatedAt      time.Time `db:"created_at" json:"createdAt"`
+}
+
+// AIFailoverConfig is the ordered list of channels tried after the primary
+// channel of a call has failed.
+type AIFailoverConfig struct {
+	ChannelIDs []int64 `json:"channelIds"`
+}
+
+// AIResponseCacheConfig chooses which callers may answer from the response
+// cache. MaxAgeDays <= 0 keeps entries valid forever.
+type AIResponseCacheConfig struct {
+	Single     bool `json:"single"`
+	Batch      bool `json:"batch"`
+	QA         bool `json:"qa"`
+	Telegraph  bool `json:"telegraph"`
+	MaxAgeDays int  `json:"maxAgeDays"`
+}
+
+// AIResponseCacheStats summarizes the stored responses.
+type AIResponseCacheStats struct {
+	Entries   int   `json:"entries"`
+	TotalHits int64 `json:"totalHits"`
+}
+
+// GenerationOptions are the sampling parameters sent with an LLM request.
+// Nil pointers and zero values mean "use the provider default".
+type GenerationOptions struct {
+	Temperature *float64 `json:"temperature,omitempty"`
+	TopP        *float64 `json:"topP,omitempty"`
+	MaxTokens   int      `json:"maxTokens,omitempty"`
+	Stop        []string `json:"stop,omitempty"`
+	Seed        *int64   `json:"seed,omitempty"`
+}
+
+func (o GenerationOptions) IsZero() bool {
+	return o.Temperature == nil && o.TopP == nil && o.MaxTokens == 0 && len(o.Stop) == 0 && o.Seed == nil
+}
+
+// Value stores the options as a JSON column; empty options become an empty string.
+func (o GenerationOptions) Value() (driver.Value, error) {
+	if o.IsZero() {
+		return "", nil
+	}
+	b, err := json.Marshal(o)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+func (o *GenerationOptions) Scan(src any) error {
+	var raw string
+	switch v := src.(type) {
+	case nil:
+	case string:
+		raw = v
+	case []byte:
+		raw = string(v)
+	default:
+		return fmt.Errorf("generation options: unsupported type %T", src)
+	}
+	*o = GenerationOptions{}
+	if strings.TrimSpace(raw) == "" {
+		return nil
+	}
+	return json.Unmarshal([]byte(raw), o)
 }
 
 type Prompt struct {
-	ID        int64     `db:"id" json:"id"`
-	Name      string    `db:"name" json:"name"`
-	Content   string    `db:"content" json:"content"`
-	IsDefault int       `db:"is_default" json:"isDefault"`
-	CreatedAt time.Time `db:"created_at" json:"createdAt"`
+	ID                int64             `db:"id" json:"id"`
+	Name              string            `db:"name" json:"name"`
+	Content           string            `db:"content" json:"content"`
+	GenerationOptions GenerationOptions `db:"generation_options" json:"generationOptions"`
+	OutputSchema      string            `db:"output_schema" json:"outputSchema"`
+	IsDefault         int               `db:"is_default" json:"isDefault"`
+	CreatedAt         time.Time         `db:"created_at" json:"createdAt"`
 }
 
 type PromptVersion struct {
-	ID        int64     `db:"id" json:"id"`
-	PromptID  int64     `db:"prompt_id" json:"promptId"`
-	VersionNo int       `db:"version_no" json:"versionNo"`
-	Name      string    `db:"name" json:"name"`
-	Content   string    `db:"content" json:"content"`
-	CreatedAt time.Time `db:"created_at" json:"createdAt"`
+	ID                int64             `db:"id" json:"id"`
+	PromptID          int64             `db:"prompt_id" json:"promptId"`
+	VersionNo         int               `db:"version_no" json:"versionNo"`
+	Name              string            `db:"name" json:"name"`
+	Content           string            `db:"content" json:"content"`
+	GenerationOptions GenerationOptions `db:"generation_options" json:"generationOptions"`
+	OutputSchema      string            `db:"output_schema" json:"outputSchema"`
+	CreatedAt         time.Time         `db:"created_at" json:"createdAt"`
 }
 
 type TelegraphSchedulerConfig struct {
-	Enabled         int    `json:"enabled"`
-	SourceURL       string `json:"sourceUrl"`
-	IntervalMinutes int    `json:"intervalMinutes"`
-	FetchLimit      int    `json:"fetchLimit"`
-	ChannelID       int64  `json:"channelId"`
-	AnalysisPrompt  string `json:"analysisPrompt"`
+	Enabled           int               `json:"enabled"`
+	SourceURL         string            `json:"sourceUrl"`
+	IntervalMinutes   int               `json:"intervalMinutes"`
+	FetchLimit        int               `json:"fetchLimit"`
+	ChannelID         int64             `json:"channelId"`
+	AnalysisPrompt    string            `json:"analysisPrompt"`
+	GenerationOptions GenerationOptions `json:"generationOptions"`
 }
 
 type AppUpdateConfig struct {
@@ -69,6 +158,74 @@ type TelegraphSchedulerStatus struct {
 	LastAnalyzed int       `json:"lastAnalyzed"`
 }
 
+// EmbeddingConfig turns on semantic retrieval for QA: sections are embedded
+// with the embedding model of the chosen channel and ranked by a mix of
+// BM25 and cosine similarity, SemanticWeight being the share of the latter.
+type EmbeddingConfig struct {
+	Enabled        int     `json:"enabled"`
+	ChannelID      int64   `json:"channelId"`
+	SemanticWeight float64 `json:"semanticWeight"`
+}
+
+// EmbeddingBackfillStatus reports the background job that embeds the
+// sections of articles imported before embeddings were enabled.
+type EmbeddingBackfillStatus struct {
+	Running   bool      `json:"running"`
+	Total     int       `json:"total"`
+	Completed int       `json:"completed"`
+	LastRunAt time.Time `json:"lastRunAt"`
+	LastError string    `json:"lastError"`
+}
+
+// FolderWatchConfig lists the folders whose new files are imported
+// automatically. With AutoAnalyze set, every new article is analyzed with
+// the chosen channel and prompt.
+type FolderWatchConfig struct {
+	Enabled         int      `json:"enabled"`
+	Dirs            []string `json:"dirs"`
+	IntervalMinutes int      `json:"intervalMinutes"`
+	AutoAnalyze     int      `json:"autoAnalyze"`
+	ChannelID       int64    `json:"channelId"`
+	PromptID        int64    `json:"promptId"`
+	Mode            string   `json:"mode"`
+}
+
+type FolderWatchStatus struct {
+	Running   bool `json:"running"`
+	Watching  bool `json:"watching"` // folders are watched for changes between scans
+	Total     int  `json:"total"`
+	Completed int  `json:"completed"`
+	// CurrentFile is the file being imported or analyzed while Running.
+	CurrentFile    string    `json:"currentFile"`
+	LastRunAt      time.Time `json:"lastRunAt"`
+	LastImported   int       `json:"lastImported"`
+	LastDuplicates int       `json:"lastDuplicates"`
+	LastFailed     int       `json:"lastFailed"`
+	LastAnalyzed   int       `json:"lastAnalyzed"`
+	LastError      string    `json:"lastError"`
+}
+
+// WatchedFile is what the folder watch remembers about a file it processed.
+// Status is "imported", "duplicate" or "failed"; failed files are retried a
+// few times, the others are never imported again, even under another name.
+type WatchedFile struct {
+	Path        string    `db:"path" json:"path"`
+	FileHash    string    `db:"file_hash" json:"fileHash"`
+	ArticleID   int64     `db:"article_id" json:"articleId"`
+	Title       string    `db:"title" json:"title"`
+	Status      string    `db:"status" json:"status"`
+	Error       string    `db:"error" json:"error"`
+	Attempts    int       `db:"attempts" json:"attempts"`
+	ProcessedAt time.Time `db:"processed_at" json:"processedAt"`
+}
+
+// TelegraphArticlePage is one page of GetTelegraphArticles.
+type TelegraphArticlePage struct {
+	Items      []TelegraphArticleItem `json:"items"`
+	Total      int                    `json:"total"`
+	NextCursor string                 `json:"nextCursor"` // empty on the last page
+}
+
 type TelegraphArticleItem struct {
 	ID              int64                 `db:"id" json:"id"`
 	Title           string                `db:"title" json:"title"`
@@ -126,9 +283,74 @@ type Article struct {
 	Status      int        `db:"status" json:"status"` // 0=待解读 1=解读中 2=已解读
 	CreatedAt   time.Time  `db:"created_at" json:"createdAt"`
 	AnalyzedAt  *time.Time `db:"analyzed_at" json:"analyzedAt"`
+	ContentHash string     `db:"content_hash" json:"contentHash"` // normalized content, see ImportFile
+	FileHash    string     `db:"file_hash" json:"fileHash"`       // original file or download
+	Simhash     int64      `db:"simhash" json:"-"`
 	Tags        []Tag      `db:"-" json:"tags"`
 }
 
+// ImportResult is the outcome of importing one file or URL. Duplicate is
+// empty for a new article, "exact" when Article is an existing article with
+// the same file or content, and "similar" when nothing was imported because
+// Article looks like the same document; import again with force to keep both.
+type ImportResult struct {
+	Article   Article `json:"article"`
+	Duplicate string  `json:"duplicate"`
+	Message   string  `json:"message"`
+	FilePath  string  `json:"filePath"` // the imported local file, for a forced retry
+}
+
+// ArticleAsset is an image or table MinerU extracted from an article's
+// source document. Path is the file inside the cached MinerU result and URL
+// where the app serves it; tables also carry their HTML.
+type ArticleAsset struct {
+	ID        int64  `db:"id" json:"id"`
+	ArticleID int64  `db:"article_id" json:"articleId"`
+	FileHash  string `db:"file_hash" json:"-"`
+	Kind      string `db:"kind" json:"kind"` // image or table
+	Path      string `db:"path" json:"path"`
+	URL       string `db:"-" json:"url"`
+	Caption   string `db:"caption" json:"caption"`
+	HTML      string `db:"html" json:"html"`
+	Page      int    `db:"page" json:"page"` // 1-based, 0 when unknown
+}
+
+// DuplicateGroup is a set of library articles that look like one document,
+// oldest first. Exact is set when they share a file or content hash.
+type DuplicateGroup struct {
+	Articles []Article `json:"articles"`
+	Exact    bool      `json:"exact"`
+}
+
+// ArticleQuery filters and pages the article and telegraph lists. Empty
+// fields do not filter. Dates are local calendar days (YYYY-MM-DD), both
+// ends inclusive.
+type ArticleQuery struct {
+	Keyword      string   `json:"keyword"` // full-text query, see SearchFullText
+	TagIDs       []int64  `json:"tagIds"`
+	TagMode      string   `json:"tagMode"` // any (default) / all
+	Statuses     []int    `json:"statuses"`
+	Sources      []string `json:"sources"` // substrings of source, any of them
+	CreatedFrom  string   `json:"createdFrom"`
+	CreatedTo    string   `json:"createdTo"`
+	AnalyzedFrom string   `json:"analyzedFrom"`
+	AnalyzedTo   string   `json:"analyzedTo"`
+	// Sort is created_desc (default), created_asc or analyzed_desc; the
+	// telegraph list also takes score_desc and watch_first.
+	Sort      string `json:"sort"`
+	WatchOnly bool   `json:"watchOnly"` // telegraph list only
+	// Cursor is the NextCursor of the previous page; empty for the first.
+	Cursor string `json:"cursor"`
+	Limit  int    `json:"limit"` // default 50, at most 200
+}
+
+// ArticlePage is one page of GetArticles. Total counts all matches.
+type ArticlePage struct {
+	Items      []Article `json:"items"`
+	Total      int       `json:"total"`
+	NextCursor string    `json:"nextCursor"` // empty on the last page
+}
+
 type Tag struct {
 	ID    int64  `db:"id" json:"id"`
 	Name  string `db:"name" json:"name"`
@@ -141,9 +363,52 @@ type AnalysisHistory struct {
 	Analysis    string    `db:"analysis" json:"analysis"`
 	PromptUsed  string    `db:"prompt_used" json:"promptUsed"`
 	ChannelUsed string    `db:"channel_used" json:"channelUsed"`
+	Reasoning   string    `db:"reasoning" json:"reasoning"` // only kept for channels with StoreReasoning
 	CreatedAt   time.Time `db:"created_at" json:"createdAt"`
 }
 
+// StructuredAnalysis is the parsed form of a structured-mode analysis. Risks
+// and catalysts live in structured_analysis_items, one row per entry.
+type StructuredAnalysis struct {
+	ArticleID     int64    `db:"article_id" json:"articleId"`
+	Summary       string   `db:"summary" json:"summary"`
+	Risks         []string `db:"-" json:"risks"`
+	Catalysts     []string `db:"-" json:"catalysts"`
+	ValuationView string   `db:"valuation_view" json:"valuationView"`
+	// Payload is the validated JSON object; with a prompt-defined schema the
+	// fields above are only filled when the schema has them.
+	Payload   string    `db:"payload" json:"payload"`
+	Repaired  int       `db:"repaired" json:"repaired"`
+	UpdatedAt time.Time `db:"updated_at" json:"updatedAt"`
+}
+
+// StructuredAnalysisHit is one matching field of a structured analysis.
+type StructuredAnalysisHit struct {
+	ArticleID int64     `db:"article_id" json:"articleId"`
+	Title     string    `db:"title" json:"title"`
+	Field     string    `db:"field" json:"field"` // summary/risks/catalysts/valuationView
+	Content   string    `db:"content" json:"content"`
+	UpdatedAt time.Time `db:"updated_at" json:"updatedAt"`
+}
+
+// SearchHit is one full-text search result: an article (Kind "article") or
+// a QA message (Kind "qa"). Snippet is HTML-escaped text with the matched
+// terms wrapped in <mark>. Score is the FTS5 bm25 rank, lower is better;
+// 0 when the query only had terms too short for the index. A message of a
+// scoped QA session has ArticleID 0.
+type SearchHit struct {
+	Kind      string    `db:"kind" json:"kind"`
+	ArticleID int64     `db:"article_id" json:"articleId"`
+	SessionID int64     `db:"session_id" json:"sessionId"`
+	MessageID int64     `db:"message_id" json:"messageId"`
+	Title     string    `db:"title" json:"title"`
+	Source    string    `db:"source" json:"source"`
+	Field     string    `db:"-" json:"field"` // title/content/analysis for articles, question/answer for QA
+	Snippet   string    `db:"-" json:"snippet"`
+	Score     float64   `db:"score" json:"score"`
+	CreatedAt time.Time `db:"created_at" json:"createdAt"`
+}
+
 type BatchFailure struct {
 	ArticleID int64     `json:"articleId"`
 	Title     string    `json:"title"`
@@ -161,23 +426,44 @@ type BatchStatus struct {
 	InProgress  int            `json:"inProgress"`
 	Concurrency int            `json:"concurrency"`
 	Failures    []BatchFailure `json:"failures"`
+	// PauseReason is set when the job paused itself, e.g. on a budget cap.
+	PauseReason string `json:"pauseReason"`
+	// Limiter state of the batch channel, shared with QA and telegraph calls.
+	QueueDepth int   `json:"queueDepth"`
+	AvgWaitMs  int64 `json:"avgWaitMs"`
+	MaxWaitMs  int64 `json:"maxWaitMs"`
+}
+
+type ChannelLimiterStats struct {
+	ChannelID          int64 `json:"channelId"`
+	QueueDepth         int   `json:"queueDepth"`
+	InFlight           int   `json:"inFlight"`
+	RequestsLastMinute int   `json:"requestsLastMinute"`
+	TokensLastMinute   int   `json:"tokensLastMinute"`
+	AvgWaitMs          int64 `json:"avgWaitMs"`
+	MaxWaitMs          int64 `json:"maxWaitMs"`
 }
 
 type AnalysisRun struct {
-	ID               int64     `db:"id" json:"id"`
-	ArticleID        int64     `db:"article_id" json:"articleId"`
-	ChannelID        int64     `db:"channel_id" json:"channelId"`
-	ChannelName      string    `db:"channel_name" json:"channelName"`
-	PromptID         int64     `db:"prompt_id" json:"promptId"`
-	PromptName       string    `db:"prompt_name" json:"promptName"`
-	Mode             string    `db:"mode" json:"mode"`
-	Success          int       `db:"success" json:"success"`
-	ErrorReason      string    `db:"error_reason" json:"errorReason"`
-	DurationMs       int64     `db:"duration_ms" json:"durationMs"`
-	PromptTokens     int       `db:"prompt_tokens" json:"promptTokens"`
-	CompletionTokens int       `db:"completion_tokens" json:"completionTokens"`
-	TotalTokens      int       `db:"total_tokens" json:"totalTokens"`
-	CreatedAt        time.Time `db:"created_at" json:"createdAt"`
+	ID                int64             `db:"id" json:"id"`
+	ArticleID         int64             `db:"article_id" json:"articleId"`
+	ChannelID         int64             `db:"channel_id" json:"channelId"`
+	ChannelName       string            `db:"channel_name" json:"channelName"`
+	PromptID          int64             `db:"prompt_id" json:"promptId"`
+	PromptName        string            `db:"prompt_name" json:"promptName"`
+	Mode              string            `db:"mode" json:"mode"`
+	Attempt           int               `db:"attempt" json:"attempt"`
+	Success           int               `db:"success" json:"success"`
+	ErrorReason       string            `db:"error_reason" json:"errorReason"`
+	DurationMs        int64             `db:"duration_ms" json:"durationMs"`
+	PromptTokens      int               `db:"prompt_tokens" json:"promptTokens"`
+	CompletionTokens  int               `db:"completion_tokens" json:"completionTokens"`
+	TotalTokens       int               `db:"total_tokens" json:"totalTokens"`
+	GenerationOptions GenerationOptions `db:"generation_options" json:"generationOptions"`
+	CacheHit          int               `db:"cache_hit" json:"cacheHit"`
+	Cost              float64           `db:"cost" json:"cost"`
+	Currency          string            `db:"currency" json:"currency"`
+	CreatedAt         time.Time         `db:"created_at" json:"createdAt"`
 }
 
 type ChannelMetric struct {
@@ -191,6 +477,7 @@ type ChannelMetric struct {
 	TotalTokens  int64  `json:"totalTokens"`
 	PromptTokens int64  `json:"promptTokens"`
 	OutputTokens int64  `json:"outputTokens"`
+	CacheHits    int    `json:"cacheHits"`
 }
 
 type FailureReasonMetric struct {
@@ -207,34 +494,145 @@ type AnalysisDashboard struct {
 	TotalTokens   int64                 `json:"totalTokens"`
 	PromptTokens  int64                 `json:"promptTokens"`
 	OutputTokens  int64                 `json:"outputTokens"`
+	CacheHits     int                   `json:"cacheHits"`
+	CacheHitRate  string                `json:"cacheHitRate"`
 	ByChannel     []ChannelMetric       `json:"byChannel"`
 	FailureTop    []FailureReasonMetric `json:"failureTop"`
+	Costs         []CostMetric          `json:"costs"`
+	CostByDay     []CostMetric          `json:"costByDay"`
+	CostByChannel []CostMetric          `json:"costByChannel"`
+	CostByPrompt  []CostMetric          `json:"costByPrompt"`
+}
+
+// CostMetric is the spend of one group in one currency. Key is the day
+// (YYYY-MM-DD), channel, prompt or role name; it is empty for totals.
+type CostMetric struct {
+	Key      string  `json:"key"`
+	Currency string  `json:"currency"`
+	Cost     float64 `json:"cost"`
+	Runs     int     `json:"runs"`
+	Tokens   int64   `json:"tokens"`
+}
+
+// AIBudgetConfig caps the spend of background AI work in one currency.
+// A limit <= 0 means no cap.
+type AIBudgetConfig struct {
+	DailyLimit   float64 `json:"dailyLimit"`
+	MonthlyLimit float64 `json:"monthlyLimit"`
+	Currency     string  `json:"currency"`
+}
+
+// AIBudgetStatus is the spend against AIBudgetConfig for the current local
+// day and month. Reason explains why Exceeded is set.
+type AIBudgetStatus struct {
+	Currency     string  `json:"currency"`
+	DailyLimit   float64 `json:"dailyLimit"`
+	MonthlyLimit float64 `json:"monthlyLimit"`
+	DailySpent   float64 `json:"dailySpent"`
+	MonthlySpent float64 `json:"monthlySpent"`
+	Exceeded     bool    `json:"exceeded"`
+	Reason       string  `json:"reason"`
 }
 
 type Role struct {
-	ID            int64     `db:"id" json:"id"`
-	Name          string    `db:"name" json:"name"`
-	Alias         string    `db:"alias" json:"alias"`
-	DomainTags    string    `db:"domain_tags" json:"domainTags"`
-	SystemPrompt  string    `db:"system_prompt" json:"systemPrompt"`
-	ModelOverride string    `db:"model_override" json:"modelOverride"`
-	Temperature   float64   `db:"temperature" json:"temperature"`
-	MaxTokens     int       `db:"max_tokens" json:"maxTokens"`
-	Enabled       int       `db:"enabled" json:"enabled"`
-	IsDefault     int       `db:"is_default" json:"isDefault"`
-	CreatedAt     time.Time `db:"created_at" json:"createdAt"`
-	UpdatedAt     time.Time `db:"updated_at" json:"updatedAt"`
+	ID            int64  `db:"id" json:"id"`
+	Name          string `db:"name" json:"name"`
+	Alias         string `db:"alias" json:"alias"`
+	DomainTags    string `db:"domain_tags" json:"domainTags"`
+	SystemPrompt  string `db:"system_prompt" json:"systemPrompt"`
+	ModelOverride string `db:"model_override" json:"modelOverride"`
+	// GenerationOptions are sent with the role's answers; a nil temperature
+	// uses the provider default, 0 asks for deterministic output.
+	GenerationOptions GenerationOptions `db:"generation_options" json:"generationOptions"`
+	Enabled           int               `db:"enabled" json:"enabled"`
+	IsDefault         int               `db:"is_default" json:"isDefault"`
+	CreatedAt         time.Time         `db:"created_at" json:"createdAt"`
+	UpdatedAt         time.Time         `db:"updated_at" json:"updatedAt"`
+}
+
+// QAModeratorConfig turns on the synthesis of consensus and disagreement
+// written once two or more roles have answered a question. RoleID is the
+// role that moderates, its model override and sampling options included;
+// 0 uses the default role. Prompt replaces the built-in moderator
+// instructions when set.
+type QAModeratorConfig struct {
+	Enabled int    `json:"enabled"`
+	RoleID  int64  `json:"roleId"`
+	Prompt  string `json:"prompt"`
+}
+
+// QAScope selects the articles a session asks across. The filters are
+// ANDed and resolved again for every question, so a tag or date range
+// picks up articles imported later. Reports are selected unless WatchStock
+// is set, which selects the telegraphs that hit that watchlist stock code;
+// ArticleIDs may name either. Limit keeps the newest matches, at most
+// 200 (the default).
+type QAScope struct {
+	ArticleIDs []int64 `json:"articleIds"`
+	TagIDs     []int64 `json:"tagIds"`
+	Keyword    string  `json:"keyword"` // full-text query, see SearchFullText
+	DateFrom   string  `json:"dateFrom"`
+	DateTo     string  `json:"dateTo"`
+	WatchStock string  `json:"watchStock"`
+	Limit      int     `json:"limit"`
+}
+
+func (q QAScope) IsZero() bool {
+	return len(q.ArticleIDs) == 0 && len(q.TagIDs) == 0 && q.Keyword == "" && q.DateFrom == "" &&
+		q.DateTo == "" && q.WatchStock == "" && q.Limit == 0
 }
 
+// Value stores the scope as a JSON column; a session of a single article
+// has an empty string.
+func (q QAScope) Value() (driver.Value, error) {
+	if q.IsZero() {
+		return "", nil
+	}
+	b, err := json.Marshal(q)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+func (q *QAScope) Scan(src any) error {
+	var raw string
+	switch v := src.(type) {
+	case nil:
+	case string:
+		raw = v
+	case []byte:
+		raw = string(v)
+	default:
+		return fmt.Errorf("qa scope: unsupported type %T", src)
+	}
+	*q = QAScope{}
+	if strings.TrimSpace(raw) == "" {
+		return nil
+	}
+	return json.Unmarshal([]byte(raw), q)
+}
+
+// QASession is a conversation about one article (ArticleID) or, with a
+// non-zero Scope, across a set of articles (ArticleID 0).
 type QASession struct {
 	ID        int64     `db:"id" json:"id"`
 	ArticleID int64     `db:"article_id" json:"articleId"`
+	Scope     QAScope   `db:"scope" json:"scope"`
 	Title     string    `db:"title" json:"title"`
 	Summary   string    `db:"summary" json:"summary"`
 	CreatedAt time.Time `db:"created_at" json:"createdAt"`
 	UpdatedAt time.Time `db:"updated_at" json:"updatedAt"`
 }
 
+// QAScopeArticle is an article a scope resolves to.
+type QAScopeArticle struct {
+	ID        int64     `db:"id" json:"id"`
+	Title     string    `db:"title" json:"title"`
+	Source    string    `db:"source" json:"source"`
+	CreatedAt time.Time `db:"created_at" json:"createdAt"`
+}
+
 type QAPin struct {
 	ID              int64     `db:"id" json:"id"`
 	SessionID       int64     `db:"session_id" json:"sessionId"`
@@ -245,14 +643,25 @@ type QAPin struct {
 	UpdatedAt       time.Time `db:"updated_at" json:"updatedAt"`
 }
 
+// QAEvidence is a section of the article an answer was given from. Pages
+// are 1-based and 0 when the source has no page layout; HeadingPath joins
+// the headings above the section with " > ". ArticleID is 0 once the
+// article has been deleted.
 type QAEvidence struct {
-	ID         int64  `db:"id" json:"id"`
-	MessageID  int64  `db:"message_id" json:"messageId"`
-	ChunkIndex int    `db:"chunk_index" json:"chunkIndex"`
-	Quote      string `db:"quote" json:"quote"`
-	Reason     string `db:"reason" json:"reason"`
+	ID           int64  `db:"id" json:"id"`
+	MessageID    int64  `db:"message_id" json:"messageId"`
+	ArticleID    int64  `db:"article_id" json:"articleId"`
+	ArticleTitle string `db:"article_title" json:"articleTitle"`
+	ChunkIndex   int    `db:"chunk_index" json:"chunkIndex"`
+	Quote        string `db:"quote" json:"quote"`
+	Reason       string `db:"reason" json:"reason"`
+	HeadingPath  string `db:"heading_path" json:"headingPath"`
+	PageStart    int    `db:"page_start" json:"pageStart"`
+	PageEnd      int    `db:"page_end" json:"pageEnd"`
 }
 
+// QAMessage is a turn of a session. RoleType is user, assistant (a role's
+// answer) or moderator (the synthesis of the answers to the parent question).
 type QAMessage struct {
 	ID               int64        `db:"id" json:"id"`
 	SessionID        int64        `db:"session_id" json:"sessionId"`
@@ -273,19 +682,22 @@ type QAMessage struct {
 }
 
 type QARun struct {
-	ID               int64     `db:"id" json:"id"`
-	SessionID        int64     `db:"session_id" json:"sessionId"`
-	MessageID        int64     `db:"message_id" json:"messageId"`
-	ArticleID        int64     `db:"article_id" json:"articleId"`
-	RoleID           int64     `db:"role_id" json:"roleId"`
-	RoleName         string    `db:"role_name" json:"roleName"`
-	Success          int       `db:"success" json:"success"`
-	ErrorReason      string    `db:"error_reason" json:"errorReason"`
-	DurationMs       int64     `db:"duration_ms" json:"durationMs"`
-	PromptTokens     int       `db:"prompt_tokens" json:"promptTokens"`
-	CompletionTokens int       `db:"completion_tokens" json:"completionTokens"`
-	TotalTokens      int       `db:"total_tokens" json:"totalTokens"`
-	CreatedAt        time.Time `db:"created_at" json:"createdAt"`
+	ID                int64             `db:"id" json:"id"`
+	SessionID         int64             `db:"session_id" json:"sessionId"`
+	MessageID         int64             `db:"message_id" json:"messageId"`
+	ArticleID         int64             `db:"article_id" json:"articleId"`
+	RoleID            int64             `db:"role_id" json:"roleId"`
+	RoleName          string            `db:"role_name" json:"roleName"`
+	Success           int               `db:"success" json:"success"`
+	ErrorReason       string            `db:"error_reason" json:"errorReason"`
+	DurationMs        int64             `db:"duration_ms" json:"durationMs"`
+	PromptTokens      int               `db:"prompt_tokens" json:"promptTokens"`
+	CompletionTokens  int               `db:"completion_tokens" json:"completionTokens"`
+	TotalTokens       int               `db:"total_tokens" json:"totalTokens"`
+	GenerationOptions GenerationOptions `db:"generation_options" json:"generationOptions"`
+	Cost              float64           `db:"cost" json:"cost"`
+	Currency          string            `db:"currency" json:"currency"`
+	CreatedAt         time.Time         `db:"created_at" json:"createdAt"`
 }
 
 type QARoleMetric struct {
@@ -312,8 +724,14 @@ type QADashboard struct {
 	OutputTokens  int64                 `json:"outputTokens"`
 	ByRole        []QARoleMetric        `json:"byRole"`
 	FailureTop    []FailureReasonMetric `json:"failureTop"`
+	Costs         []CostMetric          `json:"costs"`
+	CostByDay     []CostMetric          `json:"costByDay"`
+	CostByRole    []CostMetric          `json:"costByRole"`
 }
 
+// MinerUConfig configures document parsing. Enabled through TimeoutSec
+// are the cloud MinerU API; Parsers is the order the parsers are tried in,
+// a parser that is not set up or fails hands over to the next.
 type MinerUConfig struct {
 	Enabled        int    `json:"enabled"`
 	BaseURL        string `json:"baseUrl"`
@@ -322,6 +740,11 @@ type MinerUConfig struct {
 	IsOCR          int    `json:"isOCR"`
 	PollIntervalMs int    `json:"pollIntervalMs"`
 	TimeoutSec     int    `json:"timeoutSec"`
+
+	Parsers           []string `json:"parsers"`           // mineru_cloud, mineru_self_hosted, builtin
+	SelfHostedURL     string   `json:"selfHostedUrl"`     // empty leaves the self-hosted parser off
+	SelfHostedAPI     string   `json:"selfHostedApi"`     // mineru (mineru-api) or magic-pdf (web_api)
+	SelfHostedBackend string   `json:"selfHostedBackend"` // mineru-api backend, e.g. pipeline
 }
 
 type RoleTemplate struct {
@@ -20,12 +20,28 @@ const (
 	AnalysisModeStructured = "structured"
 )
 
+const (
+	ProviderOpenAI    = "openai"
+	ProviderAnthropic = "anthropic"
+	ProviderGemini    = "gemini"
+	ProviderOllama    = "ollama"
+)
+
 type AnalysisResult struct {
-	Text             string
+	Text string
+	// Reasoning is the thinking text of reasoning models, kept apart from
+	// the answer in Text.
+	Reasoning        string
 	PromptTokens     int
 	CompletionTokens int
 	TotalTokens      int
 	DurationMs       int64
+	// CacheHit marks a reply served from the response cache; its token
+	// counts are zero since nothing was billed.
+	CacheHit bool
+	// cacheKey is set when the request opted into the cache, so a repaired
+	// structured reply can replace the stored one.
+	cacheKey string
 }
 
 type chatMessage struct {
@@ -38,15 +54,24 @@ type streamOptions struct {
 }
 
 type chatRequest struct {
-	Model          string            `json:"model"`
-	Messages       []chatMessage     `json:"messages"`
-	Stream         bool              `json:"stream"`
-	StreamOptions  *streamOptions    `json:"stream_options,omitempty"`
-	ResponseFormat map[string]string `json:"response_format,omitempty"`
+	Model          string         `json:"model"`
+	Messages       []chatMessage  `json:"messages"`
+	Stream         bool           `json:"stream"`
+	StreamOptions  *streamOptions `json:"stream_options,omitempty"`
+	ResponseFormat map[string]any `json:"response_format,omitempty"`
+	Temperature    *float64       `json:"temperature,omitempty"`
+	TopP           *float64       `json:"top_p,omitempty"`
+	MaxTokens      int            `json:"max_tokens,omitempty"`
+	Stop           []string       `json:"stop,omitempty"`
+	Seed           *int64         `json:"seed,omitempty"`
 }
 
 type streamDelta struct {
 	Content string `json:"content"`
+	// DeepSeek-style servers stream reasoning_content; OpenRouter and some
+	// other proxies use reasoning.
+	ReasoningContent string `json:"reasoning_content"`
+	Reasoning        string `json:"reasoning"`
 }
 
 type streamChoice struct {
@@ -76,53 +101,98 @@ var aiHTTPClient = &http.Client{
 	Timeout: 5 * time.Minute,
 }
 
-func AnalyzeArticle(channel models.AIChannel, prompt, content string, onChunk func(string)) (string, error) {
-	res, err := AnalyzeArticleDetailed(channel, prompt, content, AnalysisModeText, onChunk)
+func (s *Service) AnalyzeArticle(channel models.AIChannel, prompt, content string, onChunk func(string)) (string, error) {
+	res, err := s.AnalyzeArticleDetailed(channel, prompt, content, AnalysisModeText, onChunk)
 	if err != nil {
 		return "", err
 	}
 	return res.Text, nil
 }
 
-func AnalyzeArticleDetailed(channel models.AIChannel, prompt, content, mode string, onChunk func(string)) (AnalysisResult, error) {
-	return AnalyzeArticleDetailedWithContext(context.Background(), channel, prompt, content, mode, onChunk)
+func (s *Service) AnalyzeArticleDetailed(channel models.AIChannel, prompt, content, mode string, onChunk func(string)) (AnalysisResult, error) {
+	return s.AnalyzeArticleDetailedWithContext(context.Background(), channel, prompt, content, mode, onChunk)
+}
+
+func (s *Service) AnalyzeArticleDetailedWithContext(ctx context.Context, channel models.AIChannel, prompt, content, mode string, onChunk func(string)) (AnalysisResult, error) {
+	return s.AnalyzeWithRequest(ctx, AnalysisRequest{
+		Channel: channel,
+		Prompt:  prompt,
+		Content: content,
+		Mode:    mode,
+	}, onChunk)
+}
+
+// AnalysisRequest is the full input of one LLM call. Schema is the prompt's
+// optional JSON Schema for structured mode. OnReasoning, when set, receives
+// the model's thinking text as it streams. UseCache answers identical
+// requests from the response cache and stores new replies in it.
+type AnalysisRequest struct {
+	Channel     models.AIChannel
+	Prompt      string
+	Content     string
+	Mode        string
+	Schema      string
+	Options     models.GenerationOptions
+	OnReasoning func(string)
+	UseCache    bool
 }
 
-func AnalyzeArticleDetailedWithContext(ctx context.Context, channel models.AIChannel, prompt, content, mode string, onChunk func(string)) (AnalysisResult, error) {
+func (s *Service) AnalyzeWithRequest(ctx context.Context, in AnalysisRequest, onChunk func(string)) (AnalysisResult, error) {
 	if ctx == nil {
 		ctx = context.Background()
 	}
-	if onChunk == nil {
-		onChunk = func(string) {}
+	out := streamSink{onChunk: onChunk, onReasoning: in.OnReasoning}
+	if out.onChunk == nil {
+		out.onChunk = func(string) {}
+	}
+	if out.onReasoning == nil {
+		out.onReasoning = func(string) {}
 	}
 
+	schema := ""
+	if in.Mode == AnalysisModeStructured {
+		schema = strings.TrimSpace(in.Schema)
+	}
+	system := buildSystemPrompt(in.Prompt, in.Mode, schema)
 	startedAt := time.Now()
 
-	reqBody := chatRequest{
-		Model: channel.Model,
-		Messages: []chatMessage{
-			{Role: "system", Content: buildSystemPrompt(prompt, mode)},
-			{Role: "user", Content: content},
-		},
-		Stream:        true,
-		StreamOptions: &streamOptions{IncludeUsage: true},
-	}
-	if mode == AnalysisModeStructured {
-		reqBody.ResponseFormat = map[string]string{"type": "json_object"}
+	cacheKey := ""
+	if in.UseCache {
+		cacheKey = responseCacheKey(in.Channel.Model, system, in.Mode, in.Options, in.Content)
+		if entry, ok := s.lookupCachedResponse(cacheKey); ok {
+			if entry.Reasoning != "" {
+				out.onReasoning(entry.Reasoning)
+			}
+			out.onChunk(entry.Text)
+			return AnalysisResult{
+				Text:       entry.Text,
+				Reasoning:  entry.Reasoning,
+				DurationMs: time.Since(startedAt).Milliseconds(),
+				CacheHit:   true,
+				cacheKey:   cacheKey,
+			}, nil
+		}
 	}
 
-	body, err := json.Marshal(reqBody)
+	release, err := s.limiterFor(in.Channel).acquire(ctx, estimateRequestTokens(system, in.Content, in.Options.MaxTokens))
 	if err != nil {
 		return AnalysisResult{}, err
 	}
-
-	url := strings.TrimRight(channel.BaseURL, "/") + "/chat/completions"
-	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+	usedTokens := 0
+	defer func() { release(usedTokens) }()
+
+	provider := providerFor(in.Channel)
+	req, err := provider.newRequest(ctx, chatCall{
+		Channel: in.Channel,
+		System:  system,
+		User:    in.Content,
+		Mode:    in.Mode,
+		Schema:  schema,
+		Options: in.Options,
+	})
 	if err != nil {
 		return AnalysisResult{}, err
 	}
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+channel.APIKey)
 
 	resp, err := aiHTTPClient.Do(req)
 	if err != nil {
@@ -132,33 +202,172 @@ func AnalyzeArticleDetailedWithContext(ctx context.Context, channel models.AICha
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
 		b, _ := io.ReadAll(resp.Body)
-		return AnalysisResult{}, fmt.Errorf("API error %d: %s", resp.StatusCode, string(b))
+		return AnalysisResult{}, &APIStatusError{
+			StatusCode: resp.StatusCode,
+			Body:       string(b),
+			RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+		}
 	}
 
+	var result AnalysisResult
 	ct := resp.Header.Get("Content-Type")
-	if strings.Contains(ct, "application/json") {
-		result, err := parseJSONResponse(ctx, resp.Body, onChunk)
-		if err != nil {
-			return AnalysisResult{}, err
-		}
-		result.DurationMs = time.Since(startedAt).Milliseconds()
-		return result, nil
-	}
-	if !strings.Contains(ct, "text/event-stream") {
+	switch {
+	case strings.Contains(ct, "text/event-stream"):
+		result, err = provider.parseStream(ctx, resp.Body, out)
+	case strings.Contains(ct, "json"):
+		// application/json for non-streaming proxies, application/x-ndjson for Ollama.
+		result, err = provider.parseJSON(ctx, resp.Body, out)
+	default:
 		b, _ := io.ReadAll(resp.Body)
 		return AnalysisResult{}, fmt.Errorf("非预期的响应类型 %s: %s", ct, string(b[:min(len(b), 200)]))
 	}
-
-	result, err := parseSSEResponse(ctx, resp.Body, onChunk)
 	if err != nil {
 		return AnalysisResult{}, err
 	}
+	usedTokens = result.TotalTokens
 	result.DurationMs = time.Since(startedAt).Milliseconds()
+	if cacheKey != "" {
+		result.cacheKey = cacheKey
+		s.storeCachedResponse(cacheKey, in.Channel.Model, result)
+	}
 	return result, nil
 }
 
-func parseSSEResponse(ctx context.Context, r io.Reader, onChunk func(string)) (AnalysisResult, error) {
-	var full strings.Builder
+// chatCall carries everything a provider needs to build one completion request.
+// Schema is only set in structured mode.
+type chatCall struct {
+	Channel models.AIChannel
+	System  string
+	User    string
+	Mode    string
+	Schema  string
+	Options models.GenerationOptions
+}
+
+// chatProvider adapts one vendor API to the shared AnalysisResult.
+type chatProvider interface {
+	newRequest(ctx context.Context, call chatCall) (*http.Request, error)
+	parseStream(ctx context.Context, r io.Reader, out streamSink) (AnalysisResult, error)
+	parseJSON(ctx context.Context, r io.Reader, out streamSink) (AnalysisResult, error)
+}
+
+// streamSink receives a reply as it arrives; answer text and reasoning go to
+// separate callbacks. Both are non-nil.
+type streamSink struct {
+	onChunk     func(string)
+	onReasoning func(string)
+}
+
+// streamPiece is what one stream event contributes to the reply.
+type streamPiece struct {
+	Text      string
+	Reasoning string
+	Usage     *usage
+}
+
+func providerFor(channel models.AIChannel) chatProvider {
+	switch NormalizeProvider(channel.Provider) {
+	case ProviderAnthropic:
+		return anthropicProvider{}
+	case ProviderGemini:
+		return geminiProvider{}
+	case ProviderOllama:
+		return ollamaProvider{}
+	default:
+		return openAIProvider{}
+	}
+}
+
+func NormalizeProvider(provider string) string {
+	provider = strings.ToLower(strings.TrimSpace(provider))
+	if provider == "" {
+		return ProviderOpenAI
+	}
+	return provider
+}
+
+func IsSupportedProvider(provider string) bool {
+	switch NormalizeProvider(provider) {
+	case ProviderOpenAI, ProviderAnthropic, ProviderGemini, ProviderOllama:
+		return true
+	default:
+		return false
+	}
+}
+
+func channelEndpoint(channel models.AIChannel, fallbackBase string, path string) string {
+	base := strings.TrimRight(strings.TrimSpace(channel.BaseURL), "/")
+	if base == "" {
+		base = fallbackBase
+	}
+	return base + path
+}
+
+func newJSONRequest(ctx context.Context, url string, payload any) (*http.Request, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return req, nil
+}
+
+type openAIProvider struct{}
+
+func (openAIProvider) newRequest(ctx context.Context, call chatCall) (*http.Request, error) {
+	reqBody := chatRequest{
+		Model: call.Channel.Model,
+		Messages: []chatMessage{
+			{Role: "system", Content: call.System},
+			{Role: "user", Content: call.User},
+		},
+		Stream:        true,
+		StreamOptions: &streamOptions{IncludeUsage: true},
+		Temperature:   call.Options.Temperature,
+		TopP:          call.Options.TopP,
+		MaxTokens:     call.Options.MaxTokens,
+		Stop:          call.Options.Stop,
+		Seed:          call.Options.Seed,
+	}
+	switch {
+	case call.Schema != "":
+		reqBody.ResponseFormat = map[string]any{
+			"type": "json_schema",
+			"json_schema": map[string]any{
+				"name":   "analysis_result",
+				"schema": json.RawMessage(call.Schema),
+			},
+		}
+	case call.Mode == AnalysisModeStructured:
+		reqBody.ResponseFormat = map[string]any{"type": "json_object"}
+	}
+
+	req, err := newJSONRequest(ctx, channelEndpoint(call.Channel, "", "/chat/completions"), reqBody)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+call.Channel.APIKey)
+	return req, nil
+}
+
+func (openAIProvider) parseStream(ctx context.Context, r io.Reader, out streamSink) (AnalysisResult, error) {
+	return parseSSEResponse(ctx, r, out)
+}
+
+func (openAIProvider) parseJSON(ctx context.Context, r io.Reader, out streamSink) (AnalysisResult, error) {
+	return parseJSONResponse(ctx, r, out)
+}
+
+// streamDecoder turns one SSE data payload into incremental text, reasoning
+// and, when the payload reports it, token usage.
+type streamDecoder func(data string) (streamPiece, error)
+
+func readSSEStream(ctx context.Context, r io.Reader, out streamSink, decode streamDecoder) (AnalysisResult, error) {
+	var full, reasoning strings.Builder
 	var usageData usage
 	scanner := bufio.NewScanner(r)
 	scanner.Buffer(make([]byte, 0, 64*1024), 2*1024*1024)
@@ -177,40 +386,87 @@ func parseSSEResponse(ctx context.Context, r io.Reader, onChunk func(string)) (A
 			break
 		}
 
-		var chunk streamChunk
-		if json.Unmarshal([]byte(data), &chunk) != nil {
-			continue
+		piece, err := decode(data)
+		if err != nil {
+			return AnalysisResult{}, err
 		}
-		if chunk.Error != nil && chunk.Error.Message != "" {
-			return AnalysisResult{}, errors.New(chunk.Error.Message)
+		if piece.Usage != nil {
+			mergeUsage(&usageData, *piece.Usage)
 		}
-		if chunk.Usage != nil {
-			usageData = *chunk.Usage
+		if piece.Reasoning != "" {
+			reasoning.WriteString(piece.Reasoning)
+			out.onReasoning(piece.Reasoning)
 		}
-
-		text := pickChoiceContent(chunk.Choices)
-		if text == "" {
-			continue
+		if piece.Text != "" {
+			full.WriteString(piece.Text)
+			out.onChunk(piece.Text)
 		}
-		full.WriteString(text)
-		onChunk(text)
 	}
 	if err := scanner.Err(); err != nil {
 		return AnalysisResult{}, err
 	}
-	if full.Len() == 0 {
+	return finishResult(full.String(), reasoning.String(), usageData)
+}
+
+// finishResult rejects replies without an answer. A reply that is all
+// reasoning usually means max_tokens ran out while the model was thinking.
+func finishResult(text, reasoning string, u usage) (AnalysisResult, error) {
+	if text == "" {
+		if reasoning != "" {
+			return AnalysisResult{}, errors.New("API 只返回了推理内容，没有正式回答，可尝试调大 max_tokens")
+		}
 		return AnalysisResult{}, errors.New("API 返回内容为空")
 	}
+	result := resultWithUsage(text, u)
+	result.Reasoning = reasoning
+	return result, nil
+}
 
+func parseSSEResponse(ctx context.Context, r io.Reader, out streamSink) (AnalysisResult, error) {
+	return readSSEStream(ctx, r, out, func(data string) (streamPiece, error) {
+		var chunk streamChunk
+		if json.Unmarshal([]byte(data), &chunk) != nil {
+			return streamPiece{}, nil
+		}
+		if chunk.Error != nil && chunk.Error.Message != "" {
+			return streamPiece{}, errors.New(chunk.Error.Message)
+		}
+		return streamPiece{
+			Text:      pickChoiceContent(chunk.Choices),
+			Reasoning: pickChoiceReasoning(chunk.Choices),
+			Usage:     chunk.Usage,
+		}, nil
+	})
+}
+
+// mergeUsage keeps the latest non-zero counter, since some providers split
+// input and output token counts across separate stream events.
+func mergeUsage(dst *usage, src usage) {
+	if src.PromptTokens > 0 {
+		dst.PromptTokens = src.PromptTokens
+	}
+	if src.CompletionTokens > 0 {
+		dst.CompletionTokens = src.CompletionTokens
+	}
+	if src.TotalTokens > 0 {
+		dst.TotalTokens = src.TotalTokens
+	}
+}
+
+func resultWithUsage(text string, u usage) AnalysisResult {
+	total := u.TotalTokens
+	if total == 0 {
+		total = u.PromptTokens + u.CompletionTokens
+	}
 	return AnalysisResult{
-		Text:             full.String(),
-		PromptTokens:     usageData.PromptTokens,
-		CompletionTokens: usageData.CompletionTokens,
-		TotalTokens:      usageData.TotalTokens,
-	}, nil
+		Text:             text,
+		PromptTokens:     u.PromptTokens,
+		CompletionTokens: u.CompletionTokens,
+		TotalTokens:      total,
+	}
 }
 
-func parseJSONResponse(ctx context.Context, r io.Reader, onChunk func(string)) (AnalysisResult, error) {
+func parseJSONResponse(ctx context.Context, r io.Reader, out streamSink) (AnalysisResult, error) {
 	select {
 	case <-ctx.Done():
 		return AnalysisResult{}, ctx.Err()
@@ -231,26 +487,30 @@ func parseJSONResponse(ctx context.Context, r io.Reader, onChunk func(string)) (
 	}
 
 	text := pickChoiceContent(resp.Choices)
-	if text == "" {
-		return AnalysisResult{}, errors.New("API 返回内容为空")
+	reasoning := pickChoiceReasoning(resp.Choices)
+	var u usage
+	if resp.Usage != nil {
+		u = *resp.Usage
 	}
-	onChunk(text)
-
-	result := AnalysisResult{
-		Text: text,
+	result, err := finishResult(text, reasoning, u)
+	if err != nil {
+		return AnalysisResult{}, err
 	}
-	if resp.Usage != nil {
-		result.PromptTokens = resp.Usage.PromptTokens
-		result.CompletionTokens = resp.Usage.CompletionTokens
-		result.TotalTokens = resp.Usage.TotalTokens
+	if reasoning != "" {
+		out.onReasoning(reasoning)
 	}
+	out.onChunk(text)
 	return result, nil
 }
 
-func buildSystemPrompt(prompt, mode string) string {
+func buildSystemPrompt(prompt, mode, schema string) string {
 	if mode != AnalysisModeStructured {
 		return prompt
 	}
+	if schema != "" {
+		// Providers without native schema support only see it here.
+		return prompt + "\n\n请严格以 JSON 输出，且必须是一个满足以下 JSON Schema 的 JSON 对象，不要使用 Markdown 代码块。\nJSON Schema:\n" + schema
+	}
 	return prompt + `
 
 请严格以 JSON 输出，且必须是一个可解析的 JSON 对象，不要使用 Markdown 代码块。
@@ -287,3 +547,19 @@ func pickChoiceContent(choices []streamChoice) string {
 		return ""
 	}
 }
+
+func pickChoiceReasoning(choices []streamChoice) string {
+	if len(choices) == 0 {
+		return ""
+	}
+	choice := choices[0]
+	for _, text := range []string{
+		choice.Delta.ReasoningContent, choice.Delta.Reasoning,
+		choice.Message.ReasoningContent, choice.Message.Reasoning,
+	} {
+		if text != "" {
+			return text
+		}
+	}
+	return ""
+}
@@ -0,0 +1,171 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+const (
+	defaultAnthropicBaseURL   = "https://api.anthropic.com/v1"
+	anthropicAPIVersion       = "2023-06-01"
+	anthropicDefaultMaxTokens = 4096
+)
+
+type anthropicMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type anthropicRequest struct {
+	Model         string             `json:"model"`
+	System        string             `json:"system,omitempty"`
+	Messages      []anthropicMessage `json:"messages"`
+	MaxTokens     int                `json:"max_tokens"`
+	Stream        bool               `json:"stream"`
+	Temperature   *float64           `json:"temperature,omitempty"`
+	TopP          *float64           `json:"top_p,omitempty"`
+	StopSequences []string           `json:"stop_sequences,omitempty"`
+}
+
+type anthropicUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+type anthropicContentBlock struct {
+	Type     string `json:"type"`
+	Text     string `json:"text"`
+	Thinking string `json:"thinking"`
+}
+
+type anthropicDelta struct {
+	Type     string `json:"type"`
+	Text     string `json:"text"`
+	Thinking string `json:"thinking"`
+}
+
+type anthropicEvent struct {
+	Type    string `json:"type"`
+	Message *struct {
+		Usage anthropicUsage `json:"usage"`
+	} `json:"message,omitempty"`
+	Delta *anthropicDelta `json:"delta,omitempty"`
+	Usage *anthropicUsage `json:"usage,omitempty"`
+	Error *apiError       `json:"error,omitempty"`
+}
+
+type anthropicResponse struct {
+	Content []anthropicContentBlock `json:"content"`
+	Usage   anthropicUsage          `json:"usage"`
+	Error   *apiError               `json:"error,omitempty"`
+}
+
+type anthropicProvider struct{}
+
+// newRequest drops Seed: the Messages API has no equivalent parameter.
+func (anthropicProvider) newRequest(ctx context.Context, call chatCall) (*http.Request, error) {
+	maxTokens := call.Options.MaxTokens
+	if maxTokens <= 0 {
+		// max_tokens is mandatory for the Messages API.
+		maxTokens = anthropicDefaultMaxTokens
+	}
+	reqBody := anthropicRequest{
+		Model:         call.Channel.Model,
+		System:        call.System,
+		Messages:      []anthropicMessage{{Role: "user", Content: call.User}},
+		MaxTokens:     maxTokens,
+		Stream:        true,
+		Temperature:   call.Options.Temperature,
+		TopP:          call.Options.TopP,
+		StopSequences: call.Options.Stop,
+	}
+
+	req, err := newJSONRequest(ctx, channelEndpoint(call.Channel, defaultAnthropicBaseURL, "/messages"), reqBody)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("x-api-key", call.Channel.APIKey)
+	req.Header.Set("anthropic-version", anthropicAPIVersion)
+	return req, nil
+}
+
+func (anthropicProvider) parseStream(ctx context.Context, r io.Reader, out streamSink) (AnalysisResult, error) {
+	return readSSEStream(ctx, r, out, func(data string) (streamPiece, error) {
+		var ev anthropicEvent
+		if json.Unmarshal([]byte(data), &ev) != nil {
+			return streamPiece{}, nil
+		}
+		switch ev.Type {
+		case "error":
+			if ev.Error != nil && ev.Error.Message != "" {
+				return streamPiece{}, errors.New(ev.Error.Message)
+			}
+			return streamPiece{}, errors.New("Anthropic 流式响应返回错误")
+		case "message_start":
+			if ev.Message != nil {
+				return streamPiece{Usage: &usage{PromptTokens: ev.Message.Usage.InputTokens}}, nil
+			}
+		case "content_block_delta":
+			if ev.Delta == nil {
+				break
+			}
+			switch ev.Delta.Type {
+			case "text_delta":
+				return streamPiece{Text: ev.Delta.Text}, nil
+			case "thinking_delta":
+				return streamPiece{Reasoning: ev.Delta.Thinking}, nil
+			}
+		case "message_delta":
+			if ev.Usage != nil {
+				return streamPiece{Usage: &usage{CompletionTokens: ev.Usage.OutputTokens}}, nil
+			}
+		}
+		return streamPiece{}, nil
+	})
+}
+
+func (anthropicProvider) parseJSON(ctx context.Context, r io.Reader, out streamSink) (AnalysisResult, error) {
+	if err := ctx.Err(); err != nil {
+		return AnalysisResult{}, err
+	}
+
+	body, err := io.ReadAll(r)
+	if err != nil {
+		return AnalysisResult{}, err
+	}
+
+	var resp anthropicResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return AnalysisResult{}, fmt.Errorf("解析 JSON 响应失败: %w", err)
+	}
+	if resp.Error != nil && resp.Error.Message != "" {
+		return AnalysisResult{}, errors.New(resp.Error.Message)
+	}
+
+	var text, reasoning strings.Builder
+	for _, block := range resp.Content {
+		switch block.Type {
+		case "text":
+			text.WriteString(block.Text)
+		case "thinking":
+			reasoning.WriteString(block.Thinking)
+		}
+	}
+	result, err := finishResult(text.String(), reasoning.String(), usage{
+		PromptTokens:     resp.Usage.InputTokens,
+		CompletionTokens: resp.Usage.OutputTokens,
+	})
+	if err != nil {
+		return AnalysisResult{}, err
+	}
+	if result.Reasoning != "" {
+		out.onReasoning(result.Reasoning)
+	}
+	out.onChunk(result.Text)
+	return result, nil
+}
@@ -0,0 +1,186 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const defaultGeminiBaseURL = "https://generativelanguage.googleapis.com/v1beta"
+
+type geminiPart struct {
+	Text string `json:"text"`
+	// Thought marks thought-summary parts of thinking models.
+	Thought bool `json:"thought,omitempty"`
+}
+
+type geminiContent struct {
+	Role  string       `json:"role,omitempty"`
+	Parts []geminiPart `json:"parts"`
+}
+
+type geminiGenerationConfig struct {
+	ResponseMimeType   string          `json:"responseMimeType,omitempty"`
+	ResponseJSONSchema json.RawMessage `json:"responseJsonSchema,omitempty"`
+	Temperature        *float64        `json:"temperature,omitempty"`
+	TopP               *float64        `json:"topP,omitempty"`
+	MaxOutputTokens    int             `json:"maxOutputTokens,omitempty"`
+	StopSequences      []string        `json:"stopSequences,omitempty"`
+	Seed               *int64          `json:"seed,omitempty"`
+}
+
+type geminiRequest struct {
+	SystemInstruction *geminiContent          `json:"systemInstruction,omitempty"`
+	Contents          []geminiContent         `json:"contents"`
+	GenerationConfig  *geminiGenerationConfig `json:"generationConfig,omitempty"`
+}
+
+type geminiCandidate struct {
+	Content      geminiContent `json:"content"`
+	FinishReason string        `json:"finishReason"`
+}
+
+type geminiUsage struct {
+	PromptTokenCount     int `json:"promptTokenCount"`
+	CandidatesTokenCount int `json:"candidatesTokenCount"`
+	TotalTokenCount      int `json:"totalTokenCount"`
+}
+
+type geminiResponse struct {
+	Candidates    []geminiCandidate `json:"candidates"`
+	UsageMetadata *geminiUsage      `json:"usageMetadata,omitempty"`
+	Error         *apiError         `json:"error,omitempty"`
+}
+
+type geminiProvider struct{}
+
+func (geminiProvider) newRequest(ctx context.Context, call chatCall) (*http.Request, error) {
+	reqBody := geminiRequest{
+		Contents: []geminiContent{
+			{Role: "user", Parts: []geminiPart{{Text: call.User}}},
+		},
+	}
+	if strings.TrimSpace(call.System) != "" {
+		reqBody.SystemInstruction = &geminiContent{Parts: []geminiPart{{Text: call.System}}}
+	}
+	cfg := geminiGenerationConfig{
+		Temperature:     call.Options.Temperature,
+		TopP:            call.Options.TopP,
+		MaxOutputTokens: call.Options.MaxTokens,
+		StopSequences:   call.Options.Stop,
+		Seed:            call.Options.Seed,
+	}
+	if call.Mode == AnalysisModeStructured {
+		cfg.ResponseMimeType = "application/json"
+		if call.Schema != "" {
+			cfg.ResponseJSONSchema = json.RawMessage(call.Schema)
+		}
+	}
+	if cfg.ResponseMimeType != "" || !call.Options.IsZero() {
+		reqBody.GenerationConfig = &cfg
+	}
+
+	path := "/models/" + url.PathEscape(call.Channel.Model) + ":streamGenerateContent?alt=sse"
+	req, err := newJSONRequest(ctx, channelEndpoint(call.Channel, defaultGeminiBaseURL, path), reqBody)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("x-goog-api-key", call.Channel.APIKey)
+	return req, nil
+}
+
+func (geminiProvider) parseStream(ctx context.Context, r io.Reader, out streamSink) (AnalysisResult, error) {
+	return readSSEStream(ctx, r, out, func(data string) (streamPiece, error) {
+		var chunk geminiResponse
+		if json.Unmarshal([]byte(data), &chunk) != nil {
+			return streamPiece{}, nil
+		}
+		if chunk.Error != nil && chunk.Error.Message != "" {
+			return streamPiece{}, errors.New(chunk.Error.Message)
+		}
+		text, thought := pickGeminiText(chunk.Candidates)
+		return streamPiece{Text: text, Reasoning: thought, Usage: chunk.usage()}, nil
+	})
+}
+
+// parseJSON handles proxies that ignore alt=sse and answer with either a
+// single response object or the JSON array form of streamGenerateContent.
+func (geminiProvider) parseJSON(ctx context.Context, r io.Reader, out streamSink) (AnalysisResult, error) {
+	if err := ctx.Err(); err != nil {
+		return AnalysisResult{}, err
+	}
+
+	body, err := io.ReadAll(r)
+	if err != nil {
+		return AnalysisResult{}, err
+	}
+
+	var chunks []geminiResponse
+	if trimmed := bytes.TrimSpace(body); len(trimmed) > 0 && trimmed[0] == '[' {
+		if err := json.Unmarshal(trimmed, &chunks); err != nil {
+			return AnalysisResult{}, fmt.Errorf("解析 JSON 响应失败: %w", err)
+		}
+	} else {
+		var single geminiResponse
+		if err := json.Unmarshal(trimmed, &single); err != nil {
+			return AnalysisResult{}, fmt.Errorf("解析 JSON 响应失败: %w", err)
+		}
+		chunks = append(chunks, single)
+	}
+
+	var text, reasoning strings.Builder
+	var usageData usage
+	for _, chunk := range chunks {
+		if chunk.Error != nil && chunk.Error.Message != "" {
+			return AnalysisResult{}, errors.New(chunk.Error.Message)
+		}
+		answer, thought := pickGeminiText(chunk.Candidates)
+		text.WriteString(answer)
+		reasoning.WriteString(thought)
+		if u := chunk.usage(); u != nil {
+			mergeUsage(&usageData, *u)
+		}
+	}
+	result, err := finishResult(text.String(), reasoning.String(), usageData)
+	if err != nil {
+		return AnalysisResult{}, err
+	}
+	if result.Reasoning != "" {
+		out.onReasoning(result.Reasoning)
+	}
+	out.onChunk(result.Text)
+	return result, nil
+}
+
+func (r geminiResponse) usage() *usage {
+	if r.UsageMetadata == nil {
+		return nil
+	}
+	return &usage{
+		PromptTokens:     r.UsageMetadata.PromptTokenCount,
+		CompletionTokens: r.UsageMetadata.CandidatesTokenCount,
+		TotalTokens:      r.UsageMetadata.TotalTokenCount,
+	}
+}
+
+// pickGeminiText splits the first candidate into answer text and thoughts.
+func pickGeminiText(candidates []geminiCandidate) (string, string) {
+	if len(candidates) == 0 {
+		return "", ""
+	}
+	var text, thought strings.Builder
+	for _, part := range candidates[0].Content.Parts {
+		if part.Thought {
+			thought.WriteString(part.Text)
+		} else {
+			text.WriteString(part.Text)
+		}
+	}
+	return text.String(), thought.String()
+}
@@ -0,0 +1,131 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+)
+
+const defaultOllamaBaseURL = "http://localhost:11434"
+
+type ollamaRequest struct {
+	Model    string          `json:"model"`
+	Messages []chatMessage   `json:"messages"`
+	Stream   bool            `json:"stream"`
+	Format   json.RawMessage `json:"format,omitempty"`
+	Options  *ollamaOptions  `json:"options,omitempty"`
+}
+
+type ollamaOptions struct {
+	Temperature *float64 `json:"temperature,omitempty"`
+	TopP        *float64 `json:"top_p,omitempty"`
+	NumPredict  int      `json:"num_predict,omitempty"`
+	Stop        []string `json:"stop,omitempty"`
+	Seed        *int64   `json:"seed,omitempty"`
+}
+
+type ollamaChunk struct {
+	Message struct {
+		Content  string `json:"content"`
+		Thinking string `json:"thinking"`
+	} `json:"message"`
+	Done            bool   `json:"done"`
+	PromptEvalCount int    `json:"prompt_eval_count"`
+	EvalCount       int    `json:"eval_count"`
+	Error           string `json:"error"`
+}
+
+type ollamaProvider struct{}
+
+func (ollamaProvider) newRequest(ctx context.Context, call chatCall) (*http.Request, error) {
+	reqBody := ollamaRequest{
+		Model: call.Channel.Model,
+		Messages: []chatMessage{
+			{Role: "system", Content: call.System},
+			{Role: "user", Content: call.User},
+		},
+		Stream: true,
+	}
+	// format takes either "json" or a JSON Schema object.
+	switch {
+	case call.Schema != "":
+		reqBody.Format = json.RawMessage(call.Schema)
+	case call.Mode == AnalysisModeStructured:
+		reqBody.Format = json.RawMessage(`"json"`)
+	}
+	if !call.Options.IsZero() {
+		reqBody.Options = &ollamaOptions{
+			Temperature: call.Options.Temperature,
+			TopP:        call.Options.TopP,
+			NumPredict:  call.Options.MaxTokens,
+			Stop:        call.Options.Stop,
+			Seed:        call.Options.Seed,
+		}
+	}
+
+	// Users often paste the OpenAI-compatible ".../v1" address; the native
+	// chat API lives at the server root.
+	channel := call.Channel
+	channel.BaseURL = strings.TrimSuffix(strings.TrimRight(strings.TrimSpace(channel.BaseURL), "/"), "/v1")
+
+	req, err := newJSONRequest(ctx, channelEndpoint(channel, defaultOllamaBaseURL, "/api/chat"), reqBody)
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(channel.APIKey) != "" {
+		req.Header.Set("Authorization", "Bearer "+channel.APIKey)
+	}
+	return req, nil
+}
+
+func (p ollamaProvider) parseStream(ctx context.Context, r io.Reader, out streamSink) (AnalysisResult, error) {
+	return p.parseJSON(ctx, r, out)
+}
+
+// parseJSON reads newline-delimited JSON; a non-streaming reply is simply a
+// stream with a single line.
+func (ollamaProvider) parseJSON(ctx context.Context, r io.Reader, out streamSink) (AnalysisResult, error) {
+	var full, reasoning strings.Builder
+	var usageData usage
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 2*1024*1024)
+	for scanner.Scan() {
+		select {
+		case <-ctx.Done():
+			return AnalysisResult{}, ctx.Err()
+		default:
+		}
+
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var chunk ollamaChunk
+		if json.Unmarshal([]byte(line), &chunk) != nil {
+			continue
+		}
+		if chunk.Error != "" {
+			return AnalysisResult{}, errors.New(chunk.Error)
+		}
+		if chunk.Message.Thinking != "" {
+			reasoning.WriteString(chunk.Message.Thinking)
+			out.onReasoning(chunk.Message.Thinking)
+		}
+		if chunk.Message.Content != "" {
+			full.WriteString(chunk.Message.Content)
+			out.onChunk(chunk.Message.Content)
+		}
+		if chunk.Done {
+			mergeUsage(&usageData, usage{PromptTokens: chunk.PromptEvalCount, CompletionTokens: chunk.EvalCount})
+			break
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return AnalysisResult{}, err
+	}
+	return finishResult(full.String(), reasoning.String(), usageData)
+}
@@ -0,0 +1,506 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"stock-report-analysis/internal/llmtest"
+	"stock-report-analysis/internal/models"
+)
+
+func TestParseSSEResponse(t *testing.T) {
+	tests := []struct {
+		name          string
+		stream        string
+		wantText      string
+		wantReasoning string
+		wantTotal     int
+		wantErr       string
+	}{
+		{
+			name: "chunks and usage",
+			stream: `data: {"choices":[{"delta":{"content":"利润"}}]}
+
+data: {"choices":[{"delta":{"content":"增长"}}]}
+
+data: {"choices":[],"usage":{"prompt_tokens":10,"completion_tokens":4,"total_tokens":14}}
+
+data: [DONE]
+`,
+			wantText:  "利润增长",
+			wantTotal: 14,
+		},
+		{
+			name: "reasoning before answer",
+			stream: `data: {"choices":[{"delta":{"reasoning_content":"先看营收"}}]}
+data: {"choices":[{"delta":{"content":"结论"}}]}
+data: [DONE]
+`,
+			wantText:      "结论",
+			wantReasoning: "先看营收",
+		},
+		{
+			name: "usage split across events",
+			stream: `data: {"choices":[{"delta":{"content":"a"}}],"usage":{"prompt_tokens":7}}
+data: {"choices":[],"usage":{"completion_tokens":3}}
+`,
+			wantText:  "a",
+			wantTotal: 10,
+		},
+		{
+			name: "stops at done",
+			stream: `data: {"choices":[{"delta":{"content":"a"}}]}
+data: [DONE]
+data: {"choices":[{"delta":{"content":"b"}}]}
+`,
+			wantText: "a",
+		},
+		{
+			name: "ignores comments and bad json",
+			stream: `: keep-alive
+data: not-json
+data: {"choices":[{"delta":{"content":"a"}}]}
+`,
+			wantText: "a",
+		},
+		{
+			name: "error event",
+			stream: `data: {"choices":[{"delta":{"content":"a"}}]}
+data: {"error":{"message":"upstream overloaded"}}
+`,
+			wantErr: "upstream overloaded",
+		},
+		{
+			name:    "reasoning only",
+			stream:  `data: {"choices":[{"delta":{"reasoning_content":"想了很久"}}]}`,
+			wantErr: "只返回了推理内容",
+		},
+		{
+			name:    "empty",
+			stream:  "data: [DONE]\n",
+			wantErr: "返回内容为空",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var chunks, reasoning strings.Builder
+			result, err := parseSSEResponse(context.Background(), strings.NewReader(tt.stream), streamSink{
+				onChunk:     func(s string) { chunks.WriteString(s) },
+				onReasoning: func(s string) { reasoning.WriteString(s) },
+			})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			if result.Text != tt.wantText || chunks.String() != tt.wantText {
+				t.Errorf("text = %q, streamed %q, want %q", result.Text, chunks.String(), tt.wantText)
+			}
+			if result.Reasoning != tt.wantReasoning || reasoning.String() != tt.wantReasoning {
+				t.Errorf("reasoning = %q, streamed %q, want %q", result.Reasoning, reasoning.String(), tt.wantReasoning)
+			}
+			if result.TotalTokens != tt.wantTotal {
+				t.Errorf("total tokens = %d, want %d", result.TotalTokens, tt.wantTotal)
+			}
+		})
+	}
+}
+
+func TestParseSSEResponseCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := parseSSEResponse(ctx, strings.NewReader(`data: {"choices":[{"delta":{"content":"a"}}]}`), streamSink{
+		onChunk:     func(string) {},
+		onReasoning: func(string) {},
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want context.Canceled", err)
+	}
+}
+
+func TestProviderParsers(t *testing.T) {
+	tests := []struct {
+		name           string
+		provider       chatProvider
+		nonStreaming   bool // parseJSON instead of parseStream
+		body           string
+		wantText       string
+		wantReasoning  string
+		wantPrompt     int
+		wantCompletion int
+		wantTotal      int
+		wantErr        string
+	}{
+		{
+			name:     "anthropic stream",
+			provider: anthropicProvider{},
+			body: `event: message_start
+data: {"type":"message_start","message":{"usage":{"input_tokens":25,"output_tokens":1}}}
+
+event: content_block_delta
+data: {"type":"content_block_delta","index":0,"delta":{"type":"thinking_delta","thinking":"先看营收"}}
+
+event: content_block_delta
+data: {"type":"content_block_delta","index":1,"delta":{"type":"text_delta","text":"利润"}}
+
+event: ping
+data: {"type":"ping"}
+
+event: content_block_delta
+data: {"type":"content_block_delta","index":1,"delta":{"type":"text_delta","text":"增长"}}
+
+event: message_delta
+data: {"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"output_tokens":12}}
+
+event: message_stop
+data: {"type":"message_stop"}
+`,
+			wantText:       "利润增长",
+			wantReasoning:  "先看营收",
+			wantPrompt:     25,
+			wantCompletion: 12,
+			wantTotal:      37,
+		},
+		{
+			name:     "anthropic error event",
+			provider: anthropicProvider{},
+			body: `data: {"type":"content_block_delta","delta":{"type":"text_delta","text":"a"}}
+data: {"type":"error","error":{"type":"overloaded_error","message":"Overloaded"}}
+`,
+			wantErr: "Overloaded",
+		},
+		{
+			name:           "anthropic json",
+			provider:       anthropicProvider{},
+			nonStreaming:   true,
+			body:           `{"content":[{"type":"thinking","thinking":"想"},{"type":"text","text":"结论"}],"usage":{"input_tokens":8,"output_tokens":3}}`,
+			wantText:       "结论",
+			wantReasoning:  "想",
+			wantPrompt:     8,
+			wantCompletion: 3,
+			wantTotal:      11,
+		},
+		{
+			name:     "gemini stream",
+			provider: geminiProvider{},
+			// usageMetadata is cumulative: each event repeats the running counts.
+			body: `data: {"candidates":[{"content":{"parts":[{"text":"先看营收","thought":true}]}}],"usageMetadata":{"promptTokenCount":30,"candidatesTokenCount":2,"totalTokenCount":32}}
+
+data: {"candidates":[{"content":{"parts":[{"text":"利润"}]}}],"usageMetadata":{"promptTokenCount":30,"candidatesTokenCount":5,"totalTokenCount":35}}
+
+data: {"candidates":[{"content":{"parts":[{"text":"增长"}]},"finishReason":"STOP"}],"usageMetadata":{"promptTokenCount":30,"candidatesTokenCount":9,"totalTokenCount":39}}
+`,
+			wantText:       "利润增长",
+			wantReasoning:  "先看营收",
+			wantPrompt:     30,
+			wantCompletion: 9,
+			wantTotal:      39,
+		},
+		{
+			name:     "gemini error",
+			provider: geminiProvider{},
+			body:     `data: {"error":{"code":429,"message":"Resource exhausted"}}`,
+			wantErr:  "Resource exhausted",
+		},
+		{
+			name:         "gemini json array",
+			provider:     geminiProvider{},
+			nonStreaming: true,
+			body: `[{"candidates":[{"content":{"parts":[{"text":"想","thought":true},{"text":"利润"}]}}],"usageMetadata":{"promptTokenCount":12,"candidatesTokenCount":2,"totalTokenCount":14}},
+{"candidates":[{"content":{"parts":[{"text":"增长"}]}}],"usageMetadata":{"promptTokenCount":12,"candidatesTokenCount":4,"totalTokenCount":16}}]`,
+			wantText:       "利润增长",
+			wantReasoning:  "想",
+			wantPrompt:     12,
+			wantCompletion: 4,
+			wantTotal:      16,
+		},
+		{
+			name:         "gemini json object",
+			provider:     geminiProvider{},
+			nonStreaming: true,
+			body:         `{"candidates":[{"content":{"parts":[{"text":"结论"}]}}]}`,
+			wantText:     "结论",
+		},
+		{
+			name:     "ollama stream",
+			provider: ollamaProvider{},
+			body: `{"message":{"role":"assistant","content":"","thinking":"先看营收"},"done":false}
+{"message":{"role":"assistant","content":"利润"},"done":false}
+
+{"message":{"role":"assistant","content":"增长"},"done":false}
+{"message":{"role":"assistant","content":""},"done":true,"done_reason":"stop","prompt_eval_count":18,"eval_count":6}
+`,
+			wantText:       "利润增长",
+			wantReasoning:  "先看营收",
+			wantPrompt:     18,
+			wantCompletion: 6,
+			wantTotal:      24,
+		},
+		{
+			name:           "ollama single reply",
+			provider:       ollamaProvider{},
+			nonStreaming:   true,
+			body:           `{"message":{"role":"assistant","content":"结论"},"done":true,"prompt_eval_count":5,"eval_count":2}`,
+			wantText:       "结论",
+			wantPrompt:     5,
+			wantCompletion: 2,
+			wantTotal:      7,
+		},
+		{
+			name:     "ollama error",
+			provider: ollamaProvider{},
+			body:     `{"error":"model \"qwen3\" not found, try pulling it first"}`,
+			wantErr:  "not found",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var chunks, reasoning strings.Builder
+			parse := tt.provider.parseStream
+			if tt.nonStreaming {
+				parse = tt.provider.parseJSON
+			}
+			result, err := parse(context.Background(), strings.NewReader(tt.body), streamSink{
+				onChunk:     func(s string) { chunks.WriteString(s) },
+				onReasoning: func(s string) { reasoning.WriteString(s) },
+			})
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected err: %v", err)
+			}
+			if result.Text != tt.wantText || chunks.String() != tt.wantText {
+				t.Errorf("text = %q, streamed %q, want %q", result.Text, chunks.String(), tt.wantText)
+			}
+			if result.Reasoning != tt.wantReasoning || reasoning.String() != tt.wantReasoning {
+				t.Errorf("reasoning = %q, streamed %q, want %q", result.Reasoning, reasoning.String(), tt.wantReasoning)
+			}
+			if result.PromptTokens != tt.wantPrompt || result.CompletionTokens != tt.wantCompletion || result.TotalTokens != tt.wantTotal {
+				t.Errorf("usage = %d/%d/%d, want %d/%d/%d", result.PromptTokens, result.CompletionTokens, result.TotalTokens, tt.wantPrompt, tt.wantCompletion, tt.wantTotal)
+			}
+		})
+	}
+}
+
+func TestAnalyzeStreamsFromServer(t *testing.T) {
+	svc := newTestService(t)
+	srv := llmtest.New(t)
+	srv.Enqueue(llmtest.Reply{
+		Reasoning: []string{"思考"},
+		Chunks:    []string{"营收", "增长"},
+		Usage:     &llmtest.Usage{PromptTokens: 20, CompletionTokens: 5, TotalTokens: 25},
+	})
+
+	var streamed []string
+	result, err := svc.AnalyzeArticleDetailedWithContext(context.Background(), srv.Channel(), "请解读", "正文内容", AnalysisModeText, func(s string) {
+		streamed = append(streamed, s)
+	})
+	if err != nil {
+		t.Fatalf("analyze: %v", err)
+	}
+	if result.Text != "营收增长" || result.Reasoning != "思考" {
+		t.Errorf("result = %q / %q", result.Text, result.Reasoning)
+	}
+	if result.PromptTokens != 20 || result.CompletionTokens != 5 || result.TotalTokens != 25 {
+		t.Errorf("usage = %d/%d/%d", result.PromptTokens, result.CompletionTokens, result.TotalTokens)
+	}
+	if strings.Join(streamed, "|") != "营收|增长" {
+		t.Errorf("streamed = %q", streamed)
+	}
+
+	reqs := srv.Requests()
+	if len(reqs) != 1 {
+		t.Fatalf("requests = %d, want 1", len(reqs))
+	}
+	req := reqs[0]
+	if req.Model != "fake-model" || req.Auth != "Bearer test-key" || !req.Stream {
+		t.Errorf("request = %+v", req)
+	}
+	if !strings.Contains(req.System(), "请解读") || req.User() != "正文内容" {
+		t.Errorf("messages = %+v", req.Messages)
+	}
+}
+
+func TestAnalyzeJSONReply(t *testing.T) {
+	svc := newTestService(t)
+	srv := llmtest.New(t)
+	reply := llmtest.JSONText("一次性回答")
+	reply.Usage = &llmtest.Usage{PromptTokens: 3, CompletionTokens: 2}
+	srv.Enqueue(reply)
+
+	result, err := svc.AnalyzeArticleDetailedWithContext(context.Background(), srv.Channel(), "p", "c", AnalysisModeText, nil)
+	if err != nil {
+		t.Fatalf("analyze: %v", err)
+	}
+	if result.Text != "一次性回答" || result.TotalTokens != 5 {
+		t.Errorf("result = %+v", result)
+	}
+}
+
+func TestAnalyzeServerFailures(t *testing.T) {
+	svc := newTestService(t)
+	tests := []struct {
+		name  string
+		reply llmtest.Reply
+		check func(t *testing.T, err error)
+	}{
+		{
+			name:  "error event mid-stream",
+			reply: llmtest.Reply{Chunks: []string{"半句"}, StreamError: "model crashed"},
+			check: func(t *testing.T, err error) {
+				if err == nil || !strings.Contains(err.Error(), "model crashed") {
+					t.Fatalf("err = %v", err)
+				}
+			},
+		},
+		{
+			name:  "connection dropped",
+			reply: llmtest.Reply{Chunks: []string{"a", "b", "c"}, DropAfter: 1},
+			check: func(t *testing.T, err error) {
+				if err == nil {
+					t.Fatal("want error for truncated stream")
+				}
+			},
+		},
+		{
+			name:  "rate limited",
+			reply: llmtest.RateLimited("7"),
+			check: func(t *testing.T, err error) {
+				var statusErr *APIStatusError
+				if !errors.As(err, &statusErr) {
+					t.Fatalf("err = %v, want APIStatusError", err)
+				}
+				if statusErr.StatusCode != http.StatusTooManyRequests || statusErr.RetryAfter != 7*time.Second {
+					t.Errorf("status = %d, retry after = %s", statusErr.StatusCode, statusErr.RetryAfter)
+				}
+				if !isRetryableError(err) {
+					t.Error("429 should be retryable")
+				}
+			},
+		},
+		{
+			name:  "bad request",
+			reply: llmtest.Status(http.StatusBadRequest, "bad model"),
+			check: func(t *testing.T, err error) {
+				if err == nil || isRetryableError(err) {
+					t.Fatalf("err = %v, want non-retryable error", err)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := llmtest.New(t)
+			srv.Enqueue(tt.reply)
+			_, err := svc.AnalyzeArticleDetailedWithContext(context.Background(), srv.Channel(), "p", "c", AnalysisModeText, nil)
+			tt.check(t, err)
+		})
+	}
+}
+
+func TestAnalyzeSlowStreamTimesOut(t *testing.T) {
+	svc := newTestService(t)
+	srv := llmtest.New(t)
+	srv.Enqueue(llmtest.Reply{Chunks: []string{"a", "b", "c"}, Delay: 200 * time.Millisecond})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	startedAt := time.Now()
+	_, err := svc.AnalyzeArticleDetailedWithContext(ctx, srv.Channel(), "p", "c", AnalysisModeText, nil)
+	if err == nil {
+		t.Fatal("want timeout error")
+	}
+	if elapsed := time.Since(startedAt); elapsed > time.Second {
+		t.Errorf("timeout took %s", elapsed)
+	}
+}
+
+func TestAnalyzeWithFailoverRetriesRateLimit(t *testing.T) {
+	svc := newTestService(t)
+	srv := llmtest.New(t)
+	srv.Enqueue(llmtest.RateLimited("0"), llmtest.Text("重试成功"))
+	ch := srv.Channel()
+	ch.MaxRetries = 1
+
+	var retries []AnalysisAttempt
+	attempt, err := svc.AnalyzeWithFailover(context.Background(), AnalysisRequest{
+		Channel: ch,
+		Prompt:  "p",
+		Content: "c",
+		Mode:    AnalysisModeText,
+	}, nil, nil, func(a AnalysisAttempt) {
+		retries = append(retries, a)
+	})
+	if err != nil {
+		t.Fatalf("failover: %v", err)
+	}
+	if attempt.Attempt != 2 || attempt.Result.Text != "重试成功" {
+		t.Errorf("attempt = %d, text = %q", attempt.Attempt, attempt.Result.Text)
+	}
+	if len(retries) != 1 || retries[0].Err == nil {
+		t.Errorf("retries = %+v", retries)
+	}
+}
+
+func TestAnalyzeWithFailoverSwitchesChannel(t *testing.T) {
+	svc := newTestService(t)
+	primary := llmtest.New(t)
+	primary.SetFallback(llmtest.Status(http.StatusBadGateway, "down"))
+	backup := llmtest.New(t)
+	backup.Enqueue(llmtest.Text("备用渠道"))
+
+	backupCh := backup.Channel()
+	backupCh.ID = 2
+	attempt, err := svc.AnalyzeWithFailover(context.Background(), AnalysisRequest{
+		Channel: primary.Channel(),
+		Prompt:  "p",
+		Content: "c",
+		Mode:    AnalysisModeText,
+	}, []models.AIChannel{backupCh}, nil, nil)
+	if err != nil {
+		t.Fatalf("failover: %v", err)
+	}
+	if attempt.Channel.ID != 2 || attempt.Result.Text != "备用渠道" {
+		t.Errorf("attempt = %+v", attempt)
+	}
+	if len(primary.Requests()) != 1 {
+		t.Errorf("primary requests = %d, want 1", len(primary.Requests()))
+	}
+}
+
+func TestAnalyzeResponseCache(t *testing.T) {
+	svc := newTestService(t)
+	srv := llmtest.New(t)
+	srv.Enqueue(llmtest.Reply{Chunks: []string{"缓存内容"}, Usage: &llmtest.Usage{TotalTokens: 9}})
+
+	in := AnalysisRequest{Channel: srv.Channel(), Prompt: "p", Content: "c", Mode: AnalysisModeText, UseCache: true}
+	first, err := svc.AnalyzeWithRequest(context.Background(), in, nil)
+	if err != nil || first.CacheHit {
+		t.Fatalf("first = %+v, err = %v", first, err)
+	}
+	second, err := svc.AnalyzeWithRequest(context.Background(), in, nil)
+	if err != nil {
+		t.Fatalf("second: %v", err)
+	}
+	if !second.CacheHit || second.Text != "缓存内容" || second.TotalTokens != 0 {
+		t.Errorf("second = %+v", second)
+	}
+	if len(srv.Requests()) != 1 {
+		t.Errorf("requests = %d, want 1", len(srv.Requests()))
+	}
+}
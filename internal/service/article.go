@@ -8,7 +8,6 @@ import (
 	"strings"
 	"time"
 
-	"stock-report-analysis/internal/db"
 	"stock-report-analysis/internal/models"
 
 	"github.com/jmoiron/sqlx"
@@ -16,176 +15,145 @@ import (
 
 const telegraphSourcePrefixLike = "cls-telegraph:%"
 
-func GetArticles(keyword string, tagID int64) ([]models.Article, error) {
-	var articles []models.Article
-	var err error
-
-	if tagID > 0 && keyword != "" {
-		q := "%" + keyword + "%"
-		err = db.DB.Select(&articles, "SELECT a.id,a.title,a.source,a.status,a.created_at,a.analyzed_at FROM articles a JOIN article_tags at ON a.id=at.article_id WHERE at.tag_id=? AND a.source NOT LIKE ? AND (a.title LIKE ? OR a.content LIKE ?) ORDER BY a.id DESC", tagID, telegraphSourcePrefixLike, q, q)
-	} else if tagID > 0 {
-		err = db.DB.Select(&articles, "SELECT a.id,a.title,a.source,a.status,a.created_at,a.analyzed_at FROM articles a JOIN article_tags at ON a.id=at.article_id WHERE at.tag_id=? AND a.source NOT LIKE ? ORDER BY a.id DESC", tagID, telegraphSourcePrefixLike)
-	} else if keyword != "" {
-		q := "%" + keyword + "%"
-		err = db.DB.Select(&articles, "SELECT id,title,source,status,created_at,analyzed_at FROM articles WHERE source NOT LIKE ? AND (title LIKE ? OR content LIKE ?) ORDER BY id DESC", telegraphSourcePrefixLike, q, q)
-	} else {
-		err = db.DB.Select(&articles, "SELECT id,title,source,status,created_at,analyzed_at FROM articles WHERE source NOT LIKE ? ORDER BY id DESC", telegraphSourcePrefixLike)
+// GetArticles returns one page of the imported (non-telegraph) articles.
+func (s *Service) GetArticles(q models.ArticleQuery) (models.ArticlePage, error) {
+	b, err := newArticleListQuery("articles a", q)
+	if err != nil {
+		return models.ArticlePage{}, err
 	}
+	b.add("a.source NOT LIKE ?", telegraphSourcePrefixLike)
+	b.sortBy(q.Sort, false)
+
+	total, err := b.count(s)
 	if err != nil {
-		return nil, err
+		return models.ArticlePage{}, err
+	}
+	limit := pageLimit(q.Limit)
+	var articles []models.Article
+	if err := b.selectPage(s, &articles, "a.id,a.title,a.source,a.status,a.created_at,a.analyzed_at", q.Cursor, limit); err != nil {
+		return models.ArticlePage{}, err
 	}
-	if err := loadArticleTags(&articles); err != nil {
-		return nil, err
+	page := models.ArticlePage{Total: total}
+	if len(articles) > limit {
+		articles = articles[:limit]
+		page.NextCursor = formatCursor(articles[limit-1].ID)
 	}
-	return articles, nil
+	if err := s.loadArticleTags(&articles); err != nil {
+		return models.ArticlePage{}, err
+	}
+	page.Items = articles
+	if page.Items == nil {
+		page.Items = []models.Article{}
+	}
+	return page, nil
 }
 
-func GetTelegraphArticles(keyword string, tagID int64, order string, watchOnly int) ([]models.TelegraphArticleItem, error) {
-	var articles []models.TelegraphArticleItem
-	var err error
-
-	orderBy := "a.id DESC"
-	if order == "score_desc" {
-		orderBy = "COALESCE(tm.importance_score, 0) DESC, a.id DESC"
-	}
-	if order == "watch_first" {
-		orderBy = "COALESCE(wh.watch_matched, 0) DESC, COALESCE(tm.importance_score, 0) DESC, a.id DESC"
-	}
-	watchFilter := ""
-	if watchOnly == 1 {
-		watchFilter = " AND COALESCE(wh.watch_matched, 0) > 0"
-	}
-
-	if tagID > 0 && keyword != "" {
-		q := "%" + keyword + "%"
-		err = db.DB.Select(&articles, fmt.Sprintf(`
-			SELECT
-				a.id, a.title, a.source, a.status, a.created_at, a.analyzed_at,
-				COALESCE(tm.importance_score, 0) AS importance_score,
-				COALESCE(tm.impact_direction, '中性') AS impact_direction,
-				COALESCE(tm.impact_level, '低') AS impact_level,
-				COALESCE(wh.watch_matched, 0) AS watch_matched
-			FROM articles a
-			JOIN article_tags at ON a.id = at.article_id
-			LEFT JOIN telegraph_meta tm ON a.id = tm.article_id
-			LEFT JOIN (
-				SELECT article_id, COUNT(*) AS watch_matched
-				FROM telegraph_watch_hits
-				GROUP BY article_id
-			) wh ON a.id = wh.article_id
-			WHERE a.source LIKE ? AND at.tag_id=? AND (a.title LIKE ? OR a.content LIKE ?) %s
-			ORDER BY %s
-		`, watchFilter, orderBy), telegraphSourcePrefixLike, tagID, q, q)
-	} else if tagID > 0 {
-		err = db.DB.Select(&articles, fmt.Sprintf(`
-			SELECT
-				a.id, a.title, a.source, a.status, a.created_at, a.analyzed_at,
-				COALESCE(tm.importance_score, 0) AS importance_score,
-				COALESCE(tm.impact_direction, '中性') AS impact_direction,
-				COALESCE(tm.impact_level, '低') AS impact_level,
-				COALESCE(wh.watch_matched, 0) AS watch_matched
-			FROM articles a
-			JOIN article_tags at ON a.id = at.article_id
-			LEFT JOIN telegraph_meta tm ON a.id = tm.article_id
-			LEFT JOIN (
-				SELECT article_id, COUNT(*) AS watch_matched
-				FROM telegraph_watch_hits
-				GROUP BY article_id
-			) wh ON a.id = wh.article_id
-			WHERE a.source LIKE ? AND at.tag_id=? %s
-			ORDER BY %s
-		`, watchFilter, orderBy), telegraphSourcePrefixLike, tagID)
-	} else if keyword != "" {
-		q := "%" + keyword + "%"
-		err = db.DB.Select(&articles, fmt.Sprintf(`
-			SELECT
-				a.id, a.title, a.source, a.status, a.created_at, a.analyzed_at,
-				COALESCE(tm.importance_score, 0) AS importance_score,
-				COALESCE(tm.impact_direction, '中性') AS impact_direction,
-				COALESCE(tm.impact_level, '低') AS impact_level,
-				COALESCE(wh.watch_matched, 0) AS watch_matched
-			FROM articles a
-			LEFT JOIN telegraph_meta tm ON a.id = tm.article_id
-			LEFT JOIN (
-				SELECT article_id, COUNT(*) AS watch_matched
-				FROM telegraph_watch_hits
-				GROUP BY article_id
-			) wh ON a.id = wh.article_id
-			WHERE a.source LIKE ? AND (a.title LIKE ? OR a.content LIKE ?) %s
-			ORDER BY %s
-		`, watchFilter, orderBy), telegraphSourcePrefixLike, q, q)
-	} else {
-		err = db.DB.Select(&articles, fmt.Sprintf(`
-			SELECT
-				a.id, a.title, a.source, a.status, a.created_at, a.analyzed_at,
-				COALESCE(tm.importance_score, 0) AS importance_score,
-				COALESCE(tm.impact_direction, '中性') AS impact_direction,
-				COALESCE(tm.impact_level, '低') AS impact_level,
-				COALESCE(wh.watch_matched, 0) AS watch_matched
-			FROM articles a
-			LEFT JOIN telegraph_meta tm ON a.id = tm.article_id
-			LEFT JOIN (
-				SELECT article_id, COUNT(*) AS watch_matched
-				FROM telegraph_watch_hits
-				GROUP BY article_id
-			) wh ON a.id = wh.article_id
-			WHERE a.source LIKE ? %s
-			ORDER BY %s
-		`, watchFilter, orderBy), telegraphSourcePrefixLike)
-	}
+const telegraphListFrom = `articles a
+	LEFT JOIN telegraph_meta tm ON a.id = tm.article_id
+	LEFT JOIN (
+		SELECT article_id, COUNT(*) AS watch_matched
+		FROM telegraph_watch_hits
+		GROUP BY article_id
+	) wh ON a.id = wh.article_id`
+
+// GetTelegraphArticles returns one page of telegraphs with their meta,
+// tags and watchlist hits.
+func (s *Service) GetTelegraphArticles(q models.ArticleQuery) (models.TelegraphArticlePage, error) {
+	b, err := newArticleListQuery(telegraphListFrom, q)
 	if err != nil {
-		return nil, err
+		return models.TelegraphArticlePage{}, err
 	}
-	if err := loadTelegraphItemTags(&articles); err != nil {
-		return nil, err
+	b.add("a.source LIKE ?", telegraphSourcePrefixLike)
+	if q.WatchOnly {
+		b.add("COALESCE(wh.watch_matched, 0) > 0")
 	}
-	if err := loadTelegraphWatchMatches(&articles); err != nil {
-		return nil, err
+	b.sortBy(q.Sort, true)
+
+	total, err := b.count(s)
+	if err != nil {
+		return models.TelegraphArticlePage{}, err
 	}
-	return articles, nil
+	limit := pageLimit(q.Limit)
+	var articles []models.TelegraphArticleItem
+	if err := b.selectPage(s, &articles, `
+		a.id, a.title, a.source, a.status, a.created_at, a.analyzed_at,
+		COALESCE(tm.importance_score, 0) AS importance_score,
+		COALESCE(tm.impact_direction, '中性') AS impact_direction,
+		COALESCE(tm.impact_level, '低') AS impact_level,
+		COALESCE(wh.watch_matched, 0) AS watch_matched`, q.Cursor, limit); err != nil {
+		return models.TelegraphArticlePage{}, err
+	}
+	page := models.TelegraphArticlePage{Total: total}
+	if len(articles) > limit {
+		articles = articles[:limit]
+		page.NextCursor = formatCursor(articles[limit-1].ID)
+	}
+	if err := s.loadTelegraphItemTags(&articles); err != nil {
+		return models.TelegraphArticlePage{}, err
+	}
+	if err := s.loadTelegraphWatchMatches(&articles); err != nil {
+		return models.TelegraphArticlePage{}, err
+	}
+	page.Items = articles
+	if page.Items == nil {
+		page.Items = []models.TelegraphArticleItem{}
+	}
+	return page, nil
 }
 
-func GetArticle(id int64) (models.Article, error) {
+func (s *Service) GetArticle(id int64) (models.Article, error) {
 	var a models.Article
-	err := db.DB.Get(&a, "SELECT * FROM articles WHERE id=?", id)
+	err := s.db.Get(&a, "SELECT * FROM articles WHERE id=?", id)
 	if err == nil {
-		a.Tags, _ = GetArticleTags(id)
+		a.Tags, _ = s.GetArticleTags(id)
 	}
 	return a, err
 }
 
-func ImportFile(filePath string) (models.Article, error) {
+// ImportFile imports a local file. A file whose bytes or normalized content
+// are already in the library returns that article instead, before the
+// document is parsed when the bytes match; see saveImport for near duplicates.
+func (s *Service) ImportFile(filePath string, force bool) (models.ImportResult, error) {
+	if !isImportableFile(filePath) {
+		return models.ImportResult{}, errors.New("不支持的文件类型，请导入 txt/md/html/pdf/图片/doc/ppt 等格式")
+	}
+
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return models.ImportResult{}, err
+	}
+	return s.importFileData(filePath, data, hashBytes(data), force)
+}
+
+// importFileData imports the already read contents of filePath.
+func (s *Service) importFileData(filePath string, data []byte, fileHash string, force bool) (models.ImportResult, error) {
 	title := strings.TrimSuffix(filepath.Base(filePath), filepath.Ext(filePath))
 	ext := strings.ToLower(filepath.Ext(filePath))
+	existing, kind, err := s.findDuplicate(articleFingerprint{fileHash: fileHash}, true)
+	if err != nil {
+		return models.ImportResult{}, err
+	}
+	if kind != "" {
+		result := duplicateResult(existing, kind)
+		result.FilePath = filePath
+		return result, nil
+	}
 
-	var content string
-	switch {
-	case isTextLikeFile(ext):
-		data, err := os.ReadFile(filePath)
+	doc := parsedDocument{Markdown: string(data)}
+	if !isTextLikeFile(ext) {
+		doc, err = s.parseDocument(filePath, fileHash)
 		if err != nil {
-			return models.Article{}, err
+			return models.ImportResult{}, fmt.Errorf("文档解析失败: %w", err)
 		}
-		content = string(data)
-	case isMinerUSupportedFile(ext):
-		parsed, err := ParseFileWithMinerU(filePath)
-		if err != nil {
-			return models.Article{}, fmt.Errorf("MinerU 解析失败: %w", err)
-		}
-		content = parsed
-	default:
-		return models.Article{}, errors.New("不支持的文件类型，请导入 txt/md/html/pdf/图片/doc/ppt 等格式")
-	}
-	content = strings.TrimSpace(content)
-	if content == "" {
-		return models.Article{}, errors.New("导入内容为空")
 	}
+	result, err := s.saveImport(title, doc, "", fileHash, force)
+	result.FilePath = filePath
+	return result, err
+}
 
-	res, err := db.DB.Exec("INSERT INTO articles(title,content) VALUES(?,?)", title, content)
-	if err != nil {
-		return models.Article{}, err
-	}
-	id, _ := res.LastInsertId()
-	return GetArticle(id)
+func isImportableFile(filePath string) bool {
+	ext := strings.ToLower(filepath.Ext(filePath))
+	return isTextLikeFile(ext) || isMinerUSupportedFile(ext)
 }
 
 func isTextLikeFile(ext string) bool {
@@ -206,38 +174,58 @@ func isMinerUSupportedFile(ext string) bool {
 	}
 }
 
-func UpdateArticleAnalysis(id int64, analysis, promptUsed, channelUsed string) error {
+func (s *Service) UpdateArticleAnalysis(id int64, analysis, promptUsed, channelUsed string) error {
+	return s.SaveArticleAnalysis(id, AnalysisOutcome{Analysis: analysis, PromptUsed: promptUsed, ChannelUsed: channelUsed})
+}
+
+// AnalysisOutcome is what one finished analysis writes back to an article.
+// Structured is nil for text-mode analyses; Reasoning is stored in the
+// history entry when non-empty.
+type AnalysisOutcome struct {
+	Analysis    string
+	PromptUsed  string
+	ChannelUsed string
+	Reasoning   string
+	Structured  *models.StructuredAnalysis
+}
+
+// SaveArticleAnalysis stores the analysis, appends it to the history and
+// replaces the parsed structured fields of the article.
+func (s *Service) SaveArticleAnalysis(id int64, out AnalysisOutcome) error {
 	now := time.Now()
-	tx, err := db.DB.Beginx()
+	tx, err := s.db.Beginx()
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
 
 	if _, err := tx.Exec("UPDATE articles SET analysis=?,prompt_used=?,channel_used=?,status=2,analyzed_at=? WHERE id=?",
-		analysis, promptUsed, channelUsed, now, id); err != nil {
+		out.Analysis, out.PromptUsed, out.ChannelUsed, now, id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("INSERT INTO analysis_history(article_id,analysis,prompt_used,channel_used,reasoning) VALUES(?,?,?,?,?)",
+		id, out.Analysis, out.PromptUsed, out.ChannelUsed, out.Reasoning); err != nil {
 		return err
 	}
-	if _, err := tx.Exec("INSERT INTO analysis_history(article_id,analysis,prompt_used,channel_used) VALUES(?,?,?,?)",
-		id, analysis, promptUsed, channelUsed); err != nil {
+	if err := saveStructuredAnalysisTx(tx, id, out.Structured); err != nil {
 		return err
 	}
 	return tx.Commit()
 }
 
-func GetAnalysisHistory(articleID int64) ([]models.AnalysisHistory, error) {
+func (s *Service) GetAnalysisHistory(articleID int64) ([]models.AnalysisHistory, error) {
 	var history []models.AnalysisHistory
-	err := db.DB.Select(&history, "SELECT * FROM analysis_history WHERE article_id=? ORDER BY id DESC", articleID)
+	err := s.db.Select(&history, "SELECT * FROM analysis_history WHERE article_id=? ORDER BY id DESC", articleID)
 	return history, err
 }
 
-func UpdateArticleStatus(id int64, status int) error {
-	_, err := db.DB.Exec("UPDATE articles SET status=? WHERE id=?", status, id)
+func (s *Service) UpdateArticleStatus(id int64, status int) error {
+	_, err := s.db.Exec("UPDATE articles SET status=? WHERE id=?", status, id)
 	return err
 }
 
-func DeleteArticle(id int64) error {
-	_, err := db.DB.Exec("DELETE FROM articles WHERE id=?", id)
+func (s *Service) DeleteArticle(id int64) error {
+	_, err := s.db.Exec("DELETE FROM articles WHERE id=?", id)
 	return err
 }
 
@@ -248,7 +236,7 @@ type articleTagRow struct {
 	TagColor  string `db:"color"`
 }
 
-func loadArticleTags(articles *[]models.Article) error {
+func (s *Service) loadArticleTags(articles *[]models.Article) error {
 	if len(*articles) == 0 {
 		return nil
 	}
@@ -273,7 +261,7 @@ func loadArticleTags(articles *[]models.Article) error {
 	}
 
 	var rows []articleTagRow
-	if err := db.DB.Select(&rows, db.DB.Rebind(q), args...); err != nil {
+	if err := s.db.Select(&rows, s.db.Rebind(q), args...); err != nil {
 		return err
 	}
 
@@ -289,7 +277,7 @@ func loadArticleTags(articles *[]models.Article) error {
 	return nil
 }
 
-func loadTelegraphItemTags(items *[]models.TelegraphArticleItem) error {
+func (s *Service) loadTelegraphItemTags(items *[]models.TelegraphArticleItem) error {
 	if len(*items) == 0 {
 		return nil
 	}
@@ -314,7 +302,7 @@ func loadTelegraphItemTags(items *[]models.TelegraphArticleItem) error {
 	}
 
 	var rows []articleTagRow
-	if err := db.DB.Select(&rows, db.DB.Rebind(q), args...); err != nil {
+	if err := s.db.Select(&rows, s.db.Rebind(q), args...); err != nil {
 		return err
 	}
 
@@ -336,7 +324,7 @@ type telegraphWatchHitRow struct {
 	Name      string `db:"stock_name"`
 }
 
-func loadTelegraphWatchMatches(items *[]models.TelegraphArticleItem) error {
+func (s *Service) loadTelegraphWatchMatches(items *[]models.TelegraphArticleItem) error {
 	if len(*items) == 0 {
 		return nil
 	}
@@ -360,7 +348,7 @@ func loadTelegraphWatchMatches(items *[]models.TelegraphArticleItem) error {
 	}
 
 	var rows []telegraphWatchHitRow
-	if err := db.DB.Select(&rows, db.DB.Rebind(q), args...); err != nil {
+	if err := s.db.Select(&rows, s.db.Rebind(q), args...); err != nil {
 		return err
 	}
 
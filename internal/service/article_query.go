@@ -0,0 +1,214 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"stock-report-analysis/internal/models"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 200
+)
+
+// articleListQuery builds the SQL of one page of an article list. Filters
+// are ANDed; keys are the sort expressions, all in the same direction and
+// ending with a.id so that every row has a unique position for the cursor.
+type articleListQuery struct {
+	from  string
+	where []string
+	args  []any
+	keys  []string
+	asc   bool
+}
+
+func (b *articleListQuery) add(clause string, args ...any) {
+	b.where = append(b.where, clause)
+	b.args = append(b.args, args...)
+}
+
+func (b *articleListQuery) whereSQL() string {
+	if len(b.where) == 0 {
+		return ""
+	}
+	return "WHERE " + strings.Join(b.where, " AND ")
+}
+
+// newArticleListQuery applies the filters both lists share. from must alias
+// articles as a.
+func newArticleListQuery(from string, q models.ArticleQuery) (*articleListQuery, error) {
+	b := &articleListQuery{from: from}
+
+	if match, args := keywordFilter(q.Keyword); match != "" {
+		b.add(match, args...)
+	}
+
+	if len(q.TagIDs) > 0 {
+		marks := placeholders(len(q.TagIDs))
+		args := make([]any, 0, len(q.TagIDs)+1)
+		for _, id := range q.TagIDs {
+			args = append(args, id)
+		}
+		switch q.TagMode {
+		case "", "any":
+			b.add(fmt.Sprintf("EXISTS (SELECT 1 FROM article_tags at WHERE at.article_id = a.id AND at.tag_id IN (%s))", marks), args...)
+		case "all":
+			args = append(args, len(uniqueInt64s(q.TagIDs)))
+			b.add(fmt.Sprintf(`a.id IN (
+				SELECT at.article_id FROM article_tags at WHERE at.tag_id IN (%s)
+				GROUP BY at.article_id HAVING COUNT(DISTINCT at.tag_id) = ?
+			)`, marks), args...)
+		default:
+			return nil, fmt.Errorf("不支持的标签匹配方式: %s", q.TagMode)
+		}
+	}
+
+	if len(q.Statuses) > 0 {
+		args := make([]any, 0, len(q.Statuses))
+		for _, status := range q.Statuses {
+			args = append(args, status)
+		}
+		b.add(fmt.Sprintf("a.status IN (%s)", placeholders(len(q.Statuses))), args...)
+	}
+
+	var sources []string
+	var sourceArgs []any
+	for _, source := range q.Sources {
+		if source = strings.TrimSpace(source); source != "" {
+			sources = append(sources, `a.source LIKE ? ESCAPE '\'`)
+			sourceArgs = append(sourceArgs, "%"+escapeLike(source)+"%")
+		}
+	}
+	if len(sources) > 0 {
+		b.add("("+strings.Join(sources, " OR ")+")", sourceArgs...)
+	}
+
+	for _, r := range []struct {
+		column, from, to string
+	}{
+		{"a.created_at", q.CreatedFrom, q.CreatedTo},
+		{"a.analyzed_at", q.AnalyzedFrom, q.AnalyzedTo},
+	} {
+		if r.from != "" {
+			if err := checkDate(r.from); err != nil {
+				return nil, err
+			}
+			b.add(fmt.Sprintf("date(%s, 'localtime') >= ?", r.column), r.from)
+		}
+		if r.to != "" {
+			if err := checkDate(r.to); err != nil {
+				return nil, err
+			}
+			b.add(fmt.Sprintf("date(%s, 'localtime') <= ?", r.column), r.to)
+		}
+	}
+	return b, nil
+}
+
+// sortBy sets the sort keys for sort, falling back to newest first.
+// telegraph enables the keys that need the telegraph meta joins.
+func (b *articleListQuery) sortBy(sort string, telegraph bool) {
+	b.asc = false
+	switch {
+	case sort == "created_asc":
+		b.keys, b.asc = []string{"a.id"}, true
+	case sort == "analyzed_desc":
+		b.keys = []string{"COALESCE(a.analyzed_at, '')", "a.id"}
+	case sort == "score_desc" && telegraph:
+		b.keys = []string{"COALESCE(tm.importance_score, 0)", "a.id"}
+	case sort == "watch_first" && telegraph:
+		b.keys = []string{"COALESCE(wh.watch_matched, 0)", "COALESCE(tm.importance_score, 0)", "a.id"}
+	default:
+		b.keys = []string{"a.id"}
+	}
+}
+
+func (b *articleListQuery) count(s *Service) (int, error) {
+	var total int
+	err := s.db.Get(&total, fmt.Sprintf("SELECT COUNT(*) FROM %s %s", b.from, b.whereSQL()), b.args...)
+	return total, err
+}
+
+// pageLimit normalizes the requested page size.
+func pageLimit(limit int) int {
+	if limit <= 0 || limit > maxPageSize {
+		return defaultPageSize
+	}
+	return limit
+}
+
+// selectPage selects columns of the rows after cursor into dest. It loads
+// one row more than limit so the caller can tell whether a page follows.
+func (b *articleListQuery) selectPage(s *Service, dest any, columns, cursor string, limit int) error {
+	where, args := b.where, b.args
+	if cursor != "" {
+		cursorID, err := strconv.ParseInt(cursor, 10, 64)
+		if err != nil || cursorID <= 0 {
+			return errors.New("无效的分页游标")
+		}
+		var exists int
+		if err := s.db.Get(&exists, "SELECT COUNT(*) FROM articles WHERE id=?", cursorID); err != nil {
+			return err
+		}
+		if exists == 0 {
+			return errors.New("分页游标对应的文章已删除，请刷新列表")
+		}
+		// Row values compare key by key, which is the sort order itself.
+		op := "<"
+		if b.asc {
+			op = ">"
+		}
+		keys := strings.Join(b.keys, ", ")
+		where = append(append([]string(nil), where...),
+			fmt.Sprintf("(%s) %s (SELECT %s FROM %s WHERE a.id = ?)", keys, op, keys, b.from))
+		args = append(append([]any(nil), args...), cursorID)
+	}
+
+	direction := " DESC"
+	if b.asc {
+		direction = " ASC"
+	}
+	order := make([]string, 0, len(b.keys))
+	for _, key := range b.keys {
+		order = append(order, key+direction)
+	}
+	whereSQL := ""
+	if len(where) > 0 {
+		whereSQL = "WHERE " + strings.Join(where, " AND ")
+	}
+
+	return s.db.Select(dest, fmt.Sprintf("SELECT %s FROM %s %s ORDER BY %s LIMIT ?",
+		columns, b.from, whereSQL, strings.Join(order, ", ")), append(args, limit+1)...)
+}
+
+// formatCursor returns the cursor of the page that follows the row id.
+func formatCursor(id int64) string {
+	return strconv.FormatInt(id, 10)
+}
+
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?,", n), ",")
+}
+
+func uniqueInt64s(values []int64) []int64 {
+	seen := make(map[int64]bool, len(values))
+	out := make([]int64, 0, len(values))
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func checkDate(day string) error {
+	if _, err := time.Parse("2006-01-02", day); err != nil {
+		return fmt.Errorf("日期格式应为 YYYY-MM-DD: %s", day)
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package service
+
+import (
+	"fmt"
+	"testing"
+
+	"stock-report-analysis/internal/models"
+)
+
+func articleTitles(items []models.Article) []string {
+	titles := make([]string, 0, len(items))
+	for _, a := range items {
+		titles = append(titles, a.Title)
+	}
+	return titles
+}
+
+func TestGetArticlesPagesWithCursor(t *testing.T) {
+	svc := newTestService(t)
+	for _, title := range []string{"一", "二", "三", "四", "五"} {
+		insertTestArticle(t, svc, title, "正文")
+	}
+	svc.db.MustExec("INSERT INTO articles(title, content, source) VALUES('电报', '正文', 'cls-telegraph:1')")
+
+	var seen []string
+	q := models.ArticleQuery{Limit: 2}
+	for pages := 0; ; pages++ {
+		if pages > 3 {
+			t.Fatal("cursor does not advance")
+		}
+		page, err := svc.GetArticles(q)
+		if err != nil {
+			t.Fatalf("page %d: %v", pages, err)
+		}
+		if page.Total != 5 {
+			t.Fatalf("total = %d, want 5", page.Total)
+		}
+		seen = append(seen, articleTitles(page.Items)...)
+		if page.NextCursor == "" {
+			break
+		}
+		q.Cursor = page.NextCursor
+	}
+	if got := fmt.Sprint(seen); got != "[五 四 三 二 一]" {
+		t.Fatalf("pages = %s", got)
+	}
+
+	page, err := svc.GetArticles(models.ArticleQuery{Sort: "created_asc", Limit: 3})
+	if err != nil || fmt.Sprint(articleTitles(page.Items)) != "[一 二 三]" {
+		t.Fatalf("created_asc = %v, %v", articleTitles(page.Items), err)
+	}
+	if _, err := svc.GetArticles(models.ArticleQuery{Cursor: "abc"}); err == nil {
+		t.Fatal("expected an error for a malformed cursor")
+	}
+}
+
+func TestGetArticlesFilters(t *testing.T) {
+	svc := newTestService(t)
+	a := insertTestArticle(t, svc, "甲", "正文")
+	b := insertTestArticle(t, svc, "乙", "正文")
+	insertTestArticle(t, svc, "丙", "正文")
+	svc.db.MustExec("UPDATE articles SET status=2, source='https://example.com/report', analyzed_at='2026-03-02 08:00:00', created_at='2026-03-01 08:00:00' WHERE id=?", a)
+	svc.db.MustExec("INSERT INTO tags(id, name) VALUES(1, '新能源'), (2, '港股')")
+	svc.db.MustExec("INSERT INTO article_tags(article_id, tag_id) VALUES(?, 1), (?, 2), (?, 1)", a, a, b)
+
+	tests := []struct {
+		name string
+		q    models.ArticleQuery
+		want string
+	}{
+		{"tags any", models.ArticleQuery{TagIDs: []int64{1, 2}}, "[乙 甲]"},
+		{"tags all", models.ArticleQuery{TagIDs: []int64{1, 2}, TagMode: "all"}, "[甲]"},
+		{"status", models.ArticleQuery{Statuses: []int{2}}, "[甲]"},
+		{"source", models.ArticleQuery{Sources: []string{"example.com"}}, "[甲]"},
+		{"created range", models.ArticleQuery{CreatedFrom: "2026-02-28", CreatedTo: "2026-03-01"}, "[甲]"},
+		{"analyzed range", models.ArticleQuery{AnalyzedFrom: "2026-03-03"}, "[]"},
+	}
+	for _, tt := range tests {
+		page, err := svc.GetArticles(tt.q)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got := fmt.Sprint(articleTitles(page.Items)); got != tt.want || page.Total != len(page.Items) {
+			t.Errorf("%s = %s (total %d), want %s", tt.name, got, page.Total, tt.want)
+		}
+	}
+
+	if _, err := svc.GetArticles(models.ArticleQuery{CreatedFrom: "2026/03/01"}); err == nil {
+		t.Fatal("expected an error for a malformed date")
+	}
+}
+
+func TestGetTelegraphArticlesWatchFirst(t *testing.T) {
+	svc := newTestService(t)
+	svc.db.MustExec("INSERT INTO articles(id, title, content, source) VALUES(1, '普通', '正文', 'cls-telegraph:1'), (2, '重要', '正文', 'cls-telegraph:2'), (3, '自选', '正文', 'cls-telegraph:3')")
+	svc.db.MustExec("INSERT INTO telegraph_meta(article_id, importance_score) VALUES(1, 10), (2, 90), (3, 20)")
+	svc.db.MustExec("INSERT INTO telegraph_watch_hits(article_id, stock_code, stock_name) VALUES(3, '600519', '贵州茅台')")
+
+	var titles []string
+	q := models.ArticleQuery{Sort: "watch_first", Limit: 1}
+	for {
+		page, err := svc.GetTelegraphArticles(q)
+		if err != nil {
+			t.Fatalf("telegraph page: %v", err)
+		}
+		for _, item := range page.Items {
+			titles = append(titles, item.Title)
+		}
+		if page.NextCursor == "" || len(titles) > 3 {
+			break
+		}
+		q.Cursor = page.NextCursor
+	}
+	if got := fmt.Sprint(titles); got != "[自选 重要 普通]" {
+		t.Fatalf("watch_first = %s", got)
+	}
+
+	page, err := svc.GetTelegraphArticles(models.ArticleQuery{WatchOnly: true})
+	if err != nil || page.Total != 1 || page.Items[0].WatchMatched != 1 {
+		t.Fatalf("watch only = %+v, %v", page, err)
+	}
+}
@@ -0,0 +1,290 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// BM25 parameters, the usual defaults.
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// financeSynonyms lists terms research reports write several ways, each
+// under the form it is indexed as. Segmentation matches the longest form
+// first, so "归母净利润" is one term rather than "归母" plus "净利润".
+var financeSynonyms = map[string][]string{
+	"营收":     {"营业收入", "营业总收入", "主营业务收入", "主营收入", "收入", "revenue"},
+	"净利润":    {"归属于母公司股东的净利润", "归母净利润", "归母净利", "净利"},
+	"扣非净利润":  {"扣非归母净利润", "扣除非经常性损益后的净利润", "扣非净利", "扣非"},
+	"毛利率":    {"销售毛利率", "毛利润率"},
+	"净利率":    {"销售净利率"},
+	"市盈率":    {"pe", "p/e"},
+	"市净率":    {"pb", "p/b"},
+	"每股收益":   {"eps"},
+	"净资产收益率": {"roe"},
+	"目标价":    {"目标价格", "目标股价"},
+	"评级":     {"投资评级"},
+	"同比":     {"yoy"},
+	"环比":     {"qoq"},
+	"资本开支":   {"资本支出", "capex"},
+	"经营现金流":  {"经营活动现金流", "经营性现金流", "经营活动产生的现金流量净额"},
+	"研发费用":   {"研发投入", "研发支出"},
+	"市值":     {"总市值"},
+	"分红":     {"股息", "派息"},
+	"资产负债率":  {"负债率"},
+	"增长":     {"增速"},
+	"下降":     {"下滑", "减少"},
+}
+
+// financeTerms maps every form in financeSynonyms, canonical ones
+// included, to its canonical form.
+var financeTerms, financeTermMaxRunes = func() (map[string]string, int) {
+	terms := map[string]string{}
+	longest := 0
+	for canonical, forms := range financeSynonyms {
+		for _, form := range append([]string{canonical}, forms...) {
+			terms[form] = canonical
+			longest = max(longest, len([]rune(form)))
+		}
+	}
+	return terms, longest
+}()
+
+// queryStopTerms are the question words segmentation leaves in a question,
+// which say nothing about what it asks for.
+var queryStopTerms = map[string]bool{
+	"多少": true, "什么": true, "如何": true, "怎么": true, "怎样": true, "是否": true, "哪些": true,
+	"为什": true, "请问": true, "一下": true, "是多": true, "是什": true, "有哪": true, "能否": true,
+	"可以": true, "吗": true, "呢": true, "的": true, "了": true, "是": true,
+}
+
+var (
+	searchTokenPattern = regexp.MustCompile(`\p{Han}+|\d+(?:\.\d+)?%?|[a-z][a-z0-9]*(?:/[a-z]+)?`)
+	digitGroupPattern  = regexp.MustCompile(`(\d),(\d{3})`)
+)
+
+// segmentSearchText splits text into BM25 terms: finance terms by their
+// canonical form, other Chinese as overlapping character bigrams, numbers
+// with trailing zeros trimmed (a percentage also yields the bare number)
+// and lowercase words of two letters or more. Width and case are folded
+// first.
+func segmentSearchText(text string) []string {
+	text = strings.ToLower(norm.NFKC.String(text))
+	for digitGroupPattern.MatchString(text) {
+		text = digitGroupPattern.ReplaceAllString(text, "$1$2")
+	}
+	var tokens []string
+	for _, m := range searchTokenPattern.FindAllString(text, -1) {
+		switch first := m[0]; {
+		case first >= '0' && first <= '9':
+			number, percent := strings.CutSuffix(m, "%")
+			if strings.Contains(number, ".") {
+				number = strings.TrimRight(strings.TrimRight(number, "0"), ".")
+			}
+			tokens = append(tokens, number)
+			if percent {
+				tokens = append(tokens, number+"%")
+			}
+		case first < 0x80:
+			if canonical, ok := financeTerms[m]; ok {
+				tokens = append(tokens, canonical)
+				continue
+			}
+			for _, word := range strings.Split(m, "/") {
+				if canonical, ok := financeTerms[word]; ok {
+					tokens = append(tokens, canonical)
+				} else if len(word) > 1 {
+					tokens = append(tokens, word)
+				}
+			}
+		default:
+			tokens = appendHanTerms(tokens, []rune(m))
+		}
+	}
+	return tokens
+}
+
+// appendHanTerms segments a run of Chinese characters by forward maximum
+// matching against financeTerms, covering the rest with bigrams. A run of
+// one character is kept as is.
+func appendHanTerms(tokens []string, run []rune) []string {
+	if len(run) == 1 {
+		return append(tokens, string(run))
+	}
+	for i := 0; i < len(run); {
+		matched := 0
+		for n := min(financeTermMaxRunes, len(run)-i); n >= 2; n-- {
+			if canonical, ok := financeTerms[string(run[i:i+n])]; ok {
+				tokens = append(tokens, canonical)
+				matched = n
+				break
+			}
+		}
+		if matched > 0 {
+			i += matched
+			continue
+		}
+		// A bigram running into a finance term would tie it to whatever
+		// precedes it, e.g. "年营" in "年营业收入".
+		if i+1 < len(run) && !startsFinanceTerm(run[i+1:]) {
+			tokens = append(tokens, string(run[i:i+2]))
+		}
+		i++
+	}
+	return tokens
+}
+
+func startsFinanceTerm(run []rune) bool {
+	for n := min(financeTermMaxRunes, len(run)); n >= 2; n-- {
+		if _, ok := financeTerms[string(run[:n])]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// queryTerms returns the distinct terms of a question, without question
+// words.
+func queryTerms(question string) []string {
+	seen := map[string]bool{}
+	var terms []string
+	for _, t := range segmentSearchText(question) {
+		if seen[t] || queryStopTerms[t] {
+			continue
+		}
+		seen[t] = true
+		terms = append(terms, t)
+	}
+	return terms
+}
+
+// ensureTermStats counts the terms of a section, its heading path
+// included, unless they were loaded with it. Terms holds the counts as the
+// JSON stored in article_chunks.terms and TermCount their total.
+func (ch *articleChunk) ensureTermStats() {
+	if ch.Terms != "" {
+		return
+	}
+	freqs := map[string]int{}
+	total := 0
+	for _, t := range segmentSearchText(ch.HeadingPath + "\n" + ch.Text) {
+		freqs[t]++
+		total++
+	}
+	data, _ := json.Marshal(freqs)
+	ch.Terms, ch.TermCount = string(data), total
+}
+
+func (ch *articleChunk) termFreqs() map[string]int {
+	ch.ensureTermStats()
+	var freqs map[string]int
+	if err := json.Unmarshal([]byte(ch.Terms), &freqs); err != nil {
+		// Unreadable stats are counted again.
+		ch.Terms = ""
+		ch.ensureTermStats()
+		json.Unmarshal([]byte(ch.Terms), &freqs)
+	}
+	return freqs
+}
+
+// rankChunksBM25 scores chunks against the question with BM25 over the
+// chunks given, and returns the best k that match any term in document
+// order. When none does, the first k are returned unscored.
+func rankChunksBM25(question string, chunks []articleChunk, k int) []articleChunk {
+	return topChunks(scoreChunksBM25(question, chunks), k, func(ch articleChunk) float64 { return ch.Score })
+}
+
+// scoreChunksBM25 returns copies of chunks with Score and Matched set.
+func scoreChunksBM25(question string, chunks []articleChunk) []articleChunk {
+	if len(chunks) == 0 {
+		return nil
+	}
+	terms := queryTerms(question)
+	freqs := make([]map[string]int, len(chunks))
+	df := map[string]int{}
+	totalLen := 0
+	for i := range chunks {
+		freqs[i] = chunks[i].termFreqs()
+		totalLen += chunks[i].TermCount
+		for _, t := range terms {
+			if freqs[i][t] > 0 {
+				df[t]++
+			}
+		}
+	}
+	avgLen := math.Max(float64(totalLen)/float64(len(chunks)), 1)
+	n := float64(len(chunks))
+
+	scored := make([]articleChunk, len(chunks))
+	for i, ch := range chunks {
+		ch.Score, ch.Matched = 0, nil
+		lengthNorm := bm25K1 * (1 - bm25B + bm25B*float64(ch.TermCount)/avgLen)
+		for _, t := range terms {
+			tf := float64(freqs[i][t])
+			if tf == 0 {
+				continue
+			}
+			idf := math.Log(1 + (n-float64(df[t])+0.5)/(float64(df[t])+0.5))
+			ch.Score += idf * tf * (bm25K1 + 1) / (tf + lengthNorm)
+			ch.Matched = append(ch.Matched, t)
+		}
+		scored[i] = ch
+	}
+	return scored
+}
+
+// topChunks returns the k chunks ranking highest among those rank puts
+// above zero, in the order given; the first k when there are none.
+func topChunks(chunks []articleChunk, k int, rank func(articleChunk) float64) []articleChunk {
+	if len(chunks) == 0 {
+		return nil
+	}
+	if k <= 0 {
+		k = 6
+	}
+	k = min(k, len(chunks))
+
+	ranks := make([]float64, len(chunks))
+	var picked []int
+	for i, ch := range chunks {
+		if ranks[i] = rank(ch); ranks[i] > 0 {
+			picked = append(picked, i)
+		}
+	}
+	if len(picked) == 0 {
+		return append([]articleChunk(nil), chunks[:k]...)
+	}
+
+	sort.SliceStable(picked, func(i, j int) bool { return ranks[picked[i]] > ranks[picked[j]] })
+	picked = picked[:min(k, len(picked))]
+	sort.Ints(picked)
+	selected := make([]articleChunk, len(picked))
+	for i, pos := range picked {
+		selected[i] = chunks[pos]
+	}
+	return selected
+}
+
+// retrievalReason says why a section was retrieved, as stored in
+// qa_evidences.reason.
+func retrievalReason(ch articleChunk) string {
+	var parts []string
+	if ch.Score > 0 {
+		parts = append(parts, fmt.Sprintf("BM25 %.2f，命中：%s", ch.Score, strings.Join(ch.Matched, "、")))
+	}
+	if ch.Similarity > 0 {
+		parts = append(parts, fmt.Sprintf("语义相似度 %.2f", ch.Similarity))
+	}
+	if len(parts) == 0 {
+		return "未命中检索词，按原文顺序选取"
+	}
+	return strings.Join(parts, "；")
+}
@@ -0,0 +1,87 @@
+package service
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"stock-report-analysis/internal/llmtest"
+)
+
+func TestSegmentSearchText(t *testing.T) {
+	cases := map[string][]string{
+		"归母净利润同比增长":        {"净利润", "同比", "增长"},
+		"营业收入 1,234.50 亿元": {"营收", "1234.5", "亿元"},
+		"毛利率提升至３５％":        {"毛利率", "提升", "升至", "35", "35%"},
+		"PE 与 P/E、EPS":     {"市盈率", "与", "市盈率", "每股收益"},
+		"储能":               {"储能"},
+	}
+	for text, want := range cases {
+		if got := segmentSearchText(text); !reflect.DeepEqual(got, want) {
+			t.Errorf("segmentSearchText(%q) = %q, want %q", text, got, want)
+		}
+	}
+	if got := queryTerms("公司的营收是多少？"); !reflect.DeepEqual(got, []string{"公司", "司的", "营收"}) {
+		t.Errorf("queryTerms = %q", got)
+	}
+}
+
+func TestRankChunksBM25(t *testing.T) {
+	chunks := []articleChunk{
+		{Index: 1, HeadingPath: "投资要点", Text: "维持买入评级，公司是全球动力电池龙头。"},
+		{Index: 2, HeadingPath: "储能业务", Text: "储能出货量同比增长 60%，海外订单占比提升。"},
+		{Index: 3, HeadingPath: "盈利预测", Text: "预计 2026 年营业收入 4200 亿元，归母净利润 600 亿元，对应市盈率 18 倍。"},
+		{Index: 4, HeadingPath: "风险提示", Text: "原材料价格波动，下游需求不及预期。"},
+	}
+	got := rankChunksBM25("我想了解一下这家公司 2026 年的营收和净利润预测分别是多少", chunks, 1)
+	if len(got) != 1 || got[0].Index != 3 {
+		t.Fatalf("ranked = %+v, want the forecast section", got)
+	}
+	if reason := retrievalReason(got[0]); !strings.HasPrefix(reason, "BM25 ") || !strings.Contains(reason, "营收") || !strings.Contains(reason, "净利润") {
+		t.Errorf("reason = %q", reason)
+	}
+
+	got = rankChunksBM25("PE 多少倍", chunks, 2)
+	if len(got) != 1 || got[0].Index != 3 {
+		t.Errorf("synonym ranked = %+v", got)
+	}
+
+	got = rankChunksBM25("总结", chunks, 2)
+	if len(got) != 2 || got[0].Index != 1 || got[1].Index != 2 || retrievalReason(got[0]) != "未命中检索词，按原文顺序选取" {
+		t.Errorf("fallback = %+v", got)
+	}
+}
+
+func TestAskQuestionStoresRetrievalReason(t *testing.T) {
+	svc := newTestService(t)
+	srv := llmtest.New(t)
+	saveDefaultChannel(t, svc, srv)
+	articleID := insertTestArticle(t, svc, "t", "## 储能业务\n储能出货量同比增长 60%。\n\n## 盈利预测\n预计归母净利润 600 亿元。")
+	// Sections stored before term counts existed get them on first use.
+	article, err := svc.GetArticle(articleID)
+	if err != nil {
+		t.Fatalf("article: %v", err)
+	}
+	if _, err := svc.articleChunks(article); err != nil {
+		t.Fatalf("chunks: %v", err)
+	}
+	svc.db.MustExec("UPDATE article_chunks SET terms='', term_count=0")
+
+	srv.Enqueue(llmtest.Text("600 亿元"))
+	rec := &qaRecorder{}
+	if _, err := svc.AskQuestionWithContextAndFollowUp(context.Background(), 0, articleID, "净利润预测是多少？", 0, rec.callbacks()); err != nil {
+		t.Fatalf("ask: %v", err)
+	}
+	messages, err := svc.GetQAMessages(rec.sessionID)
+	if err != nil || len(messages) != 2 || len(messages[1].Evidences) != 1 {
+		t.Fatalf("messages = %+v, err = %v", messages, err)
+	}
+	if ev := messages[1].Evidences[0]; ev.HeadingPath != "盈利预测" || !strings.Contains(ev.Reason, "净利润") {
+		t.Errorf("evidence = %+v", ev)
+	}
+	var missing int
+	if err := svc.db.Get(&missing, "SELECT COUNT(*) FROM article_chunks WHERE terms=''"); err != nil || missing != 0 {
+		t.Errorf("chunks without terms = %d, err = %v", missing, err)
+	}
+}
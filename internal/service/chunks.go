@@ -0,0 +1,348 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/jmoiron/sqlx"
+	"golang.org/x/net/html"
+
+	"stock-report-analysis/internal/models"
+)
+
+// articleChunkMaxRunes is the longest a QA section grows before it is
+// split; a section split this way keeps its heading path.
+const articleChunkMaxRunes = 900
+
+// articleChunk is a section of an article QA retrieves from. Pages are
+// 1-based and 0 when the source has no page layout. Terms and TermCount
+// are its BM25 statistics, see ensureTermStats; Score and Matched are set
+// by scoreChunksBM25, Similarity by rankChunksHybrid. ArticleID and
+// ArticleTitle are set by articleChunks, for evidence across articles.
+type articleChunk struct {
+	ID           int64    `db:"id"`
+	Index        int      `db:"chunk_index"`
+	HeadingPath  string   `db:"heading_path"`
+	PageStart    int      `db:"page_start"`
+	PageEnd      int      `db:"page_end"`
+	Text         string   `db:"text"`
+	Terms        string   `db:"terms"`
+	TermCount    int      `db:"term_count"`
+	Score        float64  `db:"-"`
+	Matched      []string `db:"-"`
+	Similarity   float64  `db:"-"`
+	ArticleID    int64    `db:"-"`
+	ArticleTitle string   `db:"-"`
+}
+
+// layoutBlock is a heading or paragraph of a parsed document. Level is the
+// heading level, 0 for body text; Page is 1-based, 0 when unknown.
+type layoutBlock struct {
+	Text  string
+	Level int
+	Page  int
+}
+
+var markdownHeadingPattern = regexp.MustCompile(`^(#{1,6})\s+(.+?)(\s+#+)?$`)
+
+// markdownBlocks splits markdown into one block per line, taking levels
+// from # headings. Markdown carries no pages.
+func markdownBlocks(content string) []layoutBlock {
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+	var blocks []layoutBlock
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if m := markdownHeadingPattern.FindStringSubmatch(line); m != nil {
+			blocks = append(blocks, layoutBlock{Text: m[2], Level: len(m[1])})
+			continue
+		}
+		blocks = append(blocks, layoutBlock{Text: line})
+	}
+	return blocks
+}
+
+// mineruLayoutBlocks turns a MinerU content list into blocks with the page
+// each sits on. Tables contribute their caption and rows, images their
+// caption only.
+func mineruLayoutBlocks(items []mineruContentItem) []layoutBlock {
+	var blocks []layoutBlock
+	for _, item := range items {
+		page := item.PageIdx + 1
+		var lines []string
+		switch item.Type {
+		case "text", "equation":
+			if item.TextLevel > 0 {
+				blocks = append(blocks, layoutBlock{Text: strings.TrimSpace(item.Text), Level: item.TextLevel, Page: page})
+				continue
+			}
+			lines = strings.Split(item.Text, "\n")
+		case "list":
+			lines = item.ListItems
+		case assetKindTable:
+			lines = append([]string{mineruItemCaption(item)}, strings.Split(tableHTMLText(item.TableBody), "\n")...)
+		case assetKindImage:
+			lines = []string{mineruItemCaption(item)}
+		}
+		for _, line := range lines {
+			if line = strings.TrimSpace(line); line != "" {
+				blocks = append(blocks, layoutBlock{Text: line, Page: page})
+			}
+		}
+	}
+	return blocks
+}
+
+// tableHTMLText renders a table's HTML as one line per row, cells
+// separated by " | ".
+func tableHTMLText(body string) string {
+	if strings.TrimSpace(body) == "" {
+		return ""
+	}
+	root, err := html.Parse(strings.NewReader(body))
+	if err != nil {
+		return ""
+	}
+	var b strings.Builder
+	renderReadableText(&b, root)
+	return collapseBlankLines(b.String())
+}
+
+var (
+	chineseChapterHeading = regexp.MustCompile(`^(第[一二三四五六七八九十百\d]+[章节部分篇]|[一二三四五六七八九十]+、)`)
+	chineseSectionHeading = regexp.MustCompile(`^[（(][一二三四五六七八九十]+[）)]`)
+	numberedHeading       = regexp.MustCompile(`^\d{1,2}(\.\d{1,2}){1,3}\s*([^\s亿万千百元倍个%\d.])`)
+)
+
+// plainTextHeadingLevel guesses whether a line of text without markup is a
+// heading, from the numbering research reports use: "第一章"/"一、" are
+// level 1, "（一）" level 2 and "1.2.3" one level per number, unless a
+// unit follows the number as in "3.5 亿元". Long lines and lines ending like
+// a sentence are body text.
+func plainTextHeadingLevel(line string) int {
+	if utf8.RuneCountInString(line) > 30 || strings.ContainsAny(line, "。；;") {
+		return 0
+	}
+	if last, _ := utf8.DecodeLastRuneInString(line); strings.ContainsRune("，,：:", last) {
+		return 0
+	}
+	switch {
+	case chineseChapterHeading.MatchString(line):
+		return 1
+	case chineseSectionHeading.MatchString(line):
+		return 2
+	case numberedHeading.MatchString(line):
+		return min(strings.Count(strings.Fields(line)[0], ".")+1, 6)
+	}
+	return 0
+}
+
+// pdfPageBlocks turns the text of each PDF page into blocks, one per line,
+// guessing headings from their numbering.
+func pdfPageBlocks(pages []string) []layoutBlock {
+	var blocks []layoutBlock
+	for i, page := range pages {
+		for _, line := range strings.Split(page, "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				blocks = append(blocks, layoutBlock{Text: line, Level: plainTextHeadingLevel(line), Page: i + 1})
+			}
+		}
+	}
+	return blocks
+}
+
+// buildSectionChunks groups blocks into sections: every heading starts a
+// new one, and a section longer than maxLen runes is split. Each chunk
+// records the path of headings above it and the pages it spans. Headings
+// directly followed by another heading only appear in the path.
+func buildSectionChunks(blocks []layoutBlock, maxLen int) []articleChunk {
+	if maxLen <= 0 {
+		maxLen = articleChunkMaxRunes
+	}
+	var chunks []articleChunk
+	var headings []layoutBlock
+	var current strings.Builder
+	hasBody := false
+	chunk := articleChunk{}
+	flush := func() {
+		if hasBody {
+			chunk.Index = len(chunks) + 1
+			chunk.Text = current.String()
+			chunks = append(chunks, chunk)
+		}
+		current.Reset()
+		hasBody = false
+		chunk = articleChunk{HeadingPath: chunk.HeadingPath}
+	}
+	add := func(text string, page int) {
+		if current.Len() > 0 {
+			current.WriteString("\n")
+		}
+		current.WriteString(text)
+		if page > 0 {
+			if chunk.PageStart == 0 {
+				chunk.PageStart = page
+			}
+			chunk.PageEnd = max(chunk.PageEnd, page)
+		}
+	}
+
+	for _, block := range blocks {
+		text := strings.TrimSpace(block.Text)
+		if text == "" {
+			continue
+		}
+		if block.Level > 0 {
+			flush()
+			for len(headings) > 0 && headings[len(headings)-1].Level >= block.Level {
+				headings = headings[:len(headings)-1]
+			}
+			headings = append(headings, layoutBlock{Text: text, Level: block.Level})
+			names := make([]string, len(headings))
+			for i, h := range headings {
+				names[i] = h.Text
+			}
+			chunk.HeadingPath = strings.Join(names, " > ")
+			add(text, block.Page)
+			continue
+		}
+		if hasBody && utf8.RuneCountInString(current.String())+1+utf8.RuneCountInString(text) > maxLen {
+			flush()
+		}
+		add(text, block.Page)
+		hasBody = true
+	}
+	flush()
+	return chunks
+}
+
+// buildArticleChunks splits markdown content into sections at its headings.
+func buildArticleChunks(content string, maxLen int) []articleChunk {
+	chunks := buildSectionChunks(markdownBlocks(content), maxLen)
+	if len(chunks) == 0 && strings.TrimSpace(content) != "" {
+		chunks = append(chunks, articleChunk{Index: 1, Text: trimToRunes(strings.TrimSpace(content), maxLen)})
+	}
+	return chunks
+}
+
+// documentChunks builds the QA sections of a parsed document, from its
+// layout when the parser returned one.
+func documentChunks(doc parsedDocument) []articleChunk {
+	if chunks := buildSectionChunks(doc.Blocks, articleChunkMaxRunes); len(chunks) > 0 {
+		return chunks
+	}
+	return buildArticleChunks(doc.Markdown, articleChunkMaxRunes)
+}
+
+func saveArticleChunksTx(tx *sqlx.Tx, articleID int64, chunks []articleChunk) error {
+	for i := range chunks {
+		ch := &chunks[i]
+		ch.ensureTermStats()
+		res, err := tx.Exec(`
+			INSERT INTO article_chunks(article_id, chunk_index, heading_path, page_start, page_end, text, terms, term_count)
+			VALUES(?,?,?,?,?,?,?,?)
+		`, articleID, ch.Index, ch.HeadingPath, ch.PageStart, ch.PageEnd, ch.Text, ch.Terms, ch.TermCount)
+		if err != nil {
+			return err
+		}
+		if ch.ID, err = res.LastInsertId(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// articleChunks returns the stored QA sections of an article. Articles
+// imported before sections were stored get them built on first use, with
+// pages when their cached MinerU result still matches the content.
+func (s *Service) articleChunks(article models.Article) ([]articleChunk, error) {
+	chunks, err := s.loadArticleChunks(article)
+	for i := range chunks {
+		chunks[i].ArticleID, chunks[i].ArticleTitle = article.ID, article.Title
+	}
+	return chunks, err
+}
+
+func (s *Service) loadArticleChunks(article models.Article) ([]articleChunk, error) {
+	var chunks []articleChunk
+	if err := s.db.Select(&chunks, `
+		SELECT id, chunk_index, heading_path, page_start, page_end, text, terms, term_count
+		FROM article_chunks
+		WHERE article_id=?
+		ORDER BY chunk_index ASC
+	`, article.ID); err != nil {
+		return nil, err
+	}
+	if len(chunks) > 0 {
+		for i := range chunks {
+			if chunks[i].Terms != "" {
+				continue
+			}
+			chunks[i].ensureTermStats()
+			if _, err := s.db.Exec("UPDATE article_chunks SET terms=?, term_count=? WHERE id=?",
+				chunks[i].Terms, chunks[i].TermCount, chunks[i].ID); err != nil {
+				log.Printf("[QA] store terms of chunk %d failed: %s", chunks[i].ID, err.Error())
+			}
+		}
+		return chunks, nil
+	}
+
+	chunks = s.buildArticleDocumentChunks(article)
+	if err := s.replaceArticleChunks(article.ID, chunks); err != nil {
+		// The sections still serve this question; they are built again
+		// next time.
+		log.Printf("[QA] store chunks of article %d failed: %s", article.ID, err.Error())
+		for i := range chunks {
+			chunks[i].ID = 0
+		}
+	}
+	return chunks, nil
+}
+
+// buildArticleDocumentChunks builds the QA sections of a stored article,
+// with pages when its cached MinerU result still matches the content.
+func (s *Service) buildArticleDocumentChunks(article models.Article) []articleChunk {
+	doc := parsedDocument{Markdown: article.Content}
+	if data := s.cachedMinerUResult(article.FileHash); data != nil {
+		if cached, err := readMinerUResult(data); err == nil && cached.Markdown == strings.TrimSpace(article.Content) {
+			doc = cached
+		}
+	}
+	return documentChunks(doc)
+}
+
+func (s *Service) replaceArticleChunks(articleID int64, chunks []articleChunk) error {
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec("DELETE FROM article_chunks WHERE article_id=?", articleID); err != nil {
+		return err
+	}
+	if err := saveArticleChunksTx(tx, articleID, chunks); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// chunkLocation describes where a section comes from, e.g.
+// "P12-13 · 公司深度 > 三、盈利预测"; it is empty without pages or headings.
+func chunkLocation(pageStart, pageEnd int, headingPath string) string {
+	var parts []string
+	switch {
+	case pageStart > 0 && pageEnd > pageStart:
+		parts = append(parts, fmt.Sprintf("P%d-%d", pageStart, pageEnd))
+	case pageStart > 0:
+		parts = append(parts, fmt.Sprintf("P%d", pageStart))
+	}
+	if headingPath != "" {
+		parts = append(parts, headingPath)
+	}
+	return strings.Join(parts, " · ")
+}
@@ -0,0 +1,126 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"stock-report-analysis/internal/llmtest"
+)
+
+func TestBuildSectionChunksFromMinerULayout(t *testing.T) {
+	items := []mineruContentItem{
+		{Type: "text", Text: "宁德时代深度报告", TextLevel: 1, PageIdx: 0},
+		{Type: "text", Text: "二、储能业务", TextLevel: 2, PageIdx: 4},
+		{Type: "text", Text: "储能出货量同比增长 60%。", PageIdx: 4},
+		{Type: "text", Text: "海外订单占比提升。", PageIdx: 5},
+		{Type: "text", Text: "三、盈利预测", TextLevel: 2, PageIdx: 11},
+		{Type: "table", TableCaption: []string{"表1：盈利预测"}, TableBody: "<table><tr><td>2026E</td><td>120</td></tr></table>", PageIdx: 11},
+	}
+	chunks := buildSectionChunks(mineruLayoutBlocks(items), 900)
+	if len(chunks) != 2 {
+		t.Fatalf("chunks = %+v, want one per section with body", chunks)
+	}
+	storage, forecast := chunks[0], chunks[1]
+	if storage.Index != 1 || storage.HeadingPath != "宁德时代深度报告 > 二、储能业务" || storage.PageStart != 5 || storage.PageEnd != 6 {
+		t.Errorf("storage section = %+v", storage)
+	}
+	if !strings.HasPrefix(storage.Text, "二、储能业务\n储能出货量") {
+		t.Errorf("storage text = %q", storage.Text)
+	}
+	if forecast.HeadingPath != "宁德时代深度报告 > 三、盈利预测" || forecast.PageStart != 12 || forecast.PageEnd != 12 ||
+		!strings.Contains(forecast.Text, "2026E | 120") {
+		t.Errorf("forecast section = %+v", forecast)
+	}
+	if got := chunkLocation(forecast.PageStart, forecast.PageEnd, "三、盈利预测"); got != "P12 · 三、盈利预测" {
+		t.Errorf("location = %q", got)
+	}
+}
+
+func TestBuildSectionChunksSplitsLongSections(t *testing.T) {
+	content := "## 风险提示\n" + strings.Repeat("原材料价格波动。", 10) + "\n" + strings.Repeat("需求不及预期。", 10)
+	chunks := buildArticleChunks(content, 100)
+	if len(chunks) != 2 {
+		t.Fatalf("chunks = %+v", chunks)
+	}
+	for _, ch := range chunks {
+		if ch.HeadingPath != "风险提示" || ch.PageStart != 0 {
+			t.Errorf("chunk = %+v", ch)
+		}
+	}
+}
+
+func TestPlainTextHeadingLevel(t *testing.T) {
+	cases := map[string]int{
+		"三、盈利预测":      1,
+		"第二章 行业格局":    1,
+		"（一）产能扩张":     2,
+		"3.1 盈利预测":    2,
+		"3.1.2 毛利率假设": 3,
+		"3.5 亿元":      0,
+		"2026.12":     0,
+		"一、公司营收同比增长 20%，超出预期。": 0,
+		"正文段落": 0,
+	}
+	for line, want := range cases {
+		if got := plainTextHeadingLevel(line); got != want {
+			t.Errorf("plainTextHeadingLevel(%q) = %d, want %d", line, got, want)
+		}
+	}
+}
+
+func TestAskQuestionRecordsEvidenceLocation(t *testing.T) {
+	svc := newTestService(t)
+	srv := llmtest.New(t)
+	saveDefaultChannel(t, svc, srv)
+	doc := parsedDocument{
+		Markdown: "三、盈利预测\n预计 2026 年净利润 120 亿元。",
+		Blocks: pdfPageBlocks([]string{
+			"公司深度报告",
+			"三、盈利预测\n预计 2026 年净利润 120 亿元。",
+		}),
+	}
+	imported, err := svc.saveImport("深度报告", doc, "report.pdf", "", false)
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+
+	srv.Enqueue(llmtest.Text("净利润 120 亿元"))
+	rec := &qaRecorder{}
+	if _, err := svc.AskQuestionWithContextAndFollowUp(context.Background(), 0, imported.Article.ID, "净利润预测是多少？", 0, rec.callbacks()); err != nil {
+		t.Fatalf("ask: %v", err)
+	}
+	if user := srv.Requests()[0].User(); !strings.Contains(user, "(P2 · 三、盈利预测)") {
+		t.Errorf("qa input = %q", user)
+	}
+	messages, err := svc.GetQAMessages(rec.sessionID)
+	if err != nil || len(messages) != 2 {
+		t.Fatalf("messages = %+v, err = %v", messages, err)
+	}
+	var found bool
+	for _, ev := range messages[1].Evidences {
+		if ev.HeadingPath == "三、盈利预测" && ev.PageStart == 2 && ev.PageEnd == 2 {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("evidences = %+v", messages[1].Evidences)
+	}
+}
+
+func TestArticleChunksBuiltForOlderArticles(t *testing.T) {
+	svc := newTestService(t)
+	articleID := insertTestArticle(t, svc, "t", "# 报告\n\n## 投资要点\n\n维持买入评级。")
+	article, err := svc.GetArticle(articleID)
+	if err != nil {
+		t.Fatalf("article: %v", err)
+	}
+	chunks, err := svc.articleChunks(article)
+	if err != nil || len(chunks) != 1 || chunks[0].HeadingPath != "报告 > 投资要点" {
+		t.Fatalf("chunks = %+v, err = %v", chunks, err)
+	}
+	var stored int
+	if err := svc.db.Get(&stored, "SELECT COUNT(*) FROM article_chunks WHERE article_id=?", articleID); err != nil || stored != 1 {
+		t.Errorf("stored = %d, err = %v", stored, err)
+	}
+}
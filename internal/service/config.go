@@ -2,22 +2,42 @@ package service
 
 import (
 	"errors"
+	"fmt"
 	"strings"
 
-	"stock-report-analysis/internal/db"
 	"stock-report-analysis/internal/models"
 
 	"github.com/jmoiron/sqlx"
 )
 
-func GetChannels() ([]models.AIChannel, error) {
+func (s *Service) GetChannels() ([]models.AIChannel, error) {
 	var channels []models.AIChannel
-	err := db.DB.Select(&channels, "SELECT * FROM ai_channels ORDER BY id DESC")
+	err := s.db.Select(&channels, "SELECT * FROM ai_channels ORDER BY id DESC")
 	return channels, err
 }
 
-func SaveChannel(ch models.AIChannel) error {
-	tx, err := db.DB.Beginx()
+func (s *Service) SaveChannel(ch models.AIChannel) error {
+	ch.Provider = NormalizeProvider(ch.Provider)
+	if !IsSupportedProvider(ch.Provider) {
+		return fmt.Errorf("不支持的渠道类型: %s", ch.Provider)
+	}
+	ch.MaxRetries, ch.RetryBackoffMs = channelRetryPolicy(ch)
+	ch.RPMLimit = max(ch.RPMLimit, 0)
+	ch.TPMLimit = max(ch.TPMLimit, 0)
+	ch.MaxInFlight = max(ch.MaxInFlight, 0)
+	ch.ContextWindow = max(ch.ContextWindow, 0)
+	if ch.StoreReasoning != 0 {
+		ch.StoreReasoning = 1
+	}
+	ch.InputPrice = max(ch.InputPrice, 0)
+	ch.OutputPrice = max(ch.OutputPrice, 0)
+	ch.Currency = NormalizeCurrency(ch.Currency)
+	ch.EmbeddingModel = strings.TrimSpace(ch.EmbeddingModel)
+	if ch.EmbeddingModel != "" && ch.Provider != ProviderOpenAI {
+		return errors.New("向量模型仅支持 OpenAI 兼容渠道")
+	}
+
+	tx, err := s.db.Beginx()
 	if err != nil {
 		return err
 	}
@@ -29,31 +49,31 @@ func SaveChannel(ch models.AIChannel) error {
 		}
 	}
 	if ch.ID == 0 {
-		if _, err := tx.Exec("INSERT INTO ai_channels(name,base_url,api_key,model,is_default) VALUES(?,?,?,?,?)",
-			ch.Name, ch.BaseURL, ch.APIKey, ch.Model, ch.IsDefault); err != nil {
+		if _, err := tx.Exec("INSERT INTO ai_channels(name,base_url,api_key,model,provider,max_retries,retry_backoff_ms,rpm_limit,tpm_limit,max_in_flight,context_window,store_reasoning,input_price,output_price,currency,embedding_model,is_default) VALUES(?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)",
+			ch.Name, ch.BaseURL, ch.APIKey, ch.Model, ch.Provider, ch.MaxRetries, ch.RetryBackoffMs, ch.RPMLimit, ch.TPMLimit, ch.MaxInFlight, ch.ContextWindow, ch.StoreReasoning, ch.InputPrice, ch.OutputPrice, ch.Currency, ch.EmbeddingModel, ch.IsDefault); err != nil {
 			return err
 		}
 		return tx.Commit()
 	}
-	if _, err := tx.Exec("UPDATE ai_channels SET name=?,base_url=?,api_key=?,model=?,is_default=? WHERE id=?",
-		ch.Name, ch.BaseURL, ch.APIKey, ch.Model, ch.IsDefault, ch.ID); err != nil {
+	if _, err := tx.Exec("UPDATE ai_channels SET name=?,base_url=?,api_key=?,model=?,provider=?,max_retries=?,retry_backoff_ms=?,rpm_limit=?,tpm_limit=?,max_in_flight=?,context_window=?,store_reasoning=?,input_price=?,output_price=?,currency=?,embedding_model=?,is_default=? WHERE id=?",
+		ch.Name, ch.BaseURL, ch.APIKey, ch.Model, ch.Provider, ch.MaxRetries, ch.RetryBackoffMs, ch.RPMLimit, ch.TPMLimit, ch.MaxInFlight, ch.ContextWindow, ch.StoreReasoning, ch.InputPrice, ch.OutputPrice, ch.Currency, ch.EmbeddingModel, ch.IsDefault, ch.ID); err != nil {
 		return err
 	}
 	return tx.Commit()
 }
 
-func DeleteChannel(id int64) error {
-	_, err := db.DB.Exec("DELETE FROM ai_channels WHERE id=?", id)
+func (s *Service) DeleteChannel(id int64) error {
+	_, err := s.db.Exec("DELETE FROM ai_channels WHERE id=?", id)
 	return err
 }
 
-func GetPrompts() ([]models.Prompt, error) {
+func (s *Service) GetPrompts() ([]models.Prompt, error) {
 	var prompts []models.Prompt
-	err := db.DB.Select(&prompts, "SELECT * FROM prompts ORDER BY id DESC")
+	err := s.db.Select(&prompts, "SELECT * FROM prompts ORDER BY id DESC")
 	return prompts, err
 }
 
-func SavePrompt(p models.Prompt) error {
+func (s *Service) SavePrompt(p models.Prompt) error {
 	p.Name = strings.TrimSpace(p.Name)
 	if p.Name == "" {
 		return errors.New("提示词名称不能为空")
@@ -61,8 +81,18 @@ func SavePrompt(p models.Prompt) error {
 	if strings.TrimSpace(p.Content) == "" {
 		return errors.New("提示词内容不能为空")
 	}
+	opts, err := NormalizeGenerationOptions(p.GenerationOptions)
+	if err != nil {
+		return err
+	}
+	p.GenerationOptions = opts
+	schema, err := NormalizeOutputSchema(p.OutputSchema)
+	if err != nil {
+		return err
+	}
+	p.OutputSchema = schema
 
-	tx, err := db.DB.Beginx()
+	tx, err := s.db.Beginx()
 	if err != nil {
 		return err
 	}
@@ -74,8 +104,8 @@ func SavePrompt(p models.Prompt) error {
 		}
 	}
 	if p.ID == 0 {
-		res, err := tx.Exec("INSERT INTO prompts(name,content,is_default) VALUES(?,?,?)",
-			p.Name, p.Content, p.IsDefault)
+		res, err := tx.Exec("INSERT INTO prompts(name,content,generation_options,output_schema,is_default) VALUES(?,?,?,?,?)",
+			p.Name, p.Content, p.GenerationOptions, p.OutputSchema, p.IsDefault)
 		if err != nil {
 			return err
 		}
@@ -83,7 +113,7 @@ func SavePrompt(p models.Prompt) error {
 		if err != nil {
 			return err
 		}
-		if err := insertPromptVersionTx(tx, promptID, p.Name, p.Content); err != nil {
+		if err := insertPromptVersionTx(tx, promptID, promptSnapshot(p)); err != nil {
 			return err
 		}
 		return tx.Commit()
@@ -94,29 +124,29 @@ func SavePrompt(p models.Prompt) error {
 		return err
 	}
 
-	if _, err := tx.Exec("UPDATE prompts SET name=?,content=?,is_default=? WHERE id=?",
-		p.Name, p.Content, p.IsDefault, p.ID); err != nil {
+	if _, err := tx.Exec("UPDATE prompts SET name=?,content=?,generation_options=?,output_schema=?,is_default=? WHERE id=?",
+		p.Name, p.Content, p.GenerationOptions, p.OutputSchema, p.IsDefault, p.ID); err != nil {
 		return err
 	}
-	if before.Name != p.Name || before.Content != p.Content {
-		if err := insertPromptVersionTx(tx, p.ID, p.Name, p.Content); err != nil {
+	if promptChanged(promptSnapshot(before), promptSnapshot(p)) {
+		if err := insertPromptVersionTx(tx, p.ID, promptSnapshot(p)); err != nil {
 			return err
 		}
 	}
 	return tx.Commit()
 }
 
-func DeletePrompt(id int64) error {
-	_, err := db.DB.Exec("DELETE FROM prompts WHERE id=?", id)
+func (s *Service) DeletePrompt(id int64) error {
+	_, err := s.db.Exec("DELETE FROM prompts WHERE id=?", id)
 	return err
 }
 
-func GetPromptVersions(promptID int64) ([]models.PromptVersion, error) {
+func (s *Service) GetPromptVersions(promptID int64) ([]models.PromptVersion, error) {
 	if promptID <= 0 {
 		return nil, errors.New("提示词 ID 无效")
 	}
 	var versions []models.PromptVersion
-	err := db.DB.Select(&versions, `
+	err := s.db.Select(&versions, `
 		SELECT *
 		FROM prompt_versions
 		WHERE prompt_id=?
@@ -125,12 +155,12 @@ func GetPromptVersions(promptID int64) ([]models.PromptVersion, error) {
 	return versions, err
 }
 
-func RestorePromptVersion(promptID int64, versionID int64) error {
+func (s *Service) RestorePromptVersion(promptID int64, versionID int64) error {
 	if promptID <= 0 || versionID <= 0 {
 		return errors.New("提示词版本参数无效")
 	}
 
-	tx, err := db.DB.Beginx()
+	tx, err := s.db.Beginx()
 	if err != nil {
 		return err
 	}
@@ -146,13 +176,14 @@ func RestorePromptVersion(promptID int64, versionID int64) error {
 		return err
 	}
 
-	if _, err := tx.Exec("UPDATE prompts SET name=?,content=? WHERE id=?", version.Name, version.Content, promptID); err != nil {
+	if _, err := tx.Exec("UPDATE prompts SET name=?,content=?,generation_options=?,output_schema=? WHERE id=?",
+		version.Name, version.Content, version.GenerationOptions, version.OutputSchema, promptID); err != nil {
 		return err
 	}
 
 	// Record restore as a new version so rollback history itself is traceable.
-	if before.Name != version.Name || before.Content != version.Content {
-		if err := insertPromptVersionTx(tx, promptID, version.Name, version.Content); err != nil {
+	if promptChanged(promptSnapshot(before), version) {
+		if err := insertPromptVersionTx(tx, promptID, version); err != nil {
 			return err
 		}
 	}
@@ -160,14 +191,31 @@ func RestorePromptVersion(promptID int64, versionID int64) error {
 	return tx.Commit()
 }
 
-func insertPromptVersionTx(tx *sqlx.Tx, promptID int64, name string, content string) error {
+// promptSnapshot holds the versioned fields of a prompt.
+func promptSnapshot(p models.Prompt) models.PromptVersion {
+	return models.PromptVersion{
+		Name:              p.Name,
+		Content:           p.Content,
+		GenerationOptions: p.GenerationOptions,
+		OutputSchema:      p.OutputSchema,
+	}
+}
+
+func promptChanged(a, b models.PromptVersion) bool {
+	return a.Name != b.Name ||
+		a.Content != b.Content ||
+		a.OutputSchema != b.OutputSchema ||
+		!sameGenerationOptions(a.GenerationOptions, b.GenerationOptions)
+}
+
+func insertPromptVersionTx(tx *sqlx.Tx, promptID int64, v models.PromptVersion) error {
 	var nextVersion int
 	if err := tx.Get(&nextVersion, "SELECT COALESCE(MAX(version_no), 0) + 1 FROM prompt_versions WHERE prompt_id=?", promptID); err != nil {
 		return err
 	}
 	_, err := tx.Exec(`
-		INSERT INTO prompt_versions(prompt_id, version_no, name, content)
-		VALUES(?,?,?,?)
-	`, promptID, nextVersion, name, content)
+		INSERT INTO prompt_versions(prompt_id, version_no, name, content, generation_options, output_schema)
+		VALUES(?,?,?,?,?,?)
+	`, promptID, nextVersion, v.Name, v.Content, v.GenerationOptions, v.OutputSchema)
 	return err
 }
@@ -0,0 +1,174 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"stock-report-analysis/internal/models"
+)
+
+const (
+	// contextReplyReserve is kept free for the reply when the prompt sets no
+	// max_tokens.
+	contextReplyReserve = 2048
+	contextSafetyMargin = 256
+	minSectionTokens    = 512
+	maxReduceRounds     = 3
+)
+
+const mapSectionPrompt = `你正在分段阅读一份长篇研究报告，当前是第 %d/%d 段。请提炼本段中与下述分析要求相关的关键信息、数据和观点，保留具体数字，不要编造，也不要给出本段无法支撑的结论。
+
+分析要求：
+%s`
+
+const reduceInputHeader = "以下是一篇长篇研究报告按原文顺序分段提炼的要点，请据此完成完整解读：\n\n"
+
+// AnalyzeWithContextFit runs in through AnalyzeWithFailover when the content
+// fits the channel's context window. Otherwise it maps the article sections
+// to notes one by one and reduces the notes with the original prompt and
+// mode. Progress lines go to onChunk before the final reply is streamed.
+// Notes that still do not fit after maxReduceRounds fail the analysis
+// instead of sending an oversized request.
+//
+// The budget follows the primary channel; fallback channels are assumed to
+// have a window at least as large.
+func (s *Service) AnalyzeWithContextFit(ctx context.Context, in AnalysisRequest, fallbacks []models.AIChannel, onChunk func(string), onRetry func(AnalysisAttempt)) (AnalysisAttempt, error) {
+	budget := contentTokenBudget(in)
+	if in.Channel.ContextWindow <= 0 || EstimateTokens(in.Content) <= budget {
+		return s.AnalyzeWithFailover(ctx, in, fallbacks, onChunk, onRetry)
+	}
+	if onChunk == nil {
+		onChunk = func(string) {}
+	}
+
+	mapCall := in
+	mapCall.Mode = AnalysisModeText
+	mapCall.Schema = ""
+	mapCall.OnReasoning = nil
+	mapCall.Prompt = fmt.Sprintf(mapSectionPrompt, 1, 1, in.Prompt)
+	sectionBudget := contentTokenBudget(mapCall)
+	if sectionBudget < minSectionTokens || budget < minSectionTokens {
+		return AnalysisAttempt{Channel: in.Channel}, fmt.Errorf("渠道上下文窗口（%d）过小，扣除提示词与回复预留后无法容纳正文", in.Channel.ContextWindow)
+	}
+
+	startedAt := time.Now()
+	var usage AnalysisResult
+	allCached := true
+	content := in.Content
+	for round := 1; ; round++ {
+		sections := splitForTokenBudget(content, sectionBudget)
+		notes := make([]string, 0, len(sections))
+		for i, section := range sections {
+			if round == 1 {
+				onChunk(fmt.Sprintf("> 正文超出渠道上下文窗口，正在分段解读 %d/%d\n\n", i+1, len(sections)))
+			} else {
+				onChunk(fmt.Sprintf("> 分段要点仍超出上下文窗口，正在二次压缩 %d/%d\n\n", i+1, len(sections)))
+			}
+			call := mapCall
+			call.Prompt = fmt.Sprintf(mapSectionPrompt, i+1, len(sections), in.Prompt)
+			call.Content = section
+			attempt, err := s.AnalyzeWithFailover(ctx, call, fallbacks, nil, onRetry)
+			addResultUsage(&usage, attempt.Result)
+			allCached = allCached && attempt.Result.CacheHit
+			if err != nil {
+				attempt.Result = usage
+				return attempt, fmt.Errorf("第 %d/%d 段解读失败: %w", i+1, len(sections), err)
+			}
+			notes = append(notes, fmt.Sprintf("【第 %d 段要点】\n%s", i+1, strings.TrimSpace(attempt.Result.Text)))
+		}
+		content = strings.Join(notes, "\n\n")
+		if EstimateTokens(reduceInputHeader+content) <= budget {
+			break
+		}
+		if round >= maxReduceRounds {
+			return AnalysisAttempt{Channel: in.Channel, Result: usage, StartedAt: startedAt}, fmt.Errorf("分段压缩 %d 轮后要点仍超出渠道上下文窗口（%d），请换用上下文更大的渠道", round, in.Channel.ContextWindow)
+		}
+	}
+
+	onChunk("> 分段要点已完成，正在汇总解读\n\n")
+	final := in
+	final.Content = reduceInputHeader + content
+	attempt, err := s.AnalyzeWithFailover(ctx, final, fallbacks, onChunk, onRetry)
+	last := attempt.Result
+	addResultUsage(&usage, last)
+	attempt.Result = usage
+	attempt.Result.Text = last.Text
+	attempt.Result.Reasoning = last.Reasoning
+	attempt.Result.CacheHit = allCached && last.CacheHit
+	attempt.Result.cacheKey = last.cacheKey
+	return attempt, err
+}
+
+// contentTokenBudget is what is left of the channel's context window for the
+// user message once the system prompt and the reply are accounted for.
+func contentTokenBudget(in AnalysisRequest) int {
+	schema := ""
+	if in.Mode == AnalysisModeStructured {
+		schema = strings.TrimSpace(in.Schema)
+	}
+	reply := in.Options.MaxTokens
+	if reply <= 0 {
+		reply = contextReplyReserve
+	}
+	system := buildSystemPrompt(in.Prompt, in.Mode, schema)
+	return in.Channel.ContextWindow - EstimateTokens(system) - reply - contextSafetyMargin
+}
+
+// splitForTokenBudget packs the buildArticleChunks sections of content into
+// groups that each fit budget, cutting sections that are too long alone.
+func splitForTokenBudget(content string, budget int) []string {
+	var groups []string
+	var current strings.Builder
+	currentTokens := 0
+	flush := func() {
+		if current.Len() > 0 {
+			groups = append(groups, current.String())
+			current.Reset()
+			currentTokens = 0
+		}
+	}
+
+	for _, chunk := range buildArticleChunks(content, 900) {
+		for _, piece := range cutToTokenBudget(chunk.Text, budget) {
+			tokens := EstimateTokens(piece)
+			if currentTokens > 0 && currentTokens+tokens > budget {
+				flush()
+			}
+			if current.Len() > 0 {
+				current.WriteString("\n")
+			}
+			current.WriteString(piece)
+			currentTokens += tokens
+		}
+	}
+	flush()
+	return groups
+}
+
+func cutToTokenBudget(text string, budget int) []string {
+	if EstimateTokens(text) <= budget {
+		return []string{text}
+	}
+	var pieces []string
+	runes := []rune(text)
+	for len(runes) > 0 {
+		// EstimateTokens never counts more than one token per rune, so
+		// budget runes always fit; grow while the estimate allows.
+		n := min(budget, len(runes))
+		for n < len(runes) && EstimateTokens(string(runes[:min(n*2, len(runes))])) <= budget {
+			n = min(n*2, len(runes))
+		}
+		pieces = append(pieces, string(runes[:n]))
+		runes = runes[n:]
+	}
+	return pieces
+}
+
+func addResultUsage(dst *AnalysisResult, src AnalysisResult) {
+	dst.PromptTokens += src.PromptTokens
+	dst.CompletionTokens += src.CompletionTokens
+	dst.TotalTokens += src.TotalTokens
+	dst.DurationMs += src.DurationMs
+}
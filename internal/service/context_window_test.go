@@ -0,0 +1,38 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"stock-report-analysis/internal/llmtest"
+)
+
+func TestAnalyzeWithContextFitStopsWhenNotesNeverFit(t *testing.T) {
+	svc := newTestService(t)
+	srv := llmtest.New(t)
+	// Every note is as long as the budget allows for a section, so the
+	// notes never shrink below the reduce budget.
+	srv.SetFallback(llmtest.Reply{Chunks: []string{strings.Repeat("要", 400)}, Usage: &llmtest.Usage{PromptTokens: 100, CompletionTokens: 400, TotalTokens: 500}})
+	channel := saveDefaultChannel(t, svc, srv)
+	channel.ContextWindow = 3000
+
+	attempt, err := svc.AnalyzeWithContextFit(context.Background(), AnalysisRequest{
+		Channel: channel,
+		Prompt:  "请解读这篇报告",
+		Content: strings.Repeat("甲", 500) + "\n\n" + strings.Repeat("乙", 500) + "\n\n" + strings.Repeat("丙", 500),
+		Mode:    AnalysisModeText,
+	}, nil, nil, nil)
+	if err == nil || !strings.Contains(err.Error(), "3 轮") {
+		t.Fatalf("err = %v", err)
+	}
+	requests := srv.Requests()
+	for _, req := range requests {
+		if strings.HasPrefix(req.User(), reduceInputHeader) {
+			t.Fatalf("sent the oversized reduce request")
+		}
+	}
+	if n := len(requests); n != 9 || attempt.Result.TotalTokens != 500*n || attempt.StartedAt.IsZero() {
+		t.Errorf("requests = %d, attempt = %+v", n, attempt)
+	}
+}
@@ -0,0 +1,186 @@
+package service
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"stock-report-analysis/internal/models"
+)
+
+const (
+	aiBudgetConfigKey = "ai_budget_config_v1"
+	DefaultCurrency   = "CNY"
+)
+
+// Group expressions for costBreakdown. Days follow the local calendar since
+// created_at is stored in UTC.
+const (
+	costByDay     = "date(created_at, 'localtime')"
+	costByChannel = "channel_name"
+	costByPrompt  = "prompt_name"
+	costByRole    = "role_name"
+)
+
+func NormalizeCurrency(currency string) string {
+	currency = strings.ToUpper(strings.TrimSpace(currency))
+	if currency == "" {
+		return DefaultCurrency
+	}
+	return currency
+}
+
+// ChannelCost prices a call with the channel's per-million-token prices. An
+// unpriced channel returns an empty currency so its runs stay out of cost
+// totals instead of counting as free.
+func ChannelCost(channel models.AIChannel, promptTokens, completionTokens int) (float64, string) {
+	if channel.InputPrice <= 0 && channel.OutputPrice <= 0 {
+		return 0, ""
+	}
+	cost := (float64(promptTokens)*channel.InputPrice + float64(completionTokens)*channel.OutputPrice) / 1e6
+	return cost, NormalizeCurrency(channel.Currency)
+}
+
+func buildCostFilter(days int) (string, []any) {
+	clause, args := buildTimeFilter(days)
+	if clause == "" {
+		return "WHERE currency <> ''", nil
+	}
+	return clause + " AND currency <> ''", args
+}
+
+// costBreakdown sums the priced rows of table by groupExpr and currency.
+// An empty groupExpr gives one total per currency.
+func (s *Service) costBreakdown(table, groupExpr string, days int) ([]models.CostMetric, error) {
+	keyExpr := "''"
+	if groupExpr != "" {
+		keyExpr = groupExpr
+	}
+	order := "cost DESC, key ASC"
+	if groupExpr == costByDay {
+		order = "key DESC"
+	}
+	clause, args := buildCostFilter(days)
+	rows := []struct {
+		Key      string          `db:"key"`
+		Currency string          `db:"currency"`
+		Cost     sql.NullFloat64 `db:"cost"`
+		Runs     int64           `db:"runs"`
+		Tokens   sql.NullInt64   `db:"tokens"`
+	}{}
+	if err := s.db.Select(&rows, fmt.Sprintf(`
+		SELECT
+			%s AS key,
+			currency,
+			SUM(cost) AS cost,
+			COUNT(*) AS runs,
+			SUM(total_tokens) AS tokens
+		FROM %s
+		%s
+		GROUP BY key, currency
+		ORDER BY %s
+	`, keyExpr, table, clause, order), args...); err != nil {
+		return nil, err
+	}
+
+	out := make([]models.CostMetric, 0, len(rows))
+	for _, row := range rows {
+		out = append(out, models.CostMetric{
+			Key:      row.Key,
+			Currency: row.Currency,
+			Cost:     row.Cost.Float64,
+			Runs:     int(row.Runs),
+			Tokens:   row.Tokens.Int64,
+		})
+	}
+	return out, nil
+}
+
+func (s *Service) GetAIBudgetConfig() (models.AIBudgetConfig, error) {
+	cfg := models.AIBudgetConfig{Currency: DefaultCurrency}
+
+	var raw string
+	err := s.db.Get(&raw, "SELECT value FROM app_configs WHERE key=?", aiBudgetConfigKey)
+	if errors.Is(err, sql.ErrNoRows) {
+		return cfg, nil
+	}
+	if err != nil {
+		return cfg, err
+	}
+	if json.Unmarshal([]byte(raw), &cfg) != nil {
+		return models.AIBudgetConfig{Currency: DefaultCurrency}, nil
+	}
+	return normalizeAIBudgetConfig(cfg), nil
+}
+
+func (s *Service) SaveAIBudgetConfig(cfg models.AIBudgetConfig) error {
+	cfg = normalizeAIBudgetConfig(cfg)
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(`
+		INSERT INTO app_configs(key, value, updated_at)
+		VALUES(?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT(key) DO UPDATE SET value=excluded.value, updated_at=CURRENT_TIMESTAMP
+	`, aiBudgetConfigKey, string(data))
+	return err
+}
+
+func normalizeAIBudgetConfig(cfg models.AIBudgetConfig) models.AIBudgetConfig {
+	cfg.DailyLimit = max(cfg.DailyLimit, 0)
+	cfg.MonthlyLimit = max(cfg.MonthlyLimit, 0)
+	cfg.Currency = NormalizeCurrency(cfg.Currency)
+	return cfg
+}
+
+// GetAIBudgetStatus sums today's and this month's spend of analysis and QA
+// runs priced in the budget currency. Runs priced in other currencies are
+// not converted and do not count.
+func (s *Service) GetAIBudgetStatus() (models.AIBudgetStatus, error) {
+	cfg, err := s.GetAIBudgetConfig()
+	if err != nil {
+		return models.AIBudgetStatus{}, err
+	}
+	status := models.AIBudgetStatus{
+		Currency:     cfg.Currency,
+		DailyLimit:   cfg.DailyLimit,
+		MonthlyLimit: cfg.MonthlyLimit,
+	}
+	if cfg.DailyLimit <= 0 && cfg.MonthlyLimit <= 0 {
+		return status, nil
+	}
+
+	spent := struct {
+		Daily   float64 `db:"daily"`
+		Monthly float64 `db:"monthly"`
+	}{}
+	if err := s.db.Get(&spent, `
+		SELECT
+			COALESCE(SUM(CASE WHEN date(created_at, 'localtime') = date('now', 'localtime') THEN cost END), 0) AS daily,
+			COALESCE(SUM(cost), 0) AS monthly
+		FROM (
+			SELECT cost, created_at FROM analysis_runs
+			WHERE currency = ? AND created_at >= datetime('now', 'localtime', 'start of month', 'utc')
+			UNION ALL
+			SELECT cost, created_at FROM qa_runs
+			WHERE currency = ? AND created_at >= datetime('now', 'localtime', 'start of month', 'utc')
+		)
+	`, cfg.Currency, cfg.Currency); err != nil {
+		return status, err
+	}
+	status.DailySpent = spent.Daily
+	status.MonthlySpent = spent.Monthly
+
+	switch {
+	case cfg.DailyLimit > 0 && status.DailySpent >= cfg.DailyLimit:
+		status.Exceeded = true
+		status.Reason = fmt.Sprintf("今日 AI 花费 %.2f %s 已达日预算 %.2f", status.DailySpent, cfg.Currency, cfg.DailyLimit)
+	case cfg.MonthlyLimit > 0 && status.MonthlySpent >= cfg.MonthlyLimit:
+		status.Exceeded = true
+		status.Reason = fmt.Sprintf("本月 AI 花费 %.2f %s 已达月预算 %.2f", status.MonthlySpent, cfg.Currency, cfg.MonthlyLimit)
+	}
+	return status, nil
+}
@@ -0,0 +1,442 @@
+package service
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math/bits"
+	"strings"
+	"unicode"
+
+	"stock-report-analysis/internal/models"
+
+	"github.com/jmoiron/sqlx"
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	duplicateExact   = "exact"
+	duplicateSimilar = "similar"
+
+	// similarMaxDistance is the largest simhash Hamming distance at which
+	// two articles are reported as possible duplicates.
+	similarMaxDistance = 6
+	simhashShingle     = 4
+	// minSimhashFeatures keeps short texts, whose simhashes collide too
+	// easily, out of near-duplicate detection.
+	minSimhashFeatures = 32
+)
+
+// articleFingerprint is what import deduplication compares. Any field may
+// be empty (zero), and empty fields never match.
+type articleFingerprint struct {
+	fileHash    string
+	contentHash string
+	simhash     uint64
+}
+
+func hashBytes(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// normalizeForHash folds width and case and keeps only letters and digits,
+// so differences in whitespace, punctuation or markdown left by different
+// parsers do not change the hash.
+func normalizeForHash(text string) string {
+	var b strings.Builder
+	for _, r := range norm.NFKC.String(text) {
+		if unicode.IsLetter(r) || unicode.IsNumber(r) {
+			b.WriteRune(unicode.ToLower(r))
+		}
+	}
+	return b.String()
+}
+
+// contentFingerprint returns the content hash and simhash of content.
+func contentFingerprint(content string) (string, uint64) {
+	normalized := normalizeForHash(content)
+	if normalized == "" {
+		return hashBytes([]byte(strings.TrimSpace(content))), 0
+	}
+	return hashBytes([]byte(normalized)), simhash(content)
+}
+
+// simhash is a 64-bit Charikar simhash over the shingles of each normalized
+// paragraph. Shingles never span paragraphs, so a report that gained or
+// lost a few paragraphs stays within a few bits of the original.
+func simhash(content string) uint64 {
+	var weights [64]int
+	features := 0
+	for _, paragraph := range strings.Split(content, "\n") {
+		runes := []rune(normalizeForHash(paragraph))
+		size := min(simhashShingle, len(runes))
+		if size == 0 {
+			continue
+		}
+		for i := 0; i+size <= len(runes); i++ {
+			h := fnv.New64a()
+			h.Write([]byte(string(runes[i : i+size])))
+			v := h.Sum64()
+			for bit := range weights {
+				if v&(1<<bit) != 0 {
+					weights[bit]++
+				} else {
+					weights[bit]--
+				}
+			}
+			features++
+		}
+	}
+	if features < minSimhashFeatures {
+		return 0
+	}
+	var out uint64
+	for bit, w := range weights {
+		if w > 0 {
+			out |= 1 << bit
+		}
+	}
+	return out
+}
+
+func simhashDistance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+// backfillArticleFingerprints hashes library articles stored before
+// fingerprints existed. Telegraphs are never deduplicated this way.
+func (s *Service) backfillArticleFingerprints() error {
+	var rows []struct {
+		ID      int64  `db:"id"`
+		Content string `db:"content"`
+	}
+	if err := s.db.Select(&rows, "SELECT id, content FROM articles WHERE content_hash='' AND source NOT LIKE ?", telegraphSourcePrefixLike); err != nil {
+		return err
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, row := range rows {
+		hash, sim := contentFingerprint(row.Content)
+		if _, err := tx.Exec("UPDATE articles SET content_hash=?, simhash=? WHERE id=?", hash, int64(sim), row.ID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// findDuplicate returns the library article fp duplicates and how: exact
+// for the same file or content, similar for a close simhash unless
+// allowSimilar. kind is empty when there is none.
+func (s *Service) findDuplicate(fp articleFingerprint, allowSimilar bool) (existing models.Article, kind string, err error) {
+	if err := s.backfillArticleFingerprints(); err != nil {
+		return models.Article{}, "", err
+	}
+	for _, key := range []struct{ column, value string }{
+		{"file_hash", fp.fileHash},
+		{"content_hash", fp.contentHash},
+	} {
+		if key.value == "" {
+			continue
+		}
+		var id int64
+		err := s.db.Get(&id, fmt.Sprintf("SELECT id FROM articles WHERE %s=? AND source NOT LIKE ? ORDER BY id LIMIT 1", key.column), key.value, telegraphSourcePrefixLike)
+		if err == nil {
+			existing, err = s.GetArticle(id)
+			return existing, duplicateExact, err
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return models.Article{}, "", err
+		}
+	}
+	if allowSimilar || fp.simhash == 0 {
+		return models.Article{}, "", nil
+	}
+
+	var rows []struct {
+		ID      int64 `db:"id"`
+		Simhash int64 `db:"simhash"`
+	}
+	if err := s.db.Select(&rows, "SELECT id, simhash FROM articles WHERE simhash != 0 AND source NOT LIKE ? ORDER BY id", telegraphSourcePrefixLike); err != nil {
+		return models.Article{}, "", err
+	}
+	bestID, bestDistance := int64(0), similarMaxDistance+1
+	for _, row := range rows {
+		if d := simhashDistance(fp.simhash, uint64(row.Simhash)); d < bestDistance {
+			bestID, bestDistance = row.ID, d
+		}
+	}
+	if bestID == 0 {
+		return models.Article{}, "", nil
+	}
+	existing, err = s.GetArticle(bestID)
+	return existing, duplicateSimilar, err
+}
+
+func duplicateResult(existing models.Article, kind string) models.ImportResult {
+	message := fmt.Sprintf("已存在相同内容的文章《%s》，未重复导入", existing.Title)
+	if kind == duplicateSimilar {
+		message = fmt.Sprintf("与已有文章《%s》高度相似，可能重复，确认后可强制导入", existing.Title)
+	}
+	return models.ImportResult{Article: existing, Duplicate: kind, Message: message}
+}
+
+// saveImport stores an imported document, with the images, tables and QA
+// sections parsed from it, unless it duplicates an article already in the library,
+// in which case that article is returned instead. force imports near
+// duplicates anyway; exact duplicates are never stored.
+func (s *Service) saveImport(title string, doc parsedDocument, source, fileHash string, force bool) (models.ImportResult, error) {
+	content := strings.TrimSpace(doc.Markdown)
+	if content == "" {
+		return models.ImportResult{}, errors.New("导入内容为空")
+	}
+	fp := articleFingerprint{fileHash: fileHash}
+	fp.contentHash, fp.simhash = contentFingerprint(content)
+	existing, kind, err := s.findDuplicate(fp, force)
+	if err != nil {
+		return models.ImportResult{}, err
+	}
+	if kind != "" {
+		return duplicateResult(existing, kind), nil
+	}
+
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return models.ImportResult{}, err
+	}
+	defer tx.Rollback()
+	res, err := tx.Exec("INSERT INTO articles(title,content,source,content_hash,file_hash,simhash) VALUES(?,?,?,?,?,?)",
+		title, content, source, fp.contentHash, fp.fileHash, int64(fp.simhash))
+	if err != nil {
+		return models.ImportResult{}, err
+	}
+	id, _ := res.LastInsertId()
+	for _, asset := range doc.Assets {
+		if _, err := tx.Exec("INSERT INTO article_assets(article_id, file_hash, kind, path, caption, html, page) VALUES(?,?,?,?,?,?,?)",
+			id, fileHash, asset.Kind, asset.Path, asset.Caption, asset.HTML, asset.Page); err != nil {
+			return models.ImportResult{}, err
+		}
+	}
+	if err := saveArticleChunksTx(tx, id, documentChunks(doc)); err != nil {
+		return models.ImportResult{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return models.ImportResult{}, err
+	}
+	article, err := s.GetArticle(id)
+	return models.ImportResult{Article: article}, err
+}
+
+// FindDuplicateArticles groups library articles that share a file or
+// content hash or whose simhashes are close. Telegraphs are left out.
+func (s *Service) FindDuplicateArticles() ([]models.DuplicateGroup, error) {
+	if err := s.backfillArticleFingerprints(); err != nil {
+		return nil, err
+	}
+	var articles []models.Article
+	if err := s.db.Select(&articles, `
+		SELECT id, title, source, status, created_at, analyzed_at, content_hash, file_hash, simhash
+		FROM articles WHERE source NOT LIKE ? ORDER BY id`, telegraphSourcePrefixLike); err != nil {
+		return nil, err
+	}
+
+	parent := make([]int, len(articles))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+	var similarLinks [][2]int
+	for i := range articles {
+		for j := i + 1; j < len(articles); j++ {
+			a, b := articles[i], articles[j]
+			exact := (a.ContentHash != "" && a.ContentHash == b.ContentHash) || (a.FileHash != "" && a.FileHash == b.FileHash)
+			similar := !exact && a.Simhash != 0 && b.Simhash != 0 &&
+				simhashDistance(uint64(a.Simhash), uint64(b.Simhash)) <= similarMaxDistance
+			if !exact && !similar {
+				continue
+			}
+			if similar {
+				similarLinks = append(similarLinks, [2]int{i, j})
+			}
+			if ri, rj := find(i), find(j); ri != rj {
+				// The older article stays the root, so groups list it first.
+				parent[max(ri, rj)] = min(ri, rj)
+			}
+		}
+	}
+
+	groupByRoot := map[int]*models.DuplicateGroup{}
+	var roots []int
+	for i := range articles {
+		root := find(i)
+		group, ok := groupByRoot[root]
+		if !ok {
+			group = &models.DuplicateGroup{Exact: true}
+			groupByRoot[root] = group
+			roots = append(roots, root)
+		}
+		group.Articles = append(group.Articles, articles[i])
+	}
+	for _, link := range similarLinks {
+		groupByRoot[find(link[0])].Exact = false
+	}
+	groups := []models.DuplicateGroup{}
+	for _, root := range roots {
+		if group := groupByRoot[root]; len(group.Articles) > 1 {
+			groups = append(groups, *group)
+		}
+	}
+	return groups, nil
+}
+
+// MergeDuplicateArticles folds duplicateIDs into keepID and deletes them.
+// Tags, analysis history and runs, and QA sessions move to the kept
+// article; its analysis is taken from a duplicate only when it has none.
+// QA evidence is re-pointed to the kept article's sections, since the
+// duplicates' sections go with them.
+func (s *Service) MergeDuplicateArticles(keepID int64, duplicateIDs []int64) error {
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var keep models.Article
+	if err := tx.Get(&keep, "SELECT * FROM articles WHERE id=?", keepID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return errors.New("保留的文章不存在")
+		}
+		return err
+	}
+	var keepChunks []articleChunk
+	for _, id := range uniqueInt64s(duplicateIDs) {
+		if id == keepID {
+			continue
+		}
+		var dup models.Article
+		if err := tx.Get(&dup, "SELECT * FROM articles WHERE id=?", id); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				continue
+			}
+			return err
+		}
+		if strings.HasPrefix(dup.Source, "cls-telegraph:") {
+			return fmt.Errorf("电报《%s》不能合并", dup.Title)
+		}
+
+		if strings.TrimSpace(keep.Analysis) == "" && strings.TrimSpace(dup.Analysis) != "" {
+			if _, err := tx.Exec("UPDATE articles SET analysis=?, prompt_used=?, channel_used=?, status=?, analyzed_at=? WHERE id=?",
+				dup.Analysis, dup.PromptUsed, dup.ChannelUsed, dup.Status, dup.AnalyzedAt, keepID); err != nil {
+				return err
+			}
+			// structured_analysis_items references its parent row, so the
+			// parent is copied before the items move.
+			if _, err := tx.Exec(`
+				INSERT OR IGNORE INTO structured_analyses(article_id, summary, valuation_view, payload, repaired, updated_at)
+				SELECT ?, summary, valuation_view, payload, repaired, updated_at FROM structured_analyses WHERE article_id=?`, keepID, id); err != nil {
+				return err
+			}
+			if _, err := tx.Exec("UPDATE structured_analysis_items SET article_id=? WHERE article_id=?", keepID, id); err != nil {
+				return err
+			}
+			keep.Analysis = dup.Analysis
+		}
+		if keep.Source == "" && dup.Source != "" {
+			if _, err := tx.Exec("UPDATE articles SET source=? WHERE id=?", dup.Source, keepID); err != nil {
+				return err
+			}
+			keep.Source = dup.Source
+		}
+		if _, err := tx.Exec("INSERT OR IGNORE INTO article_tags(article_id, tag_id) SELECT ?, tag_id FROM article_tags WHERE article_id=?", keepID, id); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`
+			UPDATE article_assets SET article_id=? WHERE article_id=?
+			AND NOT EXISTS (SELECT 1 FROM article_assets WHERE article_id=?)`, keepID, id, keepID); err != nil {
+			return err
+		}
+		if keepChunks == nil {
+			if keepChunks, err = s.mergeTargetChunksTx(tx, keep); err != nil {
+				return err
+			}
+		}
+		if err := repointMergedEvidencesTx(tx, keepID, id, keepChunks); err != nil {
+			return err
+		}
+		for _, table := range []string{"analysis_history", "analysis_runs", "qa_sessions", "qa_pins", "qa_messages", "qa_runs"} {
+			if _, err := tx.Exec(fmt.Sprintf("UPDATE %s SET article_id=? WHERE article_id=?", table), keepID, id); err != nil {
+				return err
+			}
+		}
+		if _, err := tx.Exec("DELETE FROM articles WHERE id=?", id); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// mergeTargetChunksTx returns the stored sections of keep, building and
+// storing them first when it has none yet.
+func (s *Service) mergeTargetChunksTx(tx *sqlx.Tx, keep models.Article) ([]articleChunk, error) {
+	var chunks []articleChunk
+	if err := tx.Select(&chunks, `
+		SELECT id, chunk_index, heading_path, page_start, page_end, text
+		FROM article_chunks
+		WHERE article_id=?
+		ORDER BY chunk_index ASC
+	`, keep.ID); err != nil || len(chunks) > 0 {
+		return chunks, err
+	}
+	chunks = s.buildArticleDocumentChunks(keep)
+	if err := saveArticleChunksTx(tx, keep.ID, chunks); err != nil {
+		return nil, err
+	}
+	return chunks, nil
+}
+
+// repointMergedEvidencesTx moves the QA evidence of dupID to keepID and
+// points each row at the kept section that contains its quote. Rows whose
+// quote is in none of them get chunk_index 0 and no location, as the
+// duplicate's sections are deleted with it.
+func repointMergedEvidencesTx(tx *sqlx.Tx, keepID, dupID int64, keepChunks []articleChunk) error {
+	var evidences []struct {
+		ID    int64  `db:"id"`
+		Quote string `db:"quote"`
+	}
+	if err := tx.Select(&evidences, "SELECT id, quote FROM qa_evidences WHERE article_id=?", dupID); err != nil {
+		return err
+	}
+	for _, ev := range evidences {
+		var target articleChunk
+		if quote := strings.TrimSpace(ev.Quote); quote != "" {
+			for _, ch := range keepChunks {
+				if strings.Contains(ch.Text, quote) {
+					target = ch
+					break
+				}
+			}
+		}
+		if _, err := tx.Exec(`
+			UPDATE qa_evidences SET article_id=?, chunk_index=?, heading_path=?, page_start=?, page_end=?
+			WHERE id=?
+		`, keepID, target.Index, target.HeadingPath, target.PageStart, target.PageEnd, ev.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,175 @@
+package service
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"stock-report-analysis/internal/models"
+)
+
+const quarterlyReview = `# 贵州茅台 2026 年三季报点评
+
+三季度公司实现营业收入 398 亿元，同比增长 15.2%，归母净利润 206 亿元，同比增长 14.8%，业绩符合市场预期。
+
+分产品看，茅台酒收入同比增长 14.1%，系列酒收入同比增长 21.6%，系列酒占比继续提升。
+
+直销渠道收入占比提升至 45%，i茅台平台贡献显著，渠道结构优化带动毛利率小幅上行。
+
+我们维持 2026-2028 年盈利预测，对应市盈率分别为 24/21/19 倍，维持买入评级。`
+
+func writeImportFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("write %s: %v", name, err)
+	}
+	return path
+}
+
+func TestImportFileDeduplicates(t *testing.T) {
+	svc := newTestService(t)
+	dir := t.TempDir()
+
+	first, err := svc.ImportFile(writeImportFile(t, dir, "三季报点评.md", quarterlyReview), false)
+	if err != nil || first.Duplicate != "" {
+		t.Fatalf("first import = %+v, %v", first, err)
+	}
+
+	// Same bytes under another name, then same text with different spacing.
+	for _, name := range []string{"三季报点评-副本.md", "三季报点评.txt"} {
+		content := quarterlyReview
+		if strings.HasSuffix(name, ".txt") {
+			content = strings.ReplaceAll(quarterlyReview, "\n\n", "\n  \n")
+		}
+		result, err := svc.ImportFile(writeImportFile(t, dir, name, content), false)
+		if err != nil || result.Duplicate != duplicateExact || result.Article.ID != first.Article.ID {
+			t.Fatalf("%s = %+v, %v", name, result, err)
+		}
+	}
+
+	edited := strings.Replace(quarterlyReview, "维持买入评级", "维持买入评级，目标价 2200 元", 1)
+	editedPath := writeImportFile(t, dir, "三季报点评-修订.md", edited)
+	result, err := svc.ImportFile(editedPath, false)
+	if err != nil || result.Duplicate != duplicateSimilar || result.Article.ID != first.Article.ID || result.FilePath != editedPath {
+		t.Fatalf("edited = %+v, %v", result, err)
+	}
+	result, err = svc.ImportFile(editedPath, true)
+	if err != nil || result.Duplicate != "" || result.Article.ID == first.Article.ID {
+		t.Fatalf("forced = %+v, %v", result, err)
+	}
+
+	other, err := svc.ImportFile(writeImportFile(t, dir, "宁德时代.md", "储能电池出货量同比翻倍，海外订单占比提升至三成，钠离子电池明年量产，资本开支趋于平稳。"), false)
+	if err != nil || other.Duplicate != "" {
+		t.Fatalf("unrelated = %+v, %v", other, err)
+	}
+}
+
+func TestFindAndMergeDuplicateArticles(t *testing.T) {
+	svc := newTestService(t)
+	// Rows from before fingerprints existed get them on first use.
+	keep := insertTestArticle(t, svc, "三季报点评", quarterlyReview)
+	copyID := insertTestArticle(t, svc, "三季报点评（副本）", quarterlyReview)
+	similarID := insertTestArticle(t, svc, "三季报点评（修订）", quarterlyReview+"\n\n风险提示：消费复苏不及预期。")
+	insertTestArticle(t, svc, "宁德时代调研", "储能电池出货量同比翻倍，海外订单占比提升至三成，钠离子电池明年量产，资本开支趋于平稳。")
+
+	if err := svc.SaveArticleAnalysis(copyID, AnalysisOutcome{Analysis: "业绩稳健，维持买入。"}); err != nil {
+		t.Fatalf("save analysis: %v", err)
+	}
+	svc.db.MustExec("INSERT INTO tags(id, name) VALUES(1, '白酒')")
+	svc.db.MustExec("INSERT INTO article_tags(article_id, tag_id) VALUES(?, 1)", similarID)
+	session, err := svc.CreateQASession(similarID, "估值")
+	if err != nil {
+		t.Fatalf("create session: %v", err)
+	}
+
+	groups, err := svc.FindDuplicateArticles()
+	if err != nil || len(groups) != 1 {
+		t.Fatalf("groups = %+v, %v", groups, err)
+	}
+	group := groups[0]
+	if group.Exact || len(group.Articles) != 3 || group.Articles[0].ID != keep {
+		t.Fatalf("group = %+v", group)
+	}
+
+	if err := svc.MergeDuplicateArticles(keep, []int64{copyID, similarID}); err != nil {
+		t.Fatalf("merge: %v", err)
+	}
+	merged, err := svc.GetArticle(keep)
+	if err != nil {
+		t.Fatalf("get merged: %v", err)
+	}
+	if merged.Analysis != "业绩稳健，维持买入。" || len(merged.Tags) != 1 {
+		t.Fatalf("merged = %+v", merged)
+	}
+	sessions, err := svc.GetQASessions(keep)
+	if err != nil || len(sessions) != 1 || sessions[0].ID != session.ID {
+		t.Fatalf("sessions = %+v, %v", sessions, err)
+	}
+	var remaining int
+	svc.db.Get(&remaining, "SELECT COUNT(*) FROM articles")
+	if remaining != 2 {
+		t.Fatalf("articles left = %d, want 2", remaining)
+	}
+	if groups, err := svc.FindDuplicateArticles(); err != nil || len(groups) != 0 {
+		t.Fatalf("groups after merge = %+v, %v", groups, err)
+	}
+}
+
+func TestMergeRepointsQAEvidence(t *testing.T) {
+	svc := newTestService(t)
+	keep := insertTestArticle(t, svc, "三季报点评", quarterlyReview)
+	dupID := insertTestArticle(t, svc, "三季报点评（修订）", strings.Repeat("行业背景介绍。", 150)+"\n\n"+quarterlyReview+"\n\n风险提示：消费复苏不及预期。")
+	dup, err := svc.GetArticle(dupID)
+	if err != nil {
+		t.Fatalf("get duplicate: %v", err)
+	}
+	if _, err := svc.articleChunks(dup); err != nil {
+		t.Fatalf("duplicate chunks: %v", err)
+	}
+	session, err := svc.CreateQASession(dupID, "渠道")
+	if err != nil {
+		t.Fatalf("create session: %v", err)
+	}
+	messageID, err := svc.insertQAMessage(models.QAMessage{SessionID: session.ID, ArticleID: dupID, RoleType: "assistant", Status: "done"})
+	if err != nil {
+		t.Fatalf("insert message: %v", err)
+	}
+	shared := "直销渠道收入占比提升至 45%"
+	for _, quote := range []string{shared, "风险提示：消费复苏不及预期。"} {
+		svc.db.MustExec("INSERT INTO qa_evidences(message_id, article_id, chunk_index, quote, heading_path, page_start) VALUES(?,?,5,?,'行业背景',3)", messageID, dupID, quote)
+	}
+
+	if err := svc.MergeDuplicateArticles(keep, []int64{dupID}); err != nil {
+		t.Fatalf("merge: %v", err)
+	}
+	var want struct {
+		Index       int    `db:"chunk_index"`
+		HeadingPath string `db:"heading_path"`
+	}
+	if err := svc.db.Get(&want, "SELECT chunk_index, heading_path FROM article_chunks WHERE article_id=? AND instr(text, ?) > 0", keep, shared); err != nil {
+		t.Fatalf("kept chunk: %v", err)
+	}
+	var evidences []struct {
+		ArticleID   int64  `db:"article_id"`
+		ChunkIndex  int    `db:"chunk_index"`
+		HeadingPath string `db:"heading_path"`
+		PageStart   int    `db:"page_start"`
+	}
+	if err := svc.db.Select(&evidences, "SELECT article_id, chunk_index, heading_path, page_start FROM qa_evidences ORDER BY id"); err != nil || len(evidences) != 2 {
+		t.Fatalf("evidences = %+v, %v", evidences, err)
+	}
+	if ev := evidences[0]; ev.ArticleID != keep || ev.ChunkIndex != want.Index || ev.HeadingPath != want.HeadingPath || ev.PageStart != 0 {
+		t.Errorf("shared evidence = %+v, want chunk %+v", ev, want)
+	}
+	if ev := evidences[1]; ev.ArticleID != keep || ev.ChunkIndex != 0 || ev.HeadingPath != "" || ev.PageStart != 0 {
+		t.Errorf("dropped evidence = %+v", ev)
+	}
+
+	input, err := svc.buildFollowUpContext(session.ID, keep, messageID)
+	if err != nil || strings.Contains(input, "[0]") || !strings.Contains(input, fmt.Sprintf("[%d] ", want.Index)) {
+		t.Errorf("follow up input = %q, err = %v", input, err)
+	}
+}
@@ -0,0 +1,426 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"stock-report-analysis/internal/models"
+)
+
+const embeddingConfigKey = "embedding_config_v1"
+
+// embeddingBatchSize is how many sections go into one /embeddings call.
+const embeddingBatchSize = 16
+
+// embeddingQueryTimeout bounds the embedding calls made while a question
+// waits; past it QA falls back to BM25 alone.
+const embeddingQueryTimeout = 30 * time.Second
+
+func defaultEmbeddingConfig() models.EmbeddingConfig {
+	return models.EmbeddingConfig{
+		Enabled:        0,
+		SemanticWeight: 0.5,
+	}
+}
+
+func normalizeEmbeddingConfig(cfg models.EmbeddingConfig) models.EmbeddingConfig {
+	if cfg.Enabled != 1 {
+		cfg.Enabled = 0
+	}
+	if cfg.ChannelID < 0 {
+		cfg.ChannelID = 0
+	}
+	if math.IsNaN(cfg.SemanticWeight) || cfg.SemanticWeight <= 0 {
+		cfg.SemanticWeight = defaultEmbeddingConfig().SemanticWeight
+	}
+	cfg.SemanticWeight = min(cfg.SemanticWeight, 1)
+	return cfg
+}
+
+func (s *Service) GetEmbeddingConfig() (models.EmbeddingConfig, error) {
+	cfg := defaultEmbeddingConfig()
+
+	var raw string
+	err := s.db.Get(&raw, "SELECT value FROM app_configs WHERE key=?", embeddingConfigKey)
+	if errors.Is(err, sql.ErrNoRows) {
+		return cfg, nil
+	}
+	if err != nil {
+		return cfg, err
+	}
+
+	var stored models.EmbeddingConfig
+	if json.Unmarshal([]byte(raw), &stored) != nil {
+		return cfg, nil
+	}
+	return normalizeEmbeddingConfig(stored), nil
+}
+
+func (s *Service) SaveEmbeddingConfig(cfg models.EmbeddingConfig) error {
+	cfg = normalizeEmbeddingConfig(cfg)
+	if cfg.Enabled == 1 {
+		if cfg.ChannelID <= 0 {
+			return errors.New("请选择用于向量检索的渠道")
+		}
+		channel, err := s.channelByID(cfg.ChannelID)
+		if err != nil {
+			return err
+		}
+		if channel.EmbeddingModel == "" {
+			return fmt.Errorf("渠道 %s 未配置向量模型", channel.Name)
+		}
+	}
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(`
+		INSERT INTO app_configs(key, value, updated_at)
+		VALUES(?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT(key) DO UPDATE SET value=excluded.value, updated_at=CURRENT_TIMESTAMP
+	`, embeddingConfigKey, string(data))
+	return err
+}
+
+func (s *Service) channelByID(id int64) (models.AIChannel, error) {
+	var channel models.AIChannel
+	err := s.db.Get(&channel, "SELECT * FROM ai_channels WHERE id=?", id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return channel, errors.New("渠道不存在")
+	}
+	return channel, err
+}
+
+// embeddingChannel returns the channel semantic retrieval embeds with, and
+// false while it is off or the channel lost its embedding model.
+func (s *Service) embeddingChannel() (models.EmbeddingConfig, models.AIChannel, bool) {
+	cfg, err := s.GetEmbeddingConfig()
+	if err != nil || cfg.Enabled != 1 {
+		return cfg, models.AIChannel{}, false
+	}
+	channel, err := s.channelByID(cfg.ChannelID)
+	if err != nil || channel.EmbeddingModel == "" {
+		return cfg, models.AIChannel{}, false
+	}
+	return cfg, channel, true
+}
+
+type embeddingRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+type embeddingResponse struct {
+	Data []struct {
+		Index     int       `json:"index"`
+		Embedding []float32 `json:"embedding"`
+	} `json:"data"`
+	Usage *usage `json:"usage"`
+}
+
+// embedTexts calls the channel's OpenAI-compatible /embeddings endpoint
+// with its embedding model and returns one unit-length vector per text.
+func (s *Service) embedTexts(ctx context.Context, channel models.AIChannel, texts []string) ([][]float32, error) {
+	if len(texts) == 0 {
+		return nil, nil
+	}
+	if channel.EmbeddingModel == "" {
+		return nil, fmt.Errorf("渠道 %s 未配置向量模型", channel.Name)
+	}
+	estimated := 0
+	for _, text := range texts {
+		estimated += EstimateTokens(text)
+	}
+	release, err := s.limiterFor(channel).acquire(ctx, estimated)
+	if err != nil {
+		return nil, err
+	}
+	usedTokens := 0
+	defer func() { release(usedTokens) }()
+
+	req, err := newJSONRequest(ctx, channelEndpoint(channel, "", "/embeddings"), embeddingRequest{
+		Model: channel.EmbeddingModel,
+		Input: texts,
+	})
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+channel.APIKey)
+
+	resp, err := aiHTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		b, _ := io.ReadAll(resp.Body)
+		return nil, &APIStatusError{
+			StatusCode: resp.StatusCode,
+			Body:       string(b),
+			RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+		}
+	}
+
+	var out embeddingResponse
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("向量接口返回无法解析: %w", err)
+	}
+	if out.Usage != nil {
+		usedTokens = out.Usage.TotalTokens
+	}
+	vectors := make([][]float32, len(texts))
+	for _, item := range out.Data {
+		if item.Index < 0 || item.Index >= len(texts) {
+			continue
+		}
+		vectors[item.Index] = normalizeVector(item.Embedding)
+	}
+	for i, vec := range vectors {
+		if len(vec) == 0 {
+			return nil, fmt.Errorf("向量接口未返回第 %d 条文本的向量", i+1)
+		}
+	}
+	return vectors, nil
+}
+
+// normalizeVector scales vec to unit length, so cosine similarity is a dot
+// product. A zero vector is returned as nil.
+func normalizeVector(vec []float32) []float32 {
+	var norm float64
+	for _, v := range vec {
+		norm += float64(v) * float64(v)
+	}
+	if norm == 0 {
+		return nil
+	}
+	norm = math.Sqrt(norm)
+	out := make([]float32, len(vec))
+	for i, v := range vec {
+		out[i] = float32(float64(v) / norm)
+	}
+	return out
+}
+
+// encodeVector stores a vector as little-endian float32s, the format of
+// chunk_embeddings.vector.
+func encodeVector(vec []float32) []byte {
+	data := make([]byte, 4*len(vec))
+	for i, v := range vec {
+		binary.LittleEndian.PutUint32(data[4*i:], math.Float32bits(v))
+	}
+	return data
+}
+
+func decodeVector(data []byte) []float32 {
+	vec := make([]float32, len(data)/4)
+	for i := range vec {
+		vec[i] = math.Float32frombits(binary.LittleEndian.Uint32(data[4*i:]))
+	}
+	return vec
+}
+
+func cosineSimilarity(a, b []float32) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var dot float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+	}
+	return dot
+}
+
+// embeddingInput is the text a section is embedded as: its heading path
+// carries what the section is about when the body alone does not say.
+func embeddingInput(ch articleChunk) string {
+	return strings.TrimSpace(ch.HeadingPath + "\n" + ch.Text)
+}
+
+// ensureChunkEmbeddings returns the vectors of the stored chunks by chunk
+// ID, embedding the ones the channel's model has no vector for yet.
+func (s *Service) ensureChunkEmbeddings(ctx context.Context, channel models.AIChannel, chunks []articleChunk) (map[int64][]float32, error) {
+	ids := make([]int64, 0, len(chunks))
+	for _, ch := range chunks {
+		if ch.ID > 0 {
+			ids = append(ids, ch.ID)
+		}
+	}
+	vectors := map[int64][]float32{}
+	if len(ids) == 0 {
+		return vectors, nil
+	}
+	q, args, err := sqlx.In("SELECT chunk_id, vector FROM chunk_embeddings WHERE model=? AND chunk_id IN (?)", channel.EmbeddingModel, ids)
+	if err != nil {
+		return nil, err
+	}
+	var rows []struct {
+		ChunkID int64  `db:"chunk_id"`
+		Vector  []byte `db:"vector"`
+	}
+	if err := s.db.Select(&rows, s.db.Rebind(q), args...); err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		vectors[row.ChunkID] = decodeVector(row.Vector)
+	}
+
+	var missing []articleChunk
+	for _, ch := range chunks {
+		if _, ok := vectors[ch.ID]; !ok && ch.ID > 0 {
+			missing = append(missing, ch)
+		}
+	}
+	err = s.embedChunks(ctx, channel, missing, func(id int64, vec []float32) {
+		vectors[id] = vec
+	})
+	return vectors, err
+}
+
+// embedChunks embeds chunks in batches and stores their vectors, calling
+// onEmbedded for each as its batch is stored.
+func (s *Service) embedChunks(ctx context.Context, channel models.AIChannel, chunks []articleChunk, onEmbedded func(id int64, vec []float32)) error {
+	for start := 0; start < len(chunks); start += embeddingBatchSize {
+		batch := chunks[start:min(start+embeddingBatchSize, len(chunks))]
+		texts := make([]string, len(batch))
+		for i, ch := range batch {
+			texts[i] = embeddingInput(ch)
+		}
+		vecs, err := s.embedTexts(ctx, channel, texts)
+		if err != nil {
+			return err
+		}
+		for i, ch := range batch {
+			if _, err := s.db.Exec(`
+				INSERT INTO chunk_embeddings(chunk_id, model, dims, vector)
+				VALUES(?,?,?,?)
+				ON CONFLICT(chunk_id, model) DO UPDATE SET dims=excluded.dims, vector=excluded.vector, created_at=CURRENT_TIMESTAMP
+			`, ch.ID, channel.EmbeddingModel, len(vecs[i]), encodeVector(vecs[i])); err != nil {
+				return err
+			}
+			if onEmbedded != nil {
+				onEmbedded(ch.ID, vecs[i])
+			}
+		}
+	}
+	return nil
+}
+
+// rankChunksHybrid ranks chunks by a mix of BM25, scaled to the best score
+// among them, and cosine similarity to the question, weight being the
+// share of the latter. Chunks without a vector rank by BM25 alone.
+func rankChunksHybrid(question string, chunks []articleChunk, qvec []float32, vectors map[int64][]float32, weight float64, k int) []articleChunk {
+	scored := scoreChunksBM25(question, chunks)
+	best := 0.0
+	for i := range scored {
+		if vec, ok := vectors[scored[i].ID]; ok {
+			scored[i].Similarity = cosineSimilarity(qvec, vec)
+		}
+		best = max(best, scored[i].Score)
+	}
+	return topChunks(scored, k, func(ch articleChunk) float64 {
+		rank := weight * max(ch.Similarity, 0)
+		if best > 0 {
+			rank += (1 - weight) * ch.Score / best
+		}
+		return rank
+	})
+}
+
+// retrieveChunks picks the sections a question is answered from: hybrid
+// BM25 and semantic ranking when semantic retrieval is on, BM25 alone when
+// it is off or the embedding calls fail.
+func (s *Service) retrieveChunks(ctx context.Context, question string, chunks []articleChunk, k int) []articleChunk {
+	cfg, channel, ok := s.embeddingChannel()
+	if !ok || len(chunks) == 0 {
+		return rankChunksBM25(question, chunks, k)
+	}
+	ctx, cancel := context.WithTimeout(ctx, embeddingQueryTimeout)
+	defer cancel()
+
+	vectors, err := s.ensureChunkEmbeddings(ctx, channel, chunks)
+	var qvecs [][]float32
+	if err == nil {
+		qvecs, err = s.embedTexts(ctx, channel, []string{question})
+	}
+	if err != nil {
+		log.Printf("[QA] semantic retrieval failed, using BM25 only: %s", err.Error())
+		return rankChunksBM25(question, chunks, k)
+	}
+	return rankChunksHybrid(question, chunks, qvecs[0], vectors, cfg.SemanticWeight, k)
+}
+
+// BackfillEmbeddings embeds every section of the library the embedding
+// model has no vector for, building sections first for articles imported
+// before they were stored, and returns how many it embedded. Telegraphs
+// are skipped. onProgress receives the count so far and the total.
+func (s *Service) BackfillEmbeddings(ctx context.Context, onProgress func(done, total int)) (int, error) {
+	_, channel, ok := s.embeddingChannel()
+	if !ok {
+		return 0, errors.New("请先在设置里启用语义检索，并选择配置了向量模型的渠道")
+	}
+
+	var articleIDs []int64
+	if err := s.db.Select(&articleIDs, `
+		SELECT a.id FROM articles a
+		WHERE a.source NOT LIKE ?
+		  AND NOT EXISTS (SELECT 1 FROM article_chunks c WHERE c.article_id=a.id)
+		ORDER BY a.id
+	`, telegraphSourcePrefixLike); err != nil {
+		return 0, err
+	}
+	for _, id := range articleIDs {
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+		article, err := s.GetArticle(id)
+		if err != nil {
+			return 0, err
+		}
+		if _, err := s.articleChunks(article); err != nil {
+			return 0, err
+		}
+	}
+
+	var missing []articleChunk
+	if err := s.db.Select(&missing, `
+		SELECT c.id, c.chunk_index, c.heading_path, c.text
+		FROM article_chunks c
+		JOIN articles a ON a.id = c.article_id
+		WHERE a.source NOT LIKE ?
+		  AND NOT EXISTS (SELECT 1 FROM chunk_embeddings e WHERE e.chunk_id=c.id AND e.model=?)
+		ORDER BY c.id
+	`, telegraphSourcePrefixLike, channel.EmbeddingModel); err != nil {
+		return 0, err
+	}
+
+	done := 0
+	if onProgress != nil {
+		onProgress(done, len(missing))
+	}
+	for start := 0; start < len(missing); start += embeddingBatchSize {
+		if err := ctx.Err(); err != nil {
+			return done, err
+		}
+		batch := missing[start:min(start+embeddingBatchSize, len(missing))]
+		if err := s.embedChunks(ctx, channel, batch, nil); err != nil {
+			return done, err
+		}
+		done += len(batch)
+		if onProgress != nil {
+			onProgress(done, len(missing))
+		}
+	}
+	return done, nil
+}
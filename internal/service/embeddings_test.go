@@ -0,0 +1,153 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"stock-report-analysis/internal/llmtest"
+	"stock-report-analysis/internal/models"
+)
+
+// topicEmbedder maps text onto three topics, profitability, energy storage
+// and everything else, the way a real model puts paraphrases close together.
+func topicEmbedder(input string) []float32 {
+	switch {
+	case strings.Contains(input, "利润") || strings.Contains(input, "毛利"):
+		return []float32{1, 0, 0}
+	case strings.Contains(input, "储能"):
+		return []float32{0, 1, 0}
+	default:
+		return []float32{0, 0, 1}
+	}
+}
+
+// enableEmbeddings stores srv as the default channel with an embedding
+// model and turns semantic retrieval on with it.
+func enableEmbeddings(t *testing.T, svc *Service, srv *llmtest.Server) models.AIChannel {
+	t.Helper()
+	srv.SetEmbedder(topicEmbedder)
+	ch := srv.Channel()
+	ch.ID = 0
+	ch.IsDefault = 1
+	ch.EmbeddingModel = "fake-embedding"
+	if err := svc.SaveChannel(ch); err != nil {
+		t.Fatalf("save channel: %v", err)
+	}
+	channels, err := svc.GetChannels()
+	if err != nil || len(channels) == 0 {
+		t.Fatalf("load channels: %v", err)
+	}
+	if err := svc.SaveEmbeddingConfig(models.EmbeddingConfig{Enabled: 1, ChannelID: channels[0].ID}); err != nil {
+		t.Fatalf("save embedding config: %v", err)
+	}
+	return channels[0]
+}
+
+func TestRankChunksHybridFindsParaphrase(t *testing.T) {
+	chunks := []articleChunk{
+		{ID: 1, Index: 1, HeadingPath: "储能业务", Text: "储能出货量同比增长 60%。"},
+		{ID: 2, Index: 2, HeadingPath: "经营分析", Text: "本季度毛利承压，原材料成本上涨。"},
+		{ID: 3, Index: 3, HeadingPath: "风险提示", Text: "下游需求不及预期。"},
+	}
+	vectors := map[int64][]float32{}
+	for _, ch := range chunks {
+		vectors[ch.ID] = normalizeVector(topicEmbedder(embeddingInput(ch)))
+	}
+	question := "利润率下降原因"
+	if got := rankChunksBM25(question, chunks, 1); got[0].Score > 0 {
+		t.Fatalf("BM25 alone matched %+v", got)
+	}
+
+	got := rankChunksHybrid(question, chunks, normalizeVector(topicEmbedder(question)), vectors, 0.5, 1)
+	if len(got) != 1 || got[0].Index != 2 {
+		t.Fatalf("ranked = %+v, want the margin section", got)
+	}
+	if reason := retrievalReason(got[0]); reason != "语义相似度 1.00" {
+		t.Errorf("reason = %q", reason)
+	}
+	if data := encodeVector(vectors[2]); len(decodeVector(data)) != len(vectors[2]) || decodeVector(data)[0] != vectors[2][0] {
+		t.Errorf("vector round trip failed")
+	}
+}
+
+func TestAskQuestionUsesSemanticRetrieval(t *testing.T) {
+	svc := newTestService(t)
+	srv := llmtest.New(t)
+	enableEmbeddings(t, svc, srv)
+	articleID := insertTestArticle(t, svc, "t", "## 储能业务\n储能出货量同比增长 60%。\n\n## 经营分析\n本季度毛利承压，原材料成本上涨。\n\n## 风险提示\n下游需求不及预期。")
+
+	srv.Enqueue(llmtest.Text("原材料成本上涨"))
+	rec := &qaRecorder{}
+	if _, err := svc.AskQuestionWithContextAndFollowUp(context.Background(), 0, articleID, "利润率下降原因", 0, rec.callbacks()); err != nil {
+		t.Fatalf("ask: %v", err)
+	}
+	messages, err := svc.GetQAMessages(rec.sessionID)
+	if err != nil || len(messages) != 2 || len(messages[1].Evidences) != 1 {
+		t.Fatalf("messages = %+v, err = %v", messages, err)
+	}
+	if ev := messages[1].Evidences[0]; ev.HeadingPath != "经营分析" || !strings.Contains(ev.Reason, "语义相似度") {
+		t.Errorf("evidence = %+v", ev)
+	}
+	reqs := srv.EmbeddingRequests()
+	if len(reqs) != 2 || len(reqs[0].Input) != 3 || reqs[0].Model != "fake-embedding" || reqs[1].Input[0] != "利润率下降原因" {
+		t.Fatalf("embedding requests = %+v", reqs)
+	}
+	var stored int
+	if err := svc.db.Get(&stored, "SELECT COUNT(*) FROM chunk_embeddings WHERE model='fake-embedding'"); err != nil || stored != 3 {
+		t.Errorf("stored vectors = %d, err = %v", stored, err)
+	}
+
+	// Stored vectors are reused; a failing endpoint falls back to BM25.
+	srv.SetEmbedder(nil)
+	srv.Enqueue(llmtest.Text("60%"))
+	if _, err := svc.AskQuestionWithContextAndFollowUp(context.Background(), rec.sessionID, articleID, "储能增长多少", 0, rec.callbacks()); err != nil {
+		t.Fatalf("ask again: %v", err)
+	}
+	if reqs := srv.EmbeddingRequests(); len(reqs) != 3 || reqs[2].Input[0] != "储能增长多少" {
+		t.Errorf("embedding requests = %+v", reqs)
+	}
+	messages, err = svc.GetQAMessages(rec.sessionID)
+	if err != nil || len(messages) != 4 || len(messages[3].Evidences) != 1 || !strings.HasPrefix(messages[3].Evidences[0].Reason, "BM25 ") {
+		t.Errorf("fallback messages = %+v, err = %v", messages, err)
+	}
+}
+
+func TestBackfillEmbeddings(t *testing.T) {
+	svc := newTestService(t)
+	srv := llmtest.New(t)
+	if _, err := svc.BackfillEmbeddings(context.Background(), nil); err == nil {
+		t.Fatal("backfill without semantic retrieval succeeded")
+	}
+	enableEmbeddings(t, svc, srv)
+	insertTestArticle(t, svc, "a", "## 投资要点\n维持买入评级。\n\n## 盈利预测\n预计净利润 120 亿元。")
+	insertTestArticle(t, svc, "b", "储能出货量同比增长 60%。")
+	svc.db.MustExec("INSERT INTO articles(title, content, source) VALUES('快讯', '## 快讯\n盘中异动。', 'cls-telegraph:1')")
+
+	var progress [][2]int
+	done, err := svc.BackfillEmbeddings(context.Background(), func(done, total int) {
+		progress = append(progress, [2]int{done, total})
+	})
+	if err != nil || done != 3 {
+		t.Fatalf("done = %d, err = %v", done, err)
+	}
+	if len(progress) != 2 || progress[0] != [2]int{0, 3} || progress[1] != [2]int{3, 3} {
+		t.Errorf("progress = %v", progress)
+	}
+	var stored int
+	if err := svc.db.Get(&stored, "SELECT COUNT(*) FROM chunk_embeddings"); err != nil || stored != 3 {
+		t.Errorf("stored vectors = %d, err = %v", stored, err)
+	}
+
+	if done, err := svc.BackfillEmbeddings(context.Background(), nil); err != nil || done != 0 {
+		t.Errorf("second run done = %d, err = %v", done, err)
+	}
+
+	ch := srv.Channel()
+	ch.ID = 0
+	ch.Provider = ProviderAnthropic
+	ch.EmbeddingModel = "fake-embedding"
+	if err := svc.SaveChannel(ch); err == nil {
+		t.Error("embedding model saved on an Anthropic channel")
+	}
+}
@@ -1,20 +1,72 @@
 package service
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
+	"strings"
 
 	"stock-report-analysis/internal/models"
 )
 
-func ExportMarkdown(article models.Article) string {
+func ExportMarkdown(article models.Article, structured *models.StructuredAnalysis) string {
 	md := fmt.Sprintf("# %s\n\n## 原文\n\n%s\n", article.Title, article.Content)
-	if article.Analysis != "" {
-		md += fmt.Sprintf("\n## AI 解读\n\n> 渠道: %s | 提示词: %s\n\n%s\n", article.ChannelUsed, article.PromptUsed, article.Analysis)
+	if article.Analysis == "" {
+		return md
 	}
+	md += fmt.Sprintf("\n## AI 解读\n\n> 渠道: %s | 提示词: %s\n\n", article.ChannelUsed, article.PromptUsed)
+	if structured == nil {
+		return md + article.Analysis + "\n"
+	}
+	if fields, ok := customStructuredFields(structured.Payload); ok {
+		for _, f := range fields {
+			md += "### " + f.Key + "\n\n" + markdownJSONValue(f.Value) + "\n"
+		}
+		return md
+	}
+	md += "### 核心结论\n\n" + orNone(structured.Summary) + "\n\n"
+	md += "### 主要风险\n\n" + markdownList(structured.Risks) + "\n"
+	md += "### 催化因素\n\n" + markdownList(structured.Catalysts) + "\n"
+	md += "### 估值观点\n\n" + orNone(structured.ValuationView) + "\n"
 	return md
 }
 
-func ExportToFile(article models.Article, path string) error {
-	return os.WriteFile(path, []byte(ExportMarkdown(article)), 0644)
+func (s *Service) ExportToFile(article models.Article, path string) error {
+	structured, err := s.GetStructuredAnalysis(article.ID)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(ExportMarkdown(article, structured)), 0644)
+}
+
+func markdownList(items []string) string {
+	if len(items) == 0 {
+		return "无\n"
+	}
+	var b strings.Builder
+	for _, item := range items {
+		b.WriteString("- " + item + "\n")
+	}
+	return b.String()
+}
+
+func orNone(s string) string {
+	if strings.TrimSpace(s) == "" {
+		return "无"
+	}
+	return s
+}
+
+// markdownJSONValue renders one top-level field of a custom-schema reply:
+// strings as text, string lists as bullets, anything else as a JSON block.
+func markdownJSONValue(raw json.RawMessage) string {
+	var text string
+	if json.Unmarshal(raw, &text) == nil {
+		return orNone(text) + "\n"
+	}
+	var items []string
+	if json.Unmarshal(raw, &items) == nil {
+		return markdownList(items)
+	}
+	return "```json\n" + formatStructuredJSON(string(raw), string(raw)) + "\n```\n"
 }
@@ -0,0 +1,273 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"stock-report-analysis/internal/models"
+)
+
+const (
+	aiFailoverConfigKey = "ai_failover_config_v1"
+
+	DefaultChannelMaxRetries     = 2
+	DefaultChannelRetryBackoffMs = 1000
+	maxChannelRetries            = 5
+	maxChannelRetryBackoffMs     = 60000
+
+	maxRetryBackoff = 30 * time.Second
+	maxRetryAfter   = 2 * time.Minute
+)
+
+// APIStatusError is a non-2xx reply from an AI endpoint.
+type APIStatusError struct {
+	StatusCode int
+	Body       string
+	RetryAfter time.Duration
+}
+
+func (e *APIStatusError) Error() string {
+	return fmt.Sprintf("API error %d: %s", e.StatusCode, e.Body)
+}
+
+// AnalysisAttempt is one call made by AnalyzeWithFailover. Attempt counts
+// from 1 across all channels of the chain.
+type AnalysisAttempt struct {
+	Channel   models.AIChannel
+	Attempt   int
+	Result    AnalysisResult
+	Err       error
+	StartedAt time.Time
+}
+
+// AnalyzeWithFailover retries in.Channel according to its retry policy and
+// then walks the fallback channels in order. onRetry is called for every
+// attempt that is followed by another one; the last attempt is returned.
+//
+// Once any chunk (answer or reasoning) has been streamed the error is
+// returned as is: retrying would replay text the caller has already shown.
+func (s *Service) AnalyzeWithFailover(ctx context.Context, in AnalysisRequest, fallbacks []models.AIChannel, onChunk func(string), onRetry func(AnalysisAttempt)) (AnalysisAttempt, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if onChunk == nil {
+		onChunk = func(string) {}
+	}
+
+	chain := append([]models.AIChannel{in.Channel}, fallbacks...)
+	attemptNo := 0
+	var last AnalysisAttempt
+	for i, channel := range chain {
+		maxRetries, backoffMs := channelRetryPolicy(channel)
+		for try := 0; try <= maxRetries; try++ {
+			attemptNo++
+			call := in
+			call.Channel = channel
+			streamed := false
+			if in.OnReasoning != nil {
+				call.OnReasoning = func(chunk string) {
+					streamed = true
+					in.OnReasoning(chunk)
+				}
+			}
+			startedAt := time.Now()
+			result, err := s.AnalyzeWithRequest(ctx, call, func(chunk string) {
+				streamed = true
+				onChunk(chunk)
+			})
+			last = AnalysisAttempt{Channel: channel, Attempt: attemptNo, Result: result, Err: err, StartedAt: startedAt}
+			if err == nil {
+				return last, nil
+			}
+			if ctx.Err() != nil || streamed {
+				return last, err
+			}
+
+			retrySame := try < maxRetries && isRetryableError(err)
+			if !retrySame && i == len(chain)-1 {
+				return last, err
+			}
+			if onRetry != nil {
+				onRetry(last)
+			}
+			if !retrySame {
+				break
+			}
+			if waitErr := sleepContext(ctx, retryDelay(backoffMs, try, err)); waitErr != nil {
+				return last, err
+			}
+		}
+	}
+	return last, last.Err
+}
+
+func channelRetryPolicy(channel models.AIChannel) (int, int) {
+	maxRetries := channel.MaxRetries
+	if maxRetries < 0 {
+		maxRetries = 0
+	}
+	if maxRetries > maxChannelRetries {
+		maxRetries = maxChannelRetries
+	}
+	backoffMs := channel.RetryBackoffMs
+	if backoffMs <= 0 {
+		backoffMs = DefaultChannelRetryBackoffMs
+	}
+	if backoffMs > maxChannelRetryBackoffMs {
+		backoffMs = maxChannelRetryBackoffMs
+	}
+	return maxRetries, backoffMs
+}
+
+// isRetryableError reports whether the same channel is worth calling again:
+// rate limits, server-side failures and transport errors.
+func isRetryableError(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var statusErr *APIStatusError
+	if errors.As(err, &statusErr) {
+		switch {
+		case statusErr.StatusCode == http.StatusTooManyRequests,
+			statusErr.StatusCode == http.StatusRequestTimeout,
+			statusErr.StatusCode >= 500:
+			return true
+		}
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// retryDelay doubles the base backoff per try with a little jitter; a larger
+// Retry-After from the server wins.
+func retryDelay(backoffMs int, try int, err error) time.Duration {
+	delay := time.Duration(backoffMs) * time.Millisecond << try
+	if delay > maxRetryBackoff || delay <= 0 {
+		delay = maxRetryBackoff
+	}
+	delay += time.Duration(rand.Int64N(int64(delay)/5 + 1))
+
+	var statusErr *APIStatusError
+	if errors.As(err, &statusErr) && statusErr.RetryAfter > delay {
+		delay = min(statusErr.RetryAfter, maxRetryAfter)
+	}
+	return delay
+}
+
+// parseRetryAfter accepts both forms of the header: delay-seconds and HTTP-date.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(value); err == nil {
+		if secs <= 0 {
+			return 0
+		}
+		return time.Duration(secs) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil && at.After(now) {
+		return at.Sub(now)
+	}
+	return 0
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func (s *Service) GetAIFailoverConfig() (models.AIFailoverConfig, error) {
+	cfg := models.AIFailoverConfig{ChannelIDs: []int64{}}
+
+	var raw string
+	err := s.db.Get(&raw, "SELECT value FROM app_configs WHERE key=?", aiFailoverConfigKey)
+	if errors.Is(err, sql.ErrNoRows) {
+		return cfg, nil
+	}
+	if err != nil {
+		return cfg, err
+	}
+	if json.Unmarshal([]byte(raw), &cfg) != nil {
+		return models.AIFailoverConfig{ChannelIDs: []int64{}}, nil
+	}
+	cfg.ChannelIDs = normalizeFailoverChannelIDs(cfg.ChannelIDs)
+	return cfg, nil
+}
+
+func (s *Service) SaveAIFailoverConfig(cfg models.AIFailoverConfig) error {
+	cfg.ChannelIDs = normalizeFailoverChannelIDs(cfg.ChannelIDs)
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(`
+		INSERT INTO app_configs(key, value, updated_at)
+		VALUES(?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT(key) DO UPDATE SET value=excluded.value, updated_at=CURRENT_TIMESTAMP
+	`, aiFailoverConfigKey, string(data))
+	return err
+}
+
+// FallbackChannelsFor returns the configured fallback channels in order,
+// skipping the primary channel and channels that no longer exist.
+func (s *Service) FallbackChannelsFor(primary models.AIChannel) ([]models.AIChannel, error) {
+	cfg, err := s.GetAIFailoverConfig()
+	if err != nil {
+		return nil, err
+	}
+	if len(cfg.ChannelIDs) == 0 {
+		return nil, nil
+	}
+	channels, err := s.GetChannels()
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[int64]models.AIChannel, len(channels))
+	for _, ch := range channels {
+		byID[ch.ID] = ch
+	}
+
+	out := make([]models.AIChannel, 0, len(cfg.ChannelIDs))
+	for _, id := range cfg.ChannelIDs {
+		ch, ok := byID[id]
+		if !ok || id == primary.ID {
+			continue
+		}
+		out = append(out, ch)
+	}
+	return out, nil
+}
+
+func normalizeFailoverChannelIDs(ids []int64) []int64 {
+	seen := make(map[int64]bool, len(ids))
+	out := make([]int64, 0, len(ids))
+	for _, id := range ids {
+		if id <= 0 || seen[id] {
+			continue
+		}
+		seen[id] = true
+		out = append(out, id)
+	}
+	return out
+}
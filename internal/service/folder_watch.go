@@ -0,0 +1,296 @@
+package service
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"stock-report-analysis/internal/models"
+)
+
+const folderWatchConfigKey = "folder_watch_config_v1"
+
+// Outcomes recorded in watched_files.
+const (
+	WatchedFileImported  = "imported"
+	WatchedFileDuplicate = "duplicate"
+	WatchedFileFailed    = "failed"
+)
+
+// folderWatchMaxAttempts is how often a file that fails to import is tried
+// before the watch leaves it alone until it changes.
+const folderWatchMaxAttempts = 3
+
+func defaultFolderWatchConfig() models.FolderWatchConfig {
+	return models.FolderWatchConfig{
+		Enabled:         0,
+		Dirs:            []string{},
+		IntervalMinutes: 10,
+		Mode:            AnalysisModeText,
+	}
+}
+
+func normalizeFolderWatchConfig(cfg models.FolderWatchConfig) models.FolderWatchConfig {
+	def := defaultFolderWatchConfig()
+	dirs := make([]string, 0, len(cfg.Dirs))
+	seen := map[string]bool{}
+	for _, dir := range cfg.Dirs {
+		dir = strings.TrimSpace(dir)
+		if dir == "" {
+			continue
+		}
+		dir = filepath.Clean(dir)
+		if !seen[dir] {
+			seen[dir] = true
+			dirs = append(dirs, dir)
+		}
+	}
+	cfg.Dirs = dirs
+	if cfg.IntervalMinutes <= 0 {
+		cfg.IntervalMinutes = def.IntervalMinutes
+	}
+	if cfg.IntervalMinutes > 1440 {
+		cfg.IntervalMinutes = 1440
+	}
+	if cfg.Enabled != 1 {
+		cfg.Enabled = 0
+	}
+	if cfg.AutoAnalyze != 1 {
+		cfg.AutoAnalyze = 0
+	}
+	if strings.EqualFold(cfg.Mode, AnalysisModeStructured) {
+		cfg.Mode = AnalysisModeStructured
+	} else {
+		cfg.Mode = AnalysisModeText
+	}
+	return cfg
+}
+
+func (s *Service) GetFolderWatchConfig() (models.FolderWatchConfig, error) {
+	cfg := defaultFolderWatchConfig()
+
+	var raw string
+	err := s.db.Get(&raw, "SELECT value FROM app_configs WHERE key=?", folderWatchConfigKey)
+	if errors.Is(err, sql.ErrNoRows) {
+		return cfg, nil
+	}
+	if err != nil {
+		return cfg, err
+	}
+
+	var stored models.FolderWatchConfig
+	if json.Unmarshal([]byte(raw), &stored) != nil {
+		return cfg, nil
+	}
+	return normalizeFolderWatchConfig(stored), nil
+}
+
+func (s *Service) SaveFolderWatchConfig(cfg models.FolderWatchConfig) error {
+	cfg = normalizeFolderWatchConfig(cfg)
+	for _, dir := range cfg.Dirs {
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			return fmt.Errorf("文件夹不存在: %s", dir)
+		}
+	}
+	if cfg.Enabled == 1 && len(cfg.Dirs) == 0 {
+		return errors.New("请至少添加一个监听文件夹")
+	}
+	if cfg.AutoAnalyze == 1 && (cfg.ChannelID <= 0 || cfg.PromptID <= 0) {
+		return errors.New("自动解读需要选择 AI 渠道和提示词")
+	}
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(`
+		INSERT INTO app_configs(key, value, updated_at)
+		VALUES(?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT(key) DO UPDATE SET value=excluded.value, updated_at=CURRENT_TIMESTAMP
+	`, folderWatchConfigKey, string(data))
+	return err
+}
+
+// WatchableDirs returns dirs and every folder below them that a scan
+// visits, for setting up change notifications.
+func WatchableDirs(dirs []string) []string {
+	var out []string
+	for _, root := range dirs {
+		_ = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+			if d.IsDir() {
+				if path != root && skipWatchedName(d.Name()) {
+					return filepath.SkipDir
+				}
+				out = append(out, path)
+			}
+			return nil
+		})
+	}
+	return out
+}
+
+// PendingWatchedFiles lists the importable files under dirs, subfolders
+// included, that still need processing, oldest first. Files recorded with
+// the same size and modification time are skipped without being read,
+// unless their import failed and may be retried. Files modified after
+// modifiedBefore may still be being written and wait for a later scan.
+// An unreadable folder does not stop the others; its error is returned
+// along with the files found.
+func (s *Service) PendingWatchedFiles(dirs []string, modifiedBefore time.Time) ([]string, error) {
+	type known struct {
+		Path     string `db:"path"`
+		Size     int64  `db:"size"`
+		ModTime  int64  `db:"mod_time"`
+		Status   string `db:"status"`
+		Attempts int    `db:"attempts"`
+	}
+	var rows []known
+	if err := s.db.Select(&rows, "SELECT path, size, mod_time, status, attempts FROM watched_files"); err != nil {
+		return nil, err
+	}
+	seen := make(map[string]known, len(rows))
+	for _, r := range rows {
+		seen[r.Path] = r
+	}
+
+	type candidate struct {
+		path    string
+		modTime time.Time
+	}
+	var found []candidate
+	var errs []error
+	for _, root := range dirs {
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if path == root {
+					return err
+				}
+				return nil
+			}
+			if path != root && skipWatchedName(d.Name()) {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if d.IsDir() || !d.Type().IsRegular() || !isImportableFile(path) {
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil || info.ModTime().After(modifiedBefore) {
+				return nil
+			}
+			if r, ok := seen[path]; ok && r.Size == info.Size() && r.ModTime == info.ModTime().UnixNano() &&
+				(r.Status != WatchedFileFailed || r.Attempts >= folderWatchMaxAttempts) {
+				return nil
+			}
+			found = append(found, candidate{path: path, modTime: info.ModTime()})
+			return nil
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("无法读取文件夹 %s: %w", root, err))
+		}
+	}
+
+	sort.SliceStable(found, func(i, j int) bool {
+		return found[i].modTime.Before(found[j].modTime)
+	})
+	paths := make([]string, len(found))
+	for i, c := range found {
+		paths[i] = c.path
+	}
+	return paths, errors.Join(errs...)
+}
+
+// skipWatchedName leaves out hidden entries and the lock files office
+// suites keep next to open documents.
+func skipWatchedName(name string) bool {
+	return strings.HasPrefix(name, ".") || strings.HasPrefix(name, "~$")
+}
+
+// ImportWatchedFile imports a file found by PendingWatchedFiles and records
+// the outcome under its path and hash. A file whose bytes the watch has
+// imported before, e.g. a copy or a renamed file, is recorded as a
+// duplicate without importing it again, even if that article has since
+// been deleted. A failed import is recorded, not returned; the error is
+// only for a file that cannot be read or a failed write.
+func (s *Service) ImportWatchedFile(path string) (models.WatchedFile, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return models.WatchedFile{}, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return models.WatchedFile{}, err
+	}
+	file := models.WatchedFile{Path: path, FileHash: hashBytes(data), Attempts: 1, ProcessedAt: time.Now()}
+
+	var earlier models.WatchedFile
+	err = s.db.Get(&earlier, `
+		SELECT w.article_id, COALESCE(a.title, '') AS title FROM watched_files w
+		LEFT JOIN articles a ON a.id = w.article_id
+		WHERE w.file_hash=? AND w.path<>? AND w.status<>?
+		ORDER BY w.processed_at LIMIT 1
+	`, file.FileHash, path, WatchedFileFailed)
+	switch {
+	case err == nil:
+		file.Status = WatchedFileDuplicate
+		file.ArticleID = earlier.ArticleID
+		file.Title = earlier.Title
+	case errors.Is(err, sql.ErrNoRows):
+		result, err := s.importFileData(path, data, file.FileHash, false)
+		switch {
+		case err != nil:
+			file.Status = WatchedFileFailed
+			file.Error = err.Error()
+			var attempts int
+			if s.db.Get(&attempts, "SELECT attempts FROM watched_files WHERE path=? AND file_hash=? AND status=?", path, file.FileHash, WatchedFileFailed) == nil {
+				file.Attempts = attempts + 1
+			}
+		case result.Duplicate != "":
+			file.Status = WatchedFileDuplicate
+		default:
+			file.Status = WatchedFileImported
+		}
+		file.ArticleID = result.Article.ID
+		file.Title = result.Article.Title
+	default:
+		return models.WatchedFile{}, err
+	}
+
+	_, err = s.db.Exec(`
+		INSERT INTO watched_files(path, file_hash, size, mod_time, article_id, status, error, attempts, processed_at)
+		VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(path) DO UPDATE SET
+			file_hash=excluded.file_hash, size=excluded.size, mod_time=excluded.mod_time,
+			article_id=excluded.article_id, status=excluded.status, error=excluded.error,
+			attempts=excluded.attempts, processed_at=excluded.processed_at
+	`, path, file.FileHash, info.Size(), info.ModTime().UnixNano(), file.ArticleID, file.Status, file.Error, file.Attempts, file.ProcessedAt)
+	return file, err
+}
+
+// GetWatchedFiles returns the most recently processed files.
+func (s *Service) GetWatchedFiles(limit int) ([]models.WatchedFile, error) {
+	if limit <= 0 || limit > 500 {
+		limit = 50
+	}
+	files := []models.WatchedFile{}
+	err := s.db.Select(&files, `
+		SELECT w.path, w.file_hash, w.article_id, COALESCE(a.title, '') AS title,
+			w.status, w.error, w.attempts, w.processed_at
+		FROM watched_files w
+		LEFT JOIN articles a ON a.id = w.article_id
+		ORDER BY w.processed_at DESC, w.path
+		LIMIT ?
+	`, limit)
+	return files, err
+}
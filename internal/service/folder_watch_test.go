@@ -0,0 +1,108 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"stock-report-analysis/internal/models"
+)
+
+func TestFolderWatchConfig(t *testing.T) {
+	svc := newTestService(t)
+	dir := t.TempDir()
+
+	if err := svc.SaveFolderWatchConfig(models.FolderWatchConfig{Enabled: 1}); err == nil {
+		t.Error("enabled without folders: expected an error")
+	}
+	if err := svc.SaveFolderWatchConfig(models.FolderWatchConfig{Dirs: []string{filepath.Join(dir, "missing")}}); err == nil {
+		t.Error("missing folder: expected an error")
+	}
+	if err := svc.SaveFolderWatchConfig(models.FolderWatchConfig{Dirs: []string{dir}, AutoAnalyze: 1}); err == nil {
+		t.Error("auto analyze without channel: expected an error")
+	}
+
+	err := svc.SaveFolderWatchConfig(models.FolderWatchConfig{Enabled: 1, Dirs: []string{" " + dir + " ", dir + "/", ""}, Mode: "STRUCTURED"})
+	if err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	cfg, err := svc.GetFolderWatchConfig()
+	if err != nil || len(cfg.Dirs) != 1 || cfg.Dirs[0] != dir || cfg.IntervalMinutes != 10 || cfg.Mode != AnalysisModeStructured {
+		t.Fatalf("config = %+v, %v", cfg, err)
+	}
+}
+
+func TestPendingAndImportWatchedFiles(t *testing.T) {
+	svc := newTestService(t)
+	dir := t.TempDir()
+	later := time.Now().Add(time.Minute)
+
+	first := writeImportFile(t, dir, "三季报点评.md", quarterlyReview)
+	old := time.Now().Add(-time.Hour)
+	os.Chtimes(first, old, old)
+	if err := os.Mkdir(filepath.Join(dir, "券商"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	nested := writeImportFile(t, filepath.Join(dir, "券商"), "宁德时代.txt", "储能电池出货量同比翻倍，海外订单占比提升至三成，钠离子电池明年量产，资本开支趋于平稳。")
+	writeImportFile(t, dir, "~$草稿.docx", "lock")
+	writeImportFile(t, dir, "说明.xlsx", "unsupported")
+	writeImportFile(t, dir, "空白.md", "   ")
+
+	pending, err := svc.PendingWatchedFiles([]string{dir, filepath.Join(dir, "missing")}, later)
+	if err == nil {
+		t.Error("missing folder: expected an error")
+	}
+	if len(pending) != 3 || pending[0] != first {
+		t.Fatalf("pending = %v", pending)
+	}
+	if recent, _ := svc.PendingWatchedFiles([]string{dir}, time.Now().Add(-time.Minute)); len(recent) != 1 {
+		t.Errorf("settled files = %v, want only the old one", recent)
+	}
+
+	statuses := map[string]string{}
+	for _, path := range pending {
+		file, err := svc.ImportWatchedFile(path)
+		if err != nil {
+			t.Fatalf("import %s: %v", path, err)
+		}
+		statuses[filepath.Base(path)] = file.Status
+	}
+	if statuses["三季报点评.md"] != WatchedFileImported || statuses["宁德时代.txt"] != WatchedFileImported || statuses["空白.md"] != WatchedFileFailed {
+		t.Fatalf("statuses = %v", statuses)
+	}
+
+	// A renamed copy is a duplicate even after its article was deleted;
+	// the failed file is retried until it runs out of attempts.
+	imported, _ := svc.GetWatchedFiles(10)
+	for _, f := range imported {
+		if f.Path == nested {
+			svc.DeleteArticle(f.ArticleID)
+		}
+	}
+	data, _ := os.ReadFile(nested)
+	writeImportFile(t, dir, "宁德时代-副本.txt", string(data))
+	for i := 0; i < folderWatchMaxAttempts; i++ {
+		pending, err = svc.PendingWatchedFiles([]string{dir}, later)
+		if err != nil {
+			t.Fatalf("pending: %v", err)
+		}
+		for _, path := range pending {
+			file, err := svc.ImportWatchedFile(path)
+			if err != nil {
+				t.Fatalf("import %s: %v", path, err)
+			}
+			if filepath.Base(path) == "宁德时代-副本.txt" && file.Status != WatchedFileDuplicate {
+				t.Errorf("copy = %+v", file)
+			}
+		}
+	}
+	if pending, _ = svc.PendingWatchedFiles([]string{dir}, later); len(pending) != 0 {
+		t.Errorf("pending after retries = %v", pending)
+	}
+	var articles int
+	svc.db.Get(&articles, "SELECT COUNT(*) FROM articles")
+	if articles != 1 {
+		t.Errorf("articles = %d, want 1", articles)
+	}
+}
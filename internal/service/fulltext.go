@@ -0,0 +1,525 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"sort"
+	"strings"
+	"unicode"
+
+	"stock-report-analysis/internal/models"
+)
+
+// Scopes of SearchFullText.
+const (
+	SearchScopeAll     = "all"
+	SearchScopeArticle = "article"
+	SearchScopeQA      = "qa"
+)
+
+const (
+	// minIndexedTermRunes is the shortest term the trigram index can match.
+	// Shorter terms, which includes most two-character Chinese words, fall
+	// back to LIKE on the source columns.
+	minIndexedTermRunes = 3
+	maxSearchLimit      = 200
+	snippetLead         = 24
+	snippetWidth        = 120
+)
+
+// searchNode is one node of a parsed query: a term, or and/or/not over
+// child nodes.
+type searchNode struct {
+	op    string
+	term  string
+	nodes []*searchNode
+}
+
+// searchQuery is a user query parsed for full-text search. Terms are
+// separated by spaces (AND); AND, OR, NOT (upper case), a leading "-",
+// parentheses and "quoted phrases" are supported.
+type searchQuery struct {
+	root *searchNode
+	// terms are the terms outside NOT, used for ranking and highlighting.
+	terms []string
+}
+
+// searchTarget describes one indexed table for SQL generation.
+type searchTarget struct {
+	ftsTable string
+	idExpr   string
+	// columns are the source columns searched with LIKE for short terms.
+	columns []string
+	// rank is the bm25() call with per-column weights.
+	rank string
+}
+
+var (
+	articleSearchTarget = searchTarget{
+		ftsTable: "articles_fts",
+		idExpr:   "a.id",
+		columns:  []string{"a.title", "a.content", "a.analysis"},
+		rank:     "bm25(articles_fts, 5.0, 1.0, 2.0)",
+	}
+	qaSearchTarget = searchTarget{
+		ftsTable: "qa_messages_fts",
+		idExpr:   "m.id",
+		columns:  []string{"m.content"},
+		rank:     "bm25(qa_messages_fts)",
+	}
+)
+
+type searchToken struct {
+	text   string
+	quoted bool
+}
+
+func (t searchToken) is(op string) bool {
+	return !t.quoted && t.text == op
+}
+
+func tokenizeSearchQuery(q string) []searchToken {
+	var tokens []searchToken
+	runes := []rune(q)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(' || r == ')':
+			tokens = append(tokens, searchToken{text: string(r)})
+			i++
+		case r == '"':
+			j := i + 1
+			for j < len(runes) && runes[j] != '"' {
+				j++
+			}
+			if phrase := strings.TrimSpace(string(runes[i+1 : j])); phrase != "" {
+				tokens = append(tokens, searchToken{text: phrase, quoted: true})
+			}
+			i = j + 1
+		case r == '-' && i+1 < len(runes) && !unicode.IsSpace(runes[i+1]) && (i == 0 || unicode.IsSpace(runes[i-1]) || runes[i-1] == '('):
+			tokens = append(tokens, searchToken{text: "NOT"})
+			i++
+		default:
+			j := i
+			for j < len(runes) && !unicode.IsSpace(runes[j]) && runes[j] != '(' && runes[j] != ')' && runes[j] != '"' {
+				j++
+			}
+			tokens = append(tokens, searchToken{text: string(runes[i:j])})
+			i = j
+		}
+	}
+	return tokens
+}
+
+type searchParser struct {
+	tokens []searchToken
+	pos    int
+}
+
+func (p *searchParser) peek() (searchToken, bool) {
+	if p.pos >= len(p.tokens) {
+		return searchToken{}, false
+	}
+	return p.tokens[p.pos], true
+}
+
+func (p *searchParser) parseOr() *searchNode {
+	nodes := []*searchNode{p.parseAnd()}
+	for {
+		tok, ok := p.peek()
+		if !ok || !tok.is("OR") {
+			break
+		}
+		p.pos++
+		nodes = append(nodes, p.parseAnd())
+	}
+	return joinSearchNodes("or", nodes)
+}
+
+func (p *searchParser) parseAnd() *searchNode {
+	var nodes []*searchNode
+	for {
+		tok, ok := p.peek()
+		if !ok || tok.is("OR") || tok.is(")") {
+			break
+		}
+		if tok.is("AND") {
+			p.pos++
+			continue
+		}
+		nodes = append(nodes, p.parseUnary())
+	}
+	return joinSearchNodes("and", nodes)
+}
+
+func (p *searchParser) parseUnary() *searchNode {
+	tok, _ := p.peek()
+	p.pos++
+	switch {
+	case tok.is("NOT"):
+		if next, ok := p.peek(); !ok || next.is("OR") || next.is(")") {
+			return nil
+		}
+		if child := p.parseUnary(); child != nil {
+			return &searchNode{op: "not", nodes: []*searchNode{child}}
+		}
+		return nil
+	case tok.is("("):
+		node := p.parseOr()
+		if next, ok := p.peek(); ok && next.is(")") {
+			p.pos++
+		}
+		return node
+	default:
+		return &searchNode{op: "term", term: tok.text}
+	}
+}
+
+// joinSearchNodes combines the non-nil nodes with op.
+func joinSearchNodes(op string, nodes []*searchNode) *searchNode {
+	kept := nodes[:0]
+	for _, n := range nodes {
+		if n != nil {
+			kept = append(kept, n)
+		}
+	}
+	switch len(kept) {
+	case 0:
+		return nil
+	case 1:
+		return kept[0]
+	}
+	return &searchNode{op: op, nodes: kept}
+}
+
+func parseSearchQuery(q string) (searchQuery, error) {
+	p := &searchParser{tokens: tokenizeSearchQuery(q)}
+	var parts []*searchNode
+	for p.pos < len(p.tokens) {
+		parts = append(parts, p.parseOr())
+		// Skip a stray ")" so the rest of the query still counts.
+		if tok, ok := p.peek(); ok && tok.is(")") {
+			p.pos++
+		}
+	}
+	root := joinSearchNodes("and", parts)
+	if root == nil {
+		return searchQuery{}, errors.New("请输入搜索关键词")
+	}
+	query := searchQuery{root: root}
+	query.collectTerms(root)
+	return query, nil
+}
+
+func (q *searchQuery) collectTerms(n *searchNode) {
+	switch n.op {
+	case "term":
+		q.terms = append(q.terms, n.term)
+	case "not":
+	default:
+		for _, child := range n.nodes {
+			q.collectTerms(child)
+		}
+	}
+}
+
+// filter returns a WHERE condition matching the query on target.
+func (q searchQuery) filter(t searchTarget) (string, []any) {
+	var args []any
+	return q.nodeSQL(q.root, t, &args), args
+}
+
+func (q searchQuery) nodeSQL(n *searchNode, t searchTarget, args *[]any) string {
+	switch n.op {
+	case "term":
+		if len([]rune(n.term)) >= minIndexedTermRunes {
+			*args = append(*args, ftsPhrase(n.term))
+			return fmt.Sprintf("%s IN (SELECT rowid FROM %s WHERE %s MATCH ?)", t.idExpr, t.ftsTable, t.ftsTable)
+		}
+		like := "%" + escapeLike(n.term) + "%"
+		parts := make([]string, 0, len(t.columns))
+		for _, col := range t.columns {
+			parts = append(parts, col+` LIKE ? ESCAPE '\'`)
+			*args = append(*args, like)
+		}
+		return "(" + strings.Join(parts, " OR ") + ")"
+	case "not":
+		return "NOT " + q.nodeSQL(n.nodes[0], t, args)
+	}
+	parts := make([]string, 0, len(n.nodes))
+	for _, child := range n.nodes {
+		parts = append(parts, q.nodeSQL(child, t, args))
+	}
+	return "(" + strings.Join(parts, " "+strings.ToUpper(n.op)+" ") + ")"
+}
+
+// rankJoin left-joins the bm25 rank of the indexed terms as r.rank. ok is
+// false when no term is long enough to be ranked.
+func (q searchQuery) rankJoin(t searchTarget) (join string, args []any, ok bool) {
+	var phrases []string
+	for _, term := range q.terms {
+		if len([]rune(term)) >= minIndexedTermRunes {
+			phrases = append(phrases, ftsPhrase(term))
+		}
+	}
+	if len(phrases) == 0 {
+		return "", nil, false
+	}
+	join = fmt.Sprintf("LEFT JOIN (SELECT rowid, %s AS rank FROM %s WHERE %s MATCH ?) r ON r.rowid = %s",
+		t.rank, t.ftsTable, t.ftsTable, t.idExpr)
+	return join, []any{strings.Join(phrases, " OR ")}, true
+}
+
+// ftsPhrase quotes term as an FTS5 string so operators and punctuation in
+// it are matched literally.
+func ftsPhrase(term string) string {
+	return `"` + strings.ReplaceAll(term, `"`, `""`) + `"`
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// keywordFilter is the article-list form of the search: it returns a
+// condition on alias a, or "" when keyword has no usable term.
+func keywordFilter(keyword string) (string, []any) {
+	query, err := parseSearchQuery(keyword)
+	if err != nil {
+		return "", nil
+	}
+	return query.filter(articleSearchTarget)
+}
+
+type articleSearchRow struct {
+	models.SearchHit
+	Content  string `db:"content"`
+	Analysis string `db:"analysis"`
+}
+
+type qaSearchRow struct {
+	models.SearchHit
+	RoleType string `db:"role_type"`
+	Content  string `db:"content"`
+}
+
+// SearchFullText searches articles (title, content, analysis) and QA
+// messages. Results are ordered by relevance, newest first among equals.
+func (s *Service) SearchFullText(query string, scope string, limit int) ([]models.SearchHit, error) {
+	parsed, err := parseSearchQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	if limit <= 0 || limit > maxSearchLimit {
+		limit = 50
+	}
+	switch scope {
+	case "", SearchScopeAll, SearchScopeArticle, SearchScopeQA:
+	default:
+		return nil, fmt.Errorf("不支持的搜索范围: %s", scope)
+	}
+
+	hits := []models.SearchHit{}
+	if scope != SearchScopeQA {
+		articleHits, err := s.searchArticles(parsed, limit)
+		if err != nil {
+			return nil, err
+		}
+		hits = append(hits, articleHits...)
+	}
+	if scope != SearchScopeArticle {
+		qaHits, err := s.searchQAMessages(parsed, limit)
+		if err != nil {
+			return nil, err
+		}
+		hits = append(hits, qaHits...)
+	}
+
+	sort.SliceStable(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score < hits[j].Score
+		}
+		return hits[i].CreatedAt.After(hits[j].CreatedAt)
+	})
+	if len(hits) > limit {
+		hits = hits[:limit]
+	}
+	return hits, nil
+}
+
+func (s *Service) searchArticles(q searchQuery, limit int) ([]models.SearchHit, error) {
+	where, args := q.filter(articleSearchTarget)
+	join, joinArgs, ranked := q.rankJoin(articleSearchTarget)
+	score := "0"
+	if ranked {
+		score = "COALESCE(r.rank, 0)"
+	}
+
+	var rows []articleSearchRow
+	if err := s.db.Select(&rows, fmt.Sprintf(`
+		SELECT
+			'article' AS kind, a.id AS article_id, 0 AS session_id, 0 AS message_id,
+			a.title, a.source, a.content, a.analysis, %s AS score, a.created_at
+		FROM articles a
+		%s
+		WHERE %s
+		ORDER BY score ASC, a.id DESC
+		LIMIT ?
+	`, score, join, where), append(append(joinArgs, args...), limit)...); err != nil {
+		return nil, err
+	}
+
+	hits := make([]models.SearchHit, 0, len(rows))
+	for _, row := range rows {
+		hit := row.SearchHit
+		hit.Field, hit.Snippet = "content", ""
+		for _, field := range []struct{ name, text string }{
+			{"content", row.Content},
+			{"analysis", row.Analysis},
+			{"title", row.Title},
+		} {
+			if snippet, ok := highlightSnippet(field.text, q.terms); ok {
+				hit.Field, hit.Snippet = field.name, snippet
+				break
+			}
+		}
+		if hit.Snippet == "" {
+			hit.Snippet, _ = highlightSnippet(row.Content, nil)
+		}
+		hits = append(hits, hit)
+	}
+	return hits, nil
+}
+
+func (s *Service) searchQAMessages(q searchQuery, limit int) ([]models.SearchHit, error) {
+	where, args := q.filter(qaSearchTarget)
+	join, joinArgs, ranked := q.rankJoin(qaSearchTarget)
+	score := "0"
+	if ranked {
+		score = "COALESCE(r.rank, 0)"
+	}
+
+	var rows []qaSearchRow
+	if err := s.db.Select(&rows, fmt.Sprintf(`
+		SELECT
+			'qa' AS kind, COALESCE(m.article_id, 0) AS article_id, m.session_id, m.id AS message_id,
+			COALESCE(NULLIF(qs.title, ''), a.title, '') AS title, COALESCE(a.source, '') AS source,
+			m.role_type, m.content, %s AS score, m.created_at
+		FROM qa_messages m
+		LEFT JOIN articles a ON a.id = m.article_id
+		LEFT JOIN qa_sessions qs ON qs.id = m.session_id
+		%s
+		WHERE m.content <> '' AND %s
+		ORDER BY score ASC, m.id DESC
+		LIMIT ?
+	`, score, join, where), append(append(joinArgs, args...), limit)...); err != nil {
+		return nil, err
+	}
+
+	hits := make([]models.SearchHit, 0, len(rows))
+	for _, row := range rows {
+		hit := row.SearchHit
+		hit.Field = "answer"
+		if row.RoleType == "user" {
+			hit.Field = "question"
+		}
+		if snippet, ok := highlightSnippet(row.Content, q.terms); ok {
+			hit.Snippet = snippet
+		} else {
+			hit.Snippet, _ = highlightSnippet(row.Content, nil)
+		}
+		hits = append(hits, hit)
+	}
+	return hits, nil
+}
+
+// highlightSnippet cuts a window of text around the first occurrence of any
+// term and wraps every occurrence inside it in <mark>. The result is
+// HTML-escaped. With no terms it returns the start of text; ok reports
+// whether a term was found.
+func highlightSnippet(text string, terms []string) (string, bool) {
+	runes := []rune(text)
+	lower := make([]rune, len(runes))
+	for i, r := range runes {
+		lower[i] = unicode.ToLower(r)
+	}
+
+	type span struct{ start, end int }
+	var spans []span
+	for _, term := range terms {
+		needle := []rune(strings.ToLower(term))
+		if len(needle) == 0 {
+			continue
+		}
+		for i := 0; i+len(needle) <= len(lower); i++ {
+			if runesEqual(lower[i:i+len(needle)], needle) {
+				spans = append(spans, span{i, i + len(needle)})
+			}
+		}
+	}
+	if len(terms) > 0 && len(spans) == 0 {
+		return "", false
+	}
+	sort.Slice(spans, func(i, j int) bool { return spans[i].start < spans[j].start })
+
+	from := 0
+	if len(spans) > 0 {
+		from = max(0, spans[0].start-snippetLead)
+	}
+	to := min(len(runes), from+snippetWidth)
+
+	var b strings.Builder
+	if from > 0 {
+		b.WriteString("…")
+	}
+	pos := from
+	for _, sp := range spans {
+		if sp.start < pos || sp.start >= to {
+			continue
+		}
+		end := min(sp.end, to)
+		b.WriteString(snippetText(runes[pos:sp.start]))
+		b.WriteString("<mark>")
+		b.WriteString(snippetText(runes[sp.start:end]))
+		b.WriteString("</mark>")
+		pos = end
+	}
+	b.WriteString(snippetText(runes[pos:to]))
+	if to < len(runes) {
+		b.WriteString("…")
+	}
+	return b.String(), len(spans) > 0
+}
+
+func runesEqual(a, b []rune) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// snippetText escapes runes for HTML and folds runs of whitespace, line
+// breaks included, into single spaces.
+func snippetText(runes []rune) string {
+	var b strings.Builder
+	space := false
+	for _, r := range runes {
+		if unicode.IsSpace(r) {
+			space = true
+			continue
+		}
+		if space {
+			b.WriteByte(' ')
+			space = false
+		}
+		b.WriteRune(r)
+	}
+	if space {
+		b.WriteByte(' ')
+	}
+	return html.EscapeString(b.String())
+}
@@ -0,0 +1,191 @@
+package service
+
+import (
+	"strings"
+	"testing"
+
+	"stock-report-analysis/internal/models"
+)
+
+func searchTitles(t *testing.T, svc *Service, query, scope string) []string {
+	t.Helper()
+	hits, err := svc.SearchFullText(query, scope, 0)
+	if err != nil {
+		t.Fatalf("search %q: %v", query, err)
+	}
+	titles := make([]string, 0, len(hits))
+	for _, h := range hits {
+		titles = append(titles, h.Title)
+	}
+	return titles
+}
+
+func TestParseSearchQuery(t *testing.T) {
+	tests := []struct {
+		query string
+		where string
+		terms []string
+	}{
+		{"新能源", "a.id IN (SELECT rowid FROM articles_fts WHERE articles_fts MATCH ?)", []string{"新能源"}},
+		{"营收 新能源", "((a.title LIKE ? ESCAPE '\\' OR a.content LIKE ? ESCAPE '\\' OR a.analysis LIKE ? ESCAPE '\\') AND a.id IN (SELECT rowid FROM articles_fts WHERE articles_fts MATCH ?))", []string{"营收", "新能源"}},
+		// As in FTS5, AND binds tighter than OR.
+		{"光伏组件 OR 储能电池 -减值损失", "(a.id IN (SELECT rowid FROM articles_fts WHERE articles_fts MATCH ?) OR (a.id IN (SELECT rowid FROM articles_fts WHERE articles_fts MATCH ?) AND NOT a.id IN (SELECT rowid FROM articles_fts WHERE articles_fts MATCH ?)))", []string{"光伏组件", "储能电池"}},
+		{`("毛利率 提升" OR 降本增效) AND NOT 亏损扩大`, "((a.id IN (SELECT rowid FROM articles_fts WHERE articles_fts MATCH ?) OR a.id IN (SELECT rowid FROM articles_fts WHERE articles_fts MATCH ?)) AND NOT a.id IN (SELECT rowid FROM articles_fts WHERE articles_fts MATCH ?))", []string{"毛利率 提升", "降本增效"}},
+		{"半导体 )", "a.id IN (SELECT rowid FROM articles_fts WHERE articles_fts MATCH ?)", []string{"半导体"}},
+	}
+	for _, tt := range tests {
+		q, err := parseSearchQuery(tt.query)
+		if err != nil {
+			t.Fatalf("%q: %v", tt.query, err)
+		}
+		where, _ := q.filter(articleSearchTarget)
+		if where != tt.where {
+			t.Errorf("%q: where = %s, want %s", tt.query, where, tt.where)
+		}
+		if strings.Join(q.terms, "|") != strings.Join(tt.terms, "|") {
+			t.Errorf("%q: terms = %v, want %v", tt.query, q.terms, tt.terms)
+		}
+	}
+
+	for _, query := range []string{"", "  ", "AND OR", "()", `""`} {
+		if _, err := parseSearchQuery(query); err == nil {
+			t.Errorf("%q: expected an error", query)
+		}
+	}
+}
+
+func TestSearchFullTextArticles(t *testing.T) {
+	svc := newTestService(t)
+	insertTestArticle(t, svc, "光伏行业周报", "本周光伏组件价格继续下行，硅料库存高企。")
+	insertTestArticle(t, svc, "储能深度报告", "储能电池出货量同比翻倍，营收增长显著。")
+	insertTestArticle(t, svc, "银行业点评", "净息差收窄，营收承压；光伏贷款不良率上升。")
+
+	if got := searchTitles(t, svc, "光伏组件", SearchScopeArticle); strings.Join(got, ",") != "光伏行业周报" {
+		t.Fatalf("phrase search = %v", got)
+	}
+	// Two-character terms are below the trigram size and use LIKE.
+	if got := searchTitles(t, svc, "营收", SearchScopeArticle); len(got) != 2 {
+		t.Fatalf("short term search = %v", got)
+	}
+	if got := searchTitles(t, svc, "营收 -净息差", SearchScopeArticle); strings.Join(got, ",") != "储能深度报告" {
+		t.Fatalf("exclusion = %v", got)
+	}
+	if got := searchTitles(t, svc, "光伏组件 OR 储能电池", SearchScopeArticle); len(got) != 2 {
+		t.Fatalf("OR = %v", got)
+	}
+	if got := searchTitles(t, svc, "光伏 AND 不良率", SearchScopeArticle); strings.Join(got, ",") != "银行业点评" {
+		t.Fatalf("AND = %v", got)
+	}
+	// Titles weigh more than body text.
+	if got := searchTitles(t, svc, "光伏行业 OR 光伏贷款", SearchScopeArticle); len(got) != 2 || got[0] != "光伏行业周报" {
+		t.Fatalf("ranking = %v", got)
+	}
+}
+
+func TestSearchFullTextFollowsUpdatesAndDeletes(t *testing.T) {
+	svc := newTestService(t)
+	id := insertTestArticle(t, svc, "公司点评", "原文未提及目标价。")
+
+	if got := searchTitles(t, svc, "上调目标价", SearchScopeAll); len(got) != 0 {
+		t.Fatalf("before analysis = %v", got)
+	}
+	if err := svc.SaveArticleAnalysis(id, AnalysisOutcome{Analysis: "维持买入评级，上调目标价至 50 元。"}); err != nil {
+		t.Fatalf("save analysis: %v", err)
+	}
+	hits, err := svc.SearchFullText("上调目标价", SearchScopeArticle, 10)
+	if err != nil || len(hits) != 1 {
+		t.Fatalf("after analysis = %v, %v", hits, err)
+	}
+	if hits[0].Field != "analysis" || !strings.Contains(hits[0].Snippet, "<mark>上调目标价</mark>") {
+		t.Fatalf("hit = %+v", hits[0])
+	}
+
+	if err := svc.DeleteArticle(id); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if got := searchTitles(t, svc, "上调目标价", SearchScopeAll); len(got) != 0 {
+		t.Fatalf("after delete = %v", got)
+	}
+}
+
+func TestSearchFullTextQAMessages(t *testing.T) {
+	svc := newTestService(t)
+	articleID := insertTestArticle(t, svc, "医药行业报告", "创新药出海加速。")
+	res, err := svc.db.Exec("INSERT INTO qa_sessions(article_id, title) VALUES(?, ?)", articleID, "出海问答")
+	if err != nil {
+		t.Fatalf("insert session: %v", err)
+	}
+	sessionID, _ := res.LastInsertId()
+	for _, m := range []models.QAMessage{
+		{RoleType: "user", Content: "海外授权收入能持续吗？"},
+		{RoleType: "assistant", Content: "海外授权收入取决于 <BD> 节奏，首付款占比较高。"},
+	} {
+		if _, err := svc.db.Exec("INSERT INTO qa_messages(session_id, article_id, role_type, content) VALUES(?, ?, ?, ?)",
+			sessionID, articleID, m.RoleType, m.Content); err != nil {
+			t.Fatalf("insert message: %v", err)
+		}
+	}
+
+	hits, err := svc.SearchFullText("首付款", SearchScopeAll, 10)
+	if err != nil || len(hits) != 1 {
+		t.Fatalf("hits = %v, %v", hits, err)
+	}
+	hit := hits[0]
+	if hit.Kind != "qa" || hit.ArticleID != articleID || hit.SessionID != sessionID || hit.Field != "answer" || hit.Title != "出海问答" {
+		t.Fatalf("hit = %+v", hit)
+	}
+	if !strings.Contains(hit.Snippet, "&lt;BD&gt;") || !strings.Contains(hit.Snippet, "<mark>首付款</mark>") {
+		t.Fatalf("snippet = %q", hit.Snippet)
+	}
+
+	if got := searchTitles(t, svc, "海外授权收入", SearchScopeArticle); len(got) != 0 {
+		t.Fatalf("article scope returned QA: %v", got)
+	}
+	if got := searchTitles(t, svc, "海外授权收入", SearchScopeQA); len(got) != 2 {
+		t.Fatalf("qa scope = %v", got)
+	}
+
+	// Deleting the article cascades to the messages and their index rows.
+	if err := svc.DeleteArticle(articleID); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	var indexed int
+	if err := svc.db.Get(&indexed, "SELECT COUNT(*) FROM qa_messages_fts WHERE qa_messages_fts MATCH ?", ftsPhrase("首付款")); err != nil || indexed != 0 {
+		t.Fatalf("indexed after delete = %d, %v", indexed, err)
+	}
+}
+
+func TestHighlightSnippet(t *testing.T) {
+	text := strings.Repeat("前文", 40) + "ROE\n提升明显，roe 继续改善" + strings.Repeat("后文", 80)
+	snippet, ok := highlightSnippet(text, []string{"roe"})
+	if !ok {
+		t.Fatal("term not found")
+	}
+	if !strings.HasPrefix(snippet, "…") || !strings.HasSuffix(snippet, "…") {
+		t.Fatalf("snippet not trimmed: %q", snippet)
+	}
+	if !strings.Contains(snippet, "<mark>ROE</mark> 提升明显，<mark>roe</mark>") {
+		t.Fatalf("snippet = %q", snippet)
+	}
+	if _, ok := highlightSnippet("无关内容", []string{"roe"}); ok {
+		t.Fatal("unexpected match")
+	}
+}
+
+func TestGetArticlesKeywordUsesFullText(t *testing.T) {
+	svc := newTestService(t)
+	id := insertTestArticle(t, svc, "消费行业跟踪", "白酒动销平稳。")
+	insertTestArticle(t, svc, "地产行业跟踪", "销售面积同比下降。")
+	if err := svc.SaveArticleAnalysis(id, AnalysisOutcome{Analysis: "高端白酒批价企稳回升。"}); err != nil {
+		t.Fatalf("save analysis: %v", err)
+	}
+
+	page, err := svc.GetArticles(models.ArticleQuery{Keyword: "批价企稳"})
+	if err != nil || len(page.Items) != 1 || page.Items[0].ID != id {
+		t.Fatalf("analysis keyword = %v, %v", page.Items, err)
+	}
+	page, err = svc.GetArticles(models.ArticleQuery{Keyword: "行业跟踪 -白酒"})
+	if err != nil || len(page.Items) != 1 || page.Items[0].Title != "地产行业跟踪" {
+		t.Fatalf("exclusion = %v, %v", page.Items, err)
+	}
+}
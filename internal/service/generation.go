@@ -0,0 +1,52 @@
+package service
+
+import (
+	"errors"
+	"strings"
+
+	"stock-report-analysis/internal/models"
+)
+
+const (
+	maxGenerationTokens = 32768
+	maxStopSequences    = 4
+)
+
+// NormalizeGenerationOptions trims stop sequences and rejects values that
+// every provider would refuse anyway.
+func NormalizeGenerationOptions(opts models.GenerationOptions) (models.GenerationOptions, error) {
+	if opts.Temperature != nil && (*opts.Temperature < 0 || *opts.Temperature > 2) {
+		return opts, errors.New("temperature 需在 0 ~ 2 之间")
+	}
+	if opts.TopP != nil && (*opts.TopP <= 0 || *opts.TopP > 1) {
+		return opts, errors.New("top_p 需在 (0, 1] 之间")
+	}
+	if opts.MaxTokens < 0 {
+		opts.MaxTokens = 0
+	}
+	if opts.MaxTokens > maxGenerationTokens {
+		return opts, errors.New("max_tokens 超出上限")
+	}
+
+	stops := make([]string, 0, len(opts.Stop))
+	for _, s := range opts.Stop {
+		if strings.TrimSpace(s) == "" {
+			continue
+		}
+		stops = append(stops, s)
+	}
+	if len(stops) > maxStopSequences {
+		return opts, errors.New("stop 最多支持 4 个")
+	}
+	opts.Stop = nil
+	if len(stops) > 0 {
+		opts.Stop = stops
+	}
+	return opts, nil
+}
+
+func sameGenerationOptions(a, b models.GenerationOptions) bool {
+	av, _ := a.Value()
+	bv, _ := b.Value()
+	return av == bv
+}
@@ -0,0 +1,207 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"stock-report-analysis/internal/models"
+)
+
+const (
+	limiterWindow      = time.Minute
+	limiterWaitSamples = 50
+)
+
+// channelLimiter enforces a channel's requests-per-minute, tokens-per-minute
+// and in-flight budgets. Every AI call goes through the limiter of its
+// channel, so batch, QA and telegraph runs share the same budget.
+type channelLimiter struct {
+	mu          sync.Mutex
+	rpm         int
+	tpm         int
+	maxInFlight int
+
+	inFlight int
+	waiting  int
+	requests []time.Time
+	tokens   []*tokenEvent
+	// wake is closed and replaced whenever capacity may have been freed.
+	wake chan struct{}
+
+	waitSamples []time.Duration
+}
+
+type tokenEvent struct {
+	at     time.Time
+	tokens int
+}
+
+func (s *Service) limiterFor(channel models.AIChannel) *channelLimiter {
+	s.limitersMu.Lock()
+	l, ok := s.limiters[channel.ID]
+	if !ok {
+		l = &channelLimiter{wake: make(chan struct{})}
+		s.limiters[channel.ID] = l
+	}
+	s.limitersMu.Unlock()
+
+	// Pick up edits made in settings without restarting.
+	l.mu.Lock()
+	l.rpm = max(channel.RPMLimit, 0)
+	l.tpm = max(channel.TPMLimit, 0)
+	l.maxInFlight = max(channel.MaxInFlight, 0)
+	l.mu.Unlock()
+	return l
+}
+
+// acquire blocks until the call fits in every budget or ctx is done. The
+// returned release must be called with the tokens actually used (0 keeps
+// the estimate).
+func (l *channelLimiter) acquire(ctx context.Context, estimatedTokens int) (func(actualTokens int), error) {
+	startedAt := time.Now()
+	l.mu.Lock()
+	l.waiting++
+	for {
+		now := time.Now()
+		l.pruneLocked(now)
+		retryIn, ok := l.admitLocked(now, estimatedTokens)
+		if ok {
+			break
+		}
+
+		wake := l.wake
+		l.mu.Unlock()
+		if err := waitForCapacity(ctx, wake, retryIn); err != nil {
+			l.mu.Lock()
+			l.waiting--
+			l.mu.Unlock()
+			return nil, err
+		}
+		l.mu.Lock()
+	}
+
+	now := time.Now()
+	l.waiting--
+	l.inFlight++
+	l.requests = append(l.requests, now)
+	reserved := &tokenEvent{at: now, tokens: estimatedTokens}
+	l.tokens = append(l.tokens, reserved)
+	l.recordWaitLocked(now.Sub(startedAt))
+	l.mu.Unlock()
+
+	var once sync.Once
+	return func(actualTokens int) {
+		once.Do(func() {
+			l.mu.Lock()
+			l.inFlight--
+			if actualTokens > 0 {
+				reserved.tokens = actualTokens
+			}
+			close(l.wake)
+			l.wake = make(chan struct{})
+			l.mu.Unlock()
+		})
+	}, nil
+}
+
+func waitForCapacity(ctx context.Context, wake <-chan struct{}, retryIn time.Duration) error {
+	var timeout <-chan time.Time
+	if retryIn > 0 {
+		timer := time.NewTimer(retryIn)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-wake:
+	case <-timeout:
+	}
+	return nil
+}
+
+// admitLocked reports whether a call can start now; otherwise it returns how
+// long until the sliding window frees capacity (0 means wait for a release).
+func (l *channelLimiter) admitLocked(now time.Time, estimatedTokens int) (time.Duration, bool) {
+	if l.maxInFlight > 0 && l.inFlight >= l.maxInFlight {
+		return 0, false
+	}
+	if l.rpm > 0 && len(l.requests) >= l.rpm {
+		return l.requests[0].Add(limiterWindow).Sub(now), false
+	}
+	if l.tpm > 0 && len(l.tokens) > 0 {
+		used := 0
+		for _, ev := range l.tokens {
+			used += ev.tokens
+		}
+		// A single call larger than the whole budget still runs once the
+		// window is empty, otherwise it would wait forever.
+		if used+estimatedTokens > l.tpm {
+			return l.tokens[0].at.Add(limiterWindow).Sub(now), false
+		}
+	}
+	return 0, true
+}
+
+func (l *channelLimiter) pruneLocked(now time.Time) {
+	cutoff := now.Add(-limiterWindow)
+	i := 0
+	for i < len(l.requests) && !l.requests[i].After(cutoff) {
+		i++
+	}
+	l.requests = l.requests[i:]
+
+	j := 0
+	for j < len(l.tokens) && !l.tokens[j].at.After(cutoff) {
+		j++
+	}
+	l.tokens = l.tokens[j:]
+}
+
+func (l *channelLimiter) recordWaitLocked(d time.Duration) {
+	l.waitSamples = append(l.waitSamples, d)
+	if len(l.waitSamples) > limiterWaitSamples {
+		l.waitSamples = l.waitSamples[len(l.waitSamples)-limiterWaitSamples:]
+	}
+}
+
+// GetChannelLimiterStats reports the current queue of a channel and the wait
+// time of its recent calls.
+func (s *Service) GetChannelLimiterStats(channelID int64) models.ChannelLimiterStats {
+	stats := models.ChannelLimiterStats{ChannelID: channelID}
+
+	s.limitersMu.Lock()
+	l, ok := s.limiters[channelID]
+	s.limitersMu.Unlock()
+	if !ok {
+		return stats
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.pruneLocked(time.Now())
+	stats.QueueDepth = l.waiting
+	stats.InFlight = l.inFlight
+	stats.RequestsLastMinute = len(l.requests)
+	for _, ev := range l.tokens {
+		stats.TokensLastMinute += ev.tokens
+	}
+	var total time.Duration
+	for _, d := range l.waitSamples {
+		total += d
+		if d.Milliseconds() > stats.MaxWaitMs {
+			stats.MaxWaitMs = d.Milliseconds()
+		}
+	}
+	if len(l.waitSamples) > 0 {
+		stats.AvgWaitMs = total.Milliseconds() / int64(len(l.waitSamples))
+	}
+	return stats
+}
+
+// estimateRequestTokens is a rough upper bound used to reserve TPM budget
+// before the provider reports real usage.
+func estimateRequestTokens(system, user string, maxTokens int) int {
+	return EstimateTokens(system) + EstimateTokens(user) + maxTokens
+}
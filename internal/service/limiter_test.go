@@ -0,0 +1,153 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func newTestLimiter(rpm, tpm, maxInFlight int) *channelLimiter {
+	return &channelLimiter{rpm: rpm, tpm: tpm, maxInFlight: maxInFlight, wake: make(chan struct{})}
+}
+
+// tryAcquire acquires within a short deadline and reports whether the call
+// was admitted.
+func tryAcquire(t *testing.T, l *channelLimiter, tokens int) (func(int), bool) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	release, err := l.acquire(ctx, tokens)
+	if err != nil {
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("acquire: %v", err)
+		}
+		return nil, false
+	}
+	return release, true
+}
+
+// expire moves every recorded call out of the sliding window.
+func expire(l *channelLimiter) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	past := time.Now().Add(-limiterWindow - time.Second)
+	for i := range l.requests {
+		l.requests[i] = past
+	}
+	for _, ev := range l.tokens {
+		ev.at = past
+	}
+}
+
+func TestChannelLimiterInFlight(t *testing.T) {
+	l := newTestLimiter(0, 0, 1)
+	release, ok := tryAcquire(t, l, 10)
+	if !ok {
+		t.Fatal("first call not admitted")
+	}
+	if _, ok := tryAcquire(t, l, 10); ok {
+		t.Fatal("second call admitted while the first is in flight")
+	}
+
+	admitted := make(chan error, 1)
+	go func() {
+		release, err := l.acquire(context.Background(), 10)
+		if err == nil {
+			release(0)
+		}
+		admitted <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	release(0)
+	select {
+	case err := <-admitted:
+		if err != nil {
+			t.Fatalf("waiter: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("waiter not woken by release")
+	}
+}
+
+func TestChannelLimiterRPM(t *testing.T) {
+	l := newTestLimiter(2, 0, 0)
+	for i := 0; i < 2; i++ {
+		release, ok := tryAcquire(t, l, 10)
+		if !ok {
+			t.Fatalf("call %d not admitted", i+1)
+		}
+		release(0)
+	}
+	if _, ok := tryAcquire(t, l, 10); ok {
+		t.Fatal("third call admitted within the minute")
+	}
+	expire(l)
+	if _, ok := tryAcquire(t, l, 10); !ok {
+		t.Fatal("call not admitted after the window passed")
+	}
+}
+
+func TestChannelLimiterTPM(t *testing.T) {
+	l := newTestLimiter(0, 1000, 0)
+	release, ok := tryAcquire(t, l, 600)
+	if !ok {
+		t.Fatal("first call not admitted")
+	}
+	if _, ok := tryAcquire(t, l, 500); ok {
+		t.Fatal("call admitted over the token budget")
+	}
+	// The actual usage replaces the estimate.
+	release(300)
+	release2, ok := tryAcquire(t, l, 500)
+	if !ok {
+		t.Fatal("call not admitted after the reservation shrank")
+	}
+	release2(0)
+
+	// A call larger than the whole budget waits for an empty window, then runs.
+	if _, ok := tryAcquire(t, l, 5000); ok {
+		t.Fatal("oversized call admitted while the window holds tokens")
+	}
+	expire(l)
+	release3, ok := tryAcquire(t, l, 5000)
+	if !ok {
+		t.Fatal("oversized call not admitted with an empty window")
+	}
+	release3(0)
+	if _, ok := tryAcquire(t, l, 10); ok {
+		t.Fatal("call admitted after an oversized call filled the window")
+	}
+}
+
+func TestChannelLimiterWaiterCanceled(t *testing.T) {
+	l := newTestLimiter(0, 0, 1)
+	release, ok := tryAcquire(t, l, 10)
+	if !ok {
+		t.Fatal("first call not admitted")
+	}
+	defer release(0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		_, err := l.acquire(ctx, 10)
+		done <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("err = %v, want context.Canceled", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("waiter not released by cancel")
+	}
+	l.mu.Lock()
+	waiting, inFlight := l.waiting, l.inFlight
+	l.mu.Unlock()
+	if waiting != 0 || inFlight != 1 {
+		t.Errorf("waiting = %d, in flight = %d", waiting, inFlight)
+	}
+}
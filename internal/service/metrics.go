@@ -4,16 +4,16 @@ import (
 	"database/sql"
 	"fmt"
 
-	"stock-report-analysis/internal/db"
 	"stock-report-analysis/internal/models"
 )
 
-func RecordAnalysisRun(run models.AnalysisRun) error {
-	_, err := db.DB.Exec(`
+func (s *Service) RecordAnalysisRun(run models.AnalysisRun) error {
+	_, err := s.db.Exec(`
 		INSERT INTO analysis_runs(
-			article_id, channel_id, channel_name, prompt_id, prompt_name, mode,
-			success, error_reason, duration_ms, prompt_tokens, completion_tokens, total_tokens
-		) VALUES(?,?,?,?,?,?,?,?,?,?,?,?)
+			article_id, channel_id, channel_name, prompt_id, prompt_name, mode, attempt,
+			success, error_reason, duration_ms, prompt_tokens, completion_tokens, total_tokens,
+			generation_options, cache_hit, cost, currency
+		) VALUES(?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)
 	`,
 		run.ArticleID,
 		run.ChannelID,
@@ -21,21 +21,26 @@ func RecordAnalysisRun(run models.AnalysisRun) error {
 		run.PromptID,
 		run.PromptName,
 		run.Mode,
+		max(run.Attempt, 1),
 		run.Success,
 		run.ErrorReason,
 		run.DurationMs,
 		run.PromptTokens,
 		run.CompletionTokens,
 		run.TotalTokens,
+		run.GenerationOptions,
+		run.CacheHit,
+		run.Cost,
+		run.Currency,
 	)
 	return err
 }
 
-func GetAnalysisDashboard() (models.AnalysisDashboard, error) {
-	return GetAnalysisDashboardByDays(0)
+func (s *Service) GetAnalysisDashboard() (models.AnalysisDashboard, error) {
+	return s.GetAnalysisDashboardByDays(0)
 }
 
-func GetAnalysisDashboardByDays(days int) (models.AnalysisDashboard, error) {
+func (s *Service) GetAnalysisDashboardByDays(days int) (models.AnalysisDashboard, error) {
 	dashboard := models.AnalysisDashboard{}
 	if days < 0 {
 		days = 0
@@ -50,8 +55,9 @@ func GetAnalysisDashboardByDays(days int) (models.AnalysisDashboard, error) {
 		TotalTokens   sql.NullInt64 `db:"total_tokens"`
 		PromptTokens  sql.NullInt64 `db:"prompt_tokens"`
 		OutputTokens  sql.NullInt64 `db:"output_tokens"`
+		CacheHits     sql.NullInt64 `db:"cache_hits"`
 	}{}
-	if err := db.DB.Get(&totals, fmt.Sprintf(`
+	if err := s.db.Get(&totals, fmt.Sprintf(`
 		SELECT
 			COUNT(*) AS total_runs,
 			SUM(CASE WHEN success = 1 THEN 1 ELSE 0 END) AS success_runs,
@@ -59,7 +65,8 @@ func GetAnalysisDashboardByDays(days int) (models.AnalysisDashboard, error) {
 			AVG(duration_ms) AS avg_duration_ms,
 			SUM(total_tokens) AS total_tokens,
 			SUM(prompt_tokens) AS prompt_tokens,
-			SUM(completion_tokens) AS output_tokens
+			SUM(completion_tokens) AS output_tokens,
+			SUM(cache_hit) AS cache_hits
 		FROM analysis_runs
 		%s
 	`, clause), args...); err != nil {
@@ -73,7 +80,9 @@ func GetAnalysisDashboardByDays(days int) (models.AnalysisDashboard, error) {
 	dashboard.TotalTokens = totals.TotalTokens.Int64
 	dashboard.PromptTokens = totals.PromptTokens.Int64
 	dashboard.OutputTokens = totals.OutputTokens.Int64
+	dashboard.CacheHits = int(totals.CacheHits.Int64)
 	dashboard.SuccessRate = percentage(dashboard.SuccessRuns, dashboard.TotalRuns)
+	dashboard.CacheHitRate = percentage(dashboard.CacheHits, dashboard.SuccessRuns)
 
 	channelRows := []struct {
 		ChannelID    int64         `db:"channel_id"`
@@ -85,8 +94,9 @@ func GetAnalysisDashboardByDays(days int) (models.AnalysisDashboard, error) {
 		TotalTokens  sql.NullInt64 `db:"total_tokens"`
 		PromptTokens sql.NullInt64 `db:"prompt_tokens"`
 		OutputTokens sql.NullInt64 `db:"output_tokens"`
+		CacheHits    sql.NullInt64 `db:"cache_hits"`
 	}{}
-	if err := db.DB.Select(&channelRows, fmt.Sprintf(`
+	if err := s.db.Select(&channelRows, fmt.Sprintf(`
 		SELECT
 			channel_id,
 			channel_name,
@@ -96,7 +106,8 @@ func GetAnalysisDashboardByDays(days int) (models.AnalysisDashboard, error) {
 			AVG(duration_ms) AS avg_duration,
 			SUM(total_tokens) AS total_tokens,
 			SUM(prompt_tokens) AS prompt_tokens,
-			SUM(completion_tokens) AS output_tokens
+			SUM(completion_tokens) AS output_tokens,
+			SUM(cache_hit) AS cache_hits
 		FROM analysis_runs
 		%s
 		GROUP BY channel_id, channel_name
@@ -120,6 +131,7 @@ func GetAnalysisDashboardByDays(days int) (models.AnalysisDashboard, error) {
 			TotalTokens:  row.TotalTokens.Int64,
 			PromptTokens: row.PromptTokens.Int64,
 			OutputTokens: row.OutputTokens.Int64,
+			CacheHits:    int(row.CacheHits.Int64),
 		})
 	}
 
@@ -128,7 +140,7 @@ func GetAnalysisDashboardByDays(days int) (models.AnalysisDashboard, error) {
 		Count  int64  `db:"count"`
 	}{}
 	reasonClause, reasonArgs := buildFailureFilter(days)
-	if err := db.DB.Select(&reasonRows, fmt.Sprintf(`
+	if err := s.db.Select(&reasonRows, fmt.Sprintf(`
 		SELECT error_reason AS reason, COUNT(*) AS count
 		FROM analysis_runs
 		%s
@@ -147,6 +159,20 @@ func GetAnalysisDashboardByDays(days int) (models.AnalysisDashboard, error) {
 		})
 	}
 
+	var err error
+	if dashboard.Costs, err = s.costBreakdown("analysis_runs", "", days); err != nil {
+		return dashboard, err
+	}
+	if dashboard.CostByDay, err = s.costBreakdown("analysis_runs", costByDay, days); err != nil {
+		return dashboard, err
+	}
+	if dashboard.CostByChannel, err = s.costBreakdown("analysis_runs", costByChannel, days); err != nil {
+		return dashboard, err
+	}
+	if dashboard.CostByPrompt, err = s.costBreakdown("analysis_runs", costByPrompt, days); err != nil {
+		return dashboard, err
+	}
+
 	return dashboard, nil
 }
 
@@ -15,7 +15,6 @@ import (
 	"strings"
 	"time"
 
-	"stock-report-analysis/internal/db"
 	"stock-report-analysis/internal/models"
 )
 
@@ -23,21 +22,24 @@ const mineruConfigKey = "mineru_config"
 
 func defaultMinerUConfig() models.MinerUConfig {
 	return models.MinerUConfig{
-		Enabled:        1,
-		BaseURL:        "https://mineru.net",
-		APIToken:       "",
-		ModelVersion:   "vlm",
-		IsOCR:          1,
-		PollIntervalMs: 2000,
-		TimeoutSec:     300,
+		Enabled:           1,
+		BaseURL:           "https://mineru.net",
+		APIToken:          "",
+		ModelVersion:      "vlm",
+		IsOCR:             1,
+		PollIntervalMs:    2000,
+		TimeoutSec:        300,
+		Parsers:           defaultParserOrder(),
+		SelfHostedAPI:     selfHostedAPIMinerU,
+		SelfHostedBackend: "pipeline",
 	}
 }
 
-func GetMinerUConfig() (models.MinerUConfig, error) {
+func (s *Service) GetMinerUConfig() (models.MinerUConfig, error) {
 	cfg := defaultMinerUConfig()
 
 	var raw string
-	err := db.DB.Get(&raw, "SELECT value FROM app_configs WHERE key=?", mineruConfigKey)
+	err := s.db.Get(&raw, "SELECT value FROM app_configs WHERE key=?", mineruConfigKey)
 	if err != nil && !errors.Is(err, sql.ErrNoRows) {
 		return cfg, err
 	}
@@ -60,14 +62,14 @@ func GetMinerUConfig() (models.MinerUConfig, error) {
 	return cfg, nil
 }
 
-func SaveMinerUConfig(cfg models.MinerUConfig) error {
+func (s *Service) SaveMinerUConfig(cfg models.MinerUConfig) error {
 	normalizeMinerUConfig(&cfg)
 	payload, err := json.Marshal(cfg)
 	if err != nil {
 		return err
 	}
 
-	_, err = db.DB.Exec(`
+	_, err = s.db.Exec(`
 		INSERT INTO app_configs(key, value, updated_at)
 		VALUES(?, ?, CURRENT_TIMESTAMP)
 		ON CONFLICT(key) DO UPDATE SET value=excluded.value, updated_at=CURRENT_TIMESTAMP
@@ -101,6 +103,30 @@ func normalizeMinerUConfig(cfg *models.MinerUConfig) {
 	if cfg.TimeoutSec < 30 {
 		cfg.TimeoutSec = 30
 	}
+
+	parsers := make([]string, 0, len(cfg.Parsers))
+	seen := map[string]bool{}
+	for _, name := range cfg.Parsers {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if isKnownParser(name) && !seen[name] {
+			seen[name] = true
+			parsers = append(parsers, name)
+		}
+	}
+	if len(parsers) == 0 {
+		parsers = defaultParserOrder()
+	}
+	cfg.Parsers = parsers
+	cfg.SelfHostedURL = strings.TrimRight(strings.TrimSpace(cfg.SelfHostedURL), "/")
+	if strings.EqualFold(strings.TrimSpace(cfg.SelfHostedAPI), selfHostedAPIMagicPDF) {
+		cfg.SelfHostedAPI = selfHostedAPIMagicPDF
+	} else {
+		cfg.SelfHostedAPI = selfHostedAPIMinerU
+	}
+	cfg.SelfHostedBackend = strings.TrimSpace(cfg.SelfHostedBackend)
+	if cfg.SelfHostedBackend == "" {
+		cfg.SelfHostedBackend = "pipeline"
+	}
 }
 
 type mineruEnvelope struct {
@@ -126,21 +152,29 @@ type mineruBatchResultResp struct {
 	ExtractResult []mineruExtractResultItem `json:"extract_result"`
 }
 
-func ParseFileWithMinerU(filePath string) (string, error) {
-	cfg, err := GetMinerUConfig()
+// mineruCloudParser parses with the mineru.net batch API: it uploads the
+// file, polls until the parse is done and downloads the result zip.
+type mineruCloudParser struct {
+	cfg models.MinerUConfig
+}
+
+func (mineruCloudParser) supports(ext string) bool {
+	return isMinerUSupportedFile(ext)
+}
+
+func (p mineruCloudParser) parse(filePath string) (parsedDocument, []byte, error) {
+	data, err := fetchMinerUResult(p.cfg, filePath)
 	if err != nil {
-		return "", err
-	}
-	if cfg.Enabled != 1 {
-		return "", errors.New("MinerU 解析未启用，请在设置中启用")
-	}
-	if strings.TrimSpace(cfg.APIToken) == "" {
-		return "", errors.New("缺少 MinerU API Token，请在设置中配置")
+		return parsedDocument{}, nil, err
 	}
+	doc, err := readMinerUResult(data)
+	return doc, data, err
+}
 
+func fetchMinerUResult(cfg models.MinerUConfig, filePath string) ([]byte, error) {
 	fileData, err := os.ReadFile(filePath)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	fileName := filepath.Base(filePath)
 	if strings.TrimSpace(fileName) == "" {
@@ -149,29 +183,20 @@ func ParseFileWithMinerU(filePath string) (string, error) {
 
 	batchID, uploadURL, err := createMinerUBatch(cfg, fileName)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	if err := uploadMinerUFile(uploadURL, fileData); err != nil {
-		return "", err
+		return nil, err
 	}
 
 	zipURL, err := waitMinerUResult(cfg, batchID)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	if strings.TrimSpace(zipURL) == "" {
-		return "", errors.New("MinerU 返回成功但缺少结果下载地址")
+		return nil, errors.New("MinerU 返回成功但缺少结果下载地址")
 	}
-
-	markdown, err := downloadAndExtractMarkdown(zipURL)
-	if err != nil {
-		return "", err
-	}
-	markdown = strings.TrimSpace(markdown)
-	if markdown == "" {
-		return "", errors.New("MinerU 解析结果为空")
-	}
-	return markdown, nil
+	return downloadMinerUResult(zipURL)
 }
 
 func createMinerUBatch(cfg models.MinerUConfig, fileName string) (string, string, error) {
@@ -319,26 +344,50 @@ type zipCandidate struct {
 	Size uint64
 }
 
-func downloadAndExtractMarkdown(zipURL string) (string, error) {
+func downloadMinerUResult(zipURL string) ([]byte, error) {
 	resp, err := http.Get(zipURL)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	defer resp.Body.Close()
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return "", fmt.Errorf("下载 MinerU 结果失败: HTTP %d, %s", resp.StatusCode, string(body))
+		return nil, fmt.Errorf("下载 MinerU 结果失败: HTTP %d, %s", resp.StatusCode, string(body))
 	}
+	return body, nil
+}
 
-	reader, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+// readMinerUResult reads the markdown, images, tables and page layout out
+// of a MinerU result zip.
+func readMinerUResult(data []byte) (parsedDocument, error) {
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
 	if err != nil {
-		return "", err
+		return parsedDocument{}, err
 	}
+	markdown, err := extractMinerUMarkdown(reader)
+	if err != nil {
+		return parsedDocument{}, err
+	}
+	markdown = strings.TrimSpace(markdown)
+	if markdown == "" {
+		return parsedDocument{}, errors.New("MinerU 解析结果为空")
+	}
+	items, base, err := readMinerUContentList(reader)
+	if err != nil {
+		return parsedDocument{}, err
+	}
+	return parsedDocument{
+		Markdown: markdown,
+		Assets:   extractMinerUAssets(reader, items, base),
+		Blocks:   mineruLayoutBlocks(items),
+	}, nil
+}
 
+func extractMinerUMarkdown(reader *zip.Reader) (string, error) {
 	candidates := make([]zipCandidate, 0)
 	for _, f := range reader.File {
 		if f.FileInfo().IsDir() {
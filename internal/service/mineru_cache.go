@@ -0,0 +1,269 @@
+package service
+
+import (
+	"archive/zip"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"stock-report-analysis/internal/models"
+)
+
+// mineruCacheDirName is the folder under the data directory that keeps
+// MinerU result zips, one <file hash>.zip per parsed document.
+const mineruCacheDirName = "mineru-cache"
+
+// ArticleAssetURLPrefix is where the app serves article images, followed by
+// the file hash and the path inside the cached result.
+const ArticleAssetURLPrefix = "/article-assets/"
+
+const (
+	assetKindImage = "image"
+	assetKindTable = "table"
+)
+
+var mineruImageExts = map[string]string{
+	".jpg": "image/jpeg", ".jpeg": "image/jpeg", ".png": "image/png",
+	".gif": "image/gif", ".webp": "image/webp", ".bmp": "image/bmp",
+}
+
+// mineruCachePath is the cache file for fileHash, or "" when the service
+// has no data directory or the hash is not a SHA-256 hex digest.
+func (s *Service) mineruCachePath(fileHash string) string {
+	if s.dataDir == "" || !isHexHash(fileHash) {
+		return ""
+	}
+	return filepath.Join(s.dataDir, mineruCacheDirName, fileHash+".zip")
+}
+
+func isHexHash(v string) bool {
+	_, err := hex.DecodeString(v)
+	return err == nil && len(v) == 64
+}
+
+// cachedMinerUResult returns the cached result zip for fileHash, or nil.
+func (s *Service) cachedMinerUResult(fileHash string) []byte {
+	cachePath := s.mineruCachePath(fileHash)
+	if cachePath == "" {
+		return nil
+	}
+	data, err := os.ReadFile(cachePath)
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+func (s *Service) cacheMinerUResult(fileHash string, data []byte) error {
+	cachePath := s.mineruCachePath(fileHash)
+	if cachePath == "" {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(cachePath), 0o755); err != nil {
+		return err
+	}
+	// Written aside and renamed so a crash never leaves a truncated zip.
+	tmp, err := os.CreateTemp(filepath.Dir(cachePath), fileHash+"-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), cachePath)
+}
+
+// mineruContentItem is one block of MinerU's *_content_list.json. Older
+// results name the image caption img_caption. TextLevel is set on headings.
+type mineruContentItem struct {
+	Type         string   `json:"type"`
+	Text         string   `json:"text"`
+	TextLevel    int      `json:"text_level"`
+	ListItems    []string `json:"list_items"`
+	ImgPath      string   `json:"img_path"`
+	ImgCaption   []string `json:"img_caption"`
+	ImageCaption []string `json:"image_caption"`
+	TableCaption []string `json:"table_caption"`
+	TableBody    string   `json:"table_body"`
+	PageIdx      int      `json:"page_idx"`
+}
+
+// readMinerUContentList returns the blocks of a MinerU result's content
+// list and the folder it sits in, which its img_path values are relative
+// to. Results without a content list return no blocks.
+func readMinerUContentList(reader *zip.Reader) ([]mineruContentItem, string, error) {
+	for _, f := range reader.File {
+		if f.FileInfo().IsDir() || !strings.HasSuffix(strings.ToLower(f.Name), "content_list.json") {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, "", err
+		}
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return nil, "", err
+		}
+		var items []mineruContentItem
+		if err := json.Unmarshal(data, &items); err != nil {
+			return nil, "", err
+		}
+		return items, path.Dir(f.Name), nil
+	}
+	return nil, "", nil
+}
+
+// extractMinerUAssets lists the images and tables of a MinerU result in
+// document order, with captions, table HTML and pages taken from the
+// content list. Images the content list does not mention come last.
+func extractMinerUAssets(reader *zip.Reader, items []mineruContentItem, base string) []models.ArticleAsset {
+	images := map[string]bool{}
+	var imageNames []string
+	for _, f := range reader.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		if _, ok := mineruImageExts[strings.ToLower(path.Ext(f.Name))]; ok {
+			images[f.Name] = true
+			imageNames = append(imageNames, f.Name)
+		}
+	}
+
+	var assets []models.ArticleAsset
+	used := map[string]bool{}
+	for _, item := range items {
+		if item.Type != assetKindImage && item.Type != assetKindTable {
+			continue
+		}
+		asset := models.ArticleAsset{Kind: item.Type, Page: item.PageIdx + 1}
+		if item.ImgPath != "" {
+			if name := path.Join(base, item.ImgPath); images[name] {
+				asset.Path = name
+				used[name] = true
+			}
+		}
+		asset.Caption = mineruItemCaption(item)
+		asset.HTML = strings.TrimSpace(item.TableBody)
+		if asset.Path == "" && asset.HTML == "" {
+			continue
+		}
+		assets = append(assets, asset)
+	}
+
+	sort.Strings(imageNames)
+	for _, name := range imageNames {
+		if !used[name] {
+			assets = append(assets, models.ArticleAsset{Kind: assetKindImage, Path: name})
+		}
+	}
+	return assets
+}
+
+func mineruItemCaption(item mineruContentItem) string {
+	captions := item.TableCaption
+	if item.Type == assetKindImage {
+		captions = append(item.ImageCaption, item.ImgCaption...)
+	}
+	return strings.TrimSpace(strings.Join(captions, " "))
+}
+
+// GetArticleAssets returns the images and tables extracted from the
+// article's source document, in document order.
+func (s *Service) GetArticleAssets(articleID int64) ([]models.ArticleAsset, error) {
+	assets := []models.ArticleAsset{}
+	err := s.db.Select(&assets, "SELECT * FROM article_assets WHERE article_id=? ORDER BY id", articleID)
+	for i := range assets {
+		if assets[i].Path != "" {
+			assets[i].URL = articleAssetURL(assets[i].FileHash, assets[i].Path)
+		}
+	}
+	return assets, err
+}
+
+func articleAssetURL(fileHash, name string) string {
+	parts := strings.Split(name, "/")
+	for i, p := range parts {
+		parts[i] = url.PathEscape(p)
+	}
+	return ArticleAssetURLPrefix + fileHash + "/" + strings.Join(parts, "/")
+}
+
+// ReadArticleAsset returns an image from the cached MinerU result of
+// fileHash and its content type. Only images are served.
+func (s *Service) ReadArticleAsset(fileHash, name string) ([]byte, string, error) {
+	contentType, ok := mineruImageExts[strings.ToLower(path.Ext(name))]
+	cachePath := s.mineruCachePath(fileHash)
+	if !ok || cachePath == "" {
+		return nil, "", fs.ErrNotExist
+	}
+	reader, err := zip.OpenReader(cachePath)
+	if err != nil {
+		return nil, "", err
+	}
+	defer reader.Close()
+	for _, f := range reader.File {
+		if f.Name != name {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, "", err
+		}
+		defer rc.Close()
+		data, err := io.ReadAll(rc)
+		return data, contentType, err
+	}
+	return nil, "", fs.ErrNotExist
+}
+
+// ClearMinerUCache removes cached results whose file no article comes from
+// any more and returns how many were removed. Results still used stay, so
+// their images keep showing.
+func (s *Service) ClearMinerUCache() (int64, error) {
+	if s.dataDir == "" {
+		return 0, nil
+	}
+	entries, err := os.ReadDir(filepath.Join(s.dataDir, mineruCacheDirName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	var hashes []string
+	if err := s.db.Select(&hashes, `
+		SELECT file_hash FROM articles WHERE file_hash<>''
+		UNION SELECT file_hash FROM article_assets`); err != nil {
+		return 0, err
+	}
+	inUse := map[string]bool{}
+	for _, h := range hashes {
+		inUse[h] = true
+	}
+	var removed int64
+	for _, e := range entries {
+		hash := strings.TrimSuffix(e.Name(), ".zip")
+		if e.IsDir() || inUse[hash] {
+			continue
+		}
+		if err := os.Remove(filepath.Join(s.dataDir, mineruCacheDirName, e.Name())); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
@@ -0,0 +1,125 @@
+package service
+
+import (
+	"archive/zip"
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// mineruResultZip builds a result zip laid out the way MinerU returns it.
+func mineruResultZip(t *testing.T) []byte {
+	t.Helper()
+	files := []struct{ name, body string }{
+		{"full.md", "# 宁德时代深度报告\n\n![](images/fig1.jpg)\n\n储能业务收入同比增长 60%。"},
+		{"demo_content_list.json", `[
+			{"type": "text", "text": "宁德时代深度报告", "page_idx": 0},
+			{"type": "image", "img_path": "images/fig1.jpg", "image_caption": ["图1：", "储能出货量"], "page_idx": 2},
+			{"type": "table", "img_path": "images/tab1.jpg", "table_caption": ["表1：盈利预测"], "table_body": "<table><tr><td>2026E</td></tr></table>", "page_idx": 11}
+		]`},
+		{"images/fig1.jpg", "jpeg-bytes-1"},
+		{"images/tab1.jpg", "jpeg-bytes-2"},
+		{"images/logo.png", "png-bytes"},
+		{"layout.json", "{}"},
+	}
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for _, f := range files {
+		fw, err := w.Create(f.name)
+		if err != nil {
+			t.Fatalf("zip %s: %v", f.name, err)
+		}
+		fw.Write([]byte(f.body))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("close zip: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestReadMinerUResultKeepsAssets(t *testing.T) {
+	doc, err := readMinerUResult(mineruResultZip(t))
+	if err != nil {
+		t.Fatalf("read result: %v", err)
+	}
+	if doc.Markdown == "" || doc.Markdown[0] != '#' {
+		t.Fatalf("markdown = %q", doc.Markdown)
+	}
+	if len(doc.Assets) != 3 {
+		t.Fatalf("assets = %+v, want figure, table and leftover logo", doc.Assets)
+	}
+	fig, table, logo := doc.Assets[0], doc.Assets[1], doc.Assets[2]
+	if fig.Kind != assetKindImage || fig.Path != "images/fig1.jpg" || fig.Caption != "图1： 储能出货量" || fig.Page != 3 {
+		t.Fatalf("figure = %+v", fig)
+	}
+	if table.Kind != assetKindTable || table.Path != "images/tab1.jpg" || table.Caption != "表1：盈利预测" ||
+		table.HTML != "<table><tr><td>2026E</td></tr></table>" || table.Page != 12 {
+		t.Fatalf("table = %+v", table)
+	}
+	if logo.Kind != assetKindImage || logo.Path != "images/logo.png" || logo.Page != 0 {
+		t.Fatalf("leftover image = %+v", logo)
+	}
+}
+
+func TestImportReusesCachedMinerUResult(t *testing.T) {
+	svc := newTestService(t)
+	svc.dataDir = t.TempDir()
+	// MinerU stays disabled: an import only succeeds from the cache.
+	cfg := defaultMinerUConfig()
+	cfg.Enabled = 0
+	if err := svc.SaveMinerUConfig(cfg); err != nil {
+		t.Fatalf("save mineru config: %v", err)
+	}
+
+	pdf := writeImportFile(t, t.TempDir(), "宁德时代深度报告.pdf", "%PDF-1.7 fake")
+	if _, err := svc.ImportFile(pdf, false); err == nil {
+		t.Fatal("import without cache or MinerU succeeded")
+	}
+
+	fileHash := hashBytes([]byte("%PDF-1.7 fake"))
+	if err := svc.cacheMinerUResult(fileHash, mineruResultZip(t)); err != nil {
+		t.Fatalf("cache result: %v", err)
+	}
+	result, err := svc.ImportFile(pdf, false)
+	if err != nil {
+		t.Fatalf("import from cache: %v", err)
+	}
+
+	assets, err := svc.GetArticleAssets(result.Article.ID)
+	if err != nil || len(assets) != 3 {
+		t.Fatalf("assets = %+v, %v", assets, err)
+	}
+	wantURL := ArticleAssetURLPrefix + fileHash + "/images/fig1.jpg"
+	if assets[0].URL != wantURL {
+		t.Fatalf("url = %q, want %q", assets[0].URL, wantURL)
+	}
+	data, contentType, err := svc.ReadArticleAsset(fileHash, "images/fig1.jpg")
+	if err != nil || string(data) != "jpeg-bytes-1" || contentType != "image/jpeg" {
+		t.Fatalf("read asset = %q, %q, %v", data, contentType, err)
+	}
+	if _, _, err := svc.ReadArticleAsset(fileHash, "full.md"); err == nil {
+		t.Fatal("served a non-image file")
+	}
+
+	// The result stays while its article exists and goes once it is deleted.
+	stray := hashBytes([]byte("no article"))
+	if err := svc.cacheMinerUResult(stray, mineruResultZip(t)); err != nil {
+		t.Fatalf("cache stray result: %v", err)
+	}
+	if removed, err := svc.ClearMinerUCache(); err != nil || removed != 1 {
+		t.Fatalf("clear = %d, %v, want the stray result only", removed, err)
+	}
+	if err := svc.DeleteArticle(result.Article.ID); err != nil {
+		t.Fatalf("delete article: %v", err)
+	}
+	if assets, _ := svc.GetArticleAssets(result.Article.ID); len(assets) != 0 {
+		t.Fatalf("assets left after delete: %+v", assets)
+	}
+	if removed, err := svc.ClearMinerUCache(); err != nil || removed != 1 {
+		t.Fatalf("clear after delete = %d, %v", removed, err)
+	}
+	if _, err := os.Stat(filepath.Join(svc.dataDir, mineruCacheDirName, fileHash+".zip")); !os.IsNotExist(err) {
+		t.Fatalf("cache file still there: %v", err)
+	}
+}
@@ -0,0 +1,198 @@
+package service
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"stock-report-analysis/internal/models"
+)
+
+// APIs a self-hosted MinerU service may speak, both at POST /file_parse.
+const (
+	// selfHostedAPIMinerU is mineru-api from MinerU 2.x.
+	selfHostedAPIMinerU = "mineru"
+	// selfHostedAPIMagicPDF is the web_api of magic-pdf, MinerU 1.x.
+	selfHostedAPIMagicPDF = "magic-pdf"
+)
+
+// mineruSelfHostedParser parses with a MinerU service on the user's own
+// machine or network. Its reply, a zip or JSON, is turned into the same
+// result zip the cloud API returns.
+type mineruSelfHostedParser struct {
+	cfg models.MinerUConfig
+}
+
+func (mineruSelfHostedParser) supports(ext string) bool {
+	return isMinerUSupportedFile(ext)
+}
+
+func (p mineruSelfHostedParser) parse(filePath string) (parsedDocument, []byte, error) {
+	req, err := p.newRequest(filePath)
+	if err != nil {
+		return parsedDocument{}, nil, err
+	}
+	client := &http.Client{Timeout: time.Duration(p.cfg.TimeoutSec) * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return parsedDocument{}, nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return parsedDocument{}, nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return parsedDocument{}, nil, fmt.Errorf("HTTP %d, %s", resp.StatusCode, string(body))
+	}
+
+	result := body
+	if !bytes.HasPrefix(body, []byte("PK")) {
+		if result, err = selfHostedJSONToZip(body); err != nil {
+			return parsedDocument{}, nil, err
+		}
+	}
+	doc, err := readMinerUResult(result)
+	return doc, result, err
+}
+
+func (p mineruSelfHostedParser) newRequest(filePath string) (*http.Request, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	fileField := "files"
+	fields := map[string]string{
+		"backend":             p.cfg.SelfHostedBackend,
+		"parse_method":        "auto",
+		"lang_list":           "ch",
+		"return_md":           "true",
+		"return_content_list": "true",
+		"return_images":       "true",
+		"response_format_zip": "true",
+	}
+	if p.cfg.SelfHostedAPI == selfHostedAPIMagicPDF {
+		fileField = "file"
+		fields = map[string]string{
+			"parse_method":        "auto",
+			"return_content_list": "true",
+			"return_images":       "true",
+		}
+	}
+	part, err := w.CreateFormFile(fileField, filepath.Base(filePath))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := part.Write(data); err != nil {
+		return nil, err
+	}
+	for key, value := range fields {
+		if err := w.WriteField(key, value); err != nil {
+			return nil, err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, p.cfg.SelfHostedURL+"/file_parse", &body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	return req, nil
+}
+
+// selfHostedResult is one parsed file in a JSON reply. content_list comes
+// as a JSON string from mineru-api and as an array from magic-pdf; images
+// map file names to data URLs.
+type selfHostedResult struct {
+	MDContent   string            `json:"md_content"`
+	ContentList json.RawMessage   `json:"content_list"`
+	Images      map[string]string `json:"images"`
+}
+
+// selfHostedJSONToZip packs a JSON reply into a MinerU result zip: the
+// markdown as full.md, the content list and the images under images/,
+// where the markdown and content list refer to them.
+func selfHostedJSONToZip(body []byte) ([]byte, error) {
+	var reply struct {
+		selfHostedResult
+		Results map[string]selfHostedResult `json:"results"`
+	}
+	if err := json.Unmarshal(body, &reply); err != nil {
+		return nil, fmt.Errorf("无法识别的返回内容: %w", err)
+	}
+	result := reply.selfHostedResult
+	for _, r := range reply.Results {
+		result = r
+		break
+	}
+	if strings.TrimSpace(result.MDContent) == "" {
+		return nil, errors.New("返回结果中没有 markdown 内容")
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	add := func(name string, data []byte) error {
+		f, err := zw.Create(name)
+		if err != nil {
+			return err
+		}
+		_, err = f.Write(data)
+		return err
+	}
+	if err := add("full.md", []byte(result.MDContent)); err != nil {
+		return nil, err
+	}
+	contentList := []byte(result.ContentList)
+	var encoded string
+	if json.Unmarshal(contentList, &encoded) == nil {
+		contentList = []byte(encoded)
+	}
+	if len(bytes.TrimSpace(contentList)) > 0 && string(contentList) != "null" {
+		if err := add("content_list.json", contentList); err != nil {
+			return nil, err
+		}
+	}
+	names := make([]string, 0, len(result.Images))
+	for name := range result.Images {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		data, err := decodeDataURL(result.Images[name])
+		if err != nil {
+			return nil, fmt.Errorf("图片 %s 无法解码: %w", name, err)
+		}
+		if err := add(path.Join("images", path.Base(name)), data); err != nil {
+			return nil, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decodeDataURL decodes a base64 data URL, or plain base64.
+func decodeDataURL(v string) ([]byte, error) {
+	if _, data, ok := strings.Cut(v, ";base64,"); ok {
+		v = data
+	}
+	return base64.StdEncoding.DecodeString(strings.TrimSpace(v))
+}
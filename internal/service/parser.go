@@ -0,0 +1,131 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+
+	"stock-report-analysis/internal/models"
+)
+
+// Document parsers, in the names MinerUConfig.Parsers orders them by.
+const (
+	ParserMinerUCloud      = "mineru_cloud"
+	ParserMinerUSelfHosted = "mineru_self_hosted"
+	ParserBuiltin          = "builtin"
+)
+
+// documentParser converts a document that is not plain text to markdown.
+type documentParser interface {
+	supports(ext string) bool
+	// parse converts filePath. Parsers backed by MinerU also return the
+	// result zip, which is cached under the file hash; others return nil.
+	parse(filePath string) (parsedDocument, []byte, error)
+}
+
+// parsedDocument is a document converted to markdown, with the images and
+// tables extracted from it. Blocks is its layout, when the parser knows
+// pages or headings the markdown does not carry; QA sections are built
+// from it instead of the markdown.
+type parsedDocument struct {
+	Markdown string
+	Assets   []models.ArticleAsset
+	Blocks   []layoutBlock
+}
+
+func defaultParserOrder() []string {
+	return []string{ParserMinerUCloud, ParserBuiltin}
+}
+
+func isKnownParser(name string) bool {
+	switch name {
+	case ParserMinerUCloud, ParserMinerUSelfHosted, ParserBuiltin:
+		return true
+	default:
+		return false
+	}
+}
+
+func parserLabel(name string) string {
+	switch name {
+	case ParserMinerUCloud:
+		return "MinerU 云端"
+	case ParserMinerUSelfHosted:
+		return "自部署 MinerU"
+	default:
+		return "内置解析"
+	}
+}
+
+// documentParserFor returns the parser called name, or an error saying
+// why it cannot be used with cfg.
+func documentParserFor(name string, cfg models.MinerUConfig) (documentParser, error) {
+	switch name {
+	case ParserMinerUCloud:
+		if cfg.Enabled != 1 {
+			return nil, errors.New("未启用")
+		}
+		if cfg.APIToken == "" {
+			return nil, errors.New("缺少 API Token")
+		}
+		return mineruCloudParser{cfg: cfg}, nil
+	case ParserMinerUSelfHosted:
+		if cfg.SelfHostedURL == "" {
+			return nil, errors.New("未配置服务地址")
+		}
+		return mineruSelfHostedParser{cfg: cfg}, nil
+	case ParserBuiltin:
+		return builtinParser{}, nil
+	default:
+		return nil, fmt.Errorf("未知解析器 %s", name)
+	}
+}
+
+// parseDocument converts filePath with the configured parsers in order. A
+// MinerU result cached under fileHash is used first, so parsing the same
+// file again, e.g. after its article was deleted or to force a near
+// duplicate in, spends no MinerU quota.
+func (s *Service) parseDocument(filePath, fileHash string) (parsedDocument, error) {
+	if data := s.cachedMinerUResult(fileHash); data != nil {
+		doc, err := readMinerUResult(data)
+		if err == nil {
+			return doc, nil
+		}
+		log.Printf("[Parser] cached result %s unreadable, parsing again: %s", fileHash, err.Error())
+	}
+
+	cfg, err := s.GetMinerUConfig()
+	if err != nil {
+		return parsedDocument{}, err
+	}
+	ext := strings.ToLower(filepath.Ext(filePath))
+	var failures []string
+	for _, name := range cfg.Parsers {
+		parser, err := documentParserFor(name, cfg)
+		if err != nil {
+			failures = append(failures, parserLabel(name)+": "+err.Error())
+			continue
+		}
+		if !parser.supports(ext) {
+			continue
+		}
+		doc, result, err := parser.parse(filePath)
+		if err != nil {
+			log.Printf("[Parser] %s failed on %s: %s", name, filepath.Base(filePath), err.Error())
+			failures = append(failures, parserLabel(name)+": "+err.Error())
+			continue
+		}
+		if result != nil {
+			if err := s.cacheMinerUResult(fileHash, result); err != nil {
+				log.Printf("[Parser] cache result %s failed: %s", fileHash, err.Error())
+			}
+		}
+		return doc, nil
+	}
+	if len(failures) == 0 {
+		return parsedDocument{}, fmt.Errorf("没有可解析 %s 文件的解析器，请在设置中调整解析顺序", ext)
+	}
+	return parsedDocument{}, errors.New(strings.Join(failures, "；"))
+}
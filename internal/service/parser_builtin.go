@@ -0,0 +1,296 @@
+package service
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// builtinParser extracts text locally, without network or quota: the text
+// layer of PDFs and the paragraphs, headings and tables of DOCX files. It
+// keeps no images, and scanned PDFs, which have no text layer, fail.
+type builtinParser struct{}
+
+func (builtinParser) supports(ext string) bool {
+	return ext == ".pdf" || ext == ".docx"
+}
+
+func (builtinParser) parse(filePath string) (parsedDocument, []byte, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return parsedDocument{}, nil, err
+	}
+	if strings.HasSuffix(strings.ToLower(filePath), ".docx") {
+		text, err := extractDOCXText(data)
+		if err != nil {
+			return parsedDocument{}, nil, err
+		}
+		if strings.TrimSpace(text) == "" {
+			return parsedDocument{}, nil, errors.New("文档中没有文本内容")
+		}
+		return parsedDocument{Markdown: text}, nil, nil
+	}
+	pages, err := extractPDFPages(data)
+	if err != nil {
+		return parsedDocument{}, nil, err
+	}
+	var nonEmpty []string
+	for _, page := range pages {
+		if page != "" {
+			nonEmpty = append(nonEmpty, page)
+		}
+	}
+	if len(nonEmpty) == 0 {
+		return parsedDocument{}, nil, errors.New("PDF 没有可提取的文本层，可能是扫描件，请使用 MinerU 解析")
+	}
+	return parsedDocument{Markdown: strings.Join(nonEmpty, "\n\n"), Blocks: pdfPageBlocks(pages)}, nil, nil
+}
+
+var docxHeadingStyle = regexp.MustCompile(`(?i)^(heading|标题)\s*(\d)$`)
+
+// extractDOCXText converts the body of a DOCX file to markdown: headings
+// by their style's outline level, list paragraphs as items and tables as
+// markdown tables.
+func extractDOCXText(data []byte) (string, error) {
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "", errors.New("不是有效的 DOCX 文件")
+	}
+	var document, styles *zip.File
+	for _, f := range reader.File {
+		switch f.Name {
+		case "word/document.xml":
+			document = f
+		case "word/styles.xml":
+			styles = f
+		}
+	}
+	if document == nil {
+		return "", errors.New("DOCX 中缺少 word/document.xml")
+	}
+	levels := map[string]int{}
+	if styles != nil {
+		if rc, err := styles.Open(); err == nil {
+			levels = docxHeadingLevels(rc)
+			rc.Close()
+		}
+	}
+	rc, err := document.Open()
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+	return docxMarkdown(rc, levels)
+}
+
+// docxHeadingLevels maps paragraph style IDs to heading levels, from the
+// style name ("heading 1") or its outline level.
+func docxHeadingLevels(r io.Reader) map[string]int {
+	levels := map[string]int{}
+	dec := xml.NewDecoder(r)
+	styleID := ""
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return levels
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch start.Name.Local {
+		case "style":
+			styleID = docxAttr(start, "styleId")
+		case "name":
+			name := docxAttr(start, "val")
+			if m := docxHeadingStyle.FindStringSubmatch(name); m != nil && styleID != "" {
+				levels[styleID], _ = strconv.Atoi(m[2])
+			} else if strings.EqualFold(name, "title") && styleID != "" {
+				levels[styleID] = 1
+			}
+		case "outlineLvl":
+			if n, err := strconv.Atoi(docxAttr(start, "val")); err == nil && n < 9 && styleID != "" {
+				if _, ok := levels[styleID]; !ok {
+					levels[styleID] = n + 1
+				}
+			}
+		}
+	}
+}
+
+func docxAttr(start xml.StartElement, local string) string {
+	for _, a := range start.Attr {
+		if a.Name.Local == local {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+type docxParagraph struct {
+	text  strings.Builder
+	level int
+	list  bool
+}
+
+func docxMarkdown(r io.Reader, levels map[string]int) (string, error) {
+	dec := xml.NewDecoder(r)
+	var blocks []string
+	var paragraphs []*docxParagraph
+	var table [][]string // rows of the outermost table being read
+	tableDepth := 0
+	inText := false
+	skipDepth := 0 // inside mc:Fallback, which repeats mc:Choice
+
+	for {
+		tok, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if skipDepth > 0 {
+				skipDepth++
+				continue
+			}
+			switch t.Name.Local {
+			case "Fallback":
+				skipDepth = 1
+			case "p":
+				paragraphs = append(paragraphs, &docxParagraph{})
+			case "pStyle":
+				if len(paragraphs) > 0 {
+					paragraphs[len(paragraphs)-1].level = levels[docxAttr(t, "val")]
+				}
+			case "outlineLvl":
+				if n, err := strconv.Atoi(docxAttr(t, "val")); err == nil && n < 9 && len(paragraphs) > 0 {
+					paragraphs[len(paragraphs)-1].level = n + 1
+				}
+			case "numPr":
+				if len(paragraphs) > 0 {
+					paragraphs[len(paragraphs)-1].list = true
+				}
+			case "t":
+				inText = true
+			case "tab":
+				if len(paragraphs) > 0 {
+					paragraphs[len(paragraphs)-1].text.WriteByte(' ')
+				}
+			case "br", "cr":
+				if len(paragraphs) > 0 {
+					paragraphs[len(paragraphs)-1].text.WriteByte('\n')
+				}
+			case "tbl":
+				tableDepth++
+				if tableDepth == 1 {
+					table = nil
+				}
+			case "tr":
+				if tableDepth == 1 {
+					table = append(table, nil)
+				}
+			case "tc":
+				if tableDepth == 1 && len(table) > 0 {
+					table[len(table)-1] = append(table[len(table)-1], "")
+				}
+			}
+		case xml.EndElement:
+			if skipDepth > 0 {
+				skipDepth--
+				continue
+			}
+			switch t.Name.Local {
+			case "t":
+				inText = false
+			case "p":
+				if len(paragraphs) == 0 {
+					continue
+				}
+				p := paragraphs[len(paragraphs)-1]
+				paragraphs = paragraphs[:len(paragraphs)-1]
+				text := strings.TrimSpace(p.text.String())
+				switch {
+				case text == "":
+				case len(paragraphs) > 0:
+					// A text box inside another paragraph.
+					paragraphs[len(paragraphs)-1].text.WriteString(" " + text)
+				case tableDepth > 0:
+					if row := len(table) - 1; row >= 0 && len(table[row]) > 0 {
+						cell := &table[row][len(table[row])-1]
+						*cell = strings.TrimSpace(*cell + " " + text)
+					}
+				case p.level > 0:
+					blocks = append(blocks, strings.Repeat("#", min(p.level, 6))+" "+strings.ReplaceAll(text, "\n", " "))
+				case p.list:
+					blocks = append(blocks, "- "+text)
+				default:
+					blocks = append(blocks, text)
+				}
+			case "tbl":
+				tableDepth--
+				if tableDepth == 0 {
+					if md := docxTableMarkdown(table); md != "" {
+						blocks = append(blocks, md)
+					}
+				}
+			}
+		case xml.CharData:
+			if inText && skipDepth == 0 && len(paragraphs) > 0 {
+				paragraphs[len(paragraphs)-1].text.Write(t)
+			}
+		}
+	}
+	return joinDOCXBlocks(blocks), nil
+}
+
+// joinDOCXBlocks puts a blank line between blocks, except between items
+// of one list.
+func joinDOCXBlocks(blocks []string) string {
+	var b strings.Builder
+	for i, block := range blocks {
+		if i > 0 {
+			if strings.HasPrefix(block, "- ") && strings.HasPrefix(blocks[i-1], "- ") {
+				b.WriteByte('\n')
+			} else {
+				b.WriteString("\n\n")
+			}
+		}
+		b.WriteString(block)
+	}
+	return b.String()
+}
+
+func docxTableMarkdown(rows [][]string) string {
+	cols := 0
+	for _, row := range rows {
+		cols = max(cols, len(row))
+	}
+	if cols == 0 {
+		return ""
+	}
+	var b strings.Builder
+	for i, row := range rows {
+		b.WriteString("|")
+		for c := 0; c < cols; c++ {
+			cell := ""
+			if c < len(row) {
+				cell = strings.ReplaceAll(strings.ReplaceAll(row[c], "\n", " "), "|", "\\|")
+			}
+			b.WriteString(" " + cell + " |")
+		}
+		b.WriteByte('\n')
+		if i == 0 {
+			b.WriteString("|" + strings.Repeat(" --- |", cols) + "\n")
+		}
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
@@ -0,0 +1,291 @@
+package service
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/zlib"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// buildTestPDF writes a two-page PDF: Chinese text in a composite font
+// with a ToUnicode map, English text in a standard font kept in an object
+// stream, and compressed as well as plain content streams.
+func buildTestPDF(t testing.TB) []byte {
+	t.Helper()
+	flate := func(s string) string {
+		var buf bytes.Buffer
+		w := zlib.NewWriter(&buf)
+		w.Write([]byte(s))
+		w.Close()
+		return buf.String()
+	}
+	stream := func(dict, data string) string {
+		return fmt.Sprintf("<< %s /Length %d >>\nstream\n%s\nendstream", dict, len(data), data)
+	}
+	cmap := `/CIDInit /ProcSet findresource begin 12 dict begin begincmap
+1 begincodespacerange <0000> <FFFF> endcodespacerange
+2 beginbfchar <0001> <5B81> <0002> <5FB7> endbfchar
+2 beginbfrange <0003> <0004> [<65F6> <4EE3>] <0005> <0006> <FF08> endbfrange
+endcmap CMapName currentdict /CMap defineresource pop end end`
+	page1 := `BT /F1 12 Tf 72 700 Td <00010002> Tj 0 -20 Td [<0003> 120 <0004>] TJ <0005> Tj ET
+BT /F2 10 Tf 72 600 Td (Revenue ) Tj [(grew) -300 (fast\051)] TJ ET`
+	page2 := `q 1 0 0 1 0 0 cm BI /W 1 /H 1 /BPC 8 /CS /G ID ` + "\x00\xff" + ` EI Q
+BT /F2 12 Tf 1 0 0 1 72 700 Tm (Page two) Tj 1 0 0 1 72 680 Tm (ends here) Tj ET`
+	objStmHeader := "6 0\n"
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R 4 0 R] /Count 2 /Resources << /Font << /F1 5 0 R /F2 6 0 R >> >> >>",
+		"<< /Type /Page /Parent 2 0 R /Contents 7 0 R >>",
+		"<< /Type /Page /Parent 2 0 R /Contents [8 0 R] >>",
+		"<< /Type /Font /Subtype /Type0 /BaseFont /SimSun /Encoding /Identity-H /ToUnicode 9 0 R >>",
+		"",
+		stream("/Filter /FlateDecode", flate(page1)),
+		stream("", page2),
+		stream("/Filter /FlateDecode", flate(cmap)),
+		stream(fmt.Sprintf("/Type /ObjStm /N 1 /First %d /Filter /FlateDecode", len(objStmHeader)),
+			flate(objStmHeader+"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>")),
+	}
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.7\n%\xe2\xe3\xcf\xd3\n")
+	for i, obj := range objects {
+		if obj == "" {
+			continue
+		}
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	buf.WriteString("trailer\n<< /Size 11 /Root 1 0 R >>\n%%EOF\n")
+	return buf.Bytes()
+}
+
+func TestExtractPDFText(t *testing.T) {
+	text, err := extractPDFText(buildTestPDF(t))
+	if err != nil {
+		t.Fatalf("extract: %v", err)
+	}
+	want := "宁德\n时代（\nRevenue grew fast)\n\nPage two\nends here"
+	if text != want {
+		t.Fatalf("text = %q, want %q", text, want)
+	}
+
+	if _, err := extractPDFText([]byte("not a pdf")); err == nil {
+		t.Fatal("extracted text from a non-PDF")
+	}
+}
+
+func TestDecodeStreamCapsInflatedSize(t *testing.T) {
+	zeros := func(n int) *pdfStream {
+		var buf bytes.Buffer
+		w := zlib.NewWriter(&buf)
+		block := make([]byte, 1<<20)
+		for ; n > 0; n -= len(block) {
+			w.Write(block[:min(n, len(block))])
+		}
+		w.Close()
+		return &pdfStream{dict: pdfDict{"Filter": pdfName("FlateDecode")}, raw: buf.Bytes()}
+	}
+
+	doc := &pdfDocument{}
+	bomb := zeros(maxPDFStreamBytes + 1)
+	if len(bomb.raw) > 128<<10 {
+		t.Fatalf("compressed stream is %d bytes", len(bomb.raw))
+	}
+	if _, err := doc.decodeStream(bomb); err == nil {
+		t.Fatal("decoded a stream over the per-stream limit")
+	}
+	if data, err := doc.decodeStream(zeros(maxPDFStreamBytes)); err != nil || len(data) != maxPDFStreamBytes {
+		t.Fatalf("stream at the limit: %d bytes, err = %v", len(data), err)
+	}
+
+	// Streams that each fit still fail once the document total is spent.
+	doc = &pdfDocument{inflated: maxPDFInflatedBytes - 1<<20}
+	if _, err := doc.decodeStream(zeros(1 << 20)); err != nil {
+		t.Fatalf("last stream within the total: %v", err)
+	}
+	if _, err := doc.decodeStream(zeros(1)); err == nil {
+		t.Fatal("decoded a stream past the document total")
+	}
+}
+
+// FuzzExtractPDFText feeds malformed PDFs to the extractor. It must turn
+// them into errors without leaning on the recover in extractPDFPages.
+func FuzzExtractPDFText(f *testing.F) {
+	f.Add(buildTestPDF(f))
+	f.Add([]byte("%PDF" + strings.Repeat("0", 61) + "0 obj<<" + strings.Repeat("0", 19) + "<"))
+	f.Add([]byte("%PDF-1.4\n1 0 obj\n<< /Length 99 >>\nstream\nBT"))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		if _, err := extractPDFText(data); err != nil && strings.HasPrefix(err.Error(), "PDF 解析失败") {
+			t.Fatalf("extractor panicked: %v", err)
+		}
+	})
+}
+
+func buildTestDOCX(t *testing.T) []byte {
+	t.Helper()
+	const w = `xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main" xmlns:mc="http://schemas.openxmlformats.org/markup-compatibility/2006"`
+	files := map[string]string{
+		"word/styles.xml": `<w:styles ` + w + `>
+			<w:style w:type="paragraph" w:styleId="1"><w:name w:val="heading 1"/></w:style>
+			<w:style w:type="paragraph" w:styleId="Heading2"><w:name w:val="heading 2"/></w:style>
+		</w:styles>`,
+		"word/document.xml": `<w:document ` + w + `><w:body>
+			<w:p><w:pPr><w:pStyle w:val="1"/></w:pPr><w:r><w:t>宁德时代深度报告</w:t></w:r></w:p>
+			<w:p><w:r><w:t xml:space="preserve">储能业务</w:t></w:r><w:r><w:t>同比增长 60%。</w:t></w:r></w:p>
+			<w:p><w:pPr><w:pStyle w:val="Heading2"/></w:pPr><w:r><w:t>风险提示</w:t></w:r></w:p>
+			<w:p><w:pPr><w:numPr><w:ilvl w:val="0"/></w:numPr></w:pPr><w:r><w:t>原材料价格波动</w:t></w:r></w:p>
+			<w:p><w:pPr><w:numPr><w:ilvl w:val="0"/></w:numPr></w:pPr><w:r><w:t>海外需求不及预期</w:t></w:r></w:p>
+			<w:p><w:r><mc:AlternateContent><mc:Choice><w:t>文本框</w:t></mc:Choice><mc:Fallback><w:t>文本框</w:t></mc:Fallback></mc:AlternateContent></w:r></w:p>
+			<w:tbl>
+				<w:tr><w:tc><w:p><w:r><w:t>年份</w:t></w:r></w:p></w:tc><w:tc><w:p><w:r><w:t>净利润</w:t></w:r></w:p></w:tc></w:tr>
+				<w:tr><w:tc><w:p><w:r><w:t>2026E</w:t></w:r></w:p></w:tc><w:tc><w:p><w:r><w:t>620</w:t></w:r></w:p><w:p><w:r><w:t>亿元</w:t></w:r></w:p></w:tc></w:tr>
+			</w:tbl>
+		</w:body></w:document>`,
+	}
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, body := range files {
+		f, _ := zw.Create(name)
+		f.Write([]byte(body))
+	}
+	zw.Close()
+	return buf.Bytes()
+}
+
+func TestExtractDOCXText(t *testing.T) {
+	text, err := extractDOCXText(buildTestDOCX(t))
+	if err != nil {
+		t.Fatalf("extract: %v", err)
+	}
+	want := "# 宁德时代深度报告\n\n储能业务同比增长 60%。\n\n## 风险提示\n\n- 原材料价格波动\n- 海外需求不及预期\n\n文本框\n\n" +
+		"| 年份 | 净利润 |\n| --- | --- |\n| 2026E | 620 亿元 |"
+	if text != want {
+		t.Fatalf("text = %q, want %q", text, want)
+	}
+}
+
+func TestNormalizeParserOrder(t *testing.T) {
+	cfg := defaultMinerUConfig()
+	cfg.Parsers = []string{" Builtin ", "unknown", ParserMinerUSelfHosted, ParserBuiltin}
+	cfg.SelfHostedAPI = "MAGIC-PDF"
+	cfg.SelfHostedURL = "http://127.0.0.1:8000/ "
+	normalizeMinerUConfig(&cfg)
+	if want := []string{ParserBuiltin, ParserMinerUSelfHosted}; !reflect.DeepEqual(cfg.Parsers, want) {
+		t.Fatalf("parsers = %v, want %v", cfg.Parsers, want)
+	}
+	if cfg.SelfHostedAPI != selfHostedAPIMagicPDF || cfg.SelfHostedURL != "http://127.0.0.1:8000" {
+		t.Fatalf("self-hosted = %q %q", cfg.SelfHostedAPI, cfg.SelfHostedURL)
+	}
+
+	cfg.Parsers = []string{"unknown"}
+	normalizeMinerUConfig(&cfg)
+	if !reflect.DeepEqual(cfg.Parsers, defaultParserOrder()) {
+		t.Fatalf("parsers = %v, want the default order", cfg.Parsers)
+	}
+}
+
+func TestImportFallsBackToBuiltinParser(t *testing.T) {
+	svc := newTestService(t)
+	// The cloud API is configured but unreachable, as when offline.
+	offline := httptest.NewServer(http.NotFoundHandler())
+	offline.Close()
+	cfg := defaultMinerUConfig()
+	cfg.BaseURL = offline.URL
+	cfg.APIToken = "token"
+	if err := svc.SaveMinerUConfig(cfg); err != nil {
+		t.Fatalf("save config: %v", err)
+	}
+
+	dir := t.TempDir()
+	pdf := filepath.Join(dir, "宁德时代点评.pdf")
+	if err := os.WriteFile(pdf, buildTestPDF(t), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	result, err := svc.ImportFile(pdf, false)
+	if err != nil {
+		t.Fatalf("import pdf: %v", err)
+	}
+	article, _ := svc.GetArticle(result.Article.ID)
+	if !strings.Contains(article.Content, "宁德\n时代") {
+		t.Fatalf("content = %q", article.Content)
+	}
+
+	docx := filepath.Join(dir, "深度报告.docx")
+	if err := os.WriteFile(docx, buildTestDOCX(t), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if result, err = svc.ImportFile(docx, false); err != nil {
+		t.Fatalf("import docx: %v", err)
+	}
+
+	// Formats the built-in parser cannot read report why every parser failed.
+	img := filepath.Join(dir, "scan.png")
+	if err := os.WriteFile(img, []byte("png"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.ImportFile(img, false); err == nil || !strings.Contains(err.Error(), "MinerU 云端") {
+		t.Fatalf("import png error = %v", err)
+	}
+}
+
+func TestSelfHostedMinerUParser(t *testing.T) {
+	image := base64.StdEncoding.EncodeToString([]byte("jpeg-bytes"))
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if r.URL.Path != "/file_parse" {
+			http.NotFound(w, r)
+			return
+		}
+		if _, header, err := r.FormFile("files"); err != nil || header.Filename != "储能报告.pdf" {
+			t.Errorf("file = %v, %v", header, err)
+		}
+		if r.FormValue("backend") != "pipeline" || r.FormValue("return_images") != "true" {
+			t.Errorf("form = %v", r.MultipartForm.Value)
+		}
+		// mineru-api answers JSON when it cannot zip.
+		fmt.Fprintf(w, `{"backend":"pipeline","results":{"储能报告":{
+			"md_content":"# 储能报告\n\n![](images/a.jpg)\n\n储能出货量持续增长。",
+			"content_list":"[{\"type\":\"image\",\"img_path\":\"images/a.jpg\",\"image_caption\":[\"图1\"],\"page_idx\":1}]",
+			"images":{"a.jpg":"data:image/jpeg;base64,%s"}}}}`, image)
+	}))
+	defer srv.Close()
+
+	svc := newTestService(t)
+	svc.dataDir = t.TempDir()
+	cfg := defaultMinerUConfig()
+	cfg.Enabled = 0
+	cfg.Parsers = []string{ParserMinerUSelfHosted, ParserBuiltin}
+	cfg.SelfHostedURL = srv.URL
+	if err := svc.SaveMinerUConfig(cfg); err != nil {
+		t.Fatalf("save config: %v", err)
+	}
+
+	pdf := writeImportFile(t, t.TempDir(), "储能报告.pdf", "%PDF-1.7 scanned")
+	result, err := svc.ImportFile(pdf, false)
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	assets, err := svc.GetArticleAssets(result.Article.ID)
+	if err != nil || len(assets) != 1 || assets[0].Caption != "图1" || assets[0].Page != 2 {
+		t.Fatalf("assets = %+v, %v", assets, err)
+	}
+	data, _, err := svc.ReadArticleAsset(hashBytes([]byte("%PDF-1.7 scanned")), assets[0].Path)
+	if err != nil || string(data) != "jpeg-bytes" {
+		t.Fatalf("asset = %q, %v", data, err)
+	}
+
+	// The converted result is cached like a cloud one.
+	if err := svc.DeleteArticle(result.Article.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.ImportFile(pdf, false); err != nil || calls != 1 {
+		t.Fatalf("re-import = %v after %d calls, want the cached result", err, calls)
+	}
+}
@@ -0,0 +1,1094 @@
+package service
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/ascii85"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+// This file reads the text layer of a PDF without rendering it. Objects
+// are read in file order, so objects redefined by incremental updates take
+// the last definition, and object streams are unpacked. Text comes from
+// the show-text operators of each page in content order, decoded through
+// the font's ToUnicode map or, failing that, its encoding. Scanned PDFs
+// have no text layer and yield no text.
+
+// PDF object values. Numbers are float64, booleans bool and null nil.
+type (
+	pdfName    string
+	pdfKeyword string
+	pdfString  []byte
+	pdfArray   []any
+	pdfDict    map[pdfName]any
+	pdfRef     struct{ num, gen int }
+	pdfStream  struct {
+		dict pdfDict
+		raw  []byte
+	}
+)
+
+// pdfMaxPages bounds the pages walked, against page trees that loop.
+const pdfMaxPages = 5000
+
+// maxPDFStreamBytes caps one inflated stream and maxPDFInflatedBytes all
+// streams of a document, against small files that inflate to gigabytes.
+const (
+	maxPDFStreamBytes   = 32 << 20
+	maxPDFInflatedBytes = 128 << 20
+)
+
+type pdfLexer struct {
+	data []byte
+	pos  int
+}
+
+func isPDFSpace(c byte) bool {
+	switch c {
+	case 0, '\t', '\n', '\f', '\r', ' ':
+		return true
+	}
+	return false
+}
+
+func isPDFDelimiter(c byte) bool {
+	switch c {
+	case '(', ')', '<', '>', '[', ']', '{', '}', '/', '%':
+		return true
+	}
+	return false
+}
+
+func (l *pdfLexer) skipSpace() {
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		if isPDFSpace(c) {
+			l.pos++
+		} else if c == '%' {
+			for l.pos < len(l.data) && l.data[l.pos] != '\n' && l.data[l.pos] != '\r' {
+				l.pos++
+			}
+		} else {
+			return
+		}
+	}
+}
+
+// token reads one token: a number, name, string, keyword or one of the
+// delimiters "[", "]", "<<", ">>" (as keywords). io.EOF ends the input.
+func (l *pdfLexer) token() (any, error) {
+	l.skipSpace()
+	if l.pos >= len(l.data) {
+		return nil, io.EOF
+	}
+	c := l.data[l.pos]
+	switch {
+	case c == '(':
+		return l.literalString(), nil
+	case c == '<':
+		if l.pos+1 < len(l.data) && l.data[l.pos+1] == '<' {
+			l.pos += 2
+			return pdfKeyword("<<"), nil
+		}
+		return l.hexString(), nil
+	case c == '>':
+		l.pos++
+		if l.pos < len(l.data) && l.data[l.pos] == '>' {
+			l.pos++
+		}
+		return pdfKeyword(">>"), nil
+	case c == '[' || c == ']' || c == '{' || c == '}' || c == ')':
+		l.pos++
+		return pdfKeyword(c), nil
+	case c == '/':
+		l.pos++
+		return pdfName(l.regular(true)), nil
+	}
+	word := l.regular(false)
+	if word == "" {
+		l.pos++
+		return pdfKeyword(c), nil
+	}
+	if n, err := strconv.ParseFloat(word, 64); err == nil && (word[0] == '.' || word[0] == '-' || word[0] == '+' || (word[0] >= '0' && word[0] <= '9')) {
+		return n, nil
+	}
+	switch word {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	}
+	return pdfKeyword(word), nil
+}
+
+// regular reads a run of regular characters; in names, #xx escapes a byte.
+func (l *pdfLexer) regular(name bool) string {
+	var b []byte
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		if isPDFSpace(c) || isPDFDelimiter(c) {
+			break
+		}
+		if name && c == '#' && l.pos+2 < len(l.data) {
+			if v, err := hex.DecodeString(string(l.data[l.pos+1 : l.pos+3])); err == nil {
+				b = append(b, v[0])
+				l.pos += 3
+				continue
+			}
+		}
+		b = append(b, c)
+		l.pos++
+	}
+	return string(b)
+}
+
+func (l *pdfLexer) literalString() pdfString {
+	l.pos++ // (
+	var b []byte
+	depth := 1
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		l.pos++
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return b
+			}
+		case '\\':
+			if l.pos >= len(l.data) {
+				return b
+			}
+			e := l.data[l.pos]
+			l.pos++
+			switch e {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r':
+				if l.pos < len(l.data) && l.data[l.pos] == '\n' {
+					l.pos++
+				}
+				continue
+			case '\n':
+				continue
+			default:
+				if e >= '0' && e <= '7' {
+					v := int(e - '0')
+					for i := 0; i < 2 && l.pos < len(l.data) && l.data[l.pos] >= '0' && l.data[l.pos] <= '7'; i++ {
+						v = v*8 + int(l.data[l.pos]-'0')
+						l.pos++
+					}
+					c = byte(v)
+				} else {
+					c = e
+				}
+			}
+		}
+		b = append(b, c)
+	}
+	return b
+}
+
+func (l *pdfLexer) hexString() pdfString {
+	l.pos++ // <
+	var digits []byte
+	for l.pos < len(l.data) && l.data[l.pos] != '>' {
+		if c := l.data[l.pos]; !isPDFSpace(c) {
+			digits = append(digits, c)
+		}
+		l.pos++
+	}
+	if l.pos < len(l.data) {
+		l.pos++ // >
+	}
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+	b, _ := hex.DecodeString(string(digits))
+	return b
+}
+
+// value reads a complete value: arrays and dictionaries with their
+// contents and "num gen R" as a reference. Other keywords come back as
+// pdfKeyword.
+func (l *pdfLexer) value() (any, error) {
+	tok, err := l.token()
+	if err != nil {
+		return nil, err
+	}
+	switch t := tok.(type) {
+	case float64:
+		if t != float64(int(t)) || t < 0 {
+			return t, nil
+		}
+		save := l.pos
+		gen, err1 := l.token()
+		r, err2 := l.token()
+		if g, ok := gen.(float64); ok && err1 == nil && err2 == nil && r == pdfKeyword("R") {
+			return pdfRef{num: int(t), gen: int(g)}, nil
+		}
+		l.pos = save
+		return t, nil
+	case pdfKeyword:
+		switch t {
+		case "[":
+			arr := pdfArray{}
+			for {
+				v, err := l.value()
+				if err != nil {
+					return arr, err
+				}
+				if v == pdfKeyword("]") {
+					return arr, nil
+				}
+				arr = append(arr, v)
+			}
+		case "<<":
+			dict := pdfDict{}
+			for {
+				k, err := l.value()
+				if err != nil {
+					return dict, err
+				}
+				if k == pdfKeyword(">>") {
+					return dict, nil
+				}
+				name, ok := k.(pdfName)
+				if !ok {
+					continue
+				}
+				v, err := l.value()
+				if err != nil {
+					return dict, err
+				}
+				if v == pdfKeyword(">>") {
+					return dict, nil
+				}
+				dict[name] = v
+			}
+		}
+	}
+	return tok, nil
+}
+
+type pdfDocument struct {
+	objects  map[int]any
+	root     pdfRef
+	fonts    map[any]*pdfFont
+	inflated int // bytes inflated so far, against maxPDFInflatedBytes
+}
+
+var pdfObjectHeader = regexp.MustCompile(`(\d+)\s+(\d+)\s+obj\b`)
+
+func readPDF(data []byte) (*pdfDocument, error) {
+	if !bytes.Contains(data[:min(len(data), 1024)], []byte("%PDF")) {
+		return nil, errors.New("不是有效的 PDF 文件")
+	}
+	doc := &pdfDocument{objects: map[int]any{}, fonts: map[any]*pdfFont{}}
+	var objStreams []*pdfStream
+	var trailers []pdfDict
+
+	pos := 0
+	for pos < len(data) {
+		loc := pdfObjectHeader.FindSubmatchIndex(data[pos:])
+		if loc == nil {
+			break
+		}
+		num, _ := strconv.Atoi(string(data[pos+loc[2] : pos+loc[3]]))
+		l := &pdfLexer{data: data, pos: pos + loc[1]}
+		v, err := l.value()
+		if err != nil && !errors.Is(err, io.EOF) {
+			return nil, err
+		}
+		if dict, ok := v.(pdfDict); ok {
+			if stream, end := readPDFStream(data, l.pos, dict); stream != nil {
+				v = stream
+				l.pos = end
+				switch dict["Type"] {
+				case pdfName("ObjStm"):
+					objStreams = append(objStreams, stream)
+				case pdfName("XRef"):
+					trailers = append(trailers, dict)
+				}
+			}
+		}
+		doc.objects[num] = v
+		pos = min(l.pos, len(data))
+	}
+	if idx := bytes.LastIndex(data, []byte("trailer")); idx >= 0 {
+		l := &pdfLexer{data: data, pos: idx + len("trailer")}
+		if v, _ := l.value(); v != nil {
+			if dict, ok := v.(pdfDict); ok {
+				trailers = append(trailers, dict)
+			}
+		}
+	}
+	for _, t := range trailers {
+		if _, ok := t["Encrypt"]; ok {
+			return nil, errors.New("PDF 已加密，无法提取文本")
+		}
+	}
+
+	// Objects stored directly in the file take precedence over copies in
+	// object streams.
+	for _, stream := range objStreams {
+		doc.readObjectStream(stream)
+	}
+
+	for i := len(trailers) - 1; i >= 0; i-- {
+		if ref, ok := trailers[i]["Root"].(pdfRef); ok {
+			doc.root = ref
+			return doc, nil
+		}
+	}
+	for num, v := range doc.objects {
+		if d, ok := v.(pdfDict); ok && d["Type"] == pdfName("Catalog") {
+			doc.root = pdfRef{num: num}
+			return doc, nil
+		}
+	}
+	return nil, errors.New("PDF 缺少页面目录")
+}
+
+// readPDFStream reads the stream following dict at pos, if there is one,
+// and returns it with the position after endstream.
+func readPDFStream(data []byte, pos int, dict pdfDict) (*pdfStream, int) {
+	l := &pdfLexer{data: data, pos: min(max(pos, 0), len(data))}
+	l.skipSpace()
+	if !bytes.HasPrefix(data[l.pos:], []byte("stream")) {
+		return nil, 0
+	}
+	start := l.pos + len("stream")
+	if start < len(data) && data[start] == '\r' {
+		start++
+	}
+	if start < len(data) && data[start] == '\n' {
+		start++
+	}
+	if n, ok := dict["Length"].(float64); ok && n >= 0 && start+int(n) <= len(data) {
+		end := start + int(n)
+		rest := bytes.TrimLeft(data[end:], "\r\n \t")
+		if bytes.HasPrefix(rest, []byte("endstream")) {
+			return &pdfStream{dict: dict, raw: data[start:end]}, len(data) - len(rest) + len("endstream")
+		}
+	}
+	// Length is indirect or wrong; the stream runs up to endstream.
+	idx := bytes.Index(data[start:], []byte("endstream"))
+	if idx < 0 {
+		return &pdfStream{dict: dict, raw: data[start:]}, len(data)
+	}
+	raw := bytes.TrimRight(data[start:start+idx], "\r\n")
+	return &pdfStream{dict: dict, raw: raw}, start + idx + len("endstream")
+}
+
+func (d *pdfDocument) readObjectStream(stream *pdfStream) {
+	data, err := d.decodeStream(stream)
+	if err != nil {
+		return
+	}
+	n, _ := stream.dict["N"].(float64)
+	first, _ := stream.dict["First"].(float64)
+	if first < 0 || int(first) > len(data) {
+		return
+	}
+	header := &pdfLexer{data: data[:int(first)]}
+	for i := 0; i < int(n); i++ {
+		num, err1 := header.token()
+		off, err2 := header.token()
+		numF, ok1 := num.(float64)
+		offF, ok2 := off.(float64)
+		if err1 != nil || err2 != nil || !ok1 || !ok2 {
+			return
+		}
+		if _, exists := d.objects[int(numF)]; exists {
+			continue
+		}
+		pos := int(first) + int(offF)
+		if offF < 0 || pos >= len(data) {
+			continue
+		}
+		l := &pdfLexer{data: data, pos: pos}
+		if v, err := l.value(); err == nil || errors.Is(err, io.EOF) {
+			d.objects[int(numF)] = v
+		}
+	}
+}
+
+// resolve follows references to the object they point at.
+func (d *pdfDocument) resolve(v any) any {
+	for i := 0; i < 32; i++ {
+		ref, ok := v.(pdfRef)
+		if !ok {
+			return v
+		}
+		v = d.objects[ref.num]
+	}
+	return nil
+}
+
+func (d *pdfDocument) dict(v any) pdfDict {
+	switch t := d.resolve(v).(type) {
+	case pdfDict:
+		return t
+	case *pdfStream:
+		return t.dict
+	}
+	return nil
+}
+
+// decodeStream applies the stream's filters. Flate, ASCIIHex and ASCII85
+// are supported, which covers text content; a damaged Flate stream
+// returns what could be inflated. A stream that inflates past
+// maxPDFStreamBytes, or past what is left of maxPDFInflatedBytes, fails.
+func (d *pdfDocument) decodeStream(s *pdfStream) ([]byte, error) {
+	var filters []any
+	switch f := d.resolve(s.dict["Filter"]).(type) {
+	case pdfName:
+		filters = []any{f}
+	case pdfArray:
+		filters = f
+	}
+	data := s.raw
+	for _, f := range filters {
+		switch d.resolve(f) {
+		case pdfName("FlateDecode"), pdfName("Fl"):
+			r, err := zlib.NewReader(bytes.NewReader(data))
+			if err != nil {
+				return nil, err
+			}
+			limit := min(maxPDFStreamBytes, maxPDFInflatedBytes-d.inflated)
+			out, err := io.ReadAll(io.LimitReader(r, int64(limit)+1))
+			d.inflated += len(out)
+			if len(out) > limit {
+				return nil, fmt.Errorf("PDF 数据流解压后过大（单个上限 %d MB，全文上限 %d MB）", maxPDFStreamBytes>>20, maxPDFInflatedBytes>>20)
+			}
+			if err != nil && len(out) == 0 {
+				return nil, err
+			}
+			data = out
+		case pdfName("ASCIIHexDecode"), pdfName("AHx"):
+			data = (&pdfLexer{data: append(append([]byte{'<'}, data...), '>')}).hexString()
+		case pdfName("ASCII85Decode"), pdfName("A85"):
+			src := bytes.TrimPrefix(bytes.TrimSpace(data), []byte("<~"))
+			if i := bytes.Index(src, []byte("~>")); i >= 0 {
+				src = src[:i]
+			}
+			out := make([]byte, 4*len(src)/5+4)
+			n, _, err := ascii85.Decode(out, src, true)
+			if err != nil {
+				return nil, err
+			}
+			data = out[:n]
+		default:
+			return nil, fmt.Errorf("不支持的压缩方式 %v", f)
+		}
+	}
+	return data, nil
+}
+
+// pdfFont decodes the strings shown with one font and measures how far
+// they advance, in thousandths of the font size.
+type pdfFont struct {
+	toUnicode    map[string]string // character code bytes → text
+	spaces       []pdfCodeSpace    // code lengths from the ToUnicode map
+	twoByte      bool              // composite font: two-byte codes by default
+	gbk          bool              // GBK codes: a lead byte from 0x81 starts two bytes
+	fallback     func([]byte) string
+	widths       map[uint32]float64
+	defaultWidth float64
+}
+
+type pdfCodeSpace struct{ lo, hi []byte }
+
+func (d *pdfDocument) font(v any) *pdfFont {
+	key := v
+	if _, ok := v.(pdfRef); !ok {
+		key = nil
+	}
+	if key != nil {
+		if f, ok := d.fonts[key]; ok {
+			return f
+		}
+	}
+	dict := d.dict(v)
+	f := &pdfFont{fallback: decodeLatin1, defaultWidth: 500}
+	if dict == nil {
+		return f
+	}
+	f.twoByte = dict["Subtype"] == pdfName("Type0")
+	d.loadFontWidths(f, dict)
+	encoding, _ := d.resolve(dict["Encoding"]).(pdfName)
+	enc := strings.ToUpper(string(encoding))
+	switch {
+	case strings.Contains(enc, "UCS2") || strings.Contains(enc, "UTF16"):
+		f.fallback = decodeUTF16BE
+	case strings.HasPrefix(enc, "GBK") || strings.Contains(enc, "GB-EUC") || strings.Contains(enc, "GBPC-EUC") || strings.HasPrefix(enc, "GBT"):
+		f.fallback = decodeGBK
+		f.twoByte = false
+		f.gbk = true
+	case f.twoByte:
+		f.fallback = func([]byte) string { return "" }
+	case enc == "MACROMANENCODING":
+		f.fallback = decodeMacRoman
+	}
+	if stream, ok := d.resolve(dict["ToUnicode"]).(*pdfStream); ok {
+		if data, err := d.decodeStream(stream); err == nil {
+			f.toUnicode, f.spaces = parseToUnicodeCMap(data)
+		}
+	}
+	if key != nil {
+		d.fonts[key] = f
+	}
+	return f
+}
+
+// loadFontWidths reads glyph widths: Widths from FirstChar for simple
+// fonts, W and DW of the descendant font for composite ones. Standard
+// fonts without widths get an average guess.
+func (d *pdfDocument) loadFontWidths(f *pdfFont, dict pdfDict) {
+	f.widths = map[uint32]float64{}
+	if f.twoByte {
+		f.defaultWidth = 1000
+		descendants, _ := d.resolve(dict["DescendantFonts"]).(pdfArray)
+		if len(descendants) == 0 {
+			return
+		}
+		cid := d.dict(descendants[0])
+		if dw, ok := d.resolve(cid["DW"]).(float64); ok {
+			f.defaultWidth = dw
+		}
+		w, _ := d.resolve(cid["W"]).(pdfArray)
+		for i := 0; i+1 < len(w); {
+			first, ok := d.resolve(w[i]).(float64)
+			if !ok {
+				return
+			}
+			switch next := d.resolve(w[i+1]).(type) {
+			case pdfArray:
+				for j, v := range next {
+					if width, ok := d.resolve(v).(float64); ok {
+						f.widths[uint32(first)+uint32(j)] = width
+					}
+				}
+				i += 2
+			case float64:
+				if i+2 >= len(w) || next < first || next-first > 0xFFFF {
+					return
+				}
+				if width, ok := d.resolve(w[i+2]).(float64); ok {
+					for c := uint32(first); c <= uint32(next); c++ {
+						f.widths[c] = width
+					}
+				}
+				i += 3
+			default:
+				return
+			}
+		}
+		return
+	}
+	if desc := d.dict(dict["FontDescriptor"]); desc != nil {
+		if mw, ok := d.resolve(desc["MissingWidth"]).(float64); ok && mw > 0 {
+			f.defaultWidth = mw
+		}
+	}
+	first, _ := d.resolve(dict["FirstChar"]).(float64)
+	widths, _ := d.resolve(dict["Widths"]).(pdfArray)
+	for j, v := range widths {
+		if width, ok := d.resolve(v).(float64); ok {
+			f.widths[uint32(first)+uint32(j)] = width
+		}
+	}
+}
+
+// decode returns the text of s and the advance of its glyphs.
+func (f *pdfFont) decode(s []byte) (string, float64) {
+	var b strings.Builder
+	advance := 0.0
+	for i := 0; i < len(s); {
+		n := f.codeLength(s[i:])
+		if i+n > len(s) {
+			n = len(s) - i
+		}
+		code := s[i : i+n]
+		if w, ok := f.widths[pdfCode(code)]; ok {
+			advance += w
+		} else {
+			advance += f.defaultWidth
+		}
+		if text, ok := f.toUnicode[string(code)]; ok {
+			b.WriteString(text)
+		}
+		i += n
+	}
+	if len(f.toUnicode) == 0 {
+		return f.fallback(s), advance
+	}
+	return b.String(), advance
+}
+
+func (f *pdfFont) codeLength(s []byte) int {
+	for _, space := range f.spaces {
+		n := len(space.lo)
+		if n > len(s) {
+			continue
+		}
+		in := true
+		for i := 0; i < n; i++ {
+			if s[i] < space.lo[i] || s[i] > space.hi[i] {
+				in = false
+				break
+			}
+		}
+		if in {
+			return n
+		}
+	}
+	if f.twoByte || (f.gbk && s[0] >= 0x81 && len(s) > 1) {
+		return 2
+	}
+	return 1
+}
+
+// parseToUnicodeCMap reads the bfchar and bfrange mappings of a ToUnicode
+// CMap, keyed by the code bytes, and its code space ranges.
+func parseToUnicodeCMap(data []byte) (map[string]string, []pdfCodeSpace) {
+	m := map[string]string{}
+	var spaces []pdfCodeSpace
+	l := &pdfLexer{data: data}
+	var operands []any
+	for {
+		v, err := l.value()
+		if err != nil {
+			break
+		}
+		kw, ok := v.(pdfKeyword)
+		if !ok {
+			operands = append(operands, v)
+			continue
+		}
+		switch kw {
+		case "endcodespacerange":
+			for i := 0; i+1 < len(operands); i += 2 {
+				lo, ok1 := operands[i].(pdfString)
+				hi, ok2 := operands[i+1].(pdfString)
+				if ok1 && ok2 && len(lo) == len(hi) && len(lo) > 0 {
+					spaces = append(spaces, pdfCodeSpace{lo: lo, hi: hi})
+				}
+			}
+		case "endbfchar":
+			for i := 0; i+1 < len(operands); i += 2 {
+				src, ok1 := operands[i].(pdfString)
+				dst, ok2 := operands[i+1].(pdfString)
+				if ok1 && ok2 {
+					m[string(src)] = decodeUTF16BE(dst)
+				}
+			}
+		case "endbfrange":
+			for i := 0; i+2 < len(operands); i += 3 {
+				lo, ok1 := operands[i].(pdfString)
+				hi, ok2 := operands[i+1].(pdfString)
+				if !ok1 || !ok2 || len(lo) != len(hi) || len(lo) == 0 || len(lo) > 4 {
+					continue
+				}
+				start, end := pdfCode(lo), pdfCode(hi)
+				if end < start || end-start > 0xFFFF {
+					continue
+				}
+				switch dst := operands[i+2].(type) {
+				case pdfString:
+					for c := start; c <= end; c++ {
+						m[string(pdfCodeBytes(c, len(lo)))] = decodeUTF16BE(pdfIncrement(dst, c-start))
+					}
+				case pdfArray:
+					for j, item := range dst {
+						if s, ok := item.(pdfString); ok && start+uint32(j) <= end {
+							m[string(pdfCodeBytes(start+uint32(j), len(lo)))] = decodeUTF16BE(s)
+						}
+					}
+				}
+			}
+		}
+		operands = operands[:0]
+	}
+	return m, spaces
+}
+
+func pdfCode(b []byte) uint32 {
+	var c uint32
+	for _, x := range b {
+		c = c<<8 | uint32(x)
+	}
+	return c
+}
+
+func pdfCodeBytes(c uint32, n int) []byte {
+	b := make([]byte, n)
+	for i := n - 1; i >= 0; i-- {
+		b[i] = byte(c)
+		c >>= 8
+	}
+	return b
+}
+
+// pdfIncrement adds n to the last two bytes of a UTF-16BE destination, as
+// a bfrange does for each code after the first.
+func pdfIncrement(dst []byte, n uint32) []byte {
+	out := append([]byte(nil), dst...)
+	if len(out) < 2 {
+		return out
+	}
+	v := uint32(out[len(out)-2])<<8 | uint32(out[len(out)-1])
+	v += n
+	out[len(out)-2] = byte(v >> 8)
+	out[len(out)-1] = byte(v)
+	return out
+}
+
+func decodeUTF16BE(b []byte) string {
+	if len(b)%2 == 1 {
+		b = append(b, 0)
+	}
+	u := make([]uint16, len(b)/2)
+	for i := range u {
+		u[i] = uint16(b[2*i])<<8 | uint16(b[2*i+1])
+	}
+	return string(utf16.Decode(u))
+}
+
+func decodeLatin1(b []byte) string {
+	s, _ := charmap.Windows1252.NewDecoder().Bytes(b)
+	return string(s)
+}
+
+func decodeMacRoman(b []byte) string {
+	s, _ := charmap.Macintosh.NewDecoder().Bytes(b)
+	return string(s)
+}
+
+func decodeGBK(b []byte) string {
+	s, _ := simplifiedchinese.GBK.NewDecoder().Bytes(b)
+	return string(s)
+}
+
+// pdfTextWriter collects text into lines. A pending space is only written
+// between non-CJK characters, since Chinese text has no word spaces.
+type pdfTextWriter struct {
+	out          strings.Builder
+	line         strings.Builder
+	pendingSpace bool
+	lastRune     rune
+}
+
+func (w *pdfTextWriter) write(text string) {
+	text = strings.Map(func(r rune) rune {
+		if r == 0 || r == unicode.ReplacementChar {
+			return -1
+		}
+		if unicode.IsControl(r) && r != '\t' {
+			return ' '
+		}
+		return r
+	}, text)
+	if text == "" {
+		return
+	}
+	first := []rune(text)[0]
+	if w.pendingSpace && w.line.Len() > 0 && !unicode.IsSpace(w.lastRune) && !unicode.IsSpace(first) &&
+		!isCJKRune(w.lastRune) && !isCJKRune(first) {
+		w.line.WriteByte(' ')
+	}
+	w.pendingSpace = false
+	w.line.WriteString(text)
+	runes := []rune(text)
+	w.lastRune = runes[len(runes)-1]
+}
+
+func (w *pdfTextWriter) newline() {
+	w.pendingSpace = false
+	line := strings.TrimSpace(w.line.String())
+	w.line.Reset()
+	if line != "" {
+		w.out.WriteString(line)
+		w.out.WriteByte('\n')
+	}
+}
+
+func isCJKRune(r rune) bool {
+	return r >= 0x2E80 && (unicode.Is(unicode.Han, r) || (r >= 0x3000 && r <= 0x303F) || (r >= 0xFF00 && r <= 0xFFEF))
+}
+
+// extractPDFText returns the text layer of a PDF, one line per text line
+// and a blank line between pages.
+func extractPDFText(data []byte) (string, error) {
+	pages, err := extractPDFPages(data)
+	if err != nil {
+		return "", err
+	}
+	var nonEmpty []string
+	for _, page := range pages {
+		if page != "" {
+			nonEmpty = append(nonEmpty, page)
+		}
+	}
+	return strings.Join(nonEmpty, "\n\n"), nil
+}
+
+// extractPDFPages returns the text layer of each page of a PDF, in page
+// order; pages without text are empty strings. A malformed file the lexer
+// trips over is reported as a parse error rather than a panic, so the
+// parser chain can move on.
+func extractPDFPages(data []byte) (texts []string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			texts, err = nil, fmt.Errorf("PDF 解析失败: %v", r)
+		}
+	}()
+	doc, err := readPDF(data)
+	if err != nil {
+		return nil, err
+	}
+	catalog := doc.dict(doc.root)
+	if catalog == nil {
+		return nil, errors.New("PDF 缺少页面目录")
+	}
+	var pages []pdfPage
+	doc.collectPages(catalog["Pages"], nil, map[int]bool{}, &pages)
+
+	texts = make([]string, 0, len(pages))
+	for _, page := range pages {
+		w := &pdfTextWriter{}
+		for _, content := range page.contents {
+			stream, ok := doc.resolve(content).(*pdfStream)
+			if !ok {
+				continue
+			}
+			data, err := doc.decodeStream(stream)
+			if err != nil {
+				continue
+			}
+			doc.showText(data, page.resources, w, 0)
+		}
+		w.newline()
+		texts = append(texts, strings.TrimSpace(w.out.String()))
+	}
+	return texts, nil
+}
+
+type pdfPage struct {
+	contents  []any
+	resources pdfDict
+}
+
+// collectPages walks the page tree in order; resources are inherited from
+// the nearest ancestor that sets them.
+func (d *pdfDocument) collectPages(node any, resources pdfDict, seen map[int]bool, pages *[]pdfPage) {
+	if ref, ok := node.(pdfRef); ok {
+		if seen[ref.num] {
+			return
+		}
+		seen[ref.num] = true
+	}
+	dict := d.dict(node)
+	if dict == nil || len(*pages) >= pdfMaxPages {
+		return
+	}
+	if r := d.dict(dict["Resources"]); r != nil {
+		resources = r
+	}
+	if kids, ok := d.resolve(dict["Kids"]).(pdfArray); ok {
+		for _, kid := range kids {
+			d.collectPages(kid, resources, seen, pages)
+		}
+		return
+	}
+	page := pdfPage{resources: resources}
+	switch c := d.resolve(dict["Contents"]).(type) {
+	case pdfArray:
+		page.contents = c
+	case *pdfStream:
+		page.contents = []any{dict["Contents"]}
+	}
+	*pages = append(*pages, page)
+}
+
+// showText runs the text operators of a content stream. Form XObjects are
+// followed a few levels deep. Glyph widths track where the shown text
+// ends, so a move along the line further than a narrow space becomes a
+// word gap, while text placed glyph by glyph stays together.
+func (d *pdfDocument) showText(content []byte, resources pdfDict, w *pdfTextWriter, depth int) {
+	fonts := d.dict(resources["Font"])
+	xobjects := d.dict(resources["XObject"])
+	font := &pdfFont{fallback: decodeLatin1, defaultWidth: 500}
+	fontSize, scale := 0.0, 1.0
+	lineX, endX := 0.0, 0.0
+	lineY, haveLineY := 0.0, false
+
+	show := func(s pdfString) {
+		text, advance := font.decode(s)
+		w.write(text)
+		endX += advance / 1000 * fontSize * scale
+	}
+	moveTo := func(x float64) {
+		if em := fontSize * scale; em > 0 && x-endX > 0.15*em {
+			w.pendingSpace = true
+		}
+		lineX, endX = x, x
+	}
+
+	l := &pdfLexer{data: content}
+	var operands []any
+	for {
+		v, err := l.value()
+		if err != nil {
+			break
+		}
+		op, ok := v.(pdfKeyword)
+		if !ok {
+			operands = append(operands, v)
+			continue
+		}
+		num := func(i int) float64 {
+			if i < len(operands) {
+				n, _ := operands[i].(float64)
+				return n
+			}
+			return 0
+		}
+		switch op {
+		case "BT":
+			scale, lineX, endX = 1, 0, 0
+		case "Tf":
+			if len(operands) >= 2 {
+				if name, ok := operands[0].(pdfName); ok && fonts != nil {
+					font = d.font(fonts[name])
+				}
+				fontSize = num(1)
+			}
+		case "Tj":
+			if len(operands) >= 1 {
+				if s, ok := operands[len(operands)-1].(pdfString); ok {
+					show(s)
+				}
+			}
+		case "'", "\"":
+			w.newline()
+			endX = lineX
+			if len(operands) >= 1 {
+				if s, ok := operands[len(operands)-1].(pdfString); ok {
+					show(s)
+				}
+			}
+		case "TJ":
+			if len(operands) >= 1 {
+				arr, _ := operands[len(operands)-1].(pdfArray)
+				for _, item := range arr {
+					switch t := item.(type) {
+					case pdfString:
+						show(t)
+					case float64:
+						endX -= t / 1000 * fontSize * scale
+						// A wide negative kern is a word gap.
+						if t < -200 {
+							w.pendingSpace = true
+						}
+					}
+				}
+			}
+		case "Td", "TD":
+			if len(operands) >= 2 {
+				x := lineX + num(0)*scale
+				if num(1) != 0 {
+					w.newline()
+					haveLineY = false
+					lineX, endX = x, x
+				} else {
+					moveTo(x)
+				}
+			}
+		case "T*":
+			w.newline()
+			endX = lineX
+		case "Tm":
+			if len(operands) >= 6 {
+				if a := num(0); a != 0 {
+					scale = math.Abs(a)
+				}
+				if y := num(5); haveLineY && y != lineY {
+					w.newline()
+					lineX, endX = num(4), num(4)
+				} else {
+					moveTo(num(4))
+				}
+				lineY, haveLineY = num(5), true
+			}
+		case "Do":
+			if len(operands) >= 1 && xobjects != nil && depth < 4 {
+				name, _ := operands[0].(pdfName)
+				if form, ok := d.resolve(xobjects[name]).(*pdfStream); ok && form.dict["Subtype"] == pdfName("Form") {
+					if data, err := d.decodeStream(form); err == nil {
+						res := d.dict(form.dict["Resources"])
+						if res == nil {
+							res = resources
+						}
+						d.showText(data, res, w, depth+1)
+					}
+				}
+			}
+		case "BI":
+			skipInlineImage(l)
+		}
+		operands = operands[:0]
+	}
+}
+
+// skipInlineImage moves past the binary data of an inline image, which
+// runs from ID to EI.
+func skipInlineImage(l *pdfLexer) {
+	if l.pos >= len(l.data) {
+		l.pos = len(l.data)
+		return
+	}
+	idx := bytes.Index(l.data[l.pos:], []byte("ID"))
+	if idx < 0 {
+		l.pos = len(l.data)
+		return
+	}
+	l.pos += idx + 2
+	for l.pos < len(l.data) {
+		idx := bytes.Index(l.data[l.pos:], []byte("EI"))
+		if idx < 0 {
+			l.pos = len(l.data)
+			return
+		}
+		at := l.pos + idx
+		l.pos = at + 2
+		if at > 0 && isPDFSpace(l.data[at-1]) && (l.pos >= len(l.data) || isPDFSpace(l.data[l.pos])) {
+			return
+		}
+	}
+}
@@ -6,14 +6,10 @@ import (
 	"errors"
 	"fmt"
 	"log"
-	"regexp"
-	"sort"
 	"strings"
 	"sync"
 	"time"
-	"unicode/utf8"
 
-	"stock-report-analysis/internal/db"
 	"stock-report-analysis/internal/models"
 )
 
@@ -21,25 +17,36 @@ type QAStreamCallbacks struct {
 	OnJobStart  func(sessionID int64, questionMessageID int64, roleCount int)
 	OnRoleStart func(msg models.QAMessage, role models.Role)
 	OnRoleChunk func(messageID int64, roleID int64, roleName string, chunk string)
-	OnRoleDone  func(msg models.QAMessage)
-	OnRoleError func(messageID int64, roleID int64, roleName string, errMsg string)
-	OnJobDone   func(sessionID int64)
+	// OnRoleReasoning receives the thinking text of reasoning models.
+	OnRoleReasoning func(messageID int64, roleID int64, roleName string, chunk string)
+	OnRoleDone      func(msg models.QAMessage)
+	OnRoleError     func(messageID int64, roleID int64, roleName string, errMsg string)
+	// The moderator callbacks stream the synthesis written after the roles
+	// when the moderator is enabled and at least two roles answered.
+	OnModeratorStart func(msg models.QAMessage)
+	OnModeratorChunk func(messageID int64, chunk string)
+	OnModeratorDone  func(msg models.QAMessage)
+	OnModeratorError func(messageID int64, errMsg string)
+	OnJobDone        func(sessionID int64)
 }
 
-type articleChunk struct {
-	Index int
-	Text  string
-	Score int
-}
-
-var keywordPattern = regexp.MustCompile(`[\p{Han}\p{L}\p{N}]{2,}`)
-
 const qaRoleTimeout = 90 * time.Second
 
-func GetQASessions(articleID int64) ([]models.QASession, error) {
+// The columns of the QA tables, read explicitly because the rows of a
+// scoped session have no article: article_id is NULL there and read as 0.
+const (
+	qaSessionColumns = "id, COALESCE(article_id, 0) AS article_id, scope, title, summary, created_at, updated_at"
+	qaPinColumns     = "id, session_id, COALESCE(article_id, 0) AS article_id, source_message_id, content, created_at, updated_at"
+	qaMessageColumns = `m.id, m.session_id, COALESCE(m.article_id, 0) AS article_id, m.parent_id, m.role_type, m.role_id,
+		m.content, m.status, m.error_reason, m.duration_ms, m.prompt_tokens, m.completion_tokens, m.total_tokens, m.created_at`
+	qaEvidenceColumns = `e.id, e.message_id, COALESCE(e.article_id, 0) AS article_id, COALESCE(a.title, '') AS article_title,
+		e.chunk_index, e.quote, e.reason, e.heading_path, e.page_start, e.page_end`
+)
+
+func (s *Service) GetQASessions(articleID int64) ([]models.QASession, error) {
 	var sessions []models.QASession
-	err := db.DB.Select(&sessions, `
-		SELECT *
+	err := s.db.Select(&sessions, `
+		SELECT `+qaSessionColumns+`
 		FROM qa_sessions
 		WHERE article_id=?
 		ORDER BY updated_at DESC, id DESC
@@ -47,12 +54,15 @@ func GetQASessions(articleID int64) ([]models.QASession, error) {
 	return sessions, err
 }
 
-func CreateQASession(articleID int64, title string) (models.QASession, error) {
+func (s *Service) CreateQASession(articleID int64, title string) (models.QASession, error) {
+	if articleID <= 0 {
+		return models.QASession{}, errors.New("文章 ID 无效")
+	}
 	title = strings.TrimSpace(title)
 	if title == "" {
 		title = "问答会话"
 	}
-	res, err := db.DB.Exec(`
+	res, err := s.db.Exec(`
 		INSERT INTO qa_sessions(article_id, title, summary)
 		VALUES(?,?,?)
 	`, articleID, trimToRunes(title, 64), "")
@@ -60,17 +70,24 @@ func CreateQASession(articleID int64, title string) (models.QASession, error) {
 		return models.QASession{}, err
 	}
 	id, _ := res.LastInsertId()
+	return s.getQASession(id)
+}
+
+func (s *Service) getQASession(id int64) (models.QASession, error) {
 	var session models.QASession
-	err = db.DB.Get(&session, "SELECT * FROM qa_sessions WHERE id=?", id)
+	err := s.db.Get(&session, "SELECT "+qaSessionColumns+" FROM qa_sessions WHERE id=?", id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return session, errors.New("会话不存在")
+	}
 	return session, err
 }
 
-func RenameQASession(id int64, title string) error {
+func (s *Service) RenameQASession(id int64, title string) error {
 	title = strings.TrimSpace(title)
 	if title == "" {
 		return errors.New("会话标题不能为空")
 	}
-	_, err := db.DB.Exec(`
+	_, err := s.db.Exec(`
 		UPDATE qa_sessions
 		SET title=?, updated_at=CURRENT_TIMESTAMP
 		WHERE id=?
@@ -78,15 +95,15 @@ func RenameQASession(id int64, title string) error {
 	return err
 }
 
-func DeleteQASession(id int64) error {
-	_, err := db.DB.Exec("DELETE FROM qa_sessions WHERE id=?", id)
+func (s *Service) DeleteQASession(id int64) error {
+	_, err := s.db.Exec("DELETE FROM qa_sessions WHERE id=?", id)
 	return err
 }
 
-func GetQAPins(sessionID int64) ([]models.QAPin, error) {
+func (s *Service) GetQAPins(sessionID int64) ([]models.QAPin, error) {
 	var pins []models.QAPin
-	err := db.DB.Select(&pins, `
-		SELECT *
+	err := s.db.Select(&pins, `
+		SELECT `+qaPinColumns+`
 		FROM qa_pins
 		WHERE session_id=?
 		ORDER BY id DESC
@@ -94,21 +111,20 @@ func GetQAPins(sessionID int64) ([]models.QAPin, error) {
 	return pins, err
 }
 
-func SaveQAPin(pin models.QAPin) (models.QAPin, error) {
+// SaveQAPin stores a pin under its session's article; pins of a scoped
+// session have none. pin.ArticleID is ignored.
+func (s *Service) SaveQAPin(pin models.QAPin) (models.QAPin, error) {
 	pin.Content = strings.TrimSpace(pin.Content)
 	if pin.SessionID <= 0 {
 		return models.QAPin{}, errors.New("会话 ID 无效")
 	}
-	if pin.ArticleID <= 0 {
-		return models.QAPin{}, errors.New("文章 ID 无效")
-	}
 	if pin.Content == "" {
 		return models.QAPin{}, errors.New("记忆内容不能为空")
 	}
 	pin.Content = trimToRunes(pin.Content, 1200)
 
 	if pin.ID > 0 {
-		_, err := db.DB.Exec(`
+		_, err := s.db.Exec(`
 			UPDATE qa_pins
 			SET content=?, source_message_id=?, updated_at=CURRENT_TIMESTAMP
 			WHERE id=? AND session_id=?
@@ -117,35 +133,38 @@ func SaveQAPin(pin models.QAPin) (models.QAPin, error) {
 			return models.QAPin{}, err
 		}
 		var updated models.QAPin
-		if err := db.DB.Get(&updated, "SELECT * FROM qa_pins WHERE id=?", pin.ID); err != nil {
+		if err := s.db.Get(&updated, "SELECT "+qaPinColumns+" FROM qa_pins WHERE id=?", pin.ID); err != nil {
 			return models.QAPin{}, err
 		}
 		return updated, nil
 	}
 
-	res, err := db.DB.Exec(`
+	res, err := s.db.Exec(`
 		INSERT INTO qa_pins(session_id, article_id, source_message_id, content)
-		VALUES(?,?,?,?)
-	`, pin.SessionID, pin.ArticleID, pin.SourceMessageID, pin.Content)
+		SELECT id, article_id, ?, ? FROM qa_sessions WHERE id=?
+	`, pin.SourceMessageID, pin.Content, pin.SessionID)
 	if err != nil {
 		return models.QAPin{}, err
 	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return models.QAPin{}, errors.New("会话不存在")
+	}
 	id, _ := res.LastInsertId()
 	var created models.QAPin
-	err = db.DB.Get(&created, "SELECT * FROM qa_pins WHERE id=?", id)
+	err = s.db.Get(&created, "SELECT "+qaPinColumns+" FROM qa_pins WHERE id=?", id)
 	return created, err
 }
 
-func DeleteQAPin(id int64) error {
-	_, err := db.DB.Exec("DELETE FROM qa_pins WHERE id=?", id)
+func (s *Service) DeleteQAPin(id int64) error {
+	_, err := s.db.Exec("DELETE FROM qa_pins WHERE id=?", id)
 	return err
 }
 
-func GetQAMessages(sessionID int64) ([]models.QAMessage, error) {
+func (s *Service) GetQAMessages(sessionID int64) ([]models.QAMessage, error) {
 	var messages []models.QAMessage
-	err := db.DB.Select(&messages, `
+	err := s.db.Select(&messages, `
 		SELECT
-			m.*,
+			`+qaMessageColumns+`,
 			COALESCE(r.name, '') AS role_name
 		FROM qa_messages m
 		LEFT JOIN roles r ON r.id = m.role_id
@@ -160,10 +179,11 @@ func GetQAMessages(sessionID int64) ([]models.QAMessage, error) {
 	}
 
 	var evidences []models.QAEvidence
-	err = db.DB.Select(&evidences, `
-		SELECT e.*
+	err = s.db.Select(&evidences, `
+		SELECT `+qaEvidenceColumns+`
 		FROM qa_evidences e
 		JOIN qa_messages m ON m.id = e.message_id
+		LEFT JOIN articles a ON a.id = e.article_id
 		WHERE m.session_id=?
 		ORDER BY e.id ASC
 	`, sessionID)
@@ -181,15 +201,15 @@ func GetQAMessages(sessionID int64) ([]models.QAMessage, error) {
 	return messages, nil
 }
 
-func AskQuestion(sessionID int64, articleID int64, question string, cb QAStreamCallbacks) (int64, error) {
-	return AskQuestionWithContextAndFollowUp(context.Background(), sessionID, articleID, question, 0, cb)
+func (s *Service) AskQuestion(sessionID int64, articleID int64, question string, cb QAStreamCallbacks) (int64, error) {
+	return s.AskQuestionWithContextAndFollowUp(context.Background(), sessionID, articleID, question, 0, cb)
 }
 
-func AskQuestionWithContext(ctx context.Context, sessionID int64, articleID int64, question string, cb QAStreamCallbacks) (int64, error) {
-	return AskQuestionWithContextAndFollowUp(ctx, sessionID, articleID, question, 0, cb)
+func (s *Service) AskQuestionWithContext(ctx context.Context, sessionID int64, articleID int64, question string, cb QAStreamCallbacks) (int64, error) {
+	return s.AskQuestionWithContextAndFollowUp(ctx, sessionID, articleID, question, 0, cb)
 }
 
-func AskQuestionWithContextAndFollowUp(ctx context.Context, sessionID int64, articleID int64, question string, followUpMessageID int64, cb QAStreamCallbacks) (int64, error) {
+func (s *Service) AskQuestionWithContextAndFollowUp(ctx context.Context, sessionID int64, articleID int64, question string, followUpMessageID int64, cb QAStreamCallbacks) (int64, error) {
 	if ctx == nil {
 		ctx = context.Background()
 	}
@@ -203,8 +223,21 @@ func AskQuestionWithContextAndFollowUp(ctx context.Context, sessionID int64, art
 	}
 	log.Printf("[QA] ask start session=%d article=%d question=%q", sessionID, articleID, trimToRunes(question, 80))
 
+	// An existing session decides what is asked about; a scoped one has no
+	// article and retrieves from its scope.
+	var scope models.QAScope
+	if sessionID > 0 {
+		session, err := s.getQASession(sessionID)
+		if err != nil {
+			return 0, err
+		}
+		articleID, scope = session.ArticleID, session.Scope
+	} else if articleID <= 0 {
+		return 0, errors.New("请先选择文章，或新建跨文章问答会话")
+	}
+
 	if sessionID == 0 {
-		session, err := CreateQASession(articleID, question)
+		session, err := s.CreateQASession(articleID, question)
 		if err != nil {
 			return 0, err
 		}
@@ -212,7 +245,7 @@ func AskQuestionWithContextAndFollowUp(ctx context.Context, sessionID int64, art
 		log.Printf("[QA] created session=%d article=%d", sessionID, articleID)
 	}
 
-	roles, cleanedQuestion, err := ResolveRolesByMentions(question)
+	roles, cleanedQuestion, err := s.ResolveRolesByMentions(question)
 	if err != nil {
 		return 0, err
 	}
@@ -220,13 +253,13 @@ func AskQuestionWithContextAndFollowUp(ctx context.Context, sessionID int64, art
 
 	followUpContext := ""
 	if followUpMessageID > 0 {
-		followUpContext, err = buildFollowUpContext(sessionID, articleID, followUpMessageID)
+		followUpContext, err = s.buildFollowUpContext(sessionID, articleID, followUpMessageID)
 		if err != nil {
 			return 0, err
 		}
 	}
 
-	userMessageID, err := insertQAMessage(models.QAMessage{
+	userMessageID, err := s.insertQAMessage(models.QAMessage{
 		SessionID:   sessionID,
 		ArticleID:   articleID,
 		RoleType:    "user",
@@ -254,45 +287,42 @@ func AskQuestionWithContextAndFollowUp(ctx context.Context, sessionID int64, art
 		return userMessageID, nil
 	}
 
-	article, err := GetArticle(articleID)
+	scoped := articleID == 0
+	chunks, err := s.sessionChunks(articleID, scope)
 	if err != nil {
 		return userMessageID, err
 	}
-	chunks := buildArticleChunks(article.Content, 900)
-	retrieved := retrieveTopChunks(cleanedQuestion, chunks, 6)
+	topK := 6
+	if scoped {
+		topK = qaScopeChunkCount
+	}
+	retrieved := s.retrieveChunks(ctx, cleanedQuestion, chunks, topK)
 
-	summary, _ := getSessionSummary(sessionID)
-	pins, _ := getSessionPins(sessionID)
-	channel, err := getDefaultChannel()
+	summary, _ := s.getSessionSummary(sessionID)
+	pins, _ := s.getSessionPins(sessionID)
+	channel, err := s.getDefaultChannel()
 	if err != nil {
 		return userMessageID, err
 	}
+	cacheCfg, _ := s.GetAIResponseCacheConfig()
 
+	// Roles run concurrently; the channel limiter decides how many calls are
+	// in flight. Each goroutine fills its own slot, so answers keep the
+	// order in which the roles were mentioned.
 	var wg sync.WaitGroup
-	sem := make(chan struct{}, 2)
-
-	answerSummaries := make([]string, 0, len(roles))
-	var ansMu sync.Mutex
+	answers := make([]qaRoleAnswer, len(roles))
 
-	for _, role := range roles {
-		role := role
+	for i, role := range roles {
+		i, role := i, role
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-
-			select {
-			case sem <- struct{}{}:
-			case <-ctx.Done():
-				return
-			}
-			defer func() { <-sem }()
-
 			if ctx.Err() != nil {
 				return
 			}
 			log.Printf("[QA] role begin session=%d role=%d(%s)", sessionID, role.ID, role.Name)
 
-			assistantMessageID, err := insertQAMessage(models.QAMessage{
+			assistantMessageID, err := s.insertQAMessage(models.QAMessage{
 				SessionID: sessionID,
 				ArticleID: articleID,
 				RoleType:  "assistant",
@@ -318,36 +348,57 @@ func AskQuestionWithContextAndFollowUp(ctx context.Context, sessionID int64, art
 			}
 
 			prompt := buildQASystemPrompt(role)
-			qaInput := buildQAInput(summary, pins, followUpContext, cleanedQuestion, retrieved)
+			qaInput := buildQAInput(summary, pins, followUpContext, cleanedQuestion, retrieved, scoped)
+			genOptions := role.GenerationOptions
 			startedAt := time.Now()
 			roleCtx, cancelRole := context.WithTimeout(ctx, qaRoleTimeout)
-			result, err := AnalyzeArticleDetailedWithContext(roleCtx, activeChannel, prompt, qaInput, AnalysisModeText, func(chunk string) {
+			// Roles retry on their own channel only; failing over would
+			// silently drop the role's model override.
+			attempt, err := s.AnalyzeWithFailover(roleCtx, AnalysisRequest{
+				Channel:  activeChannel,
+				Prompt:   prompt,
+				Content:  qaInput,
+				Mode:     AnalysisModeText,
+				Options:  genOptions,
+				UseCache: cacheCfg.QA,
+				OnReasoning: func(chunk string) {
+					if cb.OnRoleReasoning != nil {
+						cb.OnRoleReasoning(assistantMessageID, role.ID, role.Name, chunk)
+					}
+				},
+			}, nil, func(chunk string) {
 				if cb.OnRoleChunk != nil {
 					cb.OnRoleChunk(assistantMessageID, role.ID, role.Name, chunk)
 				}
-			})
+			}, nil)
+			result := attempt.Result
+			cost, currency := ChannelCost(activeChannel, result.PromptTokens, result.CompletionTokens)
+			roleErr := roleCtx.Err()
 			cancelRole()
 			if err != nil {
-				if errors.Is(roleCtx.Err(), context.DeadlineExceeded) {
+				if errors.Is(roleErr, context.DeadlineExceeded) {
 					err = fmt.Errorf("角色回答超时（%d 秒）", int(qaRoleTimeout.Seconds()))
-				} else if errors.Is(roleCtx.Err(), context.Canceled) || errors.Is(err, context.Canceled) {
+				} else if errors.Is(roleErr, context.Canceled) || errors.Is(err, context.Canceled) {
 					err = errors.New("已取消本次提问")
 				}
 				errMsg := err.Error()
 				log.Printf("[QA] role failed session=%d role=%d(%s) message=%d err=%s", sessionID, role.ID, role.Name, assistantMessageID, errMsg)
-				_ = updateQAMessageFailure(assistantMessageID, errMsg)
-				_ = insertQARun(models.QARun{
-					SessionID:        sessionID,
-					MessageID:        assistantMessageID,
-					ArticleID:        articleID,
-					RoleID:           role.ID,
-					RoleName:         role.Name,
-					Success:          0,
-					ErrorReason:      classifyErrorReason(err),
-					DurationMs:       time.Since(startedAt).Milliseconds(),
-					PromptTokens:     result.PromptTokens,
-					CompletionTokens: result.CompletionTokens,
-					TotalTokens:      result.TotalTokens,
+				_ = s.updateQAMessageFailure(assistantMessageID, errMsg)
+				_ = s.insertQARun(models.QARun{
+					SessionID:         sessionID,
+					MessageID:         assistantMessageID,
+					ArticleID:         articleID,
+					RoleID:            role.ID,
+					RoleName:          role.Name,
+					Success:           0,
+					ErrorReason:       classifyErrorReason(err),
+					DurationMs:        time.Since(startedAt).Milliseconds(),
+					PromptTokens:      result.PromptTokens,
+					CompletionTokens:  result.CompletionTokens,
+					TotalTokens:       result.TotalTokens,
+					GenerationOptions: genOptions,
+					Cost:              cost,
+					Currency:          currency,
 				})
 				if cb.OnRoleError != nil {
 					cb.OnRoleError(assistantMessageID, role.ID, role.Name, errMsg)
@@ -355,26 +406,27 @@ func AskQuestionWithContextAndFollowUp(ctx context.Context, sessionID int64, art
 				return
 			}
 
-			_ = updateQAMessageSuccess(assistantMessageID, result)
-			_ = insertQARun(models.QARun{
-				SessionID:        sessionID,
-				MessageID:        assistantMessageID,
-				ArticleID:        articleID,
-				RoleID:           role.ID,
-				RoleName:         role.Name,
-				Success:          1,
-				ErrorReason:      "",
-				DurationMs:       result.DurationMs,
-				PromptTokens:     result.PromptTokens,
-				CompletionTokens: result.CompletionTokens,
-				TotalTokens:      result.TotalTokens,
+			_ = s.updateQAMessageSuccess(assistantMessageID, result)
+			_ = s.insertQARun(models.QARun{
+				SessionID:         sessionID,
+				MessageID:         assistantMessageID,
+				ArticleID:         articleID,
+				RoleID:            role.ID,
+				RoleName:          role.Name,
+				Success:           1,
+				ErrorReason:       "",
+				DurationMs:        result.DurationMs,
+				PromptTokens:      result.PromptTokens,
+				CompletionTokens:  result.CompletionTokens,
+				TotalTokens:       result.TotalTokens,
+				GenerationOptions: genOptions,
+				Cost:              cost,
+				Currency:          currency,
 			})
-			_ = saveEvidences(assistantMessageID, retrieved)
+			_ = s.saveEvidences(assistantMessageID, retrieved)
 			log.Printf("[QA] role done session=%d role=%d(%s) message=%d duration_ms=%d", sessionID, role.ID, role.Name, assistantMessageID, result.DurationMs)
 
-			ansMu.Lock()
-			answerSummaries = append(answerSummaries, fmt.Sprintf("A[%s]: %s", role.Name, trimToRunes(result.Text, 240)))
-			ansMu.Unlock()
+			answers[i] = qaRoleAnswer{RoleName: role.Name, Text: result.Text}
 
 			if cb.OnRoleDone != nil {
 				cb.OnRoleDone(models.QAMessage{
@@ -399,9 +451,33 @@ func AskQuestionWithContextAndFollowUp(ctx context.Context, sessionID int64, art
 	wg.Wait()
 	log.Printf("[QA] all roles done session=%d", sessionID)
 
+	answered := make([]qaRoleAnswer, 0, len(answers))
+	for _, ans := range answers {
+		if ans.RoleName != "" {
+			answered = append(answered, ans)
+		}
+	}
+	synthesis := ""
+	if len(answered) >= 2 && ctx.Err() == nil {
+		if modCfg, _ := s.GetQAModeratorConfig(); modCfg.Enabled == 1 {
+			question := models.QAMessage{ID: userMessageID, SessionID: sessionID, ArticleID: articleID, Content: cleanedQuestion}
+			synthesis = s.moderateQA(ctx, modCfg, channel, cacheCfg.QA, question, answered, cb)
+		}
+	}
+
+	// The summary carries the moderator's synthesis when there is one, the
+	// head of every answer otherwise.
 	if ctx.Err() == nil {
-		summaryPayload := fmt.Sprintf("Q: %s\n%s", trimToRunes(cleanedQuestion, 240), strings.Join(answerSummaries, "\n"))
-		_ = appendSessionSummary(sessionID, summaryPayload)
+		lines := make([]string, 0, len(answered))
+		if synthesis != "" {
+			lines = append(lines, fmt.Sprintf("综合: %s", trimToRunes(synthesis, 480)))
+		} else {
+			for _, ans := range answered {
+				lines = append(lines, fmt.Sprintf("A[%s]: %s", ans.RoleName, trimToRunes(ans.Text, 240)))
+			}
+		}
+		summaryPayload := fmt.Sprintf("Q: %s\n%s", trimToRunes(cleanedQuestion, 240), strings.Join(lines, "\n"))
+		_ = s.appendSessionSummary(sessionID, summaryPayload)
 	}
 	if cb.OnJobDone != nil {
 		cb.OnJobDone(sessionID)
@@ -410,8 +486,8 @@ func AskQuestionWithContextAndFollowUp(ctx context.Context, sessionID int64, art
 	return userMessageID, nil
 }
 
-func getDefaultChannel() (models.AIChannel, error) {
-	channels, err := GetChannels()
+func (s *Service) getDefaultChannel() (models.AIChannel, error) {
+	channels, err := s.GetChannels()
 	if err != nil {
 		return models.AIChannel{}, err
 	}
@@ -426,12 +502,12 @@ func getDefaultChannel() (models.AIChannel, error) {
 	return channels[0], nil
 }
 
-func insertQAMessage(msg models.QAMessage) (int64, error) {
-	res, err := db.DB.Exec(`
+func (s *Service) insertQAMessage(msg models.QAMessage) (int64, error) {
+	res, err := s.db.Exec(`
 		INSERT INTO qa_messages(
 			session_id, article_id, parent_id, role_type, role_id, content, status, error_reason,
 			duration_ms, prompt_tokens, completion_tokens, total_tokens
-		) VALUES(?,?,?,?,?,?,?,?,?,?,?,?)
+		) VALUES(?,NULLIF(?, 0),?,?,?,?,?,?,?,?,?,?)
 	`,
 		msg.SessionID,
 		msg.ArticleID,
@@ -452,8 +528,8 @@ func insertQAMessage(msg models.QAMessage) (int64, error) {
 	return res.LastInsertId()
 }
 
-func updateQAMessageSuccess(messageID int64, result AnalysisResult) error {
-	_, err := db.DB.Exec(`
+func (s *Service) updateQAMessageSuccess(messageID int64, result AnalysisResult) error {
+	_, err := s.db.Exec(`
 		UPDATE qa_messages
 		SET content=?, status='done', error_reason='', duration_ms=?, prompt_tokens=?, completion_tokens=?, total_tokens=?
 		WHERE id=?
@@ -461,8 +537,8 @@ func updateQAMessageSuccess(messageID int64, result AnalysisResult) error {
 	return err
 }
 
-func updateQAMessageFailure(messageID int64, errMsg string) error {
-	_, err := db.DB.Exec(`
+func (s *Service) updateQAMessageFailure(messageID int64, errMsg string) error {
+	_, err := s.db.Exec(`
 		UPDATE qa_messages
 		SET status='failed', error_reason=?
 		WHERE id=?
@@ -470,28 +546,29 @@ func updateQAMessageFailure(messageID int64, errMsg string) error {
 	return err
 }
 
-func saveEvidences(messageID int64, chunks []articleChunk) error {
+func (s *Service) saveEvidences(messageID int64, chunks []articleChunk) error {
 	if len(chunks) == 0 {
 		return nil
 	}
 	for _, ch := range chunks {
 		quote := trimToRunes(ch.Text, 180)
-		if _, err := db.DB.Exec(`
-			INSERT INTO qa_evidences(message_id, chunk_index, quote, reason)
-			VALUES(?,?,?,?)
-		`, messageID, ch.Index, quote, "问题关键词命中"); err != nil {
+		if _, err := s.db.Exec(`
+			INSERT INTO qa_evidences(message_id, article_id, chunk_index, quote, reason, heading_path, page_start, page_end)
+			VALUES(?,NULLIF(?, 0),?,?,?,?,?,?)
+		`, messageID, ch.ArticleID, ch.Index, quote, trimToRunes(retrievalReason(ch), 255), ch.HeadingPath, ch.PageStart, ch.PageEnd); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
-func insertQARun(run models.QARun) error {
-	_, err := db.DB.Exec(`
+func (s *Service) insertQARun(run models.QARun) error {
+	_, err := s.db.Exec(`
 		INSERT INTO qa_runs(
 			session_id, message_id, article_id, role_id, role_name, success, error_reason,
-			duration_ms, prompt_tokens, completion_tokens, total_tokens
-		) VALUES(?,?,?,?,?,?,?,?,?,?,?)
+			duration_ms, prompt_tokens, completion_tokens, total_tokens, generation_options,
+			cost, currency
+		) VALUES(?,?,NULLIF(?, 0),?,?,?,?,?,?,?,?,?,?,?)
 	`,
 		run.SessionID,
 		run.MessageID,
@@ -504,13 +581,16 @@ func insertQARun(run models.QARun) error {
 		run.PromptTokens,
 		run.CompletionTokens,
 		run.TotalTokens,
+		run.GenerationOptions,
+		run.Cost,
+		run.Currency,
 	)
 	return err
 }
 
-func getSessionSummary(sessionID int64) (string, error) {
+func (s *Service) getSessionSummary(sessionID int64) (string, error) {
 	var summary sql.NullString
-	err := db.DB.Get(&summary, "SELECT summary FROM qa_sessions WHERE id=?", sessionID)
+	err := s.db.Get(&summary, "SELECT summary FROM qa_sessions WHERE id=?", sessionID)
 	if err != nil {
 		return "", err
 	}
@@ -520,11 +600,11 @@ func getSessionSummary(sessionID int64) (string, error) {
 	return summary.String, nil
 }
 
-func appendSessionSummary(sessionID int64, appendText string) error {
-	current, _ := getSessionSummary(sessionID)
+func (s *Service) appendSessionSummary(sessionID int64, appendText string) error {
+	current, _ := s.getSessionSummary(sessionID)
 	next := strings.TrimSpace(strings.TrimSpace(current) + "\n" + strings.TrimSpace(appendText))
 	next = tailRunes(next, 2000)
-	_, err := db.DB.Exec(`
+	_, err := s.db.Exec(`
 		UPDATE qa_sessions
 		SET summary=?, updated_at=CURRENT_TIMESTAMP
 		WHERE id=?
@@ -545,7 +625,10 @@ func buildQASystemPrompt(role models.Role) string {
 3) 结尾单独一行写“参考片段: x,y,z”（x/y/z 为片段编号）。`
 }
 
-func buildQAInput(summary string, pins []models.QAPin, followUpContext string, question string, chunks []articleChunk) string {
+// buildQAInput numbers the sections by their index in the article; across
+// the articles of a scoped session they are numbered in order instead and
+// labelled with their article's title.
+func buildQAInput(summary string, pins []models.QAPin, followUpContext string, question string, chunks []articleChunk, scoped bool) string {
 	var b strings.Builder
 	if strings.TrimSpace(summary) != "" {
 		b.WriteString("会话摘要:\n")
@@ -564,21 +647,33 @@ func buildQAInput(summary string, pins []models.QAPin, followUpContext string, q
 		b.WriteString(followUpContext)
 		b.WriteString("\n\n")
 	}
-	b.WriteString("报告相关片段:\n")
-	for _, ch := range chunks {
-		b.WriteString(fmt.Sprintf("[%d] %s\n", ch.Index, ch.Text))
+	if scoped {
+		b.WriteString("多篇报告相关片段:\n")
+	} else {
+		b.WriteString("报告相关片段:\n")
+	}
+	for i, ch := range chunks {
+		label := fmt.Sprintf("[%d]", ch.Index)
+		if scoped {
+			label = fmt.Sprintf("[%d] 《%s》", i+1, ch.ArticleTitle)
+		}
+		if loc := chunkLocation(ch.PageStart, ch.PageEnd, ch.HeadingPath); loc != "" {
+			b.WriteString(fmt.Sprintf("%s (%s)\n%s\n", label, loc, ch.Text))
+		} else {
+			b.WriteString(fmt.Sprintf("%s %s\n", label, ch.Text))
+		}
 	}
 	b.WriteString("\n用户问题:\n")
 	b.WriteString(question)
 	return b.String()
 }
 
-func buildFollowUpContext(sessionID int64, articleID int64, followUpMessageID int64) (string, error) {
+func (s *Service) buildFollowUpContext(sessionID int64, articleID int64, followUpMessageID int64) (string, error) {
 	var msg models.QAMessage
-	if err := db.DB.Get(&msg, `
-		SELECT m.*
+	if err := s.db.Get(&msg, `
+		SELECT `+qaMessageColumns+`
 		FROM qa_messages m
-		WHERE m.id=? AND m.session_id=? AND m.article_id=? AND m.role_type='assistant'
+		WHERE m.id=? AND m.session_id=? AND COALESCE(m.article_id, 0)=? AND m.role_type IN ('assistant', 'moderator')
 	`, followUpMessageID, sessionID, articleID); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return "", errors.New("未找到可继续追问的回答")
@@ -587,11 +682,12 @@ func buildFollowUpContext(sessionID int64, articleID int64, followUpMessageID in
 	}
 
 	var evidences []models.QAEvidence
-	if err := db.DB.Select(&evidences, `
-		SELECT *
-		FROM qa_evidences
-		WHERE message_id=?
-		ORDER BY id ASC
+	if err := s.db.Select(&evidences, `
+		SELECT `+qaEvidenceColumns+`
+		FROM qa_evidences e
+		LEFT JOIN articles a ON a.id = e.article_id
+		WHERE e.message_id=?
+		ORDER BY e.id ASC
 		LIMIT 4
 	`, followUpMessageID); err != nil {
 		return "", err
@@ -603,16 +699,26 @@ func buildFollowUpContext(sessionID int64, articleID int64, followUpMessageID in
 	if len(evidences) > 0 {
 		b.WriteString("\n\n上轮回答引用片段:\n")
 		for _, ev := range evidences {
-			b.WriteString(fmt.Sprintf("[%d] %s\n", ev.ChunkIndex, trimToRunes(ev.Quote, 180)))
+			if articleID == 0 && ev.ArticleTitle != "" {
+				b.WriteString(fmt.Sprintf("《%s》", ev.ArticleTitle))
+			}
+			// Evidence merged from a deleted duplicate may point at no section.
+			if ev.ChunkIndex > 0 {
+				b.WriteString(fmt.Sprintf("[%d] ", ev.ChunkIndex))
+			}
+			if loc := chunkLocation(ev.PageStart, ev.PageEnd, ev.HeadingPath); loc != "" {
+				b.WriteString(fmt.Sprintf("(%s) ", loc))
+			}
+			b.WriteString(trimToRunes(ev.Quote, 180) + "\n")
 		}
 	}
 	return strings.TrimSpace(b.String()), nil
 }
 
-func getSessionPins(sessionID int64) ([]models.QAPin, error) {
+func (s *Service) getSessionPins(sessionID int64) ([]models.QAPin, error) {
 	var pins []models.QAPin
-	err := db.DB.Select(&pins, `
-		SELECT *
+	err := s.db.Select(&pins, `
+		SELECT `+qaPinColumns+`
 		FROM qa_pins
 		WHERE session_id=?
 		ORDER BY id DESC
@@ -620,112 +726,6 @@ func getSessionPins(sessionID int64) ([]models.QAPin, error) {
 	return pins, err
 }
 
-func buildArticleChunks(content string, maxLen int) []articleChunk {
-	if maxLen <= 0 {
-		maxLen = 900
-	}
-	content = strings.ReplaceAll(content, "\r\n", "\n")
-	parts := strings.Split(content, "\n")
-
-	chunks := make([]articleChunk, 0)
-	var current strings.Builder
-	index := 1
-	flush := func() {
-		text := strings.TrimSpace(current.String())
-		if text == "" {
-			return
-		}
-		chunks = append(chunks, articleChunk{Index: index, Text: text})
-		index++
-		current.Reset()
-	}
-
-	for _, p := range parts {
-		p = strings.TrimSpace(p)
-		if p == "" {
-			continue
-		}
-		if current.Len() > 0 && utf8.RuneCountInString(current.String()+"\n"+p) > maxLen {
-			flush()
-		}
-		if current.Len() > 0 {
-			current.WriteString("\n")
-		}
-		current.WriteString(p)
-	}
-	flush()
-
-	if len(chunks) == 0 && strings.TrimSpace(content) != "" {
-		chunks = append(chunks, articleChunk{Index: 1, Text: trimToRunes(strings.TrimSpace(content), maxLen)})
-	}
-	return chunks
-}
-
-func retrieveTopChunks(question string, chunks []articleChunk, k int) []articleChunk {
-	if len(chunks) == 0 {
-		return nil
-	}
-	if k <= 0 {
-		k = 6
-	}
-	if k > len(chunks) {
-		k = len(chunks)
-	}
-
-	terms := extractKeywords(question)
-	for i := range chunks {
-		score := 0
-		textLower := strings.ToLower(chunks[i].Text)
-		for _, t := range terms {
-			score += strings.Count(textLower, t)
-		}
-		chunks[i].Score = score
-	}
-
-	sorted := make([]articleChunk, len(chunks))
-	copy(sorted, chunks)
-	sort.SliceStable(sorted, func(i, j int) bool {
-		if sorted[i].Score == sorted[j].Score {
-			return sorted[i].Index < sorted[j].Index
-		}
-		return sorted[i].Score > sorted[j].Score
-	})
-
-	if sorted[0].Score <= 0 {
-		return sorted[:k]
-	}
-	selected := sorted[:k]
-	sort.Slice(selected, func(i, j int) bool {
-		return selected[i].Index < selected[j].Index
-	})
-	return selected
-}
-
-func extractKeywords(question string) []string {
-	question = strings.ToLower(question)
-	matches := keywordPattern.FindAllString(question, -1)
-	if len(matches) == 0 {
-		return []string{question}
-	}
-	seen := make(map[string]struct{})
-	keywords := make([]string, 0, len(matches))
-	for _, m := range matches {
-		m = strings.TrimSpace(m)
-		if utf8.RuneCountInString(m) < 2 {
-			continue
-		}
-		if _, ok := seen[m]; ok {
-			continue
-		}
-		seen[m] = struct{}{}
-		keywords = append(keywords, m)
-	}
-	if len(keywords) == 0 {
-		return []string{question}
-	}
-	return keywords
-}
-
 func trimToRunes(s string, limit int) string {
 	s = strings.TrimSpace(s)
 	if limit <= 0 {
@@ -779,7 +779,7 @@ func classifyErrorReason(err error) string {
 	}
 }
 
-func GetQADashboardByDays(days int) (models.QADashboard, error) {
+func (s *Service) GetQADashboardByDays(days int) (models.QADashboard, error) {
 	dashboard := models.QADashboard{}
 	if days < 0 {
 		days = 0
@@ -795,7 +795,7 @@ func GetQADashboardByDays(days int) (models.QADashboard, error) {
 		PromptTokens  sql.NullInt64 `db:"prompt_tokens"`
 		OutputTokens  sql.NullInt64 `db:"output_tokens"`
 	}{}
-	if err := db.DB.Get(&totals, fmt.Sprintf(`
+	if err := s.db.Get(&totals, fmt.Sprintf(`
 		SELECT
 			COUNT(*) AS total_runs,
 			SUM(CASE WHEN success = 1 THEN 1 ELSE 0 END) AS success_runs,
@@ -830,7 +830,7 @@ func GetQADashboardByDays(days int) (models.QADashboard, error) {
 		PromptTokens sql.NullInt64 `db:"prompt_tokens"`
 		OutputTokens sql.NullInt64 `db:"output_tokens"`
 	}{}
-	if err := db.DB.Select(&roleRows, fmt.Sprintf(`
+	if err := s.db.Select(&roleRows, fmt.Sprintf(`
 		SELECT
 			role_id,
 			role_name,
@@ -872,7 +872,7 @@ func GetQADashboardByDays(days int) (models.QADashboard, error) {
 		Reason string `db:"reason"`
 		Count  int64  `db:"count"`
 	}{}
-	if err := db.DB.Select(&reasonRows, fmt.Sprintf(`
+	if err := s.db.Select(&reasonRows, fmt.Sprintf(`
 		SELECT error_reason AS reason, COUNT(*) AS count
 		FROM qa_runs
 		%s
@@ -888,5 +888,16 @@ func GetQADashboardByDays(days int) (models.QADashboard, error) {
 		dashboard.FailureTop = append(dashboard.FailureTop, models.FailureReasonMetric{Reason: row.Reason, Count: int(row.Count)})
 	}
 
+	var err error
+	if dashboard.Costs, err = s.costBreakdown("qa_runs", "", days); err != nil {
+		return dashboard, err
+	}
+	if dashboard.CostByDay, err = s.costBreakdown("qa_runs", costByDay, days); err != nil {
+		return dashboard, err
+	}
+	if dashboard.CostByRole, err = s.costBreakdown("qa_runs", costByRole, days); err != nil {
+		return dashboard, err
+	}
+
 	return dashboard, nil
 }
@@ -0,0 +1,242 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"stock-report-analysis/internal/models"
+)
+
+const qaModeratorConfigKey = "qa_moderator_config_v1"
+
+// qaModeratorAnswerRunes caps each role answer handed to the moderator.
+const qaModeratorAnswerRunes = 3000
+
+const defaultQAModeratorPrompt = `你是本轮讨论的主持人。多位分析师角色已分别回答同一个问题，请通读全部回答后给出综合意见。要求：
+1) 先写“共识”：各角色一致的结论。
+2) 再写“分歧”：观点不同之处，注明持各方观点的角色及其理由。
+3) 最后写“综合判断”，并列出仍需核实的信息。
+4) 只依据各角色的回答，不得引入新的事实；输出纯文本，不要 JSON。`
+
+// qaRoleAnswer is a role's successful answer, handed to the moderator.
+type qaRoleAnswer struct {
+	RoleName string
+	Text     string
+}
+
+func defaultQAModeratorConfig() models.QAModeratorConfig {
+	return models.QAModeratorConfig{Enabled: 0}
+}
+
+func normalizeQAModeratorConfig(cfg models.QAModeratorConfig) models.QAModeratorConfig {
+	if cfg.Enabled != 1 {
+		cfg.Enabled = 0
+	}
+	if cfg.RoleID < 0 {
+		cfg.RoleID = 0
+	}
+	cfg.Prompt = trimToRunes(strings.TrimSpace(cfg.Prompt), 2000)
+	return cfg
+}
+
+func (s *Service) GetQAModeratorConfig() (models.QAModeratorConfig, error) {
+	cfg := defaultQAModeratorConfig()
+
+	var raw string
+	err := s.db.Get(&raw, "SELECT value FROM app_configs WHERE key=?", qaModeratorConfigKey)
+	if errors.Is(err, sql.ErrNoRows) {
+		return cfg, nil
+	}
+	if err != nil {
+		return cfg, err
+	}
+
+	var stored models.QAModeratorConfig
+	if json.Unmarshal([]byte(raw), &stored) != nil {
+		return cfg, nil
+	}
+	return normalizeQAModeratorConfig(stored), nil
+}
+
+func (s *Service) SaveQAModeratorConfig(cfg models.QAModeratorConfig) error {
+	cfg = normalizeQAModeratorConfig(cfg)
+	if cfg.RoleID > 0 {
+		var enabled int
+		err := s.db.Get(&enabled, "SELECT enabled FROM roles WHERE id=?", cfg.RoleID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return errors.New("角色不存在")
+		}
+		if err != nil {
+			return err
+		}
+		if enabled != 1 {
+			return errors.New("主持角色未启用")
+		}
+	}
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(`
+		INSERT INTO app_configs(key, value, updated_at)
+		VALUES(?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT(key) DO UPDATE SET value=excluded.value, updated_at=CURRENT_TIMESTAMP
+	`, qaModeratorConfigKey, string(data))
+	return err
+}
+
+// qaModeratorRole returns the role that moderates: the configured one, or
+// the default role when none is set or it has been disabled or deleted.
+func (s *Service) qaModeratorRole(cfg models.QAModeratorConfig) (models.Role, error) {
+	if cfg.RoleID > 0 {
+		var role models.Role
+		err := s.db.Get(&role, "SELECT * FROM roles WHERE id=? AND enabled=1", cfg.RoleID)
+		if err == nil {
+			return role, nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return role, err
+		}
+		log.Printf("[QA] moderator role %d unavailable, using the default role", cfg.RoleID)
+	}
+	role, err := s.GetDefaultRole()
+	if errors.Is(err, sql.ErrNoRows) {
+		return role, errors.New("没有可用的主持角色")
+	}
+	return role, err
+}
+
+func buildQAModeratorPrompt(role models.Role, cfg models.QAModeratorConfig) string {
+	base := strings.TrimSpace(role.SystemPrompt)
+	if base == "" {
+		base = fallbackRolePrompt
+	}
+	return base + "\n\n" + coalesceString(cfg.Prompt, defaultQAModeratorPrompt)
+}
+
+func buildQAModeratorInput(question string, answers []qaRoleAnswer) string {
+	var b strings.Builder
+	b.WriteString("用户问题:\n")
+	b.WriteString(question)
+	b.WriteString("\n\n各角色回答:\n")
+	for _, ans := range answers {
+		b.WriteString(fmt.Sprintf("【%s】\n%s\n\n", ans.RoleName, trimToRunes(strings.TrimSpace(ans.Text), qaModeratorAnswerRunes)))
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// moderateQA writes the synthesis of answers as a moderator message that
+// replies to question, the user message. It returns the synthesis, or ""
+// when the moderator failed; failures are reported through cb and recorded
+// like those of a role.
+func (s *Service) moderateQA(ctx context.Context, cfg models.QAModeratorConfig, channel models.AIChannel, useCache bool, question models.QAMessage, answers []qaRoleAnswer, cb QAStreamCallbacks) string {
+	sessionID, articleID := question.SessionID, question.ArticleID
+	role, err := s.qaModeratorRole(cfg)
+	if err != nil {
+		log.Printf("[QA] moderator skipped session=%d err=%v", sessionID, err)
+		if cb.OnModeratorError != nil {
+			cb.OnModeratorError(0, err.Error())
+		}
+		return ""
+	}
+	runName := role.Name + "（主持）"
+
+	messageID, err := s.insertQAMessage(models.QAMessage{
+		SessionID: sessionID,
+		ArticleID: articleID,
+		RoleType:  "moderator",
+		RoleID:    role.ID,
+		Status:    "running",
+		ParentID:  question.ID,
+	})
+	if err != nil {
+		if cb.OnModeratorError != nil {
+			cb.OnModeratorError(0, err.Error())
+		}
+		return ""
+	}
+	msg := models.QAMessage{ID: messageID, SessionID: sessionID, ArticleID: articleID, ParentID: question.ID, RoleType: "moderator", RoleID: role.ID, RoleName: role.Name, Status: "running"}
+	if cb.OnModeratorStart != nil {
+		cb.OnModeratorStart(msg)
+	}
+	log.Printf("[QA] moderator begin session=%d role=%d(%s) answers=%d", sessionID, role.ID, role.Name, len(answers))
+
+	activeChannel := channel
+	if role.ModelOverride != "" {
+		activeChannel.Model = role.ModelOverride
+	}
+	genOptions := role.GenerationOptions
+	startedAt := time.Now()
+	modCtx, cancel := context.WithTimeout(ctx, qaRoleTimeout)
+	attempt, err := s.AnalyzeWithFailover(modCtx, AnalysisRequest{
+		Channel:  activeChannel,
+		Prompt:   buildQAModeratorPrompt(role, cfg),
+		Content:  buildQAModeratorInput(question.Content, answers),
+		Mode:     AnalysisModeText,
+		Options:  genOptions,
+		UseCache: useCache,
+	}, nil, func(chunk string) {
+		if cb.OnModeratorChunk != nil {
+			cb.OnModeratorChunk(messageID, chunk)
+		}
+	}, nil)
+	result := attempt.Result
+	cost, currency := ChannelCost(activeChannel, result.PromptTokens, result.CompletionTokens)
+	modErr := modCtx.Err()
+	cancel()
+
+	run := models.QARun{
+		SessionID:         sessionID,
+		MessageID:         messageID,
+		ArticleID:         articleID,
+		RoleID:            role.ID,
+		RoleName:          runName,
+		Success:           1,
+		DurationMs:        result.DurationMs,
+		PromptTokens:      result.PromptTokens,
+		CompletionTokens:  result.CompletionTokens,
+		TotalTokens:       result.TotalTokens,
+		GenerationOptions: genOptions,
+		Cost:              cost,
+		Currency:          currency,
+	}
+	if err != nil {
+		if errors.Is(modErr, context.DeadlineExceeded) {
+			err = fmt.Errorf("主持综合超时（%d 秒）", int(qaRoleTimeout.Seconds()))
+		} else if errors.Is(modErr, context.Canceled) || errors.Is(err, context.Canceled) {
+			err = errors.New("已取消本次提问")
+		}
+		errMsg := err.Error()
+		log.Printf("[QA] moderator failed session=%d message=%d err=%s", sessionID, messageID, errMsg)
+		_ = s.updateQAMessageFailure(messageID, errMsg)
+		run.Success = 0
+		run.ErrorReason = classifyErrorReason(err)
+		run.DurationMs = time.Since(startedAt).Milliseconds()
+		_ = s.insertQARun(run)
+		if cb.OnModeratorError != nil {
+			cb.OnModeratorError(messageID, errMsg)
+		}
+		return ""
+	}
+
+	_ = s.updateQAMessageSuccess(messageID, result)
+	_ = s.insertQARun(run)
+	log.Printf("[QA] moderator done session=%d message=%d duration_ms=%d", sessionID, messageID, result.DurationMs)
+
+	if cb.OnModeratorDone != nil {
+		msg.Content = result.Text
+		msg.Status = "done"
+		msg.DurationMs = result.DurationMs
+		msg.PromptTokens = result.PromptTokens
+		msg.CompletionTokens = result.CompletionTokens
+		msg.TotalTokens = result.TotalTokens
+		cb.OnModeratorDone(msg)
+	}
+	return result.Text
+}
@@ -0,0 +1,91 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"stock-report-analysis/internal/llmtest"
+	"stock-report-analysis/internal/models"
+)
+
+func TestModeratorSynthesizesMultiRoleAnswers(t *testing.T) {
+	svc := newTestService(t)
+	srv := llmtest.New(t)
+	saveDefaultChannel(t, svc, srv)
+	articleID := insertTestArticle(t, svc, "年报点评", "公司全年营收增长 20%，但应收账款大幅增加。")
+	for _, role := range []models.Role{
+		{Name: "多头", SystemPrompt: "你只看机会。", Enabled: 1},
+		{Name: "空头", SystemPrompt: "你只看风险。", Enabled: 1},
+	} {
+		if err := svc.SaveRole(role); err != nil {
+			t.Fatalf("save role: %v", err)
+		}
+	}
+	srv.Handle(func(req llmtest.Request) (llmtest.Reply, bool) {
+		switch system := req.System(); {
+		case strings.Contains(system, "主持人"):
+			return llmtest.Stream("共识：营收增长。", "分歧：应收账款。"), true
+		case strings.Contains(system, "只看机会"):
+			return llmtest.Text("营收增长 20%，看多"), true
+		case strings.Contains(system, "只看风险"):
+			return llmtest.Text("应收账款高企，看空"), true
+		}
+		return llmtest.Reply{}, false
+	})
+
+	if err := svc.SaveQAModeratorConfig(models.QAModeratorConfig{Enabled: 1, RoleID: 999}); err == nil {
+		t.Fatal("saved a moderator role that does not exist")
+	}
+	if err := svc.SaveQAModeratorConfig(models.QAModeratorConfig{Enabled: 1}); err != nil {
+		t.Fatalf("save config: %v", err)
+	}
+
+	rec := &qaRecorder{}
+	userMessageID, err := svc.AskQuestionWithContextAndFollowUp(context.Background(), 0, articleID, "@多头 @空头 前景如何？", 0, rec.callbacks())
+	if err != nil {
+		t.Fatalf("ask: %v", err)
+	}
+	if len(rec.done) != 2 || len(rec.moderated) != 1 || len(rec.moderatorErr) != 0 || !rec.jobDone {
+		t.Fatalf("done = %+v, moderated = %+v, errs = %v", rec.done, rec.moderated, rec.moderatorErr)
+	}
+	if rec.moderator.String() != "共识：营收增长。分歧：应收账款。" {
+		t.Errorf("moderator streamed %q", rec.moderator.String())
+	}
+
+	requests := srv.Requests()
+	input := requests[len(requests)-1].User()
+	if !strings.Contains(input, "【多头】\n营收增长 20%，看多") || !strings.Contains(input, "【空头】\n应收账款高企，看空") || strings.Index(input, "【多头】") > strings.Index(input, "【空头】") {
+		t.Errorf("moderator input = %q", input)
+	}
+
+	messages, err := svc.GetQAMessages(rec.sessionID)
+	if err != nil || len(messages) != 4 {
+		t.Fatalf("messages = %+v, err = %v", messages, err)
+	}
+	last := messages[3]
+	if last.RoleType != "moderator" || last.ParentID != userMessageID || last.Status != "done" || last.RoleName != fallbackRoleName || last.ID != rec.moderated[0].ID {
+		t.Errorf("moderator message = %+v", last)
+	}
+	summary, _ := svc.getSessionSummary(rec.sessionID)
+	if !strings.Contains(summary, "综合: 共识") || strings.Contains(summary, "A[多头]") {
+		t.Errorf("summary = %q", summary)
+	}
+	var runName string
+	if err := svc.db.Get(&runName, "SELECT role_name FROM qa_runs WHERE message_id=?", last.ID); err != nil || runName != fallbackRoleName+"（主持）" {
+		t.Errorf("moderator run = %q, err = %v", runName, err)
+	}
+
+	// The synthesis can be followed up; a single role is not moderated.
+	follow := &qaRecorder{}
+	if _, err := svc.AskQuestionWithContextAndFollowUp(context.Background(), rec.sessionID, articleID, "@多头 分歧怎么看？", last.ID, follow.callbacks()); err != nil {
+		t.Fatalf("follow up: %v", err)
+	}
+	requests = srv.Requests()
+	if user := requests[len(requests)-1].User(); !strings.Contains(user, "分歧：应收账款") {
+		t.Errorf("follow up input = %q", user)
+	}
+	if len(follow.done) != 1 || len(follow.moderated) != 0 {
+		t.Errorf("follow up done = %+v, moderated = %+v", follow.done, follow.moderated)
+	}
+}
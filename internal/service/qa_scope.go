@@ -0,0 +1,164 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"stock-report-analysis/internal/models"
+)
+
+const (
+	// qaScopeMaxArticles caps the articles a scoped session retrieves from;
+	// the newest are kept.
+	qaScopeMaxArticles = 200
+	// qaScopeChunkCount is how many sections a scoped question is answered
+	// from, more than for one article since they come from several.
+	qaScopeChunkCount = 10
+)
+
+func normalizeQAScope(scope models.QAScope) models.QAScope {
+	var ids []int64
+	for _, id := range uniqueInt64s(scope.ArticleIDs) {
+		if id > 0 {
+			ids = append(ids, id)
+		}
+	}
+	scope.ArticleIDs = ids
+	if len(scope.TagIDs) > 0 {
+		scope.TagIDs = uniqueInt64s(scope.TagIDs)
+	}
+	scope.Keyword = strings.TrimSpace(scope.Keyword)
+	scope.DateFrom = strings.TrimSpace(scope.DateFrom)
+	scope.DateTo = strings.TrimSpace(scope.DateTo)
+	scope.WatchStock = strings.TrimSpace(scope.WatchStock)
+	if scope.Limit < 0 || scope.Limit > qaScopeMaxArticles {
+		scope.Limit = 0
+	}
+	return scope
+}
+
+// ResolveQAScope returns the articles a scope currently selects, newest
+// first. WatchStock matches the code or the name of the watchlist stock a
+// telegraph hit.
+func (s *Service) ResolveQAScope(scope models.QAScope) ([]models.QAScopeArticle, error) {
+	scope = normalizeQAScope(scope)
+	if scope.IsZero() {
+		return nil, errors.New("请至少设置一个问答范围条件")
+	}
+	b, err := newArticleListQuery("articles a", models.ArticleQuery{
+		Keyword:     scope.Keyword,
+		TagIDs:      scope.TagIDs,
+		CreatedFrom: scope.DateFrom,
+		CreatedTo:   scope.DateTo,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(scope.ArticleIDs) > 0 {
+		args := make([]any, 0, len(scope.ArticleIDs))
+		for _, id := range scope.ArticleIDs {
+			args = append(args, id)
+		}
+		b.add(fmt.Sprintf("a.id IN (%s)", placeholders(len(args))), args...)
+	}
+	switch {
+	case scope.WatchStock != "":
+		b.add("a.source LIKE ?", telegraphSourcePrefixLike)
+		b.add(`EXISTS (
+			SELECT 1 FROM telegraph_watch_hits h
+			WHERE h.article_id = a.id AND (h.stock_code = ? OR h.stock_name = ?)
+		)`, scope.WatchStock, scope.WatchStock)
+	case len(scope.ArticleIDs) == 0:
+		b.add("a.source NOT LIKE ?", telegraphSourcePrefixLike)
+	}
+	b.sortBy("", false)
+
+	limit := scope.Limit
+	if limit == 0 {
+		limit = qaScopeMaxArticles
+	}
+	var articles []models.QAScopeArticle
+	if err := b.selectPage(s, &articles, "a.id, a.title, a.source, a.created_at", "", limit); err != nil {
+		return nil, err
+	}
+	if len(articles) > limit {
+		articles = articles[:limit]
+	}
+	if articles == nil {
+		articles = []models.QAScopeArticle{}
+	}
+	return articles, nil
+}
+
+// CreateScopedQASession creates a session that asks across the articles
+// of scope. A scope that selects nothing is refused.
+func (s *Service) CreateScopedQASession(scope models.QAScope, title string) (models.QASession, error) {
+	scope = normalizeQAScope(scope)
+	articles, err := s.ResolveQAScope(scope)
+	if err != nil {
+		return models.QASession{}, err
+	}
+	if len(articles) == 0 {
+		return models.QASession{}, errors.New("问答范围内没有文章")
+	}
+	title = strings.TrimSpace(title)
+	if title == "" {
+		title = "跨文章问答"
+	}
+	res, err := s.db.Exec(`
+		INSERT INTO qa_sessions(scope, title, summary)
+		VALUES(?,?,?)
+	`, scope, trimToRunes(title, 64), "")
+	if err != nil {
+		return models.QASession{}, err
+	}
+	id, _ := res.LastInsertId()
+	return s.getQASession(id)
+}
+
+// GetScopedQASessions lists the sessions that ask across articles.
+func (s *Service) GetScopedQASessions() ([]models.QASession, error) {
+	var sessions []models.QASession
+	err := s.db.Select(&sessions, `
+		SELECT `+qaSessionColumns+`
+		FROM qa_sessions
+		WHERE article_id IS NULL
+		ORDER BY updated_at DESC, id DESC
+	`)
+	return sessions, err
+}
+
+// sessionChunks loads the sections a question retrieves from: those of the
+// session's article, or of every article its scope resolves to when
+// articleID is 0.
+func (s *Service) sessionChunks(articleID int64, scope models.QAScope) ([]articleChunk, error) {
+	ids := []int64{articleID}
+	if articleID == 0 {
+		articles, err := s.ResolveQAScope(scope)
+		if err != nil {
+			return nil, err
+		}
+		if len(articles) == 0 {
+			return nil, errors.New("问答范围内没有文章")
+		}
+		ids = ids[:0]
+		for _, a := range articles {
+			ids = append(ids, a.ID)
+		}
+	}
+
+	var chunks []articleChunk
+	for _, id := range ids {
+		article, err := s.GetArticle(id)
+		if err != nil {
+			return nil, err
+		}
+		part, err := s.articleChunks(article)
+		if err != nil {
+			return nil, err
+		}
+		chunks = append(chunks, part...)
+	}
+	return chunks, nil
+}
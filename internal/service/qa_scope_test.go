@@ -0,0 +1,134 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"stock-report-analysis/internal/llmtest"
+	"stock-report-analysis/internal/models"
+)
+
+func TestResolveQAScope(t *testing.T) {
+	svc := newTestService(t)
+	catl1 := insertTestArticle(t, svc, "宁德时代深度", "海外产能稳步推进。")
+	catl2 := insertTestArticle(t, svc, "宁德时代点评", "匈牙利工厂投产。")
+	other := insertTestArticle(t, svc, "比亚迪点评", "销量创新高。")
+	svc.db.MustExec("INSERT INTO tags(name) VALUES('电池')")
+	svc.db.MustExec("INSERT INTO article_tags(article_id, tag_id) VALUES(?, 1), (?, 1)", catl1, catl2)
+	svc.db.MustExec("UPDATE articles SET created_at='2024-01-05 10:00:00' WHERE id=?", catl1)
+	res := svc.db.MustExec("INSERT INTO articles(title, content, source) VALUES('快讯', '宁德时代盘中拉升。', 'cls-telegraph:1')")
+	telegraph, _ := res.LastInsertId()
+	svc.db.MustExec("INSERT INTO telegraph_watch_hits(article_id, stock_code, stock_name, match_type) VALUES(?, '300750', '宁德时代', 'name')", telegraph)
+
+	ids := func(scope models.QAScope) []int64 {
+		t.Helper()
+		articles, err := svc.ResolveQAScope(scope)
+		if err != nil {
+			t.Fatalf("resolve %+v: %v", scope, err)
+		}
+		var out []int64
+		for _, a := range articles {
+			out = append(out, a.ID)
+		}
+		return out
+	}
+	for _, tc := range []struct {
+		name  string
+		scope models.QAScope
+		want  []int64
+	}{
+		{"tag", models.QAScope{TagIDs: []int64{1}}, []int64{catl2, catl1}},
+		{"date range", models.QAScope{TagIDs: []int64{1}, DateFrom: "2024-01-01", DateTo: "2024-01-31"}, []int64{catl1}},
+		{"newest", models.QAScope{Limit: 2}, []int64{other, catl2}},
+		{"explicit ids", models.QAScope{ArticleIDs: []int64{catl1, other, catl1}}, []int64{other, catl1}},
+		{"watch stock", models.QAScope{WatchStock: "300750"}, []int64{telegraph}},
+		{"watch stock name", models.QAScope{WatchStock: "宁德时代"}, []int64{telegraph}},
+	} {
+		if got := ids(tc.scope); len(got) != len(tc.want) || (len(got) > 0 && got[0] != tc.want[0]) || got[len(got)-1] != tc.want[len(tc.want)-1] {
+			t.Errorf("%s: got %v, want %v", tc.name, got, tc.want)
+		}
+	}
+
+	if _, err := svc.ResolveQAScope(models.QAScope{}); err == nil {
+		t.Error("empty scope resolved")
+	}
+	if _, err := svc.ResolveQAScope(models.QAScope{DateFrom: "2024/01/01"}); err == nil {
+		t.Error("bad date resolved")
+	}
+	if _, err := svc.CreateScopedQASession(models.QAScope{WatchStock: "600000"}, ""); err == nil {
+		t.Error("session created for a scope without articles")
+	}
+}
+
+func TestAskScopedQuestionCitesEachArticle(t *testing.T) {
+	svc := newTestService(t)
+	srv := llmtest.New(t)
+	saveDefaultChannel(t, svc, srv)
+	a := insertTestArticle(t, svc, "宁德时代深度", "## 海外产能\n匈牙利工厂一期投产，海外产能占比提升。\n\n## 风险提示\n原材料价格波动。")
+	b := insertTestArticle(t, svc, "宁德时代点评", "## 出海进展\n西班牙合资工厂规划海外产能 50GWh。")
+	insertTestArticle(t, svc, "比亚迪点评", "## 销量\n月销量创新高。")
+
+	session, err := svc.CreateScopedQASession(models.QAScope{ArticleIDs: []int64{a, b}}, "")
+	if err != nil {
+		t.Fatalf("create session: %v", err)
+	}
+	if session.ArticleID != 0 || len(session.Scope.ArticleIDs) != 2 || session.Title != "跨文章问答" {
+		t.Fatalf("session = %+v", session)
+	}
+
+	srv.Enqueue(llmtest.Text("匈牙利与西班牙工厂"))
+	rec := &qaRecorder{}
+	if _, err := svc.AskQuestionWithContextAndFollowUp(context.Background(), session.ID, 0, "海外产能进展如何", 0, rec.callbacks()); err != nil {
+		t.Fatalf("ask: %v", err)
+	}
+	if len(rec.done) != 1 || len(rec.errs) != 0 {
+		t.Fatalf("done = %+v, errs = %v", rec.done, rec.errs)
+	}
+	user := srv.Requests()[0].User()
+	if !strings.Contains(user, "《宁德时代深度》") || !strings.Contains(user, "《宁德时代点评》") || strings.Contains(user, "比亚迪") {
+		t.Errorf("qa input = %q", user)
+	}
+
+	messages, err := svc.GetQAMessages(session.ID)
+	if err != nil || len(messages) != 2 || messages[0].ArticleID != 0 {
+		t.Fatalf("messages = %+v, err = %v", messages, err)
+	}
+	cited := map[int64]string{}
+	for _, ev := range messages[1].Evidences {
+		cited[ev.ArticleID] = ev.ArticleTitle
+	}
+	if cited[a] != "宁德时代深度" || cited[b] != "宁德时代点评" {
+		t.Errorf("evidences = %+v", messages[1].Evidences)
+	}
+
+	// Follow-ups, pins and search work without an article.
+	srv.Enqueue(llmtest.Text("50GWh"))
+	if _, err := svc.AskQuestionWithContextAndFollowUp(context.Background(), session.ID, 0, "西班牙规划多少", messages[1].ID, (&qaRecorder{}).callbacks()); err != nil {
+		t.Fatalf("follow up: %v", err)
+	}
+	if user := srv.Requests()[1].User(); !strings.Contains(user, "上轮回答引用片段") || !strings.Contains(user, "《宁德时代") {
+		t.Errorf("follow up input = %q", user)
+	}
+	pin, err := svc.SaveQAPin(models.QAPin{SessionID: session.ID, Content: "关注海外产能"})
+	if err != nil || pin.ArticleID != 0 {
+		t.Errorf("pin = %+v, err = %v", pin, err)
+	}
+	hits, err := svc.SearchFullText("西班牙规划", SearchScopeQA, 0)
+	if err != nil || len(hits) != 1 || hits[0].SessionID != session.ID || hits[0].ArticleID != 0 {
+		t.Errorf("hits = %+v, err = %v", hits, err)
+	}
+
+	sessions, err := svc.GetScopedQASessions()
+	if err != nil || len(sessions) != 1 || sessions[0].ID != session.ID {
+		t.Errorf("scoped sessions = %+v, err = %v", sessions, err)
+	}
+	if article, _ := svc.GetQASessions(a); len(article) != 0 {
+		t.Errorf("article sessions = %+v", article)
+	}
+	// Deleting a cited article keeps the answer.
+	svc.db.MustExec("DELETE FROM articles WHERE id=?", a)
+	if messages, err := svc.GetQAMessages(session.ID); err != nil || len(messages) != 4 {
+		t.Errorf("messages after delete = %d, err = %v", len(messages), err)
+	}
+}
@@ -0,0 +1,257 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"stock-report-analysis/internal/llmtest"
+	"stock-report-analysis/internal/models"
+)
+
+// qaRecorder collects the callbacks of one question.
+type qaRecorder struct {
+	mu        sync.Mutex
+	sessionID int64
+	roles     int
+	chunks    strings.Builder
+	reasoning strings.Builder
+	done      []models.QAMessage
+	errs      []string
+	jobDone   bool
+
+	moderator    strings.Builder
+	moderated    []models.QAMessage
+	moderatorErr []string
+}
+
+func (r *qaRecorder) callbacks() QAStreamCallbacks {
+	return QAStreamCallbacks{
+		OnJobStart: func(sessionID int64, _ int64, roleCount int) {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			r.sessionID, r.roles = sessionID, roleCount
+		},
+		OnRoleChunk: func(_ int64, _ int64, _ string, chunk string) {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			r.chunks.WriteString(chunk)
+		},
+		OnRoleReasoning: func(_ int64, _ int64, _ string, chunk string) {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			r.reasoning.WriteString(chunk)
+		},
+		OnRoleDone: func(msg models.QAMessage) {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			r.done = append(r.done, msg)
+		},
+		OnRoleError: func(_ int64, _ int64, _ string, errMsg string) {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			r.errs = append(r.errs, errMsg)
+		},
+		OnModeratorChunk: func(_ int64, chunk string) {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			r.moderator.WriteString(chunk)
+		},
+		OnModeratorDone: func(msg models.QAMessage) {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			r.moderated = append(r.moderated, msg)
+		},
+		OnModeratorError: func(_ int64, errMsg string) {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			r.moderatorErr = append(r.moderatorErr, errMsg)
+		},
+		OnJobDone: func(int64) {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			r.jobDone = true
+		},
+	}
+}
+
+func TestAskQuestionAnswersAndFollowsUp(t *testing.T) {
+	svc := newTestService(t)
+	srv := llmtest.New(t)
+	saveDefaultChannel(t, svc, srv)
+	articleID := insertTestArticle(t, svc, "年报点评", "公司全年营收增长 20%，毛利率提升至 35%。")
+
+	srv.Enqueue(llmtest.Reply{
+		Reasoning: []string{"先找营收"},
+		Chunks:    []string{"营收增长", " 20%"},
+		Usage:     &llmtest.Usage{PromptTokens: 30, CompletionTokens: 6, TotalTokens: 36},
+	})
+	rec := &qaRecorder{}
+	if _, err := svc.AskQuestionWithContextAndFollowUp(context.Background(), 0, articleID, "营收增长多少？", 0, rec.callbacks()); err != nil {
+		t.Fatalf("ask: %v", err)
+	}
+	if rec.sessionID == 0 || rec.roles != 1 || !rec.jobDone {
+		t.Fatalf("recorder = session %d, roles %d, done %v", rec.sessionID, rec.roles, rec.jobDone)
+	}
+	if rec.chunks.String() != "营收增长 20%" || rec.reasoning.String() != "先找营收" {
+		t.Errorf("streamed = %q / %q", rec.chunks.String(), rec.reasoning.String())
+	}
+	if len(rec.done) != 1 || rec.done[0].TotalTokens != 36 || len(rec.errs) != 0 {
+		t.Fatalf("done = %+v, errs = %v", rec.done, rec.errs)
+	}
+	if user := srv.Requests()[0].User(); !strings.Contains(user, "营收增长多少") || !strings.Contains(user, "毛利率") {
+		t.Errorf("qa input = %q", user)
+	}
+
+	messages, err := svc.GetQAMessages(rec.sessionID)
+	if err != nil {
+		t.Fatalf("messages: %v", err)
+	}
+	if len(messages) != 2 || messages[1].Status != "done" || messages[1].Content != "营收增长 20%" {
+		t.Fatalf("messages = %+v", messages)
+	}
+	if len(messages[1].Evidences) == 0 {
+		t.Error("answer has no evidences")
+	}
+
+	srv.Enqueue(llmtest.Text("毛利率 35%"))
+	followUp := &qaRecorder{}
+	if _, err := svc.AskQuestionWithContextAndFollowUp(context.Background(), rec.sessionID, articleID, "毛利率呢？", messages[1].ID, followUp.callbacks()); err != nil {
+		t.Fatalf("follow up: %v", err)
+	}
+	if followUp.sessionID != rec.sessionID || len(followUp.done) != 1 {
+		t.Fatalf("follow up = %+v", followUp)
+	}
+	if user := srv.Requests()[1].User(); !strings.Contains(user, "上轮回答摘要") || !strings.Contains(user, "营收增长 20%") {
+		t.Errorf("follow up input = %q", user)
+	}
+
+	var runs []models.QARun
+	if err := svc.db.Select(&runs, "SELECT * FROM qa_runs ORDER BY id"); err != nil {
+		t.Fatalf("runs: %v", err)
+	}
+	if len(runs) != 2 || runs[0].Success != 1 || runs[0].TotalTokens != 36 {
+		t.Errorf("runs = %+v", runs)
+	}
+}
+
+func TestAskQuestionRecordsRoleFailure(t *testing.T) {
+	svc := newTestService(t)
+	srv := llmtest.New(t)
+	saveDefaultChannel(t, svc, srv)
+	articleID := insertTestArticle(t, svc, "t", "正文")
+	srv.SetFallback(llmtest.Status(http.StatusInternalServerError, "boom"))
+
+	rec := &qaRecorder{}
+	if _, err := svc.AskQuestionWithContextAndFollowUp(context.Background(), 0, articleID, "问题", 0, rec.callbacks()); err != nil {
+		t.Fatalf("ask: %v", err)
+	}
+	if len(rec.errs) != 1 || len(rec.done) != 0 || !rec.jobDone {
+		t.Fatalf("errs = %v, done = %+v", rec.errs, rec.done)
+	}
+
+	messages, err := svc.GetQAMessages(rec.sessionID)
+	if err != nil {
+		t.Fatalf("messages: %v", err)
+	}
+	if len(messages) != 2 || messages[1].Status != "failed" || !strings.Contains(messages[1].ErrorReason, "500") {
+		t.Errorf("messages = %+v", messages)
+	}
+	var failed int
+	if err := svc.db.Get(&failed, "SELECT COUNT(*) FROM qa_runs WHERE success=0 AND error_reason<>''"); err != nil || failed != 1 {
+		t.Errorf("failed runs = %d, err = %v", failed, err)
+	}
+}
+
+func TestAskQuestionWithoutChannel(t *testing.T) {
+	svc := newTestService(t)
+	articleID := insertTestArticle(t, svc, "t", "正文")
+	if _, err := svc.AskQuestionWithContextAndFollowUp(context.Background(), 0, articleID, "问题", 0, QAStreamCallbacks{}); err == nil {
+		t.Fatal("want error without a channel")
+	}
+}
+
+func TestAskQuestionSendsRoleGenerationOptions(t *testing.T) {
+	svc := newTestService(t)
+	srv := llmtest.New(t)
+	saveDefaultChannel(t, svc, srv)
+	articleID := insertTestArticle(t, svc, "t", "正文")
+
+	zero, topP, seed := 0.0, 0.9, int64(7)
+	opts := models.GenerationOptions{Temperature: &zero, TopP: &topP, MaxTokens: 600, Stop: []string{"###", " "}, Seed: &seed}
+	if err := svc.SaveRole(models.Role{Name: "严谨", SystemPrompt: "只说事实。", GenerationOptions: opts, Enabled: 1}); err != nil {
+		t.Fatalf("save role: %v", err)
+	}
+	bad := 3.0
+	if err := svc.SaveRole(models.Role{Name: "发散", SystemPrompt: "p", GenerationOptions: models.GenerationOptions{Temperature: &bad}, Enabled: 1}); err == nil {
+		t.Error("saved a role with temperature 3")
+	}
+
+	if _, err := svc.AskQuestionWithContextAndFollowUp(context.Background(), 0, articleID, "@严谨 结论？", 0, (&qaRecorder{}).callbacks()); err != nil {
+		t.Fatalf("ask: %v", err)
+	}
+	req := srv.Requests()[0]
+	if req.Temperature == nil || *req.Temperature != 0 || req.TopP == nil || *req.TopP != 0.9 || req.MaxTokens != 600 ||
+		len(req.Stop) != 1 || req.Stop[0] != "###" || req.Seed == nil || *req.Seed != 7 {
+		t.Errorf("request = %+v", req)
+	}
+	var stored string
+	if err := svc.db.Get(&stored, "SELECT generation_options FROM qa_runs"); err != nil || !strings.Contains(stored, `"temperature":0`) {
+		t.Errorf("run options = %q, err = %v", stored, err)
+	}
+}
+
+func TestAskQuestionRolesFollowChannelInFlight(t *testing.T) {
+	svc := newTestService(t)
+	srv := llmtest.New(t)
+	srv.SetFallback(llmtest.Reply{Chunks: []string{"答复"}, Delay: 50 * time.Millisecond})
+	channel := saveDefaultChannel(t, svc, srv)
+	articleID := insertTestArticle(t, svc, "t", "正文")
+	for _, name := range []string{"甲", "乙", "丙"} {
+		if err := svc.SaveRole(models.Role{Name: name, SystemPrompt: "p", Enabled: 1}); err != nil {
+			t.Fatalf("save role: %v", err)
+		}
+	}
+
+	// maxInFlight asks with all three roles and reports the peak number of
+	// calls in flight on the channel.
+	maxInFlight := func() int {
+		stop := make(chan struct{})
+		peak := make(chan int)
+		go func() {
+			top := 0
+			for {
+				top = max(top, svc.GetChannelLimiterStats(channel.ID).InFlight)
+				select {
+				case <-stop:
+					peak <- top
+					return
+				case <-time.After(2 * time.Millisecond):
+				}
+			}
+		}()
+		rec := &qaRecorder{}
+		if _, err := svc.AskQuestionWithContextAndFollowUp(context.Background(), 0, articleID, "@甲 @乙 @丙 前景？", 0, rec.callbacks()); err != nil {
+			t.Fatalf("ask: %v", err)
+		}
+		close(stop)
+		if len(rec.done) != 3 {
+			t.Fatalf("done = %+v, errs = %v", rec.done, rec.errs)
+		}
+		return <-peak
+	}
+
+	if got := maxInFlight(); got != 3 {
+		t.Errorf("unlimited channel ran %d roles at once, want 3", got)
+	}
+	channel.MaxInFlight = 1
+	if err := svc.SaveChannel(channel); err != nil {
+		t.Fatalf("save channel: %v", err)
+	}
+	if got := maxInFlight(); got != 1 {
+		t.Errorf("channel with max_in_flight 1 ran %d roles at once", got)
+	}
+}
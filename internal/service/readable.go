@@ -0,0 +1,330 @@
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+	"golang.org/x/net/html/charset"
+)
+
+// Elements that never hold the body of a page.
+var readableDropTags = map[atom.Atom]bool{
+	atom.Script: true, atom.Style: true, atom.Noscript: true, atom.Template: true,
+	atom.Nav: true, atom.Header: true, atom.Footer: true, atom.Aside: true,
+	atom.Form: true, atom.Button: true, atom.Select: true, atom.Input: true,
+	atom.Iframe: true, atom.Svg: true, atom.Canvas: true, atom.Object: true, atom.Embed: true,
+}
+
+var (
+	readableUnlikelyRegexp = regexp.MustCompile(`(?i)(^|[-_ ])(nav|navbar|menu|header|footer|sidebar|side|breadcrumbs?|crumbs?|comments?|share|social|ads?|advert|advertisement|banner|promo|sponsor|related|recommend|popup|modal|cookie|login|subscribe|toolbar|pager|pagination)($|[-_ ])`)
+	readablePositiveRegexp = regexp.MustCompile(`(?i)article|content|main|post|body|text|detail|entry|story`)
+)
+
+var readableBlockTags = map[atom.Atom]bool{
+	atom.P: true, atom.Div: true, atom.Section: true, atom.Article: true, atom.Main: true,
+	atom.Blockquote: true, atom.Pre: true, atom.Table: true, atom.Tr: true, atom.Ul: true, atom.Ol: true,
+	atom.Li: true, atom.Dl: true, atom.Dt: true, atom.Dd: true, atom.Figure: true, atom.Figcaption: true,
+	atom.H1: true, atom.H2: true, atom.H3: true, atom.H4: true, atom.H5: true, atom.H6: true, atom.Hr: true,
+}
+
+// extractReadableHTML returns the title and main body of an HTML page as
+// markdown-like text. The body is the container whose paragraphs carry the
+// most prose, in the spirit of Readability: navigation, ads and link lists
+// are dropped, and text blocks score by length and punctuation.
+func extractReadableHTML(body []byte, contentType string) (string, string, error) {
+	reader, err := charset.NewReader(bytes.NewReader(body), contentType)
+	if err != nil {
+		return "", "", fmt.Errorf("无法识别网页编码: %w", err)
+	}
+	doc, err := html.Parse(reader)
+	if err != nil {
+		return "", "", fmt.Errorf("解析网页失败: %w", err)
+	}
+
+	title := readableTitle(doc)
+	pruneUnlikelyNodes(doc)
+
+	root := findElement(doc, atom.Body)
+	if root == nil {
+		root = doc
+	}
+	if best := bestReadableCandidate(root); best != nil {
+		root = best
+	}
+
+	var b strings.Builder
+	renderReadableText(&b, root)
+	content := collapseBlankLines(b.String())
+	// Many pages repeat the title as their first heading.
+	if title != "" {
+		content = strings.TrimSpace(strings.TrimPrefix(strings.TrimPrefix(content, "# "+title), title))
+	}
+	return title, content, nil
+}
+
+// readableTitle prefers og:title, then the first <h1>, then <title>, which
+// often carries the site name as well.
+func readableTitle(doc *html.Node) string {
+	var ogTitle, pageTitle, h1 string
+	walkElements(doc, func(n *html.Node) bool {
+		switch n.DataAtom {
+		case atom.Meta:
+			if ogTitle == "" && (htmlAttr(n, "property") == "og:title" || htmlAttr(n, "name") == "og:title") {
+				ogTitle = strings.TrimSpace(htmlAttr(n, "content"))
+			}
+		case atom.Title:
+			if pageTitle == "" {
+				pageTitle = nodeText(n)
+			}
+		case atom.H1:
+			if h1 == "" {
+				h1 = nodeText(n)
+			}
+		}
+		return true
+	})
+	for _, t := range []string{ogTitle, h1, pageTitle} {
+		if t != "" {
+			return t
+		}
+	}
+	return ""
+}
+
+// pruneUnlikelyNodes removes chrome elements and containers whose class or
+// id looks like navigation or ads, unless they also look like content.
+func pruneUnlikelyNodes(n *html.Node) {
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		switch {
+		case c.Type == html.CommentNode:
+			n.RemoveChild(c)
+		case c.Type == html.ElementNode && (readableDropTags[c.DataAtom] || isUnlikelyCandidate(c)):
+			n.RemoveChild(c)
+		default:
+			pruneUnlikelyNodes(c)
+		}
+		c = next
+	}
+}
+
+func isUnlikelyCandidate(n *html.Node) bool {
+	if n.DataAtom == atom.Body || n.DataAtom == atom.Article || n.DataAtom == atom.Main {
+		return false
+	}
+	if htmlAttr(n, "hidden") != "" || htmlAttr(n, "aria-hidden") == "true" || strings.Contains(strings.ReplaceAll(htmlAttr(n, "style"), " ", ""), "display:none") {
+		return true
+	}
+	names := htmlAttr(n, "class") + " " + htmlAttr(n, "id")
+	if role := htmlAttr(n, "role"); role == "navigation" || role == "banner" || role == "contentinfo" || role == "complementary" {
+		return true
+	}
+	return readableUnlikelyRegexp.MatchString(names) && !readablePositiveRegexp.MatchString(names)
+}
+
+// bestReadableCandidate scores every text block and credits its parent in
+// full and its grandparent by half, then picks the container with the
+// highest score after discounting link-heavy text.
+func bestReadableCandidate(root *html.Node) *html.Node {
+	scores := map[*html.Node]float64{}
+	var order []*html.Node
+	credit := func(n *html.Node, score float64) {
+		if n == nil || n.Type != html.ElementNode {
+			return
+		}
+		if _, ok := scores[n]; !ok {
+			order = append(order, n)
+			if readablePositiveRegexp.MatchString(htmlAttr(n, "class") + " " + htmlAttr(n, "id")) {
+				scores[n] += 5
+			}
+			if n.DataAtom == atom.Article || n.DataAtom == atom.Main {
+				scores[n] += 5
+			}
+		}
+		scores[n] += score
+	}
+
+	walkElements(root, func(n *html.Node) bool {
+		if n.DataAtom != atom.P && n.DataAtom != atom.Pre && n.DataAtom != atom.Td &&
+			!(n.DataAtom == atom.Div && !hasBlockChild(n)) {
+			return true
+		}
+		text := nodeText(n)
+		length := utf8.RuneCountInString(text)
+		if length < 25 {
+			return false
+		}
+		score := 1 + float64(strings.Count(text, ",")+strings.Count(text, "，")+strings.Count(text, "。")) + min(float64(length)/100, 3)
+		credit(n.Parent, score)
+		if n.Parent != nil {
+			credit(n.Parent.Parent, score/2)
+		}
+		return false
+	})
+
+	var best *html.Node
+	bestScore := 0.0
+	for _, n := range order {
+		score := scores[n] * (1 - linkDensity(n))
+		if score > bestScore {
+			best, bestScore = n, score
+		}
+	}
+	return best
+}
+
+func hasBlockChild(n *html.Node) bool {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode && readableBlockTags[c.DataAtom] {
+			return true
+		}
+	}
+	return false
+}
+
+// linkDensity is the share of n's text that sits inside links.
+func linkDensity(n *html.Node) float64 {
+	total := utf8.RuneCountInString(nodeText(n))
+	if total == 0 {
+		return 0
+	}
+	linked := 0
+	walkElements(n, func(c *html.Node) bool {
+		if c.DataAtom == atom.A {
+			linked += utf8.RuneCountInString(nodeText(c))
+			return false
+		}
+		return true
+	})
+	return float64(linked) / float64(total)
+}
+
+// renderReadableText writes n as text: blocks on their own lines, headings
+// and list items in markdown, inline whitespace collapsed.
+func renderReadableText(b *strings.Builder, n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		text := strings.Join(strings.Fields(n.Data), " ")
+		if text == "" {
+			if n.Data != "" {
+				writeSpace(b)
+			}
+			return
+		}
+		if first, _ := utf8.DecodeRuneInString(n.Data); unicode.IsSpace(first) {
+			writeSpace(b)
+		}
+		b.WriteString(text)
+		if last, _ := utf8.DecodeLastRuneInString(n.Data); unicode.IsSpace(last) {
+			writeSpace(b)
+		}
+		return
+	case html.ElementNode:
+		switch n.DataAtom {
+		case atom.Br:
+			b.WriteByte('\n')
+			return
+		case atom.Img:
+			return
+		case atom.Pre:
+			b.WriteString("\n\n" + strings.TrimSpace(rawNodeText(n)) + "\n\n")
+			return
+		case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+			if text := nodeText(n); text != "" {
+				level := int(n.Data[1] - '0')
+				b.WriteString("\n\n" + strings.Repeat("#", level) + " " + text + "\n\n")
+			}
+			return
+		case atom.Li:
+			b.WriteString("\n- ")
+		case atom.Td, atom.Th:
+			if n.PrevSibling != nil {
+				b.WriteString(" | ")
+			}
+		}
+	}
+	block := n.Type == html.ElementNode && readableBlockTags[n.DataAtom] && n.DataAtom != atom.Li
+	if block {
+		b.WriteString("\n\n")
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		renderReadableText(b, c)
+	}
+	if block {
+		b.WriteString("\n\n")
+	}
+}
+
+// writeSpace separates inline text, once, and never at the start of a line.
+func writeSpace(b *strings.Builder) {
+	if s := b.String(); s != "" && !strings.HasSuffix(s, "\n") && !strings.HasSuffix(s, " ") {
+		b.WriteByte(' ')
+	}
+}
+
+var blankLinesRegexp = regexp.MustCompile(`\n{3,}`)
+
+func collapseBlankLines(text string) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(line)
+	}
+	return strings.TrimSpace(blankLinesRegexp.ReplaceAllString(strings.Join(lines, "\n"), "\n\n"))
+}
+
+// walkElements calls visit on every element under n in document order and
+// descends into an element only when visit returns true.
+func walkElements(n *html.Node, visit func(*html.Node) bool) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode && !visit(c) {
+			continue
+		}
+		walkElements(c, visit)
+	}
+}
+
+func findElement(n *html.Node, a atom.Atom) *html.Node {
+	var found *html.Node
+	walkElements(n, func(c *html.Node) bool {
+		if found == nil && c.DataAtom == a {
+			found = c
+		}
+		return found == nil
+	})
+	return found
+}
+
+// nodeText is the text of n with whitespace collapsed.
+func nodeText(n *html.Node) string {
+	return strings.Join(strings.Fields(rawNodeText(n)), " ")
+}
+
+func rawNodeText(n *html.Node) string {
+	var b strings.Builder
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			b.WriteString(n.Data)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return b.String()
+}
+
+func htmlAttr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
@@ -0,0 +1,130 @@
+package service
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+
+	"stock-report-analysis/internal/models"
+)
+
+const (
+	aiResponseCacheConfigKey = "ai_response_cache_config_v1"
+	maxResponseCacheAgeDays  = 3650
+)
+
+// responseCacheKey addresses a reply by everything that shapes it: the
+// model, the full system prompt (schema included), the mode, the generation
+// options and the user content. The channel itself is left out so channels
+// serving the same model share entries.
+func responseCacheKey(model, system, mode string, options models.GenerationOptions, content string) string {
+	opts, _ := options.Value()
+	payload, _ := json.Marshal([]any{model, system, mode, opts, content})
+	sum := sha256.Sum256(payload)
+	return hex.EncodeToString(sum[:])
+}
+
+type cachedResponse struct {
+	Text      string `db:"text"`
+	Reasoning string `db:"reasoning"`
+}
+
+// lookupCachedResponse returns the stored reply for key unless it is older
+// than the configured MaxAgeDays. Lookup errors count as a miss.
+func (s *Service) lookupCachedResponse(key string) (cachedResponse, bool) {
+	var entry cachedResponse
+	query := "SELECT text, reasoning FROM ai_response_cache WHERE cache_key=?"
+	args := []any{key}
+	if cfg, err := s.GetAIResponseCacheConfig(); err == nil && cfg.MaxAgeDays > 0 {
+		query += " AND created_at >= datetime('now', ?)"
+		args = append(args, fmt.Sprintf("-%d days", cfg.MaxAgeDays))
+	}
+	if err := s.db.Get(&entry, query, args...); err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("[AI] response cache lookup failed: %s", err.Error())
+		}
+		return entry, false
+	}
+	_, _ = s.db.Exec("UPDATE ai_response_cache SET hit_count=hit_count+1, last_hit_at=CURRENT_TIMESTAMP WHERE cache_key=?", key)
+	return entry, true
+}
+
+// storeCachedResponse saves or replaces the reply for key. A failed write
+// only costs a future hit, so it is logged rather than returned.
+func (s *Service) storeCachedResponse(key, model string, result AnalysisResult) {
+	_, err := s.db.Exec(`
+		INSERT INTO ai_response_cache(cache_key, model, text, reasoning, prompt_tokens, completion_tokens, total_tokens)
+		VALUES(?,?,?,?,?,?,?)
+		ON CONFLICT(cache_key) DO UPDATE SET
+			model=excluded.model,
+			text=excluded.text,
+			reasoning=excluded.reasoning,
+			prompt_tokens=excluded.prompt_tokens,
+			completion_tokens=excluded.completion_tokens,
+			total_tokens=excluded.total_tokens,
+			created_at=CURRENT_TIMESTAMP
+	`, key, model, result.Text, result.Reasoning, result.PromptTokens, result.CompletionTokens, result.TotalTokens)
+	if err != nil {
+		log.Printf("[AI] response cache store failed: %s", err.Error())
+	}
+}
+
+func (s *Service) GetAIResponseCacheConfig() (models.AIResponseCacheConfig, error) {
+	cfg := models.AIResponseCacheConfig{}
+
+	var raw string
+	err := s.db.Get(&raw, "SELECT value FROM app_configs WHERE key=?", aiResponseCacheConfigKey)
+	if errors.Is(err, sql.ErrNoRows) {
+		return cfg, nil
+	}
+	if err != nil {
+		return cfg, err
+	}
+	if json.Unmarshal([]byte(raw), &cfg) != nil {
+		return models.AIResponseCacheConfig{}, nil
+	}
+	return normalizeAIResponseCacheConfig(cfg), nil
+}
+
+func (s *Service) SaveAIResponseCacheConfig(cfg models.AIResponseCacheConfig) error {
+	cfg = normalizeAIResponseCacheConfig(cfg)
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(`
+		INSERT INTO app_configs(key, value, updated_at)
+		VALUES(?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT(key) DO UPDATE SET value=excluded.value, updated_at=CURRENT_TIMESTAMP
+	`, aiResponseCacheConfigKey, string(data))
+	return err
+}
+
+func normalizeAIResponseCacheConfig(cfg models.AIResponseCacheConfig) models.AIResponseCacheConfig {
+	cfg.MaxAgeDays = min(max(cfg.MaxAgeDays, 0), maxResponseCacheAgeDays)
+	return cfg
+}
+
+func (s *Service) GetAIResponseCacheStats() (models.AIResponseCacheStats, error) {
+	stats := struct {
+		Entries   int           `db:"entries"`
+		TotalHits sql.NullInt64 `db:"total_hits"`
+	}{}
+	if err := s.db.Get(&stats, "SELECT COUNT(*) AS entries, SUM(hit_count) AS total_hits FROM ai_response_cache"); err != nil {
+		return models.AIResponseCacheStats{}, err
+	}
+	return models.AIResponseCacheStats{Entries: stats.Entries, TotalHits: stats.TotalHits.Int64}, nil
+}
+
+// ClearAIResponseCache deletes every stored reply and returns how many were removed.
+func (s *Service) ClearAIResponseCache() (int64, error) {
+	res, err := s.db.Exec("DELETE FROM ai_response_cache")
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
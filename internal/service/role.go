@@ -7,7 +7,6 @@ import (
 	"sort"
 	"strings"
 
-	"stock-report-analysis/internal/db"
 	"stock-report-analysis/internal/models"
 
 	"github.com/jmoiron/sqlx"
@@ -18,9 +17,9 @@ var mentionPattern = regexp.MustCompile(`@([^\s@,，。:：;；!！?？]+)`)
 const fallbackRoleName = "通用分析师"
 const fallbackRolePrompt = "你是资深股票研究分析师。请基于用户提供的报告上下文回答问题。禁止编造事实；若证据不足要明确说明。回答要结构清晰，先结论后理由。"
 
-func GetRoles() ([]models.Role, error) {
+func (s *Service) GetRoles() ([]models.Role, error) {
 	var roles []models.Role
-	err := db.DB.Select(&roles, `
+	err := s.db.Select(&roles, `
 		SELECT *
 		FROM roles
 		ORDER BY is_default DESC, enabled DESC, id ASC
@@ -28,9 +27,9 @@ func GetRoles() ([]models.Role, error) {
 	return roles, err
 }
 
-func GetDefaultRole() (models.Role, error) {
+func (s *Service) GetDefaultRole() (models.Role, error) {
 	var role models.Role
-	err := db.DB.Get(&role, `
+	err := s.db.Get(&role, `
 		SELECT *
 		FROM roles
 		WHERE enabled = 1 AND is_default = 1
@@ -40,7 +39,7 @@ func GetDefaultRole() (models.Role, error) {
 	return role, err
 }
 
-func SaveRole(role models.Role) error {
+func (s *Service) SaveRole(role models.Role) error {
 	role.Name = strings.TrimSpace(role.Name)
 	role.Alias = strings.TrimSpace(role.Alias)
 	role.DomainTags = strings.TrimSpace(role.DomainTags)
@@ -56,14 +55,13 @@ func SaveRole(role models.Role) error {
 	if role.Enabled == 0 && role.IsDefault == 1 {
 		return errors.New("默认角色必须启用")
 	}
-	if role.MaxTokens <= 0 {
-		role.MaxTokens = 1200
-	}
-	if role.Temperature <= 0 {
-		role.Temperature = 0.2
+	opts, err := NormalizeGenerationOptions(role.GenerationOptions)
+	if err != nil {
+		return err
 	}
+	role.GenerationOptions = opts
 
-	tx, err := db.DB.Beginx()
+	tx, err := s.db.Beginx()
 	if err != nil {
 		return err
 	}
@@ -77,18 +75,18 @@ func SaveRole(role models.Role) error {
 
 	if role.ID == 0 {
 		_, err := tx.Exec(`
-			INSERT INTO roles(name, alias, domain_tags, system_prompt, model_override, temperature, max_tokens, enabled, is_default)
-			VALUES(?,?,?,?,?,?,?,?,?)
-		`, role.Name, role.Alias, role.DomainTags, role.SystemPrompt, role.ModelOverride, role.Temperature, role.MaxTokens, role.Enabled, role.IsDefault)
+			INSERT INTO roles(name, alias, domain_tags, system_prompt, model_override, generation_options, enabled, is_default)
+			VALUES(?,?,?,?,?,?,?,?)
+		`, role.Name, role.Alias, role.DomainTags, role.SystemPrompt, role.ModelOverride, role.GenerationOptions, role.Enabled, role.IsDefault)
 		if err != nil {
 			return err
 		}
 	} else {
 		_, err := tx.Exec(`
 			UPDATE roles
-			SET name=?, alias=?, domain_tags=?, system_prompt=?, model_override=?, temperature=?, max_tokens=?, enabled=?, is_default=?, updated_at=CURRENT_TIMESTAMP
+			SET name=?, alias=?, domain_tags=?, system_prompt=?, model_override=?, generation_options=?, enabled=?, is_default=?, updated_at=CURRENT_TIMESTAMP
 			WHERE id=?
-		`, role.Name, role.Alias, role.DomainTags, role.SystemPrompt, role.ModelOverride, role.Temperature, role.MaxTokens, role.Enabled, role.IsDefault, role.ID)
+		`, role.Name, role.Alias, role.DomainTags, role.SystemPrompt, role.ModelOverride, role.GenerationOptions, role.Enabled, role.IsDefault, role.ID)
 		if err != nil {
 			return err
 		}
@@ -100,8 +98,8 @@ func SaveRole(role models.Role) error {
 	return tx.Commit()
 }
 
-func DeleteRole(id int64) error {
-	tx, err := db.DB.Beginx()
+func (s *Service) DeleteRole(id int64) error {
+	tx, err := s.db.Beginx()
 	if err != nil {
 		return err
 	}
@@ -116,8 +114,8 @@ func DeleteRole(id int64) error {
 	return tx.Commit()
 }
 
-func SetDefaultRole(id int64) error {
-	tx, err := db.DB.Beginx()
+func (s *Service) SetDefaultRole(id int64) error {
+	tx, err := s.db.Beginx()
 	if err != nil {
 		return err
 	}
@@ -140,8 +138,8 @@ func SetDefaultRole(id int64) error {
 	return tx.Commit()
 }
 
-func ResolveRolesByMentions(question string) ([]models.Role, string, error) {
-	roles, err := GetRoles()
+func (s *Service) ResolveRolesByMentions(question string) ([]models.Role, string, error) {
+	roles, err := s.GetRoles()
 	if err != nil {
 		return nil, "", err
 	}
@@ -193,7 +191,7 @@ func ResolveRolesByMentions(question string) ([]models.Role, string, error) {
 	}
 
 	if len(selected) == 0 {
-		def, err := GetDefaultRole()
+		def, err := s.GetDefaultRole()
 		if err == nil {
 			return []models.Role{def}, cleaned, nil
 		}
@@ -226,12 +224,18 @@ func ensureDefaultRoleTx(tx *sqlx.Tx) error {
 	}
 
 	_, err = tx.Exec(`
-		INSERT INTO roles(name, alias, domain_tags, system_prompt, model_override, temperature, max_tokens, enabled, is_default)
-		VALUES(?,?,?,?,?,?,?,?,?)
-	`, fallbackRoleName, "general", "通用,基本面", fallbackRolePrompt, "", 0.2, 1200, 1, 1)
+		INSERT INTO roles(name, alias, domain_tags, system_prompt, model_override, generation_options, enabled, is_default)
+		VALUES(?,?,?,?,?,?,?,?)
+	`, fallbackRoleName, "general", "通用,基本面", fallbackRolePrompt, "", defaultRoleGenerationOptions(), 1, 1)
 	return err
 }
 
+// defaultRoleGenerationOptions are the options of built-in roles.
+func defaultRoleGenerationOptions() models.GenerationOptions {
+	temperature := 0.2
+	return models.GenerationOptions{Temperature: &temperature, MaxTokens: 1200}
+}
+
 func normalizeSpaces(s string) string {
 	fields := strings.Fields(s)
 	if len(fields) == 0 {
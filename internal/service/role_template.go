@@ -5,7 +5,6 @@ import (
 	"fmt"
 	"strings"
 
-	"stock-report-analysis/internal/db"
 	"stock-report-analysis/internal/models"
 )
 
@@ -53,7 +52,7 @@ func GetRoleTemplates() []models.RoleTemplate {
 	return out
 }
 
-func CreateRoleFromTemplate(templateID string) (models.Role, error) {
+func (s *Service) CreateRoleFromTemplate(templateID string) (models.Role, error) {
 	templateID = strings.TrimSpace(templateID)
 	if templateID == "" {
 		return models.Role{}, errors.New("模板 ID 不能为空")
@@ -70,7 +69,7 @@ func CreateRoleFromTemplate(templateID string) (models.Role, error) {
 		return models.Role{}, errors.New("未找到角色模板")
 	}
 
-	name, err := nextAvailableRoleName(tpl.Name)
+	name, err := s.nextAvailableRoleName(tpl.Name)
 	if err != nil {
 		return models.Role{}, err
 	}
@@ -80,28 +79,27 @@ func CreateRoleFromTemplate(templateID string) (models.Role, error) {
 	}
 
 	role := models.Role{
-		Name:          name,
-		Alias:         alias,
-		DomainTags:    tpl.DomainTags,
-		SystemPrompt:  tpl.SystemPrompt,
-		ModelOverride: "",
-		Temperature:   0.2,
-		MaxTokens:     1200,
-		Enabled:       1,
-		IsDefault:     0,
+		Name:              name,
+		Alias:             alias,
+		DomainTags:        tpl.DomainTags,
+		SystemPrompt:      tpl.SystemPrompt,
+		ModelOverride:     "",
+		GenerationOptions: defaultRoleGenerationOptions(),
+		Enabled:           1,
+		IsDefault:         0,
 	}
-	if err := SaveRole(role); err != nil {
+	if err := s.SaveRole(role); err != nil {
 		return models.Role{}, err
 	}
 
 	var created models.Role
-	if err := db.DB.Get(&created, `SELECT * FROM roles WHERE name=? ORDER BY id DESC LIMIT 1`, name); err != nil {
+	if err := s.db.Get(&created, `SELECT * FROM roles WHERE name=? ORDER BY id DESC LIMIT 1`, name); err != nil {
 		return models.Role{}, err
 	}
 	return created, nil
 }
 
-func nextAvailableRoleName(base string) (string, error) {
+func (s *Service) nextAvailableRoleName(base string) (string, error) {
 	base = strings.TrimSpace(base)
 	if base == "" {
 		return "", errors.New("模板名称无效")
@@ -109,7 +107,7 @@ func nextAvailableRoleName(base string) (string, error) {
 	name := base
 	for i := 0; i < 100; i++ {
 		var cnt int
-		if err := db.DB.Get(&cnt, `SELECT COUNT(*) FROM roles WHERE name=?`, name); err != nil {
+		if err := s.db.Get(&cnt, `SELECT COUNT(*) FROM roles WHERE name=?`, name); err != nil {
 			return "", err
 		}
 		if cnt == 0 {
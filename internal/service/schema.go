@@ -0,0 +1,304 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// defaultStructuredSchema describes the built-in summary/risks/catalysts/
+// valuationView reply used when a prompt defines no schema of its own.
+const defaultStructuredSchema = `{
+  "type": "object",
+  "properties": {
+    "summary": {"type": "string", "minLength": 1},
+    "risks": {"type": "array", "items": {"type": "string"}},
+    "catalysts": {"type": "array", "items": {"type": "string"}},
+    "valuationView": {"type": "string"}
+  },
+  "required": ["summary", "risks", "catalysts", "valuationView"]
+}`
+
+// SchemaViolationError reports a reply that is valid JSON but does not match
+// the schema. Path points at the offending value, e.g. "$.guidance[0]".
+type SchemaViolationError struct {
+	Path    string
+	Message string
+}
+
+func (e *SchemaViolationError) Error() string {
+	return fmt.Sprintf("结构化结果不符合 Schema: %s %s", e.Path, e.Message)
+}
+
+var schemaTypes = map[string]bool{
+	"object": true, "array": true, "string": true, "number": true,
+	"integer": true, "boolean": true, "null": true,
+}
+
+// NormalizeOutputSchema checks a prompt's JSON Schema and returns it compacted.
+// Only the keywords enforced by validateSchemaValue are meaningful locally;
+// others are passed through to providers that understand them.
+func NormalizeOutputSchema(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", nil
+	}
+	node, err := parseSchema(raw)
+	if err != nil {
+		return "", err
+	}
+	if node["type"] != "object" {
+		return "", errors.New("输出 Schema 的根节点 type 必须为 object")
+	}
+	if err := checkSchemaNode(node, "$"); err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, []byte(raw)); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func parseSchema(raw string) (map[string]any, error) {
+	var node map[string]any
+	if err := json.Unmarshal([]byte(raw), &node); err != nil || node == nil {
+		return nil, errors.New("输出 Schema 不是合法的 JSON 对象")
+	}
+	return node, nil
+}
+
+// checkSchemaNode rejects malformed keywords at save time so a typo does not
+// turn every later analysis into a schema violation.
+func checkSchemaNode(node map[string]any, path string) error {
+	switch t := node["type"].(type) {
+	case nil:
+	case string:
+		if !schemaTypes[t] {
+			return fmt.Errorf("输出 Schema %s 的 type 不支持: %s", path, t)
+		}
+	case []any:
+		for _, item := range t {
+			name, ok := item.(string)
+			if !ok || !schemaTypes[name] {
+				return fmt.Errorf("输出 Schema %s 的 type 不支持: %v", path, item)
+			}
+		}
+	default:
+		return fmt.Errorf("输出 Schema %s 的 type 应为字符串或数组", path)
+	}
+
+	if props, ok := node["properties"]; ok {
+		m, ok := props.(map[string]any)
+		if !ok {
+			return fmt.Errorf("输出 Schema %s 的 properties 应为对象", path)
+		}
+		for key, child := range m {
+			sub, ok := child.(map[string]any)
+			if !ok {
+				return fmt.Errorf("输出 Schema %s.%s 应为对象", path, key)
+			}
+			if err := checkSchemaNode(sub, path+"."+key); err != nil {
+				return err
+			}
+		}
+	}
+	if req, ok := node["required"]; ok {
+		list, ok := req.([]any)
+		if !ok {
+			return fmt.Errorf("输出 Schema %s 的 required 应为字符串数组", path)
+		}
+		for _, item := range list {
+			if _, ok := item.(string); !ok {
+				return fmt.Errorf("输出 Schema %s 的 required 应为字符串数组", path)
+			}
+		}
+	}
+	if items, ok := node["items"]; ok {
+		sub, ok := items.(map[string]any)
+		if !ok {
+			return fmt.Errorf("输出 Schema %s 的 items 应为对象", path)
+		}
+		if err := checkSchemaNode(sub, path+"[]"); err != nil {
+			return err
+		}
+	}
+	if extra, ok := node["additionalProperties"]; ok {
+		switch v := extra.(type) {
+		case bool:
+		case map[string]any:
+			if err := checkSchemaNode(v, path+".*"); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("输出 Schema %s 的 additionalProperties 应为布尔值或对象", path)
+		}
+	}
+	if enum, ok := node["enum"]; ok {
+		if _, ok := enum.([]any); !ok {
+			return fmt.Errorf("输出 Schema %s 的 enum 应为数组", path)
+		}
+	}
+	for _, key := range []string{"minLength", "maxLength", "minItems", "maxItems", "minimum", "maximum"} {
+		if v, ok := node[key]; ok {
+			if _, ok := v.(float64); !ok {
+				return fmt.Errorf("输出 Schema %s 的 %s 应为数字", path, key)
+			}
+		}
+	}
+	return nil
+}
+
+// validateSchemaValue checks value (decoded with encoding/json) against the
+// supported JSON Schema subset: type, enum, properties, required,
+// additionalProperties, items, min/maxItems, min/maxLength and
+// minimum/maximum.
+func validateSchemaValue(node map[string]any, value any, path string) error {
+	if err := checkSchemaType(node["type"], value, path); err != nil {
+		return err
+	}
+	if enum, ok := node["enum"].([]any); ok {
+		matched := false
+		for _, candidate := range enum {
+			if reflect.DeepEqual(candidate, value) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return &SchemaViolationError{Path: path, Message: "不在允许的取值范围内"}
+		}
+	}
+
+	switch v := value.(type) {
+	case map[string]any:
+		return validateSchemaObject(node, v, path)
+	case []any:
+		if n, ok := node["minItems"].(float64); ok && float64(len(v)) < n {
+			return &SchemaViolationError{Path: path, Message: fmt.Sprintf("至少需要 %d 项", int(n))}
+		}
+		if n, ok := node["maxItems"].(float64); ok && float64(len(v)) > n {
+			return &SchemaViolationError{Path: path, Message: fmt.Sprintf("最多允许 %d 项", int(n))}
+		}
+		if items, ok := node["items"].(map[string]any); ok {
+			for i, item := range v {
+				if err := validateSchemaValue(items, item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+					return err
+				}
+			}
+		}
+	case string:
+		length := float64(utf8.RuneCountInString(strings.TrimSpace(v)))
+		if n, ok := node["minLength"].(float64); ok && length < n {
+			if n == 1 {
+				return &SchemaViolationError{Path: path, Message: "不能为空"}
+			}
+			return &SchemaViolationError{Path: path, Message: fmt.Sprintf("长度不能少于 %d", int(n))}
+		}
+		if n, ok := node["maxLength"].(float64); ok && length > n {
+			return &SchemaViolationError{Path: path, Message: fmt.Sprintf("长度不能超过 %d", int(n))}
+		}
+	case float64:
+		if n, ok := node["minimum"].(float64); ok && v < n {
+			return &SchemaViolationError{Path: path, Message: fmt.Sprintf("不能小于 %v", n)}
+		}
+		if n, ok := node["maximum"].(float64); ok && v > n {
+			return &SchemaViolationError{Path: path, Message: fmt.Sprintf("不能大于 %v", n)}
+		}
+	}
+	return nil
+}
+
+func validateSchemaObject(node map[string]any, obj map[string]any, path string) error {
+	if required, ok := node["required"].([]any); ok {
+		for _, item := range required {
+			key, _ := item.(string)
+			if _, present := obj[key]; !present {
+				return &SchemaViolationError{Path: path + "." + key, Message: "缺失"}
+			}
+		}
+	}
+
+	props, _ := node["properties"].(map[string]any)
+	keys := make([]string, 0, len(obj))
+	for key := range obj {
+		keys = append(keys, key)
+	}
+	// Sorted so the same reply always reports the same first violation.
+	sort.Strings(keys)
+	for _, key := range keys {
+		childPath := path + "." + key
+		if sub, ok := props[key].(map[string]any); ok {
+			if err := validateSchemaValue(sub, obj[key], childPath); err != nil {
+				return err
+			}
+			continue
+		}
+		switch extra := node["additionalProperties"].(type) {
+		case bool:
+			if !extra {
+				return &SchemaViolationError{Path: childPath, Message: "不是 Schema 中定义的字段"}
+			}
+		case map[string]any:
+			if err := validateSchemaValue(extra, obj[key], childPath); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func checkSchemaType(spec any, value any, path string) error {
+	var allowed []string
+	switch t := spec.(type) {
+	case string:
+		allowed = []string{t}
+	case []any:
+		for _, item := range t {
+			if name, ok := item.(string); ok {
+				allowed = append(allowed, name)
+			}
+		}
+	default:
+		return nil
+	}
+	for _, name := range allowed {
+		if matchesSchemaType(name, value) {
+			return nil
+		}
+	}
+	return &SchemaViolationError{Path: path, Message: "类型应为 " + strings.Join(allowed, "/")}
+}
+
+func matchesSchemaType(name string, value any) bool {
+	switch name {
+	case "object":
+		_, ok := value.(map[string]any)
+		return ok
+	case "array":
+		_, ok := value.([]any)
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	case "integer":
+		n, ok := value.(float64)
+		return ok && n == math.Trunc(n)
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "null":
+		return value == nil
+	default:
+		return false
+	}
+}
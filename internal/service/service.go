@@ -0,0 +1,29 @@
+package service
+
+import (
+	"sync"
+
+	"stock-report-analysis/internal/db"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Service is the business layer over one database. Channel limiters live
+// here too, so services over different databases never share budgets.
+type Service struct {
+	db *sqlx.DB
+	// dataDir holds files kept next to the database; empty for an
+	// in-memory database, which disables the file caches.
+	dataDir string
+
+	limitersMu sync.Mutex
+	limiters   map[int64]*channelLimiter
+}
+
+func New(store *db.Store) *Service {
+	return &Service{
+		db:       store.DB,
+		dataDir:  store.Dir(),
+		limiters: map[int64]*channelLimiter{},
+	}
+}
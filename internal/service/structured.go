@@ -0,0 +1,305 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"stock-report-analysis/internal/models"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	structuredItemRisk     = "risk"
+	structuredItemCatalyst = "catalyst"
+
+	StructuredFieldSummary       = "summary"
+	StructuredFieldRisks         = "risks"
+	StructuredFieldCatalysts     = "catalysts"
+	StructuredFieldValuationView = "valuationView"
+)
+
+var trailingCommaPattern = regexp.MustCompile(`,\s*([}\]])`)
+
+const structuredRepairPrompt = `你是 JSON 修复助手。用户会给出一段未通过校验的模型输出及校验错误，请在不改变原意的前提下将其修正为满足 Schema 的 JSON 对象。缺失的字段用空字符串或空数组补齐，禁止编造新内容。`
+
+// ParseStructuredAnalysis validates a structured-mode reply against the
+// built-in summary/risks/catalysts/valuationView schema.
+func ParseStructuredAnalysis(raw string) (models.StructuredAnalysis, error) {
+	return ParseStructuredAnalysisWithSchema(raw, "")
+}
+
+// ParseStructuredAnalysisWithSchema validates a structured-mode reply against
+// a prompt's JSON Schema, or the built-in one when schema is empty. Markdown
+// code fences and trailing commas are tolerated. Malformed JSON is a plain
+// error; a well-formed reply that breaks the schema is a
+// *SchemaViolationError.
+func ParseStructuredAnalysisWithSchema(raw string, schema string) (models.StructuredAnalysis, error) {
+	body := extractJSONObject(raw)
+	if body == "" {
+		return models.StructuredAnalysis{}, errors.New("结构化结果不是 JSON 对象")
+	}
+
+	var obj map[string]any
+	if err := json.Unmarshal([]byte(body), &obj); err != nil {
+		repaired := trailingCommaPattern.ReplaceAllString(body, "$1")
+		if json.Unmarshal([]byte(repaired), &obj) != nil {
+			return models.StructuredAnalysis{}, fmt.Errorf("结构化结果 JSON 解析失败: %w", err)
+		}
+		body = repaired
+	}
+
+	if strings.TrimSpace(schema) == "" {
+		schema = defaultStructuredSchema
+	}
+	node, err := parseSchema(schema)
+	if err != nil {
+		return models.StructuredAnalysis{}, err
+	}
+	if err := validateSchemaValue(node, obj, "$"); err != nil {
+		return models.StructuredAnalysis{}, err
+	}
+
+	out := models.StructuredAnalysis{
+		Summary:       structuredString(obj, StructuredFieldSummary),
+		Risks:         structuredList(obj, StructuredFieldRisks),
+		Catalysts:     structuredList(obj, StructuredFieldCatalysts),
+		ValuationView: structuredString(obj, StructuredFieldValuationView),
+	}
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, []byte(body)); err == nil {
+		out.Payload = compact.String()
+	}
+	return out, nil
+}
+
+// structuredString and structuredList pick the well-known fields out of a
+// reply; a custom schema without them simply leaves them empty.
+func structuredString(obj map[string]any, key string) string {
+	v, _ := obj[key].(string)
+	return strings.TrimSpace(v)
+}
+
+func structuredList(obj map[string]any, key string) []string {
+	items, _ := obj[key].([]any)
+	out := make([]string, 0, len(items))
+	for _, item := range items {
+		text, ok := item.(string)
+		if !ok {
+			continue
+		}
+		if text = strings.TrimSpace(text); text != "" {
+			out = append(out, text)
+		}
+	}
+	return out
+}
+
+type structuredField struct {
+	Key   string
+	Value json.RawMessage
+}
+
+// customStructuredFields returns the top-level fields of payload in reply
+// order when it came from a prompt-defined schema, i.e. has no summary.
+func customStructuredFields(payload string) ([]structuredField, bool) {
+	if strings.TrimSpace(payload) == "" {
+		return nil, false
+	}
+	dec := json.NewDecoder(strings.NewReader(payload))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return nil, false
+	}
+	var fields []structuredField
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, false
+		}
+		key, _ := tok.(string)
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return nil, false
+		}
+		if key == StructuredFieldSummary {
+			return nil, false
+		}
+		fields = append(fields, structuredField{Key: key, Value: value})
+	}
+	return fields, true
+}
+
+func extractJSONObject(raw string) string {
+	text := strings.TrimSpace(raw)
+	text = strings.TrimPrefix(text, "```json")
+	text = strings.TrimPrefix(text, "```JSON")
+	text = strings.TrimPrefix(text, "```")
+	text = strings.TrimSuffix(strings.TrimSpace(text), "```")
+	start := strings.Index(text, "{")
+	end := strings.LastIndex(text, "}")
+	if start < 0 || end <= start {
+		return ""
+	}
+	return text[start : end+1]
+}
+
+// EnsureStructuredAnalysis parses result.Text and, when it is malformed,
+// asks the same channel once to repair it. The returned result carries the
+// repaired text and the tokens of both calls; a cached reply is replaced by
+// the repaired one so the next hit does not need repairing again.
+func (s *Service) EnsureStructuredAnalysis(ctx context.Context, in AnalysisRequest, result AnalysisResult) (AnalysisResult, models.StructuredAnalysis, error) {
+	parsed, err := ParseStructuredAnalysisWithSchema(result.Text, in.Schema)
+	if err == nil {
+		return result, parsed, nil
+	}
+
+	repairInput := fmt.Sprintf("校验错误：%s\n\n原始输出：\n%s", err.Error(), result.Text)
+	repair, repairErr := s.AnalyzeWithRequest(ctx, AnalysisRequest{
+		Channel: in.Channel,
+		Prompt:  structuredRepairPrompt,
+		Content: repairInput,
+		Mode:    AnalysisModeStructured,
+		Schema:  in.Schema,
+		Options: in.Options,
+	}, nil)
+	addResultUsage(&result, repair)
+	if repairErr != nil {
+		return result, models.StructuredAnalysis{}, fmt.Errorf("结构化结果修复失败: %w", repairErr)
+	}
+
+	parsed, err = ParseStructuredAnalysisWithSchema(repair.Text, in.Schema)
+	if err != nil {
+		return result, parsed, fmt.Errorf("结构化结果修复后仍无效: %w", err)
+	}
+	parsed.Repaired = 1
+	result.Text = formatStructuredJSON(parsed.Payload, repair.Text)
+	result.CacheHit = false
+	if result.cacheKey != "" {
+		s.storeCachedResponse(result.cacheKey, in.Channel.Model, result)
+	}
+	return result, parsed, nil
+}
+
+func formatStructuredJSON(payload string, fallback string) string {
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, []byte(payload), "", "  "); err != nil {
+		return fallback
+	}
+	return buf.String()
+}
+
+func saveStructuredAnalysisTx(tx *sqlx.Tx, articleID int64, sa *models.StructuredAnalysis) error {
+	// Any new analysis replaces the previous structured fields; a text-mode
+	// run leaves none so stale sections are not shown next to it.
+	if _, err := tx.Exec("DELETE FROM structured_analyses WHERE article_id=?", articleID); err != nil {
+		return err
+	}
+	if sa == nil {
+		return nil
+	}
+	if _, err := tx.Exec(`
+		INSERT INTO structured_analyses(article_id, summary, valuation_view, payload, repaired, updated_at)
+		VALUES(?,?,?,?,?,CURRENT_TIMESTAMP)
+	`, articleID, sa.Summary, sa.ValuationView, sa.Payload, sa.Repaired); err != nil {
+		return err
+	}
+	for kind, items := range map[string][]string{structuredItemRisk: sa.Risks, structuredItemCatalyst: sa.Catalysts} {
+		for i, item := range items {
+			if _, err := tx.Exec(`
+				INSERT INTO structured_analysis_items(article_id, kind, position, content)
+				VALUES(?,?,?,?)
+			`, articleID, kind, i, item); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Service) GetStructuredAnalysis(articleID int64) (*models.StructuredAnalysis, error) {
+	var rows []models.StructuredAnalysis
+	if err := s.db.Select(&rows, "SELECT * FROM structured_analyses WHERE article_id=?", articleID); err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+	sa := rows[0]
+
+	var items []struct {
+		Kind    string `db:"kind"`
+		Content string `db:"content"`
+	}
+	if err := s.db.Select(&items, `
+		SELECT kind, content
+		FROM structured_analysis_items
+		WHERE article_id=?
+		ORDER BY kind, position
+	`, articleID); err != nil {
+		return nil, err
+	}
+	sa.Risks = []string{}
+	sa.Catalysts = []string{}
+	for _, item := range items {
+		switch item.Kind {
+		case structuredItemRisk:
+			sa.Risks = append(sa.Risks, item.Content)
+		case structuredItemCatalyst:
+			sa.Catalysts = append(sa.Catalysts, item.Content)
+		}
+	}
+	return &sa, nil
+}
+
+// SearchStructuredAnalyses finds reports whose structured fields mention
+// keyword, e.g. field "risks" with keyword "商誉减值". An empty field searches
+// all four fields.
+func (s *Service) SearchStructuredAnalyses(field, keyword string, limit int) ([]models.StructuredAnalysisHit, error) {
+	keyword = strings.TrimSpace(keyword)
+	if keyword == "" {
+		return nil, errors.New("请输入搜索关键词")
+	}
+	if limit <= 0 || limit > 500 {
+		limit = 100
+	}
+	like := "%" + keyword + "%"
+
+	parts := make([]string, 0, 4)
+	args := make([]any, 0, 4)
+	if field == "" || field == StructuredFieldSummary {
+		parts = append(parts, `SELECT s.article_id, 'summary' AS field, s.summary AS content, s.updated_at FROM structured_analyses s WHERE s.summary LIKE ?`)
+		args = append(args, like)
+	}
+	if field == "" || field == StructuredFieldValuationView {
+		parts = append(parts, `SELECT s.article_id, 'valuationView' AS field, s.valuation_view AS content, s.updated_at FROM structured_analyses s WHERE s.valuation_view LIKE ?`)
+		args = append(args, like)
+	}
+	if field == "" || field == StructuredFieldRisks {
+		parts = append(parts, `SELECT i.article_id, 'risks' AS field, i.content, s.updated_at FROM structured_analysis_items i JOIN structured_analyses s ON s.article_id=i.article_id WHERE i.kind='risk' AND i.content LIKE ?`)
+		args = append(args, like)
+	}
+	if field == "" || field == StructuredFieldCatalysts {
+		parts = append(parts, `SELECT i.article_id, 'catalysts' AS field, i.content, s.updated_at FROM structured_analysis_items i JOIN structured_analyses s ON s.article_id=i.article_id WHERE i.kind='catalyst' AND i.content LIKE ?`)
+		args = append(args, like)
+	}
+	if len(parts) == 0 {
+		return nil, fmt.Errorf("不支持的结构化字段: %s", field)
+	}
+
+	query := `
+		SELECT h.article_id, a.title, h.field, h.content, h.updated_at
+		FROM (` + strings.Join(parts, " UNION ALL ") + `) h
+		JOIN articles a ON a.id = h.article_id
+		ORDER BY h.updated_at DESC, h.article_id DESC
+		LIMIT ?`
+	args = append(args, limit)
+
+	hits := []models.StructuredAnalysisHit{}
+	err := s.db.Select(&hits, query, args...)
+	return hits, err
+}
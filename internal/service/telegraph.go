@@ -12,7 +12,6 @@ import (
 	"strings"
 	"time"
 
-	"stock-report-analysis/internal/db"
 	"stock-report-analysis/internal/models"
 )
 
@@ -96,14 +95,19 @@ func normalizeTelegraphSchedulerConfig(cfg models.TelegraphSchedulerConfig) mode
 	if cfg.AnalysisPrompt == "" {
 		cfg.AnalysisPrompt = def.AnalysisPrompt
 	}
+	if opts, err := NormalizeGenerationOptions(cfg.GenerationOptions); err == nil {
+		cfg.GenerationOptions = opts
+	} else {
+		cfg.GenerationOptions = models.GenerationOptions{}
+	}
 	return cfg
 }
 
-func GetTelegraphSchedulerConfig() (models.TelegraphSchedulerConfig, error) {
+func (s *Service) GetTelegraphSchedulerConfig() (models.TelegraphSchedulerConfig, error) {
 	cfg := defaultTelegraphSchedulerConfig()
 
 	var raw string
-	err := db.DB.Get(&raw, "SELECT value FROM app_configs WHERE key=?", telegraphSchedulerConfigKey)
+	err := s.db.Get(&raw, "SELECT value FROM app_configs WHERE key=?", telegraphSchedulerConfigKey)
 	if errors.Is(err, sql.ErrNoRows) {
 		return cfg, nil
 	}
@@ -118,13 +122,16 @@ func GetTelegraphSchedulerConfig() (models.TelegraphSchedulerConfig, error) {
 	return normalizeTelegraphSchedulerConfig(stored), nil
 }
 
-func SaveTelegraphSchedulerConfig(cfg models.TelegraphSchedulerConfig) error {
+func (s *Service) SaveTelegraphSchedulerConfig(cfg models.TelegraphSchedulerConfig) error {
+	if _, err := NormalizeGenerationOptions(cfg.GenerationOptions); err != nil {
+		return err
+	}
 	cfg = normalizeTelegraphSchedulerConfig(cfg)
 	data, err := json.Marshal(cfg)
 	if err != nil {
 		return err
 	}
-	_, err = db.DB.Exec(`
+	_, err = s.db.Exec(`
 		INSERT INTO app_configs(key, value, updated_at)
 		VALUES(?, ?, CURRENT_TIMESTAMP)
 		ON CONFLICT(key) DO UPDATE SET value=excluded.value, updated_at=CURRENT_TIMESTAMP
@@ -207,7 +214,7 @@ func FetchTelegraphNews(ctx context.Context, sourceURL string, limit int) ([]Tel
 	return items, nil
 }
 
-func ImportTelegraphNews(item TelegraphNews) (models.Article, bool, error) {
+func (s *Service) ImportTelegraphNews(item TelegraphNews) (models.Article, bool, error) {
 	if item.NewsID <= 0 {
 		return models.Article{}, false, errors.New("news_id 无效")
 	}
@@ -215,7 +222,7 @@ func ImportTelegraphNews(item TelegraphNews) (models.Article, bool, error) {
 		return models.Article{}, false, errors.New("电报内容为空")
 	}
 
-	tx, err := db.DB.Beginx()
+	tx, err := s.db.Beginx()
 	if err != nil {
 		return models.Article{}, false, err
 	}
@@ -399,7 +406,7 @@ func detectTelegraphDirection(text string) string {
 	return "中性"
 }
 
-func UpsertTelegraphMeta(articleID int64, score int, direction string, level string) error {
+func (s *Service) UpsertTelegraphMeta(articleID int64, score int, direction string, level string) error {
 	if articleID <= 0 {
 		return nil
 	}
@@ -418,7 +425,7 @@ func UpsertTelegraphMeta(articleID int64, score int, direction string, level str
 		level = "低影响"
 	}
 
-	_, err := db.DB.Exec(`
+	_, err := s.db.Exec(`
 		INSERT INTO telegraph_meta(article_id, importance_score, impact_direction, impact_level, updated_at)
 		VALUES(?, ?, ?, ?, CURRENT_TIMESTAMP)
 		ON CONFLICT(article_id) DO UPDATE SET
@@ -430,11 +437,11 @@ func UpsertTelegraphMeta(articleID int64, score int, direction string, level str
 	return err
 }
 
-func MarkTelegraphAlertedIfNeeded(articleID int64, minScore int) (bool, error) {
+func (s *Service) MarkTelegraphAlertedIfNeeded(articleID int64, minScore int) (bool, error) {
 	if articleID <= 0 || minScore <= 0 {
 		return false, nil
 	}
-	res, err := db.DB.Exec(`
+	res, err := s.db.Exec(`
 		UPDATE telegraph_meta
 		SET alerted=1, updated_at=CURRENT_TIMESTAMP
 		WHERE article_id=? AND alerted=0 AND importance_score>=?
@@ -449,7 +456,7 @@ func MarkTelegraphAlertedIfNeeded(articleID int64, minScore int) (bool, error) {
 	return n > 0, nil
 }
 
-func AutoTagTelegraphArticle(articleID int64, title string, content string, direction string, level string) error {
+func (s *Service) AutoTagTelegraphArticle(articleID int64, title string, content string, direction string, level string) error {
 	if articleID <= 0 {
 		return nil
 	}
@@ -495,11 +502,11 @@ func AutoTagTelegraphArticle(articleID int64, title string, content string, dire
 	}
 
 	for _, tag := range tags {
-		tagID, err := EnsureTag(tag.name, tag.color)
+		tagID, err := s.EnsureTag(tag.name, tag.color)
 		if err != nil {
 			return err
 		}
-		if err := AddTagToArticle(articleID, tagID); err != nil {
+		if err := s.AddTagToArticle(articleID, tagID); err != nil {
 			return err
 		}
 	}
@@ -515,13 +522,13 @@ func hasAny(text string, keywords []string) bool {
 	return false
 }
 
-func RecordTelegraphRun(startedAt time.Time, durationMs int64, fetched int, imported int, analyzed int, errorReason string) error {
+func (s *Service) RecordTelegraphRun(startedAt time.Time, durationMs int64, fetched int, imported int, analyzed int, errorReason string) error {
 	success := 1
 	errorReason = normalizeTelegraphErrorReason(errorReason)
 	if errorReason != "" {
 		success = 0
 	}
-	_, err := db.DB.Exec(`
+	_, err := s.db.Exec(`
 		INSERT INTO telegraph_runs(
 			started_at, duration_ms, fetched, imported, analyzed, success, error_reason
 		) VALUES(?,?,?,?,?,?,?)
@@ -554,7 +561,7 @@ func normalizeTelegraphErrorReason(reason string) string {
 	}
 }
 
-func GetTelegraphDashboardByDays(days int) (models.TelegraphDashboard, error) {
+func (s *Service) GetTelegraphDashboardByDays(days int) (models.TelegraphDashboard, error) {
 	dashboard := models.TelegraphDashboard{}
 	if days < 0 {
 		days = 0
@@ -568,7 +575,7 @@ func GetTelegraphDashboardByDays(days int) (models.TelegraphDashboard, error) {
 		TotalAnalyze sql.NullInt64 `db:"total_analyzed"`
 		AvgDuration  sql.NullInt64 `db:"avg_duration_ms"`
 	}{}
-	if err := db.DB.Get(&total, fmt.Sprintf(`
+	if err := s.db.Get(&total, fmt.Sprintf(`
 		SELECT
 			COUNT(*) AS total_runs,
 			SUM(fetched) AS total_fetched,
@@ -597,7 +604,7 @@ func GetTelegraphDashboardByDays(days int) (models.TelegraphDashboard, error) {
 		Count  int64  `db:"count"`
 	}{}
 	reasonClause, reasonArgs := buildTelegraphFailureFilter(days)
-	if err := db.DB.Select(&reasonRows, fmt.Sprintf(`
+	if err := s.db.Select(&reasonRows, fmt.Sprintf(`
 		SELECT error_reason AS reason, COUNT(*) AS count
 		FROM telegraph_runs
 		%s
@@ -643,12 +650,12 @@ type TelegraphDigestSource struct {
 	CreatedAt       time.Time `db:"created_at"`
 }
 
-func GetTelegraphDigestSource(slotStart time.Time, slotEnd time.Time, limit int) ([]TelegraphDigestSource, error) {
+func (s *Service) GetTelegraphDigestSource(slotStart time.Time, slotEnd time.Time, limit int) ([]TelegraphDigestSource, error) {
 	if limit <= 0 {
 		limit = 5
 	}
 	var rows []TelegraphDigestSource
-	err := db.DB.Select(&rows, `
+	err := s.db.Select(&rows, `
 		SELECT
 			a.id AS article_id,
 			a.title,
@@ -668,8 +675,8 @@ func GetTelegraphDigestSource(slotStart time.Time, slotEnd time.Time, limit int)
 	return rows, err
 }
 
-func SaveTelegraphDigest(slotStart time.Time, slotEnd time.Time, summary string, topItems int, avgScore int) error {
-	_, err := db.DB.Exec(`
+func (s *Service) SaveTelegraphDigest(slotStart time.Time, slotEnd time.Time, summary string, topItems int, avgScore int) error {
+	_, err := s.db.Exec(`
 		INSERT INTO telegraph_digests(slot_start, slot_end, summary, top_items, avg_score)
 		VALUES(?,?,?,?,?)
 		ON CONFLICT(slot_start, slot_end) DO UPDATE SET
@@ -681,15 +688,15 @@ func SaveTelegraphDigest(slotStart time.Time, slotEnd time.Time, summary string,
 	return err
 }
 
-func HasTelegraphDigestSlot(slotStart time.Time, slotEnd time.Time) (bool, error) {
+func (s *Service) HasTelegraphDigestSlot(slotStart time.Time, slotEnd time.Time) (bool, error) {
 	var n int
-	if err := db.DB.Get(&n, "SELECT COUNT(1) FROM telegraph_digests WHERE slot_start=? AND slot_end=?", slotStart, slotEnd); err != nil {
+	if err := s.db.Get(&n, "SELECT COUNT(1) FROM telegraph_digests WHERE slot_start=? AND slot_end=?", slotStart, slotEnd); err != nil {
 		return false, err
 	}
 	return n > 0, nil
 }
 
-func GetTelegraphDigests(limit int) ([]models.TelegraphDigest, error) {
+func (s *Service) GetTelegraphDigests(limit int) ([]models.TelegraphDigest, error) {
 	if limit <= 0 {
 		limit = 6
 	}
@@ -697,7 +704,7 @@ func GetTelegraphDigests(limit int) ([]models.TelegraphDigest, error) {
 		limit = 50
 	}
 	var items []models.TelegraphDigest
-	err := db.DB.Select(&items, `
+	err := s.db.Select(&items, `
 		SELECT id, slot_start, slot_end, summary, top_items, avg_score, created_at
 		FROM telegraph_digests
 		ORDER BY slot_end DESC, id DESC
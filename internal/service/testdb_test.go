@@ -0,0 +1,46 @@
+package service
+
+import (
+	"testing"
+
+	"stock-report-analysis/internal/db"
+	"stock-report-analysis/internal/llmtest"
+	"stock-report-analysis/internal/models"
+)
+
+// newTestService returns a service over a fresh in-memory database.
+func newTestService(t *testing.T) *Service {
+	t.Helper()
+	store, err := db.OpenMemory()
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return New(store)
+}
+
+// saveDefaultChannel stores srv as the default channel and returns it with its ID.
+func saveDefaultChannel(t *testing.T, svc *Service, srv *llmtest.Server) models.AIChannel {
+	t.Helper()
+	ch := srv.Channel()
+	ch.ID = 0
+	ch.IsDefault = 1
+	if err := svc.SaveChannel(ch); err != nil {
+		t.Fatalf("save channel: %v", err)
+	}
+	channels, err := svc.GetChannels()
+	if err != nil || len(channels) == 0 {
+		t.Fatalf("load channels: %v", err)
+	}
+	return channels[0]
+}
+
+func insertTestArticle(t *testing.T, svc *Service, title, content string) int64 {
+	t.Helper()
+	res, err := svc.db.Exec("INSERT INTO articles(title, content) VALUES(?, ?)", title, content)
+	if err != nil {
+		t.Fatalf("insert article: %v", err)
+	}
+	id, _ := res.LastInsertId()
+	return id
+}
@@ -0,0 +1,41 @@
+package service
+
+import (
+	"unicode"
+)
+
+// EstimateTokens approximates the token count of mixed Chinese/English text
+// without a model-specific tokenizer. It errs on the high side: each CJK
+// character counts as one token, runs of Latin letters and digits as one
+// token per four characters, and other symbols as one token each.
+func EstimateTokens(text string) int {
+	tokens := 0
+	word := 0
+	flushWord := func() {
+		tokens += (word + 3) / 4
+		word = 0
+	}
+	for _, r := range text {
+		switch {
+		case r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)):
+			word++
+		case unicode.IsSpace(r):
+			flushWord()
+		case isCJK(r):
+			flushWord()
+			tokens++
+		default:
+			flushWord()
+			tokens++
+		}
+	}
+	flushWord()
+	return tokens
+}
+
+func isCJK(r rune) bool {
+	return unicode.Is(unicode.Han, r) ||
+		unicode.Is(unicode.Hiragana, r) ||
+		unicode.Is(unicode.Katakana, r) ||
+		unicode.Is(unicode.Hangul, r)
+}
@@ -0,0 +1,25 @@
+package service
+
+import "testing"
+
+func TestEstimateTokens(t *testing.T) {
+	cases := []struct {
+		name, text string
+		want       int
+	}{
+		{"empty", "", 0},
+		{"chinese", "宁德时代储能业务", 8},
+		{"chinese punctuation", "营收增长，利润下滑。", 10},
+		{"english words", "Revenue grew fast", 4},    // 2 + 1 + 1
+		{"long word", "internationalization", 5},     // 20 letters
+		{"digits and symbols", "EPS 3.25 (+12%)", 9}, // EPS, 3, ., 25, (, +, 12, %, )
+		{"mixed", "2026 年营收 398 亿元", 7},              // 2026, 年, 营, 收, 398, 亿, 元
+		{"mixed without spaces", "ROE提升至18.5%", 8},   // ROE, 提, 升, 至, 18, ., 5, %
+		{"japanese and korean", "ひらがなカタカナ한국", 10},
+	}
+	for _, tc := range cases {
+		if got := EstimateTokens(tc.text); got != tc.want {
+			t.Errorf("%s: EstimateTokens(%q) = %d, want %d", tc.name, tc.text, got, tc.want)
+		}
+	}
+}
@@ -9,7 +9,6 @@ import (
 	"regexp"
 	"strings"
 
-	"stock-report-analysis/internal/db"
 	"stock-report-analysis/internal/models"
 )
 
@@ -44,11 +43,11 @@ func validateGitHubRepo(repo string) error {
 	return nil
 }
 
-func GetAppUpdateConfig() (models.AppUpdateConfig, error) {
+func (s *Service) GetAppUpdateConfig() (models.AppUpdateConfig, error) {
 	cfg := defaultAppUpdateConfig()
 
 	var raw string
-	err := db.DB.Get(&raw, "SELECT value FROM app_configs WHERE key=?", appUpdateConfigKey)
+	err := s.db.Get(&raw, "SELECT value FROM app_configs WHERE key=?", appUpdateConfigKey)
 	if errors.Is(err, sql.ErrNoRows) {
 		return cfg, nil
 	}
@@ -67,7 +66,7 @@ func GetAppUpdateConfig() (models.AppUpdateConfig, error) {
 	return stored, nil
 }
 
-func SaveAppUpdateConfig(cfg models.AppUpdateConfig) error {
+func (s *Service) SaveAppUpdateConfig(cfg models.AppUpdateConfig) error {
 	cfg.GitHubRepo = normalizeGitHubRepo(cfg.GitHubRepo)
 	if err := validateGitHubRepo(cfg.GitHubRepo); err != nil {
 		return err
@@ -76,7 +75,7 @@ func SaveAppUpdateConfig(cfg models.AppUpdateConfig) error {
 	if err != nil {
 		return err
 	}
-	_, err = db.DB.Exec(`
+	_, err = s.db.Exec(`
 		INSERT INTO app_configs(key, value, updated_at)
 		VALUES(?, ?, CURRENT_TIMESTAMP)
 		ON CONFLICT(key) DO UPDATE SET value=excluded.value, updated_at=CURRENT_TIMESTAMP
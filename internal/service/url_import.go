@@ -0,0 +1,167 @@
+package service
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"stock-report-analysis/internal/models"
+)
+
+// maxURLImportBytes caps a downloaded page or document.
+const maxURLImportBytes = 64 << 20
+
+var urlImportHTTPClient = &http.Client{
+	Timeout: 60 * time.Second,
+}
+
+// ImportURL downloads rawURL and imports it as an article whose source is
+// the URL. HTML pages keep only their main body; PDFs and other documents
+// go through the document parsers. A URL imported before returns the existing article
+// without downloading; other duplicates are handled as in ImportFile.
+func (s *Service) ImportURL(rawURL string, force bool) (models.ImportResult, error) {
+	source, err := normalizeImportURL(rawURL)
+	if err != nil {
+		return models.ImportResult{}, err
+	}
+	if existing, err := s.articleBySource(source); err != nil {
+		return models.ImportResult{}, err
+	} else if existing.ID > 0 {
+		result := duplicateResult(existing, duplicateExact)
+		result.Message = fmt.Sprintf("该网址已导入为《%s》", existing.Title)
+		return result, nil
+	}
+
+	req, err := http.NewRequest("GET", source, nil)
+	if err != nil {
+		return models.ImportResult{}, err
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.0 Safari/605.1.15")
+	req.Header.Set("Accept", "text/html,application/xhtml+xml,application/pdf;q=0.9,*/*;q=0.8")
+	resp, err := urlImportHTTPClient.Do(req)
+	if err != nil {
+		return models.ImportResult{}, fmt.Errorf("下载失败: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return models.ImportResult{}, fmt.Errorf("下载失败: HTTP %d, %s", resp.StatusCode, string(body))
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxURLImportBytes+1))
+	if err != nil {
+		return models.ImportResult{}, fmt.Errorf("下载失败: %w", err)
+	}
+	if len(body) > maxURLImportBytes {
+		return models.ImportResult{}, fmt.Errorf("文件超过 %d MB，请下载后从本地导入", maxURLImportBytes>>20)
+	}
+
+	fileHash := hashBytes(body)
+	existing, kind, err := s.findDuplicate(articleFingerprint{fileHash: fileHash}, true)
+	if err != nil {
+		return models.ImportResult{}, err
+	}
+	if kind != "" {
+		return duplicateResult(existing, kind), nil
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	fileName := urlFileName(resp)
+	var title string
+	var doc parsedDocument
+	switch mediaType, _, _ := mime.ParseMediaType(contentType); {
+	case mediaType == "application/pdf" || bytes.HasPrefix(body, []byte("%PDF-")) ||
+		isMinerUSupportedFile(strings.ToLower(filepath.Ext(fileName))):
+		if filepath.Ext(fileName) == "" {
+			fileName += ".pdf"
+		}
+		doc, err = s.parseDownloadedDocument(fileName, body, fileHash)
+		if err != nil {
+			return models.ImportResult{}, fmt.Errorf("文档解析失败: %w", err)
+		}
+		title = strings.TrimSuffix(fileName, filepath.Ext(fileName))
+	case mediaType == "text/plain" || mediaType == "text/markdown":
+		doc.Markdown = string(body)
+	default:
+		title, doc.Markdown, err = extractReadableHTML(body, contentType)
+		if err != nil {
+			return models.ImportResult{}, err
+		}
+	}
+	if strings.TrimSpace(doc.Markdown) == "" {
+		return models.ImportResult{}, errors.New("未能从页面中提取到正文")
+	}
+	if title = strings.TrimSpace(title); title == "" {
+		title = strings.TrimSuffix(fileName, filepath.Ext(fileName))
+	}
+	return s.saveImport(title, doc, source, fileHash, force)
+}
+
+func (s *Service) articleBySource(source string) (models.Article, error) {
+	var a models.Article
+	err := s.db.Get(&a, "SELECT id,title,source,status,created_at,analyzed_at FROM articles WHERE source=? ORDER BY id LIMIT 1", source)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Article{}, nil
+	}
+	return a, err
+}
+
+// normalizeImportURL checks that rawURL is an http(s) URL and returns the
+// form stored in articles.source, so the same page always compares equal.
+func normalizeImportURL(rawURL string) (string, error) {
+	rawURL = strings.TrimSpace(rawURL)
+	if rawURL != "" && !strings.Contains(rawURL, "://") {
+		rawURL = "https://" + rawURL
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return "", errors.New("请输入有效的网址")
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", errors.New("仅支持 http/https 网址")
+	}
+	u.Host = strings.ToLower(u.Host)
+	u.Fragment = ""
+	u.RawFragment = ""
+	return u.String(), nil
+}
+
+// urlFileName names the download after Content-Disposition, or the last
+// path segment of the final URL, or its host.
+func urlFileName(resp *http.Response) string {
+	if _, params, err := mime.ParseMediaType(resp.Header.Get("Content-Disposition")); err == nil {
+		if name := filepath.Base(params["filename"]); name != "." && name != "/" && name != "" {
+			return name
+		}
+	}
+	u := resp.Request.URL
+	if name, err := url.PathUnescape(path.Base(u.Path)); err == nil && name != "." && name != "/" && name != "" {
+		return name
+	}
+	return u.Hostname()
+}
+
+// parseDownloadedDocument writes data to a temporary file named fileName,
+// since parsers read from a file, and parses it.
+func (s *Service) parseDownloadedDocument(fileName string, data []byte, fileHash string) (parsedDocument, error) {
+	dir, err := os.MkdirTemp("", "url-import-")
+	if err != nil {
+		return parsedDocument{}, err
+	}
+	defer os.RemoveAll(dir)
+	filePath := filepath.Join(dir, fileName)
+	if err := os.WriteFile(filePath, data, 0o600); err != nil {
+		return parsedDocument{}, err
+	}
+	return s.parseDocument(filePath, fileHash)
+}
@@ -0,0 +1,91 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const researchNotePage = `<!DOCTYPE html>
+<html><head>
+<meta charset="utf-8">
+<title>宁德时代调研纪要 - 某某财经</title>
+</head><body>
+<header class="site-header"><a href="/">首页</a><a href="/news">要闻</a></header>
+<nav><ul><li><a href="/a">行情</a></li><li><a href="/b">研报</a></li></ul></nav>
+<div class="ad-banner">开户送好礼，点击领取！</div>
+<div id="main-content" class="article-body">
+  <h1>宁德时代调研纪要</h1>
+  <p>公司表示，三季度储能电池出货量环比增长三成，海外订单占比持续提升，毛利率保持稳定。</p>
+  <p>管理层预计，明年钠离子电池将进入量产阶段，<b>成本</b>较磷酸铁锂电池再下降约一成，主要用于两轮车与储能场景。</p>
+  <ul><li>欧洲工厂爬坡顺利</li><li>资本开支趋于平稳</li></ul>
+</div>
+<aside class="sidebar"><p>热门文章：这是一条很长的推荐阅读标题，用来测试侧栏内容不会被提取。</p></aside>
+<div class="related-links"><a href="/1">相关阅读一：锂电板块全线走强，多只个股涨停</a></div>
+<footer>版权所有 © 某某财经</footer>
+<script>var tracking = "不应出现";</script>
+</body></html>`
+
+func TestExtractReadableHTML(t *testing.T) {
+	title, content, err := extractReadableHTML([]byte(researchNotePage), "text/html; charset=utf-8")
+	if err != nil {
+		t.Fatalf("extract: %v", err)
+	}
+	if title != "宁德时代调研纪要" {
+		t.Errorf("title = %q", title)
+	}
+	for _, want := range []string{"储能电池出货量环比增长三成", "成本较磷酸铁锂电池", "- 欧洲工厂爬坡顺利"} {
+		if !strings.Contains(content, want) {
+			t.Errorf("content lacks %q:\n%s", want, content)
+		}
+	}
+	for _, unwanted := range []string{"首页", "行情", "开户送好礼", "热门文章", "相关阅读", "版权所有", "tracking", "# 宁德时代调研纪要"} {
+		if strings.Contains(content, unwanted) {
+			t.Errorf("content keeps %q:\n%s", unwanted, content)
+		}
+	}
+}
+
+func TestImportURL(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/notes/catl", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(researchNotePage))
+	})
+	mux.HandleFunc("/files/announcement.pdf", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write([]byte("%PDF-1.7\n"))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	svc := newTestService(t)
+
+	result, err := svc.ImportURL(srv.URL+"/notes/catl#comments", false)
+	if err != nil || result.Duplicate != "" {
+		t.Fatalf("import = %+v, %v", result, err)
+	}
+	article := result.Article
+	if article.Title != "宁德时代调研纪要" || article.Source != srv.URL+"/notes/catl" {
+		t.Fatalf("article = %q from %q", article.Title, article.Source)
+	}
+	if !strings.Contains(article.Content, "钠离子电池") || strings.Contains(article.Content, "开户送好礼") {
+		t.Fatalf("content = %q", article.Content)
+	}
+
+	result, err = svc.ImportURL(" "+srv.URL+"/notes/catl ", false)
+	if err != nil || result.Duplicate != duplicateExact || result.Article.ID != article.ID {
+		t.Fatalf("second import = %+v, %v", result, err)
+	}
+
+	// MinerU is off by default, so reaching it proves the PDF was routed there.
+	if _, err := svc.ImportURL(srv.URL+"/files/announcement.pdf", false); err == nil || !strings.Contains(err.Error(), "MinerU") {
+		t.Fatalf("pdf import err = %v", err)
+	}
+
+	for _, bad := range []string{"", "ftp://example.com/a.pdf", "http://"} {
+		if _, err := svc.ImportURL(bad, false); err == nil {
+			t.Errorf("%q: expected an error", bad)
+		}
+	}
+}
@@ -8,7 +8,6 @@ import (
 	"sort"
 	"strings"
 
-	"stock-report-analysis/internal/db"
 	"stock-report-analysis/internal/models"
 )
 
@@ -16,9 +15,9 @@ const telegraphWatchlistConfigKey = "telegraph_watchlist_v1"
 
 var onlyDigitRegexp = regexp.MustCompile(`\D+`)
 
-func GetTelegraphWatchlist() ([]models.WatchStock, error) {
+func (s *Service) GetTelegraphWatchlist() ([]models.WatchStock, error) {
 	var raw string
-	err := db.DB.Get(&raw, "SELECT value FROM app_configs WHERE key=?", telegraphWatchlistConfigKey)
+	err := s.db.Get(&raw, "SELECT value FROM app_configs WHERE key=?", telegraphWatchlistConfigKey)
 	if errors.Is(err, sql.ErrNoRows) {
 		return []models.WatchStock{}, nil
 	}
@@ -33,13 +32,13 @@ func GetTelegraphWatchlist() ([]models.WatchStock, error) {
 	return normalizeWatchStocks(items), nil
 }
 
-func SaveTelegraphWatchlist(items []models.WatchStock) error {
+func (s *Service) SaveTelegraphWatchlist(items []models.WatchStock) error {
 	items = normalizeWatchStocks(items)
 	data, err := json.Marshal(items)
 	if err != nil {
 		return err
 	}
-	_, err = db.DB.Exec(`
+	_, err = s.db.Exec(`
 		INSERT INTO app_configs(key, value, updated_at)
 		VALUES(?, ?, CURRENT_TIMESTAMP)
 		ON CONFLICT(key) DO UPDATE SET value=excluded.value, updated_at=CURRENT_TIMESTAMP
@@ -97,16 +96,16 @@ func normalizeWatchStocks(items []models.WatchStock) []models.WatchStock {
 	return out
 }
 
-func RefreshTelegraphWatchHits(articleID int64, title string, content string) error {
-	watchlist, err := GetTelegraphWatchlist()
+func (s *Service) RefreshTelegraphWatchHits(articleID int64, title string, content string) error {
+	watchlist, err := s.GetTelegraphWatchlist()
 	if err != nil {
 		return err
 	}
-	return refreshTelegraphWatchHitsWithList(articleID, title, content, watchlist)
+	return s.refreshTelegraphWatchHitsWithList(articleID, title, content, watchlist)
 }
 
-func RebuildTelegraphWatchHits() error {
-	watchlist, err := GetTelegraphWatchlist()
+func (s *Service) RebuildTelegraphWatchHits() error {
+	watchlist, err := s.GetTelegraphWatchlist()
 	if err != nil {
 		return err
 	}
@@ -115,22 +114,22 @@ func RebuildTelegraphWatchHits() error {
 		Title   string `db:"title"`
 		Content string `db:"content"`
 	}{}
-	if err := db.DB.Select(&rows, "SELECT id,title,content FROM articles WHERE source LIKE ? ORDER BY id DESC", telegraphSourcePrefixLike); err != nil {
+	if err := s.db.Select(&rows, "SELECT id,title,content FROM articles WHERE source LIKE ? ORDER BY id DESC", telegraphSourcePrefixLike); err != nil {
 		return err
 	}
 	for _, row := range rows {
-		if err := refreshTelegraphWatchHitsWithList(row.ID, row.Title, row.Content, watchlist); err != nil {
+		if err := s.refreshTelegraphWatchHitsWithList(row.ID, row.Title, row.Content, watchlist); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
-func refreshTelegraphWatchHitsWithList(articleID int64, title string, content string, watchlist []models.WatchStock) error {
+func (s *Service) refreshTelegraphWatchHitsWithList(articleID int64, title string, content string, watchlist []models.WatchStock) error {
 	if articleID <= 0 {
 		return nil
 	}
-	tx, err := db.DB.Beginx()
+	tx, err := s.db.Beginx()
 	if err != nil {
 		return err
 	}